@@ -17,10 +17,14 @@
 package main
 
 import (
+	"bufio"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/01org/ciao/ciao-controller/types"
 )
@@ -29,6 +33,7 @@ var eventCommand = &command{
 	SubCommands: map[string]subCommand{
 		"list":   new(eventListCommand),
 		"delete": new(eventDeleteCommand),
+		"watch":  new(eventWatchCommand),
 	},
 }
 
@@ -149,3 +154,146 @@ func (cmd *eventDeleteCommand) run(args []string) error {
 	fmt.Printf("Deleted all event logs\n")
 	return nil
 }
+
+type eventWatchCommand struct {
+	Flag     flag.FlagSet
+	all      bool
+	tenant   string
+	types    string
+	template string
+}
+
+func (cmd *eventWatchCommand) usage(...string) {
+	fmt.Fprintf(os.Stderr, `usage: ciao-cli [options] event watch [flags]
+
+Watch prints the events of the ciao cluster as they happen, until interrupted
+
+The watch flags are:
+
+`)
+	cmd.Flag.PrintDefaults()
+	fmt.Fprintf(os.Stderr, `
+The template passed to the -f option operates on a
+
+struct {
+	Type       string    // Type of event, e.g., instance_state, node_connected
+	Timestamp  time.Time // Event timestamp
+	TenantID   string    // UUID of the tenant concerned by this event
+	InstanceID string    // UUID of the instance concerned by this event
+	NodeID     string    // UUID of the node concerned by this event
+	VolumeID   string    // UUID of the volume concerned by this event
+	ExternalIP string    // External IP concerned by this event
+	From       string    // Previous state of an instance
+	To         string    // New state of an instance
+	Message    string    // Failure reason
+}
+`)
+	fmt.Fprintln(os.Stderr, templateFunctionHelp)
+	os.Exit(2)
+}
+
+func (cmd *eventWatchCommand) parseArgs(args []string) []string {
+	cmd.Flag.BoolVar(&cmd.all, "all", false, "Watch events for all tenants in a cluster")
+	cmd.Flag.StringVar(&cmd.tenant, "tenant-id", "", "Tenant ID")
+	cmd.Flag.StringVar(&cmd.types, "type", "", "Comma separated list of event types to watch")
+	cmd.Flag.StringVar(&cmd.template, "f", "", "Template used to format output")
+	cmd.Flag.Usage = func() { cmd.usage() }
+	cmd.Flag.Parse(args)
+	return cmd.Flag.Args()
+}
+
+func (cmd *eventWatchCommand) run(args []string) error {
+	if cmd.tenant == "" {
+		cmd.tenant = *tenantID
+	}
+
+	if cmd.all == false && cmd.tenant == "" {
+		errorf("Missing required -tenant-id parameter")
+		cmd.usage()
+	}
+
+	var url string
+
+	if cmd.all == true {
+		url = buildComputeURL("events/stream")
+	} else {
+		url = buildComputeURL("%s/events/stream", cmd.tenant)
+	}
+
+	var values []queryValue
+	if cmd.types != "" {
+		for _, t := range strings.Split(cmd.types, ",") {
+			values = append(values, queryValue{
+				name:  "type",
+				value: strings.TrimSpace(t),
+			})
+		}
+	}
+
+	t := createTemplate("event-watch", cmd.template)
+
+	resp, err := sendHTTPRequest("GET", url, values, nil)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+
+		var event types.StreamEvent
+		err := json.Unmarshal([]byte(strings.TrimSpace(line[len("data:"):])), &event)
+		if err != nil {
+			errorf("Could not unmarshal event %s\n", err)
+			continue
+		}
+
+		if t != nil {
+			if err := t.Execute(os.Stdout, &event); err != nil {
+				fatalf(err.Error())
+			}
+			continue
+		}
+
+		fmt.Println(formatStreamEvent(event))
+	}
+
+	if err := scanner.Err(); err != nil {
+		fatalf(err.Error())
+	}
+
+	return nil
+}
+
+func formatStreamEvent(e types.StreamEvent) string {
+	fields := []string{e.Timestamp.Format(time.RFC3339), string(e.Type)}
+
+	if e.TenantID != "" {
+		fields = append(fields, "tenant="+e.TenantID)
+	}
+	if e.InstanceID != "" {
+		fields = append(fields, "instance="+e.InstanceID)
+	}
+	if e.NodeID != "" {
+		fields = append(fields, "node="+e.NodeID)
+	}
+	if e.VolumeID != "" {
+		fields = append(fields, "volume="+e.VolumeID)
+	}
+	if e.ExternalIP != "" {
+		fields = append(fields, "external-ip="+e.ExternalIP)
+	}
+	if e.To != "" {
+		fields = append(fields, fmt.Sprintf("%s->%s", e.From, e.To))
+	}
+	if e.Message != "" {
+		fields = append(fields, e.Message)
+	}
+
+	return strings.Join(fields, " ")
+}
@@ -57,7 +57,15 @@ const (
 	}
 	SSHIP   string                                // Instance SSH IP address
 	SSHPort int                                   // Instance SSH Port
+	KeyName string                                // Keypair injected in the instance
 	OsExtendedVolumesVolumesAttached []string     // list of attached volumes
+	StatusHistory []struct {
+		From      string                      // Previous status
+		To        string                      // New status
+		Timestamp time.Time                   // Time of the change
+	}
+	Health       string                       // healthy or unhealthy, if checked
+	HealthReason string                       // Error of the last failed check
 }`
 )
 
@@ -312,10 +320,11 @@ func validateInstanceVolumeSubArgCombo(vols *volumeFlagSlice) error {
 }
 
 // implement the flag.Value interface, eg:
-// type Value interface {
-// 	String() string
-// 	Set(string) error
-// }
+//
+//	type Value interface {
+//		String() string
+//		Set(string) error
+//	}
 func (v *volumeFlagSlice) String() string {
 	var out string
 
@@ -396,12 +405,89 @@ func (v *volumeFlagSlice) Set(value string) error {
 	return nil
 }
 
+// parameterFlags are the values of the parameters of a workload, given
+// as repeated -param name=value flags.
+type parameterFlags map[string]string
+
+func (p *parameterFlags) String() string {
+	var params []string
+	for name, value := range *p {
+		params = append(params, name+"="+value)
+	}
+	sort.Strings(params)
+
+	return strings.Join(params, ",")
+}
+
+func (p *parameterFlags) Set(value string) error {
+	i := strings.Index(value, "=")
+	if i <= 0 {
+		return fmt.Errorf("Invalid argument. Expected name=value, got \"%s\"", value)
+	}
+
+	if *p == nil {
+		*p = make(parameterFlags)
+	}
+	(*p)[value[:i]] = value[i+1:]
+
+	return nil
+}
+
+// healthCheckFlag is a health check given as a -health-check
+// protocol:port[/path] flag.
+type healthCheckFlag struct {
+	check *compute.HealthCheck
+}
+
+func (h *healthCheckFlag) String() string {
+	if h.check == nil {
+		return ""
+	}
+
+	return fmt.Sprintf("%s:%d%s", h.check.Protocol, h.check.Port, h.check.Path)
+}
+
+func (h *healthCheckFlag) Set(value string) error {
+	i := strings.Index(value, ":")
+	if i <= 0 {
+		return fmt.Errorf("Invalid argument. Expected protocol:port[/path], got \"%s\"", value)
+	}
+
+	protocol := value[:i]
+	port := value[i+1:]
+	path := ""
+	if j := strings.Index(port, "/"); j >= 0 {
+		port, path = port[:j], port[j:]
+	}
+
+	p, err := strconv.Atoi(port)
+	if err != nil || p <= 0 {
+		return fmt.Errorf("Invalid health check port \"%s\"", port)
+	}
+
+	h.check = &compute.HealthCheck{
+		Protocol: protocol,
+		Port:     p,
+		Path:     path,
+	}
+
+	return nil
+}
+
 type instanceAddCommand struct {
-	Flag      flag.FlagSet
-	workload  string
-	instances int
-	label     string
-	volumes   volumeFlagSlice
+	Flag          flag.FlagSet
+	workload      string
+	instances     int
+	label         string
+	volumes       volumeFlagSlice
+	priority      string
+	parameters    parameterFlags
+	restart       string
+	maxRestart    int
+	backoff       int
+	healthCheck   healthCheckFlag
+	healthRestart bool
+	keyName       string
 }
 
 func (cmd *instanceAddCommand) usage(...string) {
@@ -422,6 +508,14 @@ func (cmd *instanceAddCommand) parseArgs(args []string) []string {
 	cmd.Flag.IntVar(&cmd.instances, "instances", 1, "Number of instances to create")
 	cmd.Flag.StringVar(&cmd.label, "label", "", "Set a frame label. This will trigger frame tracing")
 	cmd.Flag.Var(&cmd.volumes, "volume", "volume descriptor argument list")
+	cmd.Flag.StringVar(&cmd.priority, "priority", "", "Scheduling priority (high, normal or preemptible)")
+	cmd.Flag.Var(&cmd.parameters, "param", "Workload parameter as name=value, may be repeated")
+	cmd.Flag.StringVar(&cmd.restart, "restart", "", "Restart policy overriding the workload one (never, on-failure or always)")
+	cmd.Flag.IntVar(&cmd.maxRestart, "max-restarts", 0, "Number of on-failure restarts before giving up, 0 for no limit")
+	cmd.Flag.IntVar(&cmd.backoff, "restart-backoff", 0, "Delay in seconds before the first restart, doubled with each restart")
+	cmd.Flag.Var(&cmd.healthCheck, "health-check", "Health check overriding the workload one, as tcp:port or http:port/path")
+	cmd.Flag.BoolVar(&cmd.healthRestart, "health-restart", false, "Restart the instances when they become unhealthy")
+	cmd.Flag.StringVar(&cmd.keyName, "key", "", "Name of the keypair whose public key is injected in the instances")
 	cmd.Flag.Usage = func() { cmd.usage() }
 	cmd.Flag.Parse(args)
 	return cmd.Flag.Args()
@@ -438,6 +532,16 @@ func (cmd *instanceAddCommand) validateAddCommandArgs() {
 		cmd.usage()
 	}
 
+	if cmd.restart == "" && (cmd.maxRestart != 0 || cmd.backoff != 0) {
+		errorf("-max-restarts and -restart-backoff require a -restart policy")
+		cmd.usage()
+	}
+
+	if cmd.healthRestart && cmd.healthCheck.check == nil {
+		errorf("-health-restart requires a -health-check")
+		cmd.usage()
+	}
+
 	for _, volume := range cmd.volumes {
 		//NOTE: volume.uuid itself may only be validated by controller as
 		//only it knows which storage interface is in use and what
@@ -469,6 +573,28 @@ func populateCreateServerRequest(cmd *instanceAddCommand, server *compute.Create
 	server.Server.Flavor = cmd.workload
 	server.Server.MaxInstances = cmd.instances
 	server.Server.MinInstances = 1
+	server.Server.Parameters = cmd.parameters
+	server.Server.KeyName = cmd.keyName
+
+	if cmd.priority != "" {
+		server.SchedulerHints = &compute.SchedulerHints{
+			Priority: cmd.priority,
+		}
+	}
+
+	if cmd.restart != "" {
+		server.Server.RestartPolicy = &compute.RestartPolicy{
+			Condition:   cmd.restart,
+			MaxRestarts: cmd.maxRestart,
+			Backoff:     cmd.backoff,
+		}
+	}
+
+	if cmd.healthCheck.check != nil {
+		check := *cmd.healthCheck.check
+		check.Restart = cmd.healthRestart
+		server.Server.HealthCheck = &check
+	}
 
 	for _, volume := range cmd.volumes {
 		bd := compute.BlockDeviceMappingV2{
@@ -894,6 +1020,13 @@ func (cmd *instanceShowCommand) run(args []string) error {
 	}
 
 	dumpInstance(&server.Server)
+
+	if len(server.Server.StatusHistory) > 0 {
+		fmt.Printf("\tStatus history:\n")
+	}
+	for _, t := range server.Server.StatusHistory {
+		fmt.Printf("\t\t%v: %s -> %s\n", t.Timestamp, t.From, t.To)
+	}
 	return nil
 }
 
@@ -909,6 +1042,16 @@ func dumpInstance(server *compute.ServerDetails) {
 		fmt.Printf("\tSSH IP: %s\n", server.SSHIP)
 		fmt.Printf("\tSSH Port: %d\n", server.SSHPort)
 	}
+	if server.KeyName != "" {
+		fmt.Printf("\tKeypair: %s\n", server.KeyName)
+	}
+	if server.Health != "" {
+		if server.HealthReason != "" {
+			fmt.Printf("\tHealth: %s (%s)\n", server.Health, server.HealthReason)
+		} else {
+			fmt.Printf("\tHealth: %s\n", server.Health)
+		}
+	}
 
 	for _, vol := range server.OsExtendedVolumesVolumesAttached {
 		fmt.Printf("\tVolume: %s\n", vol)
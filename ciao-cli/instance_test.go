@@ -14,7 +14,11 @@
 
 package main
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/01org/ciao/openstack/compute"
+)
 
 func TestVolumeBoolSubArgs(t *testing.T) {
 	var stringTests = []struct {
@@ -147,3 +151,83 @@ func TestVolumeSubArgSet(t *testing.T) {
 		}
 	}
 }
+
+func TestParameterFlagsSet(t *testing.T) {
+	var p parameterFlags
+
+	for _, value := range []string{"prefix=web", "motd=a=b", "empty="} {
+		err := p.Set(value)
+		if err != nil {
+			t.Errorf("valid parameter incorrectly refused: \"%s\"", value)
+		}
+	}
+
+	if p["prefix"] != "web" || p["motd"] != "a=b" || p["empty"] != "" {
+		t.Errorf("unexpected parameters %v", p)
+	}
+
+	if p.String() != "empty=,motd=a=b,prefix=web" {
+		t.Errorf("unexpected parameters string %s", p.String())
+	}
+
+	for _, value := range []string{"", "prefix", "=web"} {
+		err := p.Set(value)
+		if err == nil {
+			t.Errorf("invalid parameter incorrectly accepted: \"%s\"", value)
+		}
+	}
+}
+
+func TestHealthCheckFlagSet(t *testing.T) {
+	var h healthCheckFlag
+
+	err := h.Set("http:8080/healthz")
+	if err != nil {
+		t.Fatalf("valid health check incorrectly refused: %v", err)
+	}
+
+	if h.check.Protocol != "http" || h.check.Port != 8080 || h.check.Path != "/healthz" {
+		t.Errorf("unexpected health check %+v", h.check)
+	}
+
+	if h.String() != "http:8080/healthz" {
+		t.Errorf("unexpected health check string %s", h.String())
+	}
+
+	for _, value := range []string{"", "tcp", ":22", "tcp:", "tcp:ssh", "http:/healthz"} {
+		err := h.Set(value)
+		if err == nil {
+			t.Errorf("invalid health check incorrectly accepted: \"%s\"", value)
+		}
+	}
+}
+
+func TestPopulateRestartPolicy(t *testing.T) {
+	var server compute.CreateServerRequest
+
+	cmd := instanceAddCommand{workload: "workload", instances: 1}
+	populateCreateServerRequest(&cmd, &server)
+	if server.Server.RestartPolicy != nil {
+		t.Errorf("unexpected restart policy %+v", server.Server.RestartPolicy)
+	}
+
+	cmd.restart = "on-failure"
+	cmd.maxRestart = 3
+	cmd.backoff = 10
+	populateCreateServerRequest(&cmd, &server)
+
+	p := server.Server.RestartPolicy
+	if p == nil || p.Condition != "on-failure" || p.MaxRestarts != 3 || p.Backoff != 10 {
+		t.Errorf("unexpected restart policy %+v", p)
+	}
+}
+
+func TestPopulateKeyName(t *testing.T) {
+	var server compute.CreateServerRequest
+
+	cmd := instanceAddCommand{workload: "workload", instances: 1, keyName: "laptop"}
+	populateCreateServerRequest(&cmd, &server)
+	if server.Server.KeyName != "laptop" {
+		t.Errorf("expected key name laptop, got \"%s\"", server.Server.KeyName)
+	}
+}
@@ -0,0 +1,335 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/01org/ciao/openstack/compute"
+)
+
+var keypairCommand = &command{
+	SubCommands: map[string]subCommand{
+		"add":    new(keypairAddCommand),
+		"list":   new(keypairListCommand),
+		"show":   new(keypairShowCommand),
+		"delete": new(keypairDeleteCommand),
+	},
+}
+
+const keypairTemplateDesc = `struct {
+	Name        string    // Keypair name
+	Type        string    // Keypair type, ssh
+	PublicKey   string    // SSH public key
+	Fingerprint string    // MD5 fingerprint of the public key
+	UserID      string    // User owning the keypair
+	CreatedAt   time.Time // Time the keypair was created
+}`
+
+func keypairURL(name string) string {
+	if name == "" {
+		return buildComputeURL("%s/os-keypairs", *tenantID)
+	}
+
+	// keypair names may contain spaces
+	escaped := (&url.URL{Path: name}).String()
+
+	return buildComputeURL("%s/os-keypairs/%s", *tenantID, escaped)
+}
+
+func dumpKeypair(k *compute.Keypair) {
+	fmt.Printf("\tName: %s\n", k.Name)
+	fmt.Printf("\tFingerprint: %s\n", k.Fingerprint)
+	fmt.Printf("\tPublic key: %s\n", k.PublicKey)
+}
+
+type keypairAddCommand struct {
+	Flag       flag.FlagSet
+	name       string
+	publicKey  string
+	privateKey string
+}
+
+func (cmd *keypairAddCommand) usage(...string) {
+	fmt.Fprintf(os.Stderr, `usage: ciao-cli [options] keypair add [flags]
+
+Import an SSH public key as a keypair, or generate a keypair.  The private
+key of a generated keypair is only returned once, it is written to the
+-private-key file or printed.  The public key of a keypair is authorized
+in the instances created with its name.
+
+The add flags are:
+
+`)
+	cmd.Flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func (cmd *keypairAddCommand) parseArgs(args []string) []string {
+	cmd.Flag.StringVar(&cmd.name, "name", "", "Keypair name")
+	cmd.Flag.StringVar(&cmd.publicKey, "public-key", "", "SSH public key file to import, e.g. ~/.ssh/id_rsa.pub")
+	cmd.Flag.StringVar(&cmd.privateKey, "private-key", "", "File the private key of a generated keypair is written to")
+	cmd.Flag.Usage = func() { cmd.usage() }
+	cmd.Flag.Parse(args)
+	return cmd.Flag.Args()
+}
+
+func (cmd *keypairAddCommand) run(args []string) error {
+	if cmd.name == "" {
+		errorf("Missing required -name parameter")
+		cmd.usage()
+	}
+
+	if cmd.publicKey != "" && cmd.privateKey != "" {
+		errorf("-private-key cannot be used with -public-key")
+		cmd.usage()
+	}
+
+	req := compute.CreateKeypairRequest{
+		Keypair: compute.KeypairRequest{
+			Name: cmd.name,
+		},
+	}
+
+	if cmd.publicKey != "" {
+		key, err := ioutil.ReadFile(cmd.publicKey)
+		if err != nil {
+			fatalf("Unable to read public key: %v", err)
+		}
+		req.Keypair.PublicKey = string(key)
+	}
+
+	b, err := json.Marshal(req)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	resp, err := sendHTTPRequest("POST", keypairURL(""), nil, bytes.NewReader(b))
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		fatalf("Keypair creation failed: %s", resp.Status)
+	}
+
+	var keypair compute.KeypairResponse
+	err = unmarshalHTTPResponse(resp, &keypair)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	fmt.Printf("Created keypair:\n")
+	dumpKeypair(&keypair.Keypair)
+
+	private := keypair.Keypair.PrivateKey
+	if private == "" {
+		return nil
+	}
+
+	if cmd.privateKey == "" {
+		fmt.Printf("\n%s", private)
+		return nil
+	}
+
+	err = ioutil.WriteFile(cmd.privateKey, []byte(private), 0600)
+	if err != nil {
+		fatalf("Unable to write private key: %v", err)
+	}
+
+	fmt.Printf("Private key written to %s\n", cmd.privateKey)
+
+	return nil
+}
+
+type keypairListCommand struct {
+	Flag     flag.FlagSet
+	template string
+}
+
+func (cmd *keypairListCommand) usage(...string) {
+	fmt.Fprintf(os.Stderr, `usage: ciao-cli [options] keypair list
+
+List your keypairs
+
+The list flags are:
+
+`)
+	cmd.Flag.PrintDefaults()
+	fmt.Fprintf(os.Stderr, `
+The template passed to the -f option operates on a
+
+[]%s
+`, keypairTemplateDesc)
+	fmt.Fprintln(os.Stderr, templateFunctionHelp)
+	os.Exit(2)
+}
+
+func (cmd *keypairListCommand) parseArgs(args []string) []string {
+	cmd.Flag.StringVar(&cmd.template, "f", "", "Template used to format output")
+	cmd.Flag.Usage = func() { cmd.usage() }
+	cmd.Flag.Parse(args)
+	return cmd.Flag.Args()
+}
+
+func (cmd *keypairListCommand) run(args []string) error {
+	resp, err := sendHTTPRequest("GET", keypairURL(""), nil, nil)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		fatalf("Keypair list failed: %s", resp.Status)
+	}
+
+	var keypairs compute.KeypairsResponse
+	err = unmarshalHTTPResponse(resp, &keypairs)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	var list []compute.Keypair
+	for _, k := range keypairs.Keypairs {
+		list = append(list, k.Keypair)
+	}
+
+	if cmd.template != "" {
+		return outputToTemplate("keypair-list", cmd.template, &list)
+	}
+
+	for i, k := range list {
+		fmt.Printf("Keypair %d\n", i+1)
+		dumpKeypair(&k)
+	}
+
+	return nil
+}
+
+type keypairShowCommand struct {
+	Flag     flag.FlagSet
+	name     string
+	template string
+}
+
+func (cmd *keypairShowCommand) usage(...string) {
+	fmt.Fprintf(os.Stderr, `usage: ciao-cli [options] keypair show [flags]
+
+Show the details of a keypair
+
+The show flags are:
+
+`)
+	cmd.Flag.PrintDefaults()
+	fmt.Fprintf(os.Stderr, `
+The template passed to the -f option operates on a
+
+%s
+`, keypairTemplateDesc)
+	fmt.Fprintln(os.Stderr, templateFunctionHelp)
+	os.Exit(2)
+}
+
+func (cmd *keypairShowCommand) parseArgs(args []string) []string {
+	cmd.Flag.StringVar(&cmd.name, "name", "", "Keypair name")
+	cmd.Flag.StringVar(&cmd.template, "f", "", "Template used to format output")
+	cmd.Flag.Usage = func() { cmd.usage() }
+	cmd.Flag.Parse(args)
+	return cmd.Flag.Args()
+}
+
+func (cmd *keypairShowCommand) run(args []string) error {
+	if cmd.name == "" {
+		errorf("Missing required -name parameter")
+		cmd.usage()
+	}
+
+	resp, err := sendHTTPRequest("GET", keypairURL(cmd.name), nil, nil)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		fatalf("Keypair show failed: %s", resp.Status)
+	}
+
+	var keypair compute.KeypairResponse
+	err = unmarshalHTTPResponse(resp, &keypair)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	if cmd.template != "" {
+		return outputToTemplate("keypair-show", cmd.template, &keypair.Keypair)
+	}
+
+	dumpKeypair(&keypair.Keypair)
+
+	return nil
+}
+
+type keypairDeleteCommand struct {
+	Flag flag.FlagSet
+	name string
+}
+
+func (cmd *keypairDeleteCommand) usage(...string) {
+	fmt.Fprintf(os.Stderr, `usage: ciao-cli [options] keypair delete [flags]
+
+Delete a keypair.  The instances created with it keep its public key.
+
+The delete flags are:
+
+`)
+	cmd.Flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func (cmd *keypairDeleteCommand) parseArgs(args []string) []string {
+	cmd.Flag.StringVar(&cmd.name, "name", "", "Keypair name")
+	cmd.Flag.Usage = func() { cmd.usage() }
+	cmd.Flag.Parse(args)
+	return cmd.Flag.Args()
+}
+
+func (cmd *keypairDeleteCommand) run(args []string) error {
+	if cmd.name == "" {
+		errorf("Missing required -name parameter")
+		cmd.usage()
+	}
+
+	resp, err := sendHTTPRequest("DELETE", keypairURL(cmd.name), nil, nil)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		fatalf("Keypair deletion failed: %s", resp.Status)
+	}
+
+	fmt.Printf("Deleted keypair: %s\n", cmd.name)
+
+	return nil
+}
@@ -84,16 +84,19 @@ type subCommand interface {
 }
 
 var commands = map[string]subCommand{
-	"instance":    instanceCommand,
-	"workload":    workloadCommand,
-	"tenant":      tenantCommand,
-	"event":       eventCommand,
-	"node":        nodeCommand,
-	"trace":       traceCommand,
-	"image":       imageCommand,
-	"volume":      volumeCommand,
-	"pool":        poolCommand,
-	"external-ip": externalIPCommand,
+	"instance":      instanceCommand,
+	"workload":      workloadCommand,
+	"tenant":        tenantCommand,
+	"event":         eventCommand,
+	"node":          nodeCommand,
+	"trace":         traceCommand,
+	"image":         imageCommand,
+	"volume":        volumeCommand,
+	"pool":          poolCommand,
+	"schedule":      scheduleCommand,
+	"scaling-group": scalingGroupCommand,
+	"external-ip":   externalIPCommand,
+	"keypair":       keypairCommand,
 }
 
 var scopedToken string
@@ -0,0 +1,611 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/01org/ciao/ciao-controller/api"
+	"github.com/01org/ciao/ciao-controller/types"
+)
+
+var scalingGroupCommand = &command{
+	SubCommands: map[string]subCommand{
+		"create":  new(scalingGroupCreateCommand),
+		"list":    new(scalingGroupListCommand),
+		"show":    new(scalingGroupShowCommand),
+		"update":  new(scalingGroupUpdateCommand),
+		"delete":  new(scalingGroupDeleteCommand),
+		"history": new(scalingGroupHistoryCommand),
+	},
+}
+
+const scalingGroupTemplateDesc = `struct {
+	ID               string    // Scaling group UUID
+	TenantID         string    // Tenant owning the group
+	Name             string    // Name of the instances of the group
+	WorkloadID       string    // Workload of the instances of the group
+	MinInstances     int       // Minimum number of instances
+	MaxInstances     int       // Maximum number of instances
+	DesiredInstances int       // Number of instances the group keeps
+	ScaleOut         *struct {
+		Metric    string // cpu or memory
+		Threshold int    // Percentage above which the group scales out
+		Period    int    // Seconds over which the metric is averaged
+		Step      int    // Instances added
+	}
+	ScaleIn          *struct {
+		Metric    string // cpu or memory
+		Threshold int    // Percentage below which the group scales in
+		Period    int    // Seconds over which the metric is averaged
+		Step      int    // Instances removed
+	}
+	Cooldown         int       // Seconds between two scalings
+	CreateTime       time.Time // Time the group was created
+	LastScale        time.Time // Time the group last scaled
+}`
+
+const scalingActivityTemplateDesc = `struct {
+	GroupID   string    // Scaling group UUID
+	Timestamp time.Time // Time of the scaling
+	From      int       // Instances before the scaling
+	To        int       // Instances after the scaling
+	Reason    string    // Why the group scaled
+}`
+
+const scalingRuleHelp = `
+A scaling rule is given as metric:threshold:period:step, e.g., cpu:80:300:1
+scales when the average CPU usage of the running instances of the group
+goes past 80%% over 300 seconds, by one instance.  The metric is cpu or
+memory.
+`
+
+func sendScalingGroupRequest(method string, path string, req interface{}) (*http.Response, error) {
+	url, err := getCiaoResource("scaling-groups", api.ScalingGroupsV1)
+	if err != nil {
+		return nil, err
+	}
+
+	if path != "" {
+		url = fmt.Sprintf("%s/%s", url, path)
+	}
+
+	var body io.Reader
+	if req != nil {
+		b, err := json.Marshal(req)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(b)
+	}
+
+	ver := api.ScalingGroupsV1
+
+	return sendCiaoRequest(method, url, nil, body, &ver)
+}
+
+// parseScalingRule parses a metric:threshold:period:step rule, an empty
+// rule is none.
+func parseScalingRule(rule string) (*types.ScalingRule, error) {
+	if rule == "" {
+		return nil, nil
+	}
+
+	fields := strings.Split(rule, ":")
+	if len(fields) != 4 {
+		return nil, fmt.Errorf("Invalid scaling rule %q", rule)
+	}
+
+	var values [3]int
+	for i, f := range fields[1:] {
+		v, err := strconv.Atoi(f)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid scaling rule %q", rule)
+		}
+		values[i] = v
+	}
+
+	return &types.ScalingRule{
+		Metric:    types.ScalingMetric(fields[0]),
+		Threshold: values[0],
+		Period:    values[1],
+		Step:      values[2],
+	}, nil
+}
+
+func formatScalingRule(rule *types.ScalingRule) string {
+	if rule == nil {
+		return "none"
+	}
+
+	return fmt.Sprintf("%s:%d:%d:%d", rule.Metric, rule.Threshold, rule.Period, rule.Step)
+}
+
+func dumpScalingGroup(g *types.ScalingGroup) {
+	fmt.Printf("\tUUID: %s\n", g.ID)
+	fmt.Printf("\tName: %s\n", g.Name)
+	fmt.Printf("\tTenant: %s\n", g.TenantID)
+	fmt.Printf("\tWorkload: %s\n", g.WorkloadID)
+	fmt.Printf("\tInstances: %d (min %d, max %d)\n", g.DesiredInstances, g.MinInstances, g.MaxInstances)
+	fmt.Printf("\tScale out: %s\n", formatScalingRule(g.ScaleOut))
+	fmt.Printf("\tScale in: %s\n", formatScalingRule(g.ScaleIn))
+	fmt.Printf("\tCooldown: %ds\n", g.Cooldown)
+	fmt.Printf("\tLast scaled: %s\n", formatScheduleTime(g.LastScale))
+}
+
+// scalingGroupFlags are the flags setting the sizes and rules of a group.
+type scalingGroupFlags struct {
+	name     string
+	min      int
+	max      int
+	desired  int
+	scaleOut string
+	scaleIn  string
+	cooldown int
+}
+
+func (f *scalingGroupFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.name, "name", "", "Name of the instances of the group")
+	fs.IntVar(&f.min, "min", 0, "Minimum number of instances")
+	fs.IntVar(&f.max, "max", 1, "Maximum number of instances")
+	fs.IntVar(&f.desired, "desired", 0, "Number of instances to start with")
+	fs.StringVar(&f.scaleOut, "scale-out", "", "Rule scaling out the group")
+	fs.StringVar(&f.scaleIn, "scale-in", "", "Rule scaling in the group")
+	fs.IntVar(&f.cooldown, "cooldown", 300, "Seconds to wait after a scaling before scaling again")
+}
+
+// apply sets the fields of g given by the flags set on the command line,
+// all of them if all is true.
+func (f *scalingGroupFlags) apply(fs *flag.FlagSet, g *types.ScalingGroup, all bool) error {
+	var err error
+
+	set := func(fl *flag.Flag) {
+		if err != nil {
+			return
+		}
+
+		switch fl.Name {
+		case "name":
+			g.Name = f.name
+		case "min":
+			g.MinInstances = f.min
+		case "max":
+			g.MaxInstances = f.max
+		case "desired":
+			g.DesiredInstances = f.desired
+		case "scale-out":
+			g.ScaleOut, err = parseScalingRule(f.scaleOut)
+		case "scale-in":
+			g.ScaleIn, err = parseScalingRule(f.scaleIn)
+		case "cooldown":
+			g.Cooldown = f.cooldown
+		}
+	}
+
+	if all {
+		fs.VisitAll(set)
+	} else {
+		fs.Visit(set)
+	}
+
+	return err
+}
+
+type scalingGroupCreateCommand struct {
+	Flag     flag.FlagSet
+	workload string
+	tenant   string
+	group    scalingGroupFlags
+}
+
+func (cmd *scalingGroupCreateCommand) usage(...string) {
+	fmt.Fprintf(os.Stderr, `usage: ciao-cli [options] scaling-group create [flags]
+
+Create a group keeping a number of instances of a workload, scaled between
+a minimum and a maximum on the statistics of its instances.
+
+The create flags are:
+
+`)
+	cmd.Flag.PrintDefaults()
+	fmt.Fprintf(os.Stderr, scalingRuleHelp)
+	os.Exit(2)
+}
+
+func (cmd *scalingGroupCreateCommand) parseArgs(args []string) []string {
+	cmd.Flag.StringVar(&cmd.workload, "workload", "", "Workload UUID")
+	cmd.Flag.StringVar(&cmd.tenant, "tenant", "", "Tenant owning the group (Privileged)")
+	cmd.group.register(&cmd.Flag)
+	cmd.Flag.Usage = func() { cmd.usage() }
+	cmd.Flag.Parse(args)
+	return cmd.Flag.Args()
+}
+
+func (cmd *scalingGroupCreateCommand) run(args []string) error {
+	if cmd.workload == "" {
+		errorf("Missing required -workload parameter")
+		cmd.usage()
+	}
+
+	g := types.ScalingGroup{
+		TenantID:   cmd.tenant,
+		WorkloadID: cmd.workload,
+	}
+
+	err := cmd.group.apply(&cmd.Flag, &g, true)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	if g.DesiredInstances < g.MinInstances {
+		g.DesiredInstances = g.MinInstances
+	}
+
+	resp, err := sendScalingGroupRequest("POST", "", g)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	if resp.StatusCode != http.StatusCreated {
+		fatalf("Scaling group creation failed: %s", resp.Status)
+	}
+
+	err = unmarshalHTTPResponse(resp, &g)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	fmt.Printf("Created scaling group:\n")
+	dumpScalingGroup(&g)
+
+	return nil
+}
+
+type scalingGroupListCommand struct {
+	Flag     flag.FlagSet
+	template string
+}
+
+func (cmd *scalingGroupListCommand) usage(...string) {
+	fmt.Fprintf(os.Stderr, `usage: ciao-cli [options] scaling-group list
+
+List the scaling groups
+
+The list flags are:
+
+`)
+	cmd.Flag.PrintDefaults()
+	fmt.Fprintf(os.Stderr, `
+The template passed to the -f option operates on a
+
+[]%s
+`, scalingGroupTemplateDesc)
+	fmt.Fprintln(os.Stderr, templateFunctionHelp)
+	os.Exit(2)
+}
+
+func (cmd *scalingGroupListCommand) parseArgs(args []string) []string {
+	cmd.Flag.StringVar(&cmd.template, "f", "", "Template used to format output")
+	cmd.Flag.Usage = func() { cmd.usage() }
+	cmd.Flag.Parse(args)
+	return cmd.Flag.Args()
+}
+
+func (cmd *scalingGroupListCommand) run(args []string) error {
+	resp, err := sendScalingGroupRequest("GET", "", nil)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		fatalf("Scaling group list failed: %s", resp.Status)
+	}
+
+	var groups types.ListScalingGroupsResponse
+	err = unmarshalHTTPResponse(resp, &groups)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	if cmd.template != "" {
+		return outputToTemplate("scaling-group-list", cmd.template, &groups.ScalingGroups)
+	}
+
+	for i, g := range groups.ScalingGroups {
+		fmt.Printf("Scaling group %d\n", i+1)
+		dumpScalingGroup(&g)
+	}
+
+	return nil
+}
+
+type scalingGroupShowCommand struct {
+	Flag     flag.FlagSet
+	group    string
+	template string
+}
+
+func (cmd *scalingGroupShowCommand) usage(...string) {
+	fmt.Fprintf(os.Stderr, `usage: ciao-cli [options] scaling-group show [flags]
+
+Show the status of a scaling group: its instances and the averages of the
+metrics of its running instances
+
+The show flags are:
+
+`)
+	cmd.Flag.PrintDefaults()
+	fmt.Fprintf(os.Stderr, `
+The template passed to the -f option operates on a
+
+%s
+
+extended with the fields
+
+	Instances []string       // UUIDs of the instances of the group
+	Running   int            // Number of running instances
+	Metrics   map[string]int // Averages of the metrics, in percent
+`, scalingGroupTemplateDesc)
+	fmt.Fprintln(os.Stderr, templateFunctionHelp)
+	os.Exit(2)
+}
+
+func (cmd *scalingGroupShowCommand) parseArgs(args []string) []string {
+	cmd.Flag.StringVar(&cmd.group, "group", "", "Scaling group UUID")
+	cmd.Flag.StringVar(&cmd.template, "f", "", "Template used to format output")
+	cmd.Flag.Usage = func() { cmd.usage() }
+	cmd.Flag.Parse(args)
+	return cmd.Flag.Args()
+}
+
+func (cmd *scalingGroupShowCommand) run(args []string) error {
+	if cmd.group == "" {
+		errorf("Missing required -group parameter")
+		cmd.usage()
+	}
+
+	resp, err := sendScalingGroupRequest("GET", cmd.group, nil)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		fatalf("Scaling group show failed: %s", resp.Status)
+	}
+
+	var status types.ScalingGroupStatus
+	err = unmarshalHTTPResponse(resp, &status)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	if cmd.template != "" {
+		return outputToTemplate("scaling-group-show", cmd.template, &status)
+	}
+
+	dumpScalingGroup(&status.ScalingGroup)
+	fmt.Printf("\tRunning: %d\n", status.Running)
+
+	var metrics []string
+	for m, v := range status.Metrics {
+		metrics = append(metrics, fmt.Sprintf("%s %d%%", m, v))
+	}
+	sort.Strings(metrics)
+	fmt.Printf("\tMetrics: %s\n", strings.Join(metrics, ", "))
+
+	for _, i := range status.Instances {
+		fmt.Printf("\tInstance: %s\n", i)
+	}
+
+	return nil
+}
+
+type scalingGroupUpdateCommand struct {
+	Flag  flag.FlagSet
+	id    string
+	group scalingGroupFlags
+}
+
+func (cmd *scalingGroupUpdateCommand) usage(...string) {
+	fmt.Fprintf(os.Stderr, `usage: ciao-cli [options] scaling-group update [flags]
+
+Change the name, sizes, rules or cooldown of a scaling group.  The flags
+which are not given are left unchanged, an empty rule removes it.
+
+The update flags are:
+
+`)
+	cmd.Flag.PrintDefaults()
+	fmt.Fprintf(os.Stderr, scalingRuleHelp)
+	os.Exit(2)
+}
+
+func (cmd *scalingGroupUpdateCommand) parseArgs(args []string) []string {
+	cmd.Flag.StringVar(&cmd.id, "group", "", "Scaling group UUID")
+	cmd.group.register(&cmd.Flag)
+	cmd.Flag.Usage = func() { cmd.usage() }
+	cmd.Flag.Parse(args)
+	return cmd.Flag.Args()
+}
+
+func (cmd *scalingGroupUpdateCommand) run(args []string) error {
+	if cmd.id == "" {
+		errorf("Missing required -group parameter")
+		cmd.usage()
+	}
+
+	resp, err := sendScalingGroupRequest("GET", cmd.id, nil)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		fatalf("Scaling group show failed: %s", resp.Status)
+	}
+
+	var status types.ScalingGroupStatus
+	err = unmarshalHTTPResponse(resp, &status)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	g := status.ScalingGroup
+	g.Links = nil
+
+	err = cmd.group.apply(&cmd.Flag, &g, false)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	resp, err = sendScalingGroupRequest("PUT", cmd.id, g)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		fatalf("Scaling group update failed: %s", resp.Status)
+	}
+
+	err = unmarshalHTTPResponse(resp, &g)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	fmt.Printf("Updated scaling group:\n")
+	dumpScalingGroup(&g)
+
+	return nil
+}
+
+type scalingGroupDeleteCommand struct {
+	Flag  flag.FlagSet
+	group string
+}
+
+func (cmd *scalingGroupDeleteCommand) usage(...string) {
+	fmt.Fprintf(os.Stderr, `usage: ciao-cli [options] scaling-group delete [flags]
+
+Delete a scaling group and its instances
+
+The delete flags are:
+
+`)
+	cmd.Flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func (cmd *scalingGroupDeleteCommand) parseArgs(args []string) []string {
+	cmd.Flag.StringVar(&cmd.group, "group", "", "Scaling group UUID")
+	cmd.Flag.Usage = func() { cmd.usage() }
+	cmd.Flag.Parse(args)
+	return cmd.Flag.Args()
+}
+
+func (cmd *scalingGroupDeleteCommand) run(args []string) error {
+	if cmd.group == "" {
+		errorf("Missing required -group parameter")
+		cmd.usage()
+	}
+
+	resp, err := sendScalingGroupRequest("DELETE", cmd.group, nil)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		fatalf("Scaling group deletion failed: %s", resp.Status)
+	}
+
+	fmt.Printf("Deleted scaling group: %s\n", cmd.group)
+
+	return nil
+}
+
+type scalingGroupHistoryCommand struct {
+	Flag     flag.FlagSet
+	group    string
+	template string
+}
+
+func (cmd *scalingGroupHistoryCommand) usage(...string) {
+	fmt.Fprintf(os.Stderr, `usage: ciao-cli [options] scaling-group history [flags]
+
+List the scalings of a group, oldest first
+
+The history flags are:
+
+`)
+	cmd.Flag.PrintDefaults()
+	fmt.Fprintf(os.Stderr, `
+The template passed to the -f option operates on a
+
+[]%s
+`, scalingActivityTemplateDesc)
+	fmt.Fprintln(os.Stderr, templateFunctionHelp)
+	os.Exit(2)
+}
+
+func (cmd *scalingGroupHistoryCommand) parseArgs(args []string) []string {
+	cmd.Flag.StringVar(&cmd.group, "group", "", "Scaling group UUID")
+	cmd.Flag.StringVar(&cmd.template, "f", "", "Template used to format output")
+	cmd.Flag.Usage = func() { cmd.usage() }
+	cmd.Flag.Parse(args)
+	return cmd.Flag.Args()
+}
+
+func (cmd *scalingGroupHistoryCommand) run(args []string) error {
+	if cmd.group == "" {
+		errorf("Missing required -group parameter")
+		cmd.usage()
+	}
+
+	resp, err := sendScalingGroupRequest("GET", cmd.group+"/activities", nil)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		fatalf("Scaling group history failed: %s", resp.Status)
+	}
+
+	var activities types.ListScalingActivitiesResponse
+	err = unmarshalHTTPResponse(resp, &activities)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	if cmd.template != "" {
+		return outputToTemplate("scaling-group-history", cmd.template, &activities.Activities)
+	}
+
+	for _, a := range activities.Activities {
+		fmt.Printf("%s: %d to %d instances: %s\n", formatScheduleTime(a.Timestamp), a.From, a.To, a.Reason)
+	}
+
+	return nil
+}
@@ -0,0 +1,348 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/01org/ciao/ciao-controller/api"
+	"github.com/01org/ciao/ciao-controller/types"
+)
+
+var scheduleCommand = &command{
+	SubCommands: map[string]subCommand{
+		"add":    new(scheduleAddCommand),
+		"list":   new(scheduleListCommand),
+		"show":   new(scheduleShowCommand),
+		"delete": new(scheduleDeleteCommand),
+	},
+}
+
+const scheduleTemplateDesc = `struct {
+	ID         string    // Schedule UUID
+	TenantID   string    // Tenant owning the scheduled instances
+	InstanceID string    // Scheduled instance, if any
+	Tag        string    // Tag of the scheduled instances, if any
+	Action     string    // stop, start, restart or delete
+	Cron       string    // Cron expression of a recurring schedule
+	CreateTime time.Time // Time the schedule was created
+	LastRun    time.Time // Time the schedule last ran
+	NextRun    time.Time // Time the schedule runs next
+}`
+
+func sendScheduleRequest(method string, ID string, req interface{}) (*http.Response, error) {
+	url, err := getCiaoResource("schedules", api.SchedulesV1)
+	if err != nil {
+		return nil, err
+	}
+
+	if ID != "" {
+		url = fmt.Sprintf("%s/%s", url, ID)
+	}
+
+	var body io.Reader
+	if req != nil {
+		b, err := json.Marshal(req)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(b)
+	}
+
+	ver := api.SchedulesV1
+
+	return sendCiaoRequest(method, url, nil, body, &ver)
+}
+
+func formatScheduleTime(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+
+	return t.Local().Format(time.RFC1123)
+}
+
+func dumpSchedule(s *types.Schedule) {
+	fmt.Printf("\tUUID: %s\n", s.ID)
+	fmt.Printf("\tTenant: %s\n", s.TenantID)
+	if s.InstanceID != "" {
+		fmt.Printf("\tInstance: %s\n", s.InstanceID)
+	} else {
+		fmt.Printf("\tTag: %s\n", s.Tag)
+	}
+	fmt.Printf("\tAction: %s\n", s.Action)
+	if s.Cron != "" {
+		fmt.Printf("\tCron: %s\n", s.Cron)
+	}
+	fmt.Printf("\tLast run: %s\n", formatScheduleTime(s.LastRun))
+	fmt.Printf("\tNext run: %s\n", formatScheduleTime(s.NextRun))
+}
+
+type scheduleAddCommand struct {
+	Flag     flag.FlagSet
+	instance string
+	tag      string
+	tenant   string
+	action   string
+	cron     string
+	after    string
+}
+
+func (cmd *scheduleAddCommand) usage(...string) {
+	fmt.Fprintf(os.Stderr, `usage: ciao-cli [options] schedule add [flags]
+
+Schedule an action on an instance, or on the instances with a tag.  The
+action runs at the times matched by a cron expression, e.g., "0 19 * * 1-5",
+or once after a duration, e.g., 8h.
+
+The add flags are:
+
+`)
+	cmd.Flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func (cmd *scheduleAddCommand) parseArgs(args []string) []string {
+	cmd.Flag.StringVar(&cmd.instance, "instance", "", "Instance UUID")
+	cmd.Flag.StringVar(&cmd.tag, "tag", "", "Tag of the instances")
+	cmd.Flag.StringVar(&cmd.tenant, "tenant", "", "Tenant of the tagged instances (Privileged)")
+	cmd.Flag.StringVar(&cmd.action, "action", "", "Action to run: stop, start, restart or delete")
+	cmd.Flag.StringVar(&cmd.cron, "cron", "", "Cron expression of the times the action runs")
+	cmd.Flag.StringVar(&cmd.after, "after", "", "Duration after which the action runs once")
+	cmd.Flag.Usage = func() { cmd.usage() }
+	cmd.Flag.Parse(args)
+	return cmd.Flag.Args()
+}
+
+func (cmd *scheduleAddCommand) run(args []string) error {
+	if (cmd.instance == "") == (cmd.tag == "") {
+		errorf("One of -instance or -tag is required")
+		cmd.usage()
+	}
+
+	if cmd.action == "" {
+		errorf("Missing required -action parameter")
+		cmd.usage()
+	}
+
+	if (cmd.cron == "") == (cmd.after == "") {
+		errorf("One of -cron or -after is required")
+		cmd.usage()
+	}
+
+	req := types.ScheduleRequest{
+		TenantID:   cmd.tenant,
+		InstanceID: cmd.instance,
+		Tag:        cmd.tag,
+		Action:     types.ScheduleAction(cmd.action),
+		Cron:       cmd.cron,
+		After:      cmd.after,
+	}
+
+	resp, err := sendScheduleRequest("POST", "", req)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	if resp.StatusCode != http.StatusCreated {
+		fatalf("Schedule creation failed: %s", resp.Status)
+	}
+
+	var s types.Schedule
+	err = unmarshalHTTPResponse(resp, &s)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	fmt.Printf("Created schedule:\n")
+	dumpSchedule(&s)
+
+	return nil
+}
+
+type scheduleListCommand struct {
+	Flag     flag.FlagSet
+	template string
+}
+
+func (cmd *scheduleListCommand) usage(...string) {
+	fmt.Fprintf(os.Stderr, `usage: ciao-cli [options] schedule list
+
+List the instance schedules
+
+The list flags are:
+
+`)
+	cmd.Flag.PrintDefaults()
+	fmt.Fprintf(os.Stderr, `
+The template passed to the -f option operates on a
+
+[]%s
+`, scheduleTemplateDesc)
+	fmt.Fprintln(os.Stderr, templateFunctionHelp)
+	os.Exit(2)
+}
+
+func (cmd *scheduleListCommand) parseArgs(args []string) []string {
+	cmd.Flag.StringVar(&cmd.template, "f", "", "Template used to format output")
+	cmd.Flag.Usage = func() { cmd.usage() }
+	cmd.Flag.Parse(args)
+	return cmd.Flag.Args()
+}
+
+func (cmd *scheduleListCommand) run(args []string) error {
+	resp, err := sendScheduleRequest("GET", "", nil)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		fatalf("Schedule list failed: %s", resp.Status)
+	}
+
+	var schedules types.ListSchedulesResponse
+	err = unmarshalHTTPResponse(resp, &schedules)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	if cmd.template != "" {
+		return outputToTemplate("schedule-list", cmd.template, &schedules.Schedules)
+	}
+
+	for i, s := range schedules.Schedules {
+		fmt.Printf("Schedule %d\n", i+1)
+		dumpSchedule(&s)
+	}
+
+	return nil
+}
+
+type scheduleShowCommand struct {
+	Flag     flag.FlagSet
+	schedule string
+	template string
+}
+
+func (cmd *scheduleShowCommand) usage(...string) {
+	fmt.Fprintf(os.Stderr, `usage: ciao-cli [options] schedule show [flags]
+
+Show the details of an instance schedule
+
+The show flags are:
+
+`)
+	cmd.Flag.PrintDefaults()
+	fmt.Fprintf(os.Stderr, `
+The template passed to the -f option operates on a
+
+%s
+`, scheduleTemplateDesc)
+	fmt.Fprintln(os.Stderr, templateFunctionHelp)
+	os.Exit(2)
+}
+
+func (cmd *scheduleShowCommand) parseArgs(args []string) []string {
+	cmd.Flag.StringVar(&cmd.schedule, "schedule", "", "Schedule UUID")
+	cmd.Flag.StringVar(&cmd.template, "f", "", "Template used to format output")
+	cmd.Flag.Usage = func() { cmd.usage() }
+	cmd.Flag.Parse(args)
+	return cmd.Flag.Args()
+}
+
+func (cmd *scheduleShowCommand) run(args []string) error {
+	if cmd.schedule == "" {
+		errorf("Missing required -schedule parameter")
+		cmd.usage()
+	}
+
+	resp, err := sendScheduleRequest("GET", cmd.schedule, nil)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		fatalf("Schedule show failed: %s", resp.Status)
+	}
+
+	var s types.Schedule
+	err = unmarshalHTTPResponse(resp, &s)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	if cmd.template != "" {
+		return outputToTemplate("schedule-show", cmd.template, &s)
+	}
+
+	dumpSchedule(&s)
+
+	return nil
+}
+
+type scheduleDeleteCommand struct {
+	Flag     flag.FlagSet
+	schedule string
+}
+
+func (cmd *scheduleDeleteCommand) usage(...string) {
+	fmt.Fprintf(os.Stderr, `usage: ciao-cli [options] schedule delete [flags]
+
+Delete an instance schedule
+
+The delete flags are:
+
+`)
+	cmd.Flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func (cmd *scheduleDeleteCommand) parseArgs(args []string) []string {
+	cmd.Flag.StringVar(&cmd.schedule, "schedule", "", "Schedule UUID")
+	cmd.Flag.Usage = func() { cmd.usage() }
+	cmd.Flag.Parse(args)
+	return cmd.Flag.Args()
+}
+
+func (cmd *scheduleDeleteCommand) run(args []string) error {
+	if cmd.schedule == "" {
+		errorf("Missing required -schedule parameter")
+		cmd.usage()
+	}
+
+	resp, err := sendScheduleRequest("DELETE", cmd.schedule, nil)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		fatalf("Schedule deletion failed: %s", resp.Status)
+	}
+
+	fmt.Printf("Deleted schedule: %s\n", cmd.schedule)
+
+	return nil
+}
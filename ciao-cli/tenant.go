@@ -17,18 +17,29 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
 	"text/template"
 	"time"
 
+	"github.com/01org/ciao/ciao-controller/api"
 	"github.com/01org/ciao/ciao-controller/types"
 )
 
 var tenantCommand = &command{
 	SubCommands: map[string]subCommand{
-		"list": new(tenantListCommand),
+		"list":          new(tenantListCommand),
+		"create":        new(tenantCreateCommand),
+		"show":          new(tenantShowCommand),
+		"update":        new(tenantUpdateCommand),
+		"delete":        new(tenantDeleteCommand),
+		"quotas":        new(tenantQuotasCommand),
+		"update-quotas": new(tenantUpdateQuotasCommand),
 	},
 }
 
@@ -253,3 +264,418 @@ func listTenantResources(t *template.Template) error {
 
 	return nil
 }
+
+func getCiaoTenantRef(ID string) (string, error) {
+	url, err := getCiaoResource("tenants", api.TenantsV1)
+	if err != nil {
+		return "", err
+	}
+
+	if ID == "" {
+		return url, nil
+	}
+
+	return fmt.Sprintf("%s/%s", url, ID), nil
+}
+
+func sendTenantRequest(method string, ID string, suffix string, req interface{}) (*http.Response, error) {
+	url, err := getCiaoTenantRef(ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var body io.Reader
+	if req != nil {
+		b, err := json.Marshal(req)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(b)
+	}
+
+	ver := api.TenantsV1
+
+	return sendCiaoRequest(method, url+suffix, nil, body, &ver)
+}
+
+func dumpTenant(t *types.TenantSummary) {
+	fmt.Printf("\tUUID: %s\n", t.ID)
+	fmt.Printf("\tName: %s\n", t.Name)
+}
+
+type tenantCreateCommand struct {
+	Flag   flag.FlagSet
+	tenant string
+	name   string
+}
+
+func (cmd *tenantCreateCommand) usage(...string) {
+	fmt.Fprintf(os.Stderr, `usage: ciao-cli [options] tenant create [flags]
+
+Create a tenant (Privileged).  The tenant UUID should be the one of the
+matching identity service project.
+
+The create flags are:
+
+`)
+	cmd.Flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func (cmd *tenantCreateCommand) parseArgs(args []string) []string {
+	cmd.Flag.StringVar(&cmd.tenant, "tenant", "", "Tenant UUID")
+	cmd.Flag.StringVar(&cmd.name, "name", "", "Tenant name")
+	cmd.Flag.Usage = func() { cmd.usage() }
+	cmd.Flag.Parse(args)
+	return cmd.Flag.Args()
+}
+
+func (cmd *tenantCreateCommand) run(args []string) error {
+	if cmd.tenant == "" {
+		errorf("Missing required -tenant parameter")
+		cmd.usage()
+	}
+
+	req := types.TenantRequest{
+		ID:   cmd.tenant,
+		Name: cmd.name,
+	}
+
+	resp, err := sendTenantRequest("POST", "", "", req)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	if resp.StatusCode != http.StatusCreated {
+		fatalf("Tenant creation failed: %s", resp.Status)
+	}
+
+	var tenant types.TenantSummary
+	err = unmarshalHTTPResponse(resp, &tenant)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	fmt.Printf("Created tenant:\n")
+	dumpTenant(&tenant)
+
+	return nil
+}
+
+type tenantShowCommand struct {
+	Flag     flag.FlagSet
+	tenant   string
+	template string
+}
+
+func (cmd *tenantShowCommand) usage(...string) {
+	fmt.Fprintf(os.Stderr, `usage: ciao-cli [options] tenant show [flags]
+
+Show the details of a tenant
+
+The show flags are:
+
+`)
+	cmd.Flag.PrintDefaults()
+	fmt.Fprintf(os.Stderr, `
+The template passed to the -f option operates on the following struct:
+
+struct {
+	ID   string    // Tenant ID
+	Name string    // Tenant name
+}
+`)
+	fmt.Fprintln(os.Stderr, templateFunctionHelp)
+	os.Exit(2)
+}
+
+func (cmd *tenantShowCommand) parseArgs(args []string) []string {
+	cmd.Flag.StringVar(&cmd.tenant, "tenant", "", "Tenant UUID, defaults to -tenant-id")
+	cmd.Flag.StringVar(&cmd.template, "f", "", "Template used to format output")
+	cmd.Flag.Usage = func() { cmd.usage() }
+	cmd.Flag.Parse(args)
+	return cmd.Flag.Args()
+}
+
+func (cmd *tenantShowCommand) run(args []string) error {
+	if cmd.tenant == "" {
+		cmd.tenant = *tenantID
+	}
+
+	resp, err := sendTenantRequest("GET", cmd.tenant, "", nil)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		fatalf("Tenant show failed: %s", resp.Status)
+	}
+
+	var tenant types.TenantSummary
+	err = unmarshalHTTPResponse(resp, &tenant)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	if cmd.template != "" {
+		return outputToTemplate("tenant-show", cmd.template, &tenant)
+	}
+
+	dumpTenant(&tenant)
+
+	return nil
+}
+
+type tenantUpdateCommand struct {
+	Flag   flag.FlagSet
+	tenant string
+	name   string
+}
+
+func (cmd *tenantUpdateCommand) usage(...string) {
+	fmt.Fprintf(os.Stderr, `usage: ciao-cli [options] tenant update [flags]
+
+Rename a tenant (Privileged)
+
+The update flags are:
+
+`)
+	cmd.Flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func (cmd *tenantUpdateCommand) parseArgs(args []string) []string {
+	cmd.Flag.StringVar(&cmd.tenant, "tenant", "", "Tenant UUID")
+	cmd.Flag.StringVar(&cmd.name, "name", "", "New tenant name")
+	cmd.Flag.Usage = func() { cmd.usage() }
+	cmd.Flag.Parse(args)
+	return cmd.Flag.Args()
+}
+
+func (cmd *tenantUpdateCommand) run(args []string) error {
+	if cmd.tenant == "" {
+		errorf("Missing required -tenant parameter")
+		cmd.usage()
+	}
+
+	if cmd.name == "" {
+		errorf("Missing required -name parameter")
+		cmd.usage()
+	}
+
+	req := types.TenantRequest{
+		Name: cmd.name,
+	}
+
+	resp, err := sendTenantRequest("PUT", cmd.tenant, "", req)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		fatalf("Tenant update failed: %s", resp.Status)
+	}
+
+	var tenant types.TenantSummary
+	err = unmarshalHTTPResponse(resp, &tenant)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	fmt.Printf("Updated tenant:\n")
+	dumpTenant(&tenant)
+
+	return nil
+}
+
+type tenantDeleteCommand struct {
+	Flag   flag.FlagSet
+	tenant string
+}
+
+func (cmd *tenantDeleteCommand) usage(...string) {
+	fmt.Fprintf(os.Stderr, `usage: ciao-cli [options] tenant delete [flags]
+
+Delete a tenant which no longer owns any instance, volume, external IP
+or workload (Privileged)
+
+The delete flags are:
+
+`)
+	cmd.Flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func (cmd *tenantDeleteCommand) parseArgs(args []string) []string {
+	cmd.Flag.StringVar(&cmd.tenant, "tenant", "", "Tenant UUID")
+	cmd.Flag.Usage = func() { cmd.usage() }
+	cmd.Flag.Parse(args)
+	return cmd.Flag.Args()
+}
+
+func (cmd *tenantDeleteCommand) run(args []string) error {
+	if cmd.tenant == "" {
+		errorf("Missing required -tenant parameter")
+		cmd.usage()
+	}
+
+	resp, err := sendTenantRequest("DELETE", cmd.tenant, "", nil)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		fatalf("Tenant deletion failed: %s", resp.Status)
+	}
+
+	fmt.Printf("Deleted tenant: %s\n", cmd.tenant)
+
+	return nil
+}
+
+func dumpQuotas(tenant string, quotas []types.QuotaDetails) {
+	fmt.Printf("Quotas for tenant %s:\n", tenant)
+	for _, q := range quotas {
+		fmt.Printf("\t%-13s %d | %s\n", q.Name+":", q.Usage, limitToString(q.Value))
+	}
+}
+
+type tenantQuotasCommand struct {
+	Flag     flag.FlagSet
+	tenant   string
+	template string
+}
+
+func (cmd *tenantQuotasCommand) usage(...string) {
+	fmt.Fprintf(os.Stderr, `usage: ciao-cli [options] tenant quotas [flags]
+
+Show the quotas of a tenant and their usage
+
+The quotas flags are:
+
+`)
+	cmd.Flag.PrintDefaults()
+	fmt.Fprintf(os.Stderr, `
+The template passed to the -f option operates on the following structs:
+
+[]struct {
+	Name  string    // Quota name
+	Value int       // Quota limit, -1 when unlimited
+	Usage int       // Current usage
+}
+`)
+	fmt.Fprintln(os.Stderr, templateFunctionHelp)
+	os.Exit(2)
+}
+
+func (cmd *tenantQuotasCommand) parseArgs(args []string) []string {
+	cmd.Flag.StringVar(&cmd.tenant, "tenant", "", "Tenant UUID, defaults to -tenant-id")
+	cmd.Flag.StringVar(&cmd.template, "f", "", "Template used to format output")
+	cmd.Flag.Usage = func() { cmd.usage() }
+	cmd.Flag.Parse(args)
+	return cmd.Flag.Args()
+}
+
+func (cmd *tenantQuotasCommand) run(args []string) error {
+	if cmd.tenant == "" {
+		cmd.tenant = *tenantID
+	}
+
+	resp, err := sendTenantRequest("GET", cmd.tenant, "/quotas", nil)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		fatalf("Tenant quotas failed: %s", resp.Status)
+	}
+
+	var quotas types.QuotaListResponse
+	err = unmarshalHTTPResponse(resp, &quotas)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	if cmd.template != "" {
+		return outputToTemplate("tenant-quotas", cmd.template, &quotas.Quotas)
+	}
+
+	dumpQuotas(cmd.tenant, quotas.Quotas)
+
+	return nil
+}
+
+type tenantUpdateQuotasCommand struct {
+	Flag   flag.FlagSet
+	tenant string
+	values map[string]*int
+}
+
+func (cmd *tenantUpdateQuotasCommand) usage(...string) {
+	fmt.Fprintf(os.Stderr, `usage: ciao-cli [options] tenant update-quotas [flags]
+
+Change the quotas of a tenant (Privileged).  Quotas which are not given
+are left unchanged, a negative value removes the limit.
+
+The update-quotas flags are:
+
+`)
+	cmd.Flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func (cmd *tenantUpdateQuotasCommand) parseArgs(args []string) []string {
+	cmd.values = make(map[string]*int)
+
+	cmd.Flag.StringVar(&cmd.tenant, "tenant", "", "Tenant UUID")
+	for _, name := range types.QuotaNames {
+		cmd.values[name] = cmd.Flag.Int(name, -1, fmt.Sprintf("Limit of %s", name))
+	}
+	cmd.Flag.Usage = func() { cmd.usage() }
+	cmd.Flag.Parse(args)
+	return cmd.Flag.Args()
+}
+
+func (cmd *tenantUpdateQuotasCommand) run(args []string) error {
+	if cmd.tenant == "" {
+		errorf("Missing required -tenant parameter")
+		cmd.usage()
+	}
+
+	var req types.QuotaUpdateRequest
+
+	cmd.Flag.Visit(func(f *flag.Flag) {
+		if value, ok := cmd.values[f.Name]; ok {
+			req.Quotas = append(req.Quotas, types.QuotaDetails{
+				Name:  f.Name,
+				Value: *value,
+			})
+		}
+	})
+
+	if len(req.Quotas) == 0 {
+		errorf("No quota to update")
+		cmd.usage()
+	}
+
+	resp, err := sendTenantRequest("PUT", cmd.tenant, "/quotas", req)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		fatalf("Tenant quotas update failed: %s", resp.Status)
+	}
+
+	var quotas types.QuotaListResponse
+	err = unmarshalHTTPResponse(resp, &quotas)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	dumpQuotas(cmd.tenant, quotas.Quotas)
+
+	return nil
+}
@@ -38,6 +38,9 @@ var workloadCommand = &command{
 	SubCommands: map[string]subCommand{
 		"list":   new(workloadListCommand),
 		"create": new(workloadCreateCommand),
+		"show":   new(workloadShowCommand),
+		"update": new(workloadUpdateCommand),
+		"delete": new(workloadDeleteCommand),
 	},
 }
 
@@ -143,6 +146,15 @@ func getCiaoWorkloadsResource() (string, error) {
 	return getCiaoResource("workloads", api.WorkloadsV1)
 }
 
+func getCiaoWorkloadRef(ID string) (string, error) {
+	url, err := getCiaoWorkloadsResource()
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s/%s", url, ID), nil
+}
+
 type source struct {
 	Type types.SourceType `yaml:"service"`
 	ID   string           `yaml:"id"`
@@ -165,14 +177,17 @@ type defaultResources struct {
 // we currently only use the first disk due to lack of support
 // in types.Workload for multiple storage resources.
 type workloadOptions struct {
-	Description     string           `yaml:"description"`
-	VMType          string           `yaml:"vm_type"`
-	FWType          string           `yaml:"fw_type"`
-	ImageName       string           `yaml:"image_name"`
-	ImageID         string           `yaml:"image_id"`
-	Defaults        defaultResources `yaml:"defaults"`
-	CloudConfigFile string           `yaml:"cloud_init"`
-	Disks           []disk           `yaml:"disks"`
+	Description     string                    `yaml:"description"`
+	VMType          string                    `yaml:"vm_type"`
+	FWType          string                    `yaml:"fw_type"`
+	ImageName       string                    `yaml:"image_name"`
+	ImageID         string                    `yaml:"image_id"`
+	Defaults        defaultResources          `yaml:"defaults"`
+	CloudConfigFile string                    `yaml:"cloud_init"`
+	Disks           []disk                    `yaml:"disks"`
+	Parameters      []types.WorkloadParameter `yaml:"parameters"`
+	RestartPolicy   *payloads.RestartPolicy   `yaml:"restart_policy"`
+	HealthCheck     *payloads.HealthCheck     `yaml:"health_check"`
 }
 
 func optToReqStorage(opt workloadOptions) ([]types.StorageResource, error) {
@@ -247,6 +262,9 @@ func optToReq(opt workloadOptions, req *types.Workload) error {
 	req.ImageName = opt.ImageName
 	req.ImageID = opt.ImageID
 	req.Config = config
+	req.Parameters = opt.Parameters
+	req.RestartPolicy = opt.RestartPolicy
+	req.HealthCheck = opt.HealthCheck
 	req.Storage, err = optToReqStorage(opt)
 
 	if err != nil {
@@ -277,25 +295,30 @@ func optToReq(opt workloadOptions, req *types.Workload) error {
 	return nil
 }
 
-func (cmd *workloadCreateCommand) run(args []string) error {
+func yamlToReq(yamlFile string, req *types.Workload) error {
 	var opt workloadOptions
-	var req types.Workload
-
-	if cmd.yamlFile == "" {
-		cmd.usage()
-	}
 
-	f, err := ioutil.ReadFile(cmd.yamlFile)
+	f, err := ioutil.ReadFile(yamlFile)
 	if err != nil {
-		fatalf("Unable to read workload config file: %s\n", err)
+		return fmt.Errorf("Unable to read workload config file: %s", err)
 	}
 
 	err = yaml.Unmarshal(f, &opt)
 	if err != nil {
-		fatalf("Config file invalid: %s\n", err)
+		return fmt.Errorf("Config file invalid: %s", err)
 	}
 
-	err = optToReq(opt, &req)
+	return optToReq(opt, req)
+}
+
+func (cmd *workloadCreateCommand) run(args []string) error {
+	var req types.Workload
+
+	if cmd.yamlFile == "" {
+		cmd.usage()
+	}
+
+	err := yamlToReq(cmd.yamlFile, &req)
 	if err != nil {
 		fatalf(err.Error())
 	}
@@ -334,3 +357,270 @@ func (cmd *workloadCreateCommand) run(args []string) error {
 
 	return nil
 }
+
+type workloadShowCommand struct {
+	Flag     flag.FlagSet
+	workload string
+	template string
+}
+
+func (cmd *workloadShowCommand) usage(...string) {
+	fmt.Fprintf(os.Stderr, `usage: ciao-cli [options] workload show [flags]
+
+Show workload details
+
+The show flags are:
+
+`)
+	cmd.Flag.PrintDefaults()
+	fmt.Fprintf(os.Stderr, `
+The template passed to the -f option operates on a
+
+struct {
+	ID          string          // ID of the workload
+	Description string          // Description of the workload
+	FWType      string          // Firmware used by instances of the workload
+	VMType      string          // Hypervisor used by instances of the workload
+	ImageID     string          // ID of the backing image, if any
+	ImageName   string          // Name of the backing image, if any
+	Config      string          // cloud-init configuration of the workload
+	Defaults    []struct {
+		Type  string        // Type of the resource
+		Value int           // Amount of the resource requested
+	}
+	Storage     []struct{}      // Storage attached to instances of the workload
+	TenantID    string          // ID of the tenant owning a private workload
+	Visibility  string          // Either public or private
+	Parameters  []struct {
+		Name        string  // Name of the parameter
+		Description string  // Description of the parameter
+		Default     string  // Value used when none is given
+		Required    bool    // Whether a value must be given
+	}
+	RestartPolicy *struct {
+		Condition   string  // One of never, on-failure or always
+		MaxRestarts int     // Restarts before giving up, 0 for no limit
+		Backoff     int     // Delay in seconds before the first restart
+	}
+	HealthCheck *struct {
+		Protocol           string  // Either tcp or http
+		Port               int     // Port of the instances which is probed
+		Path               string  // Path of the URL of http probes
+		Interval           int     // Delay in seconds between probes
+		Timeout            int     // Delay in seconds after which a probe fails
+		HealthyThreshold   int     // Successful probes before being healthy
+		UnhealthyThreshold int     // Failed probes before being unhealthy
+		Restart            bool    // Whether unhealthy instances are restarted
+	}
+}
+`)
+	fmt.Fprintln(os.Stderr, templateFunctionHelp)
+	os.Exit(2)
+}
+
+func (cmd *workloadShowCommand) parseArgs(args []string) []string {
+	cmd.Flag.StringVar(&cmd.workload, "workload", "", "Workload UUID")
+	cmd.Flag.StringVar(&cmd.template, "f", "", "Template used to format output")
+	cmd.Flag.Usage = func() { cmd.usage() }
+	cmd.Flag.Parse(args)
+	return cmd.Flag.Args()
+}
+
+func (cmd *workloadShowCommand) run(args []string) error {
+	if cmd.workload == "" {
+		errorf("Missing required -workload parameter")
+		cmd.usage()
+	}
+
+	url, err := getCiaoWorkloadRef(cmd.workload)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	ver := api.WorkloadsV1
+
+	resp, err := sendCiaoRequest("GET", url, nil, nil, &ver)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		fatalf("Workload show failed: %s", resp.Status)
+	}
+
+	var workload types.WorkloadResponse
+
+	err = unmarshalHTTPResponse(resp, &workload)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	if cmd.template != "" {
+		return outputToTemplate("workload-show", cmd.template,
+			&workload.Workload)
+	}
+
+	wl := workload.Workload
+	fmt.Printf("\tUUID: %s\n", wl.ID)
+	fmt.Printf("\tDescription: %s\n", wl.Description)
+	fmt.Printf("\tVisibility: %s\n", wl.Visibility)
+	if wl.TenantID != "" {
+		fmt.Printf("\tTenant UUID: %s\n", wl.TenantID)
+	}
+	fmt.Printf("\tVM Type: %s\n", wl.VMType)
+	fmt.Printf("\tFW Type: %s\n", wl.FWType)
+	if wl.ImageID != "" {
+		fmt.Printf("\tImage UUID: %s\n", wl.ImageID)
+	}
+	for _, r := range wl.Defaults {
+		fmt.Printf("\t%s: %d\n", r.Type, r.Value)
+	}
+	for _, s := range wl.Storage {
+		fmt.Printf("\tStorage: %s %s (%d GB, bootable: %t)\n",
+			s.SourceType, s.SourceID, s.Size, s.Bootable)
+	}
+	for _, p := range wl.Parameters {
+		if p.Required {
+			fmt.Printf("\tParameter: %s (required)\n", p.Name)
+		} else {
+			fmt.Printf("\tParameter: %s (default: %q)\n", p.Name, p.Default)
+		}
+	}
+	if p := wl.RestartPolicy; p != nil {
+		fmt.Printf("\tRestart Policy: %s (max restarts: %d, backoff: %ds)\n",
+			p.Condition, p.MaxRestarts, p.Backoff)
+	}
+	if h := wl.HealthCheck; h != nil {
+		fmt.Printf("\tHealth Check: %s:%d%s (every %ds, restart: %t)\n",
+			h.Protocol, h.Port, h.Path, h.Interval, h.Restart)
+	}
+
+	return nil
+}
+
+type workloadUpdateCommand struct {
+	Flag     flag.FlagSet
+	workload string
+	yamlFile string
+}
+
+func (cmd *workloadUpdateCommand) usage(...string) {
+	fmt.Fprintf(os.Stderr, `usage: ciao-cli [options] workload update [flags]
+
+Replace the definition of an existing workload
+
+The update flags are:
+
+`)
+	cmd.Flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func (cmd *workloadUpdateCommand) parseArgs(args []string) []string {
+	cmd.Flag.StringVar(&cmd.workload, "workload", "", "Workload UUID")
+	cmd.Flag.StringVar(&cmd.yamlFile, "yaml", "", "filename for yaml which describes the workload")
+	cmd.Flag.Usage = func() { cmd.usage() }
+	cmd.Flag.Parse(args)
+	return cmd.Flag.Args()
+}
+
+func (cmd *workloadUpdateCommand) run(args []string) error {
+	var req types.Workload
+
+	if cmd.workload == "" {
+		errorf("Missing required -workload parameter")
+		cmd.usage()
+	}
+
+	if cmd.yamlFile == "" {
+		errorf("Missing required -yaml parameter")
+		cmd.usage()
+	}
+
+	err := yamlToReq(cmd.yamlFile, &req)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	req.ID = cmd.workload
+
+	b, err := json.Marshal(req)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	url, err := getCiaoWorkloadRef(cmd.workload)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	ver := api.WorkloadsV1
+
+	resp, err := sendCiaoRequest("PUT", url, nil, bytes.NewReader(b), &ver)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		fatalf("Workload update failed: %s", resp.Status)
+	}
+
+	fmt.Printf("Updated workload: %s\n", cmd.workload)
+
+	return nil
+}
+
+type workloadDeleteCommand struct {
+	Flag     flag.FlagSet
+	workload string
+}
+
+func (cmd *workloadDeleteCommand) usage(...string) {
+	fmt.Fprintf(os.Stderr, `usage: ciao-cli [options] workload delete [flags]
+
+Delete a workload which has no instances
+
+The delete flags are:
+
+`)
+	cmd.Flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func (cmd *workloadDeleteCommand) parseArgs(args []string) []string {
+	cmd.Flag.StringVar(&cmd.workload, "workload", "", "Workload UUID")
+	cmd.Flag.Usage = func() { cmd.usage() }
+	cmd.Flag.Parse(args)
+	return cmd.Flag.Args()
+}
+
+func (cmd *workloadDeleteCommand) run(args []string) error {
+	if cmd.workload == "" {
+		errorf("Missing required -workload parameter")
+		cmd.usage()
+	}
+
+	url, err := getCiaoWorkloadRef(cmd.workload)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	ver := api.WorkloadsV1
+
+	resp, err := sendCiaoRequest("DELETE", url, nil, nil, &ver)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		fatalf("Workload deletion failed: %s", resp.Status)
+	}
+
+	fmt.Printf("Deleted workload: %s\n", cmd.workload)
+
+	return nil
+}
@@ -25,6 +25,7 @@ import (
 	"time"
 
 	"github.com/01org/ciao/ciao-controller/types"
+	osIdentity "github.com/01org/ciao/openstack/identity"
 	"github.com/01org/ciao/payloads"
 	"github.com/01org/ciao/ssntp"
 	"github.com/golang/glog"
@@ -368,6 +369,25 @@ func getUsage(c *controller, w http.ResponseWriter, r *http.Request) (APIRespons
 
 type instanceAction func(string) error
 
+// hasTags returns whether an instance has all the tags.
+func hasTags(instance *types.Instance, tags []string) bool {
+	for _, tag := range tags {
+		found := false
+		for _, t := range instance.Tags {
+			if t == tag {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
 func serversAction(c *controller, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
 	vars := mux.Vars(r)
 	tenant := vars["tenant"]
@@ -399,6 +419,11 @@ func serversAction(c *controller, w http.ResponseWriter, r *http.Request) (APIRe
 			errors.New("Unsupported action")
 	}
 
+	if len(servers.ServerIDs) > 0 && len(servers.Tags) > 0 {
+		return APIResponse{http.StatusBadRequest, nil},
+			errors.New("Servers and tags are mutually exclusive")
+	}
+
 	if len(servers.ServerIDs) > 0 {
 		for _, instanceID := range servers.ServerIDs {
 			// make sure the instance belongs to the tenant
@@ -422,7 +447,11 @@ func serversAction(c *controller, w http.ResponseWriter, r *http.Request) (APIRe
 
 		for _, instance := range instances {
 			if statusFilter != "" &&
-				instance.State != statusFilter {
+				string(instance.State) != statusFilter {
+				continue
+			}
+
+			if !hasTags(instance, servers.Tags) {
 				continue
 			}
 
@@ -679,6 +708,91 @@ func clearEvents(c *controller, w http.ResponseWriter, r *http.Request) (APIResp
 	return APIResponse{http.StatusAccepted, nil}, nil
 }
 
+// eventStreamKeepAlive is how often an idle event stream sends a comment
+// so that proxies do not time the connection out.
+const eventStreamKeepAlive = 30 * time.Second
+
+// eventStreamHandler pushes controller events to its client as they
+// happen, using Server-Sent Events.  Streams opened on a tenant URL only
+// carry the events of that tenant, the events of every tenant are only
+// streamed to admins.  The type query parameter, which may
+// be repeated, restricts the stream to some event types.
+type eventStreamHandler struct {
+	*controller
+}
+
+func (h eventStreamHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tenant := mux.Vars(r)["tenant"]
+
+	if tenant == "" && !osIdentity.Privileged(r.Context()) {
+		http.Error(w, "Admin privileges required", http.StatusForbidden)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	eventTypes := make(map[types.StreamEventType]bool)
+	for _, t := range r.URL.Query()["type"] {
+		eventTypes[types.StreamEventType(t)] = true
+	}
+
+	var closed <-chan bool
+	if cn, ok := w.(http.CloseNotifier); ok {
+		closed = cn.CloseNotify()
+	}
+
+	id, events := h.ds.SubscribeEvents()
+	defer h.ds.UnsubscribeEvents(id)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventStreamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+
+			if tenant != "" && e.TenantID != tenant {
+				continue
+			}
+
+			if len(eventTypes) > 0 && !eventTypes[e.Type] {
+				continue
+			}
+
+			b, err := json.Marshal(e)
+			if err != nil {
+				glog.Warningf("Unable to marshal %s event: %v", e.Type, err)
+				continue
+			}
+
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, b)
+			flusher.Flush()
+
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+
+		case <-closed:
+			return
+
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
 func traceData(c *controller, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
 	vars := mux.Vars(r)
 	label := vars["label"]
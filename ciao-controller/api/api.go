@@ -21,6 +21,7 @@ import (
 	"net/http"
 
 	"github.com/01org/ciao/ciao-controller/types"
+	"github.com/01org/ciao/openstack/identity"
 	"github.com/01org/ciao/ssntp/uuid"
 	"github.com/golang/glog"
 	"github.com/gorilla/mux"
@@ -38,6 +39,15 @@ const (
 
 	// WorkloadsV1 is the content-type string for v1 of our workloads resource
 	WorkloadsV1 = "x.ciao.workloads.v1"
+
+	// TenantsV1 is the content-type string for v1 of our tenants resource
+	TenantsV1 = "x.ciao.tenants.v1"
+
+	// SchedulesV1 is the content-type string for v1 of our schedules resource
+	SchedulesV1 = "x.ciao.schedules.v1"
+
+	// ScalingGroupsV1 is the content-type string for v1 of our scaling groups resource
+	ScalingGroupsV1 = "x.ciao.scaling-groups.v1"
 )
 
 // HTTPErrorData represents the HTTP response body for
@@ -67,9 +77,15 @@ func errorResponse(err error) Response {
 	case types.ErrPoolNotFound,
 		types.ErrTenantNotFound,
 		types.ErrAddressNotFound,
-		types.ErrInstanceNotFound:
+		types.ErrInstanceNotFound,
+		types.ErrWorkloadNotFound,
+		types.ErrScheduleNotFound,
+		types.ErrScalingGroupNotFound:
 		return Response{http.StatusNotFound, nil}
 
+	case types.ErrNotAdmin:
+		return Response{http.StatusForbidden, nil}
+
 	case types.ErrQuota,
 		types.ErrInstanceNotAssigned,
 		types.ErrDuplicateSubnet,
@@ -79,7 +95,12 @@ func errorResponse(err error) Response {
 		types.ErrInvalidPoolAddress,
 		types.ErrBadRequest,
 		types.ErrPoolEmpty,
-		types.ErrDuplicatePoolName:
+		types.ErrDuplicatePoolName,
+		types.ErrWorkloadOwner,
+		types.ErrWorkloadInUse,
+		types.ErrDuplicateTenant,
+		types.ErrTenantInUse,
+		types.ErrUnknownQuota:
 		return Response{http.StatusForbidden, nil}
 
 	default:
@@ -180,6 +201,51 @@ func listResources(c *Context, w http.ResponseWriter, r *http.Request) (Response
 
 	links = append(links, link)
 
+	// we support the "tenants" resource
+	link = types.APILink{
+		Rel:        "tenants",
+		Version:    TenantsV1,
+		MinVersion: TenantsV1,
+	}
+
+	if !ok {
+		link.Href = fmt.Sprintf("%s/tenants", c.URL)
+	} else {
+		link.Href = fmt.Sprintf("%s/%s/tenants", c.URL, tenantID)
+	}
+
+	links = append(links, link)
+
+	// we support the "schedules" resource
+	link = types.APILink{
+		Rel:        "schedules",
+		Version:    SchedulesV1,
+		MinVersion: SchedulesV1,
+	}
+
+	if !ok {
+		link.Href = fmt.Sprintf("%s/schedules", c.URL)
+	} else {
+		link.Href = fmt.Sprintf("%s/%s/schedules", c.URL, tenantID)
+	}
+
+	links = append(links, link)
+
+	// we support the "scaling-groups" resource
+	link = types.APILink{
+		Rel:        "scaling-groups",
+		Version:    ScalingGroupsV1,
+		MinVersion: ScalingGroupsV1,
+	}
+
+	if !ok {
+		link.Href = fmt.Sprintf("%s/scaling-groups", c.URL)
+	} else {
+		link.Href = fmt.Sprintf("%s/%s/scaling-groups", c.URL, tenantID)
+	}
+
+	links = append(links, link)
+
 	return Response{http.StatusOK, links}, nil
 }
 
@@ -428,8 +494,32 @@ func unmapExternalIP(c *Context, w http.ResponseWriter, r *http.Request) (Respon
 	return errorResponse(types.ErrAddressNotFound), types.ErrAddressNotFound
 }
 
+func workloadResponse(c *Context, tenant string, wl types.Workload) types.WorkloadResponse {
+	ref := fmt.Sprintf("%s/workloads/%s", c.URL, wl.ID)
+	if tenant != "" {
+		ref = fmt.Sprintf("%s/%s/workloads/%s", c.URL, tenant, wl.ID)
+	}
+
+	link := types.Link{
+		Rel:  "self",
+		Href: ref,
+	}
+
+	return types.WorkloadResponse{
+		Workload: wl,
+		Link:     link,
+	}
+}
+
 func addWorkload(c *Context, w http.ResponseWriter, r *http.Request) (Response, error) {
 	var req types.Workload
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+
+	err := scopeAccess(r)
+	if err != nil {
+		return errorResponse(err), err
+	}
 
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
@@ -441,136 +531,887 @@ func addWorkload(c *Context, w http.ResponseWriter, r *http.Request) (Response,
 		return errorResponse(err), err
 	}
 
+	// tenants can only create private workloads
+	if tenant != "" {
+		req.TenantID = tenant
+		req.Visibility = types.Private
+	}
+
 	wl, err := c.CreateWorkload(req)
 	if err != nil {
 		return errorResponse(err), err
 	}
 
-	ref := fmt.Sprintf("%s/workloads/%s", c.URL, wl.ID)
+	return Response{http.StatusCreated, workloadResponse(c, tenant, wl)}, nil
+}
 
-	link := types.Link{
-		Rel:  "self",
-		Href: ref,
+func listWorkloads(c *Context, w http.ResponseWriter, r *http.Request) (Response, error) {
+	var resp types.ListWorkloadsResponse
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+
+	err := scopeAccess(r)
+	if err != nil {
+		return errorResponse(err), err
 	}
 
-	resp := types.WorkloadResponse{
-		Workload: wl,
-		Link:     link,
+	wls, err := c.ListWorkloads(tenant)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	resp.Workloads = []types.WorkloadResponse{}
+	for _, wl := range wls {
+		resp.Workloads = append(resp.Workloads, workloadResponse(c, tenant, wl))
 	}
 
-	return Response{http.StatusCreated, resp}, nil
+	return Response{http.StatusOK, resp}, nil
 }
 
-// Service is an interface which must be implemented by the ciao API context.
-type Service interface {
-	AddPool(name string, subnet *string, ips []string) (types.Pool, error)
-	ListPools() ([]types.Pool, error)
-	ShowPool(id string) (types.Pool, error)
-	DeletePool(id string) error
-	AddAddress(poolID string, subnet *string, IPs []string) error
-	RemoveAddress(poolID string, subnetID *string, IPID *string) error
-	ListMappedAddresses(tenantID *string) []types.MappedIP
-	MapAddress(poolName *string, instanceID string) error
-	UnMapAddress(ID string) error
-	CreateWorkload(req types.Workload) (types.Workload, error)
+func showWorkload(c *Context, w http.ResponseWriter, r *http.Request) (Response, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+	ID := vars["workload_id"]
+
+	err := scopeAccess(r)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	wl, err := c.ShowWorkload(tenant, ID)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return Response{http.StatusOK, workloadResponse(c, tenant, wl)}, nil
 }
 
-// Context is used to provide the services and current URL to the handlers.
-type Context struct {
-	URL string
-	Service
+func updateWorkload(c *Context, w http.ResponseWriter, r *http.Request) (Response, error) {
+	var req types.Workload
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+	ID := vars["workload_id"]
+
+	err := scopeAccess(r)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	if req.ID != "" && req.ID != ID {
+		return errorResponse(types.ErrBadRequest), types.ErrBadRequest
+	}
+	req.ID = ID
+
+	wl, err := c.UpdateWorkload(tenant, req)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return Response{http.StatusOK, workloadResponse(c, tenant, wl)}, nil
 }
 
-// Config is used to setup the Context for the ciao API.
-type Config struct {
-	URL         string
-	CiaoService Service
+func deleteWorkload(c *Context, w http.ResponseWriter, r *http.Request) (Response, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+	ID := vars["workload_id"]
+
+	err := scopeAccess(r)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	err = c.DeleteWorkload(tenant, ID)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return Response{http.StatusNoContent, nil}, nil
 }
 
-// Routes returns the supported ciao API endpoints.
-// A plain application/json request will return v1 of the resource
-// since we only have one version of this api so far, that means
-// most routes will match both json as well as our custom
-// content type.
-func Routes(config Config) *mux.Router {
-	// make new Context
-	context := &Context{config.URL, config.CiaoService}
+func scheduleResponse(c *Context, tenant string, s types.Schedule) types.Schedule {
+	ref := fmt.Sprintf("%s/schedules/%s", c.URL, s.ID)
+	if tenant != "" {
+		ref = fmt.Sprintf("%s/%s/schedules/%s", c.URL, tenant, s.ID)
+	}
 
-	r := mux.NewRouter()
+	s.Links = []types.Link{{Rel: "self", Href: ref}}
 
-	// external IP pools
-	route := r.Handle("/", Handler{context, listResources})
-	route.Methods("GET")
+	return s
+}
 
-	route = r.Handle("/{tenant:"+uuid.UUIDRegex+"}", Handler{context, listResources})
-	route.Methods("GET")
+func addSchedule(c *Context, w http.ResponseWriter, r *http.Request) (Response, error) {
+	var req types.ScheduleRequest
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
 
-	matchContent := fmt.Sprintf("application/(%s|json)", PoolsV1)
+	err := scopeAccess(r)
+	if err != nil {
+		return errorResponse(err), err
+	}
 
-	route = r.Handle("/pools", Handler{context, listPools})
-	route.Methods("GET")
-	route.HeadersRegexp("Content-Type", matchContent)
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return errorResponse(err), err
+	}
 
-	route = r.Handle("/{tenant:"+uuid.UUIDRegex+"}", Handler{context, listPools})
-	route.Methods("GET")
-	route.HeadersRegexp("Content-Type", matchContent)
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		return errorResponse(err), err
+	}
 
-	route = r.Handle("/pools", Handler{context, addPool})
-	route.Methods("POST")
-	route.HeadersRegexp("Content-Type", matchContent)
+	s, err := c.CreateSchedule(tenant, req)
+	if err != nil {
+		return errorResponse(err), err
+	}
 
-	route = r.Handle("/pools/{pool:"+uuid.UUIDRegex+"}", Handler{context, showPool})
-	route.Methods("GET")
-	route.HeadersRegexp("Content-Type", matchContent)
+	return Response{http.StatusCreated, scheduleResponse(c, tenant, s)}, nil
+}
 
-	route = r.Handle("/pools/{pool:"+uuid.UUIDRegex+"}", Handler{context, deletePool})
-	route.Methods("DELETE")
-	route.HeadersRegexp("Content-Type", matchContent)
+func listSchedules(c *Context, w http.ResponseWriter, r *http.Request) (Response, error) {
+	var resp types.ListSchedulesResponse
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
 
-	route = r.Handle("/pools/{pool:"+uuid.UUIDRegex+"}", Handler{context, addToPool})
-	route.Methods("POST")
-	route.HeadersRegexp("Content-Type", matchContent)
+	err := scopeAccess(r)
+	if err != nil {
+		return errorResponse(err), err
+	}
 
-	route = r.Handle("/pools/{pool:"+uuid.UUIDRegex+"}/subnets/{subnet:"+uuid.UUIDRegex+"}", Handler{context, deleteSubnet})
-	route.Methods("DELETE")
-	route.HeadersRegexp("Content-Type", matchContent)
+	schedules, err := c.ListSchedules(tenant)
+	if err != nil {
+		return errorResponse(err), err
+	}
 
-	route = r.Handle("/pools/{pool:"+uuid.UUIDRegex+"}/external-ips/{ip_id:"+uuid.UUIDRegex+"}", Handler{context, deleteExternalIP})
-	route.Methods("DELETE")
-	route.HeadersRegexp("Content-Type", matchContent)
+	resp.Schedules = []types.Schedule{}
+	for _, s := range schedules {
+		resp.Schedules = append(resp.Schedules, scheduleResponse(c, tenant, s))
+	}
 
-	// mapped external IPs
-	matchContent = fmt.Sprintf("application/(%s|json)", ExternalIPsV1)
+	return Response{http.StatusOK, resp}, nil
+}
 
-	route = r.Handle("/external-ips", Handler{context, listMappedIPs})
-	route.Methods("GET")
-	route.HeadersRegexp("Content-Type", matchContent)
+func showSchedule(c *Context, w http.ResponseWriter, r *http.Request) (Response, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+	ID := vars["schedule_id"]
 
-	route = r.Handle("/{tenant:"+uuid.UUIDRegex+"}/external-ips", Handler{context, listMappedIPs})
-	route.Methods("GET")
-	route.HeadersRegexp("Content-Type", matchContent)
+	err := scopeAccess(r)
+	if err != nil {
+		return errorResponse(err), err
+	}
 
-	route = r.Handle("/external-ips", Handler{context, mapExternalIP})
-	route.Methods("POST")
-	route.HeadersRegexp("Content-Type", matchContent)
+	s, err := c.ShowSchedule(tenant, ID)
+	if err != nil {
+		return errorResponse(err), err
+	}
 
-	route = r.Handle("/{tenant:"+uuid.UUIDRegex+"}/external-ips", Handler{context, mapExternalIP})
-	route.Methods("POST")
-	route.HeadersRegexp("Content-Type", matchContent)
+	return Response{http.StatusOK, scheduleResponse(c, tenant, s)}, nil
+}
 
-	route = r.Handle("/external-ips/{mapping_id:"+uuid.UUIDRegex+"}", Handler{context, unmapExternalIP})
-	route.Methods("DELETE")
-	route.HeadersRegexp("Content-Type", matchContent)
+func deleteSchedule(c *Context, w http.ResponseWriter, r *http.Request) (Response, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+	ID := vars["schedule_id"]
 
-	route = r.Handle("/{tenant:"+uuid.UUIDRegex+"}/external-ips/{mapping_id:"+uuid.UUIDRegex+"}", Handler{context, unmapExternalIP})
-	route.Methods("DELETE")
-	route.HeadersRegexp("Content-Type", matchContent)
+	err := scopeAccess(r)
+	if err != nil {
+		return errorResponse(err), err
+	}
 
-	// workloads
-	matchContent = fmt.Sprintf("application/(%s|json)", WorkloadsV1)
+	err = c.DeleteSchedule(tenant, ID)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return Response{http.StatusNoContent, nil}, nil
+}
+
+func scalingGroupResponse(c *Context, tenant string, g types.ScalingGroup) types.ScalingGroup {
+	ref := fmt.Sprintf("%s/scaling-groups/%s", c.URL, g.ID)
+	if tenant != "" {
+		ref = fmt.Sprintf("%s/%s/scaling-groups/%s", c.URL, tenant, g.ID)
+	}
+
+	g.Links = []types.Link{
+		{Rel: "self", Href: ref},
+		{Rel: "activities", Href: ref + "/activities"},
+	}
+
+	return g
+}
+
+func createScalingGroup(c *Context, w http.ResponseWriter, r *http.Request) (Response, error) {
+	var req types.ScalingGroup
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+
+	err := scopeAccess(r)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	// only admins may create groups for another tenant
+	if req.TenantID != "" && req.TenantID != tenant {
+		err = adminAccess(r)
+		if err != nil {
+			return errorResponse(err), err
+		}
+	}
+
+	g, err := c.CreateScalingGroup(tenant, req)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return Response{http.StatusCreated, scalingGroupResponse(c, tenant, g)}, nil
+}
+
+func listScalingGroups(c *Context, w http.ResponseWriter, r *http.Request) (Response, error) {
+	var resp types.ListScalingGroupsResponse
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+
+	err := scopeAccess(r)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	groups, err := c.ListScalingGroups(tenant)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	resp.ScalingGroups = []types.ScalingGroup{}
+	for _, g := range groups {
+		resp.ScalingGroups = append(resp.ScalingGroups, scalingGroupResponse(c, tenant, g))
+	}
+
+	return Response{http.StatusOK, resp}, nil
+}
+
+func showScalingGroup(c *Context, w http.ResponseWriter, r *http.Request) (Response, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+	ID := vars["group_id"]
+
+	err := scopeAccess(r)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	status, err := c.ShowScalingGroup(tenant, ID)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	status.ScalingGroup = scalingGroupResponse(c, tenant, status.ScalingGroup)
+
+	return Response{http.StatusOK, status}, nil
+}
+
+func updateScalingGroup(c *Context, w http.ResponseWriter, r *http.Request) (Response, error) {
+	var req types.ScalingGroup
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+
+	err := scopeAccess(r)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	req.ID = vars["group_id"]
+
+	g, err := c.UpdateScalingGroup(tenant, req)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return Response{http.StatusOK, scalingGroupResponse(c, tenant, g)}, nil
+}
+
+func deleteScalingGroup(c *Context, w http.ResponseWriter, r *http.Request) (Response, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+	ID := vars["group_id"]
+
+	err := scopeAccess(r)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	err = c.DeleteScalingGroup(tenant, ID)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return Response{http.StatusNoContent, nil}, nil
+}
+
+func listScalingActivities(c *Context, w http.ResponseWriter, r *http.Request) (Response, error) {
+	var resp types.ListScalingActivitiesResponse
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+	ID := vars["group_id"]
+
+	err := scopeAccess(r)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	activities, err := c.ListScalingActivities(tenant, ID)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	resp.Activities = append([]types.ScalingActivity{}, activities...)
+
+	return Response{http.StatusOK, resp}, nil
+}
+
+// tenantAccess checks that the caller may read the details of tenantID.
+// Admins may read any tenant, tenants may only read their own details.
+func tenantAccess(r *http.Request, tenantID string) error {
+	vars := mux.Vars(r)
+	tenant, ok := vars["tenant"]
+
+	if !ok {
+		return adminAccess(r)
+	}
+
+	if tenant != tenantID {
+		return types.ErrTenantNotFound
+	}
+
+	return nil
+}
+
+// scopeAccess checks that the caller may use the route of the request.
+// The routes without a tenant act on behalf of every tenant and are
+// restricted to admins.
+func scopeAccess(r *http.Request) error {
+	vars := mux.Vars(r)
+	if _, ok := vars["tenant"]; ok {
+		return nil
+	}
+
+	return adminAccess(r)
+}
+
+// adminAccess checks that the caller has been authenticated as an admin.
+func adminAccess(r *http.Request) error {
+	if !identity.Privileged(r.Context()) {
+		return types.ErrNotAdmin
+	}
+
+	return nil
+}
+
+func tenantResponse(c *Context, tenant string, t types.TenantSummary) types.TenantSummary {
+	ref := fmt.Sprintf("%s/tenants/%s", c.URL, t.ID)
+	if tenant != "" {
+		ref = fmt.Sprintf("%s/%s/tenants/%s", c.URL, tenant, t.ID)
+	}
+
+	t.Links = []types.Link{
+		{
+			Rel:  "self",
+			Href: ref,
+		},
+		{
+			Rel:  "quotas",
+			Href: ref + "/quotas",
+		},
+	}
+
+	return t
+}
+
+func listTenants(c *Context, w http.ResponseWriter, r *http.Request) (Response, error) {
+	var resp types.TenantsListResponse
+
+	err := adminAccess(r)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	tenants, err := c.ListTenants()
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	resp.Tenants = []types.TenantSummary{}
+	for _, t := range tenants {
+		resp.Tenants = append(resp.Tenants, tenantResponse(c, "", t))
+	}
+
+	return Response{http.StatusOK, resp}, nil
+}
+
+func addTenant(c *Context, w http.ResponseWriter, r *http.Request) (Response, error) {
+	var req types.TenantRequest
+
+	err := adminAccess(r)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	if req.ID == "" {
+		return errorResponse(types.ErrBadRequest), types.ErrBadRequest
+	}
+
+	t, err := c.CreateTenant(req.ID, req.Name)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return Response{http.StatusCreated, tenantResponse(c, "", t)}, nil
+}
+
+func showTenant(c *Context, w http.ResponseWriter, r *http.Request) (Response, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+	ID := vars["tenant_id"]
+
+	err := tenantAccess(r, ID)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	t, err := c.ShowTenant(ID)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return Response{http.StatusOK, tenantResponse(c, tenant, t)}, nil
+}
+
+func updateTenant(c *Context, w http.ResponseWriter, r *http.Request) (Response, error) {
+	var req types.TenantRequest
+	vars := mux.Vars(r)
+	ID := vars["tenant_id"]
+
+	err := adminAccess(r)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	if req.ID != "" && req.ID != ID {
+		return errorResponse(types.ErrBadRequest), types.ErrBadRequest
+	}
+
+	t, err := c.UpdateTenant(ID, req.Name)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return Response{http.StatusOK, tenantResponse(c, "", t)}, nil
+}
+
+func deleteTenant(c *Context, w http.ResponseWriter, r *http.Request) (Response, error) {
+	vars := mux.Vars(r)
+	ID := vars["tenant_id"]
+
+	err := adminAccess(r)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	err = c.DeleteTenant(ID)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return Response{http.StatusNoContent, nil}, nil
+}
+
+func listQuotas(c *Context, w http.ResponseWriter, r *http.Request) (Response, error) {
+	vars := mux.Vars(r)
+	ID := vars["tenant_id"]
+
+	err := tenantAccess(r, ID)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	quotas, err := c.ListQuotas(ID)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return Response{http.StatusOK, types.QuotaListResponse{Quotas: quotas}}, nil
+}
+
+func updateQuotas(c *Context, w http.ResponseWriter, r *http.Request) (Response, error) {
+	var req types.QuotaUpdateRequest
+	vars := mux.Vars(r)
+	ID := vars["tenant_id"]
+
+	err := adminAccess(r)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	quotas, err := c.UpdateQuotas(ID, req.Quotas)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return Response{http.StatusOK, types.QuotaListResponse{Quotas: quotas}}, nil
+}
+
+// Service is an interface which must be implemented by the ciao API context.
+type Service interface {
+	AddPool(name string, subnet *string, ips []string) (types.Pool, error)
+	ListPools() ([]types.Pool, error)
+	ShowPool(id string) (types.Pool, error)
+	DeletePool(id string) error
+	AddAddress(poolID string, subnet *string, IPs []string) error
+	RemoveAddress(poolID string, subnetID *string, IPID *string) error
+	ListMappedAddresses(tenantID *string) []types.MappedIP
+	MapAddress(poolName *string, instanceID string) error
+	UnMapAddress(ID string) error
+	CreateWorkload(req types.Workload) (types.Workload, error)
+	ListWorkloads(tenantID string) ([]types.Workload, error)
+	ShowWorkload(tenantID string, ID string) (types.Workload, error)
+	UpdateWorkload(tenantID string, req types.Workload) (types.Workload, error)
+	DeleteWorkload(tenantID string, ID string) error
+	ListTenants() ([]types.TenantSummary, error)
+	CreateTenant(ID string, name string) (types.TenantSummary, error)
+	ShowTenant(ID string) (types.TenantSummary, error)
+	UpdateTenant(ID string, name string) (types.TenantSummary, error)
+	DeleteTenant(ID string) error
+	ListQuotas(tenantID string) ([]types.QuotaDetails, error)
+	UpdateQuotas(tenantID string, quotas []types.QuotaDetails) ([]types.QuotaDetails, error)
+	CreateSchedule(tenantID string, req types.ScheduleRequest) (types.Schedule, error)
+	ListSchedules(tenantID string) ([]types.Schedule, error)
+	ShowSchedule(tenantID string, ID string) (types.Schedule, error)
+	DeleteSchedule(tenantID string, ID string) error
+	CreateScalingGroup(tenantID string, req types.ScalingGroup) (types.ScalingGroup, error)
+	ListScalingGroups(tenantID string) ([]types.ScalingGroup, error)
+	ShowScalingGroup(tenantID string, ID string) (types.ScalingGroupStatus, error)
+	UpdateScalingGroup(tenantID string, req types.ScalingGroup) (types.ScalingGroup, error)
+	DeleteScalingGroup(tenantID string, ID string) error
+	ListScalingActivities(tenantID string, ID string) ([]types.ScalingActivity, error)
+}
+
+// Context is used to provide the services and current URL to the handlers.
+type Context struct {
+	URL string
+	Service
+}
+
+// Config is used to setup the Context for the ciao API.
+type Config struct {
+	URL         string
+	CiaoService Service
+}
+
+// Routes returns the supported ciao API endpoints.
+// A plain application/json request will return v1 of the resource
+// since we only have one version of this api so far, that means
+// most routes will match both json as well as our custom
+// content type.
+func Routes(config Config) *mux.Router {
+	// make new Context
+	context := &Context{config.URL, config.CiaoService}
+
+	r := mux.NewRouter()
+
+	// external IP pools
+	route := r.Handle("/", Handler{context, listResources})
+	route.Methods("GET")
+
+	route = r.Handle("/{tenant:"+uuid.UUIDRegex+"}", Handler{context, listResources})
+	route.Methods("GET")
+
+	matchContent := fmt.Sprintf("application/(%s|json)", PoolsV1)
+
+	route = r.Handle("/pools", Handler{context, listPools})
+	route.Methods("GET")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/{tenant:"+uuid.UUIDRegex+"}", Handler{context, listPools})
+	route.Methods("GET")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/pools", Handler{context, addPool})
+	route.Methods("POST")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/pools/{pool:"+uuid.UUIDRegex+"}", Handler{context, showPool})
+	route.Methods("GET")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/pools/{pool:"+uuid.UUIDRegex+"}", Handler{context, deletePool})
+	route.Methods("DELETE")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/pools/{pool:"+uuid.UUIDRegex+"}", Handler{context, addToPool})
+	route.Methods("POST")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/pools/{pool:"+uuid.UUIDRegex+"}/subnets/{subnet:"+uuid.UUIDRegex+"}", Handler{context, deleteSubnet})
+	route.Methods("DELETE")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/pools/{pool:"+uuid.UUIDRegex+"}/external-ips/{ip_id:"+uuid.UUIDRegex+"}", Handler{context, deleteExternalIP})
+	route.Methods("DELETE")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	// mapped external IPs
+	matchContent = fmt.Sprintf("application/(%s|json)", ExternalIPsV1)
+
+	route = r.Handle("/external-ips", Handler{context, listMappedIPs})
+	route.Methods("GET")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/{tenant:"+uuid.UUIDRegex+"}/external-ips", Handler{context, listMappedIPs})
+	route.Methods("GET")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/external-ips", Handler{context, mapExternalIP})
+	route.Methods("POST")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/{tenant:"+uuid.UUIDRegex+"}/external-ips", Handler{context, mapExternalIP})
+	route.Methods("POST")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/external-ips/{mapping_id:"+uuid.UUIDRegex+"}", Handler{context, unmapExternalIP})
+	route.Methods("DELETE")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/{tenant:"+uuid.UUIDRegex+"}/external-ips/{mapping_id:"+uuid.UUIDRegex+"}", Handler{context, unmapExternalIP})
+	route.Methods("DELETE")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	// workloads
+	matchContent = fmt.Sprintf("application/(%s|json)", WorkloadsV1)
+
+	route = r.Handle("/workloads", Handler{context, addWorkload})
+	route.Methods("POST")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/{tenant:"+uuid.UUIDRegex+"}/workloads", Handler{context, addWorkload})
+	route.Methods("POST")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/workloads", Handler{context, listWorkloads})
+	route.Methods("GET")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/{tenant:"+uuid.UUIDRegex+"}/workloads", Handler{context, listWorkloads})
+	route.Methods("GET")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/workloads/{workload_id:"+uuid.UUIDRegex+"}", Handler{context, showWorkload})
+	route.Methods("GET")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/{tenant:"+uuid.UUIDRegex+"}/workloads/{workload_id:"+uuid.UUIDRegex+"}", Handler{context, showWorkload})
+	route.Methods("GET")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/workloads/{workload_id:"+uuid.UUIDRegex+"}", Handler{context, updateWorkload})
+	route.Methods("PUT")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/{tenant:"+uuid.UUIDRegex+"}/workloads/{workload_id:"+uuid.UUIDRegex+"}", Handler{context, updateWorkload})
+	route.Methods("PUT")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/workloads/{workload_id:"+uuid.UUIDRegex+"}", Handler{context, deleteWorkload})
+	route.Methods("DELETE")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/{tenant:"+uuid.UUIDRegex+"}/workloads/{workload_id:"+uuid.UUIDRegex+"}", Handler{context, deleteWorkload})
+	route.Methods("DELETE")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	// tenants and their quotas
+	matchContent = fmt.Sprintf("application/(%s|json)", TenantsV1)
+
+	route = r.Handle("/tenants", Handler{context, listTenants})
+	route.Methods("GET")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/tenants", Handler{context, addTenant})
+	route.Methods("POST")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/tenants/{tenant_id:"+uuid.UUIDRegex+"}", Handler{context, showTenant})
+	route.Methods("GET")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/{tenant:"+uuid.UUIDRegex+"}/tenants/{tenant_id:"+uuid.UUIDRegex+"}", Handler{context, showTenant})
+	route.Methods("GET")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/tenants/{tenant_id:"+uuid.UUIDRegex+"}", Handler{context, updateTenant})
+	route.Methods("PUT")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/tenants/{tenant_id:"+uuid.UUIDRegex+"}", Handler{context, deleteTenant})
+	route.Methods("DELETE")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/tenants/{tenant_id:"+uuid.UUIDRegex+"}/quotas", Handler{context, listQuotas})
+	route.Methods("GET")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/{tenant:"+uuid.UUIDRegex+"}/tenants/{tenant_id:"+uuid.UUIDRegex+"}/quotas", Handler{context, listQuotas})
+	route.Methods("GET")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/tenants/{tenant_id:"+uuid.UUIDRegex+"}/quotas", Handler{context, updateQuotas})
+	route.Methods("PUT")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	// instance schedules
+	matchContent = fmt.Sprintf("application/(%s|json)", SchedulesV1)
+
+	route = r.Handle("/schedules", Handler{context, addSchedule})
+	route.Methods("POST")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/{tenant:"+uuid.UUIDRegex+"}/schedules", Handler{context, addSchedule})
+	route.Methods("POST")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/schedules", Handler{context, listSchedules})
+	route.Methods("GET")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/{tenant:"+uuid.UUIDRegex+"}/schedules", Handler{context, listSchedules})
+	route.Methods("GET")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/schedules/{schedule_id:"+uuid.UUIDRegex+"}", Handler{context, showSchedule})
+	route.Methods("GET")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/{tenant:"+uuid.UUIDRegex+"}/schedules/{schedule_id:"+uuid.UUIDRegex+"}", Handler{context, showSchedule})
+	route.Methods("GET")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/schedules/{schedule_id:"+uuid.UUIDRegex+"}", Handler{context, deleteSchedule})
+	route.Methods("DELETE")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/{tenant:"+uuid.UUIDRegex+"}/schedules/{schedule_id:"+uuid.UUIDRegex+"}", Handler{context, deleteSchedule})
+	route.Methods("DELETE")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	// scaling groups
+	matchContent = fmt.Sprintf("application/(%s|json)", ScalingGroupsV1)
+
+	route = r.Handle("/scaling-groups", Handler{context, createScalingGroup})
+	route.Methods("POST")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/{tenant:"+uuid.UUIDRegex+"}/scaling-groups", Handler{context, createScalingGroup})
+	route.Methods("POST")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/scaling-groups", Handler{context, listScalingGroups})
+	route.Methods("GET")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/{tenant:"+uuid.UUIDRegex+"}/scaling-groups", Handler{context, listScalingGroups})
+	route.Methods("GET")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/scaling-groups/{group_id:"+uuid.UUIDRegex+"}", Handler{context, showScalingGroup})
+	route.Methods("GET")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/{tenant:"+uuid.UUIDRegex+"}/scaling-groups/{group_id:"+uuid.UUIDRegex+"}", Handler{context, showScalingGroup})
+	route.Methods("GET")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/scaling-groups/{group_id:"+uuid.UUIDRegex+"}", Handler{context, updateScalingGroup})
+	route.Methods("PUT")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/{tenant:"+uuid.UUIDRegex+"}/scaling-groups/{group_id:"+uuid.UUIDRegex+"}", Handler{context, updateScalingGroup})
+	route.Methods("PUT")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/scaling-groups/{group_id:"+uuid.UUIDRegex+"}", Handler{context, deleteScalingGroup})
+	route.Methods("DELETE")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/{tenant:"+uuid.UUIDRegex+"}/scaling-groups/{group_id:"+uuid.UUIDRegex+"}", Handler{context, deleteScalingGroup})
+	route.Methods("DELETE")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/scaling-groups/{group_id:"+uuid.UUIDRegex+"}/activities", Handler{context, listScalingActivities})
+	route.Methods("GET")
+	route.HeadersRegexp("Content-Type", matchContent)
+
+	route = r.Handle("/{tenant:"+uuid.UUIDRegex+"}/scaling-groups/{group_id:"+uuid.UUIDRegex+"}/activities", Handler{context, listScalingActivities})
+	route.Methods("GET")
+	route.HeadersRegexp("Content-Type", matchContent)
 
-	route = r.Handle("/workloads", Handler{context, addWorkload})
-	route.Methods("POST")
-	route.HeadersRegexp("Content-Type", matchContent)
 	return r
 }
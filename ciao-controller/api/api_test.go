@@ -21,8 +21,12 @@ import (
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/01org/ciao/ciao-controller/types"
+	"github.com/01org/ciao/openstack/identity"
+	"github.com/01org/ciao/payloads"
+	"github.com/gorilla/mux"
 )
 
 type test struct {
@@ -48,7 +52,7 @@ var tests = []test{
 		"",
 		"application/text",
 		http.StatusOK,
-		`[{"rel":"pools","href":"/pools","version":"x.ciao.pools.v1","minimum_version":"x.ciao.pools.v1"},{"rel":"external-ips","href":"/external-ips","version":"x.ciao.external-ips.v1","minimum_version":"x.ciao.external-ips.v1"},{"rel":"workloads","href":"/workloads","version":"x.ciao.workloads.v1","minimum_version":"x.ciao.workloads.v1"}]`,
+		`[{"rel":"pools","href":"/pools","version":"x.ciao.pools.v1","minimum_version":"x.ciao.pools.v1"},{"rel":"external-ips","href":"/external-ips","version":"x.ciao.external-ips.v1","minimum_version":"x.ciao.external-ips.v1"},{"rel":"workloads","href":"/workloads","version":"x.ciao.workloads.v1","minimum_version":"x.ciao.workloads.v1"},{"rel":"tenants","href":"/tenants","version":"x.ciao.tenants.v1","minimum_version":"x.ciao.tenants.v1"},{"rel":"schedules","href":"/schedules","version":"x.ciao.schedules.v1","minimum_version":"x.ciao.schedules.v1"},{"rel":"scaling-groups","href":"/scaling-groups","version":"x.ciao.scaling-groups.v1","minimum_version":"x.ciao.scaling-groups.v1"}]`,
 	},
 	{
 		"GET",
@@ -149,6 +153,195 @@ var tests = []test{
 		http.StatusCreated,
 		`{"workload":{"id":"ba58f471-0735-4773-9550-188e2d012941","description":"testWorkload","fw_type":"legacy","vm_type":"qemu","image_id":"73a86d7e-93c0-480e-9c41-ab42f69b7799","image_name":"","config":"this will totally work!","defaults":[],"storage":null},"link":{"rel":"self","href":"/workloads/ba58f471-0735-4773-9550-188e2d012941"}}`,
 	},
+	{
+		"GET",
+		"/workloads",
+		listWorkloads,
+		"",
+		"application/x.ciao.v1.workloads",
+		http.StatusOK,
+		`{"workloads":[{"workload":{"id":"ba58f471-0735-4773-9550-188e2d012941","description":"testWorkload","fw_type":"legacy","vm_type":"qemu","image_id":"","image_name":"","config":"this will totally work!","defaults":[],"storage":null,"visibility":"public"},"link":{"rel":"self","href":"/workloads/ba58f471-0735-4773-9550-188e2d012941"}}]}`,
+	},
+	{
+		"GET",
+		"/workloads/ba58f471-0735-4773-9550-188e2d012941",
+		showWorkload,
+		"",
+		"application/x.ciao.v1.workloads",
+		http.StatusOK,
+		`{"workload":{"id":"ba58f471-0735-4773-9550-188e2d012941","description":"testWorkload","fw_type":"legacy","vm_type":"qemu","image_id":"","image_name":"","config":"this will totally work!","defaults":[],"storage":null,"visibility":"public"},"link":{"rel":"self","href":"/workloads/ba58f471-0735-4773-9550-188e2d012941"}}`,
+	},
+	{
+		"PUT",
+		"/workloads/ba58f471-0735-4773-9550-188e2d012941",
+		updateWorkload,
+		`{"description":"updatedWorkload","fw_type":"legacy","vm_type":"qemu","config":"this will totally work!","defaults":[]}`,
+		"application/x.ciao.v1.workloads",
+		http.StatusOK,
+		`{"workload":{"id":"ba58f471-0735-4773-9550-188e2d012941","description":"updatedWorkload","fw_type":"legacy","vm_type":"qemu","image_id":"","image_name":"","config":"this will totally work!","defaults":[],"storage":null},"link":{"rel":"self","href":"/workloads/ba58f471-0735-4773-9550-188e2d012941"}}`,
+	},
+	{
+		"DELETE",
+		"/workloads/ba58f471-0735-4773-9550-188e2d012941",
+		deleteWorkload,
+		"",
+		"application/x.ciao.v1.workloads",
+		http.StatusNoContent,
+		"null",
+	},
+	{
+		"GET",
+		"/tenants",
+		listTenants,
+		"",
+		"application/x.ciao.v1.tenants",
+		http.StatusOK,
+		`{"tenants":[{"id":"093ae09b-f653-464e-9ae6-5ae28bd03a22","name":"testTenant","links":[{"rel":"self","href":"/tenants/093ae09b-f653-464e-9ae6-5ae28bd03a22"},{"rel":"quotas","href":"/tenants/093ae09b-f653-464e-9ae6-5ae28bd03a22/quotas"}]}]}`,
+	},
+	{
+		"POST",
+		"/tenants",
+		addTenant,
+		`{"id":"093ae09b-f653-464e-9ae6-5ae28bd03a22","name":"testTenant"}`,
+		"application/x.ciao.v1.tenants",
+		http.StatusCreated,
+		`{"id":"093ae09b-f653-464e-9ae6-5ae28bd03a22","name":"testTenant","links":[{"rel":"self","href":"/tenants/093ae09b-f653-464e-9ae6-5ae28bd03a22"},{"rel":"quotas","href":"/tenants/093ae09b-f653-464e-9ae6-5ae28bd03a22/quotas"}]}`,
+	},
+	{
+		"GET",
+		"/tenants/093ae09b-f653-464e-9ae6-5ae28bd03a22",
+		showTenant,
+		"",
+		"application/x.ciao.v1.tenants",
+		http.StatusOK,
+		`{"id":"093ae09b-f653-464e-9ae6-5ae28bd03a22","name":"testTenant","links":[{"rel":"self","href":"/tenants/093ae09b-f653-464e-9ae6-5ae28bd03a22"},{"rel":"quotas","href":"/tenants/093ae09b-f653-464e-9ae6-5ae28bd03a22/quotas"}]}`,
+	},
+	{
+		"PUT",
+		"/tenants/093ae09b-f653-464e-9ae6-5ae28bd03a22",
+		updateTenant,
+		`{"name":"renamedTenant"}`,
+		"application/x.ciao.v1.tenants",
+		http.StatusOK,
+		`{"id":"093ae09b-f653-464e-9ae6-5ae28bd03a22","name":"renamedTenant","links":[{"rel":"self","href":"/tenants/093ae09b-f653-464e-9ae6-5ae28bd03a22"},{"rel":"quotas","href":"/tenants/093ae09b-f653-464e-9ae6-5ae28bd03a22/quotas"}]}`,
+	},
+	{
+		"DELETE",
+		"/tenants/093ae09b-f653-464e-9ae6-5ae28bd03a22",
+		deleteTenant,
+		"",
+		"application/x.ciao.v1.tenants",
+		http.StatusNoContent,
+		"null",
+	},
+	{
+		"GET",
+		"/tenants/093ae09b-f653-464e-9ae6-5ae28bd03a22/quotas",
+		listQuotas,
+		"",
+		"application/x.ciao.v1.tenants",
+		http.StatusOK,
+		`{"quotas":[{"name":"instances","value":10,"usage":1},{"name":"vcpus","value":-1,"usage":2}]}`,
+	},
+	{
+		"PUT",
+		"/tenants/093ae09b-f653-464e-9ae6-5ae28bd03a22/quotas",
+		updateQuotas,
+		`{"quotas":[{"name":"instances","value":20}]}`,
+		"application/x.ciao.v1.tenants",
+		http.StatusOK,
+		`{"quotas":[{"name":"instances","value":20,"usage":1},{"name":"vcpus","value":-1,"usage":2}]}`,
+	},
+	{
+		"GET",
+		"/schedules",
+		listSchedules,
+		"",
+		"application/x.ciao.v1.schedules",
+		http.StatusOK,
+		`{"schedules":[{"id":"5e2a9c7b-1d3f-4a6e-8b0c-2f4d6e8a0b13","tenant_id":"093ae09b-f653-464e-9ae6-5ae28bd03a22","tag":"dev","action":"stop","cron":"0 19 * * 1-5","create_time":"2017-03-01T10:00:00Z","last_run":"0001-01-01T00:00:00Z","next_run":"2017-03-01T19:00:00Z","links":[{"rel":"self","href":"/schedules/5e2a9c7b-1d3f-4a6e-8b0c-2f4d6e8a0b13"}]}]}`,
+	},
+	{
+		"POST",
+		"/schedules",
+		addSchedule,
+		`{"tenant_id":"093ae09b-f653-464e-9ae6-5ae28bd03a22","tag":"dev","action":"stop","cron":"0 19 * * 1-5"}`,
+		"application/x.ciao.v1.schedules",
+		http.StatusCreated,
+		`{"id":"5e2a9c7b-1d3f-4a6e-8b0c-2f4d6e8a0b13","tenant_id":"093ae09b-f653-464e-9ae6-5ae28bd03a22","tag":"dev","action":"stop","cron":"0 19 * * 1-5","create_time":"2017-03-01T10:00:00Z","last_run":"0001-01-01T00:00:00Z","next_run":"2017-03-01T19:00:00Z","links":[{"rel":"self","href":"/schedules/5e2a9c7b-1d3f-4a6e-8b0c-2f4d6e8a0b13"}]}`,
+	},
+	{
+		"GET",
+		"/schedules/5e2a9c7b-1d3f-4a6e-8b0c-2f4d6e8a0b13",
+		showSchedule,
+		"",
+		"application/x.ciao.v1.schedules",
+		http.StatusOK,
+		`{"id":"5e2a9c7b-1d3f-4a6e-8b0c-2f4d6e8a0b13","tenant_id":"093ae09b-f653-464e-9ae6-5ae28bd03a22","tag":"dev","action":"stop","cron":"0 19 * * 1-5","create_time":"2017-03-01T10:00:00Z","last_run":"0001-01-01T00:00:00Z","next_run":"2017-03-01T19:00:00Z","links":[{"rel":"self","href":"/schedules/5e2a9c7b-1d3f-4a6e-8b0c-2f4d6e8a0b13"}]}`,
+	},
+	{
+		"DELETE",
+		"/schedules/5e2a9c7b-1d3f-4a6e-8b0c-2f4d6e8a0b13",
+		deleteSchedule,
+		"",
+		"application/x.ciao.v1.schedules",
+		http.StatusNoContent,
+		"null",
+	},
+	{
+		"GET",
+		"/scaling-groups",
+		listScalingGroups,
+		"",
+		"application/x.ciao.v1.scaling-groups",
+		http.StatusOK,
+		`{"scaling_groups":[{"id":"a3c1e5b7-9d2f-4e6a-8c0b-1d3f5a7c9e24","tenant_id":"093ae09b-f653-464e-9ae6-5ae28bd03a22","name":"web","workload_id":"ab68111c-03a6-11e6-87de-001320fb6e31","min_instances":1,"max_instances":4,"desired_instances":2,"scale_out":{"metric":"cpu","threshold":80,"period":300,"step":1},"cooldown":600,"create_time":"2017-03-01T10:00:00Z","last_scale":"0001-01-01T00:00:00Z","links":[{"rel":"self","href":"/scaling-groups/a3c1e5b7-9d2f-4e6a-8c0b-1d3f5a7c9e24"},{"rel":"activities","href":"/scaling-groups/a3c1e5b7-9d2f-4e6a-8c0b-1d3f5a7c9e24/activities"}]}]}`,
+	},
+	{
+		"POST",
+		"/scaling-groups",
+		createScalingGroup,
+		`{"tenant_id":"093ae09b-f653-464e-9ae6-5ae28bd03a22","name":"web","workload_id":"ab68111c-03a6-11e6-87de-001320fb6e31","min_instances":1,"max_instances":4,"desired_instances":2,"scale_out":{"metric":"cpu","threshold":80,"period":300,"step":1},"cooldown":600}`,
+		"application/x.ciao.v1.scaling-groups",
+		http.StatusCreated,
+		`{"id":"a3c1e5b7-9d2f-4e6a-8c0b-1d3f5a7c9e24","tenant_id":"093ae09b-f653-464e-9ae6-5ae28bd03a22","name":"web","workload_id":"ab68111c-03a6-11e6-87de-001320fb6e31","min_instances":1,"max_instances":4,"desired_instances":2,"scale_out":{"metric":"cpu","threshold":80,"period":300,"step":1},"cooldown":600,"create_time":"2017-03-01T10:00:00Z","last_scale":"0001-01-01T00:00:00Z","links":[{"rel":"self","href":"/scaling-groups/a3c1e5b7-9d2f-4e6a-8c0b-1d3f5a7c9e24"},{"rel":"activities","href":"/scaling-groups/a3c1e5b7-9d2f-4e6a-8c0b-1d3f5a7c9e24/activities"}]}`,
+	},
+	{
+		"GET",
+		"/scaling-groups/a3c1e5b7-9d2f-4e6a-8c0b-1d3f5a7c9e24",
+		showScalingGroup,
+		"",
+		"application/x.ciao.v1.scaling-groups",
+		http.StatusOK,
+		`{"id":"a3c1e5b7-9d2f-4e6a-8c0b-1d3f5a7c9e24","tenant_id":"093ae09b-f653-464e-9ae6-5ae28bd03a22","name":"web","workload_id":"ab68111c-03a6-11e6-87de-001320fb6e31","min_instances":1,"max_instances":4,"desired_instances":2,"scale_out":{"metric":"cpu","threshold":80,"period":300,"step":1},"cooldown":600,"create_time":"2017-03-01T10:00:00Z","last_scale":"0001-01-01T00:00:00Z","links":[{"rel":"self","href":"/scaling-groups/a3c1e5b7-9d2f-4e6a-8c0b-1d3f5a7c9e24"},{"rel":"activities","href":"/scaling-groups/a3c1e5b7-9d2f-4e6a-8c0b-1d3f5a7c9e24/activities"}],"instances":["3390740c-dce9-48d6-b83a-a717417072ce"],"running":1,"metrics":{"cpu":42}}`,
+	},
+	{
+		"PUT",
+		"/scaling-groups/a3c1e5b7-9d2f-4e6a-8c0b-1d3f5a7c9e24",
+		updateScalingGroup,
+		`{"name":"web","min_instances":1,"max_instances":4,"desired_instances":2,"scale_out":{"metric":"cpu","threshold":80,"period":300,"step":1},"cooldown":600}`,
+		"application/x.ciao.v1.scaling-groups",
+		http.StatusOK,
+		`{"id":"a3c1e5b7-9d2f-4e6a-8c0b-1d3f5a7c9e24","tenant_id":"093ae09b-f653-464e-9ae6-5ae28bd03a22","name":"web","workload_id":"ab68111c-03a6-11e6-87de-001320fb6e31","min_instances":1,"max_instances":4,"desired_instances":2,"scale_out":{"metric":"cpu","threshold":80,"period":300,"step":1},"cooldown":600,"create_time":"2017-03-01T10:00:00Z","last_scale":"0001-01-01T00:00:00Z","links":[{"rel":"self","href":"/scaling-groups/a3c1e5b7-9d2f-4e6a-8c0b-1d3f5a7c9e24"},{"rel":"activities","href":"/scaling-groups/a3c1e5b7-9d2f-4e6a-8c0b-1d3f5a7c9e24/activities"}]}`,
+	},
+	{
+		"DELETE",
+		"/scaling-groups/a3c1e5b7-9d2f-4e6a-8c0b-1d3f5a7c9e24",
+		deleteScalingGroup,
+		"",
+		"application/x.ciao.v1.scaling-groups",
+		http.StatusNoContent,
+		"null",
+	},
+	{
+		"GET",
+		"/scaling-groups/a3c1e5b7-9d2f-4e6a-8c0b-1d3f5a7c9e24/activities",
+		listScalingActivities,
+		"",
+		"application/x.ciao.v1.scaling-groups",
+		http.StatusOK,
+		`{"activities":[{"group_id":"a3c1e5b7-9d2f-4e6a-8c0b-1d3f5a7c9e24","timestamp":"2017-03-01T10:00:00Z","from":0,"to":2,"reason":"scaling group created"}]}`,
+	},
 }
 
 type testCiaoService struct{}
@@ -259,6 +452,167 @@ func (ts testCiaoService) CreateWorkload(req types.Workload) (types.Workload, er
 	return req, nil
 }
 
+func (ts testCiaoService) ListWorkloads(tenant string) ([]types.Workload, error) {
+	wl, err := ts.ShowWorkload(tenant, "ba58f471-0735-4773-9550-188e2d012941")
+	return []types.Workload{wl}, err
+}
+
+func (ts testCiaoService) ShowWorkload(tenant string, ID string) (types.Workload, error) {
+	return types.Workload{
+		ID:          "ba58f471-0735-4773-9550-188e2d012941",
+		Description: "testWorkload",
+		FWType:      "legacy",
+		VMType:      "qemu",
+		Config:      "this will totally work!",
+		Defaults:    []payloads.RequestedResource{},
+		Visibility:  types.Public,
+	}, nil
+}
+
+func (ts testCiaoService) UpdateWorkload(tenant string, req types.Workload) (types.Workload, error) {
+	if req.ID == "" {
+		req.ID = "ba58f471-0735-4773-9550-188e2d012941"
+	}
+	return req, nil
+}
+
+func (ts testCiaoService) DeleteWorkload(tenant string, ID string) error {
+	return nil
+}
+
+const testTenantID = "093ae09b-f653-464e-9ae6-5ae28bd03a22"
+
+func (ts testCiaoService) ListTenants() ([]types.TenantSummary, error) {
+	t, err := ts.ShowTenant(testTenantID)
+	return []types.TenantSummary{t}, err
+}
+
+func (ts testCiaoService) CreateTenant(ID string, name string) (types.TenantSummary, error) {
+	return types.TenantSummary{ID: ID, Name: name}, nil
+}
+
+func (ts testCiaoService) ShowTenant(ID string) (types.TenantSummary, error) {
+	return types.TenantSummary{ID: testTenantID, Name: "testTenant"}, nil
+}
+
+func (ts testCiaoService) UpdateTenant(ID string, name string) (types.TenantSummary, error) {
+	return types.TenantSummary{ID: testTenantID, Name: name}, nil
+}
+
+func (ts testCiaoService) DeleteTenant(ID string) error {
+	return nil
+}
+
+func (ts testCiaoService) ListQuotas(tenantID string) ([]types.QuotaDetails, error) {
+	return []types.QuotaDetails{
+		{Name: types.InstancesQuota, Value: 10, Usage: 1},
+		{Name: types.VCPUsQuota, Value: -1, Usage: 2},
+	}, nil
+}
+
+func (ts testCiaoService) UpdateQuotas(tenantID string, quotas []types.QuotaDetails) ([]types.QuotaDetails, error) {
+	current, _ := ts.ListQuotas(tenantID)
+	for _, q := range quotas {
+		for i := range current {
+			if current[i].Name == q.Name {
+				current[i].Value = q.Value
+			}
+		}
+	}
+	return current, nil
+}
+
+const testScheduleID = "5e2a9c7b-1d3f-4a6e-8b0c-2f4d6e8a0b13"
+
+func (ts testCiaoService) CreateSchedule(tenantID string, req types.ScheduleRequest) (types.Schedule, error) {
+	return types.Schedule{
+		ID:         testScheduleID,
+		TenantID:   req.TenantID,
+		Tag:        req.Tag,
+		Action:     req.Action,
+		Cron:       req.Cron,
+		CreateTime: time.Date(2017, time.March, 1, 10, 0, 0, 0, time.UTC),
+		NextRun:    time.Date(2017, time.March, 1, 19, 0, 0, 0, time.UTC),
+	}, nil
+}
+
+func (ts testCiaoService) ListSchedules(tenantID string) ([]types.Schedule, error) {
+	s, err := ts.ShowSchedule(tenantID, testScheduleID)
+	return []types.Schedule{s}, err
+}
+
+func (ts testCiaoService) ShowSchedule(tenantID string, ID string) (types.Schedule, error) {
+	return ts.CreateSchedule(tenantID, types.ScheduleRequest{
+		TenantID: testTenantID,
+		Tag:      "dev",
+		Action:   types.ScheduleStop,
+		Cron:     "0 19 * * 1-5",
+	})
+}
+
+func (ts testCiaoService) DeleteSchedule(tenantID string, ID string) error {
+	return nil
+}
+
+const testScalingGroupID = "a3c1e5b7-9d2f-4e6a-8c0b-1d3f5a7c9e24"
+
+func (ts testCiaoService) CreateScalingGroup(tenantID string, req types.ScalingGroup) (types.ScalingGroup, error) {
+	req.ID = testScalingGroupID
+	req.CreateTime = time.Date(2017, time.March, 1, 10, 0, 0, 0, time.UTC)
+	return req, nil
+}
+
+func (ts testCiaoService) ListScalingGroups(tenantID string) ([]types.ScalingGroup, error) {
+	g, err := ts.UpdateScalingGroup(tenantID, types.ScalingGroup{})
+	return []types.ScalingGroup{g}, err
+}
+
+func (ts testCiaoService) ShowScalingGroup(tenantID string, ID string) (types.ScalingGroupStatus, error) {
+	g, err := ts.UpdateScalingGroup(tenantID, types.ScalingGroup{})
+	return types.ScalingGroupStatus{
+		ScalingGroup: g,
+		Instances:    []string{"3390740c-dce9-48d6-b83a-a717417072ce"},
+		Running:      1,
+		Metrics:      map[types.ScalingMetric]int{types.ScalingCPU: 42},
+	}, err
+}
+
+func (ts testCiaoService) UpdateScalingGroup(tenantID string, req types.ScalingGroup) (types.ScalingGroup, error) {
+	return types.ScalingGroup{
+		ID:               testScalingGroupID,
+		TenantID:         testTenantID,
+		Name:             "web",
+		WorkloadID:       "ab68111c-03a6-11e6-87de-001320fb6e31",
+		MinInstances:     1,
+		MaxInstances:     4,
+		DesiredInstances: 2,
+		ScaleOut: &types.ScalingRule{
+			Metric:    types.ScalingCPU,
+			Threshold: 80,
+			Period:    300,
+			Step:      1,
+		},
+		Cooldown:   600,
+		CreateTime: time.Date(2017, time.March, 1, 10, 0, 0, 0, time.UTC),
+	}, nil
+}
+
+func (ts testCiaoService) DeleteScalingGroup(tenantID string, ID string) error {
+	return nil
+}
+
+func (ts testCiaoService) ListScalingActivities(tenantID string, ID string) ([]types.ScalingActivity, error) {
+	return []types.ScalingActivity{
+		{
+			GroupID:   testScalingGroupID,
+			Timestamp: time.Date(2017, time.March, 1, 10, 0, 0, 0, time.UTC),
+			From:      0,
+			To:        2,
+			Reason:    "scaling group created",
+		},
+	}, nil
+}
+
 func TestResponse(t *testing.T) {
 	var ts testCiaoService
 
@@ -271,6 +625,7 @@ func TestResponse(t *testing.T) {
 		}
 
 		req.Header.Set("Content-Type", tt.media)
+		req = req.WithContext(identity.WithPrivilege(req.Context(), true))
 
 		rr := httptest.NewRecorder()
 		handler := Handler{context, tt.handler}
@@ -288,6 +643,112 @@ func TestResponse(t *testing.T) {
 	}
 }
 
+func TestTenantsNotAdmin(t *testing.T) {
+	var ts testCiaoService
+
+	context := &Context{"", ts}
+
+	req, err := http.NewRequest("GET", "/tenants", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/x.ciao.v1.tenants")
+
+	rr := httptest.NewRecorder()
+	handler := Handler{context, listTenants}
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("got %v, expected %v", rr.Code, http.StatusForbidden)
+	}
+}
+
+type notAdminTest struct {
+	method  string
+	pattern string
+	handler func(*Context, http.ResponseWriter, *http.Request) (Response, error)
+}
+
+// testNotAdmin checks that the handlers refuse the requests of non-admin
+// callers on the tenant-less routes.
+func testNotAdmin(t *testing.T, media string, tests []notAdminTest) {
+	var ts testCiaoService
+
+	context := &Context{"", ts}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest(tt.method, tt.pattern, bytes.NewBuffer([]byte("{}")))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Content-Type", media)
+
+		rr := httptest.NewRecorder()
+		handler := Handler{context, tt.handler}
+
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("%s %s: got %v, expected %v", tt.method, tt.pattern, rr.Code, http.StatusForbidden)
+		}
+	}
+}
+
+func TestWorkloadsNotAdmin(t *testing.T) {
+	testNotAdmin(t, "application/x.ciao.v1.workloads", []notAdminTest{
+		{"POST", "/workloads", addWorkload},
+		{"GET", "/workloads", listWorkloads},
+		{"GET", "/workloads/ba58f471-0735-4773-9550-188e2d012941", showWorkload},
+		{"PUT", "/workloads/ba58f471-0735-4773-9550-188e2d012941", updateWorkload},
+		{"DELETE", "/workloads/ba58f471-0735-4773-9550-188e2d012941", deleteWorkload},
+	})
+}
+
+func TestSchedulesNotAdmin(t *testing.T) {
+	testNotAdmin(t, "application/x.ciao.v1.schedules", []notAdminTest{
+		{"POST", "/schedules", addSchedule},
+		{"GET", "/schedules", listSchedules},
+		{"GET", "/schedules/5e2a9c7b-1d3f-4a6e-8b0c-2f4d6e8a0b13", showSchedule},
+		{"DELETE", "/schedules/5e2a9c7b-1d3f-4a6e-8b0c-2f4d6e8a0b13", deleteSchedule},
+	})
+}
+
+func TestScalingGroupsNotAdmin(t *testing.T) {
+	testNotAdmin(t, "application/x.ciao.v1.scaling-groups", []notAdminTest{
+		{"POST", "/scaling-groups", createScalingGroup},
+		{"GET", "/scaling-groups", listScalingGroups},
+		{"GET", "/scaling-groups/a3c1e5b7-9d2f-4e6a-8c0b-1d3f5a7c9e24", showScalingGroup},
+		{"PUT", "/scaling-groups/a3c1e5b7-9d2f-4e6a-8c0b-1d3f5a7c9e24", updateScalingGroup},
+		{"DELETE", "/scaling-groups/a3c1e5b7-9d2f-4e6a-8c0b-1d3f5a7c9e24", deleteScalingGroup},
+		{"GET", "/scaling-groups/a3c1e5b7-9d2f-4e6a-8c0b-1d3f5a7c9e24/activities", listScalingActivities},
+	})
+}
+
+func TestScalingGroupOtherTenant(t *testing.T) {
+	var ts testCiaoService
+
+	r := mux.NewRouter()
+	r.Handle("/{tenant}/scaling-groups", Handler{&Context{"", ts}, createScalingGroup})
+
+	body := `{"tenant_id":"a0b2c8f4-5e21-4e4b-8d2a-3f0e6c1b9d70","name":"web","workload_id":"ab68111c-03a6-11e6-87de-001320fb6e31"}`
+	req, err := http.NewRequest("POST", "/093ae09b-f653-464e-9ae6-5ae28bd03a22/scaling-groups", bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/x.ciao.v1.scaling-groups")
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("got %v, expected %v", rr.Code, http.StatusForbidden)
+	}
+}
+
 func TestRoutes(t *testing.T) {
 	var ts testCiaoService
 	config := Config{"", ts}
@@ -0,0 +1,219 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/01org/ciao/ciao-controller/types"
+	osIdentity "github.com/01org/ciao/openstack/identity"
+	"github.com/01org/ciao/ssntp/uuid"
+	"github.com/golang/glog"
+)
+
+// requestIDHeader carries the ID of a request in its response, the ID the
+// audit record of the request is found by.
+const requestIDHeader = "X-Openstack-Request-Id"
+
+// auditedMethods are the methods of the API calls changing something.
+var auditedMethods = map[string]bool{
+	"POST":   true,
+	"PUT":    true,
+	"PATCH":  true,
+	"DELETE": true,
+}
+
+// statusRecorder remembers the status of the response written through it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+// auditHandler records the mutating API calls of a service in the audit
+// log.  It wraps the identity handler, which tells it who made the call.
+type auditHandler struct {
+	ctl     *controller
+	service string
+	next    http.Handler
+}
+
+func auditOutcome(status int) string {
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return types.AuditDenied
+	case status >= http.StatusBadRequest:
+		return types.AuditFailure
+	}
+
+	return types.AuditSuccess
+}
+
+func sourceIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+func (h auditHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !auditedMethods[r.Method] {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+
+	start := time.Now()
+
+	requestID := "req-" + uuid.Generate().String()
+	w.Header().Set(requestIDHeader, requestID)
+
+	caller := &osIdentity.Caller{}
+	recorder := &statusRecorder{ResponseWriter: w}
+
+	h.next.ServeHTTP(recorder, r.WithContext(osIdentity.WithCaller(r.Context(), caller)))
+
+	if recorder.status == 0 {
+		recorder.status = http.StatusOK
+	}
+
+	record := types.AuditRecord{
+		Timestamp: start.UTC(),
+		RequestID: requestID,
+		UserID:    caller.UserID,
+		UserName:  caller.UserName,
+		ProjectID: caller.ProjectID,
+		Roles:     caller.Roles,
+		SourceIP:  sourceIP(r),
+		Service:   h.service,
+		Method:    r.Method,
+		Resource:  r.URL.Path,
+		Status:    recorder.status,
+		Outcome:   auditOutcome(recorder.status),
+		LatencyMS: float64(time.Since(start)) / float64(time.Millisecond),
+	}
+
+	err := h.ctl.ds.AddAuditRecord(record)
+	if err != nil {
+		glog.Errorf("Unable to audit %s %s of request %s: %v", r.Method, r.URL.Path, requestID, err)
+	}
+}
+
+// auditFilter returns the filter of an audit log query.
+func auditFilter(r *http.Request) (types.AuditFilter, error) {
+	values := r.URL.Query()
+
+	filter := types.AuditFilter{
+		UserID:    values.Get("user"),
+		ProjectID: values.Get("project"),
+		Resource:  values.Get("resource"),
+		Outcome:   values.Get("outcome"),
+	}
+
+	if v := values.Get("start"); v != "" {
+		t, err := parseUsageTime(v)
+		if err != nil {
+			return filter, fmt.Errorf("invalid start time %q", v)
+		}
+		filter.Start = t
+	}
+
+	if v := values.Get("end"); v != "" {
+		t, err := parseUsageTime(v)
+		if err != nil {
+			return filter, fmt.Errorf("invalid end time %q", v)
+		}
+		filter.End = t
+	}
+
+	if v := values.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 0 {
+			return filter, fmt.Errorf("invalid limit %q", v)
+		}
+		filter.Limit = limit
+	}
+
+	switch filter.Outcome {
+	case "", types.AuditSuccess, types.AuditDenied, types.AuditFailure:
+	default:
+		return filter, fmt.Errorf("invalid outcome %q", filter.Outcome)
+	}
+
+	return filter, nil
+}
+
+// auditLogHandler queries the audit log.
+type auditLogHandler struct {
+	*controller
+}
+
+// @Title auditLog
+// @Description Returns the audit records of the mutating API calls, newest first, optionally filtered by time, user, project, resource prefix and outcome.  Requires admin privileges.
+// @Accept  json
+// @Success 200 {object} types.CiaoAuditLog "Returns the audit records."
+// @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
+// @Failure 500 {object} HTTPReturnErrorCode "The response contains the corresponding message and 50x corresponding code."
+// @Router /v2.1/audit [get]
+// @Resource /v2.1/audit
+func (h auditLogHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !osIdentity.Privileged(r.Context()) {
+		http.Error(w, "Admin privileges required", http.StatusForbidden)
+		return
+	}
+
+	filter, err := auditFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	records, err := h.ds.GetAuditRecords(filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if records == nil {
+		records = []types.AuditRecord{}
+	}
+
+	b, err := json.Marshal(types.CiaoAuditLog{Records: records})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
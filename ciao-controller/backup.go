@@ -0,0 +1,500 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/01org/ciao/ciao-controller/internal/backup"
+	datastore "github.com/01org/ciao/ciao-controller/internal/datastore"
+	"github.com/01org/ciao/ciao-controller/types"
+	imageDatastore "github.com/01org/ciao/ciao-image/datastore"
+	"github.com/01org/ciao/database"
+	osIdentity "github.com/01org/ciao/openstack/identity"
+	"github.com/golang/glog"
+)
+
+// directories of the controller state in a backup archive
+const (
+	backupControllerDir = "controller"
+	backupImageDir      = "image"
+	backupImagesDir     = "images"
+)
+
+// backupImageDatabase is the name of the image metadata database in the
+// backup archive.
+const backupImageDatabase = "ciao-image.db"
+
+var backupValidateMaxSize = flag.Int64("backup_validate_max_mb", 16384, "Maximum size in MB of the backup archives uploaded for validation and of the files they hold")
+
+// openImages opens the image files, so that they can still be read if the
+// images are deleted while the backup is written.
+func (c *controller) openImages() (map[string]*os.File, error) {
+	images := make(map[string]*os.File)
+
+	infos, err := ioutil.ReadDir(c.image.MountPoint)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	for _, i := range infos {
+		if !i.Mode().IsRegular() {
+			continue
+		}
+
+		f, err := os.Open(filepath.Join(c.image.MountPoint, i.Name()))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			closeImages(images)
+			return nil, err
+		}
+
+		images[i.Name()] = f
+	}
+
+	return images, nil
+}
+
+func closeImages(images map[string]*os.File) {
+	for _, f := range images {
+		f.Close()
+	}
+}
+
+// keepSnapshotImages closes the image files which do not belong to an
+// active image of the image metadata snapshot at imageDB, they are not
+// fully uploaded or their image was deleted.  The active images whose
+// file could not be opened are removed from the snapshot.
+func keepSnapshotImages(imageDB string, images map[string]*os.File) error {
+	metaDs := &imageDatastore.MetaDs{
+		DbProvider: database.NewBoltDBProvider(),
+		DbDir:      filepath.Dir(imageDB),
+		DbFile:     filepath.Base(imageDB),
+	}
+
+	err := metaDs.DbInit(metaDs.DbDir, metaDs.DbFile)
+	if err != nil {
+		return err
+	}
+	defer metaDs.DbClose()
+
+	all, err := metaDs.GetAll()
+	if err != nil {
+		return err
+	}
+
+	active := make(map[string]bool)
+	for _, i := range all {
+		if i.State != imageDatastore.Active {
+			continue
+		}
+
+		if images[i.ID] == nil {
+			glog.Warningf("Image %s has no file, leaving it out of the backup", i.ID)
+			err = metaDs.Delete(i.ID)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		active[i.ID] = true
+	}
+
+	for name, f := range images {
+		if !active[name] {
+			f.Close()
+			delete(images, name)
+		}
+	}
+
+	return nil
+}
+
+// snapshot writes consistent copies of the controller and image metadata
+// databases to dir and returns their names in the backup archive, mapped
+// to their path.  It also returns the opened files of the images recorded
+// as active in the image metadata snapshot, mapped to their name.
+func (c *controller) snapshot(dir string) (map[string]string, map[string]*os.File, error) {
+	images, err := c.openImages()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	files, err := c.ds.Snapshot(dir)
+	if err != nil {
+		closeImages(images)
+		return nil, nil, err
+	}
+
+	names := make(map[string]string)
+	for _, f := range files {
+		names[path.Join(backupControllerDir, filepath.Base(f))] = f
+	}
+
+	if c.imageMetaDs == nil {
+		return names, images, nil
+	}
+
+	imageDB := filepath.Join(dir, backupImageDatabase)
+
+	f, err := os.OpenFile(imageDB, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		closeImages(images)
+		return nil, nil, err
+	}
+
+	err = c.imageMetaDs.DbBackup(f)
+	f.Close()
+	if err != nil {
+		closeImages(images)
+		return nil, nil, fmt.Errorf("image database snapshot: %v", err)
+	}
+
+	err = keepSnapshotImages(imageDB, images)
+	if err != nil {
+		closeImages(images)
+		return nil, nil, fmt.Errorf("image database snapshot: %v", err)
+	}
+
+	names[path.Join(backupImageDir, backupImageDatabase)] = imageDB
+
+	return names, images, nil
+}
+
+// writeBackup writes a backup archive of the databases snapshotted in
+// files and of the images to w.
+func (c *controller) writeBackup(w io.Writer, files map[string]string, images map[string]*os.File) error {
+	bw := backup.NewWriter(w)
+
+	for name, f := range files {
+		err := bw.AddFile(name, f)
+		if err != nil {
+			return err
+		}
+	}
+
+	for name, f := range images {
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+
+		err = bw.Add(path.Join(backupImagesDir, name), info.Size(), f)
+		if err != nil {
+			return err
+		}
+	}
+
+	return bw.Close()
+}
+
+// backupHandler streams a backup archive of the controller state.  The
+// databases are snapshotted and the images they record as active are
+// opened before the response starts.  Requires admin privileges.
+type backupHandler struct {
+	*controller
+}
+
+func (h backupHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !osIdentity.Privileged(r.Context()) {
+		http.Error(w, "Admin privileges required", http.StatusForbidden)
+		return
+	}
+
+	dir, err := ioutil.TempDir("", "ciao-backup")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	files, images, err := h.snapshot(dir)
+	if err != nil {
+		glog.Errorf("Unable to snapshot the controller state: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer closeImages(images)
+
+	name := fmt.Sprintf("ciao-controller-backup-%s.tar.gz", time.Now().UTC().Format("20060102T150405Z"))
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	w.WriteHeader(http.StatusOK)
+
+	err = h.writeBackup(w, files, images)
+	if err != nil {
+		// too late to report the error, the client sees a truncated
+		// archive without its manifest.
+		glog.Errorf("Unable to write backup: %v", err)
+		return
+	}
+
+	glog.Infof("Controller state backed up to %s", name)
+}
+
+// validateBackup checks the integrity of the archive read from r and
+// compares it with the state of the running controller.  The files of the
+// archive may not hold more than maxSize bytes.
+func (c *controller) validateBackup(r io.Reader, maxSize int64) (types.CiaoBackupValidation, error) {
+	var v types.CiaoBackupValidation
+
+	dir, err := ioutil.TempDir("", "ciao-backup")
+	if err != nil {
+		return v, err
+	}
+	defer os.RemoveAll(dir)
+
+	manifest, err := backup.Extract(r, dir, maxSize)
+	if err != nil {
+		return v, err
+	}
+
+	contents, err := datastore.ReadSnapshot(filepath.Join(dir, backupControllerDir))
+	if err != nil {
+		return v, err
+	}
+
+	v.Created = manifest.Created
+	v.Files = len(manifest.Files)
+	v.SchemaVersion = contents.SchemaVersion
+	v.PendingMigrations = len(contents.PendingMigrations)
+	v.Tenants = len(contents.Tenants)
+	v.Instances = len(contents.Instances)
+	v.Warnings = []string{}
+
+	warn := func(format string, args ...interface{}) {
+		v.Warnings = append(v.Warnings, fmt.Sprintf(format, args...))
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, backupImageDir, backupImageDatabase)); err != nil {
+		warn("backup has no image database")
+	}
+
+	tenants, err := c.ds.GetAllTenants()
+	if err != nil {
+		return v, err
+	}
+
+	runningTenants := make(map[string]bool)
+	for _, t := range tenants {
+		runningTenants[t.ID] = true
+	}
+
+	backupTenants := make(map[string]bool)
+	for _, id := range contents.Tenants {
+		backupTenants[id] = true
+
+		if !runningTenants[id] {
+			warn("tenant %s is not known to the running controller", id)
+		}
+	}
+
+	for _, t := range tenants {
+		if !backupTenants[t.ID] {
+			warn("tenant %s is not in the backup", t.ID)
+		}
+	}
+
+	nodes := make(map[string]bool)
+	for _, n := range c.ds.GetNodeLastStats().Nodes {
+		nodes[n.ID] = true
+	}
+
+	instances, err := c.ds.GetAllInstances()
+	if err != nil {
+		return v, err
+	}
+
+	running := make(map[string]bool)
+	for _, i := range instances {
+		running[i.ID] = true
+	}
+
+	inBackup := make(map[string]bool)
+	for _, i := range contents.Instances {
+		inBackup[i.ID] = true
+
+		if !running[i.ID] {
+			warn("instance %s of tenant %s is not known to the running controller", i.ID, i.TenantID)
+		}
+
+		if i.NodeID != "" && !nodes[i.NodeID] {
+			warn("instance %s was last seen on node %s which is not connected", i.ID, i.NodeID)
+		}
+	}
+
+	for _, i := range instances {
+		if !inBackup[i.ID] {
+			warn("instance %s of tenant %s is not in the backup, a restore would orphan it", i.ID, i.TenantID)
+		}
+	}
+
+	return v, nil
+}
+
+// @Title backupValidate
+// @Description Verifies a backup archive and compares it with the running cluster.  Requires admin privileges.
+// @Accept  application/gzip
+// @Success 200 {object} types.CiaoBackupValidation "Returns a summary of the backup and the differences with the running cluster."
+// @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
+// @Failure 500 {object} HTTPReturnErrorCode "The response contains the corresponding message and 50x corresponding code."
+// @Router /v2.1/backup/validate [post]
+// @Resource /v2.1/backup
+func backupValidate(c *controller, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	if !osIdentity.Privileged(r.Context()) {
+		return APIResponse{http.StatusForbidden, nil}, types.ErrNotAdmin
+	}
+
+	maxSize := *backupValidateMaxSize << 20
+	body := http.MaxBytesReader(w, r.Body, maxSize)
+	defer body.Close()
+
+	v, err := c.validateBackup(body, maxSize)
+	if err != nil {
+		return APIResponse{http.StatusBadRequest, nil}, err
+	}
+
+	return APIResponse{http.StatusOK, v}, nil
+}
+
+// restoreFile moves the file at src to dest, replacing it.
+func restoreFile(src string, dest string) error {
+	err := os.MkdirAll(filepath.Dir(dest), 0755)
+	if err != nil {
+		return err
+	}
+
+	if os.Rename(src, dest) == nil {
+		return nil
+	}
+
+	// src and dest are on different file systems
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := dest + ".restore"
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	if err == nil {
+		err = out.Sync()
+	}
+	out.Close()
+
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, dest)
+}
+
+// restoreBackup replaces the controller state with the content of the
+// archive at archivePath.  The controller must be stopped, the archive
+// is verified before any file is replaced.
+func restoreBackup(archivePath string) error {
+	if _, err := os.Stat(*imageDatastoreLocation); err == nil {
+		db := database.NewBoltDBProvider()
+		err = db.DbInit(filepath.Dir(*imageDatastoreLocation), filepath.Base(*imageDatastoreLocation))
+		if err != nil {
+			return fmt.Errorf("image database is in use, stop the controller first: %v", err)
+		}
+		db.DbClose()
+	}
+
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	stagingDir := filepath.Dir(*persistentDatastoreLocation)
+	err = os.MkdirAll(stagingDir, 0755)
+	if err != nil {
+		return err
+	}
+
+	dir, err := ioutil.TempDir(stagingDir, ".ciao-restore")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	manifest, err := backup.Extract(f, dir, 0)
+	if err != nil {
+		return err
+	}
+
+	contents, err := datastore.ReadSnapshot(filepath.Join(dir, backupControllerDir))
+	if err != nil {
+		return err
+	}
+
+	destinations := map[string]string{
+		path.Join(backupControllerDir, datastore.PersistentSnapshot): *persistentDatastoreLocation,
+		path.Join(backupControllerDir, datastore.TransientSnapshot):  *transientDatastoreLocation,
+		path.Join(backupImageDir, backupImageDatabase):               *imageDatastoreLocation,
+	}
+
+	for _, file := range manifest.Files {
+		dest, ok := destinations[file.Name]
+		if !ok {
+			if path.Dir(file.Name) != backupImagesDir {
+				return fmt.Errorf("unexpected file %s in backup", file.Name)
+			}
+
+			dest = filepath.Join(*imagesPath, path.Base(file.Name))
+		}
+
+		// stale write-ahead logs would be replayed on the
+		// restored databases.
+		for _, suffix := range []string{"-wal", "-shm"} {
+			err = os.Remove(dest + suffix)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+
+		err = restoreFile(filepath.Join(dir, filepath.FromSlash(file.Name)), dest)
+		if err != nil {
+			return fmt.Errorf("restore %s: %v", file.Name, err)
+		}
+
+		glog.Infof("Restored %s to %s", file.Name, dest)
+	}
+
+	fmt.Printf("Restored %d files from the backup of %s: %d tenants, %d instances, schema version %d\n",
+		len(manifest.Files), manifest.Created.Format(time.RFC3339),
+		len(contents.Tenants), len(contents.Instances), contents.SchemaVersion)
+
+	return nil
+}
@@ -38,6 +38,8 @@ type controllerClient interface {
 	Disconnect()
 	mapExternalIP(t types.Tenant, m types.MappedIP) error
 	unMapExternalIP(t types.Tenant, m types.MappedIP) error
+	configureHealthChecks(t types.Tenant, targets []payloads.HealthCheckTarget) error
+	configureSecurityGroups(nodeID string, tenantID string, instances []payloads.InstanceSecurity) error
 	attachVolume(volID string, instanceID string, nodeID string) error
 	detachVolume(volID string, instanceID string, nodeID string) error
 	ssntpClient() *ssntp.Client
@@ -110,6 +112,14 @@ func (client *ssntpClient) instanceDeleted(payload []byte) {
 		glog.Warning("Error unmarshalling InstanceDeleted: %v")
 		return
 	}
+	if event.InstanceDeleted.Reason == payloads.Preempted {
+		i, err := client.ctl.ds.GetInstance(event.InstanceDeleted.InstanceUUID)
+		if err == nil {
+			msg := fmt.Sprintf("Instance %s preempted", i.ID)
+			client.ctl.ds.LogEvent(i.TenantID, msg)
+		}
+	}
+
 	client.deleteEphemeralStorage(event.InstanceDeleted.InstanceUUID)
 	err = client.ctl.ds.DeleteInstance(event.InstanceDeleted.InstanceUUID)
 	if err != nil {
@@ -128,7 +138,10 @@ func (client *ssntpClient) instanceAdded(payload []byte) {
 	err = client.ctl.ds.AddCNCIIP(newCNCI.ConcentratorMAC, newCNCI.ConcentratorIP)
 	if err != nil {
 		glog.Warningf("Error adding CNCI IP to datastore: %v", err)
+		return
 	}
+
+	go client.ctl.sendHealthChecks(newCNCI.TenantUUID)
 }
 
 func (client *ssntpClient) traceReport(payload []byte) {
@@ -152,6 +165,11 @@ func (client *ssntpClient) nodeConnected(payload []byte) {
 		return
 	}
 	glog.Infof("Node %s connected", nodeConnected.Connected.NodeUUID)
+
+	client.ctl.ds.PublishEvent(types.StreamEvent{
+		Type:   types.NodeConnectedEvent,
+		NodeID: nodeConnected.Connected.NodeUUID,
+	})
 }
 
 func (client *ssntpClient) nodeDisconnected(payload []byte) {
@@ -162,8 +180,77 @@ func (client *ssntpClient) nodeDisconnected(payload []byte) {
 		return
 	}
 
-	glog.Infof("Node %s disconnected", nodeDisconnected.Disconnected.NodeUUID)
-	client.ctl.ds.DeleteNode(nodeDisconnected.Disconnected.NodeUUID)
+	nodeID := nodeDisconnected.Disconnected.NodeUUID
+	glog.Infof("Node %s disconnected", nodeID)
+
+	var cncis []types.TenantCNCI
+	if nodeDisconnected.Disconnected.NodeType == payloads.NetworkNode {
+		cncis = client.ctl.ds.GetNodeCNCIs(nodeID)
+	}
+
+	instances, err := client.ctl.ds.GetAllInstancesByNode(nodeID)
+	if err != nil {
+		glog.Warningf("Unable to get instances of node %s: %v", nodeID, err)
+	}
+
+	client.ctl.ds.DeleteNode(nodeID)
+
+	client.ctl.ds.PublishEvent(types.StreamEvent{
+		Type:   types.NodeDisconnectedEvent,
+		NodeID: nodeID,
+	})
+
+	for _, cnci := range cncis {
+		go client.ctl.rescheduleCNCI(cnci.TenantID, cnci.InstanceID)
+	}
+
+	for _, i := range instances {
+		if i.State != types.InstanceRunning && i.State != types.InstancePending {
+			continue
+		}
+
+		go client.ctl.rescheduleInstance(i.ID, i.TenantID, nodeID)
+	}
+}
+
+func (client *ssntpClient) instanceRestarted(payload []byte) {
+	var event payloads.EventInstanceRestarted
+	err := yaml.Unmarshal(payload, &event)
+	if err != nil {
+		glog.Warningf("Error unmarshalling InstanceRestarted: %v", err)
+		return
+	}
+
+	i, err := client.ctl.ds.GetInstance(event.InstanceRestarted.InstanceUUID)
+	if err != nil {
+		glog.Warningf("Error getting instance from datastore: %v", err)
+		return
+	}
+
+	msg := fmt.Sprintf("Instance %s restarted by its node, restart %d", i.ID, event.InstanceRestarted.Restarts)
+	client.ctl.ds.LogEvent(i.TenantID, msg)
+
+	client.ctl.ds.PublishEvent(types.StreamEvent{
+		Type:       types.InstanceRestartedEvent,
+		TenantID:   i.TenantID,
+		InstanceID: i.ID,
+		NodeID:     i.NodeID,
+		Message:    msg,
+	})
+}
+
+func (client *ssntpClient) instanceHealth(payload []byte) {
+	var event payloads.EventInstanceHealth
+	err := yaml.Unmarshal(payload, &event)
+	if err != nil {
+		glog.Warningf("Error unmarshalling InstanceHealth: %v", err)
+		return
+	}
+
+	err = client.ctl.setInstanceHealth(event.InstanceHealth)
+	if err != nil {
+		glog.Warningf("Error updating health of instance %s: %v", event.InstanceHealth.InstanceUUID, err)
+	}
 }
 
 func (client *ssntpClient) unassignEvent(payload []byte) {
@@ -188,6 +275,13 @@ func (client *ssntpClient) unassignEvent(payload []byte) {
 
 	msg := fmt.Sprintf("Unmapped %s from %s", event.UnassignedIP.PublicIP, event.UnassignedIP.PrivateIP)
 	client.ctl.ds.LogEvent(i.TenantID, msg)
+
+	client.ctl.ds.PublishEvent(types.StreamEvent{
+		Type:       types.ExternalIPUnmappedEvent,
+		TenantID:   i.TenantID,
+		InstanceID: i.ID,
+		ExternalIP: event.UnassignedIP.PublicIP,
+	})
 }
 
 func (client *ssntpClient) assignEvent(payload []byte) {
@@ -206,6 +300,13 @@ func (client *ssntpClient) assignEvent(payload []byte) {
 
 	msg := fmt.Sprintf("Mapped %s to %s", event.AssignedIP.PublicIP, event.AssignedIP.PrivateIP)
 	client.ctl.ds.LogEvent(i.TenantID, msg)
+
+	client.ctl.ds.PublishEvent(types.StreamEvent{
+		Type:       types.ExternalIPMappedEvent,
+		TenantID:   i.TenantID,
+		InstanceID: i.ID,
+		ExternalIP: event.AssignedIP.PublicIP,
+	})
 }
 
 func (client *ssntpClient) EventNotify(event ssntp.Event, frame *ssntp.Frame) {
@@ -231,6 +332,12 @@ func (client *ssntpClient) EventNotify(event ssntp.Event, frame *ssntp.Frame) {
 	case ssntp.NodeDisconnected:
 		client.nodeDisconnected(payload)
 
+	case ssntp.InstanceRestarted:
+		client.instanceRestarted(payload)
+
+	case ssntp.InstanceHealth:
+		client.instanceHealth(payload)
+
 	case ssntp.PublicIPAssigned:
 		client.assignEvent(payload)
 
@@ -321,6 +428,14 @@ func (client *ssntpClient) assignError(payload []byte) {
 
 	msg := fmt.Sprintf("Failed to map %s to %s: %s", failure.PublicIP, failure.InstanceUUID, failure.Reason.String())
 	client.ctl.ds.LogEvent(failure.TenantUUID, msg)
+
+	client.ctl.ds.PublishEvent(types.StreamEvent{
+		Type:       types.ExternalIPFailureEvent,
+		TenantID:   failure.TenantUUID,
+		InstanceID: failure.InstanceUUID,
+		ExternalIP: failure.PublicIP,
+		Message:    msg,
+	})
 }
 
 func (client *ssntpClient) unassignError(payload []byte) {
@@ -334,6 +449,14 @@ func (client *ssntpClient) unassignError(payload []byte) {
 	// we can't unmap the IP - all we can do is log.
 	msg := fmt.Sprintf("Failed to unmap %s from %s: %s", failure.PublicIP, failure.InstanceUUID, failure.Reason.String())
 	client.ctl.ds.LogEvent(failure.TenantUUID, msg)
+
+	client.ctl.ds.PublishEvent(types.StreamEvent{
+		Type:       types.ExternalIPFailureEvent,
+		TenantID:   failure.TenantUUID,
+		InstanceID: failure.InstanceUUID,
+		ExternalIP: failure.PublicIP,
+		Message:    msg,
+	})
 }
 
 func (client *ssntpClient) ErrorNotify(err ssntp.Error, frame *ssntp.Frame) {
@@ -588,3 +711,45 @@ func (client *ssntpClient) unMapExternalIP(t types.Tenant, m types.MappedIP) err
 	_, err = client.ssntp.SendCommand(ssntp.ReleasePublicIP, y)
 	return err
 }
+
+func (client *ssntpClient) configureHealthChecks(t types.Tenant, targets []payloads.HealthCheckTarget) error {
+	payload := payloads.CommandConfigureHealthChecks{
+		HealthChecks: payloads.HealthChecksCommand{
+			ConcentratorUUID: t.CNCIID,
+			TenantUUID:       t.ID,
+			Targets:          targets,
+		},
+	}
+
+	y, err := yaml.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	glog.Infof("Request health checks of %d instances of tenant %s\n", len(targets), t.ID)
+	glog.V(1).Info(string(y))
+
+	_, err = client.ssntp.SendCommand(ssntp.ConfigureHealthChecks, y)
+	return err
+}
+
+func (client *ssntpClient) configureSecurityGroups(nodeID string, tenantID string, instances []payloads.InstanceSecurity) error {
+	payload := payloads.CommandConfigureSecurityGroups{
+		SecurityGroups: payloads.SecurityGroupsCommand{
+			WorkloadAgentUUID: nodeID,
+			TenantUUID:        tenantID,
+			Instances:         instances,
+		},
+	}
+
+	y, err := yaml.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	glog.Infof("Request security groups of %d instances of tenant %s on %s\n", len(instances), tenantID, nodeID)
+	glog.V(1).Info(string(y))
+
+	_, err = client.ssntp.SendCommand(ssntp.ConfigureSecurityGroups, y)
+	return err
+}
@@ -22,6 +22,7 @@ import (
 	"time"
 
 	"github.com/01org/ciao/ciao-controller/types"
+	"github.com/01org/ciao/payloads"
 	"github.com/01org/ciao/ssntp"
 )
 
@@ -107,6 +108,14 @@ func (client *ssntpClientWrapper) unMapExternalIP(t types.Tenant, m types.Mapped
 	return client.realClient.unMapExternalIP(t, m)
 }
 
+func (client *ssntpClientWrapper) configureHealthChecks(t types.Tenant, targets []payloads.HealthCheckTarget) error {
+	return client.realClient.configureHealthChecks(t, targets)
+}
+
+func (client *ssntpClientWrapper) configureSecurityGroups(nodeID string, tenantID string, instances []payloads.InstanceSecurity) error {
+	return client.realClient.configureSecurityGroups(nodeID, tenantID, instances)
+}
+
 func (client *ssntpClientWrapper) attachVolume(volID string, instanceID string, nodeID string) error {
 	return client.realClient.attachVolume(volID, instanceID, nodeID)
 }
@@ -22,7 +22,6 @@ import (
 	"time"
 
 	"github.com/01org/ciao/ciao-controller/types"
-	"github.com/01org/ciao/payloads"
 	"github.com/golang/glog"
 )
 
@@ -44,8 +43,9 @@ func (c *controller) restartInstance(instanceID string) error {
 		return types.ErrInstanceNotAssigned
 	}
 
-	if i.State != "exited" {
-		return errors.New("You may only restart paused instances")
+	err = c.ds.TransitionInstance(instanceID, types.InstanceRestarting)
+	if err != nil {
+		return err
 	}
 
 	go c.client.RestartInstance(instanceID, i.NodeID)
@@ -63,8 +63,9 @@ func (c *controller) stopInstance(instanceID string) error {
 		return types.ErrInstanceNotAssigned
 	}
 
-	if i.State == payloads.ComputeStatusPending {
-		return errors.New("You may not stop a pending instance")
+	err = c.ds.TransitionInstance(instanceID, types.InstanceStopping)
+	if err != nil {
+		return err
 	}
 
 	go c.client.StopInstance(instanceID, i.NodeID)
@@ -90,7 +91,17 @@ func (c *controller) deleteInstance(instanceID string) error {
 		}
 	}
 
+	err = c.ds.TransitionInstance(instanceID, types.InstanceDeleting)
+	if err != nil {
+		return err
+	}
+
 	go c.client.DeleteInstance(instanceID, i.NodeID)
+
+	if i.HealthCheck != nil {
+		go c.sendHealthChecks(i.TenantID)
+	}
+
 	return nil
 }
 
@@ -144,23 +155,86 @@ func (c *controller) startWorkload(w types.WorkloadRequest) ([]*types.Instance,
 	}
 
 	if !isCNCIWorkload(wl) {
+		if !wl.VisibleTo(w.TenantID) {
+			return nil, types.ErrWorkloadNotFound
+		}
+
 		err := c.confirmTenant(w.TenantID)
 		if err != nil {
 			return nil, err
 		}
 	}
 
+	params, err := workloadParameters(wl, w.Parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	if w.RestartPolicy != nil {
+		err = validateRestartPolicy(w.RestartPolicy)
+		if err != nil {
+			return nil, err
+		}
+
+		override := *wl
+		override.RestartPolicy = w.RestartPolicy
+		wl = &override
+	}
+
+	if w.HealthCheck != nil {
+		err = validateHealthCheck(w.HealthCheck)
+		if err != nil {
+			return nil, err
+		}
+
+		override := *wl
+		override.HealthCheck = w.HealthCheck
+		wl = &override
+	}
+
+	for _, id := range w.SecurityGroups {
+		g, err := c.ds.GetSecurityGroup(id)
+		if err != nil {
+			return nil, err
+		}
+
+		if g.TenantID != w.TenantID {
+			return nil, types.ErrSecurityGroupNotFound
+		}
+	}
+
+	// the values of the parameters may not render to YAML whatever the
+	// instance, check them before starting any.
+	_, err = renderUserData(wl, userDataVars{Count: w.Instances, Name: w.Name, Parameters: params})
+	if err != nil {
+		return nil, err
+	}
+
 	var newInstances []*types.Instance
 
 	for i := 0; i < w.Instances; i++ {
 		startTime := time.Now()
-		instance, err := newInstance(c, w.TenantID, wl, w.Volumes)
+		vars := userDataVars{
+			Index:      i,
+			Count:      w.Instances,
+			Name:       w.Name,
+			Parameters: params,
+		}
+		if w.Keypair != nil {
+			vars.KeyName = w.Keypair.Name
+			vars.PublicKey = w.Keypair.PublicKey
+		}
+		vars.SecurityGroups = w.SecurityGroups
+		instance, err := newInstance(c, w.TenantID, wl, w.Volumes, w.Priority, vars)
 		if err != nil {
 			glog.V(2).Info("error newInstance")
 			e = err
 			continue
 		}
 		instance.startTime = startTime
+		instance.Name = w.Name
+		instance.Tags = w.Tags
+		instance.Metadata = w.Metadata
 
 		ok, err := instance.Allowed()
 		if ok {
@@ -190,6 +264,10 @@ func (c *controller) startWorkload(w types.WorkloadRequest) ([]*types.Instance,
 		}
 	}
 
+	if wl.HealthCheck != nil && len(newInstances) > 0 {
+		go c.sendHealthChecks(w.TenantID)
+	}
+
 	return newInstances, e
 }
 
@@ -222,6 +300,31 @@ func (c *controller) launchCNCI(tenantID string) error {
 	return errors.New(msg)
 }
 
+// rescheduleCNCI relaunches a tenant CNCI lost with its network node,
+// unless it reports statistics again before cnciRescheduleDelay.
+func (c *controller) rescheduleCNCI(tenantID string, cnciID string) {
+	time.Sleep(*cnciRescheduleDelay)
+
+	tenant, err := c.ds.GetTenant(tenantID)
+	if err != nil || tenant == nil || tenant.CNCIID != cnciID {
+		// tenant or CNCI replaced in the meantime
+		return
+	}
+
+	if c.ds.GetTenantCNCINode(tenantID) != "" {
+		glog.Infof("CNCI %s is back, not rescheduling", cnciID)
+		return
+	}
+
+	msg := fmt.Sprintf("Rescheduling CNCI %s lost with its network node", cnciID)
+	c.ds.LogEvent(tenantID, msg)
+
+	err = c.launchCNCI(tenantID)
+	if err != nil {
+		glog.Warningf("Unable to reschedule CNCI for %s: %v", tenantID, err)
+	}
+}
+
 func (c *controller) addTenant(id string) error {
 	// create new entry in datastore
 	_, err := c.ds.AddTenant(id)
@@ -17,25 +17,38 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/01org/ciao/ciao-controller/internal/backup"
 	datastore "github.com/01org/ciao/ciao-controller/internal/datastore"
+	"github.com/01org/ciao/ciao-controller/internal/ratelimit"
 	"github.com/01org/ciao/ciao-controller/types"
 	image "github.com/01org/ciao/ciao-image/client"
+	imageDatastore "github.com/01org/ciao/ciao-image/datastore"
 	"github.com/01org/ciao/ciao-storage"
+	"github.com/01org/ciao/database"
 	"github.com/01org/ciao/openstack/block"
+	"github.com/01org/ciao/openstack/compute"
+	osIdentity "github.com/01org/ciao/openstack/identity"
 	"github.com/01org/ciao/payloads"
 	"github.com/01org/ciao/ssntp"
 	"github.com/01org/ciao/ssntp/uuid"
 	"github.com/01org/ciao/testutil"
+	"github.com/gorilla/mux"
 )
 
 func addTestTenant() (tenant *types.Tenant, err error) {
@@ -178,7 +191,7 @@ func BenchmarkNewConfig(b *testing.B) {
 	b.ResetTimer()
 	noVolumes := []storage.BlockDevice{}
 	for n := 0; n < b.N; n++ {
-		_, err := newConfig(ctl, wls[0], id.String(), tenant.ID, noVolumes)
+		_, err := newConfig(ctl, wls[0], id.String(), tenant.ID, noVolumes, "", userDataVars{})
 		if err != nil {
 			b.Error(err)
 		}
@@ -1263,7 +1276,7 @@ func TestStorageConfig(t *testing.T) {
 	id := uuid.Generate()
 
 	noVolumes := []storage.BlockDevice{}
-	_, err = newConfig(ctl, wls[0], id.String(), tenant.ID, noVolumes)
+	_, err = newConfig(ctl, wls[0], id.String(), tenant.ID, noVolumes, "", userDataVars{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -1810,6 +1823,1835 @@ func TestMapAddressNoPool(t *testing.T) {
 	}
 }
 
+func TestEventStream(t *testing.T) {
+	r := mux.NewRouter()
+	r.Handle("/v2.1/{tenant}/events/stream", eventStreamHandler{ctl}).Methods("GET")
+
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	tenantID := uuid.Generate().String()
+	url := fmt.Sprintf("%s/v2.1/%s/events/stream?type=%s", server.URL, tenantID, types.NodeConnectedEvent)
+
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("unexpected content type %s", resp.Header.Get("Content-Type"))
+	}
+
+	// neither of these may reach the stream
+	ctl.ds.PublishEvent(types.StreamEvent{
+		Type:     types.NodeConnectedEvent,
+		TenantID: uuid.Generate().String(),
+	})
+	ctl.ds.PublishEvent(types.StreamEvent{
+		Type:     types.NodeDisconnectedEvent,
+		TenantID: tenantID,
+	})
+
+	expected := types.StreamEvent{
+		Type:     types.NodeConnectedEvent,
+		TenantID: tenantID,
+		NodeID:   uuid.Generate().String(),
+	}
+	ctl.ds.PublishEvent(expected)
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+
+		var e types.StreamEvent
+		err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &e)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if e.Type != expected.Type || e.TenantID != tenantID || e.NodeID != expected.NodeID {
+			t.Fatalf("unexpected event %+v", e)
+		}
+
+		return
+	}
+
+	t.Fatalf("event stream closed: %v", scanner.Err())
+}
+
+func TestEventStreamNotAdmin(t *testing.T) {
+	req, err := http.NewRequest("GET", "/v2.1/events/stream", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	eventStreamHandler{ctl}.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("expected %d, got %d", http.StatusForbidden, rr.Code)
+	}
+}
+
+func testBackup(t *testing.T) []byte {
+	req, err := http.NewRequest("GET", "/v2.1/backup", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req = req.WithContext(osIdentity.WithPrivilege(req.Context(), true))
+
+	rr := httptest.NewRecorder()
+	backupHandler{ctl}.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	return rr.Body.Bytes()
+}
+
+func TestBackupValidate(t *testing.T) {
+	client, instances := testStartWorkload(t, 1, false, payloads.StartFailureReason(""))
+	defer client.Shutdown()
+
+	archive := testBackup(t)
+
+	v, err := ctl.validateBackup(bytes.NewReader(archive), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v.Instances == 0 || v.Tenants == 0 || v.PendingMigrations != 0 {
+		t.Fatalf("unexpected backup summary %+v", v)
+	}
+
+	for _, w := range v.Warnings {
+		if strings.Contains(w, instances[0].ID) {
+			t.Fatalf("unexpected warning for instance in backup: %s", w)
+		}
+	}
+
+	newClient, newInstances := testStartWorkload(t, 1, false, payloads.StartFailureReason(""))
+	defer newClient.Shutdown()
+
+	v, err = ctl.validateBackup(bytes.NewReader(archive), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := false
+	for _, w := range v.Warnings {
+		found = found || strings.Contains(w, newInstances[0].ID+" of tenant")
+	}
+
+	if !found {
+		t.Fatalf("instance started after the backup not reported: %v", v.Warnings)
+	}
+
+	archive[len(archive)/2] ^= 0xff
+
+	_, err = ctl.validateBackup(bytes.NewReader(archive), 0)
+	if err == nil {
+		t.Fatal("corrupted backup accepted")
+	}
+}
+
+func TestBackupNotAdmin(t *testing.T) {
+	r := mux.NewRouter()
+	r.Handle("/v2.1/backup", backupHandler{ctl}).Methods("GET")
+	r.Handle("/v2.1/backup/validate", legacyAPIHandler{ctl, backupValidate}).Methods("POST")
+
+	tests := []struct {
+		method string
+		path   string
+	}{
+		{"GET", "/v2.1/backup"},
+		{"POST", "/v2.1/backup/validate"},
+	}
+
+	for _, test := range tests {
+		req, err := http.NewRequest(test.method, test.path, bytes.NewReader(nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("%s %s: expected %d, got %d", test.method, test.path, http.StatusForbidden, rr.Code)
+		}
+	}
+}
+
+func TestBackupImages(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ciao-backup-images")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	metaDs, err := openImageMetaDs(filepath.Join(dir, "ciao-image.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer metaDs.DbClose()
+
+	ctl.imageMetaDs = metaDs
+	defer func() { ctl.imageMetaDs = nil }()
+
+	images := []struct {
+		image imageDatastore.Image
+		file  bool
+	}{
+		{imageDatastore.Image{ID: uuid.Generate().String(), State: imageDatastore.Active}, true},
+		{imageDatastore.Image{ID: uuid.Generate().String(), State: imageDatastore.Saving}, true},
+		{imageDatastore.Image{ID: uuid.Generate().String(), State: imageDatastore.Active}, false},
+	}
+
+	for _, i := range images {
+		err = metaDs.Write(i.image)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !i.file {
+			continue
+		}
+
+		file := filepath.Join(ctl.image.MountPoint, i.image.ID)
+		err = ioutil.WriteFile(file, []byte(i.image.ID), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(file)
+	}
+
+	archive := testBackup(t)
+
+	extracted := filepath.Join(dir, "extracted")
+	_, err = backup.Extract(bytes.NewReader(archive), extracted, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for n, i := range images {
+		_, err = os.Stat(filepath.Join(extracted, backupImagesDir, i.image.ID))
+		if (err == nil) != (n == 0) {
+			t.Errorf("image %d %s: unexpected image file in backup: %v", n, i.image.State, err)
+		}
+	}
+
+	snapshot := &imageDatastore.MetaDs{
+		DbProvider: database.NewBoltDBProvider(),
+	}
+	err = snapshot.DbInit(filepath.Join(extracted, backupImageDir), backupImageDatabase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snapshot.DbClose()
+
+	backedUp, err := snapshot.GetAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(backedUp) != 2 {
+		t.Fatalf("expected the images with a file in the backup, got %+v", backedUp)
+	}
+
+	for _, i := range backedUp {
+		if i.ID == images[2].image.ID {
+			t.Errorf("image without file left in the backup")
+		}
+	}
+}
+
+func TestBackupRestore(t *testing.T) {
+	archive := testBackup(t)
+
+	dir, err := ioutil.TempDir("", "ciao-restore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	archivePath := filepath.Join(dir, "backup.tar.gz")
+	err = ioutil.WriteFile(archivePath, archive, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flags := []*string{persistentDatastoreLocation, transientDatastoreLocation, imageDatastoreLocation, imagesPath}
+	saved := make([]string, len(flags))
+	for i, f := range flags {
+		saved[i] = *f
+	}
+	defer func() {
+		for i, f := range flags {
+			*f = saved[i]
+		}
+	}()
+
+	*persistentDatastoreLocation = filepath.Join(dir, "controller", "ciao-controller.db")
+	*transientDatastoreLocation = filepath.Join(dir, "ciao-controller-stats.db")
+	*imageDatastoreLocation = filepath.Join(dir, "image", "ciao-image.db")
+	*imagesPath = filepath.Join(dir, "images")
+
+	err = os.MkdirAll(filepath.Dir(*persistentDatastoreLocation), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ioutil.WriteFile(*persistentDatastoreLocation+"-wal", []byte("stale"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = restoreBackup(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(*persistentDatastoreLocation + "-wal"); err == nil {
+		t.Error("stale write-ahead log not removed")
+	}
+
+	contents, err := datastore.ReadSnapshot(filepath.Dir(*persistentDatastoreLocation))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	instances, err := ctl.ds.GetAllInstances()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(contents.Instances) != len(instances) {
+		t.Fatalf("restored %d instances, expected %d", len(contents.Instances), len(instances))
+	}
+
+	images, err := ioutil.ReadDir(ctl.image.MountPoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, i := range images {
+		if _, err := os.Stat(filepath.Join(*imagesPath, i.Name())); err != nil {
+			t.Errorf("image %s not restored: %v", i.Name(), err)
+		}
+	}
+
+	leftovers, _ := filepath.Glob(filepath.Join(dir, "controller", ".ciao-restore*"))
+	if len(leftovers) != 0 {
+		t.Errorf("restore left %v behind", leftovers)
+	}
+}
+
+func hasLogEvent(t *testing.T, msg string) bool {
+	log, err := ctl.ds.GetEventLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range log {
+		if e.Message == msg {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestReconcile(t *testing.T) {
+	var reason payloads.StartFailureReason
+
+	client, instances := testStartWorkload(t, 1, false, reason)
+	defer client.Shutdown()
+
+	r, err := newReconciler(reconcileReport, reconcileLost, reconcileDelete)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nodeID := uuid.Generate().String()
+	orphanID := uuid.Generate().String()
+	instance := instances[0]
+
+	stat := payloads.Stat{
+		NodeUUID: nodeID,
+		Load:     -1,
+		Instances: []payloads.InstanceStat{
+			{
+				InstanceUUID: instance.ID,
+				State:        payloads.ComputeStatusRunning,
+			},
+		},
+	}
+	err = ctl.ds.HandleStats(stat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ctl.ds.DeleteNode(nodeID)
+
+	// the launcher restarted, lost the instance and kept an unknown one
+	stat.Instances = []payloads.InstanceStat{
+		{
+			InstanceUUID: orphanID,
+			State:        payloads.ComputeStatusRunning,
+		},
+	}
+	err = ctl.ds.HandleStats(stat)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	volumeID := createTestVolume(instance.TenantID, 20, t)
+	a, err := ctl.ds.CreateStorageAttachment(uuid.Generate().String(), payloads.StorageResource{ID: volumeID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing happens until a drift has been seen twice
+	ctl.reconcile(r)
+
+	if instance.State == types.InstanceLost {
+		t.Fatal("instance marked lost on first reconciliation")
+	}
+
+	ctl.reconcile(r)
+
+	if instance.State != types.InstanceLost {
+		t.Fatalf("expected instance to be lost, got %s", instance.State)
+	}
+
+	for _, link := range ctl.ds.GetAllStorageAttachments() {
+		if link.ID == a.ID {
+			t.Fatal("ghost attachment not deleted")
+		}
+	}
+
+	msg := fmt.Sprintf("Instance %s running on node %s is unknown to the controller", orphanID, nodeID)
+	if !hasLogEvent(t, msg) {
+		t.Fatal("orphan instance not reported")
+	}
+
+	_, err = newReconciler(reconcileLost, reconcileLost, reconcileLost)
+	if err == nil {
+		t.Fatal("invalid policy accepted")
+	}
+}
+
+func TestUsageExport(t *testing.T) {
+	var reason payloads.StartFailureReason
+
+	client, instances := testStartWorkload(t, 1, false, reason)
+	defer client.Shutdown()
+
+	instance := instances[0]
+
+	stat := payloads.Stat{
+		NodeUUID: uuid.Generate().String(),
+		Load:     -1,
+		Instances: []payloads.InstanceStat{
+			{
+				InstanceUUID: instance.ID,
+				State:        payloads.ComputeStatusRunning,
+			},
+		},
+	}
+	defer ctl.ds.DeleteNode(stat.NodeUUID)
+
+	// the first statistics start metering the instance
+	for i := 0; i < 2; i++ {
+		err := ctl.ds.HandleStats(stat)
+		if err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	r := mux.NewRouter()
+	r.Handle("/v2.1/usage", usageExportHandler{ctl}).Methods("GET")
+
+	url := fmt.Sprintf("/v2.1/usage?tenant=%s&start=%s", instance.TenantID, time.Now().Add(-time.Hour).Format(time.RFC3339))
+
+	get := func(url string, privileged bool) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = req.WithContext(osIdentity.WithPrivilege(req.Context(), privileged))
+
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	rr := get(url, false)
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("expected %d, got %d", http.StatusForbidden, rr.Code)
+	}
+
+	rr = get(url, true)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	var usages types.CiaoInstanceUsages
+	err := json.Unmarshal(rr.Body.Bytes(), &usages)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(usages.Usages) == 0 || usages.Usages[0].InstanceID != instance.ID || usages.Usages[0].Hours <= 0 {
+		t.Fatalf("unexpected usage records %+v", usages.Usages)
+	}
+
+	rr = get(url+"&format=csv", true)
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "text/csv" {
+		t.Fatalf("unexpected csv export %d %s", rr.Code, rr.Header().Get("Content-Type"))
+	}
+
+	lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+	if len(lines) != len(usages.Usages)+1 || !strings.HasPrefix(lines[1], instance.ID+","+instance.TenantID) {
+		t.Fatalf("unexpected csv export %q", rr.Body.String())
+	}
+
+	rr = get("/v2.1/usage?start=tomorrow", true)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+
+	usage, err := ctl.ShowTenantUsage(instance.TenantID, time.Now().Add(-time.Hour), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(usage.ServerUsages) != 1 || usage.ServerUsages[0].InstanceID != instance.ID ||
+		usage.ServerUsages[0].EndedAt != nil || usage.TotalHours <= 0 {
+		t.Fatalf("unexpected tenant usage %+v", usage)
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	userID := uuid.Generate().String()
+	projectID := uuid.Generate().String()
+
+	// stands for the identity handler and the API handler
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		caller := osIdentity.CallerFromContext(r.Context())
+		if caller == nil {
+			if r.Method != "GET" {
+				t.Errorf("no caller in the %s request context", r.Method)
+			}
+			return
+		}
+
+		caller.UserID = userID
+		caller.ProjectID = projectID
+		caller.Roles = []string{"member"}
+
+		if r.Method == "DELETE" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	h := auditHandler{ctl, "compute", next}
+	resource := "/v2.1/" + projectID + "/servers"
+
+	for _, method := range []string{"GET", "POST", "DELETE"} {
+		req, err := http.NewRequest(method, resource, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.RemoteAddr = "192.168.0.10:43210"
+
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		id := rr.Header().Get(requestIDHeader)
+		if (method == "GET") != (id == "") {
+			t.Errorf("unexpected request ID %q for %s", id, method)
+		}
+	}
+
+	r := mux.NewRouter()
+	r.Handle("/v2.1/audit", auditLogHandler{ctl}).Methods("GET")
+
+	get := func(url string, privileged bool) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = req.WithContext(osIdentity.WithPrivilege(req.Context(), privileged))
+
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	rr := get("/v2.1/audit?project="+projectID, false)
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("expected %d, got %d", http.StatusForbidden, rr.Code)
+	}
+
+	rr = get("/v2.1/audit?outcome=bogus", true)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+
+	query := func(url string) []types.AuditRecord {
+		rr := get(url, true)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+
+		var log types.CiaoAuditLog
+		err := json.Unmarshal(rr.Body.Bytes(), &log)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return log.Records
+	}
+
+	records := query("/v2.1/audit?project=" + projectID)
+	if len(records) != 2 {
+		t.Fatalf("expected 2 audit records, got %d", len(records))
+	}
+
+	denied := records[0]
+	if denied.Method != "DELETE" || denied.Status != http.StatusForbidden || denied.Outcome != types.AuditDenied {
+		t.Errorf("unexpected denied record %+v", denied)
+	}
+
+	created := records[1]
+	if created.Method != "POST" || created.Outcome != types.AuditSuccess || created.UserID != userID ||
+		created.SourceIP != "192.168.0.10" || created.Service != "compute" || created.Resource != resource ||
+		len(created.Roles) != 1 || created.Roles[0] != "member" {
+		t.Errorf("unexpected created record %+v", created)
+	}
+
+	records = query("/v2.1/audit?outcome=denied&user=" + userID)
+	if len(records) != 1 || records[0].RequestID != denied.RequestID {
+		t.Errorf("expected the denied record, got %+v", records)
+	}
+
+	records = query("/v2.1/audit?limit=1&resource=" + resource)
+	if len(records) != 1 {
+		t.Errorf("expected 1 audit record, got %d", len(records))
+	}
+}
+
+func TestRateLimits(t *testing.T) {
+	var reason payloads.StartFailureReason
+
+	client, instances := testStartWorkload(t, 1, false, reason)
+	defer client.Shutdown()
+
+	tenant := instances[0].TenantID
+
+	config := ratelimit.Config{
+		Limits: ratelimit.Limits{
+			Classes: map[string]ratelimit.Limit{
+				ratelimit.Delete: {Rate: 0.1, Burst: 1},
+			},
+		},
+		Tenants: map[string]ratelimit.Limits{
+			tenant: {MaxStarting: 1},
+		},
+	}
+
+	limiter, err := ratelimit.New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the instance has not reported running yet
+	if ctl.startingInstances(tenant) != 1 {
+		t.Fatalf("expected 1 instance starting, got %d", ctl.startingInstances(tenant))
+	}
+
+	saved := ctl.limiter
+	ctl.limiter = limiter
+	defer func() { ctl.limiter = saved }()
+
+	r := mux.NewRouter()
+	route := r.Handle("/v2.1/{tenant}/servers", nil).Methods("POST", "DELETE")
+	route.Handler(rateLimitHandler{ctl, routeOperations(route), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	})})
+	r.Handle("/v2.1/ratelimits", rateLimitsHandler{ctl}).Methods("GET")
+
+	call := func(method string, url string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = req.WithContext(osIdentity.WithPrivilege(req.Context(), true))
+
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	url := "/v2.1/" + tenant + "/servers"
+
+	// the tenant has one instance starting already
+	rr := call("POST", url)
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "5" {
+		t.Fatalf("expected %d with Retry-After, got %d", http.StatusTooManyRequests, rr.Code)
+	}
+
+	rr = call("DELETE", url)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("expected %d, got %d", http.StatusAccepted, rr.Code)
+	}
+
+	rr = call("DELETE", url)
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "10" {
+		t.Fatalf("expected %d with Retry-After 10, got %d %q", http.StatusTooManyRequests, rr.Code, rr.Header().Get("Retry-After"))
+	}
+
+	rr = call("GET", "/v2.1/ratelimits")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	var limits types.CiaoRateLimits
+	err = json.Unmarshal(rr.Body.Bytes(), &limits)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counted := 0
+	for _, c := range limits.Counters {
+		if c.TenantID != tenant {
+			continue
+		}
+
+		switch {
+		case c.Class == ratelimit.Start && c.Allowed == 0 && c.Limited == 1:
+		case c.Class == ratelimit.Delete && c.Allowed == 1 && c.Limited == 1:
+		case c.Class == ratelimit.Create && c.Allowed == 1 && c.Limited == 0:
+		default:
+			t.Errorf("unexpected counter %+v", c)
+		}
+		counted++
+	}
+
+	if counted != 3 {
+		t.Errorf("expected 3 counters, got %d: %+v", counted, limits.Counters)
+	}
+}
+
+func TestRateLimitsReserveStarts(t *testing.T) {
+	var reason payloads.StartFailureReason
+
+	client, instances := testStartWorkload(t, 1, false, reason)
+	defer client.Shutdown()
+
+	tenant := instances[0].TenantID
+
+	limiter, err := ratelimit.New(ratelimit.Config{
+		Tenants: map[string]ratelimit.Limits{
+			tenant: {MaxStarting: 3},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved := ctl.limiter
+	ctl.limiter = limiter
+	defer func() { ctl.limiter = saved }()
+
+	entered := make(chan struct{})
+	release := make(chan struct{})
+
+	r := mux.NewRouter()
+	route := r.Handle("/v2.1/{tenant}/servers", nil).Methods("POST")
+	route.Handler(rateLimitHandler{ctl, routeOperations(route), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var server compute.CreateServerRequest
+		if err := json.NewDecoder(r.Body).Decode(&server); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if server.Server.MaxInstances == 2 {
+			close(entered)
+			<-release
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	})})
+
+	call := func(count int) int {
+		body := fmt.Sprintf(`{"server": {"max_count": %d}}`, count)
+		req, err := http.NewRequest("POST", "/v2.1/"+tenant+"/servers", strings.NewReader(body))
+		if err != nil {
+			t.Error(err)
+			return 0
+		}
+		req = req.WithContext(osIdentity.WithPrivilege(req.Context(), true))
+
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+
+		return rr.Code
+	}
+
+	// one instance is starting already
+	if code := call(3); code != http.StatusTooManyRequests {
+		t.Fatalf("expected %d, got %d", http.StatusTooManyRequests, code)
+	}
+
+	done := make(chan int)
+	go func() { done <- call(2) }()
+	<-entered
+
+	// the two instances being created are reserved
+	if code := call(1); code != http.StatusTooManyRequests {
+		t.Errorf("expected %d, got %d", http.StatusTooManyRequests, code)
+	}
+
+	close(release)
+	if code := <-done; code != http.StatusAccepted {
+		t.Fatalf("expected %d, got %d", http.StatusAccepted, code)
+	}
+
+	// the reservation is released once the creation returns
+	if code := call(1); code != http.StatusAccepted {
+		t.Fatalf("expected %d, got %d", http.StatusAccepted, code)
+	}
+}
+
+func TestServerTags(t *testing.T) {
+	var reason payloads.StartFailureReason
+
+	client, instances := testStartWorkload(t, 2, false, reason)
+	defer client.Shutdown()
+
+	sendStatsCmd(client, t)
+
+	tenant := instances[0].TenantID
+
+	var req compute.UpdateServerRequest
+	req.Server.Name = "doomed-server"
+
+	s, err := ctl.UpdateServer(tenant, instances[0].ID, req)
+	if err != nil || s.Server.Name != req.Server.Name {
+		t.Fatalf("server not renamed: %v", err)
+	}
+
+	err = ctl.SetServerTags(tenant, instances[0].ID, []string{"doomed", "web"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ctl.SetServerMetadata(tenant, instances[0].ID, map[string]string{"role": "web"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ctl.SetServerTags(tenant, instances[1].ID, []string{"web"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ctl.SetServerTags("other-tenant", instances[1].ID, nil)
+	if err != compute.ErrServerOwner {
+		t.Fatalf("expected %v, got %v", compute.ErrServerOwner, err)
+	}
+
+	s, err = ctl.ShowServerDetails(tenant, instances[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Server.Name != "doomed-server" || len(s.Server.Tags) != 2 || s.Server.Metadata["role"] != "web" {
+		t.Fatalf("server details not updated: %+v", s.Server)
+	}
+
+	r := mux.NewRouter()
+	r.Handle("/v2.1/{tenant}/servers/action", legacyAPIHandler{ctl, tenantServersAction}).Methods("POST")
+
+	b, err := json.Marshal(types.CiaoServersAction{
+		Action: "os-delete",
+		Tags:   []string{"doomed", "web"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serverCh := server.AddCmdChan(ssntp.DELETE)
+
+	httpReq, err := http.NewRequest("POST", "/v2.1/"+tenant+"/servers/action", bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpReq = httpReq.WithContext(osIdentity.WithPrivilege(httpReq.Context(), true))
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httpReq)
+
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("expected %d, got %d", http.StatusAccepted, rr.Code)
+	}
+
+	result, err := server.GetCmdChanResult(serverCh, ssntp.DELETE)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.InstanceUUID != instances[0].ID {
+		t.Fatalf("deleted %s, expected %s", result.InstanceUUID, instances[0].ID)
+	}
+
+	i, err := ctl.ds.GetInstance(instances[1].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if i.State == types.InstanceDeleting {
+		t.Fatal("server without the tags deleted")
+	}
+}
+
+func TestTemplatedWorkload(t *testing.T) {
+	tenant, err := addTestTenant()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wls, err := ctl.ds.GetWorkloads()
+	if err != nil || len(wls) == 0 {
+		t.Fatal(err)
+	}
+
+	wl := *wls[0]
+	wl.ID = uuid.Generate().String()
+	wl.Config = templatedConfig
+	wl.Parameters = templatedWorkload().Parameters
+
+	err = ctl.ds.AddWorkload(wl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ctl.ds.DeleteWorkload(wl.ID)
+
+	w := types.WorkloadRequest{
+		WorkloadID: wl.ID,
+		TenantID:   tenant.ID,
+		Instances:  2,
+		Parameters: map[string]string{"greeting": "hi"},
+	}
+	_, err = ctl.startWorkload(w)
+	if _, ok := err.(*types.ParameterError); !ok {
+		t.Fatalf("missing parameter accepted: %v", err)
+	}
+
+	stored, err := ctl.ds.GetWorkload(wl.ID)
+	if err != nil || len(stored.Parameters) != 2 {
+		t.Fatalf("workload parameters not stored: %v", err)
+	}
+
+	id := uuid.Generate().String()
+	vars := userDataVars{
+		Index:      1,
+		Count:      2,
+		Parameters: map[string]string{"prefix": "web", "greeting": "hi"},
+	}
+
+	config, err := newConfig(ctl, stored, id, tenant.ID, []storage.BlockDevice{}, "", vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(config.config, "web-1") ||
+		!strings.Contains(config.config, "hi from "+id+" of "+tenant.ID+" at "+config.ip) {
+		t.Fatalf("config not rendered:\n%s", config.config)
+	}
+}
+
+func TestInstanceRestartedEvent(t *testing.T) {
+	var reason payloads.StartFailureReason
+
+	client, instances := testStartWorkload(t, 1, false, reason)
+	defer client.Shutdown()
+
+	sendStatsCmd(client, t)
+
+	controllerCh := wrappedClient.addEventChan(ssntp.InstanceRestarted)
+	go client.SendRestartedEvent(instances[0].ID, 2)
+	err := wrappedClient.getEventChan(controllerCh, ssntp.InstanceRestarted)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := fmt.Sprintf("Instance %s restarted by its node, restart 2", instances[0].ID)
+	if !hasLogEvent(t, msg) {
+		t.Fatal("instance restart not logged")
+	}
+}
+
+func TestInstanceHealth(t *testing.T) {
+	var reason payloads.StartFailureReason
+
+	client, instances := testStartWorkload(t, 1, false, reason)
+	defer client.Shutdown()
+
+	sendStatsCmd(client, t)
+
+	timeout := *scheduleRestartTimeout
+	*scheduleRestartTimeout = 0
+	defer func() { *scheduleRestartTimeout = timeout }()
+
+	i, err := ctl.ds.GetInstance(instances[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i.HealthCheck = &payloads.HealthCheck{
+		Protocol: payloads.HealthCheckTCP,
+		Port:     22,
+		Restart:  true,
+	}
+	defer func() { i.HealthCheck = nil }()
+
+	targets, err := ctl.healthCheckTargets(i.TenantID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != 1 || targets[0].InstanceUUID != i.ID || targets[0].PrivateIP != i.IPAddress {
+		t.Fatalf("unexpected health check targets %+v", targets)
+	}
+
+	// an instance which was never healthy is not restarted
+	err = ctl.setInstanceHealth(payloads.InstanceHealthEvent{
+		InstanceUUID: i.ID,
+		Health:       payloads.Unhealthy,
+		Reason:       "connection refused",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if i.Health != payloads.Unhealthy || i.HealthReason != "connection refused" {
+		t.Fatalf("instance is %s: %s", i.Health, i.HealthReason)
+	}
+	if i.State != types.InstanceRunning {
+		t.Fatalf("instance which was never healthy restarted, state %s", i.State)
+	}
+
+	msg := fmt.Sprintf("Instance %s is unhealthy: connection refused", i.ID)
+	if !hasLogEvent(t, msg) {
+		t.Fatal("instance health not logged")
+	}
+
+	err = ctl.setInstanceHealth(payloads.InstanceHealthEvent{
+		InstanceUUID: i.ID,
+		Health:       payloads.Healthy,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serverCh := server.AddCmdChan(ssntp.STOP)
+	err = ctl.setInstanceHealth(payloads.InstanceHealthEvent{
+		InstanceUUID: i.ID,
+		Health:       payloads.Unhealthy,
+		Reason:       "timeout",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := server.GetCmdChanResult(serverCh, ssntp.STOP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.InstanceUUID != i.ID {
+		t.Fatalf("stopped %s, expected %s", result.InstanceUUID, i.ID)
+	}
+
+	msg = fmt.Sprintf("Restarting unhealthy instance %s", i.ID)
+	if !hasLogEvent(t, msg) {
+		t.Fatal("instance restart not logged")
+	}
+}
+
+func TestKeypairs(t *testing.T) {
+	user := uuid.Generate().String()
+
+	generated, err := ctl.CreateKeypair("", user, compute.KeypairRequest{Name: "generated"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if generated.PrivateKey == "" || generated.Fingerprint == "" || generated.UserID != user {
+		t.Fatalf("unexpected generated keypair %+v", generated)
+	}
+
+	imported, err := ctl.CreateKeypair("", user, compute.KeypairRequest{Name: "imported", PublicKey: testPublicKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imported.PrivateKey != "" || imported.PublicKey != testPublicKey {
+		t.Fatalf("unexpected imported keypair %+v", imported)
+	}
+
+	_, err = ctl.CreateKeypair("", user, compute.KeypairRequest{Name: "imported", PublicKey: testPublicKey})
+	if err != compute.ErrKeypairExists {
+		t.Fatalf("expected %v, got %v", compute.ErrKeypairExists, err)
+	}
+
+	invalid := []compute.KeypairRequest{
+		{Name: ""},
+		{Name: "bad/name"},
+		{Name: "x509", Type: "x509"},
+		{Name: "badkey", PublicKey: "ssh-rsa not-a-key"},
+	}
+	for _, req := range invalid {
+		_, err = ctl.CreateKeypair("", user, req)
+		if err != compute.ErrInvalidKeypair {
+			t.Errorf("%+v: expected %v, got %v", req, compute.ErrInvalidKeypair, err)
+		}
+	}
+
+	keypairs, err := ctl.ListKeypairs("", user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keypairs) != 2 || keypairs[0].Name != "generated" || keypairs[1].Name != "imported" {
+		t.Fatalf("unexpected keypairs %+v", keypairs)
+	}
+	if keypairs[0].PrivateKey != "" {
+		t.Fatal("private key stored")
+	}
+
+	keypairs, err = ctl.ListKeypairs("", uuid.Generate().String())
+	if err != nil || len(keypairs) != 0 {
+		t.Fatalf("keypairs of another user listed: %+v, %v", keypairs, err)
+	}
+
+	tenant, err := addTestTenant()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := testutil.NewSsntpTestClientConnection("Keypairs", ssntp.AGENT, testutil.AgentUUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Shutdown()
+
+	wls, err := ctl.ds.GetWorkloads()
+	if err != nil || len(wls) == 0 {
+		t.Fatal(err)
+	}
+
+	clientCmdCh := client.AddCmdChan(ssntp.START)
+
+	keypair, err := ctl.ds.GetKeypair(user, "imported")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := types.WorkloadRequest{
+		WorkloadID: wls[0].ID,
+		TenantID:   tenant.ID,
+		Instances:  1,
+		Keypair:    &keypair,
+	}
+	instances, err := ctl.startWorkload(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.GetCmdChanResult(clientCmdCh, ssntp.START)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	i, err := ctl.ds.GetInstance(instances[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i.KeyName != "imported" || i.PublicKey != testPublicKey {
+		t.Fatalf("keypair not recorded for the instance, got %s: %s", i.KeyName, i.PublicKey)
+	}
+
+	server, err := instanceToServer(ctl, i)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.KeyName != "imported" {
+		t.Fatalf("expected key name imported, got %s", server.KeyName)
+	}
+
+	keys := metadataKeys(i, "")
+	if len(keys) != 1 || keys[0].Name != "imported" || keys[0].Data != testPublicKey {
+		t.Fatalf("unexpected metadata keys %+v", keys)
+	}
+
+	vars := userDataVars{KeyName: "imported", PublicKey: testPublicKey}
+	config, err := newConfig(ctl, wls[0], uuid.Generate().String(), tenant.ID, []storage.BlockDevice{}, "", vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = ctl.ds.ReleaseTenantIP(tenant.ID, config.ip)
+
+	metaData := config.config[strings.LastIndex(config.config, "---\n")+4:]
+	metaData = strings.TrimSuffix(metaData, "\n...\n")
+
+	var md MetaData
+	err = json.Unmarshal([]byte(metaData), &md)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.PublicKeys["imported"] != testPublicKey || len(md.Keys) != 1 || md.Keys[0].Data != testPublicKey {
+		t.Fatalf("keypair not injected in the metadata: %s", metaData)
+	}
+
+	for _, name := range []string{"generated", "imported"} {
+		err = ctl.DeleteKeypair("", user, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err = ctl.ShowKeypair("", user, "imported")
+	if err != compute.ErrKeypairNotFound {
+		t.Fatalf("expected %v, got %v", compute.ErrKeypairNotFound, err)
+	}
+
+	err = ctl.DeleteKeypair("", user, "imported")
+	if err != compute.ErrKeypairNotFound {
+		t.Fatalf("expected %v, got %v", compute.ErrKeypairNotFound, err)
+	}
+}
+
+func TestSecurityGroups(t *testing.T) {
+	var reason payloads.StartFailureReason
+
+	client, instances := testStartWorkload(t, 1, false, reason)
+	defer client.Shutdown()
+
+	sendStatsCmd(client, t)
+
+	tenant := instances[0].TenantID
+
+	web, err := ctl.CreateSecurityGroup(tenant, compute.SecurityGroupRequest{Name: "web", Description: "web servers"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(web.Rules) != 1 || web.Rules[0].Direction != "egress" || web.Rules[0].IPRange.CIDR != "0.0.0.0/0" {
+		t.Fatalf("expected a new group allowing all egress traffic, got %+v", web)
+	}
+
+	_, err = ctl.CreateSecurityGroup(tenant, compute.SecurityGroupRequest{Name: "web"})
+	if err != compute.ErrSecurityGroupExists {
+		t.Fatalf("expected %v, got %v", compute.ErrSecurityGroupExists, err)
+	}
+
+	_, err = ctl.CreateSecurityGroup(tenant, compute.SecurityGroupRequest{})
+	if err != compute.ErrInvalidSecurityGroup {
+		t.Fatalf("expected %v, got %v", compute.ErrInvalidSecurityGroup, err)
+	}
+
+	_, err = ctl.ShowSecurityGroup(uuid.Generate().String(), web.ID)
+	if err != compute.ErrSecurityGroupNotFound {
+		t.Fatalf("expected %v, got %v", compute.ErrSecurityGroupNotFound, err)
+	}
+
+	db, err := ctl.CreateSecurityGroup(tenant, compute.SecurityGroupRequest{Name: "db"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rule, err := ctl.CreateSecurityGroupRule(tenant, compute.SecurityGroupRuleRequest{
+		ParentGroupID: db.ID,
+		IPProtocol:    "tcp",
+		FromPort:      5432,
+		ToPort:        5432,
+		GroupID:       web.ID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rule.Direction != "ingress" || rule.Group.Name != "web" || rule.IPRange.CIDR != "" {
+		t.Fatalf("unexpected rule %+v", rule)
+	}
+
+	_, err = ctl.CreateSecurityGroupRule(tenant, compute.SecurityGroupRuleRequest{ParentGroupID: db.ID, IPProtocol: "tcp"})
+	if err != compute.ErrInvalidSecurityGroup {
+		t.Fatalf("expected %v, got %v", compute.ErrInvalidSecurityGroup, err)
+	}
+
+	clientCh := client.AddCmdChan(ssntp.ConfigureSecurityGroups)
+
+	err = ctl.AddServerSecurityGroup(tenant, instances[0].ID, "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := client.GetCmdChanResult(clientCh, ssntp.ConfigureSecurityGroups)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.TenantUUID != tenant || result.NodeUUID != testutil.AgentUUID {
+		t.Fatalf("security groups sent for tenant %s to %s", result.TenantUUID, result.NodeUUID)
+	}
+
+	err = ctl.AddServerSecurityGroup(tenant, instances[0].ID, "web")
+	if err != compute.ErrInvalidSecurityGroup {
+		t.Fatalf("expected %v, got %v", compute.ErrInvalidSecurityGroup, err)
+	}
+
+	groups, err := ctl.ListServerSecurityGroups(tenant, instances[0].ID)
+	if err != nil || len(groups) != 1 || groups[0].ID != web.ID {
+		t.Fatalf("unexpected server security groups %+v, %v", groups, err)
+	}
+
+	server, err := ctl.ShowServerDetails(tenant, instances[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(server.Server.SecurityGroups) != 1 || server.Server.SecurityGroups[0].Name != "web" {
+		t.Fatalf("unexpected server security groups %+v", server.Server.SecurityGroups)
+	}
+
+	err = ctl.DeleteSecurityGroup(tenant, web.ID)
+	if err != compute.ErrSecurityGroupInUse {
+		t.Fatalf("expected %v, got %v", compute.ErrSecurityGroupInUse, err)
+	}
+
+	wl, err := ctl.ds.GetWorkload(instances[0].WorkloadID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vars := userDataVars{SecurityGroups: []string{db.ID}}
+	config, err := newConfig(ctl, wl, uuid.Generate().String(), tenant, []storage.BlockDevice{}, "", vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = ctl.ds.ReleaseTenantIP(tenant, config.ip)
+
+	sec := config.sc.Start.Security
+	if sec == nil || !sec.Enforced {
+		t.Fatalf("security groups not enforced on the new instance: %+v", sec)
+	}
+
+	expected := payloads.SecurityGroupRule{
+		Direction:  payloads.Ingress,
+		Protocol:   "tcp",
+		PortMin:    5432,
+		PortMax:    5432,
+		RemoteCIDR: instances[0].IPAddress + "/32",
+	}
+	if sec.Rules[len(sec.Rules)-1] != expected {
+		t.Fatalf("expected rule %+v, got %+v", expected, sec.Rules)
+	}
+
+	clientCh = client.AddCmdChan(ssntp.ConfigureSecurityGroups)
+
+	err = ctl.RemoveServerSecurityGroup(tenant, instances[0].ID, "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.GetCmdChanResult(clientCh, ssntp.ConfigureSecurityGroups)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ctl.DeleteSecurityGroup(tenant, web.ID)
+	if err != compute.ErrSecurityGroupInUse {
+		t.Fatalf("expected %v, got %v", compute.ErrSecurityGroupInUse, err)
+	}
+
+	err = ctl.DeleteSecurityGroupRule(tenant, rule.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, g := range []string{web.ID, db.ID} {
+		err = ctl.DeleteSecurityGroup(tenant, g)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	groups, err = ctl.ListSecurityGroups(tenant)
+	if err != nil || len(groups) != 0 {
+		t.Fatalf("security groups left %+v, %v", groups, err)
+	}
+}
+
+func TestRescheduleInstance(t *testing.T) {
+	tenant, err := addTestTenant()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := testutil.NewSsntpTestClientConnection("RescheduleInstance", ssntp.AGENT, testutil.AgentUUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Shutdown()
+
+	wls, err := ctl.ds.GetWorkloads()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wl types.Workload
+	for _, w := range wls {
+		if w.VMType == payloads.QEMU {
+			wl = *w
+			break
+		}
+	}
+	if wl.ID == "" {
+		t.Fatal("No VM workload")
+	}
+
+	wl.ID = uuid.Generate().String()
+	wl.ImageID = ""
+	wl.RestartPolicy = &payloads.RestartPolicy{Condition: payloads.RestartNever}
+
+	err = ctl.ds.AddWorkload(wl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ctl.ds.DeleteWorkload(wl.ID)
+
+	w := types.WorkloadRequest{
+		WorkloadID:    wl.ID,
+		TenantID:      tenant.ID,
+		Instances:     1,
+		RestartPolicy: &payloads.RestartPolicy{Condition: "sometimes"},
+	}
+	_, err = ctl.startWorkload(w)
+	if err != types.ErrBadRequest {
+		t.Fatalf("invalid restart policy accepted: %v", err)
+	}
+
+	w.RestartPolicy = &payloads.RestartPolicy{Condition: payloads.RestartAlways}
+	clientCmdCh := client.AddCmdChan(ssntp.START)
+	instances, err := ctl.startWorkload(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.GetCmdChanResult(clientCmdCh, ssntp.START)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	instance := instances[0]
+	config, err := ctl.ds.GetInstanceConfig(instance.ID)
+	if err != nil || !strings.Contains(config, "condition: always") {
+		t.Fatalf("start config of instance not stored: %v\n%s", err, config)
+	}
+
+	nodeID := uuid.Generate().String()
+	stat := payloads.Stat{
+		NodeUUID: nodeID,
+		Load:     -1,
+		Instances: []payloads.InstanceStat{
+			{
+				InstanceUUID: instance.ID,
+				State:        payloads.ComputeStatusRunning,
+			},
+		},
+	}
+	err = ctl.ds.HandleStats(stat)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	delay := *instanceRescheduleDelay
+	*instanceRescheduleDelay = 0
+	defer func() { *instanceRescheduleDelay = delay }()
+
+	// the node is still there
+	ctl.rescheduleInstance(instance.ID, tenant.ID, nodeID)
+	if instance.State != types.InstanceRunning {
+		t.Fatalf("instance of a connected node rescheduled, state %s", instance.State)
+	}
+
+	ctl.ds.DeleteNode(nodeID)
+
+	clientCmdCh = client.AddCmdChan(ssntp.START)
+	ctl.rescheduleInstance(instance.ID, tenant.ID, nodeID)
+	result, err := client.GetCmdChanResult(clientCmdCh, ssntp.START)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.InstanceUUID != instance.ID {
+		t.Fatalf("expected instance %s to be started, got %s", instance.ID, result.InstanceUUID)
+	}
+
+	if instance.State != types.InstancePending || instance.NodeID != "" {
+		t.Fatalf("rescheduled instance is %s on node %q", instance.State, instance.NodeID)
+	}
+
+	msg := fmt.Sprintf("Rescheduling instance %s lost with node %s", instance.ID, nodeID)
+	if !hasLogEvent(t, msg) {
+		t.Fatal("instance rescheduling not logged")
+	}
+}
+
+func TestInstanceSchedules(t *testing.T) {
+	var reason payloads.StartFailureReason
+
+	client, instances := testStartWorkload(t, 1, false, reason)
+	defer client.Shutdown()
+
+	sendStatsCmd(client, t)
+
+	tenant := instances[0].TenantID
+
+	err := ctl.SetServerTags(tenant, instances[0].ID, []string{"nightly"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	invalid := []types.ScheduleRequest{
+		{Tag: "nightly", Action: "pause", Cron: "0 19 * * *"},
+		{Tag: "nightly", Action: types.ScheduleStop},
+		{Tag: "nightly", Action: types.ScheduleStop, Cron: "0 19 * * *", After: "8h"},
+		{Tag: "nightly", InstanceID: instances[0].ID, Action: types.ScheduleStop, Cron: "0 19 * * *"},
+		{Tag: "nightly", Action: types.ScheduleStop, Cron: "0 25 * * *"},
+		{Tag: "nightly", Action: types.ScheduleStop, After: "-8h"},
+	}
+	for _, req := range invalid {
+		_, err = ctl.CreateSchedule(tenant, req)
+		if err != types.ErrBadRequest {
+			t.Fatalf("invalid schedule %+v accepted: %v", req, err)
+		}
+	}
+
+	_, err = ctl.CreateSchedule("other-tenant", types.ScheduleRequest{
+		InstanceID: instances[0].ID,
+		Action:     types.ScheduleStop,
+		After:      "8h",
+	})
+	if err != types.ErrInstanceNotFound {
+		t.Fatalf("expected %v, got %v", types.ErrInstanceNotFound, err)
+	}
+
+	stop, err := ctl.CreateSchedule(tenant, types.ScheduleRequest{
+		Tag:    "nightly",
+		Action: types.ScheduleStop,
+		Cron:   "0 19 * * *",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ctl.DeleteSchedule("", stop.ID)
+
+	// the expiry is due after the next run of the daily stop, whatever
+	// the time of day
+	expiry, err := ctl.CreateSchedule("", types.ScheduleRequest{
+		InstanceID: instances[0].ID,
+		Action:     types.ScheduleDelete,
+		After:      "48h",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expiry.TenantID != tenant || expiry.NextRun.Sub(expiry.CreateTime) != 48*time.Hour {
+		t.Fatalf("unexpected expiry schedule %+v", expiry)
+	}
+
+	_, err = ctl.ShowSchedule("other-tenant", stop.ID)
+	if err != types.ErrScheduleNotFound {
+		t.Fatalf("expected %v, got %v", types.ErrScheduleNotFound, err)
+	}
+
+	schedules, err := ctl.ListSchedules(tenant)
+	if err != nil || len(schedules) != 2 {
+		t.Fatalf("expected 2 schedules, got %d: %v", len(schedules), err)
+	}
+
+	// nothing is due yet
+	ctl.runSchedules(stop.NextRun.Add(-time.Minute))
+
+	serverCh := server.AddCmdChan(ssntp.STOP)
+	ctl.runSchedules(stop.NextRun)
+
+	result, err := server.GetCmdChanResult(serverCh, ssntp.STOP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.InstanceUUID != instances[0].ID {
+		t.Fatalf("stopped %s, expected %s", result.InstanceUUID, instances[0].ID)
+	}
+
+	s, err := ctl.ShowSchedule(tenant, stop.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.LastRun.Equal(stop.NextRun) || !s.NextRun.Equal(stop.NextRun.AddDate(0, 0, 1)) {
+		t.Fatalf("schedule not moved to its next run: %+v", s)
+	}
+
+	serverCh = server.AddCmdChan(ssntp.DELETE)
+	ctl.runSchedules(expiry.NextRun)
+
+	result, err = server.GetCmdChanResult(serverCh, ssntp.DELETE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.InstanceUUID != instances[0].ID {
+		t.Fatalf("deleted %s, expected %s", result.InstanceUUID, instances[0].ID)
+	}
+
+	_, err = ctl.ShowSchedule(tenant, expiry.ID)
+	if err != types.ErrScheduleNotFound {
+		t.Fatalf("expired schedule not removed: %v", err)
+	}
+
+	msg := fmt.Sprintf("Schedule %s: %s instance %s", stop.ID, types.ScheduleStop, instances[0].ID)
+	if !hasLogEvent(t, msg) {
+		t.Fatal("scheduled action not logged")
+	}
+}
+
+func TestScalingDecision(t *testing.T) {
+	s := newScaler()
+	start := time.Date(2017, time.March, 1, 10, 0, 0, 0, time.UTC)
+
+	g := types.ScalingGroup{
+		ID:               "group",
+		MinInstances:     1,
+		MaxInstances:     3,
+		DesiredInstances: 2,
+		ScaleOut:         &types.ScalingRule{Metric: types.ScalingCPU, Threshold: 80, Period: 60, Step: 2},
+		ScaleIn:          &types.ScalingRule{Metric: types.ScalingCPU, Threshold: 20, Period: 60, Step: 1},
+		Cooldown:         300,
+	}
+
+	for i := 0; i <= 6; i++ {
+		sample := scalingSample{
+			time:    start.Add(time.Duration(i) * 10 * time.Second),
+			metrics: map[types.ScalingMetric]int{types.ScalingCPU: 90},
+		}
+		s.record(g.ID, sample, time.Minute)
+
+		desired, reason := scalingDecision(s, g, sample.time)
+		if i < 6 && (desired != 2 || reason != "") {
+			t.Fatalf("scaled before the period was covered: %d %q", desired, reason)
+		}
+		if i == 6 && (desired != 3 || reason != "cpu 90% above 80% over 60s") {
+			t.Fatalf("expected to scale out to the maximum, got %d %q", desired, reason)
+		}
+	}
+
+	g.LastScale = start.Add(time.Minute)
+	desired, _ := scalingDecision(s, g, start.Add(time.Minute))
+	if desired != 2 {
+		t.Fatalf("scaled during cooldown to %d", desired)
+	}
+
+	now := start.Add(10 * time.Minute)
+	s.record(g.ID, scalingSample{time: now.Add(-time.Minute), metrics: map[types.ScalingMetric]int{types.ScalingCPU: 10}}, time.Minute)
+	s.record(g.ID, scalingSample{time: now, metrics: map[types.ScalingMetric]int{types.ScalingCPU: 10}}, time.Minute)
+	if len(s.samples[g.ID]) != 2 {
+		t.Fatalf("old samples kept: %d", len(s.samples[g.ID]))
+	}
+
+	desired, reason := scalingDecision(s, g, now)
+	if desired != 1 || reason != "cpu 10% below 20% over 60s" {
+		t.Fatalf("expected to scale in, got %d %q", desired, reason)
+	}
+
+	s.forget(nil)
+	if len(s.samples) != 0 {
+		t.Fatal("samples of deleted group kept")
+	}
+}
+
+func TestScalingGroupTagsReserved(t *testing.T) {
+	var reason payloads.StartFailureReason
+
+	client, instances := testStartWorkload(t, 1, false, reason)
+	defer client.Shutdown()
+
+	tenant := instances[0].TenantID
+	server := instances[0].ID
+	groupTag := scalingGroupTag(uuid.Generate().String())
+
+	err := ctl.SetServerTags(tenant, server, []string{"web", groupTag})
+	if err != compute.ErrInvalidTag {
+		t.Fatalf("expected %v, got %v", compute.ErrInvalidTag, err)
+	}
+
+	var req compute.CreateServerRequest
+	req.Server.Flavor = instances[0].WorkloadID
+	req.Server.Tags = []string{groupTag}
+	_, err = ctl.CreateServer(tenant, req)
+	if err != compute.ErrInvalidTag {
+		t.Fatalf("expected %v, got %v", compute.ErrInvalidTag, err)
+	}
+
+	err = ctl.ds.SetInstanceTags(server, []string{groupTag})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ctl.SetServerTags(tenant, server, []string{"web"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	i, err := ctl.ds.GetInstance(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(i.Tags) != 2 || !hasTags(i, []string{groupTag, "web"}) {
+		t.Fatalf("scaling group tag not kept: %v", i.Tags)
+	}
+
+	err = ctl.SetServerTags(tenant, server, []string{groupTag, "db"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	i, err = ctl.ds.GetInstance(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(i.Tags) != 2 || !hasTags(i, []string{groupTag, "db"}) {
+		t.Fatalf("unexpected tags %v", i.Tags)
+	}
+}
+
+func TestScalingGroups(t *testing.T) {
+	var reason payloads.StartFailureReason
+
+	client, instances := testStartWorkload(t, 1, false, reason)
+	defer client.Shutdown()
+
+	sendStatsCmd(client, t)
+
+	tenant := instances[0].TenantID
+	workload := instances[0].WorkloadID
+
+	invalid := []types.ScalingGroup{
+		{WorkloadID: workload, MinInstances: 2, MaxInstances: 1, DesiredInstances: 1},
+		{WorkloadID: workload, MinInstances: 0, MaxInstances: 2, DesiredInstances: 3},
+		{WorkloadID: workload, MaxInstances: 2, ScaleOut: &types.ScalingRule{Metric: "disk", Threshold: 80, Period: 60, Step: 1}},
+		{WorkloadID: workload, MaxInstances: 2, ScaleOut: &types.ScalingRule{Metric: types.ScalingCPU, Threshold: 180, Period: 60, Step: 1}},
+		{WorkloadID: workload, MaxInstances: 2,
+			ScaleOut: &types.ScalingRule{Metric: types.ScalingCPU, Threshold: 50, Period: 60, Step: 1},
+			ScaleIn:  &types.ScalingRule{Metric: types.ScalingCPU, Threshold: 60, Period: 60, Step: 1}},
+	}
+	for _, g := range invalid {
+		_, err := ctl.CreateScalingGroup(tenant, g)
+		if err != types.ErrBadRequest {
+			t.Fatalf("invalid scaling group %+v accepted: %v", g, err)
+		}
+	}
+
+	// adopt the running instance rather than starting one
+	g := types.ScalingGroup{
+		ID:               uuid.Generate().String(),
+		TenantID:         tenant,
+		Name:             "web",
+		WorkloadID:       workload,
+		MinInstances:     0,
+		MaxInstances:     2,
+		DesiredInstances: 1,
+		ScaleIn:          &types.ScalingRule{Metric: types.ScalingCPU, Threshold: 10, Period: 60, Step: 1},
+		CreateTime:       time.Now().UTC(),
+	}
+
+	err := ctl.ds.UpdateScalingGroup(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ctl.DeleteScalingGroup("", g.ID)
+
+	err = ctl.ds.SetInstanceTags(instances[0].ID, []string{scalingGroupTag(g.ID)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ctl.ShowScalingGroup("other-tenant", g.ID)
+	if err != types.ErrScalingGroupNotFound {
+		t.Fatalf("expected %v, got %v", types.ErrScalingGroupNotFound, err)
+	}
+
+	status, err := ctl.ShowScalingGroup(tenant, g.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Instances) != 1 || status.Instances[0] != instances[0].ID || status.Running != 1 {
+		t.Fatalf("unexpected scaling group status %+v", status)
+	}
+
+	s := newScaler()
+	now := time.Now().UTC()
+
+	// the samples do not cover the period yet
+	ctl.scale(s, now)
+
+	activities, err := ctl.ListScalingActivities(tenant, g.ID)
+	if err != nil || len(activities) != 0 {
+		t.Fatalf("unexpected scaling activities %+v: %v", activities, err)
+	}
+
+	serverCh := server.AddCmdChan(ssntp.DELETE)
+	ctl.scale(s, now.Add(time.Minute))
+
+	result, err := server.GetCmdChanResult(serverCh, ssntp.DELETE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.InstanceUUID != instances[0].ID {
+		t.Fatalf("deleted %s, expected %s", result.InstanceUUID, instances[0].ID)
+	}
+
+	groups, err := ctl.ListScalingGroups(tenant)
+	if err != nil || len(groups) != 1 || groups[0].DesiredInstances != 0 {
+		t.Fatalf("scaling group not scaled in: %+v: %v", groups, err)
+	}
+
+	activities, err = ctl.ListScalingActivities(tenant, g.ID)
+	if err != nil || len(activities) != 1 || activities[0].From != 1 || activities[0].To != 0 {
+		t.Fatalf("unexpected scaling activities %+v: %v", activities, err)
+	}
+
+	msg := fmt.Sprintf("Scaling group %s scaled from 1 to 0 instances: %s", g.ID, activities[0].Reason)
+	if !hasLogEvent(t, msg) {
+		t.Fatal("scaling not logged")
+	}
+
+	err = ctl.DeleteScalingGroup(tenant, g.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ctl.ShowScalingGroup(tenant, g.ID)
+	if err != types.ErrScalingGroupNotFound {
+		t.Fatalf("scaling group not deleted: %v", err)
+	}
+}
+
 var testClients []*testutil.SsntpTestClient
 var ctl *controller
 var server *testutil.SsntpTestServer
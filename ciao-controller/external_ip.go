@@ -211,6 +211,20 @@ func (c *controller) ListMappedAddresses(tenant *string) []types.MappedIP {
 func (c *controller) MapAddress(poolName *string, instanceID string) error {
 	var m types.MappedIP
 
+	i, err := c.ds.GetInstance(instanceID)
+	if err != nil {
+		return err
+	}
+
+	over, err := c.ds.OverQuota(i.TenantID, types.ExternalIPsQuota, 1)
+	if err != nil {
+		return err
+	}
+
+	if over {
+		return types.ErrQuota
+	}
+
 	pools, err := c.ds.GetPools()
 	if err != nil {
 		return err
@@ -0,0 +1,224 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/01org/ciao/ciao-controller/types"
+	"github.com/01org/ciao/payloads"
+	"github.com/golang/glog"
+)
+
+var healthCheckSyncInterval = flag.Duration("health_check_sync_interval", 5*time.Minute, "How often the health checks of the instances are sent again to the CNCIs, 0 only sends them when they change")
+
+// health check defaults, in seconds and probes
+const (
+	healthCheckInterval           = 10
+	healthCheckTimeout            = 5
+	healthCheckHealthyThreshold   = 2
+	healthCheckUnhealthyThreshold = 3
+)
+
+// validateHealthCheck checks a health check given by a user and fills its
+// unset fields with the defaults, a nil check is valid.
+func validateHealthCheck(check *payloads.HealthCheck) error {
+	if check == nil {
+		return nil
+	}
+
+	switch check.Protocol {
+	case payloads.HealthCheckTCP:
+		if check.Path != "" {
+			return types.ErrBadRequest
+		}
+	case payloads.HealthCheckHTTP:
+		if check.Path == "" {
+			check.Path = "/"
+		}
+	default:
+		return types.ErrBadRequest
+	}
+
+	if check.Port <= 0 || check.Port > 65535 {
+		return types.ErrBadRequest
+	}
+
+	if check.Interval < 0 || check.Timeout < 0 || check.HealthyThreshold < 0 || check.UnhealthyThreshold < 0 {
+		return types.ErrBadRequest
+	}
+
+	if check.Interval == 0 {
+		check.Interval = healthCheckInterval
+	}
+
+	if check.Timeout == 0 {
+		check.Timeout = healthCheckTimeout
+		if check.Timeout > check.Interval {
+			check.Timeout = check.Interval
+		}
+	}
+
+	if check.HealthyThreshold == 0 {
+		check.HealthyThreshold = healthCheckHealthyThreshold
+	}
+
+	if check.UnhealthyThreshold == 0 {
+		check.UnhealthyThreshold = healthCheckUnhealthyThreshold
+	}
+
+	if check.Timeout > check.Interval {
+		return types.ErrBadRequest
+	}
+
+	return nil
+}
+
+// healthCheckTargets returns the instances of a tenant whose health is
+// checked by its CNCI.
+func (c *controller) healthCheckTargets(tenantID string) ([]payloads.HealthCheckTarget, error) {
+	instances, err := c.ds.GetAllInstancesFromTenant(tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []payloads.HealthCheckTarget
+	for _, i := range instances {
+		if i.HealthCheck == nil || i.IPAddress == "" || i.State == types.InstanceDeleting {
+			continue
+		}
+
+		targets = append(targets, payloads.HealthCheckTarget{
+			InstanceUUID: i.ID,
+			PrivateIP:    i.IPAddress,
+			Check:        *i.HealthCheck,
+		})
+	}
+
+	return targets, nil
+}
+
+// updateHealthChecks sends all the health checks of a tenant to its CNCI,
+// which stops checking the instances which are not listed.  Nothing is
+// sent until the CNCI is active, it gets the checks when it registers.
+func (c *controller) updateHealthChecks(tenantID string) error {
+	t, err := c.ds.GetTenant(tenantID)
+	if err != nil {
+		return err
+	}
+
+	if t == nil || t.CNCIID == "" || t.CNCIIP == "" {
+		return nil
+	}
+
+	targets, err := c.healthCheckTargets(tenantID)
+	if err != nil {
+		return err
+	}
+
+	return c.client.configureHealthChecks(*t, targets)
+}
+
+func (c *controller) sendHealthChecks(tenantID string) {
+	err := c.updateHealthChecks(tenantID)
+	if err != nil {
+		glog.Warningf("Unable to send health checks of tenant %s: %v", tenantID, err)
+	}
+}
+
+// syncHealthChecks sends the health checks again to the CNCIs of the
+// tenants which have some, in case a CNCI restarted and lost them.
+func (c *controller) syncHealthChecks() {
+	tenants, err := c.ds.GetAllTenants()
+	if err != nil {
+		glog.Warningf("Unable to get tenants: %v", err)
+		return
+	}
+
+	for _, t := range tenants {
+		if t.CNCIID == "" || t.CNCIIP == "" {
+			continue
+		}
+
+		targets, err := c.healthCheckTargets(t.ID)
+		if err != nil || len(targets) == 0 {
+			continue
+		}
+
+		err = c.client.configureHealthChecks(*t, targets)
+		if err != nil {
+			glog.Warningf("Unable to send health checks of tenant %s: %v", t.ID, err)
+		}
+	}
+}
+
+func (c *controller) startHealthCheckSync() error {
+	if *healthCheckSyncInterval <= 0 {
+		glog.Info("Health checks only sent when they change")
+		return nil
+	}
+
+	glog.Infof("Sending health checks every %v", *healthCheckSyncInterval)
+
+	ticker := time.NewTicker(*healthCheckSyncInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		c.syncHealthChecks()
+	}
+
+	return nil
+}
+
+// setInstanceHealth records the health of an instance reported by a CNCI.
+// An instance whose check asks for it is restarted when it becomes
+// unhealthy after having been healthy, an instance which never got
+// healthy may still be booting.
+func (c *controller) setInstanceHealth(event payloads.InstanceHealthEvent) error {
+	i, err := c.ds.GetInstance(event.InstanceUUID)
+	if err != nil {
+		return err
+	}
+
+	previous, err := c.ds.SetInstanceHealth(i.ID, event.Health, event.Reason)
+	if err != nil || previous == event.Health {
+		return err
+	}
+
+	msg := fmt.Sprintf("Instance %s is %s", i.ID, event.Health)
+	if event.Reason != "" {
+		msg = fmt.Sprintf("%s: %s", msg, event.Reason)
+	}
+	c.ds.LogEvent(i.TenantID, msg)
+
+	c.ds.PublishEvent(types.StreamEvent{
+		Type:       types.InstanceHealthEvent,
+		TenantID:   i.TenantID,
+		InstanceID: i.ID,
+		NodeID:     i.NodeID,
+		Message:    msg,
+	})
+
+	if event.Health != payloads.Unhealthy || previous != payloads.Healthy ||
+		i.HealthCheck == nil || !i.HealthCheck.Restart {
+		return nil
+	}
+
+	c.ds.LogEvent(i.TenantID, fmt.Sprintf("Restarting unhealthy instance %s", i.ID))
+
+	return c.runScheduleAction(types.ScheduleRestart, i)
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/01org/ciao/payloads"
+)
+
+func TestValidateHealthCheck(t *testing.T) {
+	tests := []struct {
+		name  string
+		check *payloads.HealthCheck
+		valid bool
+	}{
+		{"none", nil, true},
+		{"tcp", &payloads.HealthCheck{Protocol: payloads.HealthCheckTCP, Port: 22}, true},
+		{"http", &payloads.HealthCheck{Protocol: payloads.HealthCheckHTTP, Port: 80, Path: "/healthz"}, true},
+		{"no protocol", &payloads.HealthCheck{Port: 22}, false},
+		{"unknown protocol", &payloads.HealthCheck{Protocol: "udp", Port: 53}, false},
+		{"tcp path", &payloads.HealthCheck{Protocol: payloads.HealthCheckTCP, Port: 22, Path: "/"}, false},
+		{"no port", &payloads.HealthCheck{Protocol: payloads.HealthCheckTCP}, false},
+		{"invalid port", &payloads.HealthCheck{Protocol: payloads.HealthCheckTCP, Port: 65536}, false},
+		{"negative interval", &payloads.HealthCheck{Protocol: payloads.HealthCheckTCP, Port: 22, Interval: -1}, false},
+		{"timeout above interval", &payloads.HealthCheck{Protocol: payloads.HealthCheckTCP, Port: 22, Interval: 5, Timeout: 10}, false},
+	}
+
+	for _, test := range tests {
+		err := validateHealthCheck(test.check)
+		if test.valid && err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		} else if !test.valid && err == nil {
+			t.Errorf("%s: invalid check accepted", test.name)
+		}
+	}
+}
+
+func TestHealthCheckDefaults(t *testing.T) {
+	check := payloads.HealthCheck{Protocol: payloads.HealthCheckHTTP, Port: 80, Interval: 2}
+
+	err := validateHealthCheck(&check)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := payloads.HealthCheck{
+		Protocol:           payloads.HealthCheckHTTP,
+		Port:               80,
+		Path:               "/",
+		Interval:           2,
+		Timeout:            2,
+		HealthyThreshold:   healthCheckHealthyThreshold,
+		UnhealthyThreshold: healthCheckUnhealthyThreshold,
+	}
+	if check != expected {
+		t.Fatalf("expected %+v, got %+v", expected, check)
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"strings"
 	"time"
 
 	"github.com/01org/ciao/ciao-controller/types"
@@ -37,6 +38,10 @@ type config struct {
 	cnci   bool
 	mac    string
 	ip     string
+
+	// rendered tells if the cloud-config of the workload was rendered
+	// for the instance.
+	rendered bool
 }
 
 type instance struct {
@@ -57,11 +62,11 @@ func isCNCIWorkload(workload *types.Workload) bool {
 }
 
 func newInstance(ctl *controller, tenantID string, workload *types.Workload,
-	volumes []storage.BlockDevice) (*instance, error) {
+	volumes []storage.BlockDevice, priority payloads.Priority, vars userDataVars) (*instance, error) {
 
 	id := uuid.Generate()
 
-	config, err := newConfig(ctl, workload, id.String(), tenantID, volumes)
+	config, err := newConfig(ctl, workload, id.String(), tenantID, volumes, priority, vars)
 	if err != nil {
 		return nil, err
 	}
@@ -80,6 +85,17 @@ func newInstance(ctl *controller, tenantID string, workload *types.Workload,
 		CreateTime: time.Now(),
 	}
 
+	if !config.cnci {
+		newInstance.KeyName = vars.KeyName
+		newInstance.PublicKey = vars.PublicKey
+		newInstance.SecurityGroups = vars.SecurityGroups
+	}
+
+	if workload.HealthCheck != nil && !config.cnci {
+		check := *workload.HealthCheck
+		newInstance.HealthCheck = &check
+	}
+
 	i := &instance{
 		ctl:       ctl,
 		newConfig: config,
@@ -112,6 +128,12 @@ func (i *instance) Add() error {
 		}
 	}
 
+	// the config is sent again if the node of the instance is lost and
+	// the metadata service serves the cloud-config rendered in it
+	if !i.CNCI && (reschedulable(i.newConfig.sc.Start) || i.newConfig.rendered) {
+		return ds.SetInstanceConfig(i.ID, i.newConfig.config)
+	}
+
 	return nil
 }
 
@@ -258,12 +280,26 @@ func controllerStorageResourceFromPayload(volume payloads.StorageResource) (s ty
 	return
 }
 
+// shareWeight returns the fair-share weight of a tenant, set through
+// the share_weight limit.  Tenants without one get a weight of 1.
+func shareWeight(tenant *types.Tenant) int {
+	for _, res := range tenant.Resources {
+		if res.Rname == types.ShareWeightQuota && res.Limit > 0 {
+			return res.Limit
+		}
+	}
+
+	return 1
+}
+
 func newConfig(ctl *controller, wl *types.Workload, instanceID string, tenantID string,
-	volumes []storage.BlockDevice) (config, error) {
+	volumes []storage.BlockDevice, priority payloads.Priority, vars userDataVars) (config, error) {
 
 	type UserData struct {
-		UUID     string `json:"uuid"`
-		Hostname string `json:"hostname"`
+		UUID       string            `json:"uuid"`
+		Hostname   string            `json:"hostname"`
+		PublicKeys map[string]string `json:"public_keys,omitempty"`
+		Keys       []MetaDataKey     `json:"keys,omitempty"`
 	}
 
 	var userData UserData
@@ -283,6 +319,7 @@ func newConfig(ctl *controller, wl *types.Workload, instanceID string, tenantID
 
 	var networking payloads.NetworkResources
 	var storage []payloads.StorageResource
+	var security *payloads.InstanceSecurity
 
 	// do we ever need to save the vnic uuid?
 	networking.VnicUUID = uuid.Generate().String()
@@ -311,10 +348,36 @@ func newConfig(ctl *controller, wl *types.Workload, instanceID string, tenantID
 		// for now let's keep going
 		networking.ConcentratorIP = tenant.CNCIIP
 
+		// render the config of the workload for this instance
+		vars.InstanceID = instanceID
+		vars.TenantID = tenantID
+		vars.IPAddress = config.ip
+		baseConfig, err = renderUserData(wl, vars)
+		if err != nil {
+			_ = ctl.ds.ReleaseTenantIP(tenantID, config.ip)
+			return config, err
+		}
+		config.rendered = len(wl.Parameters) > 0
+
+		// the launcher filters the traffic of the instance as soon
+		// as it starts if it is in security groups
+		security, err = ctl.newInstanceSecurity(tenantID, instanceID, config.ip, vars.SecurityGroups)
+		if err != nil {
+			_ = ctl.ds.ReleaseTenantIP(tenantID, config.ip)
+			return config, err
+		}
+
 		// set the hostname and uuid for userdata
 		userData.UUID = instanceID
 		userData.Hostname = instanceID
 
+		// inject the keypair of the instance, cloud-init authorizes
+		// the public keys of the metadata for the default user
+		if vars.PublicKey != "" {
+			userData.PublicKeys = map[string]string{vars.KeyName: vars.PublicKey}
+			userData.Keys = []MetaDataKey{{Name: vars.KeyName, Type: "ssh", Data: vars.PublicKey}}
+		}
+
 		// handle storage resources for just this instance
 		for _, volume := range volumes {
 			instanceStorage := payloads.StorageResource{
@@ -382,12 +445,29 @@ func newConfig(ctl *controller, wl *types.Workload, instanceID string, tenantID
 		RequestedResources:  defaults,
 		Networking:          networking,
 		Storage:             storage,
+		Security:            security,
 	}
 
 	if wl.VMType == payloads.Docker {
 		startCmd.DockerImage = wl.ImageName
 	}
 
+	// tenants cannot reach their instances without a CNCI
+	if config.cnci {
+		startCmd.Priority = payloads.HighPriority
+	} else {
+		startCmd.Priority = priority
+	}
+
+	if tenant != nil {
+		startCmd.TenantWeight = shareWeight(tenant)
+	}
+
+	if wl.RestartPolicy != nil {
+		policy := *wl.RestartPolicy
+		startCmd.RestartPolicy = &policy
+	}
+
 	cmd := payloads.Start{
 		Start: startCmd,
 	}
@@ -409,6 +489,37 @@ func newConfig(ctl *controller, wl *types.Workload, instanceID string, tenantID
 	return config, err
 }
 
+// splitInstanceConfig splits the start config of an instance into its
+// start payload and the cloud-config of its workload, as rendered for it.
+func splitInstanceConfig(config string) (payloads.Start, string, error) {
+	var start payloads.Start
+
+	// the payload is the first document, the cloud-config is followed
+	// by the metadata, the last document
+	lines := strings.Split(config, "\n")
+	end := -1
+	last := -1
+	for n, line := range lines {
+		if line == "..." && end < 0 {
+			end = n
+		}
+		if line == "---" {
+			last = n
+		}
+	}
+
+	if end < 1 || last < end {
+		return start, "", errors.New("Invalid instance config")
+	}
+
+	err := yaml.Unmarshal([]byte(strings.Join(lines[1:end], "\n")), &start)
+	if err != nil {
+		return start, "", err
+	}
+
+	return start, strings.Join(lines[end+1:last], "\n") + "\n", nil
+}
+
 func newTenantHardwareAddr(ip net.IP) net.HardwareAddr {
 	buf := make([]byte, 6)
 	ipBytes := ip.To4()
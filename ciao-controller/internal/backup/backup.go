@@ -0,0 +1,291 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package backup reads and writes the archives holding a backup of the
+// controller state.  An archive is a gzipped tar file whose last entry,
+// manifest.json, lists the other files with their size and SHA-256
+// checksum.
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ManifestName is the name of the manifest in an archive.
+const ManifestName = "manifest.json"
+
+// FormatVersion is the version of the archive format written by this
+// package.
+const FormatVersion = 1
+
+// File describes a file stored in an archive.
+type File struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Manifest describes the content of an archive.
+type Manifest struct {
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+	Files   []File    `json:"files"`
+}
+
+// Writer writes an archive.  The manifest is written by Close, an
+// archive which was not closed is not valid.
+type Writer struct {
+	gz       *gzip.Writer
+	tw       *tar.Writer
+	manifest Manifest
+}
+
+// NewWriter returns a Writer writing an archive to w.
+func NewWriter(w io.Writer) *Writer {
+	gz := gzip.NewWriter(w)
+
+	return &Writer{
+		gz: gz,
+		tw: tar.NewWriter(gz),
+		manifest: Manifest{
+			Version: FormatVersion,
+			Created: time.Now().UTC(),
+		},
+	}
+}
+
+// Add stores size bytes read from r in the archive as name.
+func (w *Writer) Add(name string, size int64, r io.Reader) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+
+	hdr := &tar.Header{
+		Name:     name,
+		Mode:     0600,
+		Size:     size,
+		ModTime:  time.Now(),
+		Typeflag: tar.TypeReg,
+	}
+
+	err := w.tw.WriteHeader(hdr)
+	if err != nil {
+		return errors.Wrapf(err, "add %s", name)
+	}
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(w.tw, h), io.LimitReader(r, size))
+	if err != nil {
+		return errors.Wrapf(err, "add %s", name)
+	}
+
+	if n != size {
+		return fmt.Errorf("add %s: read %d bytes, expected %d", name, n, size)
+	}
+
+	w.manifest.Files = append(w.manifest.Files, File{
+		Name:   name,
+		Size:   size,
+		SHA256: hex.EncodeToString(h.Sum(nil)),
+	})
+
+	return nil
+}
+
+// AddFile stores the file at path in the archive as name.
+func (w *Writer) AddFile(name string, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	return w.Add(name, info.Size(), f)
+}
+
+// Close writes the manifest and flushes the archive.  It does not close
+// the underlying writer.
+func (w *Writer) Close() error {
+	b, err := json.MarshalIndent(w.manifest, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	hdr := &tar.Header{
+		Name:     ManifestName,
+		Mode:     0600,
+		Size:     int64(len(b)),
+		ModTime:  time.Now(),
+		Typeflag: tar.TypeReg,
+	}
+
+	err = w.tw.WriteHeader(hdr)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.tw.Write(b)
+	if err != nil {
+		return err
+	}
+
+	err = w.tw.Close()
+	if err != nil {
+		return err
+	}
+
+	return w.gz.Close()
+}
+
+// checkName refuses the names which would be extracted outside of the
+// extraction directory.
+func checkName(name string) error {
+	clean := path.Clean(name)
+	if clean != name || path.IsAbs(name) || clean == "." || clean == ".." ||
+		strings.HasPrefix(clean, "../") || name == ManifestName {
+		return fmt.Errorf("invalid file name %q", name)
+	}
+
+	return nil
+}
+
+// Extract extracts the archive read from r to dir and verifies it
+// against its manifest.  An error is returned if the archive has no
+// manifest, if a file is missing, corrupted or not listed in the
+// manifest, or if the files hold more than maxSize bytes.  The size of the
+// files is not bounded if maxSize is 0.  dir may hold a partial
+// extraction when an error is returned.
+func Extract(r io.Reader, dir string, maxSize int64) (*Manifest, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid archive")
+	}
+	defer gz.Close()
+
+	var manifest *Manifest
+	var size int64
+	extracted := make(map[string]File)
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid archive")
+		}
+
+		size += hdr.Size
+		if maxSize > 0 && size > maxSize {
+			return nil, fmt.Errorf("archive content exceeds %d bytes", maxSize)
+		}
+
+		if hdr.Name == ManifestName {
+			manifest = &Manifest{}
+			err = json.NewDecoder(tr).Decode(manifest)
+			if err != nil {
+				return nil, errors.Wrap(err, "invalid manifest")
+			}
+			continue
+		}
+
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+			return nil, fmt.Errorf("%s is not a regular file", hdr.Name)
+		}
+
+		if err := checkName(hdr.Name); err != nil {
+			return nil, err
+		}
+
+		if _, ok := extracted[hdr.Name]; ok {
+			return nil, fmt.Errorf("duplicate file %s", hdr.Name)
+		}
+
+		f, err := extractFile(tr, filepath.Join(dir, filepath.FromSlash(hdr.Name)))
+		if err != nil {
+			return nil, errors.Wrapf(err, "extract %s", hdr.Name)
+		}
+
+		f.Name = hdr.Name
+		extracted[hdr.Name] = f
+	}
+
+	if manifest == nil {
+		return nil, errors.New("archive has no manifest")
+	}
+
+	if manifest.Version > FormatVersion {
+		return nil, fmt.Errorf("archive format version %d is not supported", manifest.Version)
+	}
+
+	for _, f := range manifest.Files {
+		e, ok := extracted[f.Name]
+		if !ok {
+			return nil, fmt.Errorf("%s is missing from the archive", f.Name)
+		}
+
+		if e != f {
+			return nil, fmt.Errorf("%s does not match its checksum", f.Name)
+		}
+
+		delete(extracted, f.Name)
+	}
+
+	for name := range extracted {
+		return nil, fmt.Errorf("%s is not listed in the manifest", name)
+	}
+
+	return manifest, nil
+}
+
+func extractFile(r io.Reader, dest string) (File, error) {
+	err := os.MkdirAll(filepath.Dir(dest), 0700)
+	if err != nil {
+		return File{}, err
+	}
+
+	f, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return File{}, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, h), r)
+	if err != nil {
+		return File{}, err
+	}
+
+	return File{Size: n, SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
@@ -0,0 +1,238 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var testFiles = map[string]string{
+	"controller/ciao-controller.db":  "persistent",
+	"image/ciao-image.db":            "image metadata",
+	"images/73a86d7e-93c0-480e-9c41": "image",
+}
+
+func writeTestArchive(t *testing.T) []byte {
+	var buf bytes.Buffer
+
+	w := NewWriter(&buf)
+	for name, content := range testFiles {
+		err := w.Add(name, int64(len(content)), strings.NewReader(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+// rewriteArchive copies archive, passing each file through edit.  Files
+// for which edit returns nil are dropped.
+func rewriteArchive(t *testing.T, archive []byte, edit func(name string, content []byte) []byte) []byte {
+	gr, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			break
+		}
+
+		content, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		content = edit(hdr.Name, content)
+		if content == nil {
+			continue
+		}
+
+		hdr.Size = int64(len(content))
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := tw.Write(content); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tw.Close()
+	gw.Close()
+
+	return buf.Bytes()
+}
+
+func extractTestArchive(t *testing.T, archive []byte) (*Manifest, error) {
+	dir, err := ioutil.TempDir("", "ciao-backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	m, err := Extract(bytes.NewReader(archive), dir, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, content := range testFiles {
+		b, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(b) != content {
+			t.Errorf("%s extracted as %q, expected %q", name, b, content)
+		}
+	}
+
+	return m, nil
+}
+
+func TestArchive(t *testing.T) {
+	m, err := extractTestArchive(t, writeTestArchive(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Version != FormatVersion || len(m.Files) != len(testFiles) {
+		t.Fatalf("unexpected manifest %+v", m)
+	}
+
+	for _, f := range m.Files {
+		if f.Size != int64(len(testFiles[f.Name])) || len(f.SHA256) != 64 {
+			t.Errorf("unexpected manifest entry %+v", f)
+		}
+	}
+}
+
+func TestArchiveCorrupted(t *testing.T) {
+	archive := writeTestArchive(t)
+
+	tests := []struct {
+		name string
+		edit func(name string, content []byte) []byte
+	}{
+		{
+			"corrupted file",
+			func(name string, content []byte) []byte {
+				if name == "image/ciao-image.db" {
+					return []byte("IMAGE METADATA")
+				}
+				return content
+			},
+		},
+		{
+			"missing file",
+			func(name string, content []byte) []byte {
+				if name == "image/ciao-image.db" {
+					return nil
+				}
+				return content
+			},
+		},
+		{
+			"missing manifest",
+			func(name string, content []byte) []byte {
+				if name == ManifestName {
+					return nil
+				}
+				return content
+			},
+		},
+		{
+			"unlisted file",
+			func(name string, content []byte) []byte {
+				if name == "image/ciao-image.db" {
+					return content
+				}
+				if name == ManifestName {
+					return []byte(`{"version": 1, "files": []}`)
+				}
+				return nil
+			},
+		},
+	}
+
+	for _, test := range tests {
+		_, err := extractTestArchive(t, rewriteArchive(t, archive, test.edit))
+		if err == nil {
+			t.Errorf("%s: archive accepted", test.name)
+		}
+	}
+}
+
+func TestArchiveInvalidNames(t *testing.T) {
+	names := []string{"/etc/passwd", "../ciao-controller.db", "images/../../x", "", ManifestName}
+
+	for _, name := range names {
+		w := NewWriter(ioutil.Discard)
+		if err := w.Add(name, 0, strings.NewReader("")); err == nil {
+			t.Errorf("%q accepted", name)
+		}
+	}
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	tw.WriteHeader(&tar.Header{Name: "../escape", Mode: 0600, Size: 1, Typeflag: tar.TypeReg})
+	tw.Write([]byte("x"))
+	tw.Close()
+	gw.Close()
+
+	if _, err := extractTestArchive(t, buf.Bytes()); err == nil {
+		t.Error("path traversal accepted")
+	}
+}
+
+func TestArchiveMaxSize(t *testing.T) {
+	archive := writeTestArchive(t)
+
+	dir, err := ioutil.TempDir("", "ciao-backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	_, err = Extract(bytes.NewReader(archive), dir, 16)
+	if err == nil {
+		t.Error("archive larger than its maximum size accepted")
+	}
+
+	_, err = Extract(bytes.NewReader(archive), filepath.Join(dir, "ok"), 1<<20)
+	if err != nil {
+		t.Error(err)
+	}
+}
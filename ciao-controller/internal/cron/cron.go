@@ -0,0 +1,242 @@
+/*
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package cron parses the five fields cron expressions of the instance
+// schedules and computes their next activation.
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxYears bounds the search of the next activation, an expression which
+// never matches, e.g., 0 0 30 2 *, has none.
+const maxYears = 5
+
+// field is the set of the values matched by a field of an expression.
+type field uint64
+
+func (f field) has(v int) bool {
+	return f&(1<<uint(v)) != 0
+}
+
+type bounds struct {
+	name     string
+	min, max int
+}
+
+var fieldBounds = []bounds{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Expression is a parsed cron expression.
+type Expression struct {
+	minute, hour, dom, month, dow field
+
+	// the day of the month and the day of the week match a day when
+	// both are restricted and either of them matches.
+	domStar, dowStar bool
+}
+
+// Parse parses a cron expression: minute, hour, day of month, month and
+// day of week fields separated by spaces.  Each field is *, a value, a
+// range a-b or a comma separated list of those, and any of them but a
+// value may be followed by a /step.  Sunday is 0 or 7.  The @yearly,
+// @monthly, @weekly, @daily and @hourly descriptors are accepted too.
+func Parse(spec string) (*Expression, error) {
+	spec = strings.TrimSpace(spec)
+	if d, ok := descriptors[spec]; ok {
+		spec = d
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != len(fieldBounds) {
+		return nil, fmt.Errorf("cron expression %q has %d fields, expected %d", spec, len(fields), len(fieldBounds))
+	}
+
+	values := make([]field, len(fields))
+	for i, f := range fields {
+		v, err := parseField(f, fieldBounds[i])
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+
+	e := &Expression{
+		minute:  values[0],
+		hour:    values[1],
+		dom:     values[2],
+		month:   values[3],
+		dow:     values[4],
+		domStar: fields[2] == "*",
+		dowStar: fields[4] == "*",
+	}
+
+	// 7 is another name of sunday
+	if e.dow.has(7) {
+		e.dow |= 1
+	}
+
+	return e, nil
+}
+
+func parseField(f string, b bounds) (field, error) {
+	var value field
+
+	for _, part := range strings.Split(f, ",") {
+		v, err := parsePart(part, b)
+		if err != nil {
+			return 0, err
+		}
+		value |= v
+	}
+
+	return value, nil
+}
+
+func parsePart(part string, b bounds) (field, error) {
+	rng := part
+	step := 1
+
+	if i := strings.Index(part, "/"); i >= 0 {
+		var err error
+
+		rng = part[:i]
+		step, err = strconv.Atoi(part[i+1:])
+		if err != nil || step <= 0 {
+			return 0, fmt.Errorf("invalid step in %s field %q", b.name, part)
+		}
+	}
+
+	var low, high int
+
+	switch i := strings.Index(rng, "-"); {
+	case rng == "*":
+		low, high = b.min, b.max
+	case i >= 0:
+		var err error
+
+		low, err = parseValue(rng[:i], b)
+		if err != nil {
+			return 0, err
+		}
+
+		high, err = parseValue(rng[i+1:], b)
+		if err != nil {
+			return 0, err
+		}
+
+		if high < low {
+			return 0, fmt.Errorf("invalid range in %s field %q", b.name, part)
+		}
+	default:
+		var err error
+
+		low, err = parseValue(rng, b)
+		if err != nil {
+			return 0, err
+		}
+
+		high = low
+		if step != 1 {
+			return 0, fmt.Errorf("step without range in %s field %q", b.name, part)
+		}
+	}
+
+	var value field
+	for v := low; v <= high; v += step {
+		value |= 1 << uint(v)
+	}
+
+	return value, nil
+}
+
+func parseValue(s string, b bounds) (int, error) {
+	v, err := strconv.Atoi(s)
+	if err != nil || v < b.min || v > b.max {
+		return 0, fmt.Errorf("invalid %s %q, expected %d to %d", b.name, s, b.min, b.max)
+	}
+
+	return v, nil
+}
+
+func (e *Expression) matchDay(t time.Time) bool {
+	dom := e.dom.has(t.Day())
+	dow := e.dow.has(int(t.Weekday()))
+
+	switch {
+	case e.domStar && e.dowStar:
+		return true
+	case e.domStar:
+		return dow
+	case e.dowStar:
+		return dom
+	}
+
+	return dom || dow
+}
+
+// Next returns the first time strictly after t matched by the
+// expression, in the location of t.  It returns the zero time if the
+// expression does not match in the following years.
+func (e *Expression) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	end := t.AddDate(maxYears, 0, 0)
+
+	for t.Before(end) {
+		if !e.month.has(int(t.Month())) {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if !e.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if !e.hour.has(t.Hour()) {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if !e.minute.has(t.Minute()) {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
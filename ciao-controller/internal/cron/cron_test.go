@@ -0,0 +1,88 @@
+/*
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseInvalid(t *testing.T) {
+	specs := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"5/2 * * * *",
+		"a * * * *",
+		"1,,2 * * * *",
+		"@reboot",
+	}
+
+	for _, s := range specs {
+		_, err := Parse(s)
+		if err == nil {
+			t.Errorf("invalid expression %q accepted", s)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	// a thursday
+	from := time.Date(2017, time.March, 2, 10, 30, 15, 0, time.UTC)
+
+	tests := []struct {
+		spec string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2017, time.March, 2, 10, 31, 0, 0, time.UTC)},
+		{"30 10 * * *", time.Date(2017, time.March, 3, 10, 30, 0, 0, time.UTC)},
+		{"0 19 * * 1-5", time.Date(2017, time.March, 2, 19, 0, 0, 0, time.UTC)},
+		{"0 7 * * 1-5", time.Date(2017, time.March, 3, 7, 0, 0, 0, time.UTC)},
+		{"0 7 * * 1", time.Date(2017, time.March, 6, 7, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2017, time.March, 5, 0, 0, 0, 0, time.UTC)},
+		{"*/20 * * * *", time.Date(2017, time.March, 2, 10, 40, 0, 0, time.UTC)},
+		{"0 8-18/4 * * *", time.Date(2017, time.March, 2, 12, 0, 0, 0, time.UTC)},
+		{"15,45 * * * *", time.Date(2017, time.March, 2, 10, 45, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2017, time.April, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2020, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 15 * 1", time.Date(2017, time.March, 6, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2017, time.March, 2, 11, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2017, time.March, 5, 0, 0, 0, 0, time.UTC)},
+		{"@yearly", time.Date(2018, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+
+	for _, test := range tests {
+		e, err := Parse(test.spec)
+		if err != nil {
+			t.Errorf("%s: %v", test.spec, err)
+			continue
+		}
+
+		next := e.Next(from)
+		if !next.Equal(test.next) {
+			t.Errorf("%s: expected %v, got %v", test.spec, test.next, next)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+/*
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package datastore
+
+import (
+	"github.com/01org/ciao/ciao-controller/types"
+	"github.com/pkg/errors"
+)
+
+// defaultAuditLimit bounds the number of audit records returned by a query
+// which does not set a limit.
+const defaultAuditLimit = 100
+
+// AddAuditRecord appends a record to the audit log.  Records are never
+// updated nor deleted once added.
+func (ds *Datastore) AddAuditRecord(r types.AuditRecord) error {
+	err := ds.db.addAuditRecord(r)
+	if err != nil {
+		return errors.Wrap(err, "error adding audit record")
+	}
+
+	return nil
+}
+
+// GetAuditRecords returns the audit records matching the filter, newest
+// first.
+func (ds *Datastore) GetAuditRecords(filter types.AuditFilter) ([]types.AuditRecord, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = defaultAuditLimit
+	}
+
+	records, err := ds.db.getAuditRecords(filter)
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving audit records")
+	}
+
+	return records, nil
+}
@@ -22,6 +22,7 @@ package datastore
 import (
 	"crypto/rand"
 	"encoding/binary"
+	"encoding/json"
 	"fmt"
 	"net"
 	"sort"
@@ -43,6 +44,8 @@ var (
 )
 
 // Config contains configuration information for the datastore.
+// A PersistentURI using the postgres scheme selects the PostgreSQL
+// backend, TransientURI is then unused.
 type Config struct {
 	DBBackend         persistentStore
 	PersistentURI     string
@@ -64,17 +67,114 @@ type workload struct {
 	filename string
 }
 
+// marshalParameters returns the parameters of the workload as stored in
+// the databases.
+func (w *workload) marshalParameters() (string, error) {
+	if len(w.Parameters) == 0 {
+		return "", nil
+	}
+
+	p, err := json.Marshal(w.Parameters)
+	if err != nil {
+		return "", err
+	}
+
+	return string(p), nil
+}
+
+func (w *workload) unmarshalParameters(parameters string) error {
+	if parameters == "" {
+		w.Parameters = nil
+		return nil
+	}
+
+	err := json.Unmarshal([]byte(parameters), &w.Parameters)
+	return errors.Wrap(err, "invalid workload parameters")
+}
+
+// marshalRestartPolicy returns the restart policy of the workload as
+// stored in the databases.
+func (w *workload) marshalRestartPolicy() (string, error) {
+	if w.RestartPolicy == nil {
+		return "", nil
+	}
+
+	p, err := json.Marshal(w.RestartPolicy)
+	if err != nil {
+		return "", err
+	}
+
+	return string(p), nil
+}
+
+func (w *workload) unmarshalRestartPolicy(policy string) error {
+	if policy == "" {
+		w.RestartPolicy = nil
+		return nil
+	}
+
+	w.RestartPolicy = &payloads.RestartPolicy{}
+	err := json.Unmarshal([]byte(policy), w.RestartPolicy)
+	return errors.Wrap(err, "invalid workload restart policy")
+}
+
+// marshalHealthCheck returns a health check of a workload or an instance
+// as stored in the databases.
+func marshalHealthCheck(check *payloads.HealthCheck) (string, error) {
+	if check == nil {
+		return "", nil
+	}
+
+	c, err := json.Marshal(check)
+	if err != nil {
+		return "", err
+	}
+
+	return string(c), nil
+}
+
+func unmarshalHealthCheck(check string) (*payloads.HealthCheck, error) {
+	if check == "" {
+		return nil, nil
+	}
+
+	c := &payloads.HealthCheck{}
+	err := json.Unmarshal([]byte(check), c)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid health check")
+	}
+
+	return c, nil
+}
+
 type tenant struct {
 	types.Tenant
 	network   map[int]map[int]bool
 	subnets   []int
 	instances map[string]*types.Instance
 	devices   map[string]types.BlockData
+
+	// node the CNCI last reported statistics from, empty until
+	// the CNCI reports or once that node has gone.
+	cnciNodeID string
 }
 
 type node struct {
 	types.Node
 	instances map[string]*types.Instance
+
+	// instances listed in the last statistics of the node, with
+	// their reported state.
+	reported     map[string]types.InstanceState
+	reportedTime time.Time
+}
+
+// NodeReport lists the instances a node reported in its last
+// statistics.
+type NodeReport struct {
+	NodeID    string
+	Timestamp time.Time
+	Instances map[string]types.InstanceState
 }
 
 type attachment struct {
@@ -96,6 +196,7 @@ type persistentStore interface {
 	getWorkload(id string) (*workload, error)
 	getWorkloads() ([]*workload, error)
 	updateWorkload(wl workload) error
+	deleteWorkload(ID string) error
 
 	// interfaces related to tenants
 	addLimit(tenantID string, resourceID int, limit int) (err error)
@@ -103,6 +204,7 @@ type persistentStore interface {
 	getTenant(id string) (t *tenant, err error)
 	getTenants() ([]*tenant, error)
 	updateTenant(t *tenant) (err error)
+	deleteTenant(id string) (err error)
 	releaseTenantIP(tenantID string, subnetInt int, rest int) (err error)
 	claimTenantIP(tenantID string, subnetInt int, rest int) (err error)
 
@@ -110,6 +212,43 @@ type persistentStore interface {
 	getInstances() (instances []*types.Instance, err error)
 	addInstance(instance *types.Instance) (err error)
 	deleteInstance(instanceID string) (err error)
+	addInstanceTransition(instanceID string, t types.InstanceTransition) (err error)
+	getInstanceTransitions() (transitions map[string][]types.InstanceTransition, err error)
+	updateInstanceDetails(instanceID string, d instanceDetails) (err error)
+	getInstanceDetails() (details map[string]instanceDetails, err error)
+	updateInstanceConfig(instanceID string, config string) (err error)
+	getInstanceConfig(instanceID string) (config string, err error)
+
+	// interfaces related to usage metering
+	addInstanceUsage(u types.InstanceUsage) error
+	getInstanceUsage(instanceID string, hour time.Time) (*types.InstanceUsage, error)
+	getInstanceUsages(tenantID string, start time.Time, end time.Time) ([]types.InstanceUsage, error)
+
+	// interfaces related to auditing, the audit log is append-only
+	addAuditRecord(r types.AuditRecord) error
+	getAuditRecords(filter types.AuditFilter) ([]types.AuditRecord, error)
+
+	// interfaces related to the scheduled instance actions
+	updateSchedule(s types.Schedule) error
+	deleteSchedule(ID string) error
+	getSchedules() ([]types.Schedule, error)
+
+	// interfaces related to the scaling groups
+	updateScalingGroup(g types.ScalingGroup) error
+	deleteScalingGroup(ID string) error
+	getScalingGroups() ([]types.ScalingGroup, error)
+	addScalingActivity(a types.ScalingActivity) error
+	getScalingActivities(groupID string) ([]types.ScalingActivity, error)
+
+	// interfaces related to the keypairs of the users
+	addKeypair(k types.Keypair) error
+	deleteKeypair(userID string, name string) error
+	getKeypairs() ([]types.Keypair, error)
+
+	// interfaces related to the security groups of the tenants
+	updateSecurityGroup(g types.SecurityGroup) error
+	deleteSecurityGroup(ID string) error
+	getSecurityGroups() ([]types.SecurityGroup, error)
 
 	// interfaces related to statistics
 	addNodeStat(stat payloads.Stat) (err error)
@@ -184,6 +323,13 @@ type Datastore struct {
 	externalIPs     map[string]bool
 	mappedIPs       map[string]types.MappedIP
 	poolsLock       *sync.RWMutex
+
+	keypairsLock *sync.Mutex
+
+	securityGroupsLock *sync.Mutex
+
+	events eventBroker
+	meters usageMeters
 }
 
 func (ds *Datastore) initExternalIPs() {
@@ -206,16 +352,26 @@ func (ds *Datastore) initExternalIPs() {
 	ds.mappedIPs = ds.db.getMappedIPs()
 }
 
+// newPersistentStore returns the persistent store backend selected by
+// config.
+func newPersistentStore(config Config) persistentStore {
+	if config.DBBackend != nil {
+		return config.DBBackend
+	}
+
+	if isPostgresURI(config.PersistentURI) {
+		return &postgresDB{}
+	}
+
+	return &sqliteDB{}
+}
+
 // Init initializes the private data for the Datastore object.
 // The sql tables are populated with initial data from csv
 // files if this is the first time the database has been
 // created.  The datastore caches are also filled.
 func (ds *Datastore) Init(config Config) error {
-	ps := config.DBBackend
-
-	if ps == nil {
-		ps = &sqliteDB{}
-	}
+	ps := newPersistentStore(config)
 
 	err := ps.init(config)
 	if err != nil {
@@ -248,7 +404,23 @@ func (ds *Datastore) Init(config Config) error {
 		return errors.Wrap(err, "error getting instances from database")
 	}
 
+	transitions, err := ds.db.getInstanceTransitions()
+	if err != nil {
+		return errors.Wrap(err, "error getting instance transitions from database")
+	}
+
+	details, err := ds.db.getInstanceDetails()
+	if err != nil {
+		return errors.Wrap(err, "error getting instance details from database")
+	}
+
 	for i := range instances {
+		history := transitions[instances[i].ID]
+		if len(history) > 0 {
+			instances[i].Transitions = history
+			instances[i].State = history[len(history)-1].To
+		}
+		details[instances[i].ID].apply(instances[i])
 		ds.instances[instances[i].ID] = instances[i]
 	}
 
@@ -326,6 +498,9 @@ func (ds *Datastore) Init(config Config) error {
 
 	ds.attachLock = &sync.RWMutex{}
 
+	ds.keypairsLock = &sync.Mutex{}
+	ds.securityGroupsLock = &sync.Mutex{}
+
 	ds.initExternalIPs()
 
 	return nil
@@ -336,6 +511,24 @@ func (ds *Datastore) Exit() {
 	ds.db.disconnect()
 }
 
+// snapshotter is implemented by the persistent stores which can copy
+// themselves while the controller is running.
+type snapshotter interface {
+	snapshot(dir string) ([]string, error)
+}
+
+// Snapshot writes a consistent copy of the persistent and transient
+// databases to dir, which must exist, and returns the paths of the files
+// written.  The copy can be read back with ReadSnapshot.
+func (ds *Datastore) Snapshot(dir string) ([]string, error) {
+	s, ok := ds.db.(snapshotter)
+	if !ok {
+		return nil, errors.New("snapshots are not supported by this database, use its own backup tools")
+	}
+
+	return s.snapshot(dir)
+}
+
 // AddTenantChan allows a caller to pass in a channel for CNCI Launch status.
 // When a CNCI has been added to the datastore and a channel exists,
 // success will be indicated on the channel.  If a CNCI failure occurred
@@ -347,6 +540,7 @@ func (ds *Datastore) AddTenantChan(c chan bool, tenantID string) {
 }
 
 // AddLimit allows the caller to store a limt for a specific resource for a tenant.
+// Any previous limit for that resource is replaced.
 func (ds *Datastore) AddLimit(tenantID string, resourceID int, limit int) error {
 	err := ds.db.addLimit(tenantID, resourceID, limit)
 	if err != nil {
@@ -445,6 +639,207 @@ func (ds *Datastore) GetTenant(id string) (*types.Tenant, error) {
 	return &t.Tenant, nil
 }
 
+// UpdateTenantName changes the human readable name of a tenant.
+func (ds *Datastore) UpdateTenantName(id string, name string) error {
+	ds.tenantsLock.Lock()
+	t, ok := ds.tenants[id]
+	if !ok {
+		ds.tenantsLock.Unlock()
+		return types.ErrTenantNotFound
+	}
+	t.Name = name
+	ds.tenantsLock.Unlock()
+
+	return errors.Wrap(ds.db.updateTenant(t), "error updating tenant in database")
+}
+
+// DeleteTenant removes a tenant and its CNCI instance from the datastore.
+// Tenants still owning other instances, volumes, external IPs or private
+// workloads cannot be deleted.
+func (ds *Datastore) DeleteTenant(id string) error {
+	ds.tenantsLock.RLock()
+	t, ok := ds.tenants[id]
+	if !ok {
+		ds.tenantsLock.RUnlock()
+		return types.ErrTenantNotFound
+	}
+
+	inUse := len(t.devices) > 0
+	for _, i := range t.instances {
+		if !i.CNCI {
+			inUse = true
+		}
+	}
+	cnciID := t.CNCIID
+	ds.tenantsLock.RUnlock()
+
+	if len(ds.GetMappedIPs(&id)) > 0 {
+		inUse = true
+	}
+
+	ds.workloadsLock.RLock()
+	for _, wl := range ds.workloads {
+		if wl.TenantID == id {
+			inUse = true
+		}
+	}
+	ds.workloadsLock.RUnlock()
+
+	if inUse {
+		return types.ErrTenantInUse
+	}
+
+	ds.instancesLock.RLock()
+	_, ok = ds.instances[cnciID]
+	ds.instancesLock.RUnlock()
+
+	if ok {
+		_, err := ds.deleteInstance(cnciID)
+		if err != nil {
+			return errors.Wrapf(err, "error deleting CNCI (%v)", cnciID)
+		}
+	}
+
+	err := ds.db.deleteTenant(id)
+	if err != nil {
+		return errors.Wrapf(err, "error deleting tenant (%v) from database", id)
+	}
+
+	ds.tenantsLock.Lock()
+	delete(ds.tenants, id)
+	ds.tenantsLock.Unlock()
+
+	ds.tenantUsageLock.Lock()
+	delete(ds.tenantUsage, id)
+	ds.tenantUsageLock.Unlock()
+
+	return nil
+}
+
+// GetQuotas returns the limit and usage of the resources of a tenant
+// which can be given a quota.
+func (ds *Datastore) GetQuotas(tenantID string) ([]types.QuotaDetails, error) {
+	t, err := ds.getTenant(tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	if t == nil {
+		return nil, types.ErrTenantNotFound
+	}
+
+	resources := make(map[string]types.Resource)
+	volumes := 0
+
+	ds.tenantsLock.RLock()
+	for _, r := range t.Resources {
+		resources[r.Rname] = *r
+	}
+	for _, d := range t.devices {
+		if !d.Ephemeral {
+			volumes++
+		}
+	}
+	ds.tenantsLock.RUnlock()
+
+	externalIPs := len(ds.GetMappedIPs(&tenantID))
+
+	quotas := make([]types.QuotaDetails, 0, len(types.QuotaNames))
+	for _, name := range types.QuotaNames {
+		r, ok := resources[name]
+		if !ok {
+			r.Limit = -1
+		}
+
+		q := types.QuotaDetails{
+			Name:  name,
+			Value: r.Limit,
+			Usage: r.Usage,
+		}
+
+		switch name {
+		case types.VolumesQuota:
+			q.Usage = volumes
+		case types.ExternalIPsQuota:
+			q.Usage = externalIPs
+		}
+
+		quotas = append(quotas, q)
+	}
+
+	return quotas, nil
+}
+
+// UpdateQuotas changes the limits of a tenant.  A negative value removes
+// the limit.  No limit is changed if any of the quotas is unknown.
+func (ds *Datastore) UpdateQuotas(tenantID string, quotas []types.QuotaDetails) error {
+	t, err := ds.getTenant(tenantID)
+	if err != nil {
+		return err
+	}
+
+	if t == nil {
+		return types.ErrTenantNotFound
+	}
+
+	resourceIDs := make(map[string]int)
+
+	ds.tenantsLock.RLock()
+	for _, r := range t.Resources {
+		resourceIDs[r.Rname] = r.Rtype
+	}
+	ds.tenantsLock.RUnlock()
+
+	for _, q := range quotas {
+		known := false
+		for _, name := range types.QuotaNames {
+			if q.Name == name {
+				known = true
+				break
+			}
+		}
+
+		if _, ok := resourceIDs[q.Name]; !ok || !known {
+			return types.ErrUnknownQuota
+		}
+	}
+
+	for _, q := range quotas {
+		limit := q.Value
+		if limit < 0 {
+			limit = -1
+		}
+
+		err = ds.AddLimit(tenantID, resourceIDs[q.Name], limit)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// OverQuota tells if allocating request more of a resource would put a
+// tenant over its quota.
+func (ds *Datastore) OverQuota(tenantID string, name string, request int) (bool, error) {
+	quotas, err := ds.GetQuotas(tenantID)
+	if err != nil {
+		return false, err
+	}
+
+	for _, q := range quotas {
+		if q.Name == name {
+			r := types.Resource{
+				Limit: q.Value,
+				Usage: q.Usage,
+			}
+			return r.OverLimit(request), nil
+		}
+	}
+
+	return false, nil
+}
+
 // AddWorkload is used to add a new workload to the datastore.
 // Both cache and persistent store are updated.
 func (ds *Datastore) AddWorkload(w types.Workload) error {
@@ -467,6 +862,62 @@ func (ds *Datastore) AddWorkload(w types.Workload) error {
 	return nil
 }
 
+// UpdateWorkload replaces the definition of an existing workload.
+// Both cache and persistent store are updated.
+func (ds *Datastore) UpdateWorkload(w types.Workload) error {
+	ds.workloadsLock.Lock()
+	defer ds.workloadsLock.Unlock()
+
+	if _, ok := ds.workloads[w.ID]; !ok {
+		return types.ErrWorkloadNotFound
+	}
+
+	// Workloads loaded from the CSV files may share a config file, so
+	// an update always writes the config to a file of its own.
+	wl := workload{
+		Workload: w,
+		filename: fmt.Sprintf("%s_config.yaml", w.ID),
+	}
+
+	err := ds.db.updateWorkload(wl)
+	if err != nil {
+		return errors.Wrapf(err, "error updating workload (%v) in database", wl.ID)
+	}
+
+	ds.workloads[wl.ID] = &wl
+
+	return nil
+}
+
+// DeleteWorkload removes a workload from the datastore.  Workloads
+// with instances cannot be deleted.
+func (ds *Datastore) DeleteWorkload(id string) error {
+	ds.workloadsLock.Lock()
+	defer ds.workloadsLock.Unlock()
+
+	if _, ok := ds.workloads[id]; !ok {
+		return types.ErrWorkloadNotFound
+	}
+
+	ds.instancesLock.RLock()
+	for _, i := range ds.instances {
+		if i.WorkloadID == id {
+			ds.instancesLock.RUnlock()
+			return types.ErrWorkloadInUse
+		}
+	}
+	ds.instancesLock.RUnlock()
+
+	err := ds.db.deleteWorkload(id)
+	if err != nil {
+		return errors.Wrapf(err, "error deleting workload (%v) from database", id)
+	}
+
+	delete(ds.workloads, id)
+
+	return nil
+}
+
 func (ds *Datastore) getWorkload(id string) (*workload, error) {
 	// check the cache first
 	ds.workloadsLock.RLock()
@@ -858,18 +1309,26 @@ func (ds *Datastore) AddInstance(instance *types.Instance) error {
 
 	ds.instances[instance.ID] = instance
 
+	transition := types.InstanceTransition{
+		To:        instance.State,
+		Timestamp: time.Now(),
+	}
+	instance.Transitions = append(instance.Transitions, transition)
+
 	instanceStat := types.CiaoServerStats{
 		ID:        instance.ID,
 		TenantID:  instance.TenantID,
 		NodeID:    instance.NodeID,
-		Timestamp: time.Now(),
-		Status:    instance.State,
+		Timestamp: transition.Timestamp,
+		Status:    string(instance.State),
 	}
 
 	ds.instanceLastStatLock.Lock()
 	ds.instanceLastStat[instance.ID] = instanceStat
 	ds.instanceLastStatLock.Unlock()
 
+	ds.publishTransition(instance, transition)
+
 	ds.instancesLock.Unlock()
 
 	ds.tenantsLock.Lock()
@@ -898,8 +1357,175 @@ func (ds *Datastore) AddInstance(instance *types.Instance) error {
 
 	ds.tenantsLock.Unlock()
 
+	// the details are stored before returning, so that later changes
+	// are not overwritten by the asynchronous update.
+	if d := detailsOf(instance); !d.empty() {
+		err := ds.db.updateInstanceDetails(instance.ID, d)
+		if err != nil {
+			glog.Warningf("error storing details of instance (%v): %v", instance.ID, err)
+		}
+	}
+
 	// update database asynchronously
-	go ds.db.addInstance(instance)
+	go func() {
+		ds.db.addInstance(instance)
+		ds.db.addInstanceTransition(instance.ID, transition)
+	}()
+
+	return nil
+}
+
+// recordTransition moves an instance to a new state.  The instances
+// lock must be held by the caller.
+func recordTransition(instance *types.Instance, to types.InstanceState) types.InstanceTransition {
+	t := types.InstanceTransition{
+		From:      instance.State,
+		To:        to,
+		Timestamp: time.Now(),
+	}
+
+	instance.State = to
+	instance.Transitions = append(instance.Transitions, t)
+
+	return t
+}
+
+// reportedTransition tells if a state reported by ciao-launcher may
+// replace the current state of an instance.  Instances waiting for the
+// result of a command only move to the state the command leads to.
+func reportedTransition(from types.InstanceState, to types.InstanceState) bool {
+	switch from {
+	case types.InstanceStopping:
+		return to == types.InstanceExited
+	case types.InstanceRestarting:
+		return to == types.InstancePending || to == types.InstanceRunning
+	case types.InstanceDeleting:
+		return false
+	}
+
+	return from.CanTransition(to)
+}
+
+// TransitionInstance moves an instance to a new state and records the
+// transition.  A *types.TransitionError is returned if the current state
+// of the instance does not allow it.
+func (ds *Datastore) TransitionInstance(instanceID string, to types.InstanceState) error {
+	ds.instancesLock.Lock()
+
+	instance, ok := ds.instances[instanceID]
+	if !ok {
+		ds.instancesLock.Unlock()
+		return types.ErrInstanceNotFound
+	}
+
+	if !instance.State.CanTransition(to) {
+		ds.instancesLock.Unlock()
+		return &types.TransitionError{
+			InstanceID: instanceID,
+			From:       instance.State,
+			To:         to,
+		}
+	}
+
+	t := recordTransition(instance, to)
+	ds.publishTransition(instance, t)
+
+	ds.instancesLock.Unlock()
+
+	return errors.Wrapf(ds.db.addInstanceTransition(instanceID, t),
+		"error adding transition of instance (%v) to database", instanceID)
+}
+
+// SetInstanceConfig stores the start config of an instance, which is sent
+// again if the instance is rescheduled.
+func (ds *Datastore) SetInstanceConfig(instanceID string, config string) error {
+	return errors.Wrapf(ds.db.updateInstanceConfig(instanceID, config),
+		"error storing config of instance (%v) in database", instanceID)
+}
+
+// GetInstanceConfig retrieves the start config of an instance, it is empty
+// if none was stored.
+func (ds *Datastore) GetInstanceConfig(instanceID string) (string, error) {
+	config, err := ds.db.getInstanceConfig(instanceID)
+	return config, errors.Wrapf(err, "error getting config of instance (%v) from database", instanceID)
+}
+
+// SetInstanceHealth records the health of an instance, as reported by the
+// CNCI of its tenant, and returns the health it had before.  The health is
+// not stored in the database, the CNCI reports it again when it receives
+// the health checks.
+func (ds *Datastore) SetInstanceHealth(instanceID string, health payloads.HealthStatus, reason string) (payloads.HealthStatus, error) {
+	ds.instancesLock.Lock()
+	defer ds.instancesLock.Unlock()
+
+	instance, ok := ds.instances[instanceID]
+	if !ok {
+		return "", types.ErrInstanceNotFound
+	}
+
+	previous := instance.Health
+	instance.Health = health
+	instance.HealthReason = reason
+
+	return previous, nil
+}
+
+// RescheduleInstance moves an instance lost with a node back to the
+// pending state, detached from the node, so that it can be started again
+// on another node.  It fails if the node or the instance moved on in the
+// meantime: the node reconnected, or the instance was deleted, stopped or
+// reported by another node.
+func (ds *Datastore) RescheduleInstance(instanceID string, nodeID string) error {
+	ds.instancesLock.Lock()
+
+	instance, ok := ds.instances[instanceID]
+	if !ok {
+		ds.instancesLock.Unlock()
+		return types.ErrInstanceNotFound
+	}
+
+	ds.nodesLock.RLock()
+	_, reconnected := ds.nodes[nodeID]
+	ds.nodesLock.RUnlock()
+
+	if reconnected || instance.NodeID != nodeID {
+		ds.instancesLock.Unlock()
+		return fmt.Errorf("instance %s is no longer lost with node %s", instanceID, nodeID)
+	}
+
+	var transitions []types.InstanceTransition
+
+	for _, to := range []types.InstanceState{types.InstanceLost, types.InstancePending} {
+		if instance.State == to {
+			continue
+		}
+
+		if !instance.State.CanTransition(to) {
+			ds.instancesLock.Unlock()
+			return &types.TransitionError{
+				InstanceID: instanceID,
+				From:       instance.State,
+				To:         to,
+			}
+		}
+
+		t := recordTransition(instance, to)
+		ds.publishTransition(instance, t)
+		transitions = append(transitions, t)
+	}
+
+	instance.NodeID = ""
+	instance.SSHIP = ""
+	instance.SSHPort = 0
+
+	ds.instancesLock.Unlock()
+
+	for _, t := range transitions {
+		err := ds.db.addInstanceTransition(instanceID, t)
+		if err != nil {
+			return errors.Wrapf(err, "error adding transition of instance (%v) to database", instanceID)
+		}
+	}
 
 	return nil
 }
@@ -914,6 +1540,17 @@ func (ds *Datastore) RestartFailure(instanceID string, reason payloads.RestartFa
 	msg := fmt.Sprintf("Restart Failure %s: %s", instanceID, reason.String())
 	ds.db.logEvent(i.TenantID, string(userError), msg)
 
+	ds.PublishEvent(types.StreamEvent{
+		Type:       types.InstanceRestartFailureEvent,
+		TenantID:   i.TenantID,
+		InstanceID: instanceID,
+		Message:    reason.String(),
+	})
+
+	if i.State == types.InstanceRestarting {
+		return ds.TransitionInstance(instanceID, types.InstanceExited)
+	}
+
 	return nil
 }
 
@@ -928,6 +1565,17 @@ func (ds *Datastore) StopFailure(instanceID string, reason payloads.StopFailureR
 
 	ds.db.logEvent(i.TenantID, string(userError), msg)
 
+	ds.PublishEvent(types.StreamEvent{
+		Type:       types.InstanceStopFailureEvent,
+		TenantID:   i.TenantID,
+		InstanceID: instanceID,
+		Message:    reason.String(),
+	})
+
+	if i.State == types.InstanceStopping {
+		return ds.TransitionInstance(instanceID, types.InstanceRunning)
+	}
+
 	return nil
 }
 
@@ -960,6 +1608,13 @@ func (ds *Datastore) StartFailure(instanceID string, reason payloads.StartFailur
 		msg := fmt.Sprintf("CNCI Start Failure %s: %s", instanceID, reason.String())
 		ds.db.logEvent(tenantID, string(userError), msg)
 
+		ds.PublishEvent(types.StreamEvent{
+			Type:       types.InstanceStartFailureEvent,
+			TenantID:   tenantID,
+			InstanceID: instanceID,
+			Message:    reason.String(),
+		})
+
 		ds.cnciAddedLock.Lock()
 
 		c, ok := ds.cnciAddedChans[tenantID]
@@ -1001,6 +1656,13 @@ func (ds *Datastore) StartFailure(instanceID string, reason payloads.StartFailur
 	msg := fmt.Sprintf("Start Failure %s: %s", instanceID, reason.String())
 	ds.db.logEvent(i.TenantID, string(userError), msg)
 
+	ds.PublishEvent(types.StreamEvent{
+		Type:       types.InstanceStartFailureEvent,
+		TenantID:   i.TenantID,
+		InstanceID: instanceID,
+		Message:    reason.String(),
+	})
+
 	return nil
 }
 
@@ -1030,6 +1692,14 @@ func (ds *Datastore) AttachVolumeFailure(instanceID string, volumeID string, rea
 
 	ds.db.logEvent(i.TenantID, string(userError), msg)
 
+	ds.PublishEvent(types.StreamEvent{
+		Type:       types.VolumeAttachFailureEvent,
+		TenantID:   i.TenantID,
+		InstanceID: instanceID,
+		VolumeID:   volumeID,
+		Message:    reason.String(),
+	})
+
 	return nil
 }
 
@@ -1062,6 +1732,14 @@ func (ds *Datastore) DetachVolumeFailure(instanceID string, volumeID string, rea
 	msg := fmt.Sprintf("Detach Volume Failure %s from %s: %s", volumeID, instanceID, reason.String())
 
 	ds.db.logEvent(i.TenantID, string(userError), msg)
+
+	ds.PublishEvent(types.StreamEvent{
+		Type:       types.VolumeDetachFailureEvent,
+		TenantID:   i.TenantID,
+		InstanceID: instanceID,
+		VolumeID:   volumeID,
+		Message:    reason.String(),
+	})
 	return nil
 }
 
@@ -1070,15 +1748,29 @@ func (ds *Datastore) deleteInstance(instanceID string) (string, error) {
 	delete(ds.instanceLastStat, instanceID)
 	ds.instanceLastStatLock.Unlock()
 
+	ds.stopMeter(instanceID)
+
 	ds.instancesLock.Lock()
 	i := ds.instances[instanceID]
 	delete(ds.instances, instanceID)
 	ds.instancesLock.Unlock()
 
+	// the instance may have gone with its tenant already
+	if i == nil {
+		return "", types.ErrInstanceNotFound
+	}
+
+	ds.PublishEvent(types.StreamEvent{
+		Type:       types.InstanceDeletedEvent,
+		TenantID:   i.TenantID,
+		InstanceID: instanceID,
+		NodeID:     i.NodeID,
+	})
+
 	ds.tenantsLock.Lock()
 	tenant := ds.tenants[i.TenantID]
-	delete(tenant.instances, instanceID)
 	if tenant != nil {
+		delete(tenant.instances, instanceID)
 		for name, val := range i.Usage {
 			for i := range tenant.Resources {
 				if tenant.Resources[i].Rname == name {
@@ -1141,6 +1833,14 @@ func (ds *Datastore) DeleteNode(nodeID string) error {
 	delete(ds.nodes, nodeID)
 	ds.nodesLock.Unlock()
 
+	ds.tenantsLock.Lock()
+	for _, t := range ds.tenants {
+		if t.cnciNodeID == nodeID {
+			t.cnciNodeID = ""
+		}
+	}
+	ds.tenantsLock.Unlock()
+
 	ds.nodeLastStatLock.Lock()
 	delete(ds.nodeLastStat, nodeID)
 	ds.nodeLastStatLock.Unlock()
@@ -1154,9 +1854,65 @@ func (ds *Datastore) HandleStats(stat payloads.Stat) error {
 		ds.addNodeStat(stat)
 	}
 
+	ds.recordNodeReport(stat)
+
 	return errors.Wrapf(ds.addInstanceStats(stat.Instances, stat.NodeUUID), "error updating stats")
 }
 
+// recordNodeReport remembers the instances listed in the statistics of
+// a node, statistics always list all the instances of the node.
+func (ds *Datastore) recordNodeReport(stat payloads.Stat) {
+	reported := make(map[string]types.InstanceState)
+	for _, i := range stat.Instances {
+		reported[i.InstanceUUID] = types.InstanceState(i.State)
+	}
+
+	ds.nodesLock.Lock()
+
+	n, ok := ds.nodes[stat.NodeUUID]
+	if !ok {
+		n = &node{}
+		n.ID = stat.NodeUUID
+		n.instances = make(map[string]*types.Instance)
+		ds.nodes[stat.NodeUUID] = n
+	}
+
+	n.reported = reported
+	n.reportedTime = time.Now()
+
+	ds.nodesLock.Unlock()
+}
+
+// GetNodeReports returns the instances each connected node listed in its
+// last statistics.
+func (ds *Datastore) GetNodeReports() []NodeReport {
+	var reports []NodeReport
+
+	ds.nodesLock.RLock()
+
+	for _, n := range ds.nodes {
+		if n.reported == nil {
+			continue
+		}
+
+		r := NodeReport{
+			NodeID:    n.ID,
+			Timestamp: n.reportedTime,
+			Instances: make(map[string]types.InstanceState),
+		}
+
+		for id, state := range n.reported {
+			r.Instances[id] = state
+		}
+
+		reports = append(reports, r)
+	}
+
+	ds.nodesLock.RUnlock()
+
+	return reports
+}
+
 // HandleTraceReport stores the provided trace data in the datastore.
 func (ds *Datastore) HandleTraceReport(trace payloads.Trace) error {
 	var err error
@@ -1190,6 +1946,15 @@ func (ds *Datastore) GetInstanceLastStats(nodeID string) types.CiaoServersStats
 	return serversStats
 }
 
+// GetInstanceLastStat retrieves the last stats received for an instance.
+func (ds *Datastore) GetInstanceLastStat(instanceID string) (types.CiaoServerStats, bool) {
+	ds.instanceLastStatLock.RLock()
+	stat, ok := ds.instanceLastStat[instanceID]
+	ds.instanceLastStatLock.RUnlock()
+
+	return stat, ok
+}
+
 // GetNodeLastStats retrieves the last nodes stats received for this node.
 // It returns it in a format suitable for the compute API.
 func (ds *Datastore) GetNodeLastStats() types.CiaoComputeNodes {
@@ -1331,6 +2096,8 @@ func reduceToZero(v int) int {
 }
 
 func (ds *Datastore) addInstanceStats(stats []payloads.InstanceStat, nodeID string) error {
+	transitions := make(map[string]types.InstanceTransition)
+
 	for index := range stats {
 		stat := stats[index]
 
@@ -1366,8 +2133,13 @@ func (ds *Datastore) addInstanceStats(stats []payloads.InstanceStat, nodeID stri
 		ds.instancesLock.Lock()
 		instance, ok := ds.instances[stat.InstanceUUID]
 		if ok {
-			instance.State = stat.State
+			state := types.InstanceState(stat.State)
 			instance.NodeID = nodeID
+			if state != instance.State && reportedTransition(instance.State, state) {
+				t := recordTransition(instance, state)
+				transitions[instance.ID] = t
+				ds.publishTransition(instance, t)
+			}
 			instance.SSHIP = stat.SSHIP
 			instance.SSHPort = stat.SSHPort
 			ds.nodesLock.Lock()
@@ -1376,12 +2148,76 @@ func (ds *Datastore) addInstanceStats(stats []payloads.InstanceStat, nodeID stri
 		}
 		ds.instancesLock.Unlock()
 
+		if ok {
+			ds.meterInstance(instance, stat, instanceStat.Timestamp)
+		} else {
+			ds.updateCNCINode(stat.InstanceUUID, nodeID)
+		}
+
 		ds.updateStorageAttachments(stat.InstanceUUID, stat.Volumes)
 	}
 
+	for instanceID, t := range transitions {
+		err := ds.db.addInstanceTransition(instanceID, t)
+		if err != nil {
+			glog.Warningf("error adding transition of instance (%v): %v", instanceID, err)
+		}
+	}
+
 	return errors.Wrapf(ds.db.addInstanceStats(stats, nodeID), "error adding instance stats to database")
 }
 
+// updateCNCINode records the node a tenant CNCI is running on.
+func (ds *Datastore) updateCNCINode(instanceID string, nodeID string) {
+	ds.tenantsLock.Lock()
+	defer ds.tenantsLock.Unlock()
+
+	for _, t := range ds.tenants {
+		if t.CNCIID == instanceID {
+			t.cnciNodeID = nodeID
+			return
+		}
+	}
+}
+
+// GetNodeCNCIs retrieves information about the tenant CNCIs which last
+// reported statistics from the given node.
+func (ds *Datastore) GetNodeCNCIs(nodeID string) []types.TenantCNCI {
+	var cncis []types.TenantCNCI
+
+	ds.tenantsLock.RLock()
+	defer ds.tenantsLock.RUnlock()
+
+	for _, t := range ds.tenants {
+		if t.CNCIID == "" || t.cnciNodeID != nodeID {
+			continue
+		}
+
+		cncis = append(cncis, types.TenantCNCI{
+			TenantID:   t.ID,
+			IPAddress:  t.CNCIIP,
+			MACAddress: t.CNCIMAC,
+			InstanceID: t.CNCIID,
+		})
+	}
+
+	return cncis
+}
+
+// GetTenantCNCINode returns the node on which the CNCI of a tenant is
+// running, or the empty string if that is not known.
+func (ds *Datastore) GetTenantCNCINode(tenantID string) string {
+	ds.tenantsLock.RLock()
+	defer ds.tenantsLock.RUnlock()
+
+	t, ok := ds.tenants[tenantID]
+	if !ok {
+		return ""
+	}
+
+	return t.cnciNodeID
+}
+
 // GetTenantCNCISummary retrieves information about a given CNCI id, or all CNCIs
 // If the cnci string is the null string, then this function will retrieve all
 // tenants.  If cnci is not null, it will only provide information about a specific
@@ -1611,9 +2447,24 @@ func (ds *Datastore) CreateStorageAttachment(instanceID string, volume payloads.
 	ds.instanceVolumes[link] = a.ID
 	ds.attachLock.Unlock()
 
+	ds.publishAttachment(types.VolumeAttachedEvent, bd.TenantID, a)
+
 	return a, nil
 }
 
+// GetAllStorageAttachments returns all the storage attachments.
+func (ds *Datastore) GetAllStorageAttachments() []types.StorageAttachment {
+	var links []types.StorageAttachment
+
+	ds.attachLock.RLock()
+	for _, a := range ds.attachments {
+		links = append(links, a)
+	}
+	ds.attachLock.RUnlock()
+
+	return links
+}
+
 // GetStorageAttachments returns a list of volumes associated with this instance.
 func (ds *Datastore) GetStorageAttachments(instanceID string) []types.StorageAttachment {
 	var links []types.StorageAttachment
@@ -1678,6 +2529,8 @@ func (ds *Datastore) updateStorageAttachments(instanceID string, volumes []strin
 			if err != nil {
 				glog.Warningf("error updating block device (%v): %v", v, err)
 			}
+
+			ds.publishAttachment(types.VolumeAttachedEvent, bd.TenantID, a)
 		}
 	}
 
@@ -1700,6 +2553,8 @@ func (ds *Datastore) updateStorageAttachments(instanceID string, volumes []strin
 				glog.Warningf("error updating block device (%v): %v", a.BlockID, err)
 			}
 
+			ds.publishAttachment(types.VolumeDetachedEvent, bd.TenantID, a)
+
 			// delete the attachment.
 			key := attachment{
 				instanceID: a.InstanceID,
@@ -1761,6 +2616,10 @@ func (ds *Datastore) DeleteStorageAttachment(ID string) error {
 		return ErrNoStorageAttachment
 	}
 
+	if bd, err := ds.GetBlockDevice(a.BlockID); err == nil {
+		ds.publishAttachment(types.VolumeDetachedEvent, bd.TenantID, a)
+	}
+
 	return errors.Wrapf(ds.db.deleteStorageAttachment(ID), "error deleting storage attachment (%v) from database", ID)
 }
 
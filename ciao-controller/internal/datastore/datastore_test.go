@@ -21,6 +21,7 @@ import (
 	"encoding/binary"
 	"flag"
 	"fmt"
+	"math"
 	"net"
 	"os"
 	"reflect"
@@ -581,6 +582,63 @@ func TestHandleStats(t *testing.T) {
 	}
 }
 
+func TestNodeCNCIs(t *testing.T) {
+	tenant, err := addTestTenant()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cnciID := uuid.Generate().String()
+	err = ds.AddTenantCNCI(tenant.ID, cnciID, tenant.CNCIMAC)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ds.GetTenantCNCINode(tenant.ID) != "" {
+		t.Fatal("CNCI node known before any stats")
+	}
+
+	stat := payloads.Stat{
+		NodeUUID:        uuid.Generate().String(),
+		MemTotalMB:      256,
+		MemAvailableMB:  256,
+		DiskTotalMB:     1024,
+		DiskAvailableMB: 1024,
+		Load:            20,
+		CpusOnline:      4,
+		NodeHostName:    "test",
+		Instances: []payloads.InstanceStat{
+			{
+				InstanceUUID: cnciID,
+				State:        payloads.ComputeStatusRunning,
+			},
+		},
+	}
+
+	err = ds.HandleStats(stat)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ds.GetTenantCNCINode(tenant.ID) != stat.NodeUUID {
+		t.Fatal("CNCI node not recorded")
+	}
+
+	cncis := ds.GetNodeCNCIs(stat.NodeUUID)
+	if len(cncis) != 1 || cncis[0].TenantID != tenant.ID || cncis[0].InstanceID != cnciID {
+		t.Fatalf("unexpected node CNCIs %v", cncis)
+	}
+
+	err = ds.DeleteNode(stat.NodeUUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ds.GetTenantCNCINode(tenant.ID) != "" || len(ds.GetNodeCNCIs(stat.NodeUUID)) != 0 {
+		t.Fatal("CNCI still on deleted node")
+	}
+}
+
 func TestGetInstanceLastStats(t *testing.T) {
 	tenant, err := addTestTenant()
 	if err != nil {
@@ -1206,522 +1264,554 @@ func TestGetWorkload(t *testing.T) {
 	ds.workloadsLock.Unlock()
 }
 
-func TestRestartFailure(t *testing.T) {
+func TestUpdateDeleteWorkload(t *testing.T) {
 	tenant, err := addTestTenant()
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	wls, err := ds.GetWorkloads()
+	wl := types.Workload{
+		ID:          uuid.Generate().String(),
+		Description: "test workload",
+		FWType:      string(payloads.EFI),
+		VMType:      payloads.QEMU,
+		ImageName:   "test image",
+		Config:      "#cloud-config\n",
+		Defaults: []payloads.RequestedResource{
+			{Type: payloads.VCPUs, Value: 2},
+		},
+		TenantID:   tenant.ID,
+		Visibility: types.Private,
+	}
+
+	err = ds.UpdateWorkload(wl)
+	if err != types.ErrWorkloadNotFound {
+		t.Fatal("update of unknown workload allowed")
+	}
+
+	err = ds.AddWorkload(wl)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	instance, err := addTestInstance(tenant, wls[0])
+	wl.Description = "updated workload"
+	wl.Defaults = []payloads.RequestedResource{
+		{Type: payloads.VCPUs, Value: 4},
+		{Type: payloads.MemMB, Value: 256},
+	}
+
+	err = ds.UpdateWorkload(wl)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	reason := payloads.RestartNoInstance
+	// check the update made it to the database
+	ds.workloadsLock.Lock()
+	delete(ds.workloads, wl.ID)
+	ds.workloadsLock.Unlock()
 
-	err = ds.RestartFailure(instance.ID, reason)
+	work, err := ds.getWorkload(wl.ID)
 	if err != nil {
 		t.Fatal(err)
 	}
-}
 
-func TestStopFailure(t *testing.T) {
-	tenant, err := addTestTenant()
+	if work.Description != wl.Description || len(work.Defaults) != 2 ||
+		work.TenantID != tenant.ID || work.Visibility != types.Private {
+		t.Fatalf("workload not updated: %v", work.Workload)
+	}
+
+	ds.workloadsLock.Lock()
+	ds.workloads[wl.ID] = work
+	ds.workloadsLock.Unlock()
+
+	instance, err := addTestInstance(tenant, &wl)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	wls, err := ds.GetWorkloads()
+	err = ds.DeleteWorkload(wl.ID)
+	if err != types.ErrWorkloadInUse {
+		t.Fatal("delete of workload in use allowed")
+	}
+
+	err = ds.DeleteInstance(instance.ID)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	instance, err := addTestInstance(tenant, wls[0])
+	err = ds.DeleteWorkload(wl.ID)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	reason := payloads.StopNoInstance
+	_, err = ds.GetWorkload(wl.ID)
+	if err == nil {
+		t.Fatal("workload not deleted")
+	}
 
-	err = ds.StopFailure(instance.ID, reason)
-	if err != nil {
-		t.Fatal(err)
+	err = ds.DeleteWorkload(wl.ID)
+	if err != types.ErrWorkloadNotFound {
+		t.Fatal("delete of unknown workload allowed")
 	}
 }
 
-func TestStartFailureFullCloud(t *testing.T) {
+func TestUpdateWorkloadSharedConfig(t *testing.T) {
 	tenant, err := addTestTenant()
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	wls, err := ds.GetWorkloads()
-	if err != nil {
-		t.Fatal(err)
+	wl := types.Workload{
+		ID:          uuid.Generate().String(),
+		Description: "test workload",
+		FWType:      string(payloads.EFI),
+		VMType:      payloads.QEMU,
+		ImageName:   "test image",
+		Config:      "#cloud-config\n",
+		Defaults: []payloads.RequestedResource{
+			{Type: payloads.VCPUs, Value: 2},
+		},
+		TenantID:   tenant.ID,
+		Visibility: types.Private,
 	}
 
-	instance, err := addTestInstance(tenant, wls[0])
+	err = ds.AddWorkload(wl)
 	if err != nil {
 		t.Fatal(err)
 	}
+	defer ds.DeleteWorkload(wl.ID)
 
-	tenantBefore, err := ds.GetTenant(tenant.ID)
-	if err != nil {
-		t.Fatal(err)
+	// add a second workload sharing the config file of the first one,
+	// as the workloads loaded from the CSV files do.
+	shared := fmt.Sprintf("%s_config.yaml", wl.ID)
+	other := workload{
+		Workload: wl,
+		filename: shared,
 	}
+	other.ID = uuid.Generate().String()
 
-	resourcesBefore := make(map[string]int)
-	for i := range tenantBefore.Resources {
-		r := tenantBefore.Resources[i]
-		resourcesBefore[r.Rname] = r.Usage
+	err = ds.db.updateWorkload(other)
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	reason := payloads.FullCloud
+	ds.workloadsLock.Lock()
+	ds.workloads[other.ID] = &other
+	ds.workloadsLock.Unlock()
+	defer ds.DeleteWorkload(other.ID)
 
-	err = ds.StartFailure(instance.ID, reason)
+	other.Config = "#cloud-config\nhostname: other\n"
+	err = ds.UpdateWorkload(other.Workload)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	tenantAfter, err := ds.GetTenant(tenant.ID)
+	ds.workloadsLock.Lock()
+	delete(ds.workloads, other.ID)
+	ds.workloadsLock.Unlock()
+
+	work, err := ds.getWorkload(other.ID)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	defaults := wls[0].Defaults
-
-	usage := make(map[string]int)
-	for i := range defaults {
-		usage[string(defaults[i].Type)] = defaults[i].Value
+	if work.filename != fmt.Sprintf("%s_config.yaml", other.ID) || work.Config != other.Config {
+		t.Fatalf("workload config not updated: %s %s", work.filename, work.Config)
 	}
 
-	resourcesAfter := make(map[string]int)
-	for i := range tenantAfter.Resources {
-		r := tenantAfter.Resources[i]
-		resourcesAfter[r.Rname] = r.Usage
+	ds.workloadsLock.Lock()
+	ds.workloads[other.ID] = work
+	ds.workloadsLock.Unlock()
+}
+
+func getQuota(t *testing.T, tenantID string, name string) types.QuotaDetails {
+	quotas, err := ds.GetQuotas(tenantID)
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	// make sure usage was reduced by workload defaults values
-	for name, val := range resourcesAfter {
-		before := resourcesBefore[name]
-		delta := usage[name]
+	if len(quotas) != len(types.QuotaNames) {
+		t.Fatalf("expected %d quotas, got %d", len(types.QuotaNames), len(quotas))
+	}
 
-		if name == "instances" {
-			if val != before-1 {
-				t.Fatal("instances not decremented")
-			}
-		} else if val != before-delta {
-			t.Fatal("usage not reduced")
+	for _, q := range quotas {
+		if q.Name == name {
+			return q
 		}
 	}
+
+	t.Fatalf("quota %s not found", name)
+	return types.QuotaDetails{}
 }
 
-func TestAttachVolumeFailure(t *testing.T) {
-	newTenant, err := addTestTenant()
+func TestQuotas(t *testing.T) {
+	tenant, err := addTestTenant()
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	// add test instances
-	wls, err := ds.GetWorkloads()
+	q := getQuota(t, tenant.ID, types.InstancesQuota)
+	if q.Value != -1 || q.Usage != 0 {
+		t.Fatalf("unexpected default quota %v", q)
+	}
+
+	quotas := []types.QuotaDetails{{Name: types.InstancesQuota, Value: 1}}
+	err = ds.UpdateQuotas(tenant.ID, quotas)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	instance, err := addTestInstance(newTenant, wls[0])
+	q = getQuota(t, tenant.ID, types.InstancesQuota)
+	if q.Value != 1 {
+		t.Fatalf("quota not updated: %v", q)
+	}
+
+	over, err := ds.OverQuota(tenant.ID, types.InstancesQuota, 1)
+	if err != nil || over {
+		t.Fatal("first instance over quota")
+	}
+
+	wls, err := ds.GetWorkloads()
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	// add test block data
-	blockDevice := storage.BlockDevice{
-		ID: "validID",
+	instance, err := addTestInstance(tenant, wls[0])
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	data := types.BlockData{
-		BlockDevice: blockDevice,
-		State:       types.Available,
-		TenantID:    newTenant.ID,
-		CreateTime:  time.Now(),
+	over, err = ds.OverQuota(tenant.ID, types.InstancesQuota, 1)
+	if err != nil || !over {
+		t.Fatal("second instance not over quota")
 	}
 
-	err = ds.AddBlockDevice(data)
+	err = ds.DeleteInstance(instance.ID)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	// update block data to indicate it is attaching
-	data.State = types.Attaching
+	quotas = []types.QuotaDetails{
+		{Name: types.VolumesQuota, Value: 0},
+		{Name: "unknown", Value: 1},
+	}
+	err = ds.UpdateQuotas(tenant.ID, quotas)
+	if err != types.ErrUnknownQuota {
+		t.Fatal("unknown quota accepted")
+	}
 
-	err = ds.UpdateBlockDevice(data)
+	q = getQuota(t, tenant.ID, types.VolumesQuota)
+	if q.Value != -1 {
+		t.Fatal("quota updated by rejected request")
+	}
+
+	quotas = []types.QuotaDetails{{Name: types.InstancesQuota, Value: -10}}
+	err = ds.UpdateQuotas(tenant.ID, quotas)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	// pretend we got a failure to attach.
-	ds.AttachVolumeFailure(instance.ID, data.ID, payloads.AttachVolumeAlreadyAttached)
+	q = getQuota(t, tenant.ID, types.InstancesQuota)
+	if q.Value != -1 {
+		t.Fatalf("negative quota not unlimited: %v", q)
+	}
 
-	// make sure state has been switched to Available again.
-	bd, err := ds.GetBlockDevice(data.ID)
+	quotas = []types.QuotaDetails{{Name: types.ShareWeightQuota, Value: 4}}
+	err = ds.UpdateQuotas(tenant.ID, quotas)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if bd.State != types.Available {
-		t.Fatalf("expected state: %s, got %s\n", types.Available, bd.State)
+	q = getQuota(t, tenant.ID, types.ShareWeightQuota)
+	if q.Value != 4 || q.Usage != 0 {
+		t.Fatalf("share weight not updated: %v", q)
+	}
+
+	_, err = ds.GetQuotas(uuid.Generate().String())
+	if err != types.ErrTenantNotFound {
+		t.Fatal("quotas of unknown tenant returned")
 	}
 }
 
-func TestDetachVolumeFailure(t *testing.T) {
-	newTenant, err := addTestTenant()
+func TestDeleteTenant(t *testing.T) {
+	tenant, err := addTestTenant()
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	// add test instances
 	wls, err := ds.GetWorkloads()
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	instance, err := addTestInstance(newTenant, wls[0])
+	instance, err := addTestInstance(tenant, wls[0])
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	// add test block data
-	blockDevice := storage.BlockDevice{
-		ID: "validID",
+	err = ds.DeleteTenant(tenant.ID)
+	if err != types.ErrTenantInUse {
+		t.Fatal("delete of tenant in use allowed")
 	}
 
-	data := types.BlockData{
-		BlockDevice: blockDevice,
-		State:       types.Available,
-		TenantID:    newTenant.ID,
-		CreateTime:  time.Now(),
+	err = ds.DeleteInstance(instance.ID)
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	err = ds.AddBlockDevice(data)
+	err = ds.DeleteTenant(tenant.ID)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	// update block data to indicate it is detaching
-	data.State = types.Detaching
+	t2, err := ds.GetTenant(tenant.ID)
+	if err != nil || t2 != nil {
+		t.Fatal("tenant not deleted")
+	}
 
-	err = ds.UpdateBlockDevice(data)
-	if err != nil {
-		t.Fatal(err)
+	err = ds.DeleteTenant(tenant.ID)
+	if err != types.ErrTenantNotFound {
+		t.Fatal("delete of unknown tenant allowed")
 	}
+}
 
-	// pretend we got a failure to attach.
-	err = ds.DetachVolumeFailure(instance.ID, data.ID, payloads.DetachVolumeNotAttached)
-	if err != nil {
-		t.Fatal(err)
+func reportInstanceState(t *testing.T, instance *types.Instance, nodeID string, state types.InstanceState) {
+	stats := []payloads.InstanceStat{
+		{
+			InstanceUUID: instance.ID,
+			State:        string(state),
+		},
 	}
 
-	// make sure state has been switched to InUse again.
-	bd, err := ds.GetBlockDevice(data.ID)
+	err := ds.addNodeStat(payloads.Stat{NodeUUID: nodeID, Instances: stats})
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if bd.State != types.InUse {
-		t.Fatalf("expected state: %s, got %s\n", types.InUse, bd.State)
+	err = ds.addInstanceStats(stats, nodeID)
+	if err != nil {
+		t.Fatal(err)
 	}
 }
 
-func testAllocateTenantIPs(t *testing.T, nIPs int) {
-	nIPsPerSubnet := 253
-
-	newTenant, err := addTestTenant()
+func TestInstanceTransitions(t *testing.T) {
+	tenant, err := addTestTenant()
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	// make this tenant have some network hosts assigned to them.
-	for n := 0; n < nIPs; n++ {
-		_, err = ds.AllocateTenantIP(newTenant.ID)
-		if err != nil {
-			t.Fatal(err)
-		}
+	wls, err := ds.GetWorkloads()
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	// get private tenant type
-	tenant, err := ds.getTenant(newTenant.ID)
+	instance, err := addTestInstance(tenant, wls[0])
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if len(tenant.subnets) != (nIPs/nIPsPerSubnet)+1 {
-		t.Fatal("Too many subnets created")
-	}
+	nodeID := uuid.Generate().String()
 
-	for i, subnet := range tenant.subnets {
-		if ((i + 1) * nIPsPerSubnet) < nIPs {
-			if len(tenant.network[subnet]) != nIPsPerSubnet {
-				t.Fatal("Missing IPs")
-			}
-		} else {
-			if len(tenant.network[subnet]) != nIPs%nIPsPerSubnet {
-				t.Fatal("Missing IPs")
-			}
-		}
+	err = ds.TransitionInstance(instance.ID, types.InstanceStopping)
+	if _, ok := err.(*types.TransitionError); !ok {
+		t.Fatalf("pending instance stopped: %v", err)
 	}
-}
 
-func TestAllocate100IPs(t *testing.T) {
-	testAllocateTenantIPs(t, 100)
-}
+	err = ds.TransitionInstance(instance.ID, types.InstanceDeleting)
+	if _, ok := err.(*types.TransitionError); !ok {
+		t.Fatalf("pending instance deleted: %v", err)
+	}
 
-func TestAllocate1024IPs(t *testing.T) {
-	testAllocateTenantIPs(t, 1024)
-}
+	reportInstanceState(t, instance, nodeID, types.InstanceRunning)
 
-func TestAddBlockDevice(t *testing.T) {
-	newTenant, err := addTestTenant()
+	err = ds.TransitionInstance(instance.ID, types.InstanceStopping)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	blockDevice := storage.BlockDevice{
-		ID: "validID",
+	// launcher may report the instance running until it is stopped
+	reportInstanceState(t, instance, nodeID, types.InstanceRunning)
+	if instance.State != types.InstanceStopping {
+		t.Fatalf("expected state %s, got %s", types.InstanceStopping, instance.State)
 	}
 
-	data := types.BlockData{
-		BlockDevice: blockDevice,
-		State:       types.Available,
-		TenantID:    newTenant.ID,
-		CreateTime:  time.Now(),
-	}
+	reportInstanceState(t, instance, nodeID, types.InstanceExited)
 
-	err = ds.AddBlockDevice(data)
+	err = ds.TransitionInstance(instance.ID, types.InstanceRestarting)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	// confirm that we can retrieve the block data.
-	_, err = ds.GetBlockDevice("validID")
+	err = ds.RestartFailure(instance.ID, payloads.RestartLaunchFailure)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	// confirm that this is associate with our tenant.
-	devices, err := ds.GetBlockDevices(newTenant.ID)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	for _, d := range devices {
-		if d.ID != "validID" {
-			t.Fatal(err)
-		}
+	expected := []types.InstanceState{
+		types.InstancePending,
+		types.InstanceRunning,
+		types.InstanceStopping,
+		types.InstanceExited,
+		types.InstanceRestarting,
+		types.InstanceExited,
 	}
-}
 
-func TestDeleteBlockDevice(t *testing.T) {
-	newTenant, err := addTestTenant()
+	i, err := ds.GetInstance(instance.ID)
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
 	}
 
-	blockDevice := storage.BlockDevice{
-		ID: "validID",
+	if len(i.Transitions) != len(expected) {
+		t.Fatalf("expected %d transitions, got %v", len(expected), i.Transitions)
 	}
 
-	data := types.BlockData{
-		BlockDevice: blockDevice,
-		State:       types.Available,
-		TenantID:    newTenant.ID,
-		CreateTime:  time.Now(),
+	from := types.InstanceState("")
+	for n, tr := range i.Transitions {
+		if tr.From != from || tr.To != expected[n] {
+			t.Fatalf("unexpected transition %d: %v", n, tr)
+		}
+		from = tr.To
 	}
 
-	err = ds.AddBlockDevice(data)
+	err = ds.DeleteInstance(instance.ID)
 	if err != nil {
 		t.Fatal(err)
 	}
+}
 
-	// confirm that we can retrieve the block data.
-	_, err = ds.GetBlockDevice("validID")
+func TestRestartFailure(t *testing.T) {
+	tenant, err := addTestTenant()
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	// remove the block device
-	err = ds.DeleteBlockDevice(data.ID)
+	wls, err := ds.GetWorkloads()
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	// confirm that it is no longer there.
-	_, err = ds.GetBlockDevice(data.ID)
-	if err == nil {
-		t.Fatal("Did not delete block device")
-	}
-
-	// attempt to delete a non-existing block device
-	err = ds.DeleteBlockDevice("unknownID")
-	if err != ErrNoBlockData {
-		t.Fatalf("expecting %s error, received %s\n", ErrNoBlockData, err)
-	}
-}
-
-func TestUpdateBlockDevice(t *testing.T) {
-	newTenant, err := addTestTenant()
+	instance, err := addTestInstance(tenant, wls[0])
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	blockDevice := storage.BlockDevice{
-		ID: uuid.Generate().String(),
-	}
-
-	data := types.BlockData{
-		BlockDevice: blockDevice,
-		State:       types.Available,
-		TenantID:    newTenant.ID,
-		CreateTime:  time.Now(),
-	}
+	reason := payloads.RestartNoInstance
 
-	err = ds.AddBlockDevice(data)
+	err = ds.RestartFailure(instance.ID, reason)
 	if err != nil {
 		t.Fatal(err)
 	}
+}
 
-	// confirm that we can retrieve the block data.
-	_, err = ds.GetBlockDevice(blockDevice.ID)
+func TestStopFailure(t *testing.T) {
+	tenant, err := addTestTenant()
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	// update the state of the block device.
-	data.State = types.Attaching
-
-	err = ds.UpdateBlockDevice(data)
+	wls, err := ds.GetWorkloads()
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	// confirm that we can retrieve the block data.
-	d, err := ds.GetBlockDevice(blockDevice.ID)
+	instance, err := addTestInstance(tenant, wls[0])
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if d.State != types.Attaching {
-		t.Fatalf("expected State == %s, got %s\n", types.Attaching, d.State)
-	}
-}
+	reason := payloads.StopNoInstance
 
-func TestGetBlockDevicesErr(t *testing.T) {
-	// confirm that sending a bad tenant id results in error
-	_, err := ds.GetBlockDevices("badID")
-	if err != ErrNoTenant {
+	err = ds.StopFailure(instance.ID, reason)
+	if err != nil {
 		t.Fatal(err)
 	}
 }
 
-func TestGetBlockDeviceErr(t *testing.T) {
-	// confirm that we get the correct error for missing id
-	_, err := ds.GetBlockDevice("badID")
-	if err != ErrNoBlockData {
+func TestStartFailureFullCloud(t *testing.T) {
+	tenant, err := addTestTenant()
+	if err != nil {
 		t.Fatal(err)
 	}
-}
 
-func TestUpdateBlockDeviceErr(t *testing.T) {
-	newTenant, err := addTestTenant()
+	wls, err := ds.GetWorkloads()
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	blockDevice := storage.BlockDevice{
-		ID: uuid.Generate().String(),
-	}
-
-	data := types.BlockData{
-		BlockDevice: blockDevice,
-		State:       types.Available,
-		TenantID:    newTenant.ID,
-		CreateTime:  time.Now(),
-	}
-
-	// confirm that we get the correct error for missing id
-	err = ds.UpdateBlockDevice(data)
-	if err != ErrNoBlockData {
+	instance, err := addTestInstance(tenant, wls[0])
+	if err != nil {
 		t.Fatal(err)
 	}
-}
 
-func TestCreateStorageAttachment(t *testing.T) {
-	tenant, err := addTestTenant()
+	tenantBefore, err := ds.GetTenant(tenant.ID)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	blockDevice := storage.BlockDevice{
-		ID: "validID",
+	resourcesBefore := make(map[string]int)
+	for i := range tenantBefore.Resources {
+		r := tenantBefore.Resources[i]
+		resourcesBefore[r.Rname] = r.Usage
 	}
 
-	data := types.BlockData{
-		BlockDevice: blockDevice,
-		State:       types.Available,
-		TenantID:    tenant.ID,
-		CreateTime:  time.Now(),
-	}
+	reason := payloads.FullCloud
 
-	err = ds.AddBlockDevice(data)
+	err = ds.StartFailure(instance.ID, reason)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	wls, err := ds.GetWorkloads()
+	tenantAfter, err := ds.GetTenant(tenant.ID)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if len(wls) == 0 {
-		t.Fatal("No Workloads Found")
-	}
+	defaults := wls[0].Defaults
 
-	instance, err := addTestInstance(tenant, wls[0])
-	if err != nil {
-		t.Fatal(err)
+	usage := make(map[string]int)
+	for i := range defaults {
+		usage[string(defaults[i].Type)] = defaults[i].Value
 	}
 
-	volume := payloads.StorageResource{
-		ID:        data.ID,
-		Ephemeral: false,
-		Bootable:  false,
-	}
-	_, err = ds.CreateStorageAttachment(instance.ID, volume)
-	if err != nil {
-		t.Fatal(err)
+	resourcesAfter := make(map[string]int)
+	for i := range tenantAfter.Resources {
+		r := tenantAfter.Resources[i]
+		resourcesAfter[r.Rname] = r.Usage
 	}
 
-	// get the attachments associated with this instance
-	a1 := ds.GetStorageAttachments(instance.ID)
+	// make sure usage was reduced by workload defaults values
+	for name, val := range resourcesAfter {
+		before := resourcesBefore[name]
+		delta := usage[name]
 
-	if len(a1) != 1 {
+		if name == "instances" {
+			if val != before-1 {
+				t.Fatal("instances not decremented")
+			}
+		} else if val != before-delta {
+			t.Fatal("usage not reduced")
+		}
+	}
+}
+
+func TestAttachVolumeFailure(t *testing.T) {
+	newTenant, err := addTestTenant()
+	if err != nil {
 		t.Fatal(err)
 	}
 
-	if a1[0].InstanceID != instance.ID {
+	// add test instances
+	wls, err := ds.GetWorkloads()
+	if err != nil {
 		t.Fatal(err)
 	}
-}
 
-func TestUpdateStorageAttachmentExisting(t *testing.T) {
-	tenant, err := addTestTenant()
+	instance, err := addTestInstance(newTenant, wls[0])
 	if err != nil {
 		t.Fatal(err)
 	}
 
+	// add test block data
 	blockDevice := storage.BlockDevice{
 		ID: "validID",
 	}
@@ -1729,7 +1819,7 @@ func TestUpdateStorageAttachmentExisting(t *testing.T) {
 	data := types.BlockData{
 		BlockDevice: blockDevice,
 		State:       types.Available,
-		TenantID:    tenant.ID,
+		TenantID:    newTenant.ID,
 		CreateTime:  time.Now(),
 	}
 
@@ -1738,54 +1828,46 @@ func TestUpdateStorageAttachmentExisting(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	wls, err := ds.GetWorkloads()
+	// update block data to indicate it is attaching
+	data.State = types.Attaching
+
+	err = ds.UpdateBlockDevice(data)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if len(wls) == 0 {
-		t.Fatal("No Workloads Found")
-	}
+	// pretend we got a failure to attach.
+	ds.AttachVolumeFailure(instance.ID, data.ID, payloads.AttachVolumeAlreadyAttached)
 
-	instance, err := addTestInstance(tenant, wls[0])
+	// make sure state has been switched to Available again.
+	bd, err := ds.GetBlockDevice(data.ID)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	volume := payloads.StorageResource{
-		ID:        data.ID,
-		Ephemeral: false,
-		Bootable:  false,
-	}
-	_, err = ds.CreateStorageAttachment(instance.ID, volume)
-	if err != nil {
-		t.Fatal(err)
+	if bd.State != types.Available {
+		t.Fatalf("expected state: %s, got %s\n", types.Available, bd.State)
 	}
+}
 
-	// get the attachments associated with this instance
-	a1 := ds.GetStorageAttachments(instance.ID)
-
-	if len(a1) != 1 {
+func TestDetachVolumeFailure(t *testing.T) {
+	newTenant, err := addTestTenant()
+	if err != nil {
 		t.Fatal(err)
 	}
 
-	if a1[0].InstanceID != instance.ID {
+	// add test instances
+	wls, err := ds.GetWorkloads()
+	if err != nil {
 		t.Fatal(err)
 	}
 
-	attachments := []string{data.ID}
-
-	// this doesn't return an error, but we can still exercise
-	// the code to see if anything panics.
-	ds.updateStorageAttachments(instance.ID, attachments)
-}
-
-func TestUpdateStorageAttachmentNotExisting(t *testing.T) {
-	tenant, err := addTestTenant()
+	instance, err := addTestInstance(newTenant, wls[0])
 	if err != nil {
 		t.Fatal(err)
 	}
 
+	// add test block data
 	blockDevice := storage.BlockDevice{
 		ID: "validID",
 	}
@@ -1793,7 +1875,7 @@ func TestUpdateStorageAttachmentNotExisting(t *testing.T) {
 	data := types.BlockData{
 		BlockDevice: blockDevice,
 		State:       types.Available,
-		TenantID:    tenant.ID,
+		TenantID:    newTenant.ID,
 		CreateTime:  time.Now(),
 	}
 
@@ -1802,83 +1884,80 @@ func TestUpdateStorageAttachmentNotExisting(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	wls, err := ds.GetWorkloads()
+	// update block data to indicate it is detaching
+	data.State = types.Detaching
+
+	err = ds.UpdateBlockDevice(data)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if len(wls) == 0 {
-		t.Fatal("No Workloads Found")
-	}
-
-	instance, err := addTestInstance(tenant, wls[0])
+	// pretend we got a failure to attach.
+	err = ds.DetachVolumeFailure(instance.ID, data.ID, payloads.DetachVolumeNotAttached)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	attachments := []string{data.ID}
-
-	// this doesn't return an error, but we can still exercise
-	// the code to see if anything panics.
-	ds.updateStorageAttachments(instance.ID, attachments)
-}
-
-func TestUpdateStorageAttachmentDeleted(t *testing.T) {
-	tenant, err := addTestTenant()
+	// make sure state has been switched to InUse again.
+	bd, err := ds.GetBlockDevice(data.ID)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	blockDevice := storage.BlockDevice{
-		ID: "validID",
-	}
-
-	data := types.BlockData{
-		BlockDevice: blockDevice,
-		State:       types.Available,
-		TenantID:    tenant.ID,
-		CreateTime:  time.Now(),
+	if bd.State != types.InUse {
+		t.Fatalf("expected state: %s, got %s\n", types.InUse, bd.State)
 	}
+}
 
-	err = ds.AddBlockDevice(data)
-	if err != nil {
-		t.Fatal(err)
-	}
+func testAllocateTenantIPs(t *testing.T, nIPs int) {
+	nIPsPerSubnet := 253
 
-	wls, err := ds.GetWorkloads()
+	newTenant, err := addTestTenant()
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if len(wls) == 0 {
-		t.Fatal("No Workloads Found")
+	// make this tenant have some network hosts assigned to them.
+	for n := 0; n < nIPs; n++ {
+		_, err = ds.AllocateTenantIP(newTenant.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
 	}
 
-	instance, err := addTestInstance(tenant, wls[0])
+	// get private tenant type
+	tenant, err := ds.getTenant(newTenant.ID)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	volume := payloads.StorageResource{
-		ID:        data.ID,
-		Ephemeral: false,
-		Bootable:  false,
+	if len(tenant.subnets) != (nIPs/nIPsPerSubnet)+1 {
+		t.Fatal("Too many subnets created")
 	}
-	_, err = ds.CreateStorageAttachment(instance.ID, volume)
-	if err != nil {
-		t.Fatal(err)
+
+	for i, subnet := range tenant.subnets {
+		if ((i + 1) * nIPsPerSubnet) < nIPs {
+			if len(tenant.network[subnet]) != nIPsPerSubnet {
+				t.Fatal("Missing IPs")
+			}
+		} else {
+			if len(tenant.network[subnet]) != nIPs%nIPsPerSubnet {
+				t.Fatal("Missing IPs")
+			}
+		}
 	}
+}
 
-	attachments := []string{}
+func TestAllocate100IPs(t *testing.T) {
+	testAllocateTenantIPs(t, 100)
+}
 
-	// this doesn't return an error, but we can still exercise
-	// the code to see if anything panics.
-	// send in an empty list.
-	ds.updateStorageAttachments(instance.ID, attachments)
+func TestAllocate1024IPs(t *testing.T) {
+	testAllocateTenantIPs(t, 1024)
 }
 
-func TestGetStorageAttachment(t *testing.T) {
-	tenant, err := addTestTenant()
+func TestAddBlockDevice(t *testing.T) {
+	newTenant, err := addTestTenant()
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -1890,7 +1969,7 @@ func TestGetStorageAttachment(t *testing.T) {
 	data := types.BlockData{
 		BlockDevice: blockDevice,
 		State:       types.Available,
-		TenantID:    tenant.ID,
+		TenantID:    newTenant.ID,
 		CreateTime:  time.Now(),
 	}
 
@@ -1899,54 +1978,86 @@ func TestGetStorageAttachment(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	wls, err := ds.GetWorkloads()
+	// confirm that we can retrieve the block data.
+	_, err = ds.GetBlockDevice("validID")
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if len(wls) == 0 {
-		t.Fatal("No Workloads Found")
+	// confirm that this is associate with our tenant.
+	devices, err := ds.GetBlockDevices(newTenant.ID)
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	instance, err := addTestInstance(tenant, wls[0])
+	for _, d := range devices {
+		if d.ID != "validID" {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDeleteBlockDevice(t *testing.T) {
+	newTenant, err := addTestTenant()
 	if err != nil {
-		t.Fatal(err)
+		t.Error(err)
 	}
 
-	volume := payloads.StorageResource{
-		ID:        data.ID,
-		Ephemeral: false,
-		Bootable:  false,
+	blockDevice := storage.BlockDevice{
+		ID: "validID",
 	}
-	_, err = ds.CreateStorageAttachment(instance.ID, volume)
+
+	data := types.BlockData{
+		BlockDevice: blockDevice,
+		State:       types.Available,
+		TenantID:    newTenant.ID,
+		CreateTime:  time.Now(),
+	}
+
+	err = ds.AddBlockDevice(data)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	a, err := ds.getStorageAttachment(instance.ID, data.ID)
+	// confirm that we can retrieve the block data.
+	_, err = ds.GetBlockDevice("validID")
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if a.InstanceID != instance.ID || a.BlockID != data.ID {
+	// remove the block device
+	err = ds.DeleteBlockDevice(data.ID)
+	if err != nil {
 		t.Fatal(err)
 	}
+
+	// confirm that it is no longer there.
+	_, err = ds.GetBlockDevice(data.ID)
+	if err == nil {
+		t.Fatal("Did not delete block device")
+	}
+
+	// attempt to delete a non-existing block device
+	err = ds.DeleteBlockDevice("unknownID")
+	if err != ErrNoBlockData {
+		t.Fatalf("expecting %s error, received %s\n", ErrNoBlockData, err)
+	}
 }
 
-func TestGetStorageAttachmentError(t *testing.T) {
-	tenant, err := addTestTenant()
+func TestUpdateBlockDevice(t *testing.T) {
+	newTenant, err := addTestTenant()
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	blockDevice := storage.BlockDevice{
-		ID: "validID",
+		ID: uuid.Generate().String(),
 	}
 
 	data := types.BlockData{
 		BlockDevice: blockDevice,
 		State:       types.Available,
-		TenantID:    tenant.ID,
+		TenantID:    newTenant.ID,
 		CreateTime:  time.Now(),
 	}
 
@@ -1955,27 +2066,72 @@ func TestGetStorageAttachmentError(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	wls, err := ds.GetWorkloads()
+	// confirm that we can retrieve the block data.
+	_, err = ds.GetBlockDevice(blockDevice.ID)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if len(wls) == 0 {
-		t.Fatal("No Workloads Found")
+	// update the state of the block device.
+	data.State = types.Attaching
+
+	err = ds.UpdateBlockDevice(data)
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	instance, err := addTestInstance(tenant, wls[0])
+	// confirm that we can retrieve the block data.
+	d, err := ds.GetBlockDevice(blockDevice.ID)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	_, err = ds.getStorageAttachment(instance.ID, data.ID)
-	if err != ErrNoStorageAttachment {
+	if d.State != types.Attaching {
+		t.Fatalf("expected State == %s, got %s\n", types.Attaching, d.State)
+	}
+}
+
+func TestGetBlockDevicesErr(t *testing.T) {
+	// confirm that sending a bad tenant id results in error
+	_, err := ds.GetBlockDevices("badID")
+	if err != ErrNoTenant {
 		t.Fatal(err)
 	}
 }
 
-func TestDeleteStorageAttachment(t *testing.T) {
+func TestGetBlockDeviceErr(t *testing.T) {
+	// confirm that we get the correct error for missing id
+	_, err := ds.GetBlockDevice("badID")
+	if err != ErrNoBlockData {
+		t.Fatal(err)
+	}
+}
+
+func TestUpdateBlockDeviceErr(t *testing.T) {
+	newTenant, err := addTestTenant()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blockDevice := storage.BlockDevice{
+		ID: uuid.Generate().String(),
+	}
+
+	data := types.BlockData{
+		BlockDevice: blockDevice,
+		State:       types.Available,
+		TenantID:    newTenant.ID,
+		CreateTime:  time.Now(),
+	}
+
+	// confirm that we get the correct error for missing id
+	err = ds.UpdateBlockDevice(data)
+	if err != ErrNoBlockData {
+		t.Fatal(err)
+	}
+}
+
+func TestCreateStorageAttachment(t *testing.T) {
 	tenant, err := addTestTenant()
 	if err != nil {
 		t.Fatal(err)
@@ -2021,27 +2177,19 @@ func TestDeleteStorageAttachment(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	a, err := ds.getStorageAttachment(instance.ID, data.ID)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	if a.InstanceID != instance.ID || a.BlockID != data.ID {
-		t.Fatal(err)
-	}
+	// get the attachments associated with this instance
+	a1 := ds.GetStorageAttachments(instance.ID)
 
-	err = ds.DeleteStorageAttachment(a.ID)
-	if err != nil {
+	if len(a1) != 1 {
 		t.Fatal(err)
 	}
 
-	_, err = ds.getStorageAttachment(instance.ID, data.ID)
-	if err != ErrNoStorageAttachment {
+	if a1[0].InstanceID != instance.ID {
 		t.Fatal(err)
 	}
 }
 
-func TestDeleteStorageAttachmentError(t *testing.T) {
+func TestUpdateStorageAttachmentExisting(t *testing.T) {
 	tenant, err := addTestTenant()
 	if err != nil {
 		t.Fatal(err)
@@ -2087,39 +2235,32 @@ func TestDeleteStorageAttachmentError(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	a, err := ds.getStorageAttachment(instance.ID, data.ID)
-	if err != nil {
-		t.Fatal(err)
-	}
+	// get the attachments associated with this instance
+	a1 := ds.GetStorageAttachments(instance.ID)
 
-	if a.InstanceID != instance.ID || a.BlockID != data.ID {
+	if len(a1) != 1 {
 		t.Fatal(err)
 	}
 
-	err = ds.DeleteStorageAttachment(a.ID)
-	if err != nil {
+	if a1[0].InstanceID != instance.ID {
 		t.Fatal(err)
 	}
 
-	_, err = ds.getStorageAttachment(instance.ID, data.ID)
-	if err != ErrNoStorageAttachment {
-		t.Fatal(err)
-	}
+	attachments := []string{data.ID}
 
-	err = ds.DeleteStorageAttachment(a.ID)
-	if err != ErrNoStorageAttachment {
-		t.Fatal(err)
-	}
+	// this doesn't return an error, but we can still exercise
+	// the code to see if anything panics.
+	ds.updateStorageAttachments(instance.ID, attachments)
 }
 
-func TestGetVolumeAttachments(t *testing.T) {
+func TestUpdateStorageAttachmentNotExisting(t *testing.T) {
 	tenant, err := addTestTenant()
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	blockDevice := storage.BlockDevice{
-		ID: uuid.Generate().String(),
+		ID: "validID",
 	}
 
 	data := types.BlockData{
@@ -2148,134 +2289,768 @@ func TestGetVolumeAttachments(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	volume := payloads.StorageResource{
-		ID:        data.ID,
-		Ephemeral: false,
-		Bootable:  false,
-	}
-	_, err = ds.CreateStorageAttachment(instance.ID, volume)
+	attachments := []string{data.ID}
+
+	// this doesn't return an error, but we can still exercise
+	// the code to see if anything panics.
+	ds.updateStorageAttachments(instance.ID, attachments)
+}
+
+func TestUpdateStorageAttachmentDeleted(t *testing.T) {
+	tenant, err := addTestTenant()
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	attachments, err := ds.GetVolumeAttachments(data.ID)
-	if err != nil {
-		t.Fatal(err)
+	blockDevice := storage.BlockDevice{
+		ID: "validID",
 	}
 
-	if len(attachments) != 1 {
+	data := types.BlockData{
+		BlockDevice: blockDevice,
+		State:       types.Available,
+		TenantID:    tenant.ID,
+		CreateTime:  time.Now(),
+	}
+
+	err = ds.AddBlockDevice(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wls, err := ds.GetWorkloads()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(wls) == 0 {
+		t.Fatal("No Workloads Found")
+	}
+
+	instance, err := addTestInstance(tenant, wls[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	volume := payloads.StorageResource{
+		ID:        data.ID,
+		Ephemeral: false,
+		Bootable:  false,
+	}
+	_, err = ds.CreateStorageAttachment(instance.ID, volume)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attachments := []string{}
+
+	// this doesn't return an error, but we can still exercise
+	// the code to see if anything panics.
+	// send in an empty list.
+	ds.updateStorageAttachments(instance.ID, attachments)
+}
+
+func TestGetStorageAttachment(t *testing.T) {
+	tenant, err := addTestTenant()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blockDevice := storage.BlockDevice{
+		ID: "validID",
+	}
+
+	data := types.BlockData{
+		BlockDevice: blockDevice,
+		State:       types.Available,
+		TenantID:    tenant.ID,
+		CreateTime:  time.Now(),
+	}
+
+	err = ds.AddBlockDevice(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wls, err := ds.GetWorkloads()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(wls) == 0 {
+		t.Fatal("No Workloads Found")
+	}
+
+	instance, err := addTestInstance(tenant, wls[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	volume := payloads.StorageResource{
+		ID:        data.ID,
+		Ephemeral: false,
+		Bootable:  false,
+	}
+	_, err = ds.CreateStorageAttachment(instance.ID, volume)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := ds.getStorageAttachment(instance.ID, data.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a.InstanceID != instance.ID || a.BlockID != data.ID {
+		t.Fatal(err)
+	}
+}
+
+func TestGetStorageAttachmentError(t *testing.T) {
+	tenant, err := addTestTenant()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blockDevice := storage.BlockDevice{
+		ID: "validID",
+	}
+
+	data := types.BlockData{
+		BlockDevice: blockDevice,
+		State:       types.Available,
+		TenantID:    tenant.ID,
+		CreateTime:  time.Now(),
+	}
+
+	err = ds.AddBlockDevice(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wls, err := ds.GetWorkloads()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(wls) == 0 {
+		t.Fatal("No Workloads Found")
+	}
+
+	instance, err := addTestInstance(tenant, wls[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ds.getStorageAttachment(instance.ID, data.ID)
+	if err != ErrNoStorageAttachment {
+		t.Fatal(err)
+	}
+}
+
+func TestDeleteStorageAttachment(t *testing.T) {
+	tenant, err := addTestTenant()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blockDevice := storage.BlockDevice{
+		ID: "validID",
+	}
+
+	data := types.BlockData{
+		BlockDevice: blockDevice,
+		State:       types.Available,
+		TenantID:    tenant.ID,
+		CreateTime:  time.Now(),
+	}
+
+	err = ds.AddBlockDevice(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wls, err := ds.GetWorkloads()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(wls) == 0 {
+		t.Fatal("No Workloads Found")
+	}
+
+	instance, err := addTestInstance(tenant, wls[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	volume := payloads.StorageResource{
+		ID:        data.ID,
+		Ephemeral: false,
+		Bootable:  false,
+	}
+	_, err = ds.CreateStorageAttachment(instance.ID, volume)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := ds.getStorageAttachment(instance.ID, data.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a.InstanceID != instance.ID || a.BlockID != data.ID {
+		t.Fatal(err)
+	}
+
+	err = ds.DeleteStorageAttachment(a.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ds.getStorageAttachment(instance.ID, data.ID)
+	if err != ErrNoStorageAttachment {
+		t.Fatal(err)
+	}
+}
+
+func TestDeleteStorageAttachmentError(t *testing.T) {
+	tenant, err := addTestTenant()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blockDevice := storage.BlockDevice{
+		ID: "validID",
+	}
+
+	data := types.BlockData{
+		BlockDevice: blockDevice,
+		State:       types.Available,
+		TenantID:    tenant.ID,
+		CreateTime:  time.Now(),
+	}
+
+	err = ds.AddBlockDevice(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wls, err := ds.GetWorkloads()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(wls) == 0 {
+		t.Fatal("No Workloads Found")
+	}
+
+	instance, err := addTestInstance(tenant, wls[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	volume := payloads.StorageResource{
+		ID:        data.ID,
+		Ephemeral: false,
+		Bootable:  false,
+	}
+	_, err = ds.CreateStorageAttachment(instance.ID, volume)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := ds.getStorageAttachment(instance.ID, data.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a.InstanceID != instance.ID || a.BlockID != data.ID {
+		t.Fatal(err)
+	}
+
+	err = ds.DeleteStorageAttachment(a.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ds.getStorageAttachment(instance.ID, data.ID)
+	if err != ErrNoStorageAttachment {
+		t.Fatal(err)
+	}
+
+	err = ds.DeleteStorageAttachment(a.ID)
+	if err != ErrNoStorageAttachment {
+		t.Fatal(err)
+	}
+}
+
+func TestGetVolumeAttachments(t *testing.T) {
+	tenant, err := addTestTenant()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blockDevice := storage.BlockDevice{
+		ID: uuid.Generate().String(),
+	}
+
+	data := types.BlockData{
+		BlockDevice: blockDevice,
+		State:       types.Available,
+		TenantID:    tenant.ID,
+		CreateTime:  time.Now(),
+	}
+
+	err = ds.AddBlockDevice(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wls, err := ds.GetWorkloads()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(wls) == 0 {
+		t.Fatal("No Workloads Found")
+	}
+
+	instance, err := addTestInstance(tenant, wls[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	volume := payloads.StorageResource{
+		ID:        data.ID,
+		Ephemeral: false,
+		Bootable:  false,
+	}
+	_, err = ds.CreateStorageAttachment(instance.ID, volume)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attachments, err := ds.GetVolumeAttachments(data.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(attachments) != 1 {
 		t.Fatalf("expected 1 attachment, found %d", len(attachments))
 	}
 
-	for _, a := range attachments {
-		if a.InstanceID != instance.ID || a.BlockID != data.ID {
-			t.Fatal("Returned incorrect attachment")
+	for _, a := range attachments {
+		if a.InstanceID != instance.ID || a.BlockID != data.ID {
+			t.Fatal("Returned incorrect attachment")
+		}
+	}
+}
+
+func TestAddPool(t *testing.T) {
+	pool := types.Pool{
+		ID:   uuid.Generate().String(),
+		Name: "test",
+	}
+
+	err := ds.AddPool(pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// add one with a subnet.
+	subnet := types.ExternalSubnet{
+		ID:   uuid.Generate().String(),
+		CIDR: "192.168.0.0/24",
+	}
+
+	pool2 := types.Pool{
+		ID:      uuid.Generate().String(),
+		Name:    "test2",
+		Subnets: []types.ExternalSubnet{subnet},
+	}
+
+	err = ds.AddPool(pool2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// add one with a duplicate subnet - should fail.
+	subnet = types.ExternalSubnet{
+		ID:   uuid.Generate().String(),
+		CIDR: "192.168.0.0/24",
+	}
+
+	pool3 := types.Pool{
+		ID:      uuid.Generate().String(),
+		Name:    "test3",
+		Subnets: []types.ExternalSubnet{subnet},
+	}
+
+	err = ds.AddPool(pool3)
+	if err != types.ErrDuplicateSubnet {
+		t.Fatal("Duplicate subnet allowed")
+	}
+
+	// add one with ip addresses
+	addr := types.ExternalIP{
+		ID:      uuid.Generate().String(),
+		Address: "192.168.1.1",
+	}
+
+	pool4 := types.Pool{
+		ID:   uuid.Generate().String(),
+		Name: "test4",
+		IPs:  []types.ExternalIP{addr},
+	}
+
+	err = ds.AddPool(pool4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// add one with a duplicate IP - should fail.
+	addr = types.ExternalIP{
+		ID:      uuid.Generate().String(),
+		Address: "192.168.1.1",
+	}
+
+	pool5 := types.Pool{
+		ID:   uuid.Generate().String(),
+		Name: "test5",
+		IPs:  []types.ExternalIP{addr},
+	}
+
+	err = ds.AddPool(pool5)
+	if err != types.ErrDuplicateIP {
+		t.Fatal("Duplicate IP allowed")
+	}
+
+	// add one that overlaps an existing subnet
+	addr.Address = "192.168.0.1"
+	pool5.IPs = []types.ExternalIP{addr}
+	err = ds.AddPool(pool5)
+	if err != types.ErrDuplicateIP {
+		t.Fatal("Duplicate IP allowed")
+	}
+
+	// delete all the pools
+	pools, err := ds.GetPools()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range pools {
+		err := ds.DeletePool(p.ID)
+		if err != nil {
+			t.Fatal(err)
 		}
 	}
 }
 
-func TestAddPool(t *testing.T) {
-	pool := types.Pool{
+func TestGetPool(t *testing.T) {
+	orig := types.Pool{
 		ID:   uuid.Generate().String(),
 		Name: "test",
 	}
 
-	err := ds.AddPool(pool)
+	err := ds.AddPool(orig)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	// add one with a subnet.
-	subnet := types.ExternalSubnet{
+	pool, err := ds.GetPool(orig.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reflect.DeepEqual(orig, pool) == false {
+		t.Fatalf("expected %v, got %v\n", orig, pool)
+	}
+
+	// try to get an invalid pool
+	_, err = ds.GetPool(uuid.Generate().String())
+	if err != types.ErrPoolNotFound {
+		t.Fatal("Found non existent pool")
+	}
+
+	err = ds.DeletePool(orig.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAddExternalSubnet(t *testing.T) {
+	orig := types.Pool{
 		ID:   uuid.Generate().String(),
-		CIDR: "192.168.0.0/24",
+		Name: "test",
+	}
+
+	err := ds.AddPool(orig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subnet := "192.168.2.0/24"
+	err = ds.AddExternalSubnet(orig.ID, subnet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool, err := ds.GetPool(orig.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pool.Subnets) != 1 || pool.Subnets[0].CIDR != subnet {
+		t.Fatal("subnet not added correctly")
+	}
+
+	// try to add to a not existing pool
+	err = ds.AddExternalSubnet(uuid.Generate().String(), subnet)
+	if err != types.ErrPoolNotFound {
+		t.Fatal("Unknown pool allowed")
+	}
+
+	// try to add an overlapping subnet
+	overlap := "192.168.0.0/8"
+	err = ds.AddExternalSubnet(orig.ID, overlap)
+	if err != types.ErrDuplicateSubnet {
+		t.Fatal("overlapping subnet allowed")
+	}
+
+	// try an invalid subnet
+	invalid := "not.a.subnet/10"
+	err = ds.AddExternalSubnet(orig.ID, invalid)
+	if err == nil {
+		t.Fatal("invalid subnet allowed")
+	}
+
+	// cleanup.
+	err = ds.DeletePool(orig.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAddExternalIPs(t *testing.T) {
+	orig := types.Pool{
+		ID:   uuid.Generate().String(),
+		Name: "test",
+	}
+
+	err := ds.AddPool(orig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	IPs := []string{"192.168.0.1"}
+	err = ds.AddExternalIPs(orig.ID, IPs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool, err := ds.GetPool(orig.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pool.IPs) != 1 || pool.IPs[0].Address != IPs[0] {
+		t.Fatal("address not added correctly")
+	}
+
+	// add an invalid IP
+	IPs = []string{"not.a.IP"}
+	err = ds.AddExternalIPs(orig.ID, IPs)
+	if err != types.ErrInvalidIP {
+		t.Fatal("invalid IP allowed")
+	}
+
+	// add a duplicate IP
+	IPs = []string{"192.168.0.1"}
+	err = ds.AddExternalIPs(orig.ID, IPs)
+	if err != types.ErrDuplicateIP {
+		t.Fatal("duplicate IP allowed")
+	}
+
+	// add to an invalid pool
+	IPs = []string{"192.168.0.2"}
+	err = ds.AddExternalIPs(uuid.Generate().String(), IPs)
+	if err != types.ErrPoolNotFound {
+		t.Fatal("duplicate IP allowed")
+	}
+
+	// cleanup.
+	err = ds.DeletePool(orig.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeleteExternalSubnet(t *testing.T) {
+	orig := types.Pool{
+		ID:   uuid.Generate().String(),
+		Name: "test",
+	}
+
+	err := ds.AddPool(orig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subnet := "192.168.2.0/24"
+	err = ds.AddExternalSubnet(orig.ID, subnet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool, err := ds.GetPool(orig.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// delete from the wrong pool
+	err = ds.DeleteSubnet(uuid.Generate().String(), pool.Subnets[0].CIDR)
+	if err != types.ErrPoolNotFound {
+		t.Fatal("delete from invalid pool allowed")
+	}
+
+	// delete the wrong address
+	err = ds.DeleteSubnet(pool.ID, "192.168.0.0/24")
+	if err != types.ErrInvalidPoolAddress {
+		t.Fatal("delete of wrong subnet")
+	}
+
+	// delete an invalid address
+	err = ds.DeleteSubnet(pool.ID, "192.not.a.subnet/24")
+	if err == nil {
+		t.Fatal("delete of invalid subnet")
+	}
+
+	// try to delete a mapped subnet
+	tenant, err := addTestTenant()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wls, err := ds.GetWorkloads()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	instance, err := addTestInstance(tenant, wls[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := ds.MapExternalIP(pool.ID, instance.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ds.DeleteSubnet(pool.ID, pool.Subnets[0].ID)
+	if err != types.ErrPoolNotEmpty {
+		t.Fatal("delete with mapped IP in subnet allowed")
+	}
+
+	// unmap
+	err = ds.UnMapExternalIP(m.ExternalIP)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// delete an existing subnet
+	err = ds.DeleteSubnet(pool.ID, pool.Subnets[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// cleanup.
+	err = ds.DeletePool(orig.ID)
+	if err != nil {
+		t.Fatal(err)
 	}
+}
 
-	pool2 := types.Pool{
-		ID:      uuid.Generate().String(),
-		Name:    "test2",
-		Subnets: []types.ExternalSubnet{subnet},
+func TestDeleteExternalIPs(t *testing.T) {
+	orig := types.Pool{
+		ID:   uuid.Generate().String(),
+		Name: "test",
 	}
 
-	err = ds.AddPool(pool2)
+	err := ds.AddPool(orig)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	// add one with a duplicate subnet - should fail.
-	subnet = types.ExternalSubnet{
-		ID:   uuid.Generate().String(),
-		CIDR: "192.168.0.0/24",
+	IPs := []string{"192.168.0.1"}
+	err = ds.AddExternalIPs(orig.ID, IPs)
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	pool3 := types.Pool{
-		ID:      uuid.Generate().String(),
-		Name:    "test3",
-		Subnets: []types.ExternalSubnet{subnet},
+	pool, err := ds.GetPool(orig.ID)
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	err = ds.AddPool(pool3)
-	if err != types.ErrDuplicateSubnet {
-		t.Fatal("Duplicate subnet allowed")
+	// try to delete from invalid pool
+	err = ds.DeleteExternalIP(uuid.Generate().String(), pool.IPs[0].ID)
+	if err != types.ErrPoolNotFound {
+		t.Fatal("delete from invalid pool")
 	}
 
-	// add one with ip addresses
-	addr := types.ExternalIP{
-		ID:      uuid.Generate().String(),
-		Address: "192.168.1.1",
+	// try to delete an invalid address
+	err = ds.DeleteExternalIP(pool.ID, uuid.Generate().String())
+	if err != types.ErrInvalidPoolAddress {
+		t.Fatal("delete invalid address")
 	}
 
-	pool4 := types.Pool{
-		ID:   uuid.Generate().String(),
-		Name: "test4",
-		IPs:  []types.ExternalIP{addr},
+	// try to delete a mapped address
+	tenant, err := addTestTenant()
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	err = ds.AddPool(pool4)
+	wls, err := ds.GetWorkloads()
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	// add one with a duplicate IP - should fail.
-	addr = types.ExternalIP{
-		ID:      uuid.Generate().String(),
-		Address: "192.168.1.1",
+	instance, err := addTestInstance(tenant, wls[0])
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	pool5 := types.Pool{
-		ID:   uuid.Generate().String(),
-		Name: "test5",
-		IPs:  []types.ExternalIP{addr},
+	m, err := ds.MapExternalIP(pool.ID, instance.ID)
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	err = ds.AddPool(pool5)
-	if err != types.ErrDuplicateIP {
-		t.Fatal("Duplicate IP allowed")
+	err = ds.DeleteExternalIP(pool.ID, pool.IPs[0].ID)
+	if err != types.ErrPoolNotEmpty {
+		t.Fatal("delete mapped address")
 	}
 
-	// add one that overlaps an existing subnet
-	addr.Address = "192.168.0.1"
-	pool5.IPs = []types.ExternalIP{addr}
-	err = ds.AddPool(pool5)
-	if err != types.ErrDuplicateIP {
-		t.Fatal("Duplicate IP allowed")
+	// unmap
+	err = ds.UnMapExternalIP(m.ExternalIP)
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	// delete all the pools
-	pools, err := ds.GetPools()
+	err = ds.DeleteExternalIP(pool.ID, pool.IPs[0].ID)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	for _, p := range pools {
-		err := ds.DeletePool(p.ID)
-		if err != nil {
-			t.Fatal(err)
-		}
+	// cleanup.
+	err = ds.DeletePool(pool.ID)
+	if err != nil {
+		t.Fatal(err)
 	}
 }
 
-func TestGetPool(t *testing.T) {
+func TestMapIPs(t *testing.T) {
 	orig := types.Pool{
 		ID:   uuid.Generate().String(),
 		Name: "test",
@@ -2286,81 +3061,81 @@ func TestGetPool(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	pool, err := ds.GetPool(orig.ID)
+	IPs := []string{"192.168.0.1"}
+	err = ds.AddExternalIPs(orig.ID, IPs)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if reflect.DeepEqual(orig, pool) == false {
-		t.Fatalf("expected %v, got %v\n", orig, pool)
-	}
-
-	// try to get an invalid pool
-	_, err = ds.GetPool(uuid.Generate().String())
-	if err != types.ErrPoolNotFound {
-		t.Fatal("Found non existent pool")
-	}
-
-	err = ds.DeletePool(orig.ID)
+	pool, err := ds.GetPool(orig.ID)
 	if err != nil {
 		t.Fatal(err)
 	}
-}
 
-func TestAddExternalSubnet(t *testing.T) {
-	orig := types.Pool{
-		ID:   uuid.Generate().String(),
-		Name: "test",
+	// prepare for map
+	tenant, err := addTestTenant()
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	err := ds.AddPool(orig)
+	wls, err := ds.GetWorkloads()
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	subnet := "192.168.2.0/24"
-	err = ds.AddExternalSubnet(orig.ID, subnet)
+	instance, err := addTestInstance(tenant, wls[0])
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	pool, err := ds.GetPool(orig.ID)
+	// try to map to an invalid instance.
+	_, err = ds.MapExternalIP(pool.ID, uuid.Generate().String())
+	if err == nil {
+		t.Fatal("map to invalid instance allowed")
+	}
+
+	// try to map to an invalid pool
+	_, err = ds.MapExternalIP(uuid.Generate().String(), instance.ID)
+	if err != types.ErrPoolNotFound {
+		t.Fatal("map to invalid pool allowed")
+	}
+
+	// try to map to an empty pool
+	err = ds.DeleteExternalIP(pool.ID, pool.IPs[0].ID)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if len(pool.Subnets) != 1 || pool.Subnets[0].CIDR != subnet {
-		t.Fatal("subnet not added correctly")
+	_, err = ds.MapExternalIP(pool.ID, instance.ID)
+	if err != types.ErrPoolEmpty {
+		t.Fatal(err)
 	}
 
-	// try to add to a not existing pool
-	err = ds.AddExternalSubnet(uuid.Generate().String(), subnet)
-	if err != types.ErrPoolNotFound {
-		t.Fatal("Unknown pool allowed")
+	// try to map to a valid instance.
+	err = ds.AddExternalIPs(orig.ID, IPs)
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	// try to add an overlapping subnet
-	overlap := "192.168.0.0/8"
-	err = ds.AddExternalSubnet(orig.ID, overlap)
-	if err != types.ErrDuplicateSubnet {
-		t.Fatal("overlapping subnet allowed")
+	m, err := ds.MapExternalIP(pool.ID, instance.ID)
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	// try an invalid subnet
-	invalid := "not.a.subnet/10"
-	err = ds.AddExternalSubnet(orig.ID, invalid)
-	if err == nil {
-		t.Fatal("invalid subnet allowed")
+	// unmap
+	err = ds.UnMapExternalIP(m.ExternalIP)
+	if err != nil {
+		t.Fatal(err)
 	}
 
 	// cleanup.
-	err = ds.DeletePool(orig.ID)
+	err = ds.DeletePool(pool.ID)
 	if err != nil {
 		t.Fatal(err)
 	}
 }
 
-func TestAddExternalIPs(t *testing.T) {
+func TestGetMappedIPs(t *testing.T) {
 	orig := types.Pool{
 		ID:   uuid.Generate().String(),
 		Name: "test",
@@ -2382,86 +3157,143 @@ func TestAddExternalIPs(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if len(pool.IPs) != 1 || pool.IPs[0].Address != IPs[0] {
-		t.Fatal("address not added correctly")
+	// prepare for map
+	tenant, err := addTestTenant()
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	// add an invalid IP
-	IPs = []string{"not.a.IP"}
-	err = ds.AddExternalIPs(orig.ID, IPs)
-	if err != types.ErrInvalidIP {
-		t.Fatal("invalid IP allowed")
+	wls, err := ds.GetWorkloads()
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	// add a duplicate IP
-	IPs = []string{"192.168.0.1"}
-	err = ds.AddExternalIPs(orig.ID, IPs)
-	if err != types.ErrDuplicateIP {
-		t.Fatal("duplicate IP allowed")
+	instance, err := addTestInstance(tenant, wls[0])
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	// add to an invalid pool
-	IPs = []string{"192.168.0.2"}
-	err = ds.AddExternalIPs(uuid.Generate().String(), IPs)
-	if err != types.ErrPoolNotFound {
-		t.Fatal("duplicate IP allowed")
+	m, err := ds.MapExternalIP(pool.ID, instance.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// get mapped ips with tenant
+	ips := ds.GetMappedIPs(&instance.TenantID)
+	if len(ips) != 1 {
+		t.Fatal("GetMappedIPs failed")
+	}
+
+	// get without tenant.
+	ips = ds.GetMappedIPs(nil)
+	if len(ips) != 1 {
+		t.Fatal("GetMappedIPs failed")
+	}
+
+	// get specific mapped IP
+	_, err = ds.GetMappedIP(m.ExternalIP)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// get invalid mapped IP
+	_, err = ds.GetMappedIP("192.168.0.2")
+	if err != types.ErrAddressNotFound {
+		t.Fatal("found invalid address")
+	}
+
+	// unmap
+	err = ds.UnMapExternalIP(m.ExternalIP)
+	if err != nil {
+		t.Fatal(err)
 	}
 
 	// cleanup.
-	err = ds.DeletePool(orig.ID)
+	err = ds.DeletePool(pool.ID)
 	if err != nil {
 		t.Fatal(err)
 	}
 }
 
-func TestDeleteExternalSubnet(t *testing.T) {
-	orig := types.Pool{
-		ID:   uuid.Generate().String(),
-		Name: "test",
+func TestMeterInstance(t *testing.T) {
+	tenant, err := addTestTenant()
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	err := ds.AddPool(orig)
+	wls, err := ds.GetWorkloads()
+	if err != nil || len(wls) == 0 {
+		t.Fatal(err)
+	}
+
+	instance, err := addTestInstance(tenant, wls[0])
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	subnet := "192.168.2.0/24"
-	err = ds.AddExternalSubnet(orig.ID, subnet)
+	instance.Usage[string(payloads.VCPUs)] = 2
+	instance.Usage[string(payloads.MemMB)] = 512
+
+	stat := payloads.InstanceStat{
+		InstanceUUID: instance.ID,
+		State:        payloads.ComputeStatusRunning,
+		DiskUsageMB:  1024,
+	}
+
+	hour := time.Now().UTC().Truncate(time.Hour).Add(-2 * time.Hour)
+
+	// the first statistics start the meter, the next ones are metered
+	// across the hour boundary.
+	ds.meterInstance(instance, stat, hour.Add(55*time.Minute))
+	ds.meterInstance(instance, stat, hour.Add(65*time.Minute))
+
+	// gaps are not metered, nor are exited instances
+	ds.meterInstance(instance, stat, hour.Add(95*time.Minute))
+	stat.State = payloads.ComputeStatusStopped
+	ds.meterInstance(instance, stat, hour.Add(100*time.Minute))
+
+	usages, err := ds.GetInstanceUsage(tenant.ID, hour, hour.Add(2*time.Hour))
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	pool, err := ds.GetPool(orig.ID)
-	if err != nil {
-		t.Fatal(err)
+	if len(usages) != 2 {
+		t.Fatalf("expected 2 usage records, got %+v", usages)
 	}
 
-	// delete from the wrong pool
-	err = ds.DeleteSubnet(uuid.Generate().String(), pool.Subnets[0].CIDR)
-	if err != types.ErrPoolNotFound {
-		t.Fatal("delete from invalid pool allowed")
+	for i, u := range usages {
+		if !u.Hour.Equal(hour.Add(time.Duration(i)*time.Hour)) || u.InstanceID != instance.ID {
+			t.Fatalf("unexpected usage record %+v", u)
+		}
+
+		hours := 5.0 / 60
+		if math.Abs(u.Hours-hours) > 1e-9 ||
+			math.Abs(u.VCPUHours-2*hours) > 1e-9 ||
+			math.Abs(u.MemoryGBHours-0.5*hours) > 1e-9 ||
+			math.Abs(u.DiskGBHours-hours) > 1e-9 {
+			t.Fatalf("unexpected usage record %+v", u)
+		}
 	}
 
-	// delete the wrong address
-	err = ds.DeleteSubnet(pool.ID, "192.168.0.0/24")
-	if err != types.ErrInvalidPoolAddress {
-		t.Fatal("delete of wrong subnet")
+	err = ds.DeleteInstance(instance.ID)
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	// delete an invalid address
-	err = ds.DeleteSubnet(pool.ID, "192.not.a.subnet/24")
-	if err == nil {
-		t.Fatal("delete of invalid subnet")
+	usages, err = ds.GetInstanceUsage("", hour, hour.Add(2*time.Hour))
+	if err != nil || len(usages) != 2 {
+		t.Fatalf("usage lost with instance: %v", err)
 	}
+}
 
-	// try to delete a mapped subnet
+func TestInstanceDetails(t *testing.T) {
 	tenant, err := addTestTenant()
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	wls, err := ds.GetWorkloads()
-	if err != nil {
+	if err != nil || len(wls) == 0 {
 		t.Fatal(err)
 	}
 
@@ -2470,228 +3302,366 @@ func TestDeleteExternalSubnet(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	m, err := ds.MapExternalIP(pool.ID, instance.ID)
+	err = ds.RenameInstance(instance.ID, "web-1")
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	err = ds.DeleteSubnet(pool.ID, pool.Subnets[0].ID)
-	if err != types.ErrPoolNotEmpty {
-		t.Fatal("delete with mapped IP in subnet allowed")
-	}
-
-	// unmap
-	err = ds.UnMapExternalIP(m.ExternalIP)
+	tags := []string{"web", "production"}
+	err = ds.SetInstanceTags(instance.ID, tags)
 	if err != nil {
 		t.Fatal(err)
 	}
+	tags[0] = "changed"
 
-	// delete an existing subnet
-	err = ds.DeleteSubnet(pool.ID, pool.Subnets[0].ID)
+	err = ds.SetInstanceMetadata(instance.ID, map[string]string{"role": "frontend"})
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	// cleanup.
-	err = ds.DeletePool(orig.ID)
+	i, err := ds.GetInstance(instance.ID)
 	if err != nil {
 		t.Fatal(err)
 	}
-}
 
-func TestDeleteExternalIPs(t *testing.T) {
-	orig := types.Pool{
-		ID:   uuid.Generate().String(),
-		Name: "test",
+	if i.Name != "web-1" || len(i.Tags) != 2 || i.Tags[0] != "web" || i.Metadata["role"] != "frontend" {
+		t.Fatalf("instance details not updated: %+v", i)
 	}
 
-	err := ds.AddPool(orig)
+	details, err := ds.db.getInstanceDetails()
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	IPs := []string{"192.168.0.1"}
-	err = ds.AddExternalIPs(orig.ID, IPs)
+	d := details[instance.ID]
+	if d.name != "web-1" || len(d.tags) != 2 || d.metadata["role"] != "frontend" {
+		t.Fatalf("instance details not stored: %+v", d)
+	}
+
+	err = ds.RenameInstance(uuid.Generate().String(), "none")
+	if err != types.ErrInstanceNotFound {
+		t.Fatalf("expected %v, got %v", types.ErrInstanceNotFound, err)
+	}
+
+	err = ds.DeleteInstance(instance.ID)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	pool, err := ds.GetPool(orig.ID)
+	details, err = ds.db.getInstanceDetails()
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	// try to delete from invalid pool
-	err = ds.DeleteExternalIP(uuid.Generate().String(), pool.IPs[0].ID)
-	if err != types.ErrPoolNotFound {
-		t.Fatal("delete from invalid pool")
+	if _, ok := details[instance.ID]; ok {
+		t.Fatal("instance details not deleted")
 	}
+}
 
-	// try to delete an invalid address
-	err = ds.DeleteExternalIP(pool.ID, uuid.Generate().String())
-	if err != types.ErrInvalidPoolAddress {
-		t.Fatal("delete invalid address")
+func TestSchedules(t *testing.T) {
+	tenantID := uuid.Generate().String()
+	now := time.Now().UTC()
+
+	schedules := []types.Schedule{
+		{
+			ID:         uuid.Generate().String(),
+			TenantID:   tenantID,
+			InstanceID: uuid.Generate().String(),
+			Action:     types.ScheduleDelete,
+			CreateTime: now,
+			NextRun:    now.Add(8 * time.Hour),
+		},
+		{
+			ID:         uuid.Generate().String(),
+			TenantID:   uuid.Generate().String(),
+			Tag:        "dev",
+			Action:     types.ScheduleStop,
+			Cron:       "0 19 * * *",
+			CreateTime: now,
+			NextRun:    now.Add(time.Hour),
+		},
 	}
 
-	// try to delete a mapped address
-	tenant, err := addTestTenant()
+	for _, s := range schedules {
+		err := ds.AddSchedule(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	found, err := ds.GetSchedules(tenantID)
+	if err != nil || len(found) != 1 || found[0].ID != schedules[0].ID {
+		t.Fatalf("expected schedule %s of tenant, got %+v: %v", schedules[0].ID, found, err)
+	}
+
+	s := schedules[1]
+	s.LastRun = s.NextRun
+	s.NextRun = s.NextRun.Add(24 * time.Hour)
+
+	err = ds.UpdateSchedule(s)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	wls, err := ds.GetWorkloads()
+	updated, err := ds.GetSchedule(s.ID)
+	if err != nil || !updated.LastRun.Equal(s.LastRun) || !updated.NextRun.Equal(s.NextRun) {
+		t.Fatalf("schedule runs not updated: %+v: %v", updated, err)
+	}
+
+	for _, s := range schedules {
+		err = ds.DeleteSchedule(s.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err = ds.GetSchedule(schedules[0].ID)
+	if err != types.ErrScheduleNotFound {
+		t.Fatalf("expected %v, got %v", types.ErrScheduleNotFound, err)
+	}
+}
+
+func TestScalingGroups(t *testing.T) {
+	now := time.Now().UTC()
+
+	g := types.ScalingGroup{
+		ID:               uuid.Generate().String(),
+		TenantID:         uuid.Generate().String(),
+		Name:             "web",
+		WorkloadID:       uuid.Generate().String(),
+		MinInstances:     1,
+		MaxInstances:     4,
+		DesiredInstances: 2,
+		ScaleOut:         &types.ScalingRule{Metric: types.ScalingCPU, Threshold: 80, Period: 300, Step: 1},
+		Cooldown:         600,
+		CreateTime:       now,
+	}
+
+	err := ds.UpdateScalingGroup(g)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	instance, err := addTestInstance(tenant, wls[0])
+	g.DesiredInstances = 3
+	g.LastScale = now.Add(time.Minute)
+
+	err = ds.UpdateScalingGroup(g)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	m, err := ds.MapExternalIP(pool.ID, instance.ID)
+	err = ds.AddScalingActivity(types.ScalingActivity{
+		GroupID:   g.ID,
+		Timestamp: g.LastScale,
+		From:      2,
+		To:        3,
+		Reason:    "cpu 90% above 80%",
+	})
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	err = ds.DeleteExternalIP(pool.ID, pool.IPs[0].ID)
-	if err != types.ErrPoolNotEmpty {
-		t.Fatal("delete mapped address")
+	found, err := ds.GetScalingGroups(g.TenantID)
+	if err != nil || len(found) != 1 {
+		t.Fatalf("expected scaling group of tenant, got %+v: %v", found, err)
 	}
 
-	// unmap
-	err = ds.UnMapExternalIP(m.ExternalIP)
-	if err != nil {
-		t.Fatal(err)
+	if found[0].DesiredInstances != 3 || found[0].ScaleOut == nil || found[0].ScaleIn != nil ||
+		!found[0].LastScale.Equal(g.LastScale) {
+		t.Fatalf("scaling group not updated: %+v", found[0])
 	}
 
-	err = ds.DeleteExternalIP(pool.ID, pool.IPs[0].ID)
-	if err != nil {
-		t.Fatal(err)
+	activities, err := ds.GetScalingActivities(g.ID)
+	if err != nil || len(activities) != 1 || activities[0].To != 3 {
+		t.Fatalf("unexpected scaling activities %+v: %v", activities, err)
 	}
 
-	// cleanup.
-	err = ds.DeletePool(pool.ID)
+	err = ds.DeleteScalingGroup(g.ID)
 	if err != nil {
 		t.Fatal(err)
 	}
+
+	_, err = ds.GetScalingGroup(g.ID)
+	if err != types.ErrScalingGroupNotFound {
+		t.Fatalf("expected %v, got %v", types.ErrScalingGroupNotFound, err)
+	}
+
+	activities, err = ds.GetScalingActivities(g.ID)
+	if err != nil || len(activities) != 0 {
+		t.Fatalf("scaling history not deleted: %+v: %v", activities, err)
+	}
 }
 
-func TestMapIPs(t *testing.T) {
-	orig := types.Pool{
-		ID:   uuid.Generate().String(),
-		Name: "test",
+func TestKeypairs(t *testing.T) {
+	userID := uuid.Generate().String()
+
+	keypairs := []types.Keypair{
+		{
+			UserID:     userID,
+			Name:       "work",
+			Type:       "ssh",
+			PublicKey:  "ssh-rsa AAAA work",
+			CreateTime: time.Now().UTC(),
+		},
+		{
+			UserID:     userID,
+			Name:       "home",
+			Type:       "ssh",
+			PublicKey:  "ssh-rsa AAAA home",
+			CreateTime: time.Now().UTC(),
+		},
+		{
+			UserID:     uuid.Generate().String(),
+			Name:       "work",
+			Type:       "ssh",
+			PublicKey:  "ssh-rsa AAAA other",
+			CreateTime: time.Now().UTC(),
+		},
 	}
 
-	err := ds.AddPool(orig)
-	if err != nil {
-		t.Fatal(err)
+	for _, k := range keypairs {
+		err := ds.AddKeypair(k)
+		if err != nil {
+			t.Fatal(err)
+		}
 	}
 
-	IPs := []string{"192.168.0.1"}
-	err = ds.AddExternalIPs(orig.ID, IPs)
-	if err != nil {
-		t.Fatal(err)
+	err := ds.AddKeypair(keypairs[0])
+	if err != types.ErrDuplicateKeypair {
+		t.Fatalf("expected %v, got %v", types.ErrDuplicateKeypair, err)
 	}
 
-	pool, err := ds.GetPool(orig.ID)
-	if err != nil {
-		t.Fatal(err)
+	found, err := ds.GetKeypairs(userID)
+	if err != nil || len(found) != 2 || found[0].Name != "home" || found[1].Name != "work" {
+		t.Fatalf("expected the keypairs of the user sorted by name, got %+v: %v", found, err)
 	}
 
-	// prepare for map
-	tenant, err := addTestTenant()
-	if err != nil {
-		t.Fatal(err)
+	k, err := ds.GetKeypair(userID, "work")
+	if err != nil || k.PublicKey != keypairs[0].PublicKey {
+		t.Fatalf("expected keypair %+v, got %+v: %v", keypairs[0], k, err)
 	}
 
-	wls, err := ds.GetWorkloads()
-	if err != nil {
-		t.Fatal(err)
+	for _, k := range keypairs {
+		err = ds.DeleteKeypair(k.UserID, k.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
 	}
 
-	instance, err := addTestInstance(tenant, wls[0])
-	if err != nil {
-		t.Fatal(err)
+	err = ds.DeleteKeypair(userID, "work")
+	if err != types.ErrKeypairNotFound {
+		t.Fatalf("expected %v, got %v", types.ErrKeypairNotFound, err)
 	}
+}
 
-	// try to map to an invalid instance.
-	_, err = ds.MapExternalIP(pool.ID, uuid.Generate().String())
-	if err == nil {
-		t.Fatal("map to invalid instance allowed")
+func TestSecurityGroups(t *testing.T) {
+	tenantID := uuid.Generate().String()
+
+	groups := []types.SecurityGroup{
+		{
+			ID:         uuid.Generate().String(),
+			TenantID:   tenantID,
+			Name:       "web",
+			CreateTime: time.Now().UTC(),
+		},
+		{
+			ID:         uuid.Generate().String(),
+			TenantID:   tenantID,
+			Name:       "db",
+			CreateTime: time.Now().UTC(),
+		},
+		{
+			ID:         uuid.Generate().String(),
+			TenantID:   uuid.Generate().String(),
+			Name:       "web",
+			CreateTime: time.Now().UTC(),
+		},
 	}
 
-	// try to map to an invalid pool
-	_, err = ds.MapExternalIP(uuid.Generate().String(), instance.ID)
-	if err != types.ErrPoolNotFound {
-		t.Fatal("map to invalid pool allowed")
+	for _, g := range groups {
+		err := ds.AddSecurityGroup(g)
+		if err != nil {
+			t.Fatal(err)
+		}
 	}
 
-	// try to map to an empty pool
-	err = ds.DeleteExternalIP(pool.ID, pool.IPs[0].ID)
-	if err != nil {
-		t.Fatal(err)
+	dup := groups[0]
+	dup.ID = uuid.Generate().String()
+	err := ds.AddSecurityGroup(dup)
+	if err != types.ErrDuplicateSecurityGroup {
+		t.Fatalf("expected %v, got %v", types.ErrDuplicateSecurityGroup, err)
 	}
 
-	_, err = ds.MapExternalIP(pool.ID, instance.ID)
-	if err != types.ErrPoolEmpty {
-		t.Fatal(err)
+	err = ds.UpdateSecurityGroup(groups[1].ID, "web", "")
+	if err != types.ErrDuplicateSecurityGroup {
+		t.Fatalf("expected %v, got %v", types.ErrDuplicateSecurityGroup, err)
 	}
 
-	// try to map to a valid instance.
-	err = ds.AddExternalIPs(orig.ID, IPs)
+	err = ds.UpdateSecurityGroup(groups[1].ID, "database", "Database servers")
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	m, err := ds.MapExternalIP(pool.ID, instance.ID)
-	if err != nil {
-		t.Fatal(err)
+	found, err := ds.GetSecurityGroups(tenantID)
+	if err != nil || len(found) != 2 || found[0].Name != "database" || found[1].Name != "web" {
+		t.Fatalf("expected the security groups of the tenant sorted by name, got %+v: %v", found, err)
 	}
 
-	// unmap
-	err = ds.UnMapExternalIP(m.ExternalIP)
-	if err != nil {
-		t.Fatal(err)
+	rule := types.SecurityGroupRule{
+		ID:            uuid.Generate().String(),
+		Direction:     payloads.Ingress,
+		Protocol:      "tcp",
+		PortMin:       5432,
+		PortMax:       5432,
+		RemoteGroupID: groups[0].ID,
 	}
 
-	// cleanup.
-	err = ds.DeletePool(pool.ID)
+	err = ds.AddSecurityGroupRule(groups[1].ID, rule)
 	if err != nil {
 		t.Fatal(err)
 	}
-}
 
-func TestGetMappedIPs(t *testing.T) {
-	orig := types.Pool{
-		ID:   uuid.Generate().String(),
-		Name: "test",
+	g, err := ds.GetSecurityGroup(groups[1].ID)
+	if err != nil || g.Description != "Database servers" || len(g.Rules) != 1 || g.Rules[0] != rule {
+		t.Fatalf("expected security group with rule %+v, got %+v: %v", rule, g, err)
 	}
 
-	err := ds.AddPool(orig)
-	if err != nil {
-		t.Fatal(err)
+	err = ds.DeleteSecurityGroupRule(groups[1].ID, uuid.Generate().String())
+	if err != types.ErrSecurityGroupRuleNotFound {
+		t.Fatalf("expected %v, got %v", types.ErrSecurityGroupRuleNotFound, err)
 	}
 
-	IPs := []string{"192.168.0.1"}
-	err = ds.AddExternalIPs(orig.ID, IPs)
+	err = ds.DeleteSecurityGroupRule(groups[1].ID, rule.ID)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	pool, err := ds.GetPool(orig.ID)
-	if err != nil {
-		t.Fatal(err)
+	g, err = ds.GetSecurityGroup(groups[1].ID)
+	if err != nil || len(g.Rules) != 0 {
+		t.Fatalf("security group rule not deleted: %+v: %v", g, err)
 	}
 
-	// prepare for map
+	for _, g := range groups {
+		err = ds.DeleteSecurityGroup(g.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err = ds.GetSecurityGroup(groups[0].ID)
+	if err != types.ErrSecurityGroupNotFound {
+		t.Fatalf("expected %v, got %v", types.ErrSecurityGroupNotFound, err)
+	}
+}
+
+func TestInstanceSecurityGroups(t *testing.T) {
 	tenant, err := addTestTenant()
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	wls, err := ds.GetWorkloads()
-	if err != nil {
+	if err != nil || len(wls) == 0 {
 		t.Fatal(err)
 	}
 
@@ -2700,45 +3670,31 @@ func TestGetMappedIPs(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	m, err := ds.MapExternalIP(pool.ID, instance.ID)
+	groups := []string{uuid.Generate().String()}
+	err = ds.SetInstanceSecurityGroups(instance.ID, groups)
 	if err != nil {
 		t.Fatal(err)
 	}
+	groups[0] = "changed"
 
-	// get mapped ips with tenant
-	ips := ds.GetMappedIPs(&instance.TenantID)
-	if len(ips) != 1 {
-		t.Fatal("GetMappedIPs failed")
-	}
-
-	// get without tenant.
-	ips = ds.GetMappedIPs(nil)
-	if len(ips) != 1 {
-		t.Fatal("GetMappedIPs failed")
-	}
-
-	// get specific mapped IP
-	_, err = ds.GetMappedIP(m.ExternalIP)
-	if err != nil {
-		t.Fatal(err)
+	i, err := ds.GetInstance(instance.ID)
+	if err != nil || len(i.SecurityGroups) != 1 || i.SecurityGroups[0] == "changed" {
+		t.Fatalf("instance security groups not updated: %+v: %v", i, err)
 	}
 
-	// get invalid mapped IP
-	_, err = ds.GetMappedIP("192.168.0.2")
-	if err != types.ErrAddressNotFound {
-		t.Fatal("found invalid address")
+	details, err := ds.db.getInstanceDetails()
+	if err != nil || len(details[instance.ID].securityGroups) != 1 {
+		t.Fatalf("instance security groups not stored: %+v: %v", details[instance.ID], err)
 	}
 
-	// unmap
-	err = ds.UnMapExternalIP(m.ExternalIP)
+	err = ds.SetInstanceSecurityGroups(instance.ID, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	// cleanup.
-	err = ds.DeletePool(pool.ID)
-	if err != nil {
-		t.Fatal(err)
+	i, err = ds.GetInstance(instance.ID)
+	if err != nil || len(i.SecurityGroups) != 0 {
+		t.Fatalf("instance security groups not removed: %+v: %v", i, err)
 	}
 }
 
@@ -2746,6 +3702,7 @@ var ds *Datastore
 
 var tablesInitPath = flag.String("tables_init_path", "../../tables", "path to csv files")
 var workloadsPath = flag.String("workloads_path", "../../workloads", "path to yaml files")
+var postgresDSN = flag.String("postgres_dsn", "", "DSN of an empty PostgreSQL database to run the tests against")
 
 func TestMain(m *testing.M) {
 	flag.Parse()
@@ -2760,6 +3717,11 @@ func TestMain(m *testing.M) {
 		InitWorkloadsPath: *workloadsPath,
 	}
 
+	if *postgresDSN != "" {
+		dsConfig.DBBackend = &postgresDB{}
+		dsConfig.PersistentURI = *postgresDSN
+	}
+
 	err := ds.Init(dsConfig)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%v", err)
@@ -2772,3 +3734,64 @@ func TestMain(m *testing.M) {
 
 	os.Exit(code)
 }
+
+func waitInstanceEvent(t *testing.T, events <-chan types.StreamEvent, instanceID string) types.StreamEvent {
+	timeout := time.After(5 * time.Second)
+
+	for {
+		select {
+		case e := <-events:
+			if e.InstanceID == instanceID {
+				return e
+			}
+		case <-timeout:
+			t.Fatalf("no event received for instance %s", instanceID)
+		}
+	}
+}
+
+func TestEventSubscription(t *testing.T) {
+	id, events := ds.SubscribeEvents()
+
+	tenant, err := addTestTenant()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wls, err := ds.GetWorkloads()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	instance, err := addTestInstance(tenant, wls[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := waitInstanceEvent(t, events, instance.ID)
+	if e.Type != types.InstanceStateEvent || e.To != types.InstancePending || e.TenantID != tenant.ID {
+		t.Fatalf("unexpected event %+v", e)
+	}
+
+	reportInstanceState(t, instance, uuid.Generate().String(), types.InstanceRunning)
+
+	e = waitInstanceEvent(t, events, instance.ID)
+	if e.From != types.InstancePending || e.To != types.InstanceRunning {
+		t.Fatalf("unexpected event %+v", e)
+	}
+
+	err = ds.DeleteInstance(instance.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e = waitInstanceEvent(t, events, instance.ID)
+	if e.Type != types.InstanceDeletedEvent {
+		t.Fatalf("expected %s event, got %+v", types.InstanceDeletedEvent, e)
+	}
+
+	ds.UnsubscribeEvents(id)
+
+	for range events {
+	}
+}
@@ -0,0 +1,234 @@
+/*
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package datastore
+
+import (
+	"encoding/json"
+
+	"github.com/01org/ciao/ciao-controller/types"
+	"github.com/01org/ciao/payloads"
+	"github.com/pkg/errors"
+)
+
+// instanceDetails are the name, tags, metadata and security groups of an
+// instance, which the users may change during its lifetime, its health
+// check and the keypair injected in its metadata.
+type instanceDetails struct {
+	name           string
+	tags           []string
+	metadata       map[string]string
+	healthCheck    *payloads.HealthCheck
+	keyName        string
+	publicKey      string
+	securityGroups []string
+}
+
+func copyTags(tags []string) []string {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	return append([]string(nil), tags...)
+}
+
+func copyMetadata(metadata map[string]string) map[string]string {
+	if len(metadata) == 0 {
+		return nil
+	}
+
+	c := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		c[k] = v
+	}
+
+	return c
+}
+
+func copyHealthCheck(check *payloads.HealthCheck) *payloads.HealthCheck {
+	if check == nil {
+		return nil
+	}
+
+	c := *check
+	return &c
+}
+
+func detailsOf(i *types.Instance) instanceDetails {
+	return instanceDetails{
+		name:           i.Name,
+		tags:           copyTags(i.Tags),
+		metadata:       copyMetadata(i.Metadata),
+		healthCheck:    copyHealthCheck(i.HealthCheck),
+		keyName:        i.KeyName,
+		publicKey:      i.PublicKey,
+		securityGroups: copyTags(i.SecurityGroups),
+	}
+}
+
+func (d instanceDetails) copy() instanceDetails {
+	return instanceDetails{
+		name:           d.name,
+		tags:           copyTags(d.tags),
+		metadata:       copyMetadata(d.metadata),
+		healthCheck:    copyHealthCheck(d.healthCheck),
+		keyName:        d.keyName,
+		publicKey:      d.publicKey,
+		securityGroups: copyTags(d.securityGroups),
+	}
+}
+
+func (d instanceDetails) empty() bool {
+	return d.name == "" && len(d.tags) == 0 && len(d.metadata) == 0 && d.healthCheck == nil &&
+		d.keyName == "" && len(d.securityGroups) == 0
+}
+
+func (d instanceDetails) apply(i *types.Instance) {
+	i.Name = d.name
+	i.Tags = copyTags(d.tags)
+	i.Metadata = copyMetadata(d.metadata)
+	i.HealthCheck = copyHealthCheck(d.healthCheck)
+	i.KeyName = d.keyName
+	i.PublicKey = d.publicKey
+	i.SecurityGroups = copyTags(d.securityGroups)
+}
+
+// marshal returns the tags, metadata, health check and security groups as
+// stored in the databases.
+func (d instanceDetails) marshal() (string, string, string, string, error) {
+	tags := d.tags
+	if tags == nil {
+		tags = []string{}
+	}
+
+	t, err := json.Marshal(tags)
+	if err != nil {
+		return "", "", "", "", err
+	}
+
+	metadata := d.metadata
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+
+	m, err := json.Marshal(metadata)
+	if err != nil {
+		return "", "", "", "", err
+	}
+
+	c, err := marshalHealthCheck(d.healthCheck)
+	if err != nil {
+		return "", "", "", "", err
+	}
+
+	g := ""
+	if len(d.securityGroups) > 0 {
+		b, err := json.Marshal(d.securityGroups)
+		if err != nil {
+			return "", "", "", "", err
+		}
+		g = string(b)
+	}
+
+	return string(t), string(m), c, g, nil
+}
+
+func unmarshalInstanceDetails(name string, tags string, metadata string, healthCheck string,
+	keyName string, publicKey string, securityGroups string) (instanceDetails, error) {
+	d := instanceDetails{name: name, keyName: keyName, publicKey: publicKey}
+
+	if securityGroups != "" {
+		err := json.Unmarshal([]byte(securityGroups), &d.securityGroups)
+		if err != nil {
+			return d, errors.Wrap(err, "invalid instance security groups")
+		}
+	}
+
+	if tags != "" {
+		err := json.Unmarshal([]byte(tags), &d.tags)
+		if err != nil {
+			return d, errors.Wrap(err, "invalid instance tags")
+		}
+	}
+
+	if metadata != "" {
+		err := json.Unmarshal([]byte(metadata), &d.metadata)
+		if err != nil {
+			return d, errors.Wrap(err, "invalid instance metadata")
+		}
+	}
+
+	d.tags = copyTags(d.tags)
+	d.metadata = copyMetadata(d.metadata)
+	d.securityGroups = copyTags(d.securityGroups)
+
+	check, err := unmarshalHealthCheck(healthCheck)
+	if err != nil {
+		return d, err
+	}
+	d.healthCheck = check
+
+	return d, nil
+}
+
+// updateInstanceDetails changes the details of an instance in the cache
+// with update, and stores them in the database.
+func (ds *Datastore) updateInstanceDetails(instanceID string, update func(*instanceDetails)) error {
+	ds.instancesLock.Lock()
+
+	instance, ok := ds.instances[instanceID]
+	if !ok {
+		ds.instancesLock.Unlock()
+		return types.ErrInstanceNotFound
+	}
+
+	d := detailsOf(instance)
+	update(&d)
+	d.apply(instance)
+
+	ds.instancesLock.Unlock()
+
+	return errors.Wrapf(ds.db.updateInstanceDetails(instanceID, d),
+		"error updating details of instance (%v) in database", instanceID)
+}
+
+// RenameInstance changes the name of an instance.
+func (ds *Datastore) RenameInstance(instanceID string, name string) error {
+	return ds.updateInstanceDetails(instanceID, func(d *instanceDetails) {
+		d.name = name
+	})
+}
+
+// SetInstanceTags replaces the tags of an instance.
+func (ds *Datastore) SetInstanceTags(instanceID string, tags []string) error {
+	return ds.updateInstanceDetails(instanceID, func(d *instanceDetails) {
+		d.tags = copyTags(tags)
+	})
+}
+
+// SetInstanceMetadata replaces the metadata of an instance.
+func (ds *Datastore) SetInstanceMetadata(instanceID string, metadata map[string]string) error {
+	return ds.updateInstanceDetails(instanceID, func(d *instanceDetails) {
+		d.metadata = copyMetadata(metadata)
+	})
+}
+
+// SetInstanceSecurityGroups replaces the security groups of an instance.
+func (ds *Datastore) SetInstanceSecurityGroups(instanceID string, groups []string) error {
+	return ds.updateInstanceDetails(instanceID, func(d *instanceDetails) {
+		d.securityGroups = copyTags(groups)
+	})
+}
@@ -0,0 +1,111 @@
+/*
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package datastore
+
+import (
+	"sync"
+	"time"
+
+	"github.com/01org/ciao/ciao-controller/types"
+	"github.com/golang/glog"
+)
+
+// subscriberQueueLen is the number of events buffered for a subscriber
+// before new events are dropped for it.
+const subscriberQueueLen = 256
+
+// eventBroker fans the stream events published by the datastore and the
+// controller out to every subscriber.
+type eventBroker struct {
+	sync.Mutex
+	nextID      int
+	subscribers map[int]chan types.StreamEvent
+}
+
+// SubscribeEvents registers a new subscriber to the event stream.  It
+// returns the subscription ID to pass to UnsubscribeEvents and the channel
+// events are delivered on.  A subscriber not keeping up loses events
+// rather than blocking the datastore.
+func (ds *Datastore) SubscribeEvents() (int, <-chan types.StreamEvent) {
+	ds.events.Lock()
+	defer ds.events.Unlock()
+
+	if ds.events.subscribers == nil {
+		ds.events.subscribers = make(map[int]chan types.StreamEvent)
+	}
+
+	id := ds.events.nextID
+	ds.events.nextID++
+
+	c := make(chan types.StreamEvent, subscriberQueueLen)
+	ds.events.subscribers[id] = c
+
+	return id, c
+}
+
+// UnsubscribeEvents removes a subscriber and closes its channel.
+func (ds *Datastore) UnsubscribeEvents(id int) {
+	ds.events.Lock()
+	defer ds.events.Unlock()
+
+	c, ok := ds.events.subscribers[id]
+	if !ok {
+		return
+	}
+
+	delete(ds.events.subscribers, id)
+	close(c)
+}
+
+// PublishEvent sends an event to all the subscribers of the event stream.
+func (ds *Datastore) PublishEvent(e types.StreamEvent) {
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now()
+	}
+
+	ds.events.Lock()
+	defer ds.events.Unlock()
+
+	for id, c := range ds.events.subscribers {
+		select {
+		case c <- e:
+		default:
+			glog.Warningf("Event subscriber %d is full, dropping %s event", id, e.Type)
+		}
+	}
+}
+
+func (ds *Datastore) publishTransition(instance *types.Instance, t types.InstanceTransition) {
+	ds.PublishEvent(types.StreamEvent{
+		Type:       types.InstanceStateEvent,
+		Timestamp:  t.Timestamp,
+		TenantID:   instance.TenantID,
+		InstanceID: instance.ID,
+		NodeID:     instance.NodeID,
+		From:       t.From,
+		To:         t.To,
+	})
+}
+
+func (ds *Datastore) publishAttachment(t types.StreamEventType, tenantID string, a types.StorageAttachment) {
+	ds.PublishEvent(types.StreamEvent{
+		Type:       t,
+		TenantID:   tenantID,
+		InstanceID: a.InstanceID,
+		VolumeID:   a.BlockID,
+	})
+}
@@ -0,0 +1,89 @@
+/*
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package datastore
+
+import (
+	"sort"
+
+	"github.com/01org/ciao/ciao-controller/types"
+	"github.com/pkg/errors"
+)
+
+// AddKeypair stores a new keypair of a user.
+func (ds *Datastore) AddKeypair(k types.Keypair) error {
+	ds.keypairsLock.Lock()
+	defer ds.keypairsLock.Unlock()
+
+	_, err := ds.GetKeypair(k.UserID, k.Name)
+	if err == nil {
+		return types.ErrDuplicateKeypair
+	} else if err != types.ErrKeypairNotFound {
+		return err
+	}
+
+	return errors.Wrapf(ds.db.addKeypair(k),
+		"error adding keypair (%v) to database", k.Name)
+}
+
+// DeleteKeypair removes a keypair of a user.
+func (ds *Datastore) DeleteKeypair(userID string, name string) error {
+	ds.keypairsLock.Lock()
+	defer ds.keypairsLock.Unlock()
+
+	_, err := ds.GetKeypair(userID, name)
+	if err != nil {
+		return err
+	}
+
+	return errors.Wrapf(ds.db.deleteKeypair(userID, name),
+		"error deleting keypair (%v) from database", name)
+}
+
+// GetKeypairs returns the keypairs of a user sorted by name.
+func (ds *Datastore) GetKeypairs(userID string) ([]types.Keypair, error) {
+	keypairs, err := ds.db.getKeypairs()
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving keypairs")
+	}
+
+	var found []types.Keypair
+	for _, k := range keypairs {
+		if k.UserID == userID {
+			found = append(found, k)
+		}
+	}
+
+	sort.Sort(types.SortedKeypairsByName(found))
+
+	return found, nil
+}
+
+// GetKeypair returns a keypair of a user.
+func (ds *Datastore) GetKeypair(userID string, name string) (types.Keypair, error) {
+	keypairs, err := ds.GetKeypairs(userID)
+	if err != nil {
+		return types.Keypair{}, err
+	}
+
+	for _, k := range keypairs {
+		if k.Name == name {
+			return k, nil
+		}
+	}
+
+	return types.Keypair{}, types.ErrKeypairNotFound
+}
@@ -19,6 +19,10 @@ import (
 	"encoding/csv"
 	"fmt"
 	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/01org/ciao/ciao-controller/types"
 	"github.com/01org/ciao/payloads"
@@ -34,8 +38,28 @@ type MemoryDB struct {
 	blockDevices    map[string]types.BlockData
 	attachments     map[string]types.StorageAttachment
 	instanceVolumes map[attachment]string
+	transitions     map[string][]types.InstanceTransition
+	transitionsLock sync.Mutex
+	details         map[string]instanceDetails
+	detailsLock     sync.Mutex
+	configs         map[string]string
+	configsLock     sync.Mutex
+	usages          map[string]types.InstanceUsage
+	usagesLock      sync.Mutex
+	auditLog        []types.AuditRecord
+	auditLock       sync.Mutex
+	schedules       map[string]types.Schedule
+	schedulesLock   sync.Mutex
+	scalingGroups   map[string]types.ScalingGroup
+	scalingHistory  map[string][]types.ScalingActivity
+	scalingLock     sync.Mutex
+	keypairs        map[string]types.Keypair
+	keypairsLock    sync.Mutex
+	securityGroups  map[string]types.SecurityGroup
+	securityLock    sync.Mutex
 	logEntries      []*types.LogEntry
 	cnciWorkload    *workload
+	resources       []types.Resource
 
 	tableInitPath string
 	workloadsPath string
@@ -82,6 +106,37 @@ func (db *MemoryDB) fillWorkloads() error {
 	return nil
 }
 
+func (db *MemoryDB) fillResources() error {
+	f, err := os.Open(fmt.Sprintf("%s/resources.csv", db.tableInitPath))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.TrimLeadingSpace = true
+	r.Comment = '#'
+
+	records, err := r.ReadAll()
+	if err != nil {
+		return err
+	}
+
+	for _, line := range records {
+		id, err := strconv.Atoi(line[0])
+		if err != nil {
+			return err
+		}
+
+		db.resources = append(db.resources, types.Resource{
+			Rname: line[1],
+			Rtype: id,
+			Limit: -1,
+		})
+	}
+	return nil
+}
+
 func (db *MemoryDB) init(config Config) error {
 	db.tenants = make(map[string]*tenant)
 	db.workloads = make(map[string]*workload)
@@ -91,6 +146,15 @@ func (db *MemoryDB) init(config Config) error {
 	db.blockDevices = make(map[string]types.BlockData)
 	db.attachments = make(map[string]types.StorageAttachment)
 	db.instanceVolumes = make(map[attachment]string)
+	db.transitions = make(map[string][]types.InstanceTransition)
+	db.details = make(map[string]instanceDetails)
+	db.configs = make(map[string]string)
+	db.schedules = make(map[string]types.Schedule)
+	db.scalingGroups = make(map[string]types.ScalingGroup)
+	db.scalingHistory = make(map[string][]types.ScalingActivity)
+	db.keypairs = make(map[string]types.Keypair)
+	db.securityGroups = make(map[string]types.SecurityGroup)
+	db.usages = make(map[string]types.InstanceUsage)
 
 	db.tableInitPath = config.InitTablesPath
 	db.workloadsPath = config.InitWorkloadsPath
@@ -99,6 +163,11 @@ func (db *MemoryDB) init(config Config) error {
 	if err != nil {
 		return fmt.Errorf("error parsing workloads: %v", err)
 	}
+
+	err = db.fillResources()
+	if err != nil {
+		return fmt.Errorf("error parsing resources: %v", err)
+	}
 	return nil
 }
 
@@ -164,16 +233,17 @@ func (db *MemoryDB) addTenant(id string, MAC string) error {
 		instances: make(map[string]*types.Instance),
 		devices:   make(map[string]types.BlockData),
 	}
+	for i := range db.resources {
+		r := db.resources[i]
+		t.Resources = append(t.Resources, &r)
+	}
 	db.tenants[id] = t
 	return nil
 }
 
 func (db *MemoryDB) getTenant(id string) (*tenant, error) {
-	tenant, ok := db.tenants[id]
-	if !ok {
-		return nil, fmt.Errorf("Tenant %s not found", id)
-	}
-	return tenant, nil
+	// like the sqlite backend, a missing tenant is not an error
+	return db.tenants[id], nil
 }
 
 func (db *MemoryDB) getTenants() ([]*tenant, error) {
@@ -193,6 +263,11 @@ func (db *MemoryDB) updateTenant(t *tenant) error {
 	return nil
 }
 
+func (db *MemoryDB) deleteTenant(id string) error {
+	delete(db.tenants, id)
+	return nil
+}
+
 func (db *MemoryDB) releaseTenantIP(tenantID string, subnetInt int, rest int) error {
 	return nil
 }
@@ -214,9 +289,252 @@ func (db *MemoryDB) addInstance(instance *types.Instance) error {
 }
 
 func (db *MemoryDB) deleteInstance(instanceID string) error {
+	db.transitionsLock.Lock()
+	delete(db.transitions, instanceID)
+	db.transitionsLock.Unlock()
+
+	db.detailsLock.Lock()
+	delete(db.details, instanceID)
+	db.detailsLock.Unlock()
+
+	db.configsLock.Lock()
+	delete(db.configs, instanceID)
+	db.configsLock.Unlock()
+
 	return nil
 }
 
+func (db *MemoryDB) addInstanceTransition(instanceID string, t types.InstanceTransition) error {
+	db.transitionsLock.Lock()
+	db.transitions[instanceID] = append(db.transitions[instanceID], t)
+	db.transitionsLock.Unlock()
+	return nil
+}
+
+func (db *MemoryDB) getInstanceTransitions() (map[string][]types.InstanceTransition, error) {
+	transitions := make(map[string][]types.InstanceTransition)
+
+	db.transitionsLock.Lock()
+	for id, t := range db.transitions {
+		transitions[id] = append([]types.InstanceTransition(nil), t...)
+	}
+	db.transitionsLock.Unlock()
+
+	return transitions, nil
+}
+
+func (db *MemoryDB) updateInstanceDetails(instanceID string, d instanceDetails) error {
+	db.detailsLock.Lock()
+	db.details[instanceID] = d.copy()
+	db.detailsLock.Unlock()
+	return nil
+}
+
+func (db *MemoryDB) getInstanceDetails() (map[string]instanceDetails, error) {
+	details := make(map[string]instanceDetails)
+
+	db.detailsLock.Lock()
+	for id, d := range db.details {
+		details[id] = d.copy()
+	}
+	db.detailsLock.Unlock()
+
+	return details, nil
+}
+
+func (db *MemoryDB) updateInstanceConfig(instanceID string, config string) error {
+	db.configsLock.Lock()
+	db.configs[instanceID] = config
+	db.configsLock.Unlock()
+	return nil
+}
+
+func (db *MemoryDB) getInstanceConfig(instanceID string) (string, error) {
+	db.configsLock.Lock()
+	config := db.configs[instanceID]
+	db.configsLock.Unlock()
+
+	return config, nil
+}
+
+// sortedUsages sorts usage records by hour then instance, the order in
+// which the databases return them.
+type sortedUsages []types.InstanceUsage
+
+func (s sortedUsages) Len() int      { return len(s) }
+func (s sortedUsages) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s sortedUsages) Less(i, j int) bool {
+	if s[i].Hour.Equal(s[j].Hour) {
+		return s[i].InstanceID < s[j].InstanceID
+	}
+	return s[i].Hour.Before(s[j].Hour)
+}
+
+func usageKey(instanceID string, hour time.Time) string {
+	return instanceID + "/" + hour.UTC().Format(time.RFC3339)
+}
+
+func (db *MemoryDB) addInstanceUsage(u types.InstanceUsage) error {
+	db.usagesLock.Lock()
+	db.usages[usageKey(u.InstanceID, u.Hour)] = u
+	db.usagesLock.Unlock()
+	return nil
+}
+
+func (db *MemoryDB) getInstanceUsage(instanceID string, hour time.Time) (*types.InstanceUsage, error) {
+	db.usagesLock.Lock()
+	defer db.usagesLock.Unlock()
+
+	u, ok := db.usages[usageKey(instanceID, hour)]
+	if !ok {
+		return nil, nil
+	}
+
+	return &u, nil
+}
+
+func (db *MemoryDB) getInstanceUsages(tenantID string, start time.Time, end time.Time) ([]types.InstanceUsage, error) {
+	var usages []types.InstanceUsage
+
+	db.usagesLock.Lock()
+	for _, u := range db.usages {
+		if tenantID != "" && u.TenantID != tenantID {
+			continue
+		}
+
+		if u.Hour.Before(start) || !u.Hour.Before(end) {
+			continue
+		}
+
+		usages = append(usages, u)
+	}
+	db.usagesLock.Unlock()
+
+	sort.Sort(sortedUsages(usages))
+
+	return usages, nil
+}
+
+func (db *MemoryDB) addAuditRecord(r types.AuditRecord) error {
+	db.auditLock.Lock()
+	db.auditLog = append(db.auditLog, r)
+	db.auditLock.Unlock()
+	return nil
+}
+
+func (db *MemoryDB) getAuditRecords(filter types.AuditFilter) ([]types.AuditRecord, error) {
+	var records []types.AuditRecord
+
+	db.auditLock.Lock()
+	defer db.auditLock.Unlock()
+
+	for i := len(db.auditLog) - 1; i >= 0; i-- {
+		if filter.Limit > 0 && len(records) == filter.Limit {
+			break
+		}
+
+		if filter.Match(db.auditLog[i]) {
+			records = append(records, db.auditLog[i])
+		}
+	}
+
+	return records, nil
+}
+
+func (db *MemoryDB) updateSchedule(s types.Schedule) error {
+	db.schedulesLock.Lock()
+	db.schedules[s.ID] = s
+	db.schedulesLock.Unlock()
+	return nil
+}
+
+func (db *MemoryDB) deleteSchedule(ID string) error {
+	db.schedulesLock.Lock()
+	delete(db.schedules, ID)
+	db.schedulesLock.Unlock()
+	return nil
+}
+
+func (db *MemoryDB) getSchedules() ([]types.Schedule, error) {
+	var schedules []types.Schedule
+
+	db.schedulesLock.Lock()
+	for _, s := range db.schedules {
+		schedules = append(schedules, s)
+	}
+	db.schedulesLock.Unlock()
+
+	return schedules, nil
+}
+
+func (db *MemoryDB) updateScalingGroup(g types.ScalingGroup) error {
+	db.scalingLock.Lock()
+	db.scalingGroups[g.ID] = g
+	db.scalingLock.Unlock()
+	return nil
+}
+
+func (db *MemoryDB) deleteScalingGroup(ID string) error {
+	db.scalingLock.Lock()
+	delete(db.scalingGroups, ID)
+	delete(db.scalingHistory, ID)
+	db.scalingLock.Unlock()
+	return nil
+}
+
+func (db *MemoryDB) getScalingGroups() ([]types.ScalingGroup, error) {
+	var groups []types.ScalingGroup
+
+	db.scalingLock.Lock()
+	for _, g := range db.scalingGroups {
+		groups = append(groups, g)
+	}
+	db.scalingLock.Unlock()
+
+	return groups, nil
+}
+
+func (db *MemoryDB) addScalingActivity(a types.ScalingActivity) error {
+	db.scalingLock.Lock()
+	db.scalingHistory[a.GroupID] = append(db.scalingHistory[a.GroupID], a)
+	db.scalingLock.Unlock()
+	return nil
+}
+
+func (db *MemoryDB) getScalingActivities(groupID string) ([]types.ScalingActivity, error) {
+	db.scalingLock.Lock()
+	activities := append([]types.ScalingActivity{}, db.scalingHistory[groupID]...)
+	db.scalingLock.Unlock()
+
+	return activities, nil
+}
+
+func (db *MemoryDB) addKeypair(k types.Keypair) error {
+	db.keypairsLock.Lock()
+	db.keypairs[k.UserID+"/"+k.Name] = k
+	db.keypairsLock.Unlock()
+	return nil
+}
+
+func (db *MemoryDB) deleteKeypair(userID string, name string) error {
+	db.keypairsLock.Lock()
+	delete(db.keypairs, userID+"/"+name)
+	db.keypairsLock.Unlock()
+	return nil
+}
+
+func (db *MemoryDB) getKeypairs() ([]types.Keypair, error) {
+	var keypairs []types.Keypair
+
+	db.keypairsLock.Lock()
+	for _, k := range db.keypairs {
+		keypairs = append(keypairs, k)
+	}
+	db.keypairsLock.Unlock()
+
+	return keypairs, nil
+}
+
 func (db *MemoryDB) addNodeStat(stat payloads.Stat) error {
 	return nil
 }
@@ -309,3 +627,43 @@ func (db *MemoryDB) updateWorkload(wl workload) error {
 	db.workloads[wl.ID] = &wl
 	return nil
 }
+
+func (db *MemoryDB) deleteWorkload(ID string) error {
+	if _, ok := db.workloads[ID]; !ok {
+		return fmt.Errorf("Workload %s not found", ID)
+	}
+
+	delete(db.workloads, ID)
+	return nil
+}
+
+func copySecurityGroup(g types.SecurityGroup) types.SecurityGroup {
+	g.Rules = append([]types.SecurityGroupRule(nil), g.Rules...)
+	return g
+}
+
+func (db *MemoryDB) updateSecurityGroup(g types.SecurityGroup) error {
+	db.securityLock.Lock()
+	db.securityGroups[g.ID] = copySecurityGroup(g)
+	db.securityLock.Unlock()
+	return nil
+}
+
+func (db *MemoryDB) deleteSecurityGroup(ID string) error {
+	db.securityLock.Lock()
+	delete(db.securityGroups, ID)
+	db.securityLock.Unlock()
+	return nil
+}
+
+func (db *MemoryDB) getSecurityGroups() ([]types.SecurityGroup, error) {
+	var groups []types.SecurityGroup
+
+	db.securityLock.Lock()
+	for _, g := range db.securityGroups {
+		groups = append(groups, copySecurityGroup(g))
+	}
+	db.securityLock.Unlock()
+
+	return groups, nil
+}
@@ -0,0 +1,199 @@
+/*
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package datastore
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// Migration describes a change to the schema of the persistent store.
+type Migration struct {
+	Version     int
+	Description string
+}
+
+// migration upgrades a schema from the previous version to Version.
+// Databases created before the schema was versioned are at version 0
+// and may already contain some of the changes, migrations must be
+// written so that they can be applied to them.
+type migration struct {
+	Migration
+	up func(tx *sql.Tx) error
+}
+
+// execMigration returns a migration step executing cmds in order.
+func execMigration(cmds ...string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		for _, cmd := range cmds {
+			glog.V(2).Info("exec: ", cmd)
+
+			_, err := tx.Exec(cmd)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+// migratable is implemented by the persistent stores with a versioned
+// schema.
+type migratable interface {
+	// pendingMigrations returns the migrations init would apply to the
+	// database described by config, without modifying it.
+	pendingMigrations(config Config) ([]Migration, error)
+}
+
+// PendingMigrations returns the schema migrations Init would apply to the
+// persistent store described by config, without applying them.  An error
+// is returned if the store has a schema newer than this controller knows.
+func PendingMigrations(config Config) ([]Migration, error) {
+	m, ok := newPersistentStore(config).(migratable)
+	if !ok {
+		return nil, nil
+	}
+
+	return m.pendingMigrations(config)
+}
+
+// schema tracks the version of the schema of a database in its
+// schema_version table, one row per applied migration.
+type schema struct {
+	db         *sql.DB
+	migrations []migration
+
+	// versionTableQuery counts the schema_version tables in the
+	// database, the way to ask differs between databases.
+	versionTableQuery string
+}
+
+func (s schema) latest() int {
+	if len(s.migrations) == 0 {
+		return 0
+	}
+
+	return s.migrations[len(s.migrations)-1].Version
+}
+
+// version returns the current version of the schema, 0 if the database
+// is empty or was created before the schema was versioned.
+func (s schema) version() (int, error) {
+	var tables int
+	err := s.db.QueryRow(s.versionTableQuery).Scan(&tables)
+	if err != nil {
+		return 0, errors.Wrap(err, "look up schema_version table")
+	}
+
+	if tables == 0 {
+		return 0, nil
+	}
+
+	var version sql.NullInt64
+	err = s.db.QueryRow("SELECT MAX(version) FROM schema_version").Scan(&version)
+	if err != nil {
+		return 0, errors.Wrap(err, "read schema version")
+	}
+
+	return int(version.Int64), nil
+}
+
+// pending returns the migrations to apply to bring the schema to the
+// latest version.  It refuses databases with a newer schema, they were
+// written by a newer controller and this one could corrupt them.
+func (s schema) pending() ([]migration, error) {
+	version, err := s.version()
+	if err != nil {
+		return nil, err
+	}
+
+	if version > s.latest() {
+		return nil, fmt.Errorf("database schema version %d is newer than version %d supported by this controller", version, s.latest())
+	}
+
+	var pending []migration
+	for _, m := range s.migrations {
+		if m.Version > version {
+			pending = append(pending, m)
+		}
+	}
+
+	return pending, nil
+}
+
+// migrate applies the pending migrations, each one in its own
+// transaction.
+func (s schema) migrate() error {
+	pending, err := s.pending()
+	if err != nil {
+		return err
+	}
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	_, err = s.db.Exec(`CREATE TABLE IF NOT EXISTS schema_version
+		(
+			version integer PRIMARY KEY,
+			applied timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`)
+	if err != nil {
+		return errors.Wrap(err, "create schema_version table")
+	}
+
+	for _, m := range pending {
+		glog.Infof("Migrating database schema to version %d: %s", m.Version, m.Description)
+
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+
+		err = m.up(tx)
+		if err != nil {
+			tx.Rollback()
+			return errors.Wrapf(err, "schema migration %d", m.Version)
+		}
+
+		_, err = tx.Exec(fmt.Sprintf("INSERT INTO schema_version (version) VALUES (%d)", m.Version))
+		if err != nil {
+			tx.Rollback()
+			return errors.Wrapf(err, "schema migration %d", m.Version)
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return errors.Wrapf(err, "schema migration %d", m.Version)
+		}
+	}
+
+	return nil
+}
+
+func migrationList(migrations []migration) []Migration {
+	list := make([]Migration, 0, len(migrations))
+	for _, m := range migrations {
+		list = append(list, m.Migration)
+	}
+
+	return list
+}
@@ -0,0 +1,373 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/01org/ciao/ciao-controller/types"
+	"github.com/01org/ciao/payloads"
+)
+
+// ids of the records in the testdata fixtures
+const (
+	fixtureTenantID   = "a0b2c8f4-5e21-4e4b-8d2a-3f0e6c1b9d70"
+	fixtureWorkloadID = "7d6b3e1a-0f4c-4a8e-9b2d-5c1e8f3a6b90"
+	fixtureInstanceID = "3c9e1f7a-2b4d-4c6e-8a0f-1d3b5e7a9c20"
+)
+
+// fixtureConfig creates a persistent database from the schema-v<version>
+// fixture in a temporary directory and returns the datastore config using
+// it.  extra statements are run after the fixture.
+func fixtureConfig(t *testing.T, version int, extra string) (Config, func()) {
+	fixture, err := ioutil.ReadFile(fmt.Sprintf("testdata/schema-v%d.sql", version))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "ciao-migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	persistentURI := "file:" + filepath.Join(dir, "ciao-controller.db")
+
+	db, err := sql.Open("sqlite3", persistentURI)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(string(fixture) + extra)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("unable to load fixture v%d: %v", version, err)
+	}
+
+	config := Config{
+		PersistentURI:     persistentURI,
+		TransientURI:      "file:" + filepath.Join(dir, "ciao-controller-stats.db"),
+		InitTablesPath:    *tablesInitPath,
+		InitWorkloadsPath: *workloadsPath,
+	}
+
+	return config, func() { os.RemoveAll(dir) }
+}
+
+func TestSQLiteMigrations(t *testing.T) {
+	latest := sqliteMigrations[len(sqliteMigrations)-1].Version
+
+	for version := 1; version <= latest; version++ {
+		config, cleanup := fixtureConfig(t, version, "")
+
+		// the fixtures of the versioned schemas record their
+		// version, only the later migrations are applied to them.
+		pending, err := PendingMigrations(config)
+		if err != nil {
+			cleanup()
+			t.Fatalf("unable to list the migrations of fixture v%d: %v", version, err)
+		}
+
+		if version >= 4 && (len(pending) != latest-version || (len(pending) > 0 && pending[0].Version != version+1)) {
+			t.Errorf("fixture v%d has unexpected pending migrations %v", version, pending)
+		}
+
+		ps := &sqliteDB{}
+		err = ps.init(config)
+		if err != nil {
+			cleanup()
+			t.Fatalf("unable to upgrade fixture v%d: %v", version, err)
+		}
+
+		current, err := sqliteSchema(ps.db).version()
+		if err != nil || current != latest {
+			t.Errorf("fixture v%d upgraded to version %d, expected %d: %v", version, current, latest, err)
+		}
+
+		wl, err := ps.getWorkload(fixtureWorkloadID)
+		if err != nil {
+			t.Errorf("fixture v%d workload lost: %v", version, err)
+		} else if wl.Visibility != types.Public || wl.TenantID != "" || len(wl.Defaults) != 2 {
+			t.Errorf("fixture v%d workload not upgraded: %+v", version, wl)
+		} else if version >= 7 && (len(wl.Parameters) != 1 || wl.Parameters[0].Default != "hello") {
+			t.Errorf("fixture v%d workload parameters lost: %+v", version, wl.Parameters)
+		} else if version < 7 && wl.Parameters != nil {
+			t.Errorf("fixture v%d workload has parameters: %+v", version, wl.Parameters)
+		} else if version >= 8 && (wl.RestartPolicy == nil || wl.RestartPolicy.MaxRestarts != 3) {
+			t.Errorf("fixture v%d workload restart policy lost: %+v", version, wl.RestartPolicy)
+		} else if version < 8 && wl.RestartPolicy != nil {
+			t.Errorf("fixture v%d workload has a restart policy: %+v", version, wl.RestartPolicy)
+		} else if version >= 11 && (wl.HealthCheck == nil || wl.HealthCheck.Port != 22) {
+			t.Errorf("fixture v%d workload health check lost: %+v", version, wl.HealthCheck)
+		} else if version < 11 && wl.HealthCheck != nil {
+			t.Errorf("fixture v%d workload has a health check: %+v", version, wl.HealthCheck)
+		}
+
+		tenant, err := ps.getTenant(fixtureTenantID)
+		if err != nil || tenant == nil {
+			t.Errorf("fixture v%d tenant lost: %v", version, err)
+		} else if tenant.instances[fixtureInstanceID] == nil || !tenant.network[4096][2] {
+			t.Errorf("fixture v%d tenant instances or network lost", version)
+		}
+
+		limits := make(map[string]int)
+		if tenant != nil {
+			for _, r := range tenant.Resources {
+				limits[r.Rname] = r.Limit
+			}
+		}
+		if limits["instances"] != 10 || (version < 14) != (limits["vcpus"] == -1) {
+			t.Errorf("fixture v%d unexpected limits %v", version, limits)
+		}
+
+		err = ps.addInstanceTransition(fixtureInstanceID, types.InstanceTransition{
+			From:      types.InstancePending,
+			To:        types.InstanceRunning,
+			Timestamp: time.Now(),
+		})
+		if err != nil {
+			t.Errorf("fixture v%d unable to record transition: %v", version, err)
+		}
+
+		transitions, err := ps.getInstanceTransitions()
+		if err != nil || len(transitions[fixtureInstanceID]) == 0 {
+			t.Errorf("fixture v%d transitions not recorded: %v", version, err)
+		}
+
+		usage := types.InstanceUsage{
+			InstanceID: fixtureInstanceID,
+			TenantID:   fixtureTenantID,
+			Hour:       time.Now().UTC().Truncate(time.Hour),
+			Hours:      1,
+		}
+		err = ps.addInstanceUsage(usage)
+		if err != nil {
+			t.Errorf("fixture v%d unable to record usage: %v", version, err)
+		}
+
+		u, err := ps.getInstanceUsage(fixtureInstanceID, usage.Hour)
+		if err != nil || u == nil || *u != usage {
+			t.Errorf("fixture v%d usage not recorded: %v", version, err)
+		}
+
+		err = ps.addAuditRecord(types.AuditRecord{
+			Timestamp: time.Now(),
+			UserID:    fixtureTenantID,
+			Method:    "DELETE",
+			Outcome:   types.AuditSuccess,
+		})
+		if err != nil {
+			t.Errorf("fixture v%d unable to record audit: %v", version, err)
+		}
+
+		records, err := ps.getAuditRecords(types.AuditFilter{UserID: fixtureTenantID})
+		if err != nil || len(records) != 1 {
+			t.Errorf("fixture v%d audit not recorded: %v", version, err)
+		}
+
+		fixtureDetails, err := ps.getInstanceDetails()
+		if err != nil || (version >= 12) != (fixtureDetails[fixtureInstanceID].keyName == "fixture-key") {
+			t.Errorf("fixture v%d unexpected instance keypair %q: %v", version, fixtureDetails[fixtureInstanceID].keyName, err)
+		}
+
+		if (version >= 13) != (len(fixtureDetails[fixtureInstanceID].securityGroups) == 1) {
+			t.Errorf("fixture v%d unexpected instance security groups %v", version, fixtureDetails[fixtureInstanceID].securityGroups)
+		}
+
+		err = ps.updateInstanceDetails(fixtureInstanceID, instanceDetails{name: "server", tags: []string{"web"}})
+		if err != nil {
+			t.Errorf("fixture v%d unable to record instance details: %v", version, err)
+		}
+
+		details, err := ps.getInstanceDetails()
+		if err != nil || details[fixtureInstanceID].name != "server" {
+			t.Errorf("fixture v%d instance details not recorded: %v", version, err)
+		}
+
+		err = ps.updateInstanceDetails(fixtureInstanceID, instanceDetails{
+			healthCheck: &payloads.HealthCheck{Protocol: payloads.HealthCheckTCP, Port: 80},
+		})
+		if err != nil {
+			t.Errorf("fixture v%d unable to record instance health check: %v", version, err)
+		}
+
+		details, err = ps.getInstanceDetails()
+		if err != nil || details[fixtureInstanceID].healthCheck == nil || details[fixtureInstanceID].healthCheck.Port != 80 {
+			t.Errorf("fixture v%d instance health check not recorded: %v", version, err)
+		}
+
+		startConfig, err := ps.getInstanceConfig(fixtureInstanceID)
+		if err != nil || (version >= 8) != (startConfig != "") {
+			t.Errorf("fixture v%d unexpected instance config %q: %v", version, startConfig, err)
+		}
+
+		err = ps.updateInstanceConfig(fixtureInstanceID, "---\n...\n")
+		if err != nil {
+			t.Errorf("fixture v%d unable to record instance config: %v", version, err)
+		}
+
+		schedules, err := ps.getSchedules()
+		if err != nil || (version >= 9) != (len(schedules) == 1) {
+			t.Errorf("fixture v%d unexpected schedules %+v: %v", version, schedules, err)
+		} else if version >= 9 && schedules[0].NextRun.Hour() != 19 {
+			t.Errorf("fixture v%d schedule next run lost: %v", version, schedules[0].NextRun)
+		}
+
+		err = ps.updateSchedule(types.Schedule{
+			ID:       "migrated",
+			TenantID: fixtureTenantID,
+			Tag:      "fixture",
+			Action:   types.ScheduleDelete,
+			NextRun:  time.Now(),
+		})
+		if err != nil {
+			t.Errorf("fixture v%d unable to record schedule: %v", version, err)
+		}
+
+		groups, err := ps.getScalingGroups()
+		if err != nil || (version >= 10) != (len(groups) == 1) {
+			t.Errorf("fixture v%d unexpected scaling groups %+v: %v", version, groups, err)
+		} else if version >= 10 && (groups[0].ScaleOut == nil || groups[0].ScaleOut.Threshold != 80) {
+			t.Errorf("fixture v%d scaling group rule lost: %+v", version, groups[0].ScaleOut)
+		}
+
+		activities, err := ps.getScalingActivities("8b1d4f6a-3c5e-4a7b-9d0f-2e4c6a8b0d35")
+		if err != nil || (version >= 10) != (len(activities) == 1) {
+			t.Errorf("fixture v%d unexpected scaling activities %+v: %v", version, activities, err)
+		}
+
+		err = ps.addScalingActivity(types.ScalingActivity{
+			GroupID:   "migrated",
+			Timestamp: time.Now(),
+			From:      0,
+			To:        1,
+		})
+		if err != nil {
+			t.Errorf("fixture v%d unable to record scaling activity: %v", version, err)
+		}
+
+		keypairs, err := ps.getKeypairs()
+		if err != nil || (version >= 12) != (len(keypairs) == 1) {
+			t.Errorf("fixture v%d unexpected keypairs %+v: %v", version, keypairs, err)
+		} else if version >= 12 && (keypairs[0].Name != "fixture-key" || keypairs[0].CreateTime.Hour() != 10) {
+			t.Errorf("fixture v%d keypair lost: %+v", version, keypairs[0])
+		}
+
+		err = ps.addKeypair(types.Keypair{
+			UserID:     fixtureTenantID,
+			Name:       "migrated",
+			Type:       "ssh",
+			PublicKey:  "ssh-rsa AAAA migrated",
+			CreateTime: time.Now(),
+		})
+		if err != nil {
+			t.Errorf("fixture v%d unable to record keypair: %v", version, err)
+		}
+
+		securityGroups, err := ps.getSecurityGroups()
+		if err != nil || (version >= 13) != (len(securityGroups) == 1) {
+			t.Errorf("fixture v%d unexpected security groups %+v: %v", version, securityGroups, err)
+		} else if version >= 13 && (securityGroups[0].Name != "fixture-web" || len(securityGroups[0].Rules) != 1 ||
+			securityGroups[0].Rules[0].PortMin != 80) {
+			t.Errorf("fixture v%d security group lost: %+v", version, securityGroups[0])
+		}
+
+		err = ps.updateSecurityGroup(types.SecurityGroup{
+			ID:         "migrated",
+			TenantID:   fixtureTenantID,
+			Name:       "migrated",
+			CreateTime: time.Now(),
+		})
+		if err != nil {
+			t.Errorf("fixture v%d unable to record security group: %v", version, err)
+		}
+
+		err = ps.updateInstanceDetails(fixtureInstanceID, instanceDetails{securityGroups: []string{"migrated"}})
+		if err != nil {
+			t.Errorf("fixture v%d unable to record instance security groups: %v", version, err)
+		}
+
+		details, err = ps.getInstanceDetails()
+		if err != nil || len(details[fixtureInstanceID].securityGroups) != 1 {
+			t.Errorf("fixture v%d instance security groups not recorded: %v", version, err)
+		}
+
+		ps.disconnect()
+
+		pending, err = PendingMigrations(config)
+		if err != nil || len(pending) != 0 {
+			t.Errorf("fixture v%d still has pending migrations %v: %v", version, pending, err)
+		}
+
+		cleanup()
+	}
+}
+
+func TestSQLiteMigrationsDryRun(t *testing.T) {
+	config, cleanup := fixtureConfig(t, 1, "")
+	defer cleanup()
+
+	pending, err := PendingMigrations(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pending) != len(sqliteMigrations) {
+		t.Fatalf("expected %d pending migrations, got %v", len(sqliteMigrations), pending)
+	}
+
+	for i, m := range pending {
+		if m.Version != i+1 || m.Description == "" {
+			t.Errorf("unexpected migration %+v", m)
+		}
+	}
+
+	db, err := sql.Open("sqlite3", config.PersistentURI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	version, err := sqliteSchema(db).version()
+	if err != nil || version != 0 {
+		t.Fatalf("dry run modified the schema, version %d: %v", version, err)
+	}
+}
+
+func TestSQLiteMigrationsNewerSchema(t *testing.T) {
+	config, cleanup := fixtureConfig(t, 3, `
+		CREATE TABLE schema_version (version integer PRIMARY KEY, applied timestamp);
+		INSERT INTO schema_version (version) VALUES (1000);`)
+	defer cleanup()
+
+	_, err := PendingMigrations(config)
+	if err == nil {
+		t.Fatal("dry run accepted a newer schema")
+	}
+
+	ps := &sqliteDB{}
+	err = ps.init(config)
+	if err == nil {
+		ps.disconnect()
+		t.Fatal("init accepted a newer schema")
+	}
+}
@@ -0,0 +1,2311 @@
+/*
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package datastore
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/01org/ciao/ciao-controller/types"
+	"github.com/01org/ciao/payloads"
+	"github.com/golang/glog"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// isPostgresURI reports whether uri is a PostgreSQL DSN rather than the
+// location of an sqlite database.
+func isPostgresURI(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return false
+	}
+
+	return u.Scheme == "postgres" || u.Scheme == "postgresql"
+}
+
+// postgresDB is a persistentStore keeping all the controller state in a
+// single PostgreSQL database.  The statistics and the event log, which
+// sqliteDB keeps in a separate transient database, live in unlogged
+// tables.
+type postgresDB struct {
+	db            *sql.DB
+	tableInitPath string
+	workloadsPath string
+}
+
+// postgresMigrations are the schema migrations of the PostgreSQL
+// database, in order.  Foreign keys are not declared, sqlite does not
+// enforce the ones in its schema and the datastore relies on that when
+// deleting.
+var postgresMigrations = []migration{
+	{
+		Migration{1, "initial schema"},
+		execMigration(postgresInitialSchema...),
+	},
+	{
+		Migration{2, "hourly instance usage"},
+		execMigration(
+			`CREATE TABLE IF NOT EXISTS instance_usage
+			(
+				instance_id varchar(64),
+				tenant_id varchar(64),
+				workload_id varchar(64),
+				hour timestamp with time zone,
+				hours double precision,
+				vcpu_hours double precision,
+				memory_gb_hours double precision,
+				disk_gb_hours double precision,
+				volume_gb_hours double precision,
+				external_ip_hours double precision,
+				PRIMARY KEY(instance_id, hour)
+			)`,
+			`CREATE INDEX IF NOT EXISTS instance_usage_hour
+			ON instance_usage(hour)`,
+		),
+	},
+	{
+		Migration{3, "audit log"},
+		execMigration(
+			`CREATE TABLE IF NOT EXISTS audit_log
+			(
+				id bigserial PRIMARY KEY,
+				timestamp timestamp with time zone,
+				request_id text,
+				user_id varchar(64),
+				user_name text,
+				project_id varchar(64),
+				roles text[],
+				source_ip text,
+				service text,
+				method text,
+				resource text,
+				status integer,
+				outcome text,
+				latency_ms double precision
+			)`,
+			`CREATE INDEX IF NOT EXISTS audit_log_timestamp
+			ON audit_log(timestamp)`,
+			`CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+			BEGIN
+				RAISE EXCEPTION 'audit log is append-only';
+			END;
+			$$ LANGUAGE plpgsql`,
+			`CREATE TRIGGER audit_log_no_update_delete
+			BEFORE UPDATE OR DELETE ON audit_log
+			FOR EACH ROW EXECUTE PROCEDURE audit_log_append_only()`,
+			`CREATE TRIGGER audit_log_no_truncate
+			BEFORE TRUNCATE ON audit_log
+			FOR EACH STATEMENT EXECUTE PROCEDURE audit_log_append_only()`,
+		),
+	},
+	{
+		Migration{4, "instance names, tags and metadata"},
+		execMigration(
+			`CREATE TABLE IF NOT EXISTS instance_details
+			(
+				instance_id varchar(64) PRIMARY KEY,
+				name text NOT NULL DEFAULT '',
+				tags text NOT NULL DEFAULT '[]',
+				metadata text NOT NULL DEFAULT '{}'
+			)`,
+		),
+	},
+	{
+		Migration{5, "workload parameters"},
+		execMigration(
+			`ALTER TABLE workload_template
+			ADD COLUMN IF NOT EXISTS parameters text NOT NULL DEFAULT ''`,
+		),
+	},
+	{
+		Migration{6, "restart policies"},
+		execMigration(
+			`ALTER TABLE workload_template
+			ADD COLUMN IF NOT EXISTS restart_policy text NOT NULL DEFAULT ''`,
+			`CREATE TABLE IF NOT EXISTS instance_configs
+			(
+				instance_id varchar(64) PRIMARY KEY,
+				config text NOT NULL
+			)`,
+		),
+	},
+	{
+		Migration{7, "instance schedules"},
+		execMigration(
+			`CREATE TABLE IF NOT EXISTS schedules
+			(
+				id varchar(64) PRIMARY KEY,
+				tenant_id varchar(64),
+				instance_id varchar(64),
+				tag text,
+				action text,
+				cron text,
+				create_time timestamp with time zone,
+				last_run timestamp with time zone,
+				next_run timestamp with time zone
+			)`,
+		),
+	},
+	{
+		Migration{8, "scaling groups"},
+		execMigration(
+			`CREATE TABLE IF NOT EXISTS scaling_groups
+			(
+				id varchar(64) PRIMARY KEY,
+				tenant_id varchar(64),
+				name text,
+				workload_id varchar(64),
+				min_instances integer,
+				max_instances integer,
+				desired_instances integer,
+				scale_out text,
+				scale_in text,
+				cooldown integer,
+				create_time timestamp with time zone,
+				last_scale timestamp with time zone
+			)`,
+			`CREATE TABLE IF NOT EXISTS scaling_activities
+			(
+				id serial PRIMARY KEY,
+				group_id varchar(64),
+				timestamp timestamp with time zone,
+				from_instances integer,
+				to_instances integer,
+				reason text
+			)`,
+		),
+	},
+	{
+		Migration{9, "health checks"},
+		execMigration(
+			`ALTER TABLE workload_template
+			ADD COLUMN IF NOT EXISTS health_check text NOT NULL DEFAULT ''`,
+			`ALTER TABLE instance_details
+			ADD COLUMN IF NOT EXISTS health_check text NOT NULL DEFAULT ''`,
+		),
+	},
+	{
+		Migration{10, "keypairs"},
+		execMigration(
+			`CREATE TABLE IF NOT EXISTS keypairs
+			(
+				user_id varchar(64),
+				name text,
+				type text,
+				public_key text,
+				fingerprint text,
+				create_time timestamp with time zone,
+				PRIMARY KEY (user_id, name)
+			)`,
+			`ALTER TABLE instance_details
+			ADD COLUMN IF NOT EXISTS key_name text NOT NULL DEFAULT ''`,
+			`ALTER TABLE instance_details
+			ADD COLUMN IF NOT EXISTS public_key text NOT NULL DEFAULT ''`,
+		),
+	},
+	{
+		Migration{11, "security groups"},
+		execMigration(
+			`CREATE TABLE IF NOT EXISTS security_groups
+			(
+				id varchar(64) PRIMARY KEY,
+				tenant_id varchar(64),
+				name text,
+				description text,
+				rules text,
+				create_time timestamp with time zone
+			)`,
+			`ALTER TABLE instance_details
+			ADD COLUMN IF NOT EXISTS security_groups text NOT NULL DEFAULT ''`,
+		),
+	},
+	{
+		Migration{12, "unlimited quotas"},
+		execMigration(
+			"UPDATE limits SET max_value = -1 WHERE max_value = 0",
+		),
+	},
+}
+
+var postgresInitialSchema = []string{
+	`CREATE TABLE IF NOT EXISTS resources
+	(
+		id integer PRIMARY KEY,
+		name text
+	)`,
+	`CREATE TABLE IF NOT EXISTS tenants
+	(
+		id varchar(64) PRIMARY KEY,
+		name text NOT NULL DEFAULT '',
+		cnci_id varchar(64) NOT NULL DEFAULT '',
+		cnci_mac text NOT NULL DEFAULT '',
+		cnci_ip text NOT NULL DEFAULT ''
+	)`,
+	`CREATE TABLE IF NOT EXISTS limits
+	(
+		resource_id integer,
+		tenant_id varchar(64),
+		max_value integer,
+		PRIMARY KEY(tenant_id, resource_id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS instances
+	(
+		id varchar(64) PRIMARY KEY,
+		tenant_id varchar(64),
+		workload_id varchar(64),
+		mac_address text,
+		ip text,
+		create_time timestamptz,
+		UNIQUE(tenant_id, ip, mac_address)
+	)`,
+	`CREATE TABLE IF NOT EXISTS instance_transitions
+	(
+		id serial PRIMARY KEY,
+		instance_id varchar(64),
+		from_state text,
+		to_state text,
+		timestamp timestamptz
+	)`,
+	`CREATE TABLE IF NOT EXISTS workload_template
+	(
+		id varchar(64) PRIMARY KEY,
+		description text,
+		filename text,
+		fw_type text,
+		vm_type text,
+		image_id varchar(64),
+		image_name text,
+		internal boolean,
+		tenant_id varchar(64) NOT NULL DEFAULT '',
+		visibility text NOT NULL DEFAULT 'public'
+	)`,
+	`CREATE TABLE IF NOT EXISTS workload_resources
+	(
+		workload_id varchar(64),
+		resource_id integer,
+		default_value integer,
+		estimated_value integer,
+		mandatory boolean,
+		PRIMARY KEY(workload_id, resource_id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS workload_storage
+	(
+		workload_id varchar(64),
+		volume_id varchar(64),
+		bootable boolean,
+		ephemeral boolean,
+		size integer,
+		source_type text,
+		source_id varchar(64),
+		tag text
+	)`,
+	`CREATE TABLE IF NOT EXISTS usage
+	(
+		instance_id varchar(64),
+		resource_id integer,
+		value integer,
+		PRIMARY KEY(instance_id, resource_id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS tenant_network
+	(
+		tenant_id varchar(64),
+		subnet integer,
+		rest integer
+	)`,
+	`CREATE TABLE IF NOT EXISTS block_data
+	(
+		id varchar(64) PRIMARY KEY,
+		tenant_id varchar(64),
+		size integer,
+		state text,
+		create_time timestamptz,
+		name text,
+		description text
+	)`,
+	`CREATE TABLE IF NOT EXISTS attachments
+	(
+		id varchar(64) PRIMARY KEY,
+		instance_id varchar(64),
+		block_id varchar(64),
+		ephemeral boolean,
+		boot boolean
+	)`,
+	`CREATE TABLE IF NOT EXISTS pools
+	(
+		id varchar(64) PRIMARY KEY,
+		name text,
+		free integer,
+		total integer
+	)`,
+	`CREATE TABLE IF NOT EXISTS subnet_pool
+	(
+		id varchar(64) PRIMARY KEY,
+		pool_id varchar(64),
+		cidr text
+	)`,
+	`CREATE TABLE IF NOT EXISTS address_pool
+	(
+		id varchar(64) PRIMARY KEY,
+		pool_id varchar(64),
+		address text
+	)`,
+	`CREATE TABLE IF NOT EXISTS mapped_ips
+	(
+		id varchar(64) PRIMARY KEY,
+		external_ip text,
+		instance_id varchar(64),
+		pool_id varchar(64)
+	)`,
+	`CREATE UNLOGGED TABLE IF NOT EXISTS log
+	(
+		id serial PRIMARY KEY,
+		tenant_id varchar(64),
+		type text,
+		message text,
+		timestamp timestamptz NOT NULL DEFAULT now()
+	)`,
+	`CREATE UNLOGGED TABLE IF NOT EXISTS node_statistics
+	(
+		id serial PRIMARY KEY,
+		node_id varchar(64),
+		mem_total_mb integer,
+		mem_available_mb integer,
+		disk_total_mb integer,
+		disk_available_mb integer,
+		load integer,
+		cpus_online integer,
+		timestamp timestamptz NOT NULL DEFAULT now()
+	)`,
+	`CREATE UNLOGGED TABLE IF NOT EXISTS instance_statistics
+	(
+		id serial PRIMARY KEY,
+		instance_id varchar(64),
+		memory_usage_mb integer,
+		disk_usage_mb integer,
+		cpu_usage integer,
+		state text,
+		node_id varchar(64),
+		ssh_ip text,
+		ssh_port integer,
+		timestamp timestamptz NOT NULL DEFAULT now()
+	)`,
+	`CREATE INDEX IF NOT EXISTS instance_statistics_instance_id
+	ON instance_statistics(instance_id, timestamp)`,
+	`CREATE UNLOGGED TABLE IF NOT EXISTS frame_statistics
+	(
+		id serial PRIMARY KEY,
+		label text,
+		type text,
+		operand text,
+		start_timestamp text,
+		end_timestamp text
+	)`,
+	`CREATE UNLOGGED TABLE IF NOT EXISTS trace_data
+	(
+		id serial PRIMARY KEY,
+		frame_id integer,
+		ssntp_uuid varchar(64),
+		tx_timestamp text,
+		rx_timestamp text
+	)`,
+}
+
+func postgresSchema(db *sql.DB) schema {
+	return schema{
+		db:                db,
+		migrations:        postgresMigrations,
+		versionTableQuery: "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = 'schema_version'",
+	}
+}
+
+func (ds *postgresDB) pendingMigrations(config Config) ([]Migration, error) {
+	db, err := sql.Open("postgres", config.PersistentURI)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	pending, err := postgresSchema(db).pending()
+	if err != nil {
+		return nil, err
+	}
+
+	return migrationList(pending), nil
+}
+
+// postgresSeeds lists the tables populated from the csv files of the
+// tables init path along with the columns of the csv records.
+var postgresSeeds = []struct {
+	table   string
+	columns []string
+}{
+	{"resources", []string{"id", "name"}},
+	{"tenants", []string{"id", "name", "cnci_mac"}},
+	{"limits", []string{"resource_id", "tenant_id", "max_value"}},
+	{"workload_template", []string{"id", "description", "filename", "fw_type", "vm_type", "image_id", "image_name", "internal"}},
+	{"workload_resources", []string{"workload_id", "resource_id", "default_value", "estimated_value", "mandatory"}},
+	{"workload_storage", []string{"workload_id", "volume_id", "bootable", "ephemeral", "size", "source_type", "source_id", "tag"}},
+	{"pools", []string{"id", "name", "free", "total"}},
+	{"subnet_pool", []string{"id", "pool_id", "cidr"}},
+	{"address_pool", []string{"id", "pool_id", "address"}},
+	{"mapped_ips", []string{"id", "external_ip", "instance_id", "pool_id"}},
+}
+
+// latestInstanceStats selects the most recent statistics reported for
+// each instance.
+const latestInstanceStats = `
+	latest AS
+	(
+		SELECT DISTINCT ON (instance_id)
+			instance_id,
+			state,
+			ssh_ip,
+			ssh_port,
+			node_id
+		FROM instance_statistics
+		ORDER BY instance_id, timestamp DESC, id DESC
+	)`
+
+// init connects to the database named by the persistent URI and brings
+// its schema up to date.  A new database is populated with initial data
+// from the csv files.
+func (ds *postgresDB) init(config Config) error {
+	db, err := sql.Open("postgres", config.PersistentURI)
+	if err != nil {
+		return errors.Wrap(err, "open postgres database")
+	}
+
+	err = db.Ping()
+	if err != nil {
+		db.Close()
+		return errors.Wrap(err, "connect to postgres database")
+	}
+
+	ds.db = db
+	ds.tableInitPath = config.InitTablesPath
+	ds.workloadsPath = config.InitWorkloadsPath
+
+	s := postgresSchema(db)
+
+	version, err := s.version()
+	if err != nil {
+		return err
+	}
+
+	err = s.migrate()
+	if err != nil {
+		return err
+	}
+
+	if version > 0 {
+		return nil
+	}
+
+	for _, seed := range postgresSeeds {
+		err = ds.populate(seed.table, seed.columns)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// populate inserts the records of the csv file named after table.  A
+// missing file is not an error.
+func (ds *postgresDB) populate(table string, columns []string) error {
+	f, err := os.Open(fmt.Sprintf("%s/%s.csv", ds.tableInitPath, table))
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.TrimLeadingSpace = true
+	r.Comment = '#'
+
+	records, err := r.ReadAll()
+	if err != nil {
+		return errors.Wrapf(err, "read %s.csv", table)
+	}
+
+	params := make([]string, len(columns))
+	for i := range params {
+		params[i] = fmt.Sprintf("$%d", i+1)
+	}
+
+	cmd := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) ON CONFLICT DO NOTHING",
+		table, strings.Join(columns, ", "), strings.Join(params, ", "))
+
+	for _, record := range records {
+		if len(record) < len(columns) {
+			glog.Warningf("short record in %s.csv: %v", table, record)
+			continue
+		}
+
+		args := make([]interface{}, len(columns))
+		for i := range columns {
+			args[i] = record[i]
+		}
+
+		_, err = ds.db.Exec(cmd, args...)
+		if err != nil {
+			glog.V(2).Infof("could not add %s: %v", table, err)
+		}
+	}
+
+	return nil
+}
+
+func (ds *postgresDB) disconnect() {
+	ds.db.Close()
+}
+
+func (ds *postgresDB) logEvent(tenantID string, eventType string, message string) error {
+	_, err := ds.db.Exec("INSERT INTO log (tenant_id, type, message) VALUES ($1, $2, $3)", tenantID, eventType, message)
+	return err
+}
+
+func (ds *postgresDB) clearLog() error {
+	_, err := ds.db.Exec("DELETE FROM log")
+	if err != nil {
+		glog.V(2).Info("could not clear log: ", err)
+	}
+
+	return err
+}
+
+func (ds *postgresDB) getEventLog() ([]*types.LogEntry, error) {
+	rows, err := ds.db.Query("SELECT timestamp, tenant_id, type, message FROM log ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	logEntries := make([]*types.LogEntry, 0)
+	for rows.Next() {
+		var e types.LogEntry
+		err = rows.Scan(&e.Timestamp, &e.TenantID, &e.EventType, &e.Message)
+		if err != nil {
+			return nil, err
+		}
+		logEntries = append(logEntries, &e)
+	}
+
+	return logEntries, rows.Err()
+}
+
+func (ds *postgresDB) getCNCIWorkloadID() (string, error) {
+	var ID string
+
+	err := ds.db.QueryRow("SELECT id FROM workload_template WHERE description = 'CNCI'").Scan(&ID)
+	if err != nil {
+		return "", err
+	}
+
+	return ID, nil
+}
+
+func (ds *postgresDB) getConfig(ID string) (string, error) {
+	var configFile string
+
+	err := ds.db.QueryRow("SELECT filename FROM workload_template WHERE id = $1", ID).Scan(&configFile)
+	if err != nil {
+		return "", err
+	}
+
+	bytes, err := ioutil.ReadFile(fmt.Sprintf("%s/%s", ds.workloadsPath, configFile))
+	if err != nil {
+		return "", err
+	}
+
+	return string(bytes), nil
+}
+
+func (ds *postgresDB) getWorkloadDefaults(ID string) ([]payloads.RequestedResource, error) {
+	query := `SELECT resources.name, default_value, mandatory FROM workload_resources
+		  JOIN resources
+		  ON workload_resources.resource_id = resources.id
+		  WHERE workload_id = $1`
+
+	rows, err := ds.db.Query(query, ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var defaults []payloads.RequestedResource
+
+	for rows.Next() {
+		var r payloads.RequestedResource
+		var rname string
+
+		err = rows.Scan(&rname, &r.Value, &r.Mandatory)
+		if err != nil {
+			return nil, err
+		}
+
+		r.Type = payloads.Resource(rname)
+		defaults = append(defaults, r)
+	}
+
+	return defaults, rows.Err()
+}
+
+func (ds *postgresDB) getWorkloadStorage(ID string) ([]types.StorageResource, error) {
+	query := `SELECT volume_id, bootable, ephemeral, size,
+			 source_type, source_id, tag
+		  FROM workload_storage
+		  WHERE workload_id = $1`
+
+	rows, err := ds.db.Query(query, ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []types.StorageResource{}
+
+	for rows.Next() {
+		var r types.StorageResource
+		var sourceType string
+
+		err := rows.Scan(&r.ID, &r.Bootable, &r.Ephemeral, &r.Size, &sourceType, &r.SourceID, &r.Tag)
+		if err != nil {
+			return []types.StorageResource{}, err
+		}
+
+		r.SourceType = types.SourceType(sourceType)
+		res = append(res, r)
+	}
+
+	return res, rows.Err()
+}
+
+const workloadColumns = `id, description, filename, fw_type, vm_type,
+			 image_id, image_name, tenant_id, visibility, parameters,
+			 restart_policy, health_check`
+
+func (ds *postgresDB) scanWorkload(row interface {
+	Scan(...interface{}) error
+}) (*workload, error) {
+	wl := new(workload)
+
+	var VMType string
+	var visibility string
+	var parameters string
+	var restartPolicy string
+	var healthCheck string
+
+	err := row.Scan(&wl.ID, &wl.Description, &wl.filename, &wl.FWType, &VMType, &wl.ImageID, &wl.ImageName, &wl.TenantID, &visibility, &parameters, &restartPolicy, &healthCheck)
+	if err != nil {
+		return nil, err
+	}
+
+	wl.VMType = payloads.Hypervisor(VMType)
+	wl.Visibility = types.Visibility(visibility)
+
+	err = wl.unmarshalParameters(parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	err = wl.unmarshalRestartPolicy(restartPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	wl.HealthCheck, err = unmarshalHealthCheck(healthCheck)
+	if err != nil {
+		return nil, err
+	}
+
+	wl.Config, err = ds.getConfig(wl.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	wl.Defaults, err = ds.getWorkloadDefaults(wl.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	wl.Storage, err = ds.getWorkloadStorage(wl.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return wl, nil
+}
+
+func (ds *postgresDB) getWorkload(id string) (*workload, error) {
+	row := ds.db.QueryRow("SELECT "+workloadColumns+" FROM workload_template WHERE id = $1", id)
+
+	wl, err := ds.scanWorkload(row)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("Workload %q not found", id)
+	}
+
+	return wl, err
+}
+
+func (ds *postgresDB) getWorkloads() ([]*workload, error) {
+	rows, err := ds.db.Query("SELECT " + workloadColumns + " FROM workload_template WHERE internal = false")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var workloads []*workload
+
+	for rows.Next() {
+		wl, err := ds.scanWorkload(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		workloads = append(workloads, wl)
+	}
+
+	return workloads, rows.Err()
+}
+
+func (ds *postgresDB) updateWorkload(w workload) error {
+	tx, err := ds.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	// replace the resources and storage of an existing workload.
+	for _, table := range []string{"workload_resources", "workload_storage"} {
+		_, err = tx.Exec("DELETE FROM "+table+" WHERE workload_id = $1", w.ID)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	cmd := `INSERT INTO workload_resources (workload_id, resource_id, default_value, estimated_value, mandatory)
+		SELECT $1, resources.id, $2, $2, $3
+		FROM resources
+		WHERE name = $4`
+
+	for _, d := range w.Defaults {
+		_, err = tx.Exec(cmd, w.ID, d.Value, d.Mandatory, string(d.Type))
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	for _, s := range w.Storage {
+		_, err = tx.Exec("INSERT INTO workload_storage (workload_id, volume_id, bootable, ephemeral, size, source_type, source_id, tag) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
+			w.ID, s.ID, s.Bootable, s.Ephemeral, s.Size, string(s.SourceType), s.SourceID, s.Tag)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	err = ioutil.WriteFile(fmt.Sprintf("%s/%s", ds.workloadsPath, w.filename), []byte(w.Config), 0644)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	parameters, err := w.marshalParameters()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	restartPolicy, err := w.marshalRestartPolicy()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	healthCheck, err := marshalHealthCheck(w.HealthCheck)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO workload_template (id, description, filename, fw_type, vm_type, image_id, image_name, internal, tenant_id, visibility, parameters, restart_policy, health_check)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, false, $8, $9, $10, $11, $12)
+			  ON CONFLICT (id) DO UPDATE
+			  SET description = EXCLUDED.description,
+			      filename = EXCLUDED.filename,
+			      fw_type = EXCLUDED.fw_type,
+			      vm_type = EXCLUDED.vm_type,
+			      image_id = EXCLUDED.image_id,
+			      image_name = EXCLUDED.image_name,
+			      tenant_id = EXCLUDED.tenant_id,
+			      visibility = EXCLUDED.visibility,
+			      parameters = EXCLUDED.parameters,
+			      restart_policy = EXCLUDED.restart_policy,
+			      health_check = EXCLUDED.health_check`,
+		w.ID, w.Description, w.filename, w.FWType, string(w.VMType), w.ImageID, w.ImageName, w.TenantID, string(w.Visibility), parameters, restartPolicy, healthCheck)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (ds *postgresDB) deleteWorkload(ID string) error {
+	var filename string
+	err := ds.db.QueryRow("SELECT filename FROM workload_template WHERE id = $1 AND internal = false", ID).Scan(&filename)
+	if err != nil {
+		return err
+	}
+
+	tx, err := ds.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	for _, table := range []string{"workload_resources", "workload_storage"} {
+		_, err = tx.Exec("DELETE FROM "+table+" WHERE workload_id = $1", ID)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	_, err = tx.Exec("DELETE FROM workload_template WHERE id = $1", ID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	// the csv initialised workloads share their config files
+	var users int
+	err = ds.db.QueryRow("SELECT COUNT(*) FROM workload_template WHERE filename = $1", filename).Scan(&users)
+	if err == nil && users == 0 {
+		os.Remove(fmt.Sprintf("%s/%s", ds.workloadsPath, filename))
+	}
+
+	return nil
+}
+
+func (ds *postgresDB) addLimit(tenantID string, resourceID int, limit int) error {
+	_, err := ds.db.Exec(`INSERT INTO limits (resource_id, tenant_id, max_value) VALUES ($1, $2, $3)
+			      ON CONFLICT (tenant_id, resource_id) DO UPDATE SET max_value = EXCLUDED.max_value`,
+		resourceID, tenantID, limit)
+	return err
+}
+
+func (ds *postgresDB) addTenant(ID string, MAC string) error {
+	_, err := ds.db.Exec("INSERT INTO tenants (id, cnci_mac) VALUES ($1, $2) ON CONFLICT DO NOTHING", ID, MAC)
+	return err
+}
+
+func (ds *postgresDB) getTenantResources(ID string) ([]*types.Resource, error) {
+	query := `WITH instances_usage AS
+		 (
+			 SELECT resource_id, value
+			 FROM usage
+			 JOIN instances
+			 ON usage.instance_id = instances.id
+			 WHERE instances.tenant_id = $1
+		 )
+		 SELECT resources.name, resources.id, limits.max_value,
+		 CASE WHEN resources.id = 1 THEN
+		 (
+			 SELECT COUNT(instances.id)
+			 FROM instances
+			 WHERE instances.tenant_id = $1
+		 )
+		 ELSE SUM(instances_usage.value)
+		 END
+		 FROM resources
+		 LEFT JOIN instances_usage
+		 ON instances_usage.resource_id = resources.id
+		 LEFT JOIN limits
+		 ON resources.id = limits.resource_id
+		 AND limits.tenant_id = $1
+		 GROUP BY resources.id, resources.name, limits.max_value
+		 ORDER BY resources.id`
+
+	rows, err := ds.db.Query(query, ID)
+	if err != nil {
+		glog.Warning("Failed to get tenant usage")
+		return nil, err
+	}
+	defer rows.Close()
+
+	var resources []*types.Resource
+
+	for rows.Next() {
+		var sqlMaxVal sql.NullInt64
+		var sqlCurVal sql.NullInt64
+
+		r := types.Resource{
+			Limit: -1,
+		}
+
+		err = rows.Scan(&r.Rname, &r.Rtype, &sqlMaxVal, &sqlCurVal)
+		if err != nil {
+			return nil, err
+		}
+
+		if sqlMaxVal.Valid {
+			r.Limit = int(sqlMaxVal.Int64)
+		}
+
+		if sqlCurVal.Valid {
+			r.Usage = int(sqlCurVal.Int64)
+		}
+
+		resources = append(resources, &r)
+	}
+
+	return resources, rows.Err()
+}
+
+func (ds *postgresDB) getTenantNetwork(t *tenant) error {
+	t.network = make(map[int]map[int]bool)
+
+	rows, err := ds.db.Query("SELECT subnet, rest FROM tenant_network WHERE tenant_id = $1", t.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var subnetInt int
+		var rest int
+
+		err = rows.Scan(&subnetInt, &rest)
+		if err != nil {
+			return err
+		}
+
+		_, ok := t.network[subnetInt]
+		if !ok {
+			t.network[subnetInt] = make(map[int]bool)
+		}
+
+		/* Only add to the subnet list for the first host */
+		if len(t.network[subnetInt]) == 0 {
+			t.subnets = append(t.subnets, subnetInt)
+		}
+
+		t.network[subnetInt][rest] = true
+	}
+
+	return rows.Err()
+}
+
+// fillTenant reads the resources, network, instances and devices of
+// a tenant.
+func (ds *postgresDB) fillTenant(t *tenant) error {
+	var err error
+
+	t.Resources, err = ds.getTenantResources(t.ID)
+	if err != nil {
+		return err
+	}
+
+	err = ds.getTenantNetwork(t)
+	if err != nil {
+		return err
+	}
+
+	t.instances, err = ds.getTenantInstances(t.ID)
+	if err != nil {
+		return err
+	}
+
+	t.devices, err = ds.getTenantDevices(t.ID)
+
+	return err
+}
+
+const tenantColumns = "id, name, cnci_id, cnci_mac, cnci_ip"
+
+func (ds *postgresDB) getTenant(ID string) (*tenant, error) {
+	t := &tenant{}
+
+	err := ds.db.QueryRow("SELECT "+tenantColumns+" FROM tenants WHERE id = $1", ID).Scan(&t.ID, &t.Name, &t.CNCIID, &t.CNCIMAC, &t.CNCIIP)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			// not an error, it's just not there.
+			err = nil
+		}
+
+		return nil, err
+	}
+
+	return t, ds.fillTenant(t)
+}
+
+func (ds *postgresDB) getTenants() ([]*tenant, error) {
+	rows, err := ds.db.Query("SELECT " + tenantColumns + " FROM tenants")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tenants []*tenant
+
+	for rows.Next() {
+		t := &tenant{}
+
+		err = rows.Scan(&t.ID, &t.Name, &t.CNCIID, &t.CNCIMAC, &t.CNCIIP)
+		if err != nil {
+			return nil, err
+		}
+
+		tenants = append(tenants, t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, t := range tenants {
+		err = ds.fillTenant(t)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return tenants, nil
+}
+
+func (ds *postgresDB) updateTenant(t *tenant) error {
+	_, err := ds.db.Exec("UPDATE tenants SET name = $1, cnci_id = $2, cnci_mac = $3, cnci_ip = $4 WHERE id = $5", t.Name, t.CNCIID, t.CNCIMAC, t.CNCIIP, t.ID)
+	return err
+}
+
+func (ds *postgresDB) deleteTenant(ID string) error {
+	tx, err := ds.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	for _, table := range []string{"limits", "tenant_network"} {
+		_, err = tx.Exec("DELETE FROM "+table+" WHERE tenant_id = $1", ID)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	_, err = tx.Exec("DELETE FROM tenants WHERE id = $1", ID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (ds *postgresDB) claimTenantIP(tenantID string, subnetInt int, rest int) error {
+	_, err := ds.db.Exec("INSERT INTO tenant_network (tenant_id, subnet, rest) VALUES ($1, $2, $3)", tenantID, subnetInt, rest)
+	return err
+}
+
+func (ds *postgresDB) releaseTenantIP(tenantID string, subnetInt int, rest int) error {
+	_, err := ds.db.Exec("DELETE FROM tenant_network WHERE tenant_id = $1 AND subnet = $2 AND rest = $3", tenantID, subnetInt, rest)
+	return err
+}
+
+// queryInstances returns the instances matching the where clause along
+// with their latest reported state.
+func (ds *postgresDB) queryInstances(where string, args ...interface{}) ([]*types.Instance, error) {
+	query := `WITH ` + latestInstanceStats + `
+	SELECT	instances.id,
+		instances.tenant_id,
+		COALESCE(latest.state, '` + payloads.ComputeStatusPending + `'),
+		instances.workload_id,
+		COALESCE(latest.ssh_ip, 'Not Assigned'),
+		latest.ssh_port,
+		COALESCE(latest.node_id, 'Not Assigned'),
+		instances.mac_address,
+		instances.ip
+	FROM instances
+	LEFT JOIN latest
+	ON instances.id = latest.instance_id
+	` + where
+
+	rows, err := ds.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var instances []*types.Instance
+
+	for rows.Next() {
+		var i types.Instance
+		var sshPort sql.NullInt64
+
+		err = rows.Scan(&i.ID, &i.TenantID, &i.State, &i.WorkloadID, &i.SSHIP, &sshPort, &i.NodeID, &i.MACAddress, &i.IPAddress)
+		if err != nil {
+			return nil, err
+		}
+
+		if sshPort.Valid {
+			i.SSHPort = int(sshPort.Int64)
+		}
+
+		instances = append(instances, &i)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, i := range instances {
+		defaults, err := ds.getWorkloadDefaults(i.WorkloadID)
+		if err != nil {
+			return nil, err
+		}
+
+		i.Usage = make(map[string]int)
+		for _, d := range defaults {
+			i.Usage[string(d.Type)] = d.Value
+		}
+	}
+
+	return instances, nil
+}
+
+func (ds *postgresDB) getInstances() ([]*types.Instance, error) {
+	return ds.queryInstances("")
+}
+
+func (ds *postgresDB) getTenantInstances(tenantID string) (map[string]*types.Instance, error) {
+	list, err := ds.queryInstances("WHERE instances.tenant_id = $1", tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	instances := make(map[string]*types.Instance)
+	for _, i := range list {
+		instances[i.ID] = i
+	}
+
+	return instances, nil
+}
+
+func (ds *postgresDB) addInstance(instance *types.Instance) error {
+	_, err := ds.db.Exec("INSERT INTO instances (id, tenant_id, workload_id, mac_address, ip, create_time) VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT DO NOTHING",
+		instance.ID, instance.TenantID, instance.WorkloadID, instance.MACAddress, instance.IPAddress, instance.CreateTime)
+	if err != nil {
+		return err
+	}
+
+	cmd := `INSERT INTO usage (instance_id, resource_id, value)
+		SELECT $1, resources.id, $2
+		FROM resources
+		WHERE name = $3
+		ON CONFLICT DO NOTHING`
+
+	for key, val := range instance.Usage {
+		_, err = ds.db.Exec(cmd, instance.ID, val, key)
+		if err != nil {
+			glog.V(2).Info(err)
+			// but keep going
+		}
+	}
+
+	return nil
+}
+
+func (ds *postgresDB) deleteInstance(instanceID string) error {
+	tx, err := ds.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	for _, cmd := range []string{
+		"DELETE FROM instances WHERE id = $1",
+		"DELETE FROM usage WHERE instance_id = $1",
+		"DELETE FROM instance_transitions WHERE instance_id = $1",
+		"DELETE FROM instance_details WHERE instance_id = $1",
+		"DELETE FROM instance_configs WHERE instance_id = $1",
+	} {
+		_, err = tx.Exec(cmd, instanceID)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (ds *postgresDB) addInstanceTransition(instanceID string, t types.InstanceTransition) error {
+	_, err := ds.db.Exec("INSERT INTO instance_transitions (instance_id, from_state, to_state, timestamp) VALUES ($1, $2, $3, $4)",
+		instanceID, string(t.From), string(t.To), t.Timestamp)
+	return err
+}
+
+func (ds *postgresDB) getInstanceTransitions() (map[string][]types.InstanceTransition, error) {
+	rows, err := ds.db.Query("SELECT instance_id, from_state, to_state, timestamp FROM instance_transitions ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transitions := make(map[string][]types.InstanceTransition)
+
+	for rows.Next() {
+		var instanceID string
+		var t types.InstanceTransition
+
+		err = rows.Scan(&instanceID, &t.From, &t.To, &t.Timestamp)
+		if err != nil {
+			return nil, err
+		}
+
+		transitions[instanceID] = append(transitions[instanceID], t)
+	}
+
+	return transitions, rows.Err()
+}
+
+func (ds *postgresDB) updateInstanceDetails(instanceID string, d instanceDetails) error {
+	tags, metadata, healthCheck, securityGroups, err := d.marshal()
+	if err != nil {
+		return err
+	}
+
+	_, err = ds.db.Exec(`INSERT INTO instance_details (instance_id, name, tags, metadata, health_check, key_name, public_key, security_groups)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (instance_id) DO UPDATE SET
+			name = EXCLUDED.name,
+			tags = EXCLUDED.tags,
+			metadata = EXCLUDED.metadata,
+			health_check = EXCLUDED.health_check,
+			key_name = EXCLUDED.key_name,
+			public_key = EXCLUDED.public_key,
+			security_groups = EXCLUDED.security_groups`,
+		instanceID, d.name, tags, metadata, healthCheck, d.keyName, d.publicKey, securityGroups)
+	return err
+}
+
+func (ds *postgresDB) getInstanceDetails() (map[string]instanceDetails, error) {
+	rows, err := ds.db.Query("SELECT instance_id, name, tags, metadata, health_check, key_name, public_key, security_groups FROM instance_details")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	details := make(map[string]instanceDetails)
+
+	for rows.Next() {
+		var instanceID, name, tags, metadata, healthCheck, keyName, publicKey, securityGroups string
+
+		err = rows.Scan(&instanceID, &name, &tags, &metadata, &healthCheck, &keyName, &publicKey,
+			&securityGroups)
+		if err != nil {
+			return nil, err
+		}
+
+		d, err := unmarshalInstanceDetails(name, tags, metadata, healthCheck, keyName, publicKey,
+			securityGroups)
+		if err != nil {
+			return nil, err
+		}
+
+		details[instanceID] = d
+	}
+
+	return details, rows.Err()
+}
+
+func (ds *postgresDB) updateInstanceConfig(instanceID string, config string) error {
+	_, err := ds.db.Exec(`INSERT INTO instance_configs (instance_id, config)
+		VALUES ($1, $2)
+		ON CONFLICT (instance_id) DO UPDATE SET config = EXCLUDED.config`,
+		instanceID, config)
+	return err
+}
+
+func (ds *postgresDB) getInstanceConfig(instanceID string) (string, error) {
+	var config string
+
+	err := ds.db.QueryRow("SELECT config FROM instance_configs WHERE instance_id = $1", instanceID).Scan(&config)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+
+	return config, err
+}
+
+func (ds *postgresDB) addInstanceUsage(u types.InstanceUsage) error {
+	_, err := ds.db.Exec(`INSERT INTO instance_usage
+		(instance_id, tenant_id, workload_id, hour, hours, vcpu_hours, memory_gb_hours, disk_gb_hours, volume_gb_hours, external_ip_hours)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (instance_id, hour) DO UPDATE SET
+			hours = EXCLUDED.hours,
+			vcpu_hours = EXCLUDED.vcpu_hours,
+			memory_gb_hours = EXCLUDED.memory_gb_hours,
+			disk_gb_hours = EXCLUDED.disk_gb_hours,
+			volume_gb_hours = EXCLUDED.volume_gb_hours,
+			external_ip_hours = EXCLUDED.external_ip_hours`,
+		u.InstanceID, u.TenantID, u.WorkloadID, u.Hour.UTC(), u.Hours, u.VCPUHours,
+		u.MemoryGBHours, u.DiskGBHours, u.VolumeGBHours, u.ExternalIPHours)
+	return err
+}
+
+func (ds *postgresDB) queryInstanceUsages(where string, args ...interface{}) ([]types.InstanceUsage, error) {
+	rows, err := ds.db.Query(`SELECT instance_id, tenant_id, workload_id, hour, hours, vcpu_hours,
+		memory_gb_hours, disk_gb_hours, volume_gb_hours, external_ip_hours
+		FROM instance_usage WHERE `+where+` ORDER BY hour, instance_id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var usages []types.InstanceUsage
+
+	for rows.Next() {
+		var u types.InstanceUsage
+
+		err = rows.Scan(&u.InstanceID, &u.TenantID, &u.WorkloadID, &u.Hour, &u.Hours, &u.VCPUHours,
+			&u.MemoryGBHours, &u.DiskGBHours, &u.VolumeGBHours, &u.ExternalIPHours)
+		if err != nil {
+			return nil, err
+		}
+
+		u.Hour = u.Hour.UTC()
+		usages = append(usages, u)
+	}
+
+	return usages, rows.Err()
+}
+
+func (ds *postgresDB) getInstanceUsage(instanceID string, hour time.Time) (*types.InstanceUsage, error) {
+	usages, err := ds.queryInstanceUsages("instance_id = $1 AND hour = $2", instanceID, hour.UTC())
+	if err != nil || len(usages) == 0 {
+		return nil, err
+	}
+
+	return &usages[0], nil
+}
+
+func (ds *postgresDB) getInstanceUsages(tenantID string, start time.Time, end time.Time) ([]types.InstanceUsage, error) {
+	if tenantID == "" {
+		return ds.queryInstanceUsages("hour >= $1 AND hour < $2", start.UTC(), end.UTC())
+	}
+
+	return ds.queryInstanceUsages("tenant_id = $1 AND hour >= $2 AND hour < $3", tenantID, start.UTC(), end.UTC())
+}
+
+func (ds *postgresDB) addAuditRecord(r types.AuditRecord) error {
+	_, err := ds.db.Exec(`INSERT INTO audit_log
+		(timestamp, request_id, user_id, user_name, project_id, roles, source_ip, service, method, resource, status, outcome, latency_ms)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`,
+		r.Timestamp.UTC(), r.RequestID, r.UserID, r.UserName, r.ProjectID, pq.Array(r.Roles),
+		r.SourceIP, r.Service, r.Method, r.Resource, r.Status, r.Outcome, r.LatencyMS)
+	return err
+}
+
+func (ds *postgresDB) getAuditRecords(filter types.AuditFilter) ([]types.AuditRecord, error) {
+	var where []string
+	var args []interface{}
+
+	add := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		where = append(where, strings.Replace(cond, "?", fmt.Sprintf("$%d", len(args)), -1))
+	}
+
+	if !filter.Start.IsZero() {
+		add("timestamp >= ?", filter.Start.UTC())
+	}
+
+	if !filter.End.IsZero() {
+		add("timestamp < ?", filter.End.UTC())
+	}
+
+	if filter.UserID != "" {
+		add("user_id = ?", filter.UserID)
+	}
+
+	if filter.ProjectID != "" {
+		add("project_id = ?", filter.ProjectID)
+	}
+
+	if filter.Resource != "" {
+		add("substr(resource, 1, length(?)) = ?", filter.Resource)
+	}
+
+	if filter.Outcome != "" {
+		add("outcome = ?", filter.Outcome)
+	}
+
+	query := `SELECT timestamp, request_id, user_id, user_name, project_id, roles, source_ip,
+		service, method, resource, status, outcome, latency_ms
+		FROM audit_log`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY id DESC"
+	if filter.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", filter.Limit)
+	}
+
+	rows, err := ds.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []types.AuditRecord
+
+	for rows.Next() {
+		var r types.AuditRecord
+
+		err = rows.Scan(&r.Timestamp, &r.RequestID, &r.UserID, &r.UserName, &r.ProjectID, pq.Array(&r.Roles),
+			&r.SourceIP, &r.Service, &r.Method, &r.Resource, &r.Status, &r.Outcome, &r.LatencyMS)
+		if err != nil {
+			return nil, err
+		}
+
+		r.Timestamp = r.Timestamp.UTC()
+		records = append(records, r)
+	}
+
+	return records, rows.Err()
+}
+
+func (ds *postgresDB) updateSchedule(s types.Schedule) error {
+	_, err := ds.db.Exec(`INSERT INTO schedules
+		(id, tenant_id, instance_id, tag, action, cron, create_time, last_run, next_run)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (id) DO UPDATE
+		SET last_run = EXCLUDED.last_run,
+		    next_run = EXCLUDED.next_run`,
+		s.ID, s.TenantID, s.InstanceID, s.Tag, string(s.Action), s.Cron,
+		s.CreateTime.UTC(), s.LastRun.UTC(), s.NextRun.UTC())
+	return err
+}
+
+func (ds *postgresDB) deleteSchedule(ID string) error {
+	_, err := ds.db.Exec("DELETE FROM schedules WHERE id = $1", ID)
+	return err
+}
+
+func (ds *postgresDB) getSchedules() ([]types.Schedule, error) {
+	rows, err := ds.db.Query(`SELECT id, tenant_id, instance_id, tag, action, cron,
+		create_time, last_run, next_run
+		FROM schedules`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var schedules []types.Schedule
+
+	for rows.Next() {
+		var s types.Schedule
+		var action string
+
+		err = rows.Scan(&s.ID, &s.TenantID, &s.InstanceID, &s.Tag, &action, &s.Cron,
+			&s.CreateTime, &s.LastRun, &s.NextRun)
+		if err != nil {
+			return nil, err
+		}
+
+		s.Action = types.ScheduleAction(action)
+		s.CreateTime = s.CreateTime.UTC()
+		s.LastRun = s.LastRun.UTC()
+		s.NextRun = s.NextRun.UTC()
+
+		schedules = append(schedules, s)
+	}
+
+	return schedules, rows.Err()
+}
+
+func (ds *postgresDB) addKeypair(k types.Keypair) error {
+	_, err := ds.db.Exec(`INSERT INTO keypairs
+		(user_id, name, type, public_key, fingerprint, create_time)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		k.UserID, k.Name, k.Type, k.PublicKey, k.Fingerprint, k.CreateTime.UTC())
+	return err
+}
+
+func (ds *postgresDB) deleteKeypair(userID string, name string) error {
+	_, err := ds.db.Exec("DELETE FROM keypairs WHERE user_id = $1 AND name = $2", userID, name)
+	return err
+}
+
+func (ds *postgresDB) getKeypairs() ([]types.Keypair, error) {
+	rows, err := ds.db.Query(`SELECT user_id, name, type, public_key, fingerprint, create_time
+		FROM keypairs`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keypairs []types.Keypair
+
+	for rows.Next() {
+		var k types.Keypair
+
+		err = rows.Scan(&k.UserID, &k.Name, &k.Type, &k.PublicKey, &k.Fingerprint, &k.CreateTime)
+		if err != nil {
+			return nil, err
+		}
+
+		k.CreateTime = k.CreateTime.UTC()
+		keypairs = append(keypairs, k)
+	}
+
+	return keypairs, rows.Err()
+}
+
+func (ds *postgresDB) updateSecurityGroup(g types.SecurityGroup) error {
+	rules, err := marshalSecurityGroupRules(g.Rules)
+	if err != nil {
+		return err
+	}
+
+	_, err = ds.db.Exec(`INSERT INTO security_groups
+		(id, tenant_id, name, description, rules, create_time)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (id) DO UPDATE
+		SET name = EXCLUDED.name,
+		    description = EXCLUDED.description,
+		    rules = EXCLUDED.rules`,
+		g.ID, g.TenantID, g.Name, g.Description, rules, g.CreateTime.UTC())
+	return err
+}
+
+func (ds *postgresDB) deleteSecurityGroup(ID string) error {
+	_, err := ds.db.Exec("DELETE FROM security_groups WHERE id = $1", ID)
+	return err
+}
+
+func (ds *postgresDB) getSecurityGroups() ([]types.SecurityGroup, error) {
+	rows, err := ds.db.Query(`SELECT id, tenant_id, name, description, rules, create_time
+		FROM security_groups`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []types.SecurityGroup
+
+	for rows.Next() {
+		var g types.SecurityGroup
+		var rules string
+
+		err = rows.Scan(&g.ID, &g.TenantID, &g.Name, &g.Description, &rules, &g.CreateTime)
+		if err != nil {
+			return nil, err
+		}
+
+		g.Rules, err = unmarshalSecurityGroupRules(rules)
+		if err != nil {
+			return nil, err
+		}
+
+		g.CreateTime = g.CreateTime.UTC()
+		groups = append(groups, g)
+	}
+
+	return groups, rows.Err()
+}
+
+func (ds *postgresDB) updateScalingGroup(g types.ScalingGroup) error {
+	scaleOut, err := marshalScalingRule(g.ScaleOut)
+	if err != nil {
+		return err
+	}
+
+	scaleIn, err := marshalScalingRule(g.ScaleIn)
+	if err != nil {
+		return err
+	}
+
+	_, err = ds.db.Exec(`INSERT INTO scaling_groups
+		(id, tenant_id, name, workload_id, min_instances, max_instances, desired_instances,
+		scale_out, scale_in, cooldown, create_time, last_scale)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		ON CONFLICT (id) DO UPDATE
+		SET name = EXCLUDED.name,
+		    min_instances = EXCLUDED.min_instances,
+		    max_instances = EXCLUDED.max_instances,
+		    desired_instances = EXCLUDED.desired_instances,
+		    scale_out = EXCLUDED.scale_out,
+		    scale_in = EXCLUDED.scale_in,
+		    cooldown = EXCLUDED.cooldown,
+		    last_scale = EXCLUDED.last_scale`,
+		g.ID, g.TenantID, g.Name, g.WorkloadID, g.MinInstances, g.MaxInstances, g.DesiredInstances,
+		scaleOut, scaleIn, g.Cooldown, g.CreateTime.UTC(), g.LastScale.UTC())
+	return err
+}
+
+func (ds *postgresDB) deleteScalingGroup(ID string) error {
+	tx, err := ds.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM scaling_activities WHERE group_id = $1", ID)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM scaling_groups WHERE id = $1", ID)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (ds *postgresDB) getScalingGroups() ([]types.ScalingGroup, error) {
+	rows, err := ds.db.Query(`SELECT id, tenant_id, name, workload_id, min_instances,
+		max_instances, desired_instances, scale_out, scale_in, cooldown, create_time, last_scale
+		FROM scaling_groups`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []types.ScalingGroup
+
+	for rows.Next() {
+		var g types.ScalingGroup
+		var scaleOut, scaleIn string
+
+		err = rows.Scan(&g.ID, &g.TenantID, &g.Name, &g.WorkloadID, &g.MinInstances,
+			&g.MaxInstances, &g.DesiredInstances, &scaleOut, &scaleIn, &g.Cooldown,
+			&g.CreateTime, &g.LastScale)
+		if err != nil {
+			return nil, err
+		}
+
+		g.ScaleOut, err = unmarshalScalingRule(scaleOut)
+		if err != nil {
+			return nil, err
+		}
+
+		g.ScaleIn, err = unmarshalScalingRule(scaleIn)
+		if err != nil {
+			return nil, err
+		}
+
+		g.CreateTime = g.CreateTime.UTC()
+		g.LastScale = g.LastScale.UTC()
+
+		groups = append(groups, g)
+	}
+
+	return groups, rows.Err()
+}
+
+func (ds *postgresDB) addScalingActivity(a types.ScalingActivity) error {
+	_, err := ds.db.Exec(`INSERT INTO scaling_activities
+		(group_id, timestamp, from_instances, to_instances, reason)
+		VALUES ($1, $2, $3, $4, $5)`,
+		a.GroupID, a.Timestamp.UTC(), a.From, a.To, a.Reason)
+	return err
+}
+
+func (ds *postgresDB) getScalingActivities(groupID string) ([]types.ScalingActivity, error) {
+	rows, err := ds.db.Query(`SELECT group_id, timestamp, from_instances, to_instances, reason
+		FROM scaling_activities WHERE group_id = $1 ORDER BY id`, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var activities []types.ScalingActivity
+
+	for rows.Next() {
+		var a types.ScalingActivity
+
+		err = rows.Scan(&a.GroupID, &a.Timestamp, &a.From, &a.To, &a.Reason)
+		if err != nil {
+			return nil, err
+		}
+
+		a.Timestamp = a.Timestamp.UTC()
+		activities = append(activities, a)
+	}
+
+	return activities, rows.Err()
+}
+
+func (ds *postgresDB) addNodeStat(stat payloads.Stat) error {
+	_, err := ds.db.Exec("INSERT INTO node_statistics (node_id, mem_total_mb, mem_available_mb, disk_total_mb, disk_available_mb, load, cpus_online) VALUES ($1, $2, $3, $4, $5, $6, $7)",
+		stat.NodeUUID, stat.MemTotalMB, stat.MemAvailableMB, stat.DiskTotalMB, stat.DiskAvailableMB, stat.Load, stat.CpusOnline)
+	return err
+}
+
+func (ds *postgresDB) addInstanceStats(stats []payloads.InstanceStat, nodeID string) error {
+	cmd := `INSERT INTO instance_statistics (instance_id, memory_usage_mb, disk_usage_mb, cpu_usage, state, node_id, ssh_ip, ssh_port)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+
+	var err error
+
+	for _, stat := range stats {
+		_, err = ds.db.Exec(cmd, stat.InstanceUUID, stat.MemoryUsageMB, stat.DiskUsageMB, stat.CPUUsage, stat.State, nodeID, stat.SSHIP, stat.SSHPort)
+		if err != nil {
+			glog.Warning(err)
+			// but keep going
+		}
+	}
+
+	return err
+}
+
+func (ds *postgresDB) addFrameStat(stat payloads.FrameTrace) error {
+	tx, err := ds.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var id int
+
+	err = tx.QueryRow("INSERT INTO frame_statistics (label, type, operand, start_timestamp, end_timestamp) VALUES ($1, $2, $3, $4, $5) RETURNING id",
+		stat.Label, stat.Type, stat.Operand, stat.StartTimestamp, stat.EndTimestamp).Scan(&id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for _, t := range stat.Nodes {
+		_, err = tx.Exec("INSERT INTO trace_data (frame_id, ssntp_uuid, tx_timestamp, rx_timestamp) VALUES ($1, $2, $3, $4)",
+			id, t.SSNTPUUID, t.TxTimestamp, t.RxTimestamp)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (ds *postgresDB) getNodeSummary() ([]*types.NodeSummary, error) {
+	query := `
+WITH ` + latestInstanceStats + `,
+instance_states AS
+(
+	SELECT	COALESCE(latest.state, '` + payloads.ComputeStatusPending + `') AS state,
+		COALESCE(latest.node_id, 'Not Assigned') AS node_id
+	FROM instances
+	LEFT JOIN latest
+	ON instances.id = latest.instance_id
+)
+SELECT	node_id,
+	COUNT(*),
+	COUNT(*) FILTER (WHERE state = '` + payloads.ComputeStatusRunning + `'),
+	COUNT(*) FILTER (WHERE state = '` + payloads.ComputeStatusPending + `'),
+	COUNT(*) FILTER (WHERE state = '` + payloads.ComputeStatusStopped + `')
+FROM instance_states
+GROUP BY node_id`
+
+	rows, err := ds.db.Query(query)
+	if err != nil {
+		glog.V(2).Info("Failed to get Node Summary: ", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	summary := make([]*types.NodeSummary, 0)
+
+	for rows.Next() {
+		var n types.NodeSummary
+
+		err = rows.Scan(&n.NodeID, &n.TotalInstances, &n.TotalRunningInstances, &n.TotalPendingInstances, &n.TotalPausedInstances)
+		if err != nil {
+			return nil, err
+		}
+
+		summary = append(summary, &n)
+	}
+
+	return summary, rows.Err()
+}
+
+func (ds *postgresDB) getBatchFrameSummary() ([]types.BatchFrameSummary, error) {
+	rows, err := ds.db.Query("SELECT label, COUNT(id) FROM frame_statistics GROUP BY label")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := make([]types.BatchFrameSummary, 0)
+
+	for rows.Next() {
+		var stat types.BatchFrameSummary
+
+		err = rows.Scan(&stat.BatchID, &stat.NumInstances)
+		if err != nil {
+			return nil, err
+		}
+
+		stats = append(stats, stat)
+	}
+
+	return stats, rows.Err()
+}
+
+// elapsed returns the SQL expression for the number of seconds between
+// two trace timestamps, NULL when one of them was not recorded.
+func elapsed(from, to string) string {
+	return fmt.Sprintf("EXTRACT(EPOCH FROM (NULLIF(%s, '')::timestamptz - NULLIF(%s, '')::timestamptz))", to, from)
+}
+
+func (ds *postgresDB) getBatchFrameStatistics(label string) ([]types.BatchFrameStat, error) {
+	query := `WITH total AS
+		(
+			SELECT	id,
+				start_timestamp,
+				end_timestamp,
+				` + elapsed("start_timestamp", "end_timestamp") + ` AS total_elapsed
+			FROM frame_statistics
+			WHERE label = $1
+		),
+		total_start AS
+		(
+			SELECT	trace_data.frame_id,
+				` + elapsed("total.start_timestamp", "trace_data.tx_timestamp") + ` AS total_elapsed
+			FROM trace_data
+			JOIN total
+			ON trace_data.frame_id = total.id
+			WHERE rx_timestamp = ''
+		),
+		total_end AS
+		(
+			SELECT	trace_data.frame_id,
+				` + elapsed("trace_data.rx_timestamp", "total.end_timestamp") + ` AS total_elapsed
+			FROM trace_data
+			JOIN total
+			ON trace_data.frame_id = total.id
+			WHERE tx_timestamp = ''
+		),
+		total_per_node AS
+		(
+			SELECT	trace_data.frame_id,
+				` + elapsed("trace_data.rx_timestamp", "trace_data.tx_timestamp") + ` AS total_elapsed
+			FROM trace_data
+			WHERE tx_timestamp != '' AND rx_timestamp != ''
+		),
+		diffs AS
+		(
+			SELECT	total.total_elapsed AS total_elapsed,
+				total_start.total_elapsed AS controller_elapsed,
+				total_end.total_elapsed AS launcher_elapsed,
+				total_per_node.total_elapsed AS scheduler_elapsed
+			FROM total
+			LEFT JOIN total_start
+			ON total.id = total_start.frame_id
+			LEFT JOIN total_end
+			ON total_start.frame_id = total_end.frame_id
+			LEFT JOIN total_per_node
+			ON total_start.frame_id = total_per_node.frame_id
+		)
+		SELECT	(SELECT COUNT(id) FROM total),
+			(SELECT EXTRACT(EPOCH FROM (MAX(NULLIF(end_timestamp, '')::timestamptz) - MIN(NULLIF(start_timestamp, '')::timestamptz))) FROM total),
+			AVG(total_elapsed),
+			AVG(controller_elapsed),
+			AVG(launcher_elapsed),
+			AVG(scheduler_elapsed),
+			VAR_POP(controller_elapsed),
+			VAR_POP(launcher_elapsed),
+			VAR_POP(scheduler_elapsed)
+		FROM diffs`
+
+	rows, err := ds.db.Query(query, label)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := make([]types.BatchFrameStat, 0)
+
+	for rows.Next() {
+		var stat types.BatchFrameStat
+		var numInstances sql.NullInt64
+		var values [8]sql.NullFloat64
+
+		err = rows.Scan(&numInstances, &values[0], &values[1], &values[2], &values[3], &values[4], &values[5], &values[6], &values[7])
+		if err != nil {
+			return nil, err
+		}
+
+		if numInstances.Valid {
+			stat.NumInstances = int(numInstances.Int64)
+		}
+
+		fields := []*float64{
+			&stat.TotalElapsed,
+			&stat.AverageElapsed,
+			&stat.AverageControllerElapsed,
+			&stat.AverageLauncherElapsed,
+			&stat.AverageSchedulerElapsed,
+			&stat.VarianceController,
+			&stat.VarianceLauncher,
+			&stat.VarianceScheduler,
+		}
+
+		for i, v := range values {
+			if v.Valid {
+				*fields[i] = v.Float64
+			}
+		}
+
+		stats = append(stats, stat)
+	}
+
+	return stats, rows.Err()
+}
+
+const blockDataColumns = "id, tenant_id, size, state, create_time, name, description"
+
+func (ds *postgresDB) queryBlockData(where string, args ...interface{}) (map[string]types.BlockData, error) {
+	rows, err := ds.db.Query("SELECT "+blockDataColumns+" FROM block_data "+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	devices := make(map[string]types.BlockData)
+
+	for rows.Next() {
+		var data types.BlockData
+		var state string
+
+		err = rows.Scan(&data.ID, &data.TenantID, &data.Size, &state, &data.CreateTime, &data.Name, &data.Description)
+		if err != nil {
+			return nil, err
+		}
+
+		data.State = types.BlockState(state)
+		devices[data.ID] = data
+	}
+
+	return devices, rows.Err()
+}
+
+func (ds *postgresDB) getTenantDevices(tenantID string) (map[string]types.BlockData, error) {
+	return ds.queryBlockData("WHERE tenant_id = $1", tenantID)
+}
+
+func (ds *postgresDB) getAllBlockData() (map[string]types.BlockData, error) {
+	return ds.queryBlockData("")
+}
+
+func (ds *postgresDB) addBlockData(data types.BlockData) error {
+	_, err := ds.db.Exec("INSERT INTO block_data ("+blockDataColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7) ON CONFLICT DO NOTHING",
+		data.ID, data.TenantID, data.Size, string(data.State), data.CreateTime, data.Name, data.Description)
+	return err
+}
+
+// For now we only support updating the state.
+func (ds *postgresDB) updateBlockData(data types.BlockData) error {
+	_, err := ds.db.Exec("UPDATE block_data SET state = $1 WHERE id = $2", string(data.State), data.ID)
+	return err
+}
+
+func (ds *postgresDB) deleteBlockData(ID string) error {
+	_, err := ds.db.Exec("DELETE FROM block_data WHERE id = $1", ID)
+	return err
+}
+
+func (ds *postgresDB) addStorageAttachment(a types.StorageAttachment) error {
+	_, err := ds.db.Exec("INSERT INTO attachments (id, instance_id, block_id, ephemeral, boot) VALUES ($1, $2, $3, $4, $5)",
+		a.ID, a.InstanceID, a.BlockID, a.Ephemeral, a.Boot)
+	return err
+}
+
+func (ds *postgresDB) getAllStorageAttachments() (map[string]types.StorageAttachment, error) {
+	attachments := make(map[string]types.StorageAttachment)
+
+	rows, err := ds.db.Query("SELECT id, instance_id, block_id, ephemeral, boot FROM attachments")
+	if err != nil {
+		return attachments, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a types.StorageAttachment
+
+		err = rows.Scan(&a.ID, &a.InstanceID, &a.BlockID, &a.Ephemeral, &a.Boot)
+		if err != nil {
+			return attachments, err
+		}
+
+		attachments[a.ID] = a
+	}
+
+	return attachments, rows.Err()
+}
+
+func (ds *postgresDB) deleteStorageAttachment(ID string) error {
+	_, err := ds.db.Exec("DELETE FROM attachments WHERE id = $1", ID)
+	return err
+}
+
+// this is here just for readability.
+func (ds *postgresDB) addPool(pool types.Pool) error {
+	return ds.updatePool(pool)
+}
+
+// updatePool is used to update all pool related fields even if they
+// are in different tables.
+func (ds *postgresDB) updatePool(pool types.Pool) error {
+	tx, err := ds.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	// the subnets and addresses no longer in the pool are removed,
+	// the ones already in the tables are left alone.
+	subnets := make([]string, 0, len(pool.Subnets))
+	for _, subnet := range pool.Subnets {
+		subnets = append(subnets, subnet.ID)
+	}
+
+	addresses := make([]string, 0, len(pool.IPs))
+	for _, IP := range pool.IPs {
+		addresses = append(addresses, IP.ID)
+	}
+
+	_, err = tx.Exec("DELETE FROM subnet_pool WHERE pool_id = $1 AND NOT (id = ANY($2))", pool.ID, pq.Array(subnets))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM address_pool WHERE pool_id = $1 AND NOT (id = ANY($2))", pool.ID, pq.Array(addresses))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for _, subnet := range pool.Subnets {
+		_, err = tx.Exec("INSERT INTO subnet_pool (id, pool_id, cidr) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING", subnet.ID, pool.ID, subnet.CIDR)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	for _, IP := range pool.IPs {
+		_, err = tx.Exec("INSERT INTO address_pool (id, pool_id, address) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING", IP.ID, pool.ID, IP.Address)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`INSERT INTO pools (id, name, free, total) VALUES ($1, $2, $3, $4)
+			  ON CONFLICT (id) DO UPDATE SET free = EXCLUDED.free, total = EXCLUDED.total`,
+		pool.ID, pool.Name, pool.Free, pool.TotalIPs)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (ds *postgresDB) getAllPools() map[string]types.Pool {
+	pools := make(map[string]types.Pool)
+
+	rows, err := ds.db.Query("SELECT id, name, free, total FROM pools")
+	if err != nil {
+		glog.Warning(err)
+		return nil
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var pool types.Pool
+
+		err = rows.Scan(&pool.ID, &pool.Name, &pool.Free, &pool.TotalIPs)
+		if err != nil {
+			continue
+		}
+
+		pools[pool.ID] = pool
+	}
+
+	if err = rows.Err(); err != nil {
+		glog.Warning(err)
+		return nil
+	}
+
+	for ID, pool := range pools {
+		pool.Subnets, err = ds.getPoolSubnets(ID)
+		if err != nil {
+			delete(pools, ID)
+			continue
+		}
+
+		pool.IPs, err = ds.getPoolAddresses(ID)
+		if err != nil {
+			delete(pools, ID)
+			continue
+		}
+
+		pools[ID] = pool
+	}
+
+	return pools
+}
+
+func (ds *postgresDB) deletePool(ID string) error {
+	tx, err := ds.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	for _, cmd := range []string{
+		"DELETE FROM subnet_pool WHERE pool_id = $1",
+		"DELETE FROM address_pool WHERE pool_id = $1",
+		"DELETE FROM pools WHERE id = $1",
+	} {
+		_, err = tx.Exec(cmd, ID)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (ds *postgresDB) getPoolSubnets(poolID string) ([]types.ExternalSubnet, error) {
+	var subnets []types.ExternalSubnet
+
+	rows, err := ds.db.Query("SELECT id, cidr FROM subnet_pool WHERE pool_id = $1", poolID)
+	if err != nil {
+		return subnets, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var subnet types.ExternalSubnet
+
+		err = rows.Scan(&subnet.ID, &subnet.CIDR)
+		if err != nil {
+			continue
+		}
+
+		subnets = append(subnets, subnet)
+	}
+
+	return subnets, rows.Err()
+}
+
+func (ds *postgresDB) getPoolAddresses(poolID string) ([]types.ExternalIP, error) {
+	var IPs []types.ExternalIP
+
+	rows, err := ds.db.Query("SELECT id, address FROM address_pool WHERE pool_id = $1", poolID)
+	if err != nil {
+		return IPs, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var IP types.ExternalIP
+
+		err = rows.Scan(&IP.ID, &IP.Address)
+		if err != nil {
+			continue
+		}
+
+		IPs = append(IPs, IP)
+	}
+
+	return IPs, rows.Err()
+}
+
+func (ds *postgresDB) addMappedIP(m types.MappedIP) error {
+	_, err := ds.db.Exec("INSERT INTO mapped_ips (id, pool_id, external_ip, instance_id) VALUES ($1, $2, $3, $4)",
+		m.ID, m.PoolID, m.ExternalIP, m.InstanceID)
+	return err
+}
+
+func (ds *postgresDB) deleteMappedIP(ID string) error {
+	_, err := ds.db.Exec("DELETE FROM mapped_ips WHERE id = $1", ID)
+	return err
+}
+
+func (ds *postgresDB) getMappedIPs() map[string]types.MappedIP {
+	IPs := make(map[string]types.MappedIP)
+
+	query := `SELECT	mapped_ips.id,
+				mapped_ips.pool_id,
+				mapped_ips.external_ip,
+				mapped_ips.instance_id,
+				instances.ip,
+				instances.tenant_id,
+				pools.name
+		  FROM	mapped_ips
+		  JOIN instances
+		  ON instances.id = mapped_ips.instance_id
+		  JOIN pools
+		  ON pools.id = mapped_ips.pool_id`
+
+	rows, err := ds.db.Query(query)
+	if err != nil {
+		glog.Warning(err)
+		return IPs
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var IP types.MappedIP
+
+		err = rows.Scan(&IP.ID, &IP.PoolID, &IP.ExternalIP, &IP.InstanceID, &IP.InternalIP, &IP.TenantID, &IP.PoolName)
+		if err != nil {
+			continue
+		}
+
+		IPs[IP.ExternalIP] = IP
+	}
+
+	if err = rows.Err(); err != nil {
+		glog.Warning(err)
+	}
+
+	return IPs
+}
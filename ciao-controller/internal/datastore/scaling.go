@@ -0,0 +1,111 @@
+/*
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package datastore
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/01org/ciao/ciao-controller/types"
+	"github.com/pkg/errors"
+)
+
+func marshalScalingRule(rule *types.ScalingRule) (string, error) {
+	if rule == nil {
+		return "", nil
+	}
+
+	r, err := json.Marshal(rule)
+	if err != nil {
+		return "", err
+	}
+
+	return string(r), nil
+}
+
+func unmarshalScalingRule(rule string) (*types.ScalingRule, error) {
+	if rule == "" {
+		return nil, nil
+	}
+
+	r := &types.ScalingRule{}
+	err := json.Unmarshal([]byte(rule), r)
+	return r, errors.Wrap(err, "invalid scaling rule")
+}
+
+// UpdateScalingGroup stores a scaling group, new or not.
+func (ds *Datastore) UpdateScalingGroup(g types.ScalingGroup) error {
+	g.Links = nil
+
+	return errors.Wrapf(ds.db.updateScalingGroup(g),
+		"error updating scaling group (%v) in database", g.ID)
+}
+
+// DeleteScalingGroup removes a scaling group and its history.
+func (ds *Datastore) DeleteScalingGroup(ID string) error {
+	return errors.Wrapf(ds.db.deleteScalingGroup(ID),
+		"error deleting scaling group (%v) from database", ID)
+}
+
+// GetScalingGroups returns the scaling groups of a tenant sorted by ID, or
+// all of them if tenantID is empty.
+func (ds *Datastore) GetScalingGroups(tenantID string) ([]types.ScalingGroup, error) {
+	groups, err := ds.db.getScalingGroups()
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving scaling groups")
+	}
+
+	var found []types.ScalingGroup
+	for _, g := range groups {
+		if tenantID == "" || g.TenantID == tenantID {
+			found = append(found, g)
+		}
+	}
+
+	sort.Sort(types.SortedScalingGroupsByID(found))
+
+	return found, nil
+}
+
+// GetScalingGroup returns a scaling group.
+func (ds *Datastore) GetScalingGroup(ID string) (types.ScalingGroup, error) {
+	groups, err := ds.GetScalingGroups("")
+	if err != nil {
+		return types.ScalingGroup{}, err
+	}
+
+	for _, g := range groups {
+		if g.ID == ID {
+			return g, nil
+		}
+	}
+
+	return types.ScalingGroup{}, types.ErrScalingGroupNotFound
+}
+
+// AddScalingActivity records a scaling activity of a group.
+func (ds *Datastore) AddScalingActivity(a types.ScalingActivity) error {
+	return errors.Wrapf(ds.db.addScalingActivity(a),
+		"error adding activity of scaling group (%v) to database", a.GroupID)
+}
+
+// GetScalingActivities returns the history of a scaling group, oldest
+// first.
+func (ds *Datastore) GetScalingActivities(groupID string) ([]types.ScalingActivity, error) {
+	activities, err := ds.db.getScalingActivities(groupID)
+	return activities, errors.Wrapf(err, "error retrieving activities of scaling group (%v)", groupID)
+}
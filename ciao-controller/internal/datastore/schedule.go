@@ -0,0 +1,82 @@
+/*
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package datastore
+
+import (
+	"sort"
+
+	"github.com/01org/ciao/ciao-controller/types"
+	"github.com/pkg/errors"
+)
+
+// AddSchedule stores a new schedule.
+func (ds *Datastore) AddSchedule(s types.Schedule) error {
+	s.Links = nil
+
+	return errors.Wrapf(ds.db.updateSchedule(s),
+		"error adding schedule (%v) to database", s.ID)
+}
+
+// UpdateSchedule stores the last and next runs of a schedule.
+func (ds *Datastore) UpdateSchedule(s types.Schedule) error {
+	s.Links = nil
+
+	return errors.Wrapf(ds.db.updateSchedule(s),
+		"error updating schedule (%v) in database", s.ID)
+}
+
+// DeleteSchedule removes a schedule.
+func (ds *Datastore) DeleteSchedule(ID string) error {
+	return errors.Wrapf(ds.db.deleteSchedule(ID),
+		"error deleting schedule (%v) from database", ID)
+}
+
+// GetSchedules returns the schedules of a tenant sorted by ID, or all of
+// them if tenantID is empty.
+func (ds *Datastore) GetSchedules(tenantID string) ([]types.Schedule, error) {
+	schedules, err := ds.db.getSchedules()
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving schedules")
+	}
+
+	var found []types.Schedule
+	for _, s := range schedules {
+		if tenantID == "" || s.TenantID == tenantID {
+			found = append(found, s)
+		}
+	}
+
+	sort.Sort(types.SortedSchedulesByID(found))
+
+	return found, nil
+}
+
+// GetSchedule returns a schedule.
+func (ds *Datastore) GetSchedule(ID string) (types.Schedule, error) {
+	schedules, err := ds.GetSchedules("")
+	if err != nil {
+		return types.Schedule{}, err
+	}
+
+	for _, s := range schedules {
+		if s.ID == ID {
+			return s, nil
+		}
+	}
+
+	return types.Schedule{}, types.ErrScheduleNotFound
+}
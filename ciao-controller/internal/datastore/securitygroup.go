@@ -0,0 +1,191 @@
+/*
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package datastore
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/01org/ciao/ciao-controller/types"
+	"github.com/pkg/errors"
+)
+
+func marshalSecurityGroupRules(rules []types.SecurityGroupRule) (string, error) {
+	if rules == nil {
+		rules = []types.SecurityGroupRule{}
+	}
+
+	r, err := json.Marshal(rules)
+	if err != nil {
+		return "", err
+	}
+
+	return string(r), nil
+}
+
+func unmarshalSecurityGroupRules(rules string) ([]types.SecurityGroupRule, error) {
+	if rules == "" {
+		return nil, nil
+	}
+
+	var r []types.SecurityGroupRule
+	err := json.Unmarshal([]byte(rules), &r)
+	if len(r) == 0 {
+		r = nil
+	}
+	return r, errors.Wrap(err, "invalid security group rules")
+}
+
+// checkSecurityGroupName returns an error if the name of a security group
+// is used by another security group of its tenant.
+func (ds *Datastore) checkSecurityGroupName(g types.SecurityGroup) error {
+	groups, err := ds.GetSecurityGroups(g.TenantID)
+	if err != nil {
+		return err
+	}
+
+	for _, o := range groups {
+		if o.Name == g.Name && o.ID != g.ID {
+			return types.ErrDuplicateSecurityGroup
+		}
+	}
+
+	return nil
+}
+
+// AddSecurityGroup stores a new security group of a tenant.
+func (ds *Datastore) AddSecurityGroup(g types.SecurityGroup) error {
+	ds.securityGroupsLock.Lock()
+	defer ds.securityGroupsLock.Unlock()
+
+	err := ds.checkSecurityGroupName(g)
+	if err != nil {
+		return err
+	}
+
+	return errors.Wrapf(ds.db.updateSecurityGroup(g),
+		"error adding security group (%v) to database", g.ID)
+}
+
+// UpdateSecurityGroup changes the name and description of a security group.
+func (ds *Datastore) UpdateSecurityGroup(ID string, name string, description string) error {
+	ds.securityGroupsLock.Lock()
+	defer ds.securityGroupsLock.Unlock()
+
+	g, err := ds.GetSecurityGroup(ID)
+	if err != nil {
+		return err
+	}
+
+	g.Name = name
+	g.Description = description
+
+	err = ds.checkSecurityGroupName(g)
+	if err != nil {
+		return err
+	}
+
+	return errors.Wrapf(ds.db.updateSecurityGroup(g),
+		"error updating security group (%v) in database", ID)
+}
+
+// DeleteSecurityGroup removes a security group and its rules.
+func (ds *Datastore) DeleteSecurityGroup(ID string) error {
+	ds.securityGroupsLock.Lock()
+	defer ds.securityGroupsLock.Unlock()
+
+	_, err := ds.GetSecurityGroup(ID)
+	if err != nil {
+		return err
+	}
+
+	return errors.Wrapf(ds.db.deleteSecurityGroup(ID),
+		"error deleting security group (%v) from database", ID)
+}
+
+// GetSecurityGroups returns the security groups of a tenant sorted by name,
+// or all of them if tenantID is empty.
+func (ds *Datastore) GetSecurityGroups(tenantID string) ([]types.SecurityGroup, error) {
+	groups, err := ds.db.getSecurityGroups()
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving security groups")
+	}
+
+	var found []types.SecurityGroup
+	for _, g := range groups {
+		if tenantID == "" || g.TenantID == tenantID {
+			found = append(found, g)
+		}
+	}
+
+	sort.Sort(types.SortedSecurityGroupsByName(found))
+
+	return found, nil
+}
+
+// GetSecurityGroup returns a security group.
+func (ds *Datastore) GetSecurityGroup(ID string) (types.SecurityGroup, error) {
+	groups, err := ds.GetSecurityGroups("")
+	if err != nil {
+		return types.SecurityGroup{}, err
+	}
+
+	for _, g := range groups {
+		if g.ID == ID {
+			return g, nil
+		}
+	}
+
+	return types.SecurityGroup{}, types.ErrSecurityGroupNotFound
+}
+
+// AddSecurityGroupRule adds a rule to a security group.
+func (ds *Datastore) AddSecurityGroupRule(groupID string, rule types.SecurityGroupRule) error {
+	ds.securityGroupsLock.Lock()
+	defer ds.securityGroupsLock.Unlock()
+
+	g, err := ds.GetSecurityGroup(groupID)
+	if err != nil {
+		return err
+	}
+
+	g.Rules = append(g.Rules, rule)
+
+	return errors.Wrapf(ds.db.updateSecurityGroup(g),
+		"error adding rule (%v) of security group (%v) to database", rule.ID, groupID)
+}
+
+// DeleteSecurityGroupRule removes a rule from a security group.
+func (ds *Datastore) DeleteSecurityGroupRule(groupID string, ruleID string) error {
+	ds.securityGroupsLock.Lock()
+	defer ds.securityGroupsLock.Unlock()
+
+	g, err := ds.GetSecurityGroup(groupID)
+	if err != nil {
+		return err
+	}
+
+	for i := range g.Rules {
+		if g.Rules[i].ID == ruleID {
+			g.Rules = append(g.Rules[:i], g.Rules[i+1:]...)
+			return errors.Wrapf(ds.db.updateSecurityGroup(g),
+				"error deleting rule (%v) of security group (%v) from database", ruleID, groupID)
+		}
+	}
+
+	return types.ErrSecurityGroupRuleNotFound
+}
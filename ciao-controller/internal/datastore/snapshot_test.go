@@ -0,0 +1,84 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestSQLiteSnapshot(t *testing.T) {
+	config, cleanup := fixtureConfig(t, 3, "")
+	defer cleanup()
+
+	ps := &sqliteDB{}
+	err := ps.init(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ps.disconnect()
+
+	dir, err := ioutil.TempDir("", "ciao-snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files, err := ps.snapshot(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != 2 {
+		t.Fatalf("expected 2 snapshot files, got %v", files)
+	}
+
+	contents, err := ReadSnapshot(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	latest := sqliteMigrations[len(sqliteMigrations)-1].Version
+	if contents.SchemaVersion != latest || len(contents.PendingMigrations) != 0 {
+		t.Errorf("snapshot schema version %d, expected %d", contents.SchemaVersion, latest)
+	}
+
+	found := false
+	for _, id := range contents.Tenants {
+		found = found || id == fixtureTenantID
+	}
+
+	if !found {
+		t.Errorf("tenant %s missing from snapshot %v", fixtureTenantID, contents.Tenants)
+	}
+
+	if len(contents.Instances) != 1 || contents.Instances[0].ID != fixtureInstanceID ||
+		contents.Instances[0].TenantID != fixtureTenantID {
+		t.Errorf("unexpected snapshot instances %+v", contents.Instances)
+	}
+
+	_, err = ps.snapshot(dir)
+	if err == nil {
+		t.Error("snapshot overwrote an existing snapshot")
+	}
+}
+
+func TestSnapshotNotSupported(t *testing.T) {
+	_, err := ds.Snapshot(os.TempDir())
+	if err == nil {
+		t.Error("memory database snapshot did not fail")
+	}
+}
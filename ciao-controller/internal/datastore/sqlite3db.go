@@ -67,6 +67,13 @@ func (d namedData) Create(record ...string) (err error) {
 	return
 }
 
+// Init creates the table.  The tables of the persistent database are
+// created by the schema migrations, only the transient ones are created
+// on every start.
+func (d namedData) Init() error {
+	return nil
+}
+
 func (d namedData) Populate() (err error) {
 	return nil
 }
@@ -124,18 +131,6 @@ type subnetData struct {
 	namedData
 }
 
-func (d subnetData) Init() error {
-	cmd := `CREATE TABLE IF NOT EXISTS tenant_network
-		(
-		tenant_id varchar(32),
-		subnet int,
-		rest int,
-		foreign key(tenant_id) references tenants(id)
-		);`
-
-	return d.ds.exec(d.db, cmd)
-}
-
 // Handling of Limit specific Data
 type limitsData struct {
 	namedData
@@ -160,103 +155,73 @@ func (d limitsData) Populate() error {
 	return err
 }
 
-func (d limitsData) Init() error {
-	cmd := `CREATE TABLE IF NOT EXISTS limits
-		(
-		resource_id integer,
-		tenant_id varchar(32),
-		max_value integer,
-		foreign key(resource_id) references resources(id),
-		foreign key(tenant_id) references tenants(id)
-		);`
+// Handling of Instance specific data
+type instanceData struct {
+	namedData
+}
 
-	return d.ds.exec(d.db, cmd)
+// instance state transitions
+type instanceTransitionData struct {
+	namedData
 }
 
-// Handling of Instance specific data
-type instanceData struct {
+// names, tags and metadata of the instances
+type instanceDetailsData struct {
 	namedData
 }
 
-func (d instanceData) Init() error {
-	cmd := `CREATE TABLE IF NOT EXISTS instances
-		(
-		id string primary key,
-		tenant_id string,
-		workload_id string,
-		mac_address string,
-		ip string,
-		create_time DATETIME,
-		foreign key(tenant_id) references tenants(id),
-		foreign key(workload_id) references workload_template(id),
-		unique(tenant_id, ip, mac_address)
-		);`
+// start configs of the instances which may be rescheduled
+type instanceConfigData struct {
+	namedData
+}
 
-	return d.ds.exec(d.db, cmd)
+// hourly instance usage records
+type instanceUsageData struct {
+	namedData
 }
 
-// Volume Data
-type blockData struct {
+// append-only audit log of the API calls
+type auditLogData struct {
 	namedData
 }
 
-func (d blockData) Init() error {
-	cmd := `CREATE TABLE IF NOT EXISTS block_data
-		(
-		id string primary_key,
-		tenant_id string,
-		size integer,
-		state string,
-		create_time DATETIME,
-		name string,
-		description string,
-		foreign key(tenant_id) references tenants(id)
-		);`
+// actions scheduled on instances
+type scheduleData struct {
+	namedData
+}
 
-	return d.ds.exec(d.db, cmd)
+// scaling groups and their history
+type scalingGroupData struct {
+	namedData
 }
 
-type attachments struct {
+type scalingActivityData struct {
 	namedData
 }
 
-func (d attachments) Init() error {
-	cmd := `CREATE TABLE IF NOT EXISTS attachments
-		(
-		id string primary key,
-		instance_id string,
-		block_id string,
-		ephemeral int,
-		boot int,
-		foreign key(instance_id) references instances(id),
-		foreign key(block_id) references block_data(id)
-		);`
+// SSH keypairs of the users
+type keypairData struct {
+	namedData
+}
 
-	return d.ds.exec(d.db, cmd)
+// security groups of the tenants and their rules
+type securityGroupData struct {
+	namedData
 }
 
-// workload storage resources
+// Volume Data
+type blockData struct {
+	namedData
+}
 
-type workloadStorage struct {
+type attachments struct {
 	namedData
 }
 
-func (d workloadStorage) Init() error {
-	cmd := `CREATE TABLE IF NOT EXISTS workload_storage
-	        (
-		workload_id string,
-		volume_id string,
-		bootable int,
-		ephemeral int,
-		size integer,
-		source_type string,
-		source_id string,
-		tag string,
-		foreign key(workload_id) references workloads(id),
-		foreign key(volume_id) references block_data(id)
-		);`
+// workload storage resources
 
-	return d.ds.exec(d.db, cmd)
+type workloadStorage struct {
+	namedData
 }
 
 func (d workloadStorage) Populate() error {
@@ -307,16 +272,6 @@ func (d resourceData) Populate() error {
 	return err
 }
 
-func (d resourceData) Init() error {
-	cmd := `CREATE TABLE IF NOT EXISTS resources
-		(
-		id int primary key,
-		name text
-		);`
-
-	return d.ds.exec(d.db, cmd)
-}
-
 // Tenants data
 type tenantData struct {
 	namedData
@@ -342,39 +297,11 @@ func (d tenantData) Populate() error {
 	return err
 }
 
-func (d tenantData) Init() error {
-	cmd := `CREATE TABLE IF NOT EXISTS tenants
-		(
-		id varchar(32) primary key,
-		name text,
-		cnci_id varchar(32) default null,
-		cnci_mac string default null,
-		cnci_ip string default null
-		);`
-
-	return d.ds.exec(d.db, cmd)
-}
-
 // usage data
 type usageData struct {
 	namedData
 }
 
-func (d usageData) Init() error {
-	cmd := `CREATE TABLE IF NOT EXISTS usage
-		(
-		instance_id string,
-		resource_id int,
-		value int,
-		foreign key(instance_id) references instances(id),
-		foreign key(resource_id) references resources(id)
-		);
-		CREATE UNIQUE INDEX IF NOT EXISTS myindex
-		ON usage(instance_id, resource_id);`
-
-	return d.ds.exec(d.db, cmd)
-}
-
 // workload resources
 type workloadResourceData struct {
 	namedData
@@ -401,23 +328,6 @@ func (d workloadResourceData) Populate() error {
 	return err
 }
 
-func (d workloadResourceData) Init() error {
-	cmd := `CREATE TABLE IF NOT EXISTS workload_resources
-		(
-		workload_id varchar(32),
-		resource_id int,
-		default_value int,
-		estimated_value int,
-		mandatory int,
-		foreign key(workload_id) references workload_template(id),
-		foreign key(resource_id) references resources(id)
-		);
-		CREATE UNIQUE INDEX IF NOT EXISTS wlr_index
-		ON workload_resources(workload_id, resource_id);`
-
-	return d.ds.exec(d.db, cmd)
-}
-
 // workload template data
 type workloadTemplateData struct {
 	namedData
@@ -438,7 +348,7 @@ func (d workloadTemplateData) Populate() error {
 		imageID := line[5]
 		imageName := line[6]
 		internal := line[7]
-		err = d.ds.create(d.name, id, description, filename, fwType, vmType, imageID, imageName, internal)
+		err = d.ds.create(d.name, id, description, filename, fwType, vmType, imageID, imageName, internal, "", string(types.Public), "", "", "")
 		if err != nil {
 			glog.V(2).Info("could not add workload: ", err)
 		}
@@ -447,22 +357,6 @@ func (d workloadTemplateData) Populate() error {
 	return err
 }
 
-func (d workloadTemplateData) Init() error {
-	cmd := `CREATE TABLE IF NOT EXISTS workload_template
-		(
-		id varchar(32) primary key,
-		description text,
-		filename text,
-		fw_type text,
-		vm_type text,
-		image_id varchar(32),
-		image_name text,
-		internal integer
-		);`
-
-	return d.ds.exec(d.db, cmd)
-}
-
 // statistics
 type nodeStatisticsData struct {
 	namedData
@@ -567,19 +461,6 @@ func (d poolData) Populate() error {
 	return err
 }
 
-func (d poolData) Init() error {
-	cmd := `CREATE TABLE IF NOT EXISTS pools
-		(
-			id varchar(32),
-			name string,
-			free int,
-			total int,
-			PRIMARY KEY(id, name)
-		);`
-
-	return d.ds.exec(d.db, cmd)
-}
-
 type subnetPoolData struct {
 	namedData
 }
@@ -603,17 +484,6 @@ func (d subnetPoolData) Populate() error {
 	return err
 }
 
-func (d subnetPoolData) Init() error {
-	cmd := `CREATE TABLE IF NOT EXISTS subnet_pool
-		(
-			id varchar(32) primary key,
-			pool_id varchar(32),
-			cidr string
-		);`
-
-	return d.ds.exec(d.db, cmd)
-}
-
 type addressData struct {
 	namedData
 }
@@ -637,17 +507,6 @@ func (d addressData) Populate() error {
 	return err
 }
 
-func (d addressData) Init() error {
-	cmd := `CREATE TABLE IF NOT EXISTS address_pool
-		(
-			id varchar(32) primary key,
-			pool_id varchar(32),
-			address string
-		);`
-
-	return d.ds.exec(d.db, cmd)
-}
-
 type mappedIPData struct {
 	namedData
 }
@@ -672,18 +531,6 @@ func (d mappedIPData) Populate() error {
 	return err
 }
 
-func (d mappedIPData) Init() error {
-	cmd := `CREATE TABLE IF NOT EXISTS mapped_ips
-		(
-			id varchar(32) primary key,
-			external_ip string,
-			instance_id varchar(32),
-			pool_id varchar(32)
-		);`
-
-	return d.ds.exec(d.db, cmd)
-}
-
 func (ds *sqliteDB) exec(db *sql.DB, cmd string) error {
 	glog.V(2).Info("exec: ", cmd)
 
@@ -776,6 +623,16 @@ func (ds *sqliteDB) init(config Config) error {
 		tenantData{namedData{ds: ds, name: "tenants", db: ds.db}},
 		limitsData{namedData{ds: ds, name: "limits", db: ds.db}},
 		instanceData{namedData{ds: ds, name: "instances", db: ds.db}},
+		instanceTransitionData{namedData{ds: ds, name: "instance_transitions", db: ds.db}},
+		instanceDetailsData{namedData{ds: ds, name: "instance_details", db: ds.db}},
+		instanceConfigData{namedData{ds: ds, name: "instance_configs", db: ds.db}},
+		instanceUsageData{namedData{ds: ds, name: "instance_usage", db: ds.db}},
+		auditLogData{namedData{ds: ds, name: "audit_log", db: ds.db}},
+		scheduleData{namedData{ds: ds, name: "schedules", db: ds.db}},
+		scalingGroupData{namedData{ds: ds, name: "scaling_groups", db: ds.db}},
+		scalingActivityData{namedData{ds: ds, name: "scaling_activities", db: ds.db}},
+		keypairData{namedData{ds: ds, name: "keypairs", db: ds.db}},
+		securityGroupData{namedData{ds: ds, name: "security_groups", db: ds.db}},
 		workloadTemplateData{namedData{ds: ds, name: "workload_template", db: ds.db}},
 		workloadResourceData{namedData{ds: ds, name: "workload_resources", db: ds.db}},
 		usageData{namedData{ds: ds, name: "usage", db: ds.db}},
@@ -797,6 +654,11 @@ func (ds *sqliteDB) init(config Config) error {
 	ds.tableInitPath = config.InitTablesPath
 	ds.workloadsPath = config.InitWorkloadsPath
 
+	err = sqliteSchema(ds.db).migrate()
+	if err != nil {
+		return err
+	}
+
 	for _, table := range ds.tables {
 		err = table.Init()
 		if err != nil {
@@ -1073,11 +935,29 @@ func (ds *sqliteDB) getWorkloadStorage(ID string) ([]types.StorageResource, erro
 }
 
 func (ds *sqliteDB) addLimit(tenantID string, resourceID int, limit int) error {
+	db := ds.getTableDB("limits")
+
 	ds.dbLock.Lock()
-	err := ds.create("limits", resourceID, tenantID, limit)
-	ds.dbLock.Unlock()
+	defer ds.dbLock.Unlock()
 
-	return err
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM limits WHERE tenant_id = ? AND resource_id = ?", tenantID, resourceID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO limits (resource_id, tenant_id, max_value) VALUES (?, ?, ?)", resourceID, tenantID, limit)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
 }
 
 func (ds *sqliteDB) getTenantResources(ID string) ([]*types.Resource, error) {
@@ -1219,15 +1099,24 @@ func (ds *sqliteDB) getWorkload(id string) (*workload, error) {
 			 fw_type,
 			 vm_type,
 			 image_id,
-			 image_name
+			 image_name,
+			 tenant_id,
+			 visibility,
+			 parameters,
+			 restart_policy,
+			 health_check
 		  FROM workload_template
 		  WHERE id = ?`
 
 	work := new(workload)
 
 	var VMType string
+	var visibility string
+	var parameters string
+	var restartPolicy string
+	var healthCheck string
 
-	err := datastore.QueryRow(query, id).Scan(&work.ID, &work.Description, &work.filename, &work.FWType, &VMType, &work.ImageID, &work.ImageName)
+	err := datastore.QueryRow(query, id).Scan(&work.ID, &work.Description, &work.filename, &work.FWType, &VMType, &work.ImageID, &work.ImageName, &work.TenantID, &visibility, &parameters, &restartPolicy, &healthCheck)
 	switch {
 	case err == sql.ErrNoRows:
 		return nil, fmt.Errorf("Workload %q not found", id)
@@ -1236,6 +1125,22 @@ func (ds *sqliteDB) getWorkload(id string) (*workload, error) {
 	}
 
 	work.VMType = payloads.Hypervisor(VMType)
+	work.Visibility = types.Visibility(visibility)
+
+	err = work.unmarshalParameters(parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	err = work.unmarshalRestartPolicy(restartPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	work.HealthCheck, err = unmarshalHealthCheck(healthCheck)
+	if err != nil {
+		return nil, err
+	}
 
 	work.Config, err = ds.getConfig(id)
 	if err != nil {
@@ -1266,7 +1171,12 @@ func (ds *sqliteDB) getWorkloads() ([]*workload, error) {
 			 fw_type,
 			 vm_type,
 			 image_id,
-			 image_name
+			 image_name,
+			 tenant_id,
+			 visibility,
+			 parameters,
+			 restart_policy,
+			 health_check
 		  FROM workload_template
 		  WHERE internal = 0`
 
@@ -1280,8 +1190,27 @@ func (ds *sqliteDB) getWorkloads() ([]*workload, error) {
 		wl := new(workload)
 
 		var VMType string
+		var visibility string
+		var parameters string
+		var restartPolicy string
+		var healthCheck string
+
+		err = rows.Scan(&wl.ID, &wl.Description, &wl.filename, &wl.FWType, &VMType, &wl.ImageID, &wl.ImageName, &wl.TenantID, &visibility, &parameters, &restartPolicy, &healthCheck)
+		if err != nil {
+			return nil, err
+		}
+
+		err = wl.unmarshalParameters(parameters)
+		if err != nil {
+			return nil, err
+		}
+
+		err = wl.unmarshalRestartPolicy(restartPolicy)
+		if err != nil {
+			return nil, err
+		}
 
-		err = rows.Scan(&wl.ID, &wl.Description, &wl.filename, &wl.FWType, &VMType, &wl.ImageID, &wl.ImageName)
+		wl.HealthCheck, err = unmarshalHealthCheck(healthCheck)
 		if err != nil {
 			return nil, err
 		}
@@ -1302,6 +1231,7 @@ func (ds *sqliteDB) getWorkloads() ([]*workload, error) {
 		}
 
 		wl.VMType = payloads.Hypervisor(VMType)
+		wl.Visibility = types.Visibility(visibility)
 
 		workloads = append(workloads, wl)
 	}
@@ -1338,52 +1268,127 @@ func (ds *sqliteDB) updateWorkload(w workload) error {
 		return err
 	}
 
-	// if this is a new workload, put it in, otherwise just update.
+	// if this is a new workload, put it in, otherwise replace its
+	// resources and storage and update it.
 	_, ok := m[w.ID]
-	if !ok {
-		// add in workload resources
-		for _, d := range w.Defaults {
-			err := ds.createWorkloadDefault(tx, w.ID, resources[string(d.Type)], d)
-			if err != nil {
-				tx.Rollback()
-				return err
-			}
+	if ok {
+		_, err = tx.Exec("DELETE FROM workload_resources WHERE workload_id = ?", w.ID)
+		if err != nil {
+			tx.Rollback()
+			return err
 		}
 
-		// add in any workload storage resources
-		if len(w.Storage) > 0 {
-			for i := range w.Storage {
-				err := ds.createWorkloadStorage(tx, w.ID, &w.Storage[i])
-				if err != nil {
-					tx.Rollback()
-					return err
-				}
-			}
+		_, err = tx.Exec("DELETE FROM workload_storage WHERE workload_id = ?", w.ID)
+		if err != nil {
+			tx.Rollback()
+			return err
 		}
+	}
 
-		// write config to file.
-		path := fmt.Sprintf("%s/%s", ds.workloadsPath, w.filename)
-		err := ioutil.WriteFile(path, []byte(w.Config), 0644)
+	// add in workload resources
+	for _, d := range w.Defaults {
+		err := ds.createWorkloadDefault(tx, w.ID, resources[string(d.Type)], d)
 		if err != nil {
 			tx.Rollback()
 			return err
 		}
+	}
 
-		_, err = tx.Exec("INSERT INTO workload_template (id, description, filename, fw_type, vm_type, image_id, image_name, internal) VALUES (?, ?, ?, ?, ?, ?, ?, ?)", w.ID, w.Description, w.filename, w.FWType, string(w.VMType), w.ImageID, w.ImageName, false)
+	// add in any workload storage resources
+	for i := range w.Storage {
+		err := ds.createWorkloadStorage(tx, w.ID, &w.Storage[i])
 		if err != nil {
 			tx.Rollback()
 			return err
 		}
+	}
+
+	// write config to file.
+	path := fmt.Sprintf("%s/%s", ds.workloadsPath, w.filename)
+	err = ioutil.WriteFile(path, []byte(w.Config), 0644)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	parameters, err := w.marshalParameters()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	restartPolicy, err := w.marshalRestartPolicy()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	healthCheck, err := marshalHealthCheck(w.HealthCheck)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if !ok {
+		_, err = tx.Exec("INSERT INTO workload_template (id, description, filename, fw_type, vm_type, image_id, image_name, internal, tenant_id, visibility, parameters, restart_policy, health_check) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", w.ID, w.Description, w.filename, w.FWType, string(w.VMType), w.ImageID, w.ImageName, false, w.TenantID, string(w.Visibility), parameters, restartPolicy, healthCheck)
 	} else {
-		// update not supported yet.
+		_, err = tx.Exec("UPDATE workload_template SET description = ?, filename = ?, fw_type = ?, vm_type = ?, image_id = ?, image_name = ?, tenant_id = ?, visibility = ?, parameters = ?, restart_policy = ?, health_check = ? WHERE id = ?", w.Description, w.filename, w.FWType, string(w.VMType), w.ImageID, w.ImageName, w.TenantID, string(w.Visibility), parameters, restartPolicy, healthCheck, w.ID)
+	}
+	if err != nil {
 		tx.Rollback()
-		return errors.New("Workload Update not supported yet")
+		return err
 	}
 
 	tx.Commit()
 	return nil
 }
 
+func (ds *sqliteDB) deleteWorkload(ID string) error {
+	db := ds.getTableDB("workload_template")
+
+	var filename string
+	err := db.QueryRow("SELECT filename FROM workload_template WHERE id = ? AND internal = 0", ID).Scan(&filename)
+	if err != nil {
+		return err
+	}
+
+	ds.dbLock.Lock()
+	defer ds.dbLock.Unlock()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	for _, table := range []string{"workload_resources", "workload_storage"} {
+		_, err = tx.Exec("DELETE FROM "+table+" WHERE workload_id = ?", ID)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	_, err = tx.Exec("DELETE FROM workload_template WHERE id = ?", ID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	// the csv initialised workloads share their config files
+	var users int
+	err = db.QueryRow("SELECT COUNT(*) FROM workload_template WHERE filename = ?", filename).Scan(&users)
+	if err == nil && users == 0 {
+		os.Remove(fmt.Sprintf("%s/%s", ds.workloadsPath, filename))
+	}
+
+	return nil
+}
+
 func (ds *sqliteDB) updateTenant(t *tenant) error {
 	db := ds.getTableDB("tenants")
 
@@ -1395,7 +1400,7 @@ func (ds *sqliteDB) updateTenant(t *tenant) error {
 		return err
 	}
 
-	_, err = tx.Exec("UPDATE tenants SET cnci_id = ?, cnci_mac = ?, cnci_ip = ? WHERE id = ?", t.CNCIID, t.CNCIMAC, t.CNCIIP, t.ID)
+	_, err = tx.Exec("UPDATE tenants SET name = ?, cnci_id = ?, cnci_mac = ?, cnci_ip = ? WHERE id = ?", t.Name, t.CNCIID, t.CNCIMAC, t.CNCIIP, t.ID)
 	if err != nil {
 		tx.Rollback()
 		ds.dbLock.Unlock()
@@ -1409,6 +1414,34 @@ func (ds *sqliteDB) updateTenant(t *tenant) error {
 	return err
 }
 
+func (ds *sqliteDB) deleteTenant(ID string) error {
+	db := ds.getTableDB("tenants")
+
+	ds.dbLock.Lock()
+	defer ds.dbLock.Unlock()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	for _, table := range []string{"limits", "tenant_network"} {
+		_, err = tx.Exec("DELETE FROM "+table+" WHERE tenant_id = ?", ID)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	_, err = tx.Exec("DELETE FROM tenants WHERE id = ?", ID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
 func (ds *sqliteDB) getTenants() ([]*tenant, error) {
 	var tenants []*tenant
 
@@ -1831,11 +1864,669 @@ func (ds *sqliteDB) deleteInstance(instanceID string) error {
 		return err
 	}
 
-	tx.Commit()
-
-	ds.dbLock.Unlock()
-
-	return err
+	_, err = tx.Exec("DELETE FROM instance_transitions WHERE instance_id = ?", instanceID)
+	if err != nil {
+		tx.Rollback()
+		ds.dbLock.Unlock()
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM instance_details WHERE instance_id = ?", instanceID)
+	if err != nil {
+		tx.Rollback()
+		ds.dbLock.Unlock()
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM instance_configs WHERE instance_id = ?", instanceID)
+	if err != nil {
+		tx.Rollback()
+		ds.dbLock.Unlock()
+		return err
+	}
+
+	tx.Commit()
+
+	ds.dbLock.Unlock()
+
+	return err
+}
+
+func (ds *sqliteDB) addInstanceTransition(instanceID string, t types.InstanceTransition) error {
+	datastore := ds.getTableDB("instance_transitions")
+
+	ds.dbLock.Lock()
+	defer ds.dbLock.Unlock()
+
+	_, err := datastore.Exec("INSERT INTO instance_transitions (instance_id, from_state, to_state, timestamp) VALUES (?, ?, ?, ?)",
+		instanceID, string(t.From), string(t.To), t.Timestamp.Format(time.RFC3339Nano))
+
+	return err
+}
+
+func (ds *sqliteDB) getInstanceTransitions() (map[string][]types.InstanceTransition, error) {
+	datastore := ds.getTableDB("instance_transitions")
+
+	rows, err := datastore.Query("SELECT instance_id, from_state, to_state, timestamp FROM instance_transitions ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transitions := make(map[string][]types.InstanceTransition)
+
+	for rows.Next() {
+		var instanceID string
+		var t types.InstanceTransition
+
+		err = rows.Scan(&instanceID, &t.From, &t.To, &t.Timestamp)
+		if err != nil {
+			return nil, err
+		}
+
+		transitions[instanceID] = append(transitions[instanceID], t)
+	}
+
+	return transitions, rows.Err()
+}
+
+func (ds *sqliteDB) updateInstanceDetails(instanceID string, d instanceDetails) error {
+	tags, metadata, healthCheck, securityGroups, err := d.marshal()
+	if err != nil {
+		return err
+	}
+
+	datastore := ds.getTableDB("instance_details")
+
+	ds.dbLock.Lock()
+	defer ds.dbLock.Unlock()
+
+	_, err = datastore.Exec("INSERT OR REPLACE INTO instance_details (instance_id, name, tags, metadata, health_check, key_name, public_key, security_groups) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		instanceID, d.name, tags, metadata, healthCheck, d.keyName, d.publicKey, securityGroups)
+
+	return err
+}
+
+func (ds *sqliteDB) getInstanceDetails() (map[string]instanceDetails, error) {
+	datastore := ds.getTableDB("instance_details")
+
+	rows, err := datastore.Query("SELECT instance_id, name, tags, metadata, health_check, key_name, public_key, security_groups FROM instance_details")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	details := make(map[string]instanceDetails)
+
+	for rows.Next() {
+		var instanceID string
+		var name string
+		var tags string
+		var metadata string
+		var healthCheck string
+		var keyName string
+		var publicKey string
+		var securityGroups string
+
+		err = rows.Scan(&instanceID, &name, &tags, &metadata, &healthCheck, &keyName, &publicKey,
+			&securityGroups)
+		if err != nil {
+			return nil, err
+		}
+
+		d, err := unmarshalInstanceDetails(name, tags, metadata, healthCheck, keyName, publicKey,
+			securityGroups)
+		if err != nil {
+			return nil, err
+		}
+
+		details[instanceID] = d
+	}
+
+	return details, rows.Err()
+}
+
+func (ds *sqliteDB) updateInstanceConfig(instanceID string, config string) error {
+	datastore := ds.getTableDB("instance_configs")
+
+	ds.dbLock.Lock()
+	defer ds.dbLock.Unlock()
+
+	_, err := datastore.Exec("INSERT OR REPLACE INTO instance_configs (instance_id, config) VALUES (?, ?)",
+		instanceID, config)
+
+	return err
+}
+
+func (ds *sqliteDB) getInstanceConfig(instanceID string) (string, error) {
+	datastore := ds.getTableDB("instance_configs")
+
+	var config string
+
+	err := datastore.QueryRow("SELECT config FROM instance_configs WHERE instance_id = ?", instanceID).Scan(&config)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+
+	return config, err
+}
+
+// usageHour formats the hour of a usage record, the records of an
+// instance are looked up and sorted by their formatted hour.
+func usageHour(hour time.Time) string {
+	return hour.UTC().Format(time.RFC3339)
+}
+
+func (ds *sqliteDB) addInstanceUsage(u types.InstanceUsage) error {
+	datastore := ds.getTableDB("instance_usage")
+
+	ds.dbLock.Lock()
+	defer ds.dbLock.Unlock()
+
+	_, err := datastore.Exec(`INSERT OR REPLACE INTO instance_usage
+		(instance_id, tenant_id, workload_id, hour, hours, vcpu_hours, memory_gb_hours, disk_gb_hours, volume_gb_hours, external_ip_hours)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		u.InstanceID, u.TenantID, u.WorkloadID, usageHour(u.Hour), u.Hours, u.VCPUHours,
+		u.MemoryGBHours, u.DiskGBHours, u.VolumeGBHours, u.ExternalIPHours)
+
+	return err
+}
+
+const instanceUsageColumns = `instance_id, tenant_id, workload_id, hour, hours, vcpu_hours,
+	memory_gb_hours, disk_gb_hours, volume_gb_hours, external_ip_hours`
+
+func (ds *sqliteDB) queryInstanceUsages(where string, args ...interface{}) ([]types.InstanceUsage, error) {
+	datastore := ds.getTableDB("instance_usage")
+
+	query := fmt.Sprintf("SELECT %s FROM instance_usage WHERE %s ORDER BY hour, instance_id", instanceUsageColumns, where)
+
+	rows, err := datastore.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var usages []types.InstanceUsage
+
+	for rows.Next() {
+		var u types.InstanceUsage
+		var hour string
+
+		err = rows.Scan(&u.InstanceID, &u.TenantID, &u.WorkloadID, &hour, &u.Hours, &u.VCPUHours,
+			&u.MemoryGBHours, &u.DiskGBHours, &u.VolumeGBHours, &u.ExternalIPHours)
+		if err != nil {
+			return nil, err
+		}
+
+		u.Hour, err = time.Parse(time.RFC3339, hour)
+		if err != nil {
+			return nil, err
+		}
+
+		usages = append(usages, u)
+	}
+
+	return usages, rows.Err()
+}
+
+func (ds *sqliteDB) getInstanceUsage(instanceID string, hour time.Time) (*types.InstanceUsage, error) {
+	usages, err := ds.queryInstanceUsages("instance_id = ? AND hour = ?", instanceID, usageHour(hour))
+	if err != nil || len(usages) == 0 {
+		return nil, err
+	}
+
+	return &usages[0], nil
+}
+
+func (ds *sqliteDB) getInstanceUsages(tenantID string, start time.Time, end time.Time) ([]types.InstanceUsage, error) {
+	if tenantID == "" {
+		return ds.queryInstanceUsages("hour >= ? AND hour < ?", usageHour(start), usageHour(end))
+	}
+
+	return ds.queryInstanceUsages("tenant_id = ? AND hour >= ? AND hour < ?", tenantID, usageHour(start), usageHour(end))
+}
+
+// auditTimeFormat formats the timestamps of the audit records with a
+// fixed width, so that they sort and compare as strings.
+const auditTimeFormat = "2006-01-02T15:04:05.000000000Z"
+
+func auditTime(t time.Time) string {
+	return t.UTC().Format(auditTimeFormat)
+}
+
+func (ds *sqliteDB) addAuditRecord(r types.AuditRecord) error {
+	datastore := ds.getTableDB("audit_log")
+
+	ds.dbLock.Lock()
+	defer ds.dbLock.Unlock()
+
+	_, err := datastore.Exec(`INSERT INTO audit_log
+		(timestamp, request_id, user_id, user_name, project_id, roles, source_ip, service, method, resource, status, outcome, latency_ms)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		auditTime(r.Timestamp), r.RequestID, r.UserID, r.UserName, r.ProjectID,
+		strings.Join(r.Roles, ","), r.SourceIP, r.Service, r.Method, r.Resource,
+		r.Status, r.Outcome, r.LatencyMS)
+
+	return err
+}
+
+func (ds *sqliteDB) getAuditRecords(filter types.AuditFilter) ([]types.AuditRecord, error) {
+	datastore := ds.getTableDB("audit_log")
+
+	var where []string
+	var args []interface{}
+
+	if !filter.Start.IsZero() {
+		where = append(where, "timestamp >= ?")
+		args = append(args, auditTime(filter.Start))
+	}
+
+	if !filter.End.IsZero() {
+		where = append(where, "timestamp < ?")
+		args = append(args, auditTime(filter.End))
+	}
+
+	if filter.UserID != "" {
+		where = append(where, "user_id = ?")
+		args = append(args, filter.UserID)
+	}
+
+	if filter.ProjectID != "" {
+		where = append(where, "project_id = ?")
+		args = append(args, filter.ProjectID)
+	}
+
+	if filter.Resource != "" {
+		where = append(where, "substr(resource, 1, length(?)) = ?")
+		args = append(args, filter.Resource, filter.Resource)
+	}
+
+	if filter.Outcome != "" {
+		where = append(where, "outcome = ?")
+		args = append(args, filter.Outcome)
+	}
+
+	query := `SELECT timestamp, request_id, user_id, user_name, project_id, roles, source_ip,
+		service, method, resource, status, outcome, latency_ms
+		FROM audit_log`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY id DESC"
+	if filter.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", filter.Limit)
+	}
+
+	rows, err := datastore.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []types.AuditRecord
+
+	for rows.Next() {
+		var r types.AuditRecord
+		var timestamp string
+		var roles string
+
+		err = rows.Scan(&timestamp, &r.RequestID, &r.UserID, &r.UserName, &r.ProjectID, &roles,
+			&r.SourceIP, &r.Service, &r.Method, &r.Resource, &r.Status, &r.Outcome, &r.LatencyMS)
+		if err != nil {
+			return nil, err
+		}
+
+		r.Timestamp, err = time.Parse(auditTimeFormat, timestamp)
+		if err != nil {
+			return nil, err
+		}
+
+		if roles != "" {
+			r.Roles = strings.Split(roles, ",")
+		}
+
+		records = append(records, r)
+	}
+
+	return records, rows.Err()
+}
+
+func (ds *sqliteDB) updateSchedule(s types.Schedule) error {
+	datastore := ds.getTableDB("schedules")
+
+	ds.dbLock.Lock()
+	defer ds.dbLock.Unlock()
+
+	_, err := datastore.Exec(`INSERT OR REPLACE INTO schedules
+		(id, tenant_id, instance_id, tag, action, cron, create_time, last_run, next_run)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		s.ID, s.TenantID, s.InstanceID, s.Tag, string(s.Action), s.Cron,
+		auditTime(s.CreateTime), auditTime(s.LastRun), auditTime(s.NextRun))
+
+	return err
+}
+
+func (ds *sqliteDB) deleteSchedule(ID string) error {
+	datastore := ds.getTableDB("schedules")
+
+	ds.dbLock.Lock()
+	defer ds.dbLock.Unlock()
+
+	_, err := datastore.Exec("DELETE FROM schedules WHERE id = ?", ID)
+
+	return err
+}
+
+func (ds *sqliteDB) getSchedules() ([]types.Schedule, error) {
+	datastore := ds.getTableDB("schedules")
+
+	rows, err := datastore.Query(`SELECT id, tenant_id, instance_id, tag, action, cron,
+		create_time, last_run, next_run
+		FROM schedules`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var schedules []types.Schedule
+
+	for rows.Next() {
+		var s types.Schedule
+		var action string
+		var times [3]string
+
+		err = rows.Scan(&s.ID, &s.TenantID, &s.InstanceID, &s.Tag, &action, &s.Cron,
+			&times[0], &times[1], &times[2])
+		if err != nil {
+			return nil, err
+		}
+
+		s.Action = types.ScheduleAction(action)
+
+		for i, t := range []*time.Time{&s.CreateTime, &s.LastRun, &s.NextRun} {
+			*t, err = time.Parse(auditTimeFormat, times[i])
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		schedules = append(schedules, s)
+	}
+
+	return schedules, rows.Err()
+}
+
+func (ds *sqliteDB) addKeypair(k types.Keypair) error {
+	datastore := ds.getTableDB("keypairs")
+
+	ds.dbLock.Lock()
+	defer ds.dbLock.Unlock()
+
+	_, err := datastore.Exec(`INSERT INTO keypairs
+		(user_id, name, type, public_key, fingerprint, create_time)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		k.UserID, k.Name, k.Type, k.PublicKey, k.Fingerprint, auditTime(k.CreateTime))
+
+	return err
+}
+
+func (ds *sqliteDB) deleteKeypair(userID string, name string) error {
+	datastore := ds.getTableDB("keypairs")
+
+	ds.dbLock.Lock()
+	defer ds.dbLock.Unlock()
+
+	_, err := datastore.Exec("DELETE FROM keypairs WHERE user_id = ? AND name = ?", userID, name)
+
+	return err
+}
+
+func (ds *sqliteDB) getKeypairs() ([]types.Keypair, error) {
+	datastore := ds.getTableDB("keypairs")
+
+	rows, err := datastore.Query(`SELECT user_id, name, type, public_key, fingerprint, create_time
+		FROM keypairs`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keypairs []types.Keypair
+
+	for rows.Next() {
+		var k types.Keypair
+		var createTime string
+
+		err = rows.Scan(&k.UserID, &k.Name, &k.Type, &k.PublicKey, &k.Fingerprint, &createTime)
+		if err != nil {
+			return nil, err
+		}
+
+		k.CreateTime, err = time.Parse(auditTimeFormat, createTime)
+		if err != nil {
+			return nil, err
+		}
+
+		keypairs = append(keypairs, k)
+	}
+
+	return keypairs, rows.Err()
+}
+
+func (ds *sqliteDB) updateSecurityGroup(g types.SecurityGroup) error {
+	datastore := ds.getTableDB("security_groups")
+
+	rules, err := marshalSecurityGroupRules(g.Rules)
+	if err != nil {
+		return err
+	}
+
+	ds.dbLock.Lock()
+	defer ds.dbLock.Unlock()
+
+	_, err = datastore.Exec(`INSERT OR REPLACE INTO security_groups
+		(id, tenant_id, name, description, rules, create_time)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		g.ID, g.TenantID, g.Name, g.Description, rules, auditTime(g.CreateTime))
+
+	return err
+}
+
+func (ds *sqliteDB) deleteSecurityGroup(ID string) error {
+	datastore := ds.getTableDB("security_groups")
+
+	ds.dbLock.Lock()
+	defer ds.dbLock.Unlock()
+
+	_, err := datastore.Exec("DELETE FROM security_groups WHERE id = ?", ID)
+
+	return err
+}
+
+func (ds *sqliteDB) getSecurityGroups() ([]types.SecurityGroup, error) {
+	datastore := ds.getTableDB("security_groups")
+
+	rows, err := datastore.Query(`SELECT id, tenant_id, name, description, rules, create_time
+		FROM security_groups`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []types.SecurityGroup
+
+	for rows.Next() {
+		var g types.SecurityGroup
+		var rules, createTime string
+
+		err = rows.Scan(&g.ID, &g.TenantID, &g.Name, &g.Description, &rules, &createTime)
+		if err != nil {
+			return nil, err
+		}
+
+		g.Rules, err = unmarshalSecurityGroupRules(rules)
+		if err != nil {
+			return nil, err
+		}
+
+		g.CreateTime, err = time.Parse(auditTimeFormat, createTime)
+		if err != nil {
+			return nil, err
+		}
+
+		groups = append(groups, g)
+	}
+
+	return groups, rows.Err()
+}
+
+func (ds *sqliteDB) updateScalingGroup(g types.ScalingGroup) error {
+	datastore := ds.getTableDB("scaling_groups")
+
+	scaleOut, err := marshalScalingRule(g.ScaleOut)
+	if err != nil {
+		return err
+	}
+
+	scaleIn, err := marshalScalingRule(g.ScaleIn)
+	if err != nil {
+		return err
+	}
+
+	ds.dbLock.Lock()
+	defer ds.dbLock.Unlock()
+
+	_, err = datastore.Exec(`INSERT OR REPLACE INTO scaling_groups
+		(id, tenant_id, name, workload_id, min_instances, max_instances, desired_instances,
+		scale_out, scale_in, cooldown, create_time, last_scale)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		g.ID, g.TenantID, g.Name, g.WorkloadID, g.MinInstances, g.MaxInstances, g.DesiredInstances,
+		scaleOut, scaleIn, g.Cooldown, auditTime(g.CreateTime), auditTime(g.LastScale))
+
+	return err
+}
+
+func (ds *sqliteDB) deleteScalingGroup(ID string) error {
+	datastore := ds.getTableDB("scaling_groups")
+
+	ds.dbLock.Lock()
+	defer ds.dbLock.Unlock()
+
+	tx, err := datastore.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM scaling_activities WHERE group_id = ?", ID)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM scaling_groups WHERE id = ?", ID)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (ds *sqliteDB) getScalingGroups() ([]types.ScalingGroup, error) {
+	datastore := ds.getTableDB("scaling_groups")
+
+	rows, err := datastore.Query(`SELECT id, tenant_id, name, workload_id, min_instances,
+		max_instances, desired_instances, scale_out, scale_in, cooldown, create_time, last_scale
+		FROM scaling_groups`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []types.ScalingGroup
+
+	for rows.Next() {
+		var g types.ScalingGroup
+		var scaleOut, scaleIn string
+		var createTime, lastScale string
+
+		err = rows.Scan(&g.ID, &g.TenantID, &g.Name, &g.WorkloadID, &g.MinInstances,
+			&g.MaxInstances, &g.DesiredInstances, &scaleOut, &scaleIn, &g.Cooldown,
+			&createTime, &lastScale)
+		if err != nil {
+			return nil, err
+		}
+
+		g.ScaleOut, err = unmarshalScalingRule(scaleOut)
+		if err != nil {
+			return nil, err
+		}
+
+		g.ScaleIn, err = unmarshalScalingRule(scaleIn)
+		if err != nil {
+			return nil, err
+		}
+
+		g.CreateTime, err = time.Parse(auditTimeFormat, createTime)
+		if err != nil {
+			return nil, err
+		}
+
+		g.LastScale, err = time.Parse(auditTimeFormat, lastScale)
+		if err != nil {
+			return nil, err
+		}
+
+		groups = append(groups, g)
+	}
+
+	return groups, rows.Err()
+}
+
+func (ds *sqliteDB) addScalingActivity(a types.ScalingActivity) error {
+	datastore := ds.getTableDB("scaling_activities")
+
+	ds.dbLock.Lock()
+	defer ds.dbLock.Unlock()
+
+	_, err := datastore.Exec(`INSERT INTO scaling_activities
+		(group_id, timestamp, from_instances, to_instances, reason)
+		VALUES (?, ?, ?, ?, ?)`,
+		a.GroupID, auditTime(a.Timestamp), a.From, a.To, a.Reason)
+
+	return err
+}
+
+func (ds *sqliteDB) getScalingActivities(groupID string) ([]types.ScalingActivity, error) {
+	datastore := ds.getTableDB("scaling_activities")
+
+	rows, err := datastore.Query(`SELECT group_id, timestamp, from_instances, to_instances, reason
+		FROM scaling_activities WHERE group_id = ? ORDER BY id`, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var activities []types.ScalingActivity
+
+	for rows.Next() {
+		var a types.ScalingActivity
+		var timestamp string
+
+		err = rows.Scan(&a.GroupID, &timestamp, &a.From, &a.To, &a.Reason)
+		if err != nil {
+			return nil, err
+		}
+
+		a.Timestamp, err = time.Parse(auditTimeFormat, timestamp)
+		if err != nil {
+			return nil, err
+		}
+
+		activities = append(activities, a)
+	}
+
+	return activities, rows.Err()
 }
 
 func (ds *sqliteDB) addUsage(instanceID string, usage map[string]int) error {
@@ -16,6 +16,7 @@ package datastore
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"reflect"
 	"testing"
@@ -1033,5 +1034,555 @@ users:
 		t.Fatal("Expected workload equality")
 	}
 
+	// moving the workload to a config file of its own must leave the
+	// previous, possibly shared, file untouched.
+	shared := wl.Config
+	wl.Config = "#cloud-config\n"
+	wl.filename = fmt.Sprintf("%s_other_config.yaml", w.ID)
+	defer os.Remove(fmt.Sprintf("%s/%s", *workloadsPath, wl.filename))
+
+	err = db.updateWorkload(wl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(config) != shared {
+		t.Fatalf("shared config file overwritten: %s", config)
+	}
+
+	wl2, err = db.getWorkload(wl.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if wl2.filename != wl.filename || wl2.Config != wl.Config {
+		t.Fatalf("workload config not updated: %s %s", wl2.filename, wl2.Config)
+	}
+
+	db.disconnect()
+}
+
+func TestSQLiteDBInstanceTransitions(t *testing.T) {
+	db, err := getPersistentStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	instanceID := uuid.Generate().String()
+	now := time.Now()
+
+	transitions := []types.InstanceTransition{
+		{To: types.InstancePending, Timestamp: now},
+		{From: types.InstancePending, To: types.InstanceRunning, Timestamp: now.Add(time.Second)},
+	}
+
+	for _, tr := range transitions {
+		err = db.addInstanceTransition(instanceID, tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	history, err := db.getInstanceTransitions()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(history[instanceID]) != len(transitions) {
+		t.Fatalf("expected %d transitions, got %d", len(transitions), len(history[instanceID]))
+	}
+
+	for i, tr := range history[instanceID] {
+		if tr.From != transitions[i].From || tr.To != transitions[i].To ||
+			!tr.Timestamp.Equal(transitions[i].Timestamp) {
+			t.Fatalf("expected transition %v, got %v", transitions[i], tr)
+		}
+	}
+
+	err = db.deleteInstance(instanceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	history, err = db.getInstanceTransitions()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(history[instanceID]) != 0 {
+		t.Fatal("transitions not deleted with instance")
+	}
+
+	db.disconnect()
+}
+
+func TestSQLiteDBInstanceUsage(t *testing.T) {
+	db, err := getPersistentStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	instanceID := uuid.Generate().String()
+	tenantID := uuid.Generate().String()
+	hour := time.Now().UTC().Truncate(time.Hour)
+
+	usage := types.InstanceUsage{
+		InstanceID: instanceID,
+		TenantID:   tenantID,
+		Hour:       hour,
+		Hours:      0.5,
+		VCPUHours:  1,
+	}
+
+	err = db.addInstanceUsage(usage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// records are updated in place during the hour
+	usage.Hours = 1
+	usage.VCPUHours = 2
+
+	err = db.addInstanceUsage(usage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := db.getInstanceUsage(instanceID, hour)
+	if err != nil || u == nil {
+		t.Fatalf("usage not found: %v", err)
+	}
+
+	if *u != usage {
+		t.Fatalf("expected usage %+v, got %+v", usage, *u)
+	}
+
+	usages, err := db.getInstanceUsages(tenantID, hour, hour.Add(time.Hour))
+	if err != nil || len(usages) != 1 {
+		t.Fatalf("expected 1 usage record, got %d: %v", len(usages), err)
+	}
+
+	usages, err = db.getInstanceUsages(tenantID, hour.Add(time.Hour), hour.Add(2*time.Hour))
+	if err != nil || len(usages) != 0 {
+		t.Fatalf("expected no usage record, got %d: %v", len(usages), err)
+	}
+
+	// usage outlives the instance
+	err = db.deleteInstance(instanceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err = db.getInstanceUsage(instanceID, hour)
+	if err != nil || u == nil {
+		t.Fatalf("usage deleted with instance: %v", err)
+	}
+
+	db.disconnect()
+}
+
+func TestSQLiteDBAuditLog(t *testing.T) {
+	db, err := getPersistentStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	userID := uuid.Generate().String()
+	projectID := uuid.Generate().String()
+	now := time.Now().UTC()
+
+	records := []types.AuditRecord{
+		{
+			Timestamp: now.Add(-time.Hour),
+			RequestID: "req-" + uuid.Generate().String(),
+			UserID:    userID,
+			ProjectID: projectID,
+			Roles:     []string{"admin", "member"},
+			Method:    "POST",
+			Resource:  "/v2.1/" + projectID + "/servers",
+			Status:    202,
+			Outcome:   types.AuditSuccess,
+		},
+		{
+			Timestamp: now,
+			RequestID: "req-" + uuid.Generate().String(),
+			UserID:    userID,
+			ProjectID: projectID,
+			Method:    "DELETE",
+			Resource:  "/v2.1/" + projectID + "/servers/" + uuid.Generate().String(),
+			Status:    403,
+			Outcome:   types.AuditDenied,
+		},
+	}
+
+	for _, r := range records {
+		err = db.addAuditRecord(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	found, err := db.getAuditRecords(types.AuditFilter{UserID: userID})
+	if err != nil || len(found) != 2 {
+		t.Fatalf("expected 2 audit records, got %d: %v", len(found), err)
+	}
+
+	if found[0].RequestID != records[1].RequestID || !found[0].Timestamp.Equal(records[1].Timestamp) {
+		t.Errorf("audit records not returned newest first: %+v", found)
+	}
+
+	if len(found[1].Roles) != 2 || found[1].Roles[1] != "member" {
+		t.Errorf("audit record roles not stored: %v", found[1].Roles)
+	}
+
+	filters := []types.AuditFilter{
+		{UserID: userID, Outcome: types.AuditDenied},
+		{ProjectID: projectID, Start: now.Add(-time.Minute)},
+		{UserID: userID, End: now.Add(-time.Minute)},
+		{Resource: records[1].Resource},
+		{UserID: userID, Limit: 1},
+	}
+
+	for _, f := range filters {
+		found, err = db.getAuditRecords(f)
+		if err != nil || len(found) != 1 {
+			t.Errorf("expected 1 audit record matching %+v, got %d: %v", f, len(found), err)
+		}
+	}
+
+	found, err = db.getAuditRecords(types.AuditFilter{Resource: "/v2.1/" + projectID + "/servers"})
+	if err != nil || len(found) != 2 {
+		t.Errorf("expected 2 audit records under the servers, got %d: %v", len(found), err)
+	}
+
+	// the audit log is append-only
+	datastore := db.(*sqliteDB).getTableDB("audit_log")
+
+	_, err = datastore.Exec("UPDATE audit_log SET outcome = ? WHERE user_id = ?", types.AuditSuccess, userID)
+	if err == nil {
+		t.Error("audit record updated")
+	}
+
+	_, err = datastore.Exec("DELETE FROM audit_log WHERE user_id = ?", userID)
+	if err == nil {
+		t.Error("audit record deleted")
+	}
+
+	db.disconnect()
+}
+
+func TestSQLiteDBSchedules(t *testing.T) {
+	db, err := getPersistentStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC()
+
+	s := types.Schedule{
+		ID:         uuid.Generate().String(),
+		TenantID:   uuid.Generate().String(),
+		Tag:        "dev",
+		Action:     types.ScheduleRestart,
+		Cron:       "30 6 * * 1-5",
+		CreateTime: now,
+		NextRun:    now.Add(time.Hour),
+	}
+
+	err = db.updateSchedule(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.LastRun = s.NextRun
+	s.NextRun = s.NextRun.Add(24 * time.Hour)
+
+	err = db.updateSchedule(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schedules, err := db.getSchedules()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var found *types.Schedule
+	for i := range schedules {
+		if schedules[i].ID == s.ID {
+			found = &schedules[i]
+		}
+	}
+
+	if found == nil {
+		t.Fatal("schedule not stored")
+	}
+
+	if found.Action != s.Action || found.Cron != s.Cron || found.Tag != s.Tag ||
+		!found.CreateTime.Equal(s.CreateTime) || !found.LastRun.Equal(s.LastRun) ||
+		!found.NextRun.Equal(s.NextRun) || found.InstanceID != "" {
+		t.Fatalf("expected schedule %+v, got %+v", s, *found)
+	}
+
+	err = db.deleteSchedule(s.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schedules, err = db.getSchedules()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range schedules {
+		if f.ID == s.ID {
+			t.Fatal("schedule not deleted")
+		}
+	}
+
+	db.disconnect()
+}
+
+func TestSQLiteDBScalingGroups(t *testing.T) {
+	db, err := getPersistentStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC()
+
+	g := types.ScalingGroup{
+		ID:               uuid.Generate().String(),
+		TenantID:         uuid.Generate().String(),
+		Name:             "web",
+		WorkloadID:       uuid.Generate().String(),
+		MinInstances:     1,
+		MaxInstances:     4,
+		DesiredInstances: 2,
+		ScaleOut:         &types.ScalingRule{Metric: types.ScalingCPU, Threshold: 80, Period: 300, Step: 2},
+		ScaleIn:          &types.ScalingRule{Metric: types.ScalingMemory, Threshold: 20, Period: 600, Step: 1},
+		Cooldown:         600,
+		CreateTime:       now,
+	}
+
+	err = db.updateScalingGroup(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g.DesiredInstances = 4
+	g.LastScale = now.Add(time.Minute)
+
+	err = db.updateScalingGroup(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= 2; i++ {
+		err = db.addScalingActivity(types.ScalingActivity{
+			GroupID:   g.ID,
+			Timestamp: now.Add(time.Duration(i) * time.Minute),
+			From:      i,
+			To:        i + 1,
+			Reason:    "test",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	groups, err := db.getScalingGroups()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var found *types.ScalingGroup
+	for i := range groups {
+		if groups[i].ID == g.ID {
+			found = &groups[i]
+		}
+	}
+
+	if found == nil {
+		t.Fatal("scaling group not stored")
+	}
+
+	if found.DesiredInstances != 4 || found.Name != g.Name || found.WorkloadID != g.WorkloadID ||
+		*found.ScaleOut != *g.ScaleOut || *found.ScaleIn != *g.ScaleIn ||
+		!found.CreateTime.Equal(g.CreateTime) || !found.LastScale.Equal(g.LastScale) {
+		t.Fatalf("expected scaling group %+v, got %+v", g, *found)
+	}
+
+	activities, err := db.getScalingActivities(g.ID)
+	if err != nil || len(activities) != 2 || activities[0].From != 1 || activities[1].From != 2 {
+		t.Fatalf("unexpected scaling activities %+v: %v", activities, err)
+	}
+
+	err = db.deleteScalingGroup(g.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	groups, err = db.getScalingGroups()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range groups {
+		if f.ID == g.ID {
+			t.Fatal("scaling group not deleted")
+		}
+	}
+
+	activities, err = db.getScalingActivities(g.ID)
+	if err != nil || len(activities) != 0 {
+		t.Fatalf("scaling activities not deleted: %+v: %v", activities, err)
+	}
+
+	db.disconnect()
+}
+
+func TestSQLiteDBKeypairs(t *testing.T) {
+	db, err := getPersistentStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	k := types.Keypair{
+		UserID:      uuid.Generate().String(),
+		Name:        "laptop",
+		Type:        "ssh",
+		PublicKey:   "ssh-rsa AAAA laptop",
+		Fingerprint: "d4:1d:8c:d9:8f:00:b2:04:e9:80:09:98:ec:f8:42:7e",
+		CreateTime:  time.Now().UTC(),
+	}
+
+	err = db.addKeypair(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.addKeypair(k)
+	if err == nil {
+		t.Fatal("duplicate keypair stored")
+	}
+
+	keypairs, err := db.getKeypairs()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var found *types.Keypair
+	for i := range keypairs {
+		if keypairs[i].UserID == k.UserID && keypairs[i].Name == k.Name {
+			found = &keypairs[i]
+		}
+	}
+
+	if found == nil {
+		t.Fatal("keypair not stored")
+	}
+
+	if found.PublicKey != k.PublicKey || found.Fingerprint != k.Fingerprint ||
+		found.Type != k.Type || !found.CreateTime.Equal(k.CreateTime) {
+		t.Fatalf("expected keypair %+v, got %+v", k, *found)
+	}
+
+	err = db.deleteKeypair(k.UserID, k.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keypairs, err = db.getKeypairs()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range keypairs {
+		if f.UserID == k.UserID && f.Name == k.Name {
+			t.Fatal("keypair not deleted")
+		}
+	}
+
+	db.disconnect()
+}
+
+func TestSQLiteDBSecurityGroups(t *testing.T) {
+	db, err := getPersistentStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g := types.SecurityGroup{
+		ID:          uuid.Generate().String(),
+		TenantID:    uuid.Generate().String(),
+		Name:        "web",
+		Description: "Web servers",
+		Rules: []types.SecurityGroupRule{
+			{
+				ID:         uuid.Generate().String(),
+				Direction:  payloads.Ingress,
+				Protocol:   "tcp",
+				PortMin:    80,
+				PortMax:    443,
+				RemoteCIDR: "0.0.0.0/0",
+			},
+		},
+		CreateTime: time.Now().UTC(),
+	}
+
+	err = db.updateSecurityGroup(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g.Name = "www"
+	err = db.updateSecurityGroup(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	groups, err := db.getSecurityGroups()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var found *types.SecurityGroup
+	for i := range groups {
+		if groups[i].ID == g.ID {
+			found = &groups[i]
+		}
+	}
+
+	if found == nil {
+		t.Fatal("security group not stored")
+	}
+
+	if found.Name != g.Name || found.Description != g.Description || len(found.Rules) != 1 ||
+		found.Rules[0] != g.Rules[0] || !found.CreateTime.Equal(g.CreateTime) {
+		t.Fatalf("expected security group %+v, got %+v", g, *found)
+	}
+
+	err = db.deleteSecurityGroup(g.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	groups, err = db.getSecurityGroups()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range groups {
+		if f.ID == g.ID {
+			t.Fatal("security group not deleted")
+		}
+	}
+
 	db.disconnect()
 }
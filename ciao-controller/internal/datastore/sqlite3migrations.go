@@ -0,0 +1,463 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package datastore
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+// sqliteMigrations are the schema migrations of the persistent sqlite
+// database, in order.  A migration must never be changed once released,
+// schema changes go in a new migration appended to the list.
+var sqliteMigrations = []migration{
+	{
+		Migration{1, "initial schema"},
+		execMigration(
+			`CREATE TABLE IF NOT EXISTS resources
+			(
+			id int primary key,
+			name text
+			);`,
+			`CREATE TABLE IF NOT EXISTS tenants
+			(
+			id varchar(32) primary key,
+			name text,
+			cnci_id varchar(32) default null,
+			cnci_mac string default null,
+			cnci_ip string default null
+			);`,
+			`CREATE TABLE IF NOT EXISTS limits
+			(
+			resource_id integer,
+			tenant_id varchar(32),
+			max_value integer,
+			foreign key(resource_id) references resources(id),
+			foreign key(tenant_id) references tenants(id)
+			);`,
+			`CREATE TABLE IF NOT EXISTS instances
+			(
+			id string primary key,
+			tenant_id string,
+			workload_id string,
+			mac_address string,
+			ip string,
+			create_time DATETIME,
+			foreign key(tenant_id) references tenants(id),
+			foreign key(workload_id) references workload_template(id),
+			unique(tenant_id, ip, mac_address)
+			);`,
+			`CREATE TABLE IF NOT EXISTS workload_template
+			(
+			id varchar(32) primary key,
+			description text,
+			filename text,
+			fw_type text,
+			vm_type text,
+			image_id varchar(32),
+			image_name text,
+			internal integer
+			);`,
+			`CREATE TABLE IF NOT EXISTS workload_resources
+			(
+			workload_id varchar(32),
+			resource_id int,
+			default_value int,
+			estimated_value int,
+			mandatory int,
+			foreign key(workload_id) references workload_template(id),
+			foreign key(resource_id) references resources(id)
+			);`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS wlr_index
+			ON workload_resources(workload_id, resource_id);`,
+			`CREATE TABLE IF NOT EXISTS usage
+			(
+			instance_id string,
+			resource_id int,
+			value int,
+			foreign key(instance_id) references instances(id),
+			foreign key(resource_id) references resources(id)
+			);`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS myindex
+			ON usage(instance_id, resource_id);`,
+			`CREATE TABLE IF NOT EXISTS tenant_network
+			(
+			tenant_id varchar(32),
+			subnet int,
+			rest int,
+			foreign key(tenant_id) references tenants(id)
+			);`,
+			`CREATE TABLE IF NOT EXISTS block_data
+			(
+			id string primary_key,
+			tenant_id string,
+			size integer,
+			state string,
+			create_time DATETIME,
+			name string,
+			description string,
+			foreign key(tenant_id) references tenants(id)
+			);`,
+			`CREATE TABLE IF NOT EXISTS attachments
+			(
+			id string primary key,
+			instance_id string,
+			block_id string,
+			ephemeral int,
+			boot int,
+			foreign key(instance_id) references instances(id),
+			foreign key(block_id) references block_data(id)
+			);`,
+			`CREATE TABLE IF NOT EXISTS workload_storage
+			(
+			workload_id string,
+			volume_id string,
+			bootable int,
+			ephemeral int,
+			size integer,
+			source_type string,
+			source_id string,
+			tag string,
+			foreign key(workload_id) references workloads(id),
+			foreign key(volume_id) references block_data(id)
+			);`,
+			`CREATE TABLE IF NOT EXISTS pools
+			(
+			id varchar(32),
+			name string,
+			free int,
+			total int,
+			PRIMARY KEY(id, name)
+			);`,
+			`CREATE TABLE IF NOT EXISTS subnet_pool
+			(
+			id varchar(32) primary key,
+			pool_id varchar(32),
+			cidr string
+			);`,
+			`CREATE TABLE IF NOT EXISTS address_pool
+			(
+			id varchar(32) primary key,
+			pool_id varchar(32),
+			address string
+			);`,
+			`CREATE TABLE IF NOT EXISTS mapped_ips
+			(
+			id varchar(32) primary key,
+			external_ip string,
+			instance_id varchar(32),
+			pool_id varchar(32)
+			);`,
+		),
+	},
+	{
+		Migration{2, "workload ownership"},
+		func(tx *sql.Tx) error {
+			return addColumns(tx, "workload_template", []string{
+				"tenant_id varchar(32) DEFAULT ''",
+				"visibility text DEFAULT 'public'",
+			})
+		},
+	},
+	{
+		Migration{3, "instance state transitions"},
+		execMigration(
+			`CREATE TABLE IF NOT EXISTS instance_transitions
+			(
+			id integer primary key,
+			instance_id string,
+			from_state string,
+			to_state string,
+			timestamp DATETIME
+			);`,
+		),
+	},
+	{
+		Migration{4, "hourly instance usage"},
+		execMigration(
+			`CREATE TABLE IF NOT EXISTS instance_usage
+			(
+			instance_id string,
+			tenant_id string,
+			workload_id string,
+			hour string,
+			hours real,
+			vcpu_hours real,
+			memory_gb_hours real,
+			disk_gb_hours real,
+			volume_gb_hours real,
+			external_ip_hours real,
+			primary key(instance_id, hour)
+			);`,
+			`CREATE INDEX IF NOT EXISTS instance_usage_hour
+			ON instance_usage(hour);`,
+		),
+	},
+	{
+		Migration{5, "audit log"},
+		execMigration(
+			`CREATE TABLE IF NOT EXISTS audit_log
+			(
+			id integer primary key,
+			timestamp string,
+			request_id string,
+			user_id string,
+			user_name string,
+			project_id string,
+			roles string,
+			source_ip string,
+			service string,
+			method string,
+			resource string,
+			status integer,
+			outcome string,
+			latency_ms real
+			);`,
+			`CREATE INDEX IF NOT EXISTS audit_log_timestamp
+			ON audit_log(timestamp);`,
+			`CREATE TRIGGER IF NOT EXISTS audit_log_no_update
+			BEFORE UPDATE ON audit_log
+			BEGIN
+				SELECT RAISE(ABORT, 'audit log is append-only');
+			END;`,
+			`CREATE TRIGGER IF NOT EXISTS audit_log_no_delete
+			BEFORE DELETE ON audit_log
+			BEGIN
+				SELECT RAISE(ABORT, 'audit log is append-only');
+			END;`,
+		),
+	},
+	{
+		Migration{6, "instance names, tags and metadata"},
+		execMigration(
+			`CREATE TABLE IF NOT EXISTS instance_details
+			(
+			instance_id string primary key,
+			name string,
+			tags string,
+			metadata string
+			);`,
+		),
+	},
+	{
+		Migration{7, "workload parameters"},
+		func(tx *sql.Tx) error {
+			return addColumns(tx, "workload_template", []string{
+				"parameters text DEFAULT ''",
+			})
+		},
+	},
+	{
+		Migration{8, "restart policies"},
+		func(tx *sql.Tx) error {
+			err := addColumns(tx, "workload_template", []string{
+				"restart_policy text DEFAULT ''",
+			})
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS instance_configs
+			(
+			instance_id string primary key,
+			config string
+			);`)
+			return err
+		},
+	},
+	{
+		Migration{9, "instance schedules"},
+		execMigration(
+			`CREATE TABLE IF NOT EXISTS schedules
+			(
+			id string primary key,
+			tenant_id string,
+			instance_id string,
+			tag string,
+			action string,
+			cron string,
+			create_time string,
+			last_run string,
+			next_run string
+			);`,
+		),
+	},
+	{
+		Migration{10, "scaling groups"},
+		execMigration(
+			`CREATE TABLE IF NOT EXISTS scaling_groups
+			(
+			id string primary key,
+			tenant_id string,
+			name string,
+			workload_id string,
+			min_instances integer,
+			max_instances integer,
+			desired_instances integer,
+			scale_out string,
+			scale_in string,
+			cooldown integer,
+			create_time string,
+			last_scale string
+			);`,
+			`CREATE TABLE IF NOT EXISTS scaling_activities
+			(
+			id integer primary key autoincrement,
+			group_id string,
+			timestamp string,
+			from_instances integer,
+			to_instances integer,
+			reason string
+			);`,
+		),
+	},
+	{
+		Migration{11, "health checks"},
+		func(tx *sql.Tx) error {
+			err := addColumns(tx, "workload_template", []string{
+				"health_check text DEFAULT ''",
+			})
+			if err != nil {
+				return err
+			}
+
+			return addColumns(tx, "instance_details", []string{
+				"health_check text DEFAULT ''",
+			})
+		},
+	},
+	{
+		Migration{12, "keypairs"},
+		func(tx *sql.Tx) error {
+			_, err := tx.Exec(`CREATE TABLE IF NOT EXISTS keypairs
+			(
+			user_id string,
+			name string,
+			type string,
+			public_key string,
+			fingerprint string,
+			create_time string,
+			primary key(user_id, name)
+			);`)
+			if err != nil {
+				return err
+			}
+
+			return addColumns(tx, "instance_details", []string{
+				"key_name text DEFAULT ''",
+				"public_key text DEFAULT ''",
+			})
+		},
+	},
+	{
+		Migration{13, "security groups"},
+		func(tx *sql.Tx) error {
+			_, err := tx.Exec(`CREATE TABLE IF NOT EXISTS security_groups
+			(
+			id string primary key,
+			tenant_id string,
+			name string,
+			description string,
+			rules string,
+			create_time string
+			);`)
+			if err != nil {
+				return err
+			}
+
+			return addColumns(tx, "instance_details", []string{
+				"security_groups text DEFAULT ''",
+			})
+		},
+	},
+	{
+		Migration{14, "unlimited quotas"},
+		execMigration(
+			"UPDATE limits SET max_value = -1 WHERE max_value = 0",
+		),
+	},
+}
+
+// addColumns adds the columns that are missing from an existing table.
+// Each column is given as a column definition, name first.
+func addColumns(tx *sql.Tx, table string, columns []string) error {
+	rows, err := tx.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var dflt sql.NullString
+
+		err = rows.Scan(&cid, &name, &colType, &notNull, &dflt, &pk)
+		if err != nil {
+			return err
+		}
+
+		existing[name] = true
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, column := range columns {
+		name := strings.Fields(column)[0]
+		if existing[name] {
+			continue
+		}
+
+		cmd := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", table, column)
+		glog.V(2).Info("exec: ", cmd)
+
+		_, err = tx.Exec(cmd)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func sqliteSchema(db *sql.DB) schema {
+	return schema{
+		db:                db,
+		migrations:        sqliteMigrations,
+		versionTableQuery: "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_version'",
+	}
+}
+
+func (ds *sqliteDB) pendingMigrations(config Config) ([]Migration, error) {
+	db, err := sql.Open("sqlite3", config.PersistentURI)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	pending, err := sqliteSchema(db).pending()
+	if err != nil {
+		return nil, err
+	}
+
+	return migrationList(pending), nil
+}
@@ -0,0 +1,269 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package datastore
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	sqlite3 "github.com/mattn/go-sqlite3"
+	"github.com/pkg/errors"
+)
+
+// names of the database files in a snapshot directory
+const (
+	PersistentSnapshot = "ciao-controller.db"
+	TransientSnapshot  = "ciao-controller-stats.db"
+)
+
+// snapshotBusyRetries bounds how long a snapshot waits for connections
+// outside of the datastore to release their locks.
+const snapshotBusyRetries = 100
+
+// snapshot copies the persistent and transient databases to dir using
+// the sqlite online backup API.  The datastore locks are held for the
+// whole copy, so that both databases are copied at the same point.
+func (ds *sqliteDB) snapshot(dir string) ([]string, error) {
+	ds.dbLock.Lock()
+	defer ds.dbLock.Unlock()
+
+	ds.tdbLock.Lock()
+	defer ds.tdbLock.Unlock()
+
+	files := []string{
+		filepath.Join(dir, PersistentSnapshot),
+		filepath.Join(dir, TransientSnapshot),
+	}
+
+	err := sqliteBackup(ds.dbName, files[0])
+	if err != nil {
+		return nil, errors.Wrap(err, "persistent database snapshot")
+	}
+
+	err = sqliteBackup(ds.tdbName, files[1])
+	if err != nil {
+		return nil, errors.Wrap(err, "transient database snapshot")
+	}
+
+	return files, nil
+}
+
+// sqliteBackup copies the database at srcURI to a new database file
+// at dest.
+func sqliteBackup(srcURI string, dest string) error {
+	driver := &sqlite3.SQLiteDriver{}
+
+	srcConn, err := driver.Open(srcURI)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+
+	if _, err := os.Stat(dest); err == nil {
+		return fmt.Errorf("%s already exists", dest)
+	}
+
+	destConn, err := driver.Open("file:" + dest)
+	if err != nil {
+		return err
+	}
+	defer destConn.Close()
+
+	b, err := destConn.(*sqlite3.SQLiteConn).Backup("main", srcConn.(*sqlite3.SQLiteConn), "main")
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < snapshotBusyRetries; i++ {
+		done, err := b.Step(-1)
+		if err != nil {
+			b.Finish()
+			return err
+		}
+
+		if done {
+			return b.Finish()
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	b.Finish()
+
+	return errors.New("database is busy")
+}
+
+// SnapshotInstance is an instance recorded in a snapshot.
+type SnapshotInstance struct {
+	ID       string
+	TenantID string
+
+	// NodeID is the node which last reported statistics for the
+	// instance, if any.
+	NodeID string
+}
+
+// SnapshotContents summarizes the state recorded in a snapshot.
+type SnapshotContents struct {
+	SchemaVersion     int
+	PendingMigrations []Migration
+	Tenants           []string
+	Instances         []SnapshotInstance
+}
+
+// ReadSnapshot summarizes the snapshot written by Snapshot in dir.  The
+// snapshot is not migrated, but an error is returned if its schema is
+// newer than this controller knows.
+func ReadSnapshot(dir string) (*SnapshotContents, error) {
+	path := filepath.Join(dir, PersistentSnapshot)
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open("sqlite3", "file:"+path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	s := sqliteSchema(db)
+
+	var contents SnapshotContents
+
+	contents.SchemaVersion, err = s.version()
+	if err != nil {
+		return nil, err
+	}
+
+	pending, err := s.pending()
+	if err != nil {
+		return nil, err
+	}
+	contents.PendingMigrations = migrationList(pending)
+
+	contents.Tenants, err = snapshotTenants(db)
+	if err != nil {
+		return nil, errors.Wrap(err, "read tenants")
+	}
+
+	contents.Instances, err = snapshotInstances(db)
+	if err != nil {
+		return nil, errors.Wrap(err, "read instances")
+	}
+
+	nodes, err := snapshotInstanceNodes(filepath.Join(dir, TransientSnapshot))
+	if err != nil {
+		return nil, errors.Wrap(err, "read instance statistics")
+	}
+
+	for i := range contents.Instances {
+		contents.Instances[i].NodeID = nodes[contents.Instances[i].ID]
+	}
+
+	return &contents, nil
+}
+
+func snapshotTenants(db *sql.DB) ([]string, error) {
+	rows, err := db.Query("SELECT id FROM tenants")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tenants []string
+	for rows.Next() {
+		var id string
+
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+
+		tenants = append(tenants, id)
+	}
+
+	return tenants, rows.Err()
+}
+
+func snapshotInstances(db *sql.DB) ([]SnapshotInstance, error) {
+	rows, err := db.Query("SELECT id, tenant_id FROM instances")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var instances []SnapshotInstance
+	for rows.Next() {
+		var i SnapshotInstance
+
+		err = rows.Scan(&i.ID, &i.TenantID)
+		if err != nil {
+			return nil, err
+		}
+
+		instances = append(instances, i)
+	}
+
+	return instances, rows.Err()
+}
+
+// snapshotInstanceNodes returns the node which last reported each
+// instance in the transient database at path.  The transient database
+// is optional, it holds nothing which is not rebuilt by the nodes.
+func snapshotInstanceNodes(path string) (map[string]string, error) {
+	nodes := make(map[string]string)
+
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nodes, nil
+	}
+
+	db, err := sql.Open("sqlite3", "file:"+path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var tables int
+	err = db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'instance_statistics'").Scan(&tables)
+	if err != nil || tables == 0 {
+		return nodes, err
+	}
+
+	rows, err := db.Query("SELECT instance_id, node_id FROM instance_statistics ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var instanceID string
+		var nodeID sql.NullString
+
+		err = rows.Scan(&instanceID, &nodeID)
+		if err != nil {
+			return nil, err
+		}
+
+		if nodeID.Valid && nodeID.String != "" {
+			nodes[instanceID] = nodeID.String
+		}
+	}
+
+	return nodes, rows.Err()
+}
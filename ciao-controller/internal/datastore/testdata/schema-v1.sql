@@ -0,0 +1,147 @@
+-- Persistent controller database as created before workloads could be
+-- owned by a tenant.  The schema is not versioned.
+CREATE TABLE resources
+(
+id int primary key,
+name text
+);
+CREATE TABLE tenants
+(
+id varchar(32) primary key,
+name text,
+cnci_id varchar(32) default null,
+cnci_mac string default null,
+cnci_ip string default null
+);
+CREATE TABLE limits
+(
+resource_id integer,
+tenant_id varchar(32),
+max_value integer,
+foreign key(resource_id) references resources(id),
+foreign key(tenant_id) references tenants(id)
+);
+CREATE TABLE instances
+(
+id string primary key,
+tenant_id string,
+workload_id string,
+mac_address string,
+ip string,
+create_time DATETIME,
+foreign key(tenant_id) references tenants(id),
+foreign key(workload_id) references workload_template(id),
+unique(tenant_id, ip, mac_address)
+);
+CREATE TABLE workload_template
+(
+id varchar(32) primary key,
+description text,
+filename text,
+fw_type text,
+vm_type text,
+image_id varchar(32),
+image_name text,
+internal integer
+);
+CREATE TABLE workload_resources
+(
+workload_id varchar(32),
+resource_id int,
+default_value int,
+estimated_value int,
+mandatory int,
+foreign key(workload_id) references workload_template(id),
+foreign key(resource_id) references resources(id)
+);
+CREATE UNIQUE INDEX wlr_index ON workload_resources(workload_id, resource_id);
+CREATE TABLE usage
+(
+instance_id string,
+resource_id int,
+value int,
+foreign key(instance_id) references instances(id),
+foreign key(resource_id) references resources(id)
+);
+CREATE UNIQUE INDEX myindex ON usage(instance_id, resource_id);
+CREATE TABLE tenant_network
+(
+tenant_id varchar(32),
+subnet int,
+rest int,
+foreign key(tenant_id) references tenants(id)
+);
+CREATE TABLE block_data
+(
+id string primary_key,
+tenant_id string,
+size integer,
+state string,
+create_time DATETIME,
+name string,
+description string,
+foreign key(tenant_id) references tenants(id)
+);
+CREATE TABLE attachments
+(
+id string primary key,
+instance_id string,
+block_id string,
+ephemeral int,
+boot int,
+foreign key(instance_id) references instances(id),
+foreign key(block_id) references block_data(id)
+);
+CREATE TABLE workload_storage
+(
+workload_id string,
+volume_id string,
+bootable int,
+ephemeral int,
+size integer,
+source_type string,
+source_id string,
+tag string,
+foreign key(workload_id) references workloads(id),
+foreign key(volume_id) references block_data(id)
+);
+CREATE TABLE pools
+(
+id varchar(32),
+name string,
+free int,
+total int,
+PRIMARY KEY(id, name)
+);
+CREATE TABLE subnet_pool
+(
+id varchar(32) primary key,
+pool_id varchar(32),
+cidr string
+);
+CREATE TABLE address_pool
+(
+id varchar(32) primary key,
+pool_id varchar(32),
+address string
+);
+CREATE TABLE mapped_ips
+(
+id varchar(32) primary key,
+external_ip string,
+instance_id varchar(32),
+pool_id varchar(32)
+);
+INSERT INTO resources VALUES (1, 'instances');
+INSERT INTO resources VALUES (2, 'vcpus');
+INSERT INTO resources VALUES (3, 'mem_mb');
+INSERT INTO tenants VALUES ('a0b2c8f4-5e21-4e4b-8d2a-3f0e6c1b9d70', '', '', '02:00:8c:ba:f9:45', '');
+INSERT INTO limits VALUES (1, 'a0b2c8f4-5e21-4e4b-8d2a-3f0e6c1b9d70', 10);
+INSERT INTO limits VALUES (2, 'a0b2c8f4-5e21-4e4b-8d2a-3f0e6c1b9d70', 0);
+INSERT INTO workload_template VALUES ('7d6b3e1a-0f4c-4a8e-9b2d-5c1e8f3a6b90', 'Fixture Workload', 'test.yaml', 'legacy', 'qemu', '73a86d7e-93c0-480e-9c41-ab42f69b7799', '', 0);
+INSERT INTO workload_resources VALUES ('7d6b3e1a-0f4c-4a8e-9b2d-5c1e8f3a6b90', 2, 2, 2, 1);
+INSERT INTO workload_resources VALUES ('7d6b3e1a-0f4c-4a8e-9b2d-5c1e8f3a6b90', 3, 256, 256, 1);
+INSERT INTO instances VALUES ('3c9e1f7a-2b4d-4c6e-8a0f-1d3b5e7a9c20', 'a0b2c8f4-5e21-4e4b-8d2a-3f0e6c1b9d70', '7d6b3e1a-0f4c-4a8e-9b2d-5c1e8f3a6b90', '02:00:ac:11:00:02', '172.16.0.2', '2017-03-01T10:00:00Z');
+INSERT INTO usage VALUES ('3c9e1f7a-2b4d-4c6e-8a0f-1d3b5e7a9c20', 2, 2);
+INSERT INTO usage VALUES ('3c9e1f7a-2b4d-4c6e-8a0f-1d3b5e7a9c20', 3, 256);
+INSERT INTO tenant_network VALUES ('a0b2c8f4-5e21-4e4b-8d2a-3f0e6c1b9d70', 4096, 2);
@@ -0,0 +1,269 @@
+-- Persistent controller database as created once hourly instance usage
+-- was recorded, at schema version 4.
+CREATE TABLE resources
+(
+id int primary key,
+name text
+);
+CREATE TABLE tenants
+(
+id varchar(32) primary key,
+name text,
+cnci_id varchar(32) default null,
+cnci_mac string default null,
+cnci_ip string default null
+);
+CREATE TABLE limits
+(
+resource_id integer,
+tenant_id varchar(32),
+max_value integer,
+foreign key(resource_id) references resources(id),
+foreign key(tenant_id) references tenants(id)
+);
+CREATE TABLE instances
+(
+id string primary key,
+tenant_id string,
+workload_id string,
+mac_address string,
+ip string,
+create_time DATETIME,
+foreign key(tenant_id) references tenants(id),
+foreign key(workload_id) references workload_template(id),
+unique(tenant_id, ip, mac_address)
+);
+CREATE TABLE workload_template
+(
+id varchar(32) primary key,
+description text,
+filename text,
+fw_type text,
+vm_type text,
+image_id varchar(32),
+image_name text,
+internal integer,
+tenant_id varchar(32) DEFAULT '',
+visibility text DEFAULT 'public',
+parameters text DEFAULT '',
+restart_policy text DEFAULT ''
+);
+CREATE TABLE workload_resources
+(
+workload_id varchar(32),
+resource_id int,
+default_value int,
+estimated_value int,
+mandatory int,
+foreign key(workload_id) references workload_template(id),
+foreign key(resource_id) references resources(id)
+);
+CREATE UNIQUE INDEX wlr_index ON workload_resources(workload_id, resource_id);
+CREATE TABLE usage
+(
+instance_id string,
+resource_id int,
+value int,
+foreign key(instance_id) references instances(id),
+foreign key(resource_id) references resources(id)
+);
+CREATE UNIQUE INDEX myindex ON usage(instance_id, resource_id);
+CREATE TABLE tenant_network
+(
+tenant_id varchar(32),
+subnet int,
+rest int,
+foreign key(tenant_id) references tenants(id)
+);
+CREATE TABLE block_data
+(
+id string primary_key,
+tenant_id string,
+size integer,
+state string,
+create_time DATETIME,
+name string,
+description string,
+foreign key(tenant_id) references tenants(id)
+);
+CREATE TABLE attachments
+(
+id string primary key,
+instance_id string,
+block_id string,
+ephemeral int,
+boot int,
+foreign key(instance_id) references instances(id),
+foreign key(block_id) references block_data(id)
+);
+CREATE TABLE workload_storage
+(
+workload_id string,
+volume_id string,
+bootable int,
+ephemeral int,
+size integer,
+source_type string,
+source_id string,
+tag string,
+foreign key(workload_id) references workloads(id),
+foreign key(volume_id) references block_data(id)
+);
+CREATE TABLE pools
+(
+id varchar(32),
+name string,
+free int,
+total int,
+PRIMARY KEY(id, name)
+);
+CREATE TABLE subnet_pool
+(
+id varchar(32) primary key,
+pool_id varchar(32),
+cidr string
+);
+CREATE TABLE address_pool
+(
+id varchar(32) primary key,
+pool_id varchar(32),
+address string
+);
+CREATE TABLE mapped_ips
+(
+id varchar(32) primary key,
+external_ip string,
+instance_id varchar(32),
+pool_id varchar(32)
+);
+CREATE TABLE instance_transitions
+(
+id integer primary key,
+instance_id string,
+from_state string,
+to_state string,
+timestamp DATETIME
+);
+CREATE TABLE schema_version
+(
+version integer PRIMARY KEY,
+applied timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE instance_usage
+(
+instance_id string,
+tenant_id string,
+workload_id string,
+hour string,
+hours real,
+vcpu_hours real,
+memory_gb_hours real,
+disk_gb_hours real,
+volume_gb_hours real,
+external_ip_hours real,
+primary key(instance_id, hour)
+);
+CREATE INDEX instance_usage_hour ON instance_usage(hour);
+CREATE TABLE audit_log
+(
+id integer primary key,
+timestamp string,
+request_id string,
+user_id string,
+user_name string,
+project_id string,
+roles string,
+source_ip string,
+service string,
+method string,
+resource string,
+status integer,
+outcome string,
+latency_ms real
+);
+CREATE INDEX audit_log_timestamp ON audit_log(timestamp);
+CREATE TRIGGER audit_log_no_update BEFORE UPDATE ON audit_log BEGIN SELECT RAISE(ABORT, 'audit log is append-only'); END;
+CREATE TRIGGER audit_log_no_delete BEFORE DELETE ON audit_log BEGIN SELECT RAISE(ABORT, 'audit log is append-only'); END;
+CREATE TABLE instance_details
+(
+instance_id string primary key,
+name string,
+tags string,
+metadata string
+);
+CREATE TABLE instance_configs
+(
+instance_id string primary key,
+config string
+);
+CREATE TABLE schedules
+(
+id string primary key,
+tenant_id string,
+instance_id string,
+tag string,
+action string,
+cron string,
+create_time string,
+last_run string,
+next_run string
+);
+CREATE TABLE scaling_groups
+(
+id string primary key,
+tenant_id string,
+name string,
+workload_id string,
+min_instances integer,
+max_instances integer,
+desired_instances integer,
+scale_out string,
+scale_in string,
+cooldown integer,
+create_time string,
+last_scale string
+);
+CREATE TABLE scaling_activities
+(
+id integer primary key autoincrement,
+group_id string,
+timestamp string,
+from_instances integer,
+to_instances integer,
+reason string
+);
+INSERT INTO resources VALUES (1, 'instances');
+INSERT INTO resources VALUES (2, 'vcpus');
+INSERT INTO resources VALUES (3, 'mem_mb');
+INSERT INTO tenants VALUES ('a0b2c8f4-5e21-4e4b-8d2a-3f0e6c1b9d70', '', '', '02:00:8c:ba:f9:45', '');
+INSERT INTO limits VALUES (1, 'a0b2c8f4-5e21-4e4b-8d2a-3f0e6c1b9d70', 10);
+INSERT INTO limits VALUES (2, 'a0b2c8f4-5e21-4e4b-8d2a-3f0e6c1b9d70', 0);
+INSERT INTO workload_template VALUES ('7d6b3e1a-0f4c-4a8e-9b2d-5c1e8f3a6b90', 'Fixture Workload', 'test.yaml', 'legacy', 'qemu', '73a86d7e-93c0-480e-9c41-ab42f69b7799', '', 0, '', 'public', '[{"name":"greeting","default":"hello"}]', '{"condition":"on-failure","max_restarts":3}');
+INSERT INTO workload_resources VALUES ('7d6b3e1a-0f4c-4a8e-9b2d-5c1e8f3a6b90', 2, 2, 2, 1);
+INSERT INTO workload_resources VALUES ('7d6b3e1a-0f4c-4a8e-9b2d-5c1e8f3a6b90', 3, 256, 256, 1);
+INSERT INTO instances VALUES ('3c9e1f7a-2b4d-4c6e-8a0f-1d3b5e7a9c20', 'a0b2c8f4-5e21-4e4b-8d2a-3f0e6c1b9d70', '7d6b3e1a-0f4c-4a8e-9b2d-5c1e8f3a6b90', '02:00:ac:11:00:02', '172.16.0.2', '2017-03-01T10:00:00Z');
+INSERT INTO usage VALUES ('3c9e1f7a-2b4d-4c6e-8a0f-1d3b5e7a9c20', 2, 2);
+INSERT INTO usage VALUES ('3c9e1f7a-2b4d-4c6e-8a0f-1d3b5e7a9c20', 3, 256);
+INSERT INTO tenant_network VALUES ('a0b2c8f4-5e21-4e4b-8d2a-3f0e6c1b9d70', 4096, 2);
+INSERT INTO instance_transitions (instance_id, from_state, to_state, timestamp) VALUES ('3c9e1f7a-2b4d-4c6e-8a0f-1d3b5e7a9c20', '', 'pending', '2017-03-01T10:00:00Z');
+INSERT INTO schema_version (version) VALUES (1);
+INSERT INTO schema_version (version) VALUES (2);
+INSERT INTO schema_version (version) VALUES (3);
+INSERT INTO schema_version (version) VALUES (4);
+INSERT INTO schema_version (version) VALUES (5);
+INSERT INTO schema_version (version) VALUES (6);
+INSERT INTO schema_version (version) VALUES (7);
+INSERT INTO schema_version (version) VALUES (8);
+INSERT INTO schema_version (version) VALUES (9);
+INSERT INTO schema_version (version) VALUES (10);
+INSERT INTO instance_usage VALUES ('3c9e1f7a-2b4d-4c6e-8a0f-1d3b5e7a9c20', 'a0b2c8f4-5e21-4e4b-8d2a-3f0e6c1b9d70', '7d6b3e1a-0f4c-4a8e-9b2d-5c1e8f3a6b90', '2017-03-01T10:00:00Z', 0.5, 1, 0.125, 0, 0, 0);
+INSERT INTO audit_log (timestamp, request_id, user_id, user_name, project_id, roles, source_ip, service, method, resource, status, outcome, latency_ms) VALUES ('2017-03-01T10:00:00.000000000Z', 'req-5f0c2d1e-8a7b-4c3d-9e6f-1a2b3c4d5e6f', 'f9e8d7c6-b5a4-4392-8170-6f5e4d3c2b1a', 'admin', 'a0b2c8f4-5e21-4e4b-8d2a-3f0e6c1b9d70', 'admin', '10.0.0.1', 'compute', 'POST', '/v2.1/a0b2c8f4-5e21-4e4b-8d2a-3f0e6c1b9d70/servers', 202, 'success', 12.5);
+INSERT INTO instance_details VALUES ('3c9e1f7a-2b4d-4c6e-8a0f-1d3b5e7a9c20', 'fixture-server', '["fixture"]', '{"role":"fixture"}');
+INSERT INTO instance_configs VALUES ('3c9e1f7a-2b4d-4c6e-8a0f-1d3b5e7a9c20', '---
+start:
+  instance_uuid: 3c9e1f7a-2b4d-4c6e-8a0f-1d3b5e7a9c20
+...
+');
+INSERT INTO schedules VALUES ('5e2a9c7b-1d3f-4a6e-8b0c-2f4d6e8a0b13', 'a0b2c8f4-5e21-4e4b-8d2a-3f0e6c1b9d70', '3c9e1f7a-2b4d-4c6e-8a0f-1d3b5e7a9c20', '', 'stop', '0 19 * * 1-5', '2017-03-01T10:00:00.000000000Z', '0001-01-01T00:00:00.000000000Z', '2017-03-01T19:00:00.000000000Z');
+INSERT INTO scaling_groups VALUES ('8b1d4f6a-3c5e-4a7b-9d0f-2e4c6a8b0d35', 'a0b2c8f4-5e21-4e4b-8d2a-3f0e6c1b9d70', 'web', '7d6b3e1a-0f4c-4a8e-9b2d-5c1e8f3a6b90', 1, 4, 2, '{"metric":"cpu","threshold":80,"period":300,"step":1}', '', 600, '2017-03-01T10:00:00.000000000Z', '2017-03-01T11:00:00.000000000Z');
+INSERT INTO scaling_activities (group_id, timestamp, from_instances, to_instances, reason) VALUES ('8b1d4f6a-3c5e-4a7b-9d0f-2e4c6a8b0d35', '2017-03-01T11:00:00.000000000Z', 1, 2, 'cpu 90% above 80%');
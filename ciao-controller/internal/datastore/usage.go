@@ -0,0 +1,181 @@
+/*
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package datastore
+
+import (
+	"sync"
+	"time"
+
+	"github.com/01org/ciao/ciao-controller/types"
+	"github.com/01org/ciao/payloads"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// maxMeterGap bounds the time metered between two statistics of an
+// instance.  Longer gaps, when the controller or the node was down, are
+// not metered as nothing is known of the instance meanwhile.
+var maxMeterGap = 10 * time.Minute
+
+// meter accumulates the usage of an instance during the current hour.
+type meter struct {
+	last  time.Time
+	usage types.InstanceUsage
+}
+
+// usageMeters holds the meters of the instances reporting statistics.
+type usageMeters struct {
+	sync.Mutex
+	meters map[string]*meter
+}
+
+// usageRates is the hourly consumption of an instance, as of its last
+// statistics.
+type usageRates struct {
+	vcpus       float64
+	memoryGB    float64
+	diskGB      float64
+	volumeGB    float64
+	externalIPs float64
+}
+
+func (r usageRates) add(u *types.InstanceUsage, hours float64) {
+	u.Hours += hours
+	u.VCPUHours += r.vcpus * hours
+	u.MemoryGBHours += r.memoryGB * hours
+	u.DiskGBHours += r.diskGB * hours
+	u.VolumeGBHours += r.volumeGB * hours
+	u.ExternalIPHours += r.externalIPs * hours
+}
+
+// instanceUsageRates returns the resources the instance consumes.  vCPUs
+// and memory are the ones allocated to the instance, disk is what the
+// instance reported using.
+func (ds *Datastore) instanceUsageRates(i *types.Instance, stat payloads.InstanceStat) usageRates {
+	rates := usageRates{
+		vcpus:    float64(i.Usage[string(payloads.VCPUs)]),
+		memoryGB: float64(i.Usage[string(payloads.MemMB)]) / 1024,
+		diskGB:   float64(reduceToZero(stat.DiskUsageMB)) / 1024,
+	}
+
+	for _, a := range ds.GetStorageAttachments(i.ID) {
+		bd, err := ds.GetBlockDevice(a.BlockID)
+		if err == nil {
+			rates.volumeGB += float64(bd.Size)
+		}
+	}
+
+	ds.poolsLock.RLock()
+	for _, m := range ds.mappedIPs {
+		if m.InstanceID == i.ID {
+			rates.externalIPs++
+		}
+	}
+	ds.poolsLock.RUnlock()
+
+	return rates
+}
+
+// hourUsage returns the usage record of the instance for the hour,
+// resuming the one already stored when the controller restarted during
+// that hour.
+func (ds *Datastore) hourUsage(i *types.Instance, hour time.Time) types.InstanceUsage {
+	u, err := ds.db.getInstanceUsage(i.ID, hour)
+	if err != nil {
+		glog.Warningf("Unable to retrieve usage of instance %s: %v", i.ID, err)
+	}
+
+	if u != nil {
+		return *u
+	}
+
+	return types.InstanceUsage{
+		InstanceID: i.ID,
+		TenantID:   i.TenantID,
+		WorkloadID: i.WorkloadID,
+		Hour:       hour,
+	}
+}
+
+// meterInstance adds the usage of an instance since its previous
+// statistics to its hourly usage records.  Instances are only metered
+// while they report running.
+func (ds *Datastore) meterInstance(i *types.Instance, stat payloads.InstanceStat, now time.Time) {
+	rates := ds.instanceUsageRates(i, stat)
+
+	ds.meters.Lock()
+	defer ds.meters.Unlock()
+
+	if ds.meters.meters == nil {
+		ds.meters.meters = make(map[string]*meter)
+	}
+
+	m, ok := ds.meters.meters[i.ID]
+	if !ok {
+		ds.meters.meters[i.ID] = &meter{last: now}
+		return
+	}
+
+	if stat.State != payloads.ComputeStatusRunning || now.Sub(m.last) > maxMeterGap {
+		m.last = now
+		return
+	}
+
+	for t := m.last; t.Before(now); {
+		hour := t.UTC().Truncate(time.Hour)
+
+		end := hour.Add(time.Hour)
+		if end.After(now) {
+			end = now
+		}
+
+		if !m.usage.Hour.Equal(hour) {
+			m.usage = ds.hourUsage(i, hour)
+		}
+
+		rates.add(&m.usage, end.Sub(t).Hours())
+
+		err := ds.db.addInstanceUsage(m.usage)
+		if err != nil {
+			glog.Warningf("Unable to record usage of instance %s: %v", i.ID, err)
+		}
+
+		t = end
+	}
+
+	m.last = now
+}
+
+// stopMeter forgets the meter of a deleted instance, its usage records
+// are kept.
+func (ds *Datastore) stopMeter(instanceID string) {
+	ds.meters.Lock()
+	delete(ds.meters.meters, instanceID)
+	ds.meters.Unlock()
+}
+
+// GetInstanceUsage returns the hourly usage records of the instances of a
+// tenant, or of all the tenants if tenantID is empty, for the hours
+// starting between start and end.
+func (ds *Datastore) GetInstanceUsage(tenantID string, start time.Time, end time.Time) ([]types.InstanceUsage, error) {
+	usages, err := ds.db.getInstanceUsages(tenantID, start.UTC().Truncate(time.Hour), end)
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving instance usage")
+	}
+
+	return usages, nil
+}
@@ -0,0 +1,241 @@
+/*
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package eventsink forwards the events of the ciao controller to
+// external systems such as webhooks, syslog or JSON-lines files.
+package eventsink
+
+import (
+	"io/ioutil"
+	"sync"
+
+	"github.com/01org/ciao/ciao-controller/types"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Supported sink types.
+const (
+	Webhook = "webhook"
+	Syslog  = "syslog"
+	File    = "file"
+)
+
+// queueLen is the number of events buffered for a sink before new events
+// are dropped for it.
+const queueLen = 1024
+
+// Sink delivers events to an external system.
+type Sink interface {
+	// Send delivers a single event, retrying as the sink sees fit.
+	Send(e types.StreamEvent) error
+
+	// Close releases the resources held by the sink.
+	Close() error
+}
+
+// Filter selects the events a sink receives.  Empty lists match
+// everything.
+type Filter struct {
+	Tenants []string                `yaml:"tenants,omitempty"`
+	Events  []types.StreamEventType `yaml:"events,omitempty"`
+}
+
+// Match tells if an event passes the filter.
+func (f Filter) Match(e types.StreamEvent) bool {
+	if len(f.Tenants) > 0 && !containsString(f.Tenants, e.TenantID) {
+		return false
+	}
+
+	if len(f.Events) == 0 {
+		return true
+	}
+
+	for _, t := range f.Events {
+		if t == e.Type {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsString(l []string, s string) bool {
+	for _, v := range l {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SinkConfig describes a single sink.  Only the fields relevant to Type
+// need to be set.
+type SinkConfig struct {
+	Type   string `yaml:"type"`
+	Filter `yaml:",inline"`
+
+	// webhook
+	URL     string `yaml:"url,omitempty"`
+	Secret  string `yaml:"secret,omitempty"`
+	Retries int    `yaml:"retries,omitempty"`
+
+	// syslog
+	Network string `yaml:"network,omitempty"`
+	Address string `yaml:"address,omitempty"`
+	Tag     string `yaml:"tag,omitempty"`
+
+	// file
+	Path string `yaml:"path,omitempty"`
+}
+
+// Config lists the sinks events are forwarded to.
+type Config struct {
+	Sinks []SinkConfig `yaml:"sinks"`
+}
+
+// LoadConfig reads a sink configuration from a YAML file.
+func LoadConfig(path string) (Config, error) {
+	var config Config
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return config, errors.Wrapf(err, "unable to read %s", path)
+	}
+
+	err = yaml.Unmarshal(data, &config)
+	if err != nil {
+		return config, errors.Wrapf(err, "unable to parse %s", path)
+	}
+
+	return config, nil
+}
+
+// New creates the sink described by config.
+func New(config SinkConfig) (Sink, error) {
+	switch config.Type {
+	case Webhook:
+		return newWebhookSink(config)
+	case Syslog:
+		return newSyslogSink(config)
+	case File:
+		return newFileSink(config)
+	}
+
+	return nil, errors.Errorf("unknown event sink type %q", config.Type)
+}
+
+type filteredSink struct {
+	Sink
+	Filter
+	name   string
+	events chan types.StreamEvent
+}
+
+func (s *filteredSink) run(wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	for e := range s.events {
+		if err := s.Send(e); err != nil {
+			glog.Warningf("Unable to send %s event to %s sink: %v", e.Type, s.name, err)
+		}
+	}
+
+	if err := s.Close(); err != nil {
+		glog.Warningf("Unable to close %s sink: %v", s.name, err)
+	}
+}
+
+// Dispatcher fans events out to a set of sinks.  Each sink has its own
+// queue, so a slow or unreachable sink does not hold the others back.
+type Dispatcher struct {
+	sinks []*filteredSink
+	wg    sync.WaitGroup
+}
+
+// NewDispatcher creates the sinks listed in config.  No sink is started
+// unless all of them could be created.
+func NewDispatcher(config Config) (*Dispatcher, error) {
+	d := &Dispatcher{}
+
+	sinks := make([]Sink, 0, len(config.Sinks))
+	for _, c := range config.Sinks {
+		s, err := New(c)
+		if err != nil {
+			for _, s := range sinks {
+				_ = s.Close()
+			}
+			return nil, err
+		}
+
+		sinks = append(sinks, s)
+	}
+
+	for i, c := range config.Sinks {
+		d.addSink(c.Type, sinks[i], c.Filter)
+	}
+
+	return d, nil
+}
+
+func (d *Dispatcher) addSink(name string, s Sink, f Filter) {
+	fs := &filteredSink{
+		Sink:   s,
+		Filter: f,
+		name:   name,
+		events: make(chan types.StreamEvent, queueLen),
+	}
+
+	d.sinks = append(d.sinks, fs)
+	d.wg.Add(1)
+	go fs.run(&d.wg)
+}
+
+// Dispatch queues an event for the sinks whose filter it matches.
+func (d *Dispatcher) Dispatch(e types.StreamEvent) {
+	for _, s := range d.sinks {
+		if !s.Match(e) {
+			continue
+		}
+
+		select {
+		case s.events <- e:
+		default:
+			glog.Warningf("%s sink queue is full, dropping %s event", s.name, e.Type)
+		}
+	}
+}
+
+// Run dispatches the events received on events until the channel is
+// closed, then flushes and closes all the sinks.
+func (d *Dispatcher) Run(events <-chan types.StreamEvent) {
+	for e := range events {
+		d.Dispatch(e)
+	}
+
+	d.Close()
+}
+
+// Close waits for the queued events to be sent and closes the sinks.
+func (d *Dispatcher) Close() {
+	for _, s := range d.sinks {
+		close(s.events)
+	}
+
+	d.wg.Wait()
+}
@@ -0,0 +1,236 @@
+/*
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package eventsink
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/01org/ciao/ciao-controller/types"
+)
+
+func TestFilter(t *testing.T) {
+	f := Filter{
+		Tenants: []string{"tenant-a"},
+		Events:  []types.StreamEventType{types.InstanceStartFailureEvent},
+	}
+
+	tests := []struct {
+		event types.StreamEvent
+		match bool
+	}{
+		{types.StreamEvent{Type: types.InstanceStartFailureEvent, TenantID: "tenant-a"}, true},
+		{types.StreamEvent{Type: types.InstanceStartFailureEvent, TenantID: "tenant-b"}, false},
+		{types.StreamEvent{Type: types.InstanceStateEvent, TenantID: "tenant-a"}, false},
+	}
+
+	for _, test := range tests {
+		if f.Match(test.event) != test.match {
+			t.Errorf("expected match %v for %+v", test.match, test.event)
+		}
+	}
+
+	if !(Filter{}).Match(types.StreamEvent{Type: types.NodeDisconnectedEvent}) {
+		t.Error("empty filter does not match")
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "eventsink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "sinks.yaml")
+	data := `sinks:
+- type: webhook
+  url: https://alerts.example.com/ciao
+  secret: s3cr3t
+  events: [instance_start_failure, node_disconnected]
+- type: file
+  path: /var/lib/ciao/logs/controller/events.json
+  tenants: [tenant-a]
+`
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(config.Sinks) != 2 {
+		t.Fatalf("expected 2 sinks, got %d", len(config.Sinks))
+	}
+
+	w := config.Sinks[0]
+	if w.Type != Webhook || w.Secret != "s3cr3t" || len(w.Events) != 2 || w.Events[1] != types.NodeDisconnectedEvent {
+		t.Fatalf("unexpected webhook config %+v", w)
+	}
+
+	f := config.Sinks[1]
+	if f.Type != File || len(f.Tenants) != 1 || f.Tenants[0] != "tenant-a" {
+		t.Fatalf("unexpected file config %+v", f)
+	}
+}
+
+func TestWebhookRetry(t *testing.T) {
+	attempts := 0
+	var received types.StreamEvent
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Header.Get(SignatureHeader) != Signature([]byte("secret"), body) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		_ = json.Unmarshal(body, &received)
+	}))
+	defer server.Close()
+
+	s, err := newWebhookSink(SinkConfig{Type: Webhook, URL: server.URL, Secret: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.delay = time.Millisecond
+
+	e := types.StreamEvent{Type: types.NodeDisconnectedEvent, NodeID: "node-a"}
+	if err := s.Send(e); err != nil {
+		t.Fatal(err)
+	}
+
+	if attempts != 3 || received.NodeID != "node-a" {
+		t.Fatalf("unexpected delivery after %d attempts: %+v", attempts, received)
+	}
+}
+
+func TestWebhookNoRetry(t *testing.T) {
+	attempts := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	s, err := newWebhookSink(SinkConfig{Type: Webhook, URL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.delay = time.Millisecond
+
+	if err := s.Send(types.StreamEvent{Type: types.NodeConnectedEvent}); err == nil {
+		t.Fatal("expected webhook failure")
+	}
+
+	if attempts != 1 {
+		t.Fatalf("expected a single attempt, got %d", attempts)
+	}
+}
+
+func TestDispatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "eventsink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "events.json")
+	config := Config{
+		Sinks: []SinkConfig{
+			{
+				Type:   File,
+				Path:   path,
+				Filter: Filter{Events: []types.StreamEventType{types.InstanceStartFailureEvent}},
+			},
+		},
+	}
+
+	d, err := NewDispatcher(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := make(chan types.StreamEvent, 3)
+	events <- types.StreamEvent{Type: types.InstanceStartFailureEvent, InstanceID: "instance-a"}
+	events <- types.StreamEvent{Type: types.InstanceStateEvent, InstanceID: "instance-b"}
+	events <- types.StreamEvent{Type: types.InstanceStartFailureEvent, InstanceID: "instance-c"}
+	close(events)
+
+	d.Run(events)
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var ids []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e types.StreamEvent
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, e.InstanceID)
+	}
+
+	if len(ids) != 2 || ids[0] != "instance-a" || ids[1] != "instance-c" {
+		t.Fatalf("unexpected events written %v", ids)
+	}
+}
+
+func TestUnknownSink(t *testing.T) {
+	if _, err := New(SinkConfig{Type: "carrier-pigeon"}); err == nil {
+		t.Fatal("expected unknown sink type error")
+	}
+}
+
+func TestDispatcherUnknownSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "eventsink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := Config{
+		Sinks: []SinkConfig{
+			{Type: File, Path: filepath.Join(dir, "events.json")},
+			{Type: "carrier-pigeon"},
+		},
+	}
+
+	if _, err := NewDispatcher(config); err == nil {
+		t.Fatal("expected unknown sink type error")
+	}
+}
@@ -0,0 +1,55 @@
+/*
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package eventsink
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/01org/ciao/ciao-controller/types"
+	"github.com/pkg/errors"
+)
+
+// fileSink appends events to a file, one JSON document per line.
+type fileSink struct {
+	file    *os.File
+	encoder *json.Encoder
+}
+
+func newFileSink(config SinkConfig) (*fileSink, error) {
+	if config.Path == "" {
+		return nil, errors.New("file sink requires a path")
+	}
+
+	f, err := os.OpenFile(config.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to open %s", config.Path)
+	}
+
+	return &fileSink{
+		file:    f,
+		encoder: json.NewEncoder(f),
+	}, nil
+}
+
+func (s *fileSink) Send(e types.StreamEvent) error {
+	return errors.Wrapf(s.encoder.Encode(e), "unable to write to %s", s.file.Name())
+}
+
+func (s *fileSink) Close() error {
+	return s.file.Close()
+}
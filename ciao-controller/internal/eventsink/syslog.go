@@ -0,0 +1,85 @@
+/*
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package eventsink
+
+import (
+	"encoding/json"
+	"log/syslog"
+
+	"github.com/01org/ciao/ciao-controller/types"
+	"github.com/pkg/errors"
+)
+
+const defaultSyslogTag = "ciao-controller"
+
+type syslogSink struct {
+	writer *syslog.Writer
+}
+
+// newSyslogSink connects to the local syslog daemon, unless a network
+// and an address are configured.
+func newSyslogSink(config SinkConfig) (*syslogSink, error) {
+	tag := config.Tag
+	if tag == "" {
+		tag = defaultSyslogTag
+	}
+
+	w, err := syslog.Dial(config.Network, config.Address, syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to connect to syslog")
+	}
+
+	return &syslogSink{writer: w}, nil
+}
+
+func isFailure(t types.StreamEventType) bool {
+	switch t {
+	case types.InstanceStartFailureEvent,
+		types.InstanceStopFailureEvent,
+		types.InstanceRestartFailureEvent,
+		types.VolumeAttachFailureEvent,
+		types.VolumeDetachFailureEvent,
+		types.ExternalIPFailureEvent:
+		return true
+	}
+
+	return false
+}
+
+// Send logs failures with the error severity, node loss with the warning
+// one and everything else as information.
+func (s *syslogSink) Send(e types.StreamEvent) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal event")
+	}
+
+	msg := string(b)
+
+	switch {
+	case isFailure(e.Type):
+		return s.writer.Err(msg)
+	case e.Type == types.NodeDisconnectedEvent:
+		return s.writer.Warning(msg)
+	}
+
+	return s.writer.Info(msg)
+}
+
+func (s *syslogSink) Close() error {
+	return s.writer.Close()
+}
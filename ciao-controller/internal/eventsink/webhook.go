@@ -0,0 +1,131 @@
+/*
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package eventsink
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/01org/ciao/ciao-controller/types"
+	"github.com/pkg/errors"
+)
+
+// SignatureHeader carries the HMAC-SHA256 of the body of a webhook
+// request, keyed with the secret of the sink.
+const SignatureHeader = "X-Ciao-Signature"
+
+const (
+	defaultRetries    = 5
+	initialRetryDelay = time.Second
+	maxRetryDelay     = time.Minute
+	webhookTimeout    = 10 * time.Second
+)
+
+type webhookSink struct {
+	url     string
+	secret  []byte
+	retries int
+	delay   time.Duration
+	client  *http.Client
+}
+
+func newWebhookSink(config SinkConfig) (*webhookSink, error) {
+	if config.URL == "" {
+		return nil, errors.New("webhook sink requires a url")
+	}
+
+	retries := config.Retries
+	if retries == 0 {
+		retries = defaultRetries
+	}
+
+	return &webhookSink{
+		url:     config.URL,
+		secret:  []byte(config.Secret),
+		retries: retries,
+		delay:   initialRetryDelay,
+		client:  &http.Client{Timeout: webhookTimeout},
+	}, nil
+}
+
+// Signature computes the value of the SignatureHeader of a webhook request
+// with the given body.
+func Signature(secret []byte, body []byte) string {
+	h := hmac.New(sha256.New, secret)
+	_, _ = h.Write(body)
+	return "sha256=" + hex.EncodeToString(h.Sum(nil))
+}
+
+func (s *webhookSink) post(body []byte) (retry bool, err error) {
+	req, err := http.NewRequest("POST", s.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if len(s.secret) > 0 {
+		req.Header.Set(SignatureHeader, Signature(s.secret, body))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	_ = resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= 500:
+		return true, errors.Errorf("webhook returned %s", resp.Status)
+	}
+
+	return false, errors.Errorf("webhook returned %s", resp.Status)
+}
+
+// Send posts the event, retrying with an exponential backoff while the
+// webhook cannot be reached or reports a transient failure.
+func (s *webhookSink) Send(e types.StreamEvent) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal event")
+	}
+
+	delay := s.delay
+	for attempt := 0; ; attempt++ {
+		retry, err := s.post(body)
+		if err == nil || !retry || attempt >= s.retries {
+			return err
+		}
+
+		time.Sleep(delay)
+
+		delay *= 2
+		if delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+}
+
+func (s *webhookSink) Close() error {
+	return nil
+}
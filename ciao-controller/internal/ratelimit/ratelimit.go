@@ -0,0 +1,320 @@
+/*
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+// Package ratelimit limits the rate of the API calls of each tenant with
+// token buckets, one per tenant and operation class.
+package ratelimit
+
+import (
+	"io/ioutil"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/01org/ciao/ciao-controller/types"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Operation classes.  Start is not rate limited, it counts the server
+// creations refused because the tenant has too many instances starting.
+const (
+	Read   = "read"
+	Create = "create"
+	Update = "update"
+	Delete = "delete"
+	Start  = "start"
+)
+
+// ClassOf returns the operation class of an HTTP method.
+func ClassOf(method string) string {
+	switch method {
+	case "POST":
+		return Create
+	case "PUT", "PATCH":
+		return Update
+	case "DELETE":
+		return Delete
+	}
+
+	return Read
+}
+
+// Limit is a token bucket, refilled with Rate tokens per second up to
+// Burst tokens.  Each call takes a token.
+type Limit struct {
+	Rate  float64 `yaml:"rate"`
+	Burst int     `yaml:"burst"`
+}
+
+// Limits are the limits of a tenant.
+type Limits struct {
+	// Classes maps the operation classes to their limit, the classes
+	// without a limit are not limited.
+	Classes map[string]Limit `yaml:"classes"`
+
+	// MaxStarting caps the instances of a tenant starting at once, 0
+	// does not cap them.
+	MaxStarting int `yaml:"max_starting"`
+}
+
+// Config holds the limits of all the tenants, and the limits of some
+// tenants that override them.
+type Config struct {
+	Limits  `yaml:",inline"`
+	Tenants map[string]Limits `yaml:"tenants"`
+}
+
+// LoadConfig reads the limits from a YAML file.
+func LoadConfig(path string) (Config, error) {
+	var config Config
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return config, errors.Wrapf(err, "unable to read %s", path)
+	}
+
+	err = yaml.Unmarshal(data, &config)
+	if err != nil {
+		return config, errors.Wrapf(err, "unable to parse %s", path)
+	}
+
+	return config, nil
+}
+
+func (l Limits) validate() error {
+	for class, limit := range l.Classes {
+		switch class {
+		case Read, Create, Update, Delete:
+		default:
+			return errors.Errorf("unknown operation class %q", class)
+		}
+
+		if limit.Rate <= 0 || limit.Burst < 0 {
+			return errors.Errorf("invalid %s limit, rate must be positive and burst not negative", class)
+		}
+	}
+
+	if l.MaxStarting < 0 {
+		return errors.New("max_starting must not be negative")
+	}
+
+	return nil
+}
+
+type key struct {
+	tenant string
+	class  string
+}
+
+type bucket struct {
+	tokens  float64
+	last    time.Time
+	allowed uint64
+	limited uint64
+}
+
+// Limiter enforces the limits of a Config.
+type Limiter struct {
+	sync.Mutex
+	config   Config
+	buckets  map[key]*bucket
+	reserved map[string]int
+}
+
+// New creates a Limiter enforcing the limits of config.
+func New(config Config) (*Limiter, error) {
+	err := config.Limits.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	for tenant, limits := range config.Tenants {
+		err = limits.validate()
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid limits of tenant %s", tenant)
+		}
+	}
+
+	return &Limiter{
+		config:   config,
+		buckets:  make(map[key]*bucket),
+		reserved: make(map[string]int),
+	}, nil
+}
+
+// limit returns the limit of a tenant in a class, and whether there is one.
+func (l *Limiter) limit(tenant string, class string) (Limit, bool) {
+	limit, ok := l.config.Tenants[tenant].Classes[class]
+	if !ok {
+		limit, ok = l.config.Classes[class]
+	}
+
+	if limit.Burst == 0 {
+		limit.Burst = int(math.Ceil(limit.Rate))
+	}
+
+	return limit, ok
+}
+
+func (l *Limiter) bucket(tenant string, class string) *bucket {
+	k := key{tenant, class}
+
+	b, ok := l.buckets[k]
+	if !ok {
+		b = &bucket{tokens: -1}
+		l.buckets[k] = b
+	}
+
+	return b
+}
+
+// Allow takes a token from the bucket of the tenant in the class.  When the
+// bucket is empty the call is refused, and Allow returns how long until the
+// bucket has a token again.
+func (l *Limiter) Allow(tenant string, class string, now time.Time) (bool, time.Duration) {
+	l.Lock()
+	defer l.Unlock()
+
+	b := l.bucket(tenant, class)
+
+	limit, ok := l.limit(tenant, class)
+	if !ok {
+		b.allowed++
+		return true, 0
+	}
+
+	burst := float64(limit.Burst)
+	if b.tokens < 0 {
+		b.tokens = burst
+	} else {
+		b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*limit.Rate)
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		b.limited++
+		wait := (1 - b.tokens) / limit.Rate
+		return false, time.Duration(wait * float64(time.Second))
+	}
+
+	b.tokens--
+	b.allowed++
+
+	return true, 0
+}
+
+// MaxStarting returns how many instances of the tenant may start at once,
+// 0 if there is no cap.
+func (l *Limiter) MaxStarting(tenant string) int {
+	if max := l.config.Tenants[tenant].MaxStarting; max > 0 {
+		return max
+	}
+
+	return l.config.MaxStarting
+}
+
+// ReserveStarts reserves count instance starts of a tenant, unless they
+// would put the tenant over its cap.  starting returns the instances of
+// the tenant starting already, it is called with the limiter locked so
+// that concurrent reservations see each other.  Reserved starts must be
+// released once the instances are recorded as starting, or failed to be.
+func (l *Limiter) ReserveStarts(tenant string, count int, starting func() int) bool {
+	max := l.MaxStarting(tenant)
+	if max == 0 {
+		return true
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	if starting()+l.reserved[tenant]+count > max {
+		return false
+	}
+
+	l.reserved[tenant] += count
+
+	return true
+}
+
+// ReleaseStarts releases count instance starts reserved by a tenant.
+func (l *Limiter) ReleaseStarts(tenant string, count int) {
+	if l.MaxStarting(tenant) == 0 {
+		return
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	l.reserved[tenant] -= count
+	if l.reserved[tenant] <= 0 {
+		delete(l.reserved, tenant)
+	}
+}
+
+// Count counts a call of a tenant in a class which is not rate limited,
+// allowed or refused.
+func (l *Limiter) Count(tenant string, class string, allowed bool) {
+	l.Lock()
+	defer l.Unlock()
+
+	b := l.bucket(tenant, class)
+	if allowed {
+		b.allowed++
+	} else {
+		b.limited++
+	}
+}
+
+type byTenantClass []types.RateLimitCounter
+
+func (c byTenantClass) Len() int      { return len(c) }
+func (c byTenantClass) Swap(i, j int) { c[i], c[j] = c[j], c[i] }
+func (c byTenantClass) Less(i, j int) bool {
+	if c[i].TenantID != c[j].TenantID {
+		return c[i].TenantID < c[j].TenantID
+	}
+	return c[i].Class < c[j].Class
+}
+
+// Counters returns the calls allowed and refused of each tenant in each
+// class, sorted by tenant and class.
+func (l *Limiter) Counters() []types.RateLimitCounter {
+	l.Lock()
+	defer l.Unlock()
+
+	counters := make([]types.RateLimitCounter, 0, len(l.buckets))
+
+	for k, b := range l.buckets {
+		c := types.RateLimitCounter{
+			TenantID: k.tenant,
+			Class:    k.class,
+			Allowed:  b.allowed,
+			Limited:  b.limited,
+		}
+
+		if b.tokens > 0 {
+			c.Tokens = b.tokens
+		}
+
+		counters = append(counters, c)
+	}
+
+	sort.Sort(byTenantClass(counters))
+
+	return counters
+}
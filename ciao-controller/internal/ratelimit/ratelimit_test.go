@@ -0,0 +1,237 @@
+/*
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package ratelimit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testConfig = `
+classes:
+  create:
+    rate: 0.5
+    burst: 2
+  delete:
+    rate: 2
+max_starting: 10
+tenants:
+  big-tenant:
+    classes:
+      create:
+        rate: 10
+        burst: 20
+    max_starting: 50
+`
+
+func loadTestConfig(t *testing.T, data string) (Config, error) {
+	dir, err := ioutil.TempDir("", "ciao-ratelimit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "ratelimits.yaml")
+	err = ioutil.WriteFile(path, []byte(data), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return LoadConfig(path)
+}
+
+func TestAllow(t *testing.T) {
+	config, err := loadTestConfig(t, testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+
+	// the burst is allowed, then the calls follow the rate
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.Allow("tenant", Create, now); !ok {
+			t.Fatalf("call %d of the burst refused", i)
+		}
+	}
+
+	ok, wait := l.Allow("tenant", Create, now)
+	if ok || wait != 2*time.Second {
+		t.Fatalf("call over the burst allowed or wrong wait %v", wait)
+	}
+
+	ok, wait = l.Allow("tenant", Create, now.Add(time.Second))
+	if ok || wait != time.Second {
+		t.Fatalf("call over the rate allowed or wrong wait %v", wait)
+	}
+
+	if ok, _ = l.Allow("tenant", Create, now.Add(2*time.Second)); !ok {
+		t.Fatal("call after refill refused")
+	}
+
+	// other tenants and classes have their own buckets
+	if ok, _ = l.Allow("other-tenant", Create, now); !ok {
+		t.Fatal("call of another tenant refused")
+	}
+
+	for i := 0; i < 20; i++ {
+		if ok, _ = l.Allow("big-tenant", Create, now); !ok {
+			t.Fatalf("call %d of the tenant burst refused", i)
+		}
+	}
+
+	// the burst defaults to the rate
+	for i := 0; i < 2; i++ {
+		if ok, _ = l.Allow("tenant", Delete, now); !ok {
+			t.Fatalf("delete %d refused", i)
+		}
+	}
+
+	if ok, _ = l.Allow("tenant", Delete, now); ok {
+		t.Fatal("delete over the default burst allowed")
+	}
+
+	// classes without a limit are not limited
+	for i := 0; i < 100; i++ {
+		if ok, _ = l.Allow("tenant", Read, now); !ok {
+			t.Fatal("read refused")
+		}
+	}
+
+	if l.MaxStarting("tenant") != 10 || l.MaxStarting("big-tenant") != 50 {
+		t.Fatal("unexpected max starting")
+	}
+
+	l.Count("tenant", Start, false)
+
+	expected := map[string][2]uint64{
+		"tenant/" + Create: {3, 2},
+		"tenant/" + Delete: {2, 1},
+		"tenant/" + Read:   {100, 0},
+		"tenant/" + Start:  {0, 1},
+	}
+
+	for _, c := range l.Counters() {
+		if c.TenantID != "tenant" {
+			continue
+		}
+
+		e, ok := expected[c.TenantID+"/"+c.Class]
+		if !ok || c.Allowed != e[0] || c.Limited != e[1] {
+			t.Errorf("unexpected counter %+v", c)
+		}
+		delete(expected, c.TenantID+"/"+c.Class)
+	}
+
+	if len(expected) != 0 {
+		t.Errorf("missing counters %v", expected)
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	invalid := []string{
+		"classes: {list: {rate: 1}}",
+		"classes: {create: {rate: 0}}",
+		"classes: {create: {rate: 1, burst: -1}}",
+		"max_starting: -1",
+		"tenants: {t: {classes: {create: {rate: -1}}}}",
+	}
+
+	for _, data := range invalid {
+		config, err := loadTestConfig(t, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = New(config)
+		if err == nil {
+			t.Errorf("invalid config %q accepted", data)
+		}
+	}
+
+	_, err := loadTestConfig(t, "classes: [")
+	if err == nil {
+		t.Error("invalid yaml accepted")
+	}
+}
+
+func TestClassOf(t *testing.T) {
+	classes := map[string]string{
+		"GET":    Read,
+		"HEAD":   Read,
+		"POST":   Create,
+		"PUT":    Update,
+		"PATCH":  Update,
+		"DELETE": Delete,
+	}
+
+	for method, class := range classes {
+		if ClassOf(method) != class {
+			t.Errorf("%s is not %s", method, class)
+		}
+	}
+}
+
+func TestReserveStarts(t *testing.T) {
+	config, err := loadTestConfig(t, testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	starting := 4
+	count := func() int { return starting }
+
+	if !l.ReserveStarts("tenant", 6, count) {
+		t.Fatal("starts within the cap refused")
+	}
+
+	if l.ReserveStarts("tenant", 1, count) {
+		t.Fatal("reserved starts not counted")
+	}
+
+	if !l.ReserveStarts("big-tenant", 46, count) {
+		t.Fatal("starts within the tenant cap refused")
+	}
+
+	starting = 10
+	l.ReleaseStarts("tenant", 6)
+	if l.ReserveStarts("tenant", 1, count) {
+		t.Fatal("starting instances not counted")
+	}
+
+	starting = 0
+	if !l.ReserveStarts("tenant", 10, count) {
+		t.Fatal("released starts still counted")
+	}
+
+	if l.ReserveStarts("tenant", 11, count) {
+		t.Fatal("starts over the cap accepted")
+	}
+}
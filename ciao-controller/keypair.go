@@ -0,0 +1,118 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+)
+
+// keypairBits is the size of the RSA keys generated for the keypairs
+// created without a public key.
+const keypairBits = 2048
+
+// keypairName matches the names accepted for keypairs, as in OpenStack.
+var keypairName = regexp.MustCompile(`^[A-Za-z0-9 _.@-]{1,255}$`)
+
+var errInvalidPublicKey = errors.New("Invalid SSH public key")
+
+// sshString appends b to buf in the SSH wire format, prefixed with its
+// length.
+func sshString(buf *bytes.Buffer, b []byte) {
+	_ = binary.Write(buf, binary.BigEndian, uint32(len(b)))
+	buf.Write(b)
+}
+
+// sshMPInt appends n to buf as an SSH multiple precision integer.
+func sshMPInt(buf *bytes.Buffer, n *big.Int) {
+	b := n.Bytes()
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		b = append([]byte{0}, b...)
+	}
+	sshString(buf, b)
+}
+
+// sshFingerprint returns the MD5 fingerprint of the wire format of a
+// public key, as printed by ssh-keygen -l -E md5.
+func sshFingerprint(blob []byte) string {
+	sum := md5.Sum(blob)
+
+	hex := make([]string, len(sum))
+	for i, b := range sum {
+		hex[i] = fmt.Sprintf("%02x", b)
+	}
+
+	return strings.Join(hex, ":")
+}
+
+// parsePublicKey checks an SSH public key in the authorized_keys format,
+// "type base64-blob [comment]", and returns its fingerprint.  The blob
+// must start with the name of the type of the key.
+func parsePublicKey(key string) (string, error) {
+	fields := strings.Fields(key)
+	if len(fields) < 2 {
+		return "", errInvalidPublicKey
+	}
+
+	blob, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil || len(blob) < 4 {
+		return "", errInvalidPublicKey
+	}
+
+	n := binary.BigEndian.Uint32(blob)
+	if uint64(n) > uint64(len(blob)-4) || string(blob[4:4+n]) != fields[0] {
+		return "", errInvalidPublicKey
+	}
+
+	return sshFingerprint(blob), nil
+}
+
+// generateKeypair generates an RSA keypair and returns its public key in
+// the authorized_keys format, its PEM encoded private key and the
+// fingerprint of the public key.
+func generateKeypair(comment string) (string, string, string, error) {
+	key, err := rsa.GenerateKey(rand.Reader, keypairBits)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	var blob bytes.Buffer
+	sshString(&blob, []byte("ssh-rsa"))
+	sshMPInt(&blob, big.NewInt(int64(key.E)))
+	sshMPInt(&blob, key.N)
+
+	public := "ssh-rsa " + base64.StdEncoding.EncodeToString(blob.Bytes())
+	if comment != "" {
+		public += " " + comment
+	}
+
+	private := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	})
+
+	return public, string(private), sshFingerprint(blob.Bytes()), nil
+}
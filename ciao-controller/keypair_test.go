@@ -0,0 +1,82 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+	"testing"
+)
+
+const testPublicKey = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIBscjj9zs4EGiyqvB5iD2NVkYQpBiwKPzRBeFSBPxzeS test"
+
+func TestParsePublicKey(t *testing.T) {
+	fingerprint, err := parsePublicKey(testPublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// as printed by ssh-keygen -l -E md5
+	if fingerprint != "b6:86:dc:7f:4f:f8:f3:62:57:a1:af:15:d4:63:fa:7b" {
+		t.Fatalf("unexpected fingerprint %s", fingerprint)
+	}
+
+	invalid := []string{
+		"",
+		"ssh-ed25519",
+		"ssh-ed25519 not-base64!",
+		"ssh-rsa AAAAC3NzaC1lZDI1NTE5AAAAIBscjj9zs4EGiyqvB5iD2NVkYQpBiwKPzRBeFSBPxzeS",
+		"ssh-ed25519 AAAA",
+		"ssh-ed25519 /////w==",
+	}
+
+	for _, key := range invalid {
+		_, err := parsePublicKey(key)
+		if err == nil {
+			t.Errorf("public key %q accepted", key)
+		}
+	}
+}
+
+func TestGenerateKeypair(t *testing.T) {
+	public, private, fingerprint, err := generateKeypair("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(public, "ssh-rsa ") || !strings.HasSuffix(public, " test") {
+		t.Fatalf("unexpected public key %s", public)
+	}
+
+	f, err := parsePublicKey(public)
+	if err != nil || f != fingerprint {
+		t.Fatalf("expected fingerprint %s, got %s: %v", fingerprint, f, err)
+	}
+
+	block, _ := pem.Decode([]byte(private))
+	if block == nil || block.Type != "RSA PRIVATE KEY" {
+		t.Fatalf("unexpected private key %s", private)
+	}
+
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if key.N.BitLen() != keypairBits {
+		t.Fatalf("expected a %d bits key, got %d", keypairBits, key.N.BitLen())
+	}
+}
@@ -21,6 +21,10 @@
 // @SubApi Tenants API [/v2.1/tenants]
 // @SubApi CNCIs API [/v2.1/cncis]
 // @SubApi Traces API [/v2.1/traces]
+// @SubApi Backup API [/v2.1/backup]
+// @SubApi Usage API [/v2.1/usage]
+// @SubApi Audit API [/v2.1/audit]
+// @SubApi Rate Limits API [/v2.1/ratelimits]
 
 package main
 
@@ -97,7 +101,7 @@ func listTenantResources(c *controller, w http.ResponseWriter, r *http.Request)
 }
 
 // @Title tenantServersAction
-// @Description Runs the indicated action (os-start, os-stop, os-delete) in the servers.
+// @Description Runs the indicated action (os-start, os-stop, os-delete) in the servers, or in the servers having all the given tags.
 // @Accept  json
 // @Success 202 {object} string "This operation does not return a response body, returns the 202 StatusAccepted code."
 // @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
@@ -106,7 +110,8 @@ func listTenantResources(c *controller, w http.ResponseWriter, r *http.Request)
 // @Resource /v2.1/{tenant}/servers
 // tenantServersAction will apply the operation sent in POST (as os-start, os-stop, os-delete)
 // to all servers of a tenant or if ServersID size is greater than zero it will be applied
-// only to the subset provided that also belongs to the tenant
+// only to the subset provided that also belongs to the tenant.  If Tags is not
+// empty it will be applied only to the servers of the tenant having all the tags
 func tenantServersAction(c *controller, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
 	return serversAction(c, w, r)
 }
@@ -303,10 +308,29 @@ func legacyComputeRoutes(ctl *controller, r *mux.Router) *mux.Router {
 	r.Handle("/v2.1/{tenant}/events",
 		legacyAPIHandler{ctl, legacyListTenantEvents}).Methods("GET")
 
+	r.Handle("/v2.1/events/stream",
+		eventStreamHandler{ctl}).Methods("GET")
+	r.Handle("/v2.1/{tenant}/events/stream",
+		eventStreamHandler{ctl}).Methods("GET")
+
 	r.Handle("/v2.1/traces",
 		legacyAPIHandler{ctl, legacyListTraces}).Methods("GET")
 	r.Handle("/v2.1/traces/{label}",
 		legacyAPIHandler{ctl, legacyTraceData}).Methods("GET")
 
+	r.Handle("/v2.1/backup",
+		backupHandler{ctl}).Methods("GET")
+	r.Handle("/v2.1/backup/validate",
+		legacyAPIHandler{ctl, backupValidate}).Methods("POST")
+
+	r.Handle("/v2.1/usage",
+		usageExportHandler{ctl}).Methods("GET")
+
+	r.Handle("/v2.1/audit",
+		auditLogHandler{ctl}).Methods("GET")
+
+	r.Handle("/v2.1/ratelimits",
+		rateLimitsHandler{ctl}).Methods("GET")
+
 	return r
 }
@@ -0,0 +1,469 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/01org/ciao/ciao-controller/types"
+	"github.com/01org/ciao/payloads"
+	"github.com/golang/glog"
+	"github.com/gorilla/mux"
+	"gopkg.in/yaml.v2"
+)
+
+// MetadataPort is the default port of the instance metadata service.
+const MetadataPort = 8775
+
+var metadataPort = flag.Int("metadata_port", MetadataPort, "Port the instance metadata service listens on")
+var metadataSecret = flag.String("metadata_secret", "", "Secret shared with the CNCI metadata proxies. The metadata service is disabled if empty")
+
+var errMetadataForbidden = errors.New("Metadata request not signed by a known CNCI")
+var errMetadataNoInstance = errors.New("No instance matches metadata request")
+
+// metadataInstance identifies the instance a proxied request comes from.
+// The request has to be signed by the CNCI of the tenant owning the
+// instance and both the IP and MAC address have to match it.
+func (c *controller) metadataInstance(r *http.Request) (*types.Instance, error) {
+	cnciID := r.Header.Get(payloads.MetadataCNCIHeader)
+	ip := r.Header.Get(payloads.MetadataIPHeader)
+	mac := strings.ToLower(r.Header.Get(payloads.MetadataMACHeader))
+	sig := r.Header.Get(payloads.MetadataSignatureHeader)
+
+	if cnciID == "" || ip == "" || mac == "" {
+		return nil, errMetadataForbidden
+	}
+
+	expected := payloads.MetadataSignature(*metadataSecret, cnciID, ip, mac)
+	if !hmac.Equal([]byte(sig), []byte(expected)) {
+		return nil, errMetadataForbidden
+	}
+
+	cncis, err := c.ds.GetTenantCNCISummary(cnciID)
+	if err != nil || len(cncis) == 0 {
+		return nil, errMetadataForbidden
+	}
+
+	instances, err := c.ds.GetAllInstancesFromTenant(cncis[0].TenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, i := range instances {
+		if i.IPAddress == ip && strings.ToLower(i.MACAddress) == mac {
+			return i, nil
+		}
+	}
+
+	return nil, errMetadataNoInstance
+}
+
+type metadataHandler struct {
+	ctl     *controller
+	handler func(*controller, *types.Instance, http.ResponseWriter, *http.Request)
+}
+
+func (h metadataHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	i, err := h.ctl.metadataInstance(r)
+	switch err {
+	case nil:
+	case errMetadataForbidden:
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case errMetadataNoInstance:
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.handler(h.ctl, i, w, r)
+}
+
+// metadataUserData returns the cloud-init document of the instance's
+// workload, stripped of its YAML document markers.  The config of the
+// workloads with parameters is the one rendered for the instance, which is
+// stored with its start config.
+func (c *controller) metadataUserData(i *types.Instance) (string, error) {
+	wl, err := c.ds.GetWorkload(i.WorkloadID)
+	if err != nil {
+		return "", err
+	}
+
+	userData := wl.Config
+	if len(wl.Parameters) > 0 {
+		config, err := c.ds.GetInstanceConfig(i.ID)
+		if err != nil {
+			return "", err
+		}
+
+		// the instance was created before its config was stored
+		if config == "" {
+			glog.Warningf("No rendered config stored for instance %s", i.ID)
+			return "", nil
+		}
+
+		_, userData, err = splitInstanceConfig(config)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	var lines []string
+	scanner := bufio.NewScanner(strings.NewReader(userData))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "---" || line == "..." {
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	if len(lines) == 0 {
+		return "", nil
+	}
+
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
+// metadataPublicKeys collects the SSH keys authorized by the instance's
+// cloud-config, either globally or for one of its users.
+func metadataPublicKeys(userData string) []string {
+	var cfg struct {
+		Keys  []string `yaml:"ssh_authorized_keys"`
+		Users []struct {
+			Keys []string `yaml:"ssh-authorized-keys"`
+		} `yaml:"users"`
+	}
+
+	if err := yaml.Unmarshal([]byte(userData), &cfg); err != nil {
+		glog.Warningf("Unable to parse cloud-config: %v", err)
+		return nil
+	}
+
+	keys := cfg.Keys
+	for _, u := range cfg.Users {
+		keys = append(keys, u.Keys...)
+	}
+
+	return keys
+}
+
+// metadataKeys returns the SSH keys of an instance, the keypair it was
+// created with followed by the keys authorized by its cloud-config.
+func metadataKeys(i *types.Instance, userData string) []MetaDataKey {
+	var keys []MetaDataKey
+
+	if i.PublicKey != "" {
+		keys = append(keys, MetaDataKey{Name: i.KeyName, Type: "ssh", Data: i.PublicKey})
+	}
+
+	for n, k := range metadataPublicKeys(userData) {
+		keys = append(keys, MetaDataKey{Name: fmt.Sprintf("key-%d", n), Type: "ssh", Data: k})
+	}
+
+	return keys
+}
+
+// metadataGateway returns the gateway of the instance's tenant subnet,
+// which is the first address of the subnet and is owned by the CNCI.
+func metadataGateway(ip net.IP) net.IP {
+	gw := ip.To4().Mask(net.IPv4Mask(255, 255, 255, 0))
+	gw[3]++
+	return gw
+}
+
+// MetaData is the OpenStack meta_data.json document.
+type MetaData struct {
+	UUID             string            `json:"uuid"`
+	Name             string            `json:"name"`
+	Hostname         string            `json:"hostname"`
+	ProjectID        string            `json:"project_id"`
+	LaunchIndex      int               `json:"launch_index"`
+	AvailabilityZone string            `json:"availability_zone"`
+	PublicKeys       map[string]string `json:"public_keys,omitempty"`
+	Keys             []MetaDataKey     `json:"keys,omitempty"`
+	Meta             map[string]string `json:"meta,omitempty"`
+}
+
+// MetaDataKey describes one of the SSH keys in meta_data.json.
+type MetaDataKey struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Data string `json:"data"`
+}
+
+// NetworkData is the OpenStack network_data.json document.
+type NetworkData struct {
+	Links    []NetworkLink `json:"links"`
+	Networks []Network     `json:"networks"`
+	Services []string      `json:"services"`
+}
+
+// NetworkLink describes a guest network interface.
+type NetworkLink struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	MAC  string `json:"ethernet_mac_address"`
+}
+
+// Network describes the configuration of a guest network interface.
+type Network struct {
+	ID        string         `json:"id"`
+	Type      string         `json:"type"`
+	Link      string         `json:"link"`
+	IPAddress string         `json:"ip_address"`
+	Netmask   string         `json:"netmask"`
+	Routes    []NetworkRoute `json:"routes"`
+	NetworkID string         `json:"network_id"`
+}
+
+// NetworkRoute describes a route of a guest network.
+type NetworkRoute struct {
+	Network string `json:"network"`
+	Netmask string `json:"netmask"`
+	Gateway string `json:"gateway"`
+}
+
+func writeMetadataJSON(w http.ResponseWriter, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(b)
+}
+
+func writeMetadataText(w http.ResponseWriter, lines ...string) {
+	w.Header().Set("Content-Type", "text/plain")
+	_, _ = fmt.Fprint(w, strings.Join(lines, "\n"))
+}
+
+func listOpenStackVersions(c *controller, i *types.Instance, w http.ResponseWriter, r *http.Request) {
+	writeMetadataText(w, "latest")
+}
+
+func listOpenStackMetaData(c *controller, i *types.Instance, w http.ResponseWriter, r *http.Request) {
+	writeMetadataText(w, "meta_data.json", "network_data.json", "user_data")
+}
+
+func showOpenStackMetaData(c *controller, i *types.Instance, w http.ResponseWriter, r *http.Request) {
+	userData, err := c.metadataUserData(i)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	md := MetaData{
+		UUID:             i.ID,
+		Name:             i.ID,
+		Hostname:         i.ID,
+		ProjectID:        i.TenantID,
+		AvailabilityZone: "nova",
+		Meta:             i.Metadata,
+	}
+
+	if i.Name != "" {
+		md.Name = i.Name
+	}
+
+	md.Keys = metadataKeys(i, userData)
+	if len(md.Keys) > 0 {
+		md.PublicKeys = make(map[string]string)
+	}
+	for _, k := range md.Keys {
+		md.PublicKeys[k.Name] = k.Data
+	}
+
+	writeMetadataJSON(w, md)
+}
+
+func showOpenStackNetworkData(c *controller, i *types.Instance, w http.ResponseWriter, r *http.Request) {
+	ip := net.ParseIP(i.IPAddress)
+	if ip == nil || ip.To4() == nil {
+		http.Error(w, "Instance has no IPv4 address", http.StatusNotFound)
+		return
+	}
+
+	nd := NetworkData{
+		Links: []NetworkLink{
+			{
+				ID:   "tap0",
+				Type: "phy",
+				MAC:  i.MACAddress,
+			},
+		},
+		Networks: []Network{
+			{
+				ID:        "network0",
+				Type:      "ipv4",
+				Link:      "tap0",
+				IPAddress: i.IPAddress,
+				Netmask:   "255.255.255.0",
+				Routes: []NetworkRoute{
+					{
+						Network: "0.0.0.0",
+						Netmask: "0.0.0.0",
+						Gateway: metadataGateway(ip).String(),
+					},
+				},
+				NetworkID: i.TenantID,
+			},
+		},
+		Services: []string{},
+	}
+
+	writeMetadataJSON(w, nd)
+}
+
+func showUserData(c *controller, i *types.Instance, w http.ResponseWriter, r *http.Request) {
+	userData, err := c.metadataUserData(i)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if userData == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	_, _ = fmt.Fprint(w, userData)
+}
+
+var ec2MetaDataKeys = []string{
+	"hostname",
+	"instance-id",
+	"local-hostname",
+	"local-ipv4",
+	"mac",
+	"public-keys/",
+}
+
+func listEC2MetaData(c *controller, i *types.Instance, w http.ResponseWriter, r *http.Request) {
+	writeMetadataText(w, ec2MetaDataKeys...)
+}
+
+func showEC2MetaData(c *controller, i *types.Instance, w http.ResponseWriter, r *http.Request) {
+	switch mux.Vars(r)["key"] {
+	case "hostname", "local-hostname", "instance-id":
+		writeMetadataText(w, i.ID)
+	case "local-ipv4":
+		writeMetadataText(w, i.IPAddress)
+	case "mac":
+		writeMetadataText(w, i.MACAddress)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func listEC2PublicKeys(c *controller, i *types.Instance, w http.ResponseWriter, r *http.Request) {
+	userData, err := c.metadataUserData(i)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var lines []string
+	for n, k := range metadataKeys(i, userData) {
+		lines = append(lines, fmt.Sprintf("%d=%s", n, k.Name))
+	}
+
+	writeMetadataText(w, lines...)
+}
+
+func showEC2PublicKey(c *controller, i *types.Instance, w http.ResponseWriter, r *http.Request) {
+	userData, err := c.metadataUserData(i)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	keys := metadataKeys(i, userData)
+	n, err := strconv.Atoi(mux.Vars(r)["index"])
+	if err != nil || n < 0 || n >= len(keys) {
+		http.NotFound(w, r)
+		return
+	}
+
+	writeMetadataText(w, keys[n].Data)
+}
+
+func metadataRoutes(c *controller) *mux.Router {
+	const osVersion = "{version:latest|[0-9]{4}-[0-9]{2}-[0-9]{2}}"
+	const ec2Version = "/" + osVersion
+
+	r := mux.NewRouter()
+
+	routes := []struct {
+		path    string
+		handler func(*controller, *types.Instance, http.ResponseWriter, *http.Request)
+	}{
+		{"/openstack", listOpenStackVersions},
+		{"/openstack/", listOpenStackVersions},
+		{"/openstack/" + osVersion, listOpenStackMetaData},
+		{"/openstack/" + osVersion + "/", listOpenStackMetaData},
+		{"/openstack/" + osVersion + "/meta_data.json", showOpenStackMetaData},
+		{"/openstack/" + osVersion + "/network_data.json", showOpenStackNetworkData},
+		{"/openstack/" + osVersion + "/user_data", showUserData},
+		{ec2Version + "/meta-data", listEC2MetaData},
+		{ec2Version + "/meta-data/", listEC2MetaData},
+		{ec2Version + "/meta-data/public-keys", listEC2PublicKeys},
+		{ec2Version + "/meta-data/public-keys/", listEC2PublicKeys},
+		{ec2Version + "/meta-data/public-keys/{index:[0-9]+}/openssh-key", showEC2PublicKey},
+		{ec2Version + "/meta-data/{key}", showEC2MetaData},
+		{ec2Version + "/user-data", showUserData},
+	}
+
+	for _, route := range routes {
+		r.Handle(route.path, metadataHandler{c, route.handler}).Methods("GET")
+	}
+
+	return r
+}
+
+// startMetadataService serves instance metadata to the CNCI metadata
+// proxies. Requests are only answered if they carry a valid signature,
+// so the service stays disabled until a shared secret is configured.
+func (c *controller) startMetadataService() error {
+	if *metadataSecret == "" {
+		glog.Info("No metadata secret configured, metadata service disabled")
+		return nil
+	}
+
+	service := fmt.Sprintf(":%d", *metadataPort)
+
+	glog.Infof("Starting metadata service on port %d\n", *metadataPort)
+
+	err := http.ListenAndServeTLS(service, httpsCAcert, httpsKey, metadataRoutes(c))
+	if err != nil {
+		glog.Fatal(err)
+	}
+
+	return nil
+}
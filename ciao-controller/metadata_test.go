@@ -0,0 +1,181 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/01org/ciao/ciao-controller/types"
+	"github.com/01org/ciao/payloads"
+	"github.com/01org/ciao/ssntp"
+	"github.com/01org/ciao/ssntp/uuid"
+)
+
+func metadataRequest(t *testing.T, path string, cnciID string, instance *types.Instance, secret string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest("GET", path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set(payloads.MetadataCNCIHeader, cnciID)
+	req.Header.Set(payloads.MetadataIPHeader, instance.IPAddress)
+	req.Header.Set(payloads.MetadataMACHeader, instance.MACAddress)
+	req.Header.Set(payloads.MetadataSignatureHeader,
+		payloads.MetadataSignature(secret, cnciID, instance.IPAddress, instance.MACAddress))
+
+	rr := httptest.NewRecorder()
+	metadataRoutes(ctl).ServeHTTP(rr, req)
+
+	return rr
+}
+
+func TestMetadataService(t *testing.T) {
+	*metadataSecret = "metadata-test-secret"
+	defer func() { *metadataSecret = "" }()
+
+	client, instances := testStartWorkload(t, 1, false, payloads.StartFailureReason(""))
+	defer client.Shutdown()
+
+	instance := instances[0]
+	tenant, err := ctl.ds.GetTenant(instance.TenantID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := metadataRequest(t, "/openstack/latest/meta_data.json", tenant.CNCIID, instance, *metadataSecret)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	var md MetaData
+	if err := json.Unmarshal(rr.Body.Bytes(), &md); err != nil {
+		t.Fatal(err)
+	}
+
+	if md.UUID != instance.ID || md.ProjectID != instance.TenantID {
+		t.Fatalf("unexpected meta data %+v", md)
+	}
+
+	rr = metadataRequest(t, "/latest/meta-data/local-ipv4", tenant.CNCIID, instance, *metadataSecret)
+	if rr.Code != http.StatusOK || rr.Body.String() != instance.IPAddress {
+		t.Fatalf("expected %s, got %d: %s", instance.IPAddress, rr.Code, rr.Body.String())
+	}
+
+	rr = metadataRequest(t, "/2009-04-04/meta-data/instance-id", tenant.CNCIID, instance, *metadataSecret)
+	if rr.Code != http.StatusOK || rr.Body.String() != instance.ID {
+		t.Fatalf("expected %s, got %d: %s", instance.ID, rr.Code, rr.Body.String())
+	}
+
+	rr = metadataRequest(t, "/openstack/latest/network_data.json", tenant.CNCIID, instance, *metadataSecret)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), instance.MACAddress) {
+		t.Fatalf("unexpected network data %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = metadataRequest(t, "/latest/meta-data/instance-id", tenant.CNCIID, instance, "wrong-secret")
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("expected %d, got %d", http.StatusForbidden, rr.Code)
+	}
+
+	other := *instance
+	other.MACAddress = "02:00:00:00:00:00"
+	rr = metadataRequest(t, "/latest/meta-data/instance-id", tenant.CNCIID, &other, *metadataSecret)
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected %d, got %d", http.StatusNotFound, rr.Code)
+	}
+}
+
+func TestMetadataPublicKeys(t *testing.T) {
+	userData := `#cloud-config
+ssh_authorized_keys:
+  - ssh-rsa AAAA1 global
+users:
+  - name: demouser
+    ssh-authorized-keys:
+    - ssh-rsa AAAA2 demo
+`
+	keys := metadataPublicKeys(userData)
+	if len(keys) != 2 || keys[0] != "ssh-rsa AAAA1 global" || keys[1] != "ssh-rsa AAAA2 demo" {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+}
+
+func TestMetadataTemplatedUserData(t *testing.T) {
+	*metadataSecret = "metadata-test-secret"
+	defer func() { *metadataSecret = "" }()
+
+	client, instances := testStartWorkload(t, 1, false, payloads.StartFailureReason(""))
+	defer client.Shutdown()
+
+	tenant, err := ctl.ds.GetTenant(instances[0].TenantID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wl, err := ctl.ds.GetWorkload(instances[0].WorkloadID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	templated := *wl
+	templated.ID = uuid.Generate().String()
+	templated.Config = templatedConfig + `---
+ssh_authorized_keys:
+  - ssh-rsa {{.Parameters.prefix}} key
+...
+`
+	templated.Parameters = templatedWorkload().Parameters
+
+	err = ctl.ds.AddWorkload(templated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ctl.ds.DeleteWorkload(templated.ID)
+
+	clientCmdCh := client.AddCmdChan(ssntp.START)
+	started, err := ctl.startWorkload(types.WorkloadRequest{
+		WorkloadID: templated.ID,
+		TenantID:   tenant.ID,
+		Instances:  2,
+		Parameters: map[string]string{"prefix": "web"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.GetCmdChanResult(clientCmdCh, ssntp.START)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	instance := started[1]
+	rr := metadataRequest(t, "/openstack/latest/user_data", tenant.CNCIID, instance, *metadataSecret)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	userData := rr.Body.String()
+	if strings.Contains(userData, "{{") || !strings.Contains(userData, "hostname: web-1") ||
+		!strings.Contains(userData, "hello from "+instance.ID) {
+		t.Fatalf("user data not rendered:\n%s", userData)
+	}
+
+	rr = metadataRequest(t, "/latest/meta-data/public-keys/0/openssh-key", tenant.CNCIID, instance, *metadataSecret)
+	if rr.Code != http.StatusOK || rr.Body.String() != "ssh-rsa web key" {
+		t.Fatalf("expected rendered key, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
@@ -20,6 +20,8 @@ import (
 	"net/http"
 	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/01org/ciao/ciao-controller/types"
 	"github.com/01org/ciao/ciao-storage"
@@ -46,9 +48,17 @@ func instanceToServer(ctl *controller, instance *types.Instance) (compute.Server
 
 	imageID := workload.ImageID
 
+	metadata := make(map[string]string)
+	for k, v := range instance.Metadata {
+		metadata[k] = v
+	}
+
 	server := compute.ServerDetails{
 		HostID:   instance.NodeID,
 		ID:       instance.ID,
+		Name:     instance.Name,
+		Metadata: metadata,
+		Tags:     append([]string{}, instance.Tags...),
 		TenantID: instance.TenantID,
 		Flavor: compute.FlavorLinks{
 			ID: instance.WorkloadID,
@@ -56,7 +66,7 @@ func instanceToServer(ctl *controller, instance *types.Instance) (compute.Server
 		Image: compute.Image{
 			ID: imageID,
 		},
-		Status: instance.State,
+		Status: string(instance.State),
 		Addresses: compute.Addresses{
 			Private: []compute.PrivateAddresses{
 				{
@@ -66,14 +76,50 @@ func instanceToServer(ctl *controller, instance *types.Instance) (compute.Server
 			},
 		},
 		OsExtendedVolumesVolumesAttached: volumes,
-		SSHIP:   instance.SSHIP,
-		SSHPort: instance.SSHPort,
-		Created: instance.CreateTime,
+		SSHIP:                            instance.SSHIP,
+		SSHPort:                          instance.SSHPort,
+		Created:                          instance.CreateTime,
+		KeyName:                          instance.KeyName,
+		Health:                           string(instance.Health),
+		HealthReason:                     instance.HealthReason,
+	}
+
+	for _, id := range instance.SecurityGroups {
+		g, err := ctl.ds.GetSecurityGroup(id)
+		if err != nil {
+			continue
+		}
+		server.SecurityGroups = append(server.SecurityGroups, compute.SecurityGroup{Name: g.Name})
+	}
+
+	for _, t := range instance.Transitions {
+		server.StatusHistory = append(server.StatusHistory, compute.StatusTransition{
+			From:      string(t.From),
+			To:        string(t.To),
+			Timestamp: t.Timestamp,
+		})
 	}
 
 	return server, nil
 }
 
+// serverActionError maps the errors returned by the instance commands
+// to the compute service errors.
+func serverActionError(action string, err error) error {
+	if err == types.ErrInstanceNotAssigned {
+		return compute.ErrInstanceNotAvailable
+	}
+
+	if e, ok := err.(*types.TransitionError); ok {
+		return &compute.StateError{
+			Action: action,
+			Status: string(e.From),
+		}
+	}
+
+	return err
+}
+
 func (c *controller) validateBlockDeviceMappingSourceType(srcType string) error {
 	validSourceTypes := []string{
 		"blank",
@@ -359,6 +405,13 @@ func (c *controller) CreateServer(tenant string, server compute.CreateServerRequ
 		nInstances = server.Server.MinInstances
 	}
 
+	// only scaling groups start instances in a scaling group
+	for _, t := range server.Server.Tags {
+		if isScalingGroupTag(t) {
+			return server, compute.ErrInvalidTag
+		}
+	}
+
 	blockDeviceMappings := server.Server.BlockDeviceMappings
 	err = c.validateBlockDeviceMappings(blockDeviceMappings, nInstances)
 	if err != nil {
@@ -366,6 +419,47 @@ func (c *controller) CreateServer(tenant string, server compute.CreateServerRequ
 	}
 	volumes := abstractBlockDevices(blockDeviceMappings)
 
+	var priority payloads.Priority
+	if server.SchedulerHints != nil {
+		priority = payloads.Priority(server.SchedulerHints.Priority)
+		switch priority {
+		case "", payloads.HighPriority, payloads.NormalPriority, payloads.PreemptiblePriority:
+		default:
+			return server, compute.ErrSchedulerHint
+		}
+	}
+
+	var restartPolicy *payloads.RestartPolicy
+	if p := server.Server.RestartPolicy; p != nil {
+		restartPolicy = &payloads.RestartPolicy{
+			Condition:   payloads.RestartCondition(p.Condition),
+			MaxRestarts: p.MaxRestarts,
+			Backoff:     p.Backoff,
+		}
+
+		if validateRestartPolicy(restartPolicy) != nil {
+			return server, compute.ErrRestartPolicy
+		}
+	}
+
+	var healthCheck *payloads.HealthCheck
+	if h := server.Server.HealthCheck; h != nil {
+		healthCheck = &payloads.HealthCheck{
+			Protocol:           payloads.HealthCheckProtocol(h.Protocol),
+			Port:               h.Port,
+			Path:               h.Path,
+			Interval:           h.Interval,
+			Timeout:            h.Timeout,
+			HealthyThreshold:   h.HealthyThreshold,
+			UnhealthyThreshold: h.UnhealthyThreshold,
+			Restart:            h.Restart,
+		}
+
+		if validateHealthCheck(healthCheck) != nil {
+			return server, compute.ErrHealthCheck
+		}
+	}
+
 	// openstack doesn't allow us to use our traced start workload
 	// functionality. So we use the name field in our cli to indicate
 	// that we want to trace this workload.
@@ -375,13 +469,50 @@ func (c *controller) CreateServer(tenant string, server compute.CreateServerRequ
 	}
 
 	w := types.WorkloadRequest{
-		WorkloadID: server.Server.Flavor,
-		TenantID:   tenant,
-		Instances:  nInstances,
-		TraceLabel: label,
-		Volumes:    volumes,
+		WorkloadID:    server.Server.Flavor,
+		TenantID:      tenant,
+		Instances:     nInstances,
+		TraceLabel:    label,
+		Volumes:       volumes,
+		Priority:      priority,
+		Name:          server.Server.Name,
+		Tags:          server.Server.Tags,
+		Metadata:      server.Server.Metadata,
+		Parameters:    server.Server.Parameters,
+		RestartPolicy: restartPolicy,
+		HealthCheck:   healthCheck,
+	}
+
+	if k := server.Keypair; k != nil {
+		w.Keypair = &types.Keypair{
+			UserID:      k.UserID,
+			Name:        k.Name,
+			Type:        k.Type,
+			PublicKey:   k.PublicKey,
+			Fingerprint: k.Fingerprint,
+			CreateTime:  k.CreatedAt,
+		}
 	}
+
+	if len(server.Server.SecurityGroups) > 0 {
+		var names []string
+		for _, g := range server.Server.SecurityGroups {
+			names = append(names, g.Name)
+		}
+
+		w.SecurityGroups, err = c.tenantSecurityGroups(tenant, names)
+		if err == types.ErrSecurityGroupNotFound {
+			return server, compute.ErrInvalidSecurityGroup
+		}
+		if err != nil {
+			return server, err
+		}
+	}
+
 	instances, err := c.startWorkload(w)
+	if e, ok := err.(*types.ParameterError); ok {
+		return server, &compute.ParameterError{Reason: e.Reason}
+	}
 	if err != nil {
 		return server, err
 	}
@@ -480,11 +611,8 @@ func (c *controller) DeleteServer(tenant string, server string) error {
 	}
 
 	err = c.deleteInstance(server)
-	if err == types.ErrInstanceNotAssigned {
-		return compute.ErrInstanceNotAvailable
-	}
 
-	return err
+	return serverActionError("delete", err)
 }
 
 func (c *controller) StartServer(tenant string, ID string) error {
@@ -498,11 +626,8 @@ func (c *controller) StartServer(tenant string, ID string) error {
 	}
 
 	err = c.restartInstance(ID)
-	if err == types.ErrInstanceNotAssigned {
-		return compute.ErrInstanceNotAvailable
-	}
 
-	return err
+	return serverActionError("start", err)
 }
 
 func (c *controller) StopServer(tenant string, ID string) error {
@@ -516,23 +641,91 @@ func (c *controller) StopServer(tenant string, ID string) error {
 	}
 
 	err = c.stopInstance(ID)
-	if err == types.ErrInstanceNotAssigned {
-		return compute.ErrInstanceNotAvailable
+
+	return serverActionError("stop", err)
+}
+
+// tenantInstance returns an instance of a tenant.
+func (c *controller) tenantInstance(tenant string, server string) (*types.Instance, error) {
+	i, err := c.ds.GetInstance(server)
+	if err != nil {
+		return nil, compute.ErrServerNotFound
 	}
 
-	return err
+	if i.TenantID != tenant {
+		return nil, compute.ErrServerOwner
+	}
+
+	return i, nil
+}
+
+func (c *controller) UpdateServer(tenant string, server string, req compute.UpdateServerRequest) (compute.Server, error) {
+	_, err := c.tenantInstance(tenant, server)
+	if err != nil {
+		return compute.Server{}, err
+	}
+
+	err = c.ds.RenameInstance(server, req.Server.Name)
+	if err != nil {
+		return compute.Server{}, err
+	}
+
+	return c.ShowServerDetails(tenant, server)
+}
+
+func (c *controller) SetServerMetadata(tenant string, server string, metadata map[string]string) error {
+	_, err := c.tenantInstance(tenant, server)
+	if err != nil {
+		return err
+	}
+
+	return c.ds.SetInstanceMetadata(server, metadata)
+}
+
+// SetServerTags replaces the tags of a server.  The scaling group tags
+// of the server are kept, whether they are listed or not, and no other
+// scaling group tag can be added.
+func (c *controller) SetServerTags(tenant string, server string, tags []string) error {
+	i, err := c.tenantInstance(tenant, server)
+	if err != nil {
+		return err
+	}
+
+	var groupTags []string
+	for _, t := range i.Tags {
+		if isScalingGroupTag(t) {
+			groupTags = append(groupTags, t)
+		}
+	}
+
+	newTags := append([]string{}, groupTags...)
+	for _, t := range tags {
+		if !isScalingGroupTag(t) {
+			newTags = append(newTags, t)
+			continue
+		}
+
+		if !hasTags(i, []string{t}) {
+			return compute.ErrInvalidTag
+		}
+	}
+
+	return c.ds.SetInstanceTags(server, newTags)
 }
 
 func (c *controller) ListFlavors(tenant string) (compute.Flavors, error) {
 	flavors := compute.NewComputeFlavors()
 
-	// we are ignoring tenant for now
 	workloads, err := c.ds.GetWorkloads()
 	if err != nil {
 		return flavors, err
 	}
 
 	for _, workload := range workloads {
+		if !workload.VisibleTo(tenant) {
+			continue
+		}
+
 		flavors.Flavors = append(flavors.Flavors,
 			struct {
 				ID    string         `json:"id"`
@@ -556,7 +749,7 @@ func buildFlavorDetails(workload *types.Workload) (compute.FlavorDetails, error)
 		return details, fmt.Errorf("Workload resources not set")
 	}
 
-	details.OsFlavorAccessIsPublic = true
+	details.OsFlavorAccessIsPublic = workload.Visibility != types.Private
 	details.ID = workload.ID
 	details.Disk = workload.ImageID
 	details.Name = workload.Description
@@ -576,14 +769,16 @@ func buildFlavorDetails(workload *types.Workload) (compute.FlavorDetails, error)
 func (c *controller) ListFlavorsDetail(tenant string) (compute.FlavorsDetails, error) {
 	flavors := compute.NewComputeFlavorsDetails()
 
-	// we ignore tenant for now
-
 	workloads, err := c.ds.GetWorkloads()
 	if err != nil {
 		return flavors, err
 	}
 
 	for _, workload := range workloads {
+		if !workload.VisibleTo(tenant) {
+			continue
+		}
+
 		details, err := buildFlavorDetails(workload)
 		if err != nil {
 			continue
@@ -598,7 +793,7 @@ func (c *controller) ListFlavorsDetail(tenant string) (compute.FlavorsDetails, e
 func (c *controller) ShowFlavorDetails(tenant string, flavorID string) (compute.Flavor, error) {
 	var flavor compute.Flavor
 
-	workload, err := c.ds.GetWorkload(flavorID)
+	workload, err := c.getVisibleWorkload(tenant, flavorID)
 	if err != nil {
 		return flavor, err
 	}
@@ -611,6 +806,590 @@ func (c *controller) ShowFlavorDetails(tenant string, flavorID string) (compute.
 	return flavor, nil
 }
 
+// getTargetQuotas returns the quotas of the target tenant, creating
+// the tenant if it is looking at its own quotas.
+func (c *controller) getTargetQuotas(tenant string, target string) (map[string]types.QuotaDetails, error) {
+	if tenant == target {
+		err := c.confirmTenant(target)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	quotas, err := c.ds.GetQuotas(target)
+	if err == types.ErrTenantNotFound {
+		return nil, compute.ErrTenantNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	m := make(map[string]types.QuotaDetails)
+	for _, q := range quotas {
+		m[q.Name] = q
+	}
+
+	return m, nil
+}
+
+func quotaDetail(q types.QuotaDetails) compute.QuotaDetail {
+	return compute.QuotaDetail{
+		InUse: q.Usage,
+		Limit: q.Value,
+	}
+}
+
+// ShowQuotaSet returns the compute quotas of the target tenant.
+func (c *controller) ShowQuotaSet(tenant string, target string) (compute.QuotaSetDetail, error) {
+	quotas, err := c.getTargetQuotas(tenant, target)
+	if err != nil {
+		return compute.QuotaSetDetail{}, err
+	}
+
+	return compute.QuotaSetDetail{
+		ID:          target,
+		Instances:   quotaDetail(quotas[types.InstancesQuota]),
+		Cores:       quotaDetail(quotas[types.VCPUsQuota]),
+		RAM:         quotaDetail(quotas[types.MemoryQuota]),
+		FloatingIPs: quotaDetail(quotas[types.ExternalIPsQuota]),
+	}, nil
+}
+
+// UpdateQuotaSet changes the compute quotas of the target tenant.
+func (c *controller) UpdateQuotaSet(tenant string, target string, req compute.QuotaSetUpdate) (compute.QuotaSetDetail, error) {
+	var quotas []types.QuotaDetails
+
+	add := func(name string, value *int) {
+		if value != nil {
+			quotas = append(quotas, types.QuotaDetails{Name: name, Value: *value})
+		}
+	}
+
+	add(types.InstancesQuota, req.Instances)
+	add(types.VCPUsQuota, req.Cores)
+	add(types.MemoryQuota, req.RAM)
+	add(types.ExternalIPsQuota, req.FloatingIPs)
+
+	err := c.ds.UpdateQuotas(target, quotas)
+	if err == types.ErrTenantNotFound {
+		return compute.QuotaSetDetail{}, compute.ErrTenantNotFound
+	} else if err != nil {
+		return compute.QuotaSetDetail{}, err
+	}
+
+	return c.ShowQuotaSet(tenant, target)
+}
+
+// DeleteQuotaSet makes the compute quotas of the target tenant unlimited.
+func (c *controller) DeleteQuotaSet(tenant string, target string) error {
+	quotas := []types.QuotaDetails{
+		{Name: types.InstancesQuota, Value: -1},
+		{Name: types.VCPUsQuota, Value: -1},
+		{Name: types.MemoryQuota, Value: -1},
+		{Name: types.ExternalIPsQuota, Value: -1},
+	}
+
+	err := c.ds.UpdateQuotas(target, quotas)
+	if err == types.ErrTenantNotFound {
+		return compute.ErrTenantNotFound
+	}
+
+	return err
+}
+
+// serverUsage starts the usage of the server of a usage record.  The
+// allocation of deleted servers is deduced from their usage.
+func (c *controller) serverUsage(u types.InstanceUsage) *compute.ServerUsage {
+	s := &compute.ServerUsage{
+		InstanceID: u.InstanceID,
+		Name:       u.InstanceID,
+		TenantID:   u.TenantID,
+		Flavor:     u.WorkloadID,
+		StartedAt:  u.Hour,
+		State:      "terminated",
+	}
+
+	wl, err := c.ds.GetWorkload(u.WorkloadID)
+	if err == nil {
+		s.Flavor = wl.Description
+	}
+
+	i, err := c.ds.GetInstance(u.InstanceID)
+	if err == nil {
+		s.VCPUs = i.Usage[string(payloads.VCPUs)]
+		s.MemoryMB = i.Usage[string(payloads.MemMB)]
+		s.LocalGB = i.Usage[string(payloads.DiskMB)] / 1024
+		s.StartedAt = i.CreateTime
+		s.State = string(i.State)
+	} else if u.Hours > 0 {
+		s.VCPUs = int(u.VCPUHours/u.Hours + 0.5)
+		s.MemoryMB = int(u.MemoryGBHours*1024/u.Hours + 0.5)
+		s.LocalGB = int(u.DiskGBHours/u.Hours + 0.5)
+	}
+
+	return s
+}
+
+// tenantUsages sums the hourly usage records of the instances of a
+// tenant, or of all the tenants if tenantID is empty, for the hours
+// starting between start and end.
+func (c *controller) tenantUsages(tenantID string, start time.Time, end time.Time) (map[string]*compute.TenantUsage, error) {
+	records, err := c.ds.GetInstanceUsage(tenantID, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	tenants := make(map[string]*compute.TenantUsage)
+	servers := make(map[string]*compute.ServerUsage)
+	var order []string
+
+	for _, u := range records {
+		t, ok := tenants[u.TenantID]
+		if !ok {
+			t = &compute.TenantUsage{
+				TenantID: u.TenantID,
+				Start:    start,
+				Stop:     end,
+			}
+			tenants[u.TenantID] = t
+		}
+
+		t.TotalHours += u.Hours
+		t.TotalVCPUsUsage += u.VCPUHours
+		t.TotalMemoryMBUsage += u.MemoryGBHours * 1024
+		t.TotalLocalGBUsage += u.DiskGBHours
+
+		s, ok := servers[u.InstanceID]
+		if !ok {
+			s = c.serverUsage(u)
+			servers[u.InstanceID] = s
+			order = append(order, u.InstanceID)
+		}
+
+		s.Hours += u.Hours
+		s.Uptime = int(s.Hours * 3600)
+
+		// records come by hour, the last one of a deleted server
+		// tells when it ended.
+		if s.State == "terminated" {
+			ended := u.Hour.Add(time.Duration(u.Hours * float64(time.Hour)))
+			s.EndedAt = &ended
+		}
+	}
+
+	for _, id := range order {
+		s := servers[id]
+		t := tenants[s.TenantID]
+		t.ServerUsages = append(t.ServerUsages, *s)
+	}
+
+	return tenants, nil
+}
+
+// ListTenantUsage returns the usage of the tenants which had instances
+// running between start and end.
+func (c *controller) ListTenantUsage(start time.Time, end time.Time) ([]compute.TenantUsage, error) {
+	tenants, err := c.tenantUsages("", start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for id := range tenants {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	usages := make([]compute.TenantUsage, 0, len(ids))
+	for _, id := range ids {
+		usages = append(usages, *tenants[id])
+	}
+
+	return usages, nil
+}
+
+// ShowTenantUsage returns the usage of a tenant between start and end.
+func (c *controller) ShowTenantUsage(tenant string, start time.Time, end time.Time) (compute.TenantUsage, error) {
+	tenants, err := c.tenantUsages(tenant, start, end)
+	if err != nil {
+		return compute.TenantUsage{}, err
+	}
+
+	t, ok := tenants[tenant]
+	if !ok {
+		return compute.TenantUsage{TenantID: tenant, Start: start, Stop: end}, nil
+	}
+
+	return *t, nil
+}
+
+func keypairToCompute(k types.Keypair) compute.Keypair {
+	return compute.Keypair{
+		Name:        k.Name,
+		Type:        k.Type,
+		PublicKey:   k.PublicKey,
+		Fingerprint: k.Fingerprint,
+		UserID:      k.UserID,
+		CreatedAt:   k.CreateTime,
+	}
+}
+
+// CreateKeypair imports the public key of the request as a keypair of
+// user, or generates a keypair and returns its private key.
+func (c *controller) CreateKeypair(tenant string, user string, req compute.KeypairRequest) (compute.Keypair, error) {
+	if !keypairName.MatchString(req.Name) {
+		return compute.Keypair{}, compute.ErrInvalidKeypair
+	}
+
+	if req.Type != "" && req.Type != "ssh" {
+		return compute.Keypair{}, compute.ErrInvalidKeypair
+	}
+
+	keypair := types.Keypair{
+		UserID:     user,
+		Name:       req.Name,
+		Type:       "ssh",
+		PublicKey:  strings.TrimSpace(req.PublicKey),
+		CreateTime: time.Now().UTC(),
+	}
+
+	var private string
+	var err error
+	if keypair.PublicKey == "" {
+		keypair.PublicKey, private, keypair.Fingerprint, err = generateKeypair("Generated-by-Ciao")
+		if err != nil {
+			return compute.Keypair{}, err
+		}
+	} else {
+		keypair.Fingerprint, err = parsePublicKey(keypair.PublicKey)
+		if err != nil {
+			return compute.Keypair{}, compute.ErrInvalidKeypair
+		}
+	}
+
+	err = c.ds.AddKeypair(keypair)
+	if err == types.ErrDuplicateKeypair {
+		return compute.Keypair{}, compute.ErrKeypairExists
+	}
+	if err != nil {
+		return compute.Keypair{}, err
+	}
+
+	k := keypairToCompute(keypair)
+	k.PrivateKey = private
+
+	return k, nil
+}
+
+// ListKeypairs returns the keypairs of user.
+func (c *controller) ListKeypairs(tenant string, user string) ([]compute.Keypair, error) {
+	keypairs, err := c.ds.GetKeypairs(user)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp []compute.Keypair
+	for _, k := range keypairs {
+		resp = append(resp, keypairToCompute(k))
+	}
+
+	return resp, nil
+}
+
+// ShowKeypair returns a keypair of user.
+func (c *controller) ShowKeypair(tenant string, user string, name string) (compute.Keypair, error) {
+	k, err := c.ds.GetKeypair(user, name)
+	if err == types.ErrKeypairNotFound {
+		return compute.Keypair{}, compute.ErrKeypairNotFound
+	}
+	if err != nil {
+		return compute.Keypair{}, err
+	}
+
+	return keypairToCompute(k), nil
+}
+
+// DeleteKeypair deletes a keypair of user.  The instances created with
+// the keypair keep its public key.
+func (c *controller) DeleteKeypair(tenant string, user string, name string) error {
+	err := c.ds.DeleteKeypair(user, name)
+	if err == types.ErrKeypairNotFound {
+		return compute.ErrKeypairNotFound
+	}
+
+	return err
+}
+
+// securityGroupError maps the security group errors of the datastore to
+// the compute service errors.
+func securityGroupError(err error) error {
+	switch err {
+	case types.ErrSecurityGroupNotFound:
+		return compute.ErrSecurityGroupNotFound
+	case types.ErrDuplicateSecurityGroup:
+		return compute.ErrSecurityGroupExists
+	case types.ErrSecurityGroupRuleNotFound:
+		return compute.ErrSecurityGroupRuleNotFound
+	case types.ErrSecurityGroupInUse:
+		return compute.ErrSecurityGroupInUse
+	case types.ErrBadRequest:
+		return compute.ErrInvalidSecurityGroup
+	}
+
+	return err
+}
+
+func (c *controller) securityGroupRuleToCompute(g types.SecurityGroup, r types.SecurityGroupRule) compute.SecurityGroupRule {
+	rule := compute.SecurityGroupRule{
+		ID:            r.ID,
+		ParentGroupID: g.ID,
+		Direction:     string(r.Direction),
+		IPProtocol:    r.Protocol,
+		FromPort:      r.PortMin,
+		ToPort:        r.PortMax,
+	}
+
+	rule.IPRange.CIDR = r.RemoteCIDR
+
+	if r.RemoteGroupID != "" {
+		remote, err := c.ds.GetSecurityGroup(r.RemoteGroupID)
+		if err == nil {
+			rule.Group.Name = remote.Name
+			rule.Group.TenantID = remote.TenantID
+		}
+	}
+
+	return rule
+}
+
+func (c *controller) securityGroupToCompute(g types.SecurityGroup) compute.SecurityGroup {
+	group := compute.SecurityGroup{
+		ID:          g.ID,
+		Name:        g.Name,
+		Description: g.Description,
+		TenantID:    g.TenantID,
+		Rules:       []compute.SecurityGroupRule{},
+	}
+
+	for _, r := range g.Rules {
+		group.Rules = append(group.Rules, c.securityGroupRuleToCompute(g, r))
+	}
+
+	return group
+}
+
+// tenantSecurityGroup returns a security group of a tenant.
+func (c *controller) tenantSecurityGroup(tenant string, ID string) (types.SecurityGroup, error) {
+	g, err := c.ds.GetSecurityGroup(ID)
+	if err != nil {
+		return g, securityGroupError(err)
+	}
+
+	if g.TenantID != tenant {
+		return types.SecurityGroup{}, compute.ErrSecurityGroupNotFound
+	}
+
+	return g, nil
+}
+
+func validSecurityGroupName(name string) bool {
+	return name != "" && len(name) <= 255
+}
+
+// CreateSecurityGroup creates a security group of tenant which allows all
+// the egress traffic of its instances.
+func (c *controller) CreateSecurityGroup(tenant string, req compute.SecurityGroupRequest) (compute.SecurityGroup, error) {
+	if !validSecurityGroupName(req.Name) {
+		return compute.SecurityGroup{}, compute.ErrInvalidSecurityGroup
+	}
+
+	g := newSecurityGroup(tenant, req.Name, req.Description)
+
+	err := c.ds.AddSecurityGroup(g)
+	if err != nil {
+		return compute.SecurityGroup{}, securityGroupError(err)
+	}
+
+	return c.securityGroupToCompute(g), nil
+}
+
+// ListSecurityGroups returns the security groups of tenant.
+func (c *controller) ListSecurityGroups(tenant string) ([]compute.SecurityGroup, error) {
+	groups, err := c.ds.GetSecurityGroups(tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp []compute.SecurityGroup
+	for _, g := range groups {
+		resp = append(resp, c.securityGroupToCompute(g))
+	}
+
+	return resp, nil
+}
+
+// ShowSecurityGroup returns a security group of tenant.
+func (c *controller) ShowSecurityGroup(tenant string, group string) (compute.SecurityGroup, error) {
+	g, err := c.tenantSecurityGroup(tenant, group)
+	if err != nil {
+		return compute.SecurityGroup{}, err
+	}
+
+	return c.securityGroupToCompute(g), nil
+}
+
+// UpdateSecurityGroup changes the name and description of a security group
+// of tenant.
+func (c *controller) UpdateSecurityGroup(tenant string, group string, req compute.SecurityGroupRequest) (compute.SecurityGroup, error) {
+	if !validSecurityGroupName(req.Name) {
+		return compute.SecurityGroup{}, compute.ErrInvalidSecurityGroup
+	}
+
+	_, err := c.tenantSecurityGroup(tenant, group)
+	if err != nil {
+		return compute.SecurityGroup{}, err
+	}
+
+	err = c.ds.UpdateSecurityGroup(group, req.Name, req.Description)
+	if err != nil {
+		return compute.SecurityGroup{}, securityGroupError(err)
+	}
+
+	return c.ShowSecurityGroup(tenant, group)
+}
+
+// DeleteSecurityGroup deletes a security group of tenant which no server
+// belongs to and no rule refers to.
+func (c *controller) DeleteSecurityGroup(tenant string, group string) error {
+	g, err := c.tenantSecurityGroup(tenant, group)
+	if err != nil {
+		return err
+	}
+
+	return securityGroupError(c.deleteSecurityGroup(g))
+}
+
+// CreateSecurityGroupRule adds a rule to a security group of tenant.
+func (c *controller) CreateSecurityGroupRule(tenant string, req compute.SecurityGroupRuleRequest) (compute.SecurityGroupRule, error) {
+	g, err := c.tenantSecurityGroup(tenant, req.ParentGroupID)
+	if err != nil {
+		return compute.SecurityGroupRule{}, err
+	}
+
+	rule := types.SecurityGroupRule{
+		Direction:     payloads.SecurityGroupDirection(req.Direction),
+		Protocol:      strings.ToLower(req.IPProtocol),
+		PortMin:       req.FromPort,
+		PortMax:       req.ToPort,
+		RemoteCIDR:    req.CIDR,
+		RemoteGroupID: req.GroupID,
+	}
+
+	rule, err = c.addSecurityGroupRule(g, rule)
+	if err != nil {
+		return compute.SecurityGroupRule{}, securityGroupError(err)
+	}
+
+	return c.securityGroupRuleToCompute(g, rule), nil
+}
+
+// DeleteSecurityGroupRule removes a rule from the security group of tenant
+// it belongs to.
+func (c *controller) DeleteSecurityGroupRule(tenant string, rule string) error {
+	groups, err := c.ds.GetSecurityGroups(tenant)
+	if err != nil {
+		return err
+	}
+
+	for _, g := range groups {
+		for _, r := range g.Rules {
+			if r.ID != rule {
+				continue
+			}
+
+			err = c.ds.DeleteSecurityGroupRule(g.ID, rule)
+			if err != nil {
+				return securityGroupError(err)
+			}
+
+			go c.sendSecurityGroups(tenant)
+
+			return nil
+		}
+	}
+
+	return compute.ErrSecurityGroupRuleNotFound
+}
+
+// ListServerSecurityGroups returns the security groups of a server of
+// tenant.
+func (c *controller) ListServerSecurityGroups(tenant string, server string) ([]compute.SecurityGroup, error) {
+	i, err := c.tenantInstance(tenant, server)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp []compute.SecurityGroup
+	for _, id := range i.SecurityGroups {
+		g, err := c.ds.GetSecurityGroup(id)
+		if err != nil {
+			continue
+		}
+		resp = append(resp, c.securityGroupToCompute(g))
+	}
+
+	return resp, nil
+}
+
+// AddServerSecurityGroup adds a server of tenant to the security group
+// name.
+func (c *controller) AddServerSecurityGroup(tenant string, server string, name string) error {
+	i, err := c.tenantInstance(tenant, server)
+	if err != nil {
+		return err
+	}
+
+	IDs, err := c.tenantSecurityGroups(tenant, []string{name})
+	if err != nil {
+		return securityGroupError(err)
+	}
+
+	for _, id := range i.SecurityGroups {
+		if id == IDs[0] {
+			return compute.ErrInvalidSecurityGroup
+		}
+	}
+
+	return c.setInstanceSecurityGroups(i, append(i.SecurityGroups, IDs[0]))
+}
+
+// RemoveServerSecurityGroup removes a server of tenant from the security
+// group name.  The traffic of the server is no longer filtered once it
+// leaves its last security group.
+func (c *controller) RemoveServerSecurityGroup(tenant string, server string, name string) error {
+	i, err := c.tenantInstance(tenant, server)
+	if err != nil {
+		return err
+	}
+
+	IDs, err := c.tenantSecurityGroups(tenant, []string{name})
+	if err != nil {
+		return securityGroupError(err)
+	}
+
+	var groups []string
+	for _, id := range i.SecurityGroups {
+		if id != IDs[0] {
+			groups = append(groups, id)
+		}
+	}
+
+	if len(groups) == len(i.SecurityGroups) {
+		return compute.ErrInvalidSecurityGroup
+	}
+
+	return c.setInstanceSecurityGroups(i, groups)
+}
+
 // Start will get the Compute API endpoints from the OpenStack compute api,
 // then wrap them in keystone validation. It will then start the https
 // service.
@@ -622,6 +1401,14 @@ func (c *controller) startComputeService() error {
 		return errors.New("Unable to start Compute Service")
 	}
 
+	// remember the compute routes, the audit log tells them apart
+	// from the legacy ones.
+	computeRoutes := make(map[*mux.Route]bool)
+	_ = r.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		computeRoutes[route] = true
+		return nil
+	})
+
 	// we add on some ciao specific routes for legacy purposes
 	// using the openstack compute port.
 	r = legacyComputeRoutes(c, r)
@@ -638,14 +1425,21 @@ func (c *controller) startComputeService() error {
 	}
 
 	err := r.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		service := "legacy"
+		if computeRoutes[route] {
+			service = "compute"
+		}
+
 		h := osIdentity.Handler{
 			Client:        c.id.scV3,
-			Next:          route.GetHandler(),
+			Next:          c.limitRate(route),
 			ValidServices: validServices,
 			ValidAdmins:   validAdmins,
+			Policy:        c.policy,
+			Operations:    routeOperations(route),
 		}
 
-		route.Handler(h)
+		route.Handler(auditHandler{c, service, h})
 
 		return nil
 	})
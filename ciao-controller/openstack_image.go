@@ -203,18 +203,12 @@ type ImageConfig struct {
 	MetaDataStore imageDatastore.MetaDataStore
 }
 
-// startImageService will get the Image API endpoints from the OpenStack image api,
-// then wrap them in keystone validation. It will then start the https
-// service.
-func (c *controller) startImageService() error {
-
-	dbDir := filepath.Dir(*imageDatastoreLocation)
-	dbFile := filepath.Base(*imageDatastoreLocation)
-
+// openImageMetaDs opens the image metadata database at path.
+func openImageMetaDs(path string) (*imageDatastore.MetaDs, error) {
 	metaDs := &imageDatastore.MetaDs{
 		DbProvider: database.NewBoltDBProvider(),
-		DbDir:      dbDir,
-		DbFile:     dbFile,
+		DbDir:      filepath.Dir(path),
+		DbFile:     filepath.Base(path),
 	}
 
 	glog.Info("ciao-image - MetaDatastore Initialization")
@@ -226,15 +220,25 @@ func (c *controller) startImageService() error {
 
 	err := metaDs.DbInit(metaDs.DbDir, metaDs.DbFile)
 	if err != nil {
-		glog.Fatalf("Error on DB Initialization: %v", err)
+		return nil, fmt.Errorf("Error on DB Initialization: %v", err)
 	}
-	defer metaDs.DbClose()
 
 	err = metaDs.DbTablesInit(metaDsTables)
 	if err != nil {
-		glog.Fatalf("Error on DB Tables Initialization: %v ", err)
+		metaDs.DbClose()
+		return nil, fmt.Errorf("Error on DB Tables Initialization: %v ", err)
 	}
 
+	return metaDs, nil
+}
+
+// startImageService will get the Image API endpoints from the OpenStack image api,
+// then wrap them in keystone validation. It will then start the https
+// service.
+func (c *controller) startImageService() error {
+	metaDs := c.imageMetaDs
+	defer metaDs.DbClose()
+
 	rawDs := &imageDatastore.Ceph{
 		ImageTempDir: c.image.MountPoint,
 		BlockDriver: storage.CephDriver{
@@ -263,7 +267,7 @@ func (c *controller) startImageService() error {
 	glog.Infof("MetaDataStore : %T", config.MetaDataStore)
 
 	is := ImageService{ds: &imageDatastore.ImageStore{}}
-	err = is.ds.Init(config.RawDataStore, config.MetaDataStore)
+	err := is.ds.Init(config.RawDataStore, config.MetaDataStore)
 	if err != nil {
 		return err
 	}
@@ -290,12 +294,14 @@ func (c *controller) startImageService() error {
 	err = r.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
 		h := osIdentity.Handler{
 			Client:        c.id.scV3,
-			Next:          route.GetHandler(),
+			Next:          c.limitRate(route),
 			ValidServices: validServices,
 			ValidAdmins:   validAdmins,
+			Policy:        c.policy,
+			Operations:    routeOperations(route),
 		}
 
-		route.Handler(h)
+		route.Handler(auditHandler{c, "image", h})
 
 		return nil
 	})
@@ -37,7 +37,112 @@ func (c *controller) GetAbsoluteLimits(tenant string) (block.AbsoluteLimits, err
 		return block.AbsoluteLimits{}, err
 	}
 
-	return block.AbsoluteLimits{}, nil
+	quotas, err := c.ds.GetQuotas(tenant)
+	if err != nil {
+		return block.AbsoluteLimits{}, err
+	}
+
+	limits := block.AbsoluteLimits{
+		MaxTotalBackups:         -1,
+		MaxTotalVolumeGigabytes: -1,
+		MaxTotalSnapshots:       -1,
+		MaxTotalBackupGigabytes: -1,
+	}
+
+	for _, q := range quotas {
+		if q.Name == types.VolumesQuota {
+			limits.MaxTotalVolumes = q.Value
+			limits.TotalVolumesUsed = q.Usage
+		}
+	}
+
+	devices, err := c.ds.GetBlockDevices(tenant)
+	if err != nil {
+		return block.AbsoluteLimits{}, err
+	}
+
+	for _, d := range devices {
+		if !d.Ephemeral {
+			limits.TotalGigabytesUsed += d.Size
+		}
+	}
+
+	return limits, nil
+}
+
+// ShowVolumeQuotaSet returns the volume quotas of the target tenant.
+func (c *controller) ShowVolumeQuotaSet(tenant string, target string) (block.QuotaSetUsage, error) {
+	if tenant == target {
+		err := c.confirmTenant(target)
+		if err != nil {
+			return block.QuotaSetUsage{}, err
+		}
+	}
+
+	quotas, err := c.ds.GetQuotas(target)
+	if err == types.ErrTenantNotFound {
+		return block.QuotaSetUsage{}, block.ErrTenantNotFound
+	} else if err != nil {
+		return block.QuotaSetUsage{}, err
+	}
+
+	usage := block.QuotaSetUsage{
+		ID:        target,
+		Gigabytes: block.QuotaUsage{Limit: -1},
+		Snapshots: block.QuotaUsage{Limit: -1},
+	}
+
+	for _, q := range quotas {
+		if q.Name == types.VolumesQuota {
+			usage.Volumes = block.QuotaUsage{InUse: q.Usage, Limit: q.Value}
+		}
+	}
+
+	devices, err := c.ds.GetBlockDevices(target)
+	if err != nil {
+		return block.QuotaSetUsage{}, err
+	}
+
+	for _, d := range devices {
+		if !d.Ephemeral {
+			usage.Gigabytes.InUse += d.Size
+		}
+	}
+
+	return usage, nil
+}
+
+// UpdateVolumeQuotaSet changes the volume quotas of the target tenant.
+func (c *controller) UpdateVolumeQuotaSet(tenant string, target string, req block.QuotaSetUpdate) (block.QuotaSetUsage, error) {
+	var quotas []types.QuotaDetails
+
+	if req.Volumes != nil {
+		quotas = append(quotas, types.QuotaDetails{
+			Name:  types.VolumesQuota,
+			Value: *req.Volumes,
+		})
+	}
+
+	err := c.ds.UpdateQuotas(target, quotas)
+	if err == types.ErrTenantNotFound {
+		return block.QuotaSetUsage{}, block.ErrTenantNotFound
+	} else if err != nil {
+		return block.QuotaSetUsage{}, err
+	}
+
+	return c.ShowVolumeQuotaSet(tenant, target)
+}
+
+// DeleteVolumeQuotaSet makes the volume quotas of the target tenant unlimited.
+func (c *controller) DeleteVolumeQuotaSet(tenant string, target string) error {
+	quotas := []types.QuotaDetails{{Name: types.VolumesQuota, Value: -1}}
+
+	err := c.ds.UpdateQuotas(target, quotas)
+	if err == types.ErrTenantNotFound {
+		return block.ErrTenantNotFound
+	}
+
+	return err
 }
 
 // CreateVolume will create a new block device and store it in the datastore.
@@ -49,7 +154,15 @@ func (c *controller) CreateVolume(tenant string, req block.RequestedVolume) (blo
 
 	var bd storage.BlockDevice
 
-	// no limits checking for now.
+	over, err := c.ds.OverQuota(tenant, types.VolumesQuota, 1)
+	if err != nil {
+		return block.Volume{}, err
+	}
+
+	if over {
+		return block.Volume{}, block.ErrQuota
+	}
+
 	if req.ImageRef != nil {
 		// create bootable volume
 		bd, err = c.CreateBlockDeviceFromSnapshot(*req.ImageRef, "ciao-image")
@@ -434,12 +547,14 @@ func (c *controller) startVolumeService() error {
 	err := r.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
 		h := osIdentity.Handler{
 			Client:        c.id.scV3,
-			Next:          route.GetHandler(),
+			Next:          c.limitRate(route),
 			ValidServices: validServices,
 			ValidAdmins:   validAdmins,
+			Policy:        c.policy,
+			Operations:    routeOperations(route),
 		}
 
-		route.Handler(h)
+		route.Handler(auditHandler{c, "volume", h})
 
 		return nil
 	})
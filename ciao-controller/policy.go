@@ -0,0 +1,376 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+
+	"github.com/gorilla/mux"
+)
+
+// policyOperations names the operations of the API routes, by path
+// template and method, as the rules of the policy file refer to them.
+// Route variables are given without their regular expression.
+var policyOperations = map[string]map[string]string{
+	// compute API
+	"/v2.1/{tenant}/servers": {
+		"POST": "compute:servers:create",
+	},
+	"/v2.1/{tenant}/servers/detail": {
+		"GET": "compute:servers:list",
+	},
+	"/v2.1/{tenant}/servers/{server}": {
+		"GET":    "compute:servers:show",
+		"PUT":    "compute:servers:update",
+		"DELETE": "compute:servers:delete",
+	},
+	"/v2.1/{tenant}/servers/{server}/action": {
+		"POST": "compute:servers:action",
+	},
+	"/v2.1/{tenant}/servers/{server}/metadata": {
+		"GET":  "compute:servers:metadata:list",
+		"POST": "compute:servers:metadata:update",
+		"PUT":  "compute:servers:metadata:update",
+	},
+	"/v2.1/{tenant}/servers/{server}/metadata/{key}": {
+		"GET":    "compute:servers:metadata:show",
+		"PUT":    "compute:servers:metadata:update",
+		"DELETE": "compute:servers:metadata:delete",
+	},
+	"/v2.1/{tenant}/servers/{server}/tags": {
+		"GET":    "compute:servers:tags:list",
+		"PUT":    "compute:servers:tags:update",
+		"DELETE": "compute:servers:tags:delete",
+	},
+	"/v2.1/{tenant}/servers/{server}/tags/{tag}": {
+		"GET":    "compute:servers:tags:show",
+		"PUT":    "compute:servers:tags:update",
+		"DELETE": "compute:servers:tags:delete",
+	},
+	"/v2.1/{tenant}/flavors": {
+		"GET": "compute:flavors:list",
+	},
+	"/v2.1/{tenant}/flavors/detail": {
+		"GET": "compute:flavors:list",
+	},
+	"/v2.1/{tenant}/flavors/{flavor}": {
+		"GET": "compute:flavors:show",
+	},
+	"/v2.1/{tenant}/os-quota-sets/{target}": {
+		"GET":    "compute:quotas:show",
+		"PUT":    "compute:quotas:update",
+		"DELETE": "compute:quotas:delete",
+	},
+	"/v2.1/{tenant}/os-quota-sets/{target}/detail": {
+		"GET": "compute:quotas:show",
+	},
+	"/v2.1/{tenant}/os-simple-tenant-usage": {
+		"GET": "compute:usage:list",
+	},
+	"/v2.1/{tenant}/os-simple-tenant-usage/{target}": {
+		"GET": "compute:usage:show",
+	},
+	"/v2.1/{tenant}/os-keypairs": {
+		"GET":  "compute:keypairs:list",
+		"POST": "compute:keypairs:create",
+	},
+	"/v2.1/{tenant}/os-keypairs/{keypair}": {
+		"GET":    "compute:keypairs:show",
+		"DELETE": "compute:keypairs:delete",
+	},
+	"/v2.1/{tenant}/os-security-groups": {
+		"GET":  "compute:security_groups:list",
+		"POST": "compute:security_groups:create",
+	},
+	"/v2.1/{tenant}/os-security-groups/{group}": {
+		"GET":    "compute:security_groups:show",
+		"PUT":    "compute:security_groups:update",
+		"DELETE": "compute:security_groups:delete",
+	},
+	"/v2.1/{tenant}/os-security-group-rules": {
+		"POST": "compute:security_groups:rules:create",
+	},
+	"/v2.1/{tenant}/os-security-group-rules/{rule}": {
+		"DELETE": "compute:security_groups:rules:delete",
+	},
+	"/v2.1/{tenant}/servers/{server}/os-security-groups": {
+		"GET": "compute:servers:security_groups:list",
+	},
+
+	// legacy API
+	"/v2.1/{tenant}/servers/action": {
+		"POST": "compute:servers:bulk_action",
+	},
+	"/v2.1/flavors/{flavor}/servers/detail": {
+		"GET": "compute:servers:list_by_flavor",
+	},
+	"/v2.1/{tenant}/resources": {
+		"GET": "legacy:resources:list",
+	},
+	"/v2.1/{tenant}/quotas": {
+		"GET": "legacy:quotas:list",
+	},
+	"/v2.1/tenants": {
+		"GET": "legacy:tenants:list",
+	},
+	"/v2.1/nodes": {
+		"GET": "legacy:nodes:list",
+	},
+	"/v2.1/nodes/summary": {
+		"GET": "legacy:nodes:list",
+	},
+	"/v2.1/nodes/{node}/servers/detail": {
+		"GET": "legacy:nodes:servers",
+	},
+	"/v2.1/cncis": {
+		"GET": "legacy:cncis:list",
+	},
+	"/v2.1/cncis/{cnci}/detail": {
+		"GET": "legacy:cncis:show",
+	},
+	"/v2.1/events": {
+		"GET":    "legacy:events:list",
+		"DELETE": "legacy:events:clear",
+	},
+	"/v2.1/{tenant}/events": {
+		"GET": "legacy:events:list",
+	},
+	"/v2.1/events/stream": {
+		"GET": "legacy:events:stream",
+	},
+	"/v2.1/{tenant}/events/stream": {
+		"GET": "legacy:events:stream",
+	},
+	"/v2.1/traces": {
+		"GET": "legacy:traces:list",
+	},
+	"/v2.1/traces/{label}": {
+		"GET": "legacy:traces:show",
+	},
+	"/v2.1/backup": {
+		"GET": "legacy:backup:create",
+	},
+	"/v2.1/backup/validate": {
+		"POST": "legacy:backup:validate",
+	},
+	"/v2.1/usage": {
+		"GET": "legacy:usage:export",
+	},
+	"/v2.1/audit": {
+		"GET": "legacy:audit:list",
+	},
+	"/v2.1/ratelimits": {
+		"GET": "legacy:ratelimits:list",
+	},
+
+	// volume API
+	"/": {
+		"GET": "versions:list",
+	},
+	"/v2": {
+		"GET": "versions:show",
+	},
+	"/v2/{tenant}/limits": {
+		"GET": "volume:limits:show",
+	},
+	"/v2/{tenant}/os-quota-sets/{target}": {
+		"GET":    "volume:quotas:show",
+		"PUT":    "volume:quotas:update",
+		"DELETE": "volume:quotas:delete",
+	},
+	"/v2/{tenant}/volumes": {
+		"POST": "volume:create",
+		"GET":  "volume:list",
+	},
+	"/v2/{tenant}/volumes/detail": {
+		"GET": "volume:list",
+	},
+	"/v2/{tenant}/volumes/{volume_id}": {
+		"GET":    "volume:show",
+		"DELETE": "volume:delete",
+	},
+	"/v2/{tenant}/volumes/{volume_id}/action": {
+		"POST": "volume:action",
+	},
+
+	// image API
+	"/v2/images": {
+		"POST": "image:create",
+		"GET":  "image:list",
+	},
+	"/v2/images/{image_id}": {
+		"GET":    "image:show",
+		"DELETE": "image:delete",
+	},
+	"/v2/images/{image_id}/file": {
+		"PUT": "image:upload",
+	},
+
+	// ciao API
+	"/{tenant}": {
+		"GET": "ciao:resources:list",
+	},
+	"/pools": {
+		"GET":  "ciao:pools:list",
+		"POST": "ciao:pools:create",
+	},
+	"/pools/{pool}": {
+		"GET":    "ciao:pools:show",
+		"POST":   "ciao:pools:update",
+		"DELETE": "ciao:pools:delete",
+	},
+	"/pools/{pool}/subnets/{subnet}": {
+		"DELETE": "ciao:pools:update",
+	},
+	"/pools/{pool}/external-ips/{ip_id}": {
+		"DELETE": "ciao:pools:update",
+	},
+	"/external-ips": {
+		"GET":  "ciao:external_ips:list",
+		"POST": "ciao:external_ips:map",
+	},
+	"/{tenant}/external-ips": {
+		"GET":  "ciao:external_ips:list",
+		"POST": "ciao:external_ips:map",
+	},
+	"/external-ips/{mapping_id}": {
+		"DELETE": "ciao:external_ips:unmap",
+	},
+	"/{tenant}/external-ips/{mapping_id}": {
+		"DELETE": "ciao:external_ips:unmap",
+	},
+	"/workloads": {
+		"GET":  "ciao:workloads:list",
+		"POST": "ciao:workloads:create",
+	},
+	"/{tenant}/workloads": {
+		"GET":  "ciao:workloads:list",
+		"POST": "ciao:workloads:create",
+	},
+	"/workloads/{workload_id}": {
+		"GET":    "ciao:workloads:show",
+		"PUT":    "ciao:workloads:update",
+		"DELETE": "ciao:workloads:delete",
+	},
+	"/{tenant}/workloads/{workload_id}": {
+		"GET":    "ciao:workloads:show",
+		"PUT":    "ciao:workloads:update",
+		"DELETE": "ciao:workloads:delete",
+	},
+	"/tenants": {
+		"GET":  "ciao:tenants:list",
+		"POST": "ciao:tenants:create",
+	},
+	"/tenants/{tenant_id}": {
+		"GET":    "ciao:tenants:show",
+		"PUT":    "ciao:tenants:update",
+		"DELETE": "ciao:tenants:delete",
+	},
+	"/{tenant}/tenants/{tenant_id}": {
+		"GET": "ciao:tenants:show",
+	},
+	"/tenants/{tenant_id}/quotas": {
+		"GET": "ciao:quotas:show",
+		"PUT": "ciao:quotas:update",
+	},
+	"/{tenant}/tenants/{tenant_id}/quotas": {
+		"GET": "ciao:quotas:show",
+	},
+	"/schedules": {
+		"GET":  "ciao:schedules:list",
+		"POST": "ciao:schedules:create",
+	},
+	"/{tenant}/schedules": {
+		"GET":  "ciao:schedules:list",
+		"POST": "ciao:schedules:create",
+	},
+	"/schedules/{schedule_id}": {
+		"GET":    "ciao:schedules:show",
+		"DELETE": "ciao:schedules:delete",
+	},
+	"/{tenant}/schedules/{schedule_id}": {
+		"GET":    "ciao:schedules:show",
+		"DELETE": "ciao:schedules:delete",
+	},
+	"/scaling-groups": {
+		"GET":  "ciao:scaling-groups:list",
+		"POST": "ciao:scaling-groups:create",
+	},
+	"/{tenant}/scaling-groups": {
+		"GET":  "ciao:scaling-groups:list",
+		"POST": "ciao:scaling-groups:create",
+	},
+	"/scaling-groups/{group_id}": {
+		"GET":    "ciao:scaling-groups:show",
+		"PUT":    "ciao:scaling-groups:update",
+		"DELETE": "ciao:scaling-groups:delete",
+	},
+	"/{tenant}/scaling-groups/{group_id}": {
+		"GET":    "ciao:scaling-groups:show",
+		"PUT":    "ciao:scaling-groups:update",
+		"DELETE": "ciao:scaling-groups:delete",
+	},
+	"/scaling-groups/{group_id}/activities": {
+		"GET": "ciao:scaling-groups:activities",
+	},
+	"/{tenant}/scaling-groups/{group_id}/activities": {
+		"GET": "ciao:scaling-groups:activities",
+	},
+}
+
+// routeTemplate returns the path template of a route without the regular
+// expressions of its variables.
+func routeTemplate(route *mux.Route) string {
+	tmpl, err := route.GetPathTemplate()
+	if err != nil {
+		return ""
+	}
+
+	var b bytes.Buffer
+	depth := 0
+	name := false
+
+	for _, c := range tmpl {
+		switch {
+		case c == '{':
+			depth++
+			if depth == 1 {
+				name = true
+				b.WriteRune(c)
+			}
+			continue
+		case c == '}':
+			depth--
+			if depth == 0 {
+				b.WriteRune(c)
+			}
+			continue
+		case c == ':' && depth == 1:
+			name = false
+			continue
+		}
+
+		if depth == 0 || name {
+			b.WriteRune(c)
+		}
+	}
+
+	return b.String()
+}
+
+// routeOperations returns the operations of a route by method.
+func routeOperations(route *mux.Route) map[string]string {
+	return policyOperations[routeTemplate(route)]
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/01org/ciao/ciao-controller/api"
+	"github.com/01org/ciao/openstack/block"
+	"github.com/01org/ciao/openstack/compute"
+	osimage "github.com/01org/ciao/openstack/image"
+	"github.com/gorilla/mux"
+)
+
+func TestRouteTemplate(t *testing.T) {
+	r := mux.NewRouter()
+	route := r.Handle("/{tenant:[a-f0-9]{8}}/pools/{pool:[a-f]{2,4}}/ips", nil)
+
+	tmpl := routeTemplate(route)
+	if tmpl != "/{tenant}/pools/{pool}/ips" {
+		t.Errorf("unexpected template %s", tmpl)
+	}
+}
+
+// TestPolicyOperations checks that every API route has its operations
+// named.
+func TestPolicyOperations(t *testing.T) {
+	routers := map[string]*mux.Router{
+		"compute": legacyComputeRoutes(ctl, compute.Routes(compute.APIConfig{ComputeService: ctl})),
+		"volume":  block.Routes(block.APIConfig{VolService: ctl}),
+		"image":   osimage.Routes(osimage.APIConfig{}),
+		"ciao":    api.Routes(api.Config{CiaoService: ctl}),
+	}
+
+	for service, r := range routers {
+		err := r.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+			if len(routeOperations(route)) == 0 {
+				t.Errorf("%s route %s has no operation", service, routeTemplate(route))
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
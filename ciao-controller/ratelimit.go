@@ -0,0 +1,202 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/01org/ciao/ciao-controller/internal/ratelimit"
+	"github.com/01org/ciao/ciao-controller/types"
+	"github.com/01org/ciao/openstack/compute"
+	osIdentity "github.com/01org/ciao/openstack/identity"
+	"github.com/golang/glog"
+	"github.com/gorilla/mux"
+)
+
+var rateLimitsPath = flag.String("rate_limits", "", "path to the yaml file configuring the API rate limits of the tenants")
+
+// startRetryAfter is how long clients refused a server creation, as their
+// tenant has too many instances starting, are asked to wait.
+const startRetryAfter = 5 * time.Second
+
+// serverCreateOperation is the operation whose calls start instances.
+const serverCreateOperation = "compute:servers:create"
+
+// rateLimitHandler refuses the API calls of the tenants over their rate
+// limits.  It is wrapped by the identity handler, which tells it the
+// project of the caller.
+type rateLimitHandler struct {
+	ctl        *controller
+	operations map[string]string
+	next       http.Handler
+}
+
+func tooManyRequests(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+}
+
+// startingInstances returns the number of instances of the tenant not
+// started yet.
+func (c *controller) startingInstances(tenant string) int {
+	instances, err := c.ds.GetAllInstancesFromTenant(tenant)
+	if err != nil {
+		return 0
+	}
+
+	starting := 0
+	for _, i := range instances {
+		if i.State == types.InstancePending {
+			starting++
+		}
+	}
+
+	return starting
+}
+
+// requestedInstances returns the number of instances a server creation
+// asks for, leaving the body of the request for the next handler.
+func requestedInstances(r *http.Request) int {
+	if r.Body == nil {
+		return 1
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	_ = r.Body.Close()
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return 1
+	}
+
+	var server compute.CreateServerRequest
+	if err := json.Unmarshal(body, &server); err != nil {
+		return 1
+	}
+
+	if server.Server.MaxInstances > 0 {
+		return server.Server.MaxInstances
+	} else if server.Server.MinInstances > 0 {
+		return server.Server.MinInstances
+	}
+
+	return 1
+}
+
+func (h rateLimitHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tenant := mux.Vars(r)["tenant"]
+	if caller := osIdentity.CallerFromContext(r.Context()); caller != nil && caller.ProjectID != "" {
+		tenant = caller.ProjectID
+	}
+
+	if tenant == "" {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+
+	limiter := h.ctl.limiter
+
+	ok, wait := limiter.Allow(tenant, ratelimit.ClassOf(r.Method), time.Now())
+	if !ok {
+		glog.V(2).Infof("Rate limiting %s %s of tenant %s", r.Method, r.URL.Path, tenant)
+		tooManyRequests(w, wait)
+		return
+	}
+
+	if h.operations[r.Method] == serverCreateOperation {
+		// The instances are recorded as pending by the time the
+		// creation returns, so the reservation can be released then.
+		n := requestedInstances(r)
+		if !limiter.ReserveStarts(tenant, n, func() int { return h.ctl.startingInstances(tenant) }) {
+			glog.V(2).Infof("Tenant %s cannot start %d more instances", tenant, n)
+			limiter.Count(tenant, ratelimit.Start, false)
+			tooManyRequests(w, startRetryAfter)
+			return
+		}
+		defer limiter.ReleaseStarts(tenant, n)
+
+		limiter.Count(tenant, ratelimit.Start, true)
+	}
+
+	h.next.ServeHTTP(w, r)
+}
+
+// limitRate returns the handler of a route, rate limited if the controller
+// has rate limits.
+func (c *controller) limitRate(route *mux.Route) http.Handler {
+	if c.limiter == nil {
+		return route.GetHandler()
+	}
+
+	return rateLimitHandler{c, routeOperations(route), route.GetHandler()}
+}
+
+// startRateLimits configures the rate limits of the API calls.
+func (c *controller) startRateLimits(path string) error {
+	config, err := ratelimit.LoadConfig(path)
+	if err != nil {
+		return err
+	}
+
+	c.limiter, err = ratelimit.New(config)
+	if err != nil {
+		return err
+	}
+
+	glog.Infof("Rate limiting the API calls as configured in %s", path)
+
+	return nil
+}
+
+// rateLimitsHandler returns the counters of the rate limits.
+type rateLimitsHandler struct {
+	*controller
+}
+
+// @Title rateLimits
+// @Description Returns the API calls of each tenant and operation class allowed and refused by the rate limits.  Requires admin privileges.
+// @Accept  json
+// @Success 200 {object} types.CiaoRateLimits "Returns the rate limit counters."
+// @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
+// @Failure 500 {object} HTTPReturnErrorCode "The response contains the corresponding message and 50x corresponding code."
+// @Router /v2.1/ratelimits [get]
+// @Resource /v2.1/ratelimits
+func (h rateLimitsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !osIdentity.Privileged(r.Context()) {
+		http.Error(w, "Admin privileges required", http.StatusForbidden)
+		return
+	}
+
+	limits := types.CiaoRateLimits{Counters: []types.RateLimitCounter{}}
+	if h.limiter != nil {
+		limits.Counters = h.limiter.Counters()
+	}
+
+	b, err := json.Marshal(limits)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
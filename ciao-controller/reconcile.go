@@ -0,0 +1,247 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/01org/ciao/ciao-controller/types"
+	"github.com/golang/glog"
+)
+
+var reconcileInterval = flag.Duration("reconcile_interval", 5*time.Minute, "How often the instances reported by the nodes are reconciled with the datastore, 0 disables reconciliation")
+var reconcileOrphans = flag.String("reconcile_orphans", reconcileReport, "What to do with instances running on a node but unknown to the controller: report or delete")
+var reconcileMissing = flag.String("reconcile_missing", reconcileReport, "What to do with instances their node stopped reporting: report or lost")
+var reconcileAttachments = flag.String("reconcile_attachments", reconcileReport, "What to do with attachments of unknown instances or volumes: report or delete")
+
+// reconciliation policies
+const (
+	reconcileReport = "report"
+	reconcileDelete = "delete"
+	reconcileLost   = "lost"
+)
+
+// kinds of drift between the datastore and the nodes
+const (
+	driftOrphan     = "orphan"
+	driftMissing    = "missing"
+	driftAttachment = "attachment"
+)
+
+// reconciler compares the instances the nodes report in their statistics
+// with the datastore.  A drift is only acted upon when two consecutive
+// passes see it, which leaves time to the commands and events in flight
+// to land.  Each drift is logged once, until it disappears.
+type reconciler struct {
+	policies map[string]string
+
+	// drifts seen by the last pass, and whether they were handled.
+	drifts map[string]bool
+}
+
+func newReconciler(orphans string, missing string, attachments string) (*reconciler, error) {
+	allowed := map[string][]string{
+		driftOrphan:     {reconcileReport, reconcileDelete},
+		driftMissing:    {reconcileReport, reconcileLost},
+		driftAttachment: {reconcileReport, reconcileDelete},
+	}
+
+	policies := map[string]string{
+		driftOrphan:     orphans,
+		driftMissing:    missing,
+		driftAttachment: attachments,
+	}
+
+	for kind, policy := range policies {
+		valid := false
+		for _, p := range allowed[kind] {
+			valid = valid || p == policy
+		}
+
+		if !valid {
+			return nil, fmt.Errorf("invalid %s reconciliation policy %q, expected one of %v", kind, policy, allowed[kind])
+		}
+	}
+
+	return &reconciler{
+		policies: policies,
+		drifts:   make(map[string]bool),
+	}, nil
+}
+
+// drift records a drift seen by the current pass in seen.  handle is
+// called with the policy of the drift when the previous pass saw it too
+// and it was not handled yet.
+func (r *reconciler) drift(seen map[string]bool, kind string, id string, handle func(policy string)) {
+	key := kind + ":" + id
+
+	handled, suspect := r.drifts[key]
+	if suspect && !handled {
+		handle(r.policies[kind])
+		handled = true
+	}
+
+	seen[key] = handled
+}
+
+// reconcile runs one reconciliation pass.
+func (c *controller) reconcile(r *reconciler) {
+	seen := make(map[string]bool)
+
+	cncis := make(map[string]bool)
+	tenants, err := c.ds.GetAllTenants()
+	if err != nil {
+		glog.Warningf("Unable to reconcile instances: %v", err)
+		return
+	}
+
+	for _, t := range tenants {
+		if t.CNCIID != "" {
+			cncis[t.CNCIID] = true
+		}
+	}
+
+	for _, report := range c.ds.GetNodeReports() {
+		nodeID := report.NodeID
+
+		for instanceID := range report.Instances {
+			if cncis[instanceID] {
+				continue
+			}
+
+			if _, err := c.ds.GetInstance(instanceID); err == nil {
+				continue
+			}
+
+			r.drift(seen, driftOrphan, instanceID, func(policy string) {
+				c.reconcileOrphan(policy, instanceID, nodeID)
+			})
+		}
+
+		instances, err := c.ds.GetAllInstancesByNode(nodeID)
+		if err != nil {
+			glog.Warningf("Unable to reconcile instances of node %s: %v", nodeID, err)
+			continue
+		}
+
+		for _, i := range instances {
+			if _, ok := report.Instances[i.ID]; ok {
+				continue
+			}
+
+			// moved to another node, being deleted or already lost
+			if i.NodeID != nodeID || i.State == types.InstanceDeleting || i.State == types.InstanceLost {
+				continue
+			}
+
+			instance := i
+			r.drift(seen, driftMissing, i.ID, func(policy string) {
+				c.reconcileMissing(policy, instance, nodeID)
+			})
+		}
+	}
+
+	for _, a := range c.ds.GetAllStorageAttachments() {
+		_, instanceErr := c.ds.GetInstance(a.InstanceID)
+		_, volumeErr := c.ds.GetBlockDevice(a.BlockID)
+		if instanceErr == nil && volumeErr == nil {
+			continue
+		}
+
+		attachment := a
+		r.drift(seen, driftAttachment, a.ID, func(policy string) {
+			c.reconcileAttachment(policy, attachment)
+		})
+	}
+
+	r.drifts = seen
+}
+
+func (c *controller) reconcileOrphan(policy string, instanceID string, nodeID string) {
+	if policy == reconcileReport {
+		msg := fmt.Sprintf("Instance %s running on node %s is unknown to the controller", instanceID, nodeID)
+		c.ds.LogEvent("", msg)
+		return
+	}
+
+	msg := fmt.Sprintf("Deleting instance %s running on node %s, unknown to the controller", instanceID, nodeID)
+	c.ds.LogEvent("", msg)
+
+	err := c.client.DeleteInstance(instanceID, nodeID)
+	if err != nil {
+		glog.Warningf("Unable to delete orphan instance %s: %v", instanceID, err)
+	}
+}
+
+func (c *controller) reconcileMissing(policy string, i *types.Instance, nodeID string) {
+	if policy == reconcileReport {
+		msg := fmt.Sprintf("Instance %s is no longer reported by node %s", i.ID, nodeID)
+		c.ds.LogEvent(i.TenantID, msg)
+		return
+	}
+
+	msg := fmt.Sprintf("Instance %s is no longer reported by node %s, marking it lost", i.ID, nodeID)
+	c.ds.LogEvent(i.TenantID, msg)
+
+	err := c.ds.TransitionInstance(i.ID, types.InstanceLost)
+	if err != nil {
+		glog.Warningf("Unable to mark instance %s lost: %v", i.ID, err)
+	}
+}
+
+func (c *controller) reconcileAttachment(policy string, a types.StorageAttachment) {
+	tenantID := ""
+	if bd, err := c.ds.GetBlockDevice(a.BlockID); err == nil {
+		tenantID = bd.TenantID
+	} else if i, err := c.ds.GetInstance(a.InstanceID); err == nil {
+		tenantID = i.TenantID
+	}
+
+	if policy == reconcileReport {
+		msg := fmt.Sprintf("Attachment %s of volume %s to instance %s refers to an unknown instance or volume", a.ID, a.BlockID, a.InstanceID)
+		c.ds.LogEvent(tenantID, msg)
+		return
+	}
+
+	msg := fmt.Sprintf("Deleting attachment %s of volume %s to instance %s, it refers to an unknown instance or volume", a.ID, a.BlockID, a.InstanceID)
+	c.ds.LogEvent(tenantID, msg)
+
+	err := c.ds.DeleteStorageAttachment(a.ID)
+	if err != nil {
+		glog.Warningf("Unable to delete attachment %s: %v", a.ID, err)
+	}
+}
+
+// startReconciler periodically reconciles the instances reported by the
+// nodes with the datastore, following the policies of r.
+func (c *controller) startReconciler(r *reconciler) error {
+	if *reconcileInterval <= 0 {
+		glog.Info("Instance reconciliation disabled")
+		return nil
+	}
+
+	glog.Infof("Reconciling instances every %v", *reconcileInterval)
+
+	ticker := time.NewTicker(*reconcileInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		c.reconcile(r)
+	}
+
+	return nil
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/01org/ciao/ciao-controller/types"
+	"github.com/01org/ciao/payloads"
+	"github.com/golang/glog"
+)
+
+var instanceRescheduleDelay = flag.Duration("instance_reschedule_delay", 30*time.Second, "How long an instance lost with its node has to come back before being started on another node")
+
+// defaultRestartBackoff is the backoff, in seconds, of the restart
+// policies given without one.
+const defaultRestartBackoff = 1
+
+// validateRestartPolicy checks a restart policy given by a user, a nil
+// policy is valid.  Policies restarting instances without a backoff are
+// given defaultRestartBackoff.
+func validateRestartPolicy(policy *payloads.RestartPolicy) error {
+	if policy == nil {
+		return nil
+	}
+
+	switch policy.Condition {
+	case payloads.RestartNever, payloads.RestartOnFailure, payloads.RestartAlways:
+	default:
+		return types.ErrBadRequest
+	}
+
+	if policy.MaxRestarts < 0 || policy.Backoff < 0 {
+		return types.ErrBadRequest
+	}
+
+	if policy.Condition != payloads.RestartNever && policy.Backoff == 0 {
+		policy.Backoff = defaultRestartBackoff
+	}
+
+	return nil
+}
+
+// reschedulable tells if an instance may be started again on another node
+// when its node is lost: its restart policy restarts it and it keeps no
+// state on its node.  Containers, instances booting from a local copy of
+// an image and instances with local volumes would come back empty.
+func reschedulable(start payloads.StartCmd) bool {
+	policy := start.RestartPolicy
+	if policy == nil || (policy.Condition != payloads.RestartOnFailure && policy.Condition != payloads.RestartAlways) {
+		return false
+	}
+
+	if start.VMType == payloads.Docker || start.ImageUUID != "" {
+		return false
+	}
+
+	for _, s := range start.Storage {
+		if s.Local {
+			return false
+		}
+	}
+
+	return true
+}
+
+// rescheduleInstance starts an instance lost with its node again on
+// another node, unless the node comes back before instanceRescheduleDelay.
+// Only the reschedulable instances, whose start config was stored, are
+// rescheduled.
+func (c *controller) rescheduleInstance(instanceID string, tenantID string, nodeID string) {
+	config, err := c.ds.GetInstanceConfig(instanceID)
+	if err != nil {
+		glog.Warningf("Unable to reschedule instance %s: %v", instanceID, err)
+		return
+	}
+
+	if config == "" {
+		return
+	}
+
+	start, _, err := splitInstanceConfig(config)
+	if err != nil {
+		glog.Warningf("Unable to reschedule instance %s: %v", instanceID, err)
+		return
+	}
+
+	if !reschedulable(start.Start) {
+		return
+	}
+
+	time.Sleep(*instanceRescheduleDelay)
+
+	err = c.ds.RescheduleInstance(instanceID, nodeID)
+	if err != nil {
+		glog.Infof("Not rescheduling instance %s: %v", instanceID, err)
+		return
+	}
+
+	msg := fmt.Sprintf("Rescheduling instance %s lost with node %s", instanceID, nodeID)
+	c.ds.LogEvent(tenantID, msg)
+
+	c.ds.PublishEvent(types.StreamEvent{
+		Type:       types.InstanceRescheduledEvent,
+		TenantID:   tenantID,
+		InstanceID: instanceID,
+		NodeID:     nodeID,
+	})
+
+	err = c.client.StartWorkload(config)
+	if err != nil {
+		glog.Warningf("Unable to reschedule instance %s: %v", instanceID, err)
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/01org/ciao/payloads"
+)
+
+func TestValidateRestartPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy *payloads.RestartPolicy
+		valid  bool
+	}{
+		{"none", nil, true},
+		{"never", &payloads.RestartPolicy{Condition: payloads.RestartNever}, true},
+		{"on-failure", &payloads.RestartPolicy{Condition: payloads.RestartOnFailure, MaxRestarts: 3, Backoff: 10}, true},
+		{"always", &payloads.RestartPolicy{Condition: payloads.RestartAlways}, true},
+		{"no condition", &payloads.RestartPolicy{}, false},
+		{"unknown condition", &payloads.RestartPolicy{Condition: "sometimes"}, false},
+		{"negative max restarts", &payloads.RestartPolicy{Condition: payloads.RestartOnFailure, MaxRestarts: -1}, false},
+		{"negative backoff", &payloads.RestartPolicy{Condition: payloads.RestartAlways, Backoff: -1}, false},
+	}
+
+	for _, test := range tests {
+		err := validateRestartPolicy(test.policy)
+		if test.valid && err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		} else if !test.valid && err == nil {
+			t.Errorf("%s: invalid policy accepted", test.name)
+		}
+	}
+}
+
+func TestValidateRestartPolicyBackoff(t *testing.T) {
+	tests := []struct {
+		policy  payloads.RestartPolicy
+		backoff int
+	}{
+		{payloads.RestartPolicy{Condition: payloads.RestartNever}, 0},
+		{payloads.RestartPolicy{Condition: payloads.RestartAlways}, defaultRestartBackoff},
+		{payloads.RestartPolicy{Condition: payloads.RestartOnFailure}, defaultRestartBackoff},
+		{payloads.RestartPolicy{Condition: payloads.RestartOnFailure, Backoff: 10}, 10},
+	}
+
+	for _, test := range tests {
+		policy := test.policy
+
+		err := validateRestartPolicy(&policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if policy.Backoff != test.backoff {
+			t.Errorf("%s: got backoff %d, expected %d", policy.Condition, policy.Backoff, test.backoff)
+		}
+	}
+}
+
+func TestReschedulable(t *testing.T) {
+	always := &payloads.RestartPolicy{Condition: payloads.RestartAlways}
+	never := &payloads.RestartPolicy{Condition: payloads.RestartNever}
+	volume := payloads.StorageResource{ID: "volume", Bootable: true}
+
+	tests := []struct {
+		name  string
+		start payloads.StartCmd
+		ok    bool
+	}{
+		{"volume backed", payloads.StartCmd{VMType: payloads.QEMU, RestartPolicy: always, Storage: []payloads.StorageResource{volume}}, true},
+		{"no policy", payloads.StartCmd{VMType: payloads.QEMU, Storage: []payloads.StorageResource{volume}}, false},
+		{"never", payloads.StartCmd{VMType: payloads.QEMU, RestartPolicy: never}, false},
+		{"container", payloads.StartCmd{VMType: payloads.Docker, RestartPolicy: always}, false},
+		{"local image", payloads.StartCmd{VMType: payloads.QEMU, RestartPolicy: always, ImageUUID: "image"}, false},
+		{"local volume", payloads.StartCmd{VMType: payloads.QEMU, RestartPolicy: always, Storage: []payloads.StorageResource{volume, {Local: true, Size: 10}}}, false},
+	}
+
+	for _, test := range tests {
+		if reschedulable(test.start) != test.ok {
+			t.Errorf("%s: expected reschedulable %v", test.name, test.ok)
+		}
+	}
+}
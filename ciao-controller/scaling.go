@@ -0,0 +1,595 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/01org/ciao/ciao-controller/types"
+	"github.com/01org/ciao/payloads"
+	"github.com/01org/ciao/ssntp/uuid"
+	"github.com/golang/glog"
+)
+
+var scalingInterval = flag.Duration("scaling_interval", 30*time.Second, "How often the scaling groups sample the statistics of their instances and are scaled, 0 disables scaling")
+
+// scalingGroupTagPrefix prefixes the tag marking the instances of a
+// scaling group.  The tags with this prefix are reserved: only the
+// controller sets them, when a group starts an instance, and tenants can
+// neither add nor remove them.
+const scalingGroupTagPrefix = "scaling-group:"
+
+func scalingGroupTag(groupID string) string {
+	return scalingGroupTagPrefix + groupID
+}
+
+func isScalingGroupTag(tag string) bool {
+	return strings.HasPrefix(tag, scalingGroupTagPrefix)
+}
+
+func validateScalingRule(rule *types.ScalingRule) error {
+	if rule == nil {
+		return nil
+	}
+
+	switch rule.Metric {
+	case types.ScalingCPU, types.ScalingMemory:
+	default:
+		return types.ErrBadRequest
+	}
+
+	if rule.Threshold <= 0 || rule.Threshold > 100 || rule.Period <= 0 || rule.Step <= 0 {
+		return types.ErrBadRequest
+	}
+
+	return nil
+}
+
+func validateScalingGroup(g types.ScalingGroup) error {
+	if g.TenantID == "" || g.WorkloadID == "" {
+		return types.ErrBadRequest
+	}
+
+	if g.MinInstances < 0 || g.MaxInstances <= 0 || g.MinInstances > g.MaxInstances ||
+		g.DesiredInstances < g.MinInstances || g.DesiredInstances > g.MaxInstances {
+		return types.ErrBadRequest
+	}
+
+	if g.Cooldown < 0 {
+		return types.ErrBadRequest
+	}
+
+	err := validateScalingRule(g.ScaleOut)
+	if err != nil {
+		return err
+	}
+
+	err = validateScalingRule(g.ScaleIn)
+	if err != nil {
+		return err
+	}
+
+	// a group would flap between scaling out and in otherwise
+	if g.ScaleOut != nil && g.ScaleIn != nil && g.ScaleOut.Metric == g.ScaleIn.Metric &&
+		g.ScaleIn.Threshold >= g.ScaleOut.Threshold {
+		return types.ErrBadRequest
+	}
+
+	return nil
+}
+
+// scalingSample is the average of the metrics of the running instances of
+// a group at some time.
+type scalingSample struct {
+	time    time.Time
+	metrics map[types.ScalingMetric]int
+}
+
+// scaler keeps the recent samples of the metrics of the scaling groups,
+// which the scaling rules average over their period.
+type scaler struct {
+	samples map[string][]scalingSample
+}
+
+func newScaler() *scaler {
+	return &scaler{
+		samples: make(map[string][]scalingSample),
+	}
+}
+
+// record adds a sample of a group and drops the samples older than keep,
+// but the last of them which tells the period is covered.
+func (s *scaler) record(groupID string, sample scalingSample, keep time.Duration) {
+	samples := append(s.samples[groupID], sample)
+
+	cutoff := sample.time.Add(-keep)
+	i := 0
+	for i+1 < len(samples) && !samples[i+1].time.After(cutoff) {
+		i++
+	}
+
+	s.samples[groupID] = samples[i:]
+}
+
+// average returns the average of a metric of a group over the period
+// before now, false if the samples do not cover the period yet.
+func (s *scaler) average(groupID string, metric types.ScalingMetric, period time.Duration, now time.Time) (int, bool) {
+	samples := s.samples[groupID]
+	cutoff := now.Add(-period)
+
+	if len(samples) == 0 || samples[0].time.After(cutoff) {
+		return 0, false
+	}
+
+	sum := 0
+	count := 0
+	for _, sample := range samples {
+		v, ok := sample.metrics[metric]
+		if !ok || !sample.time.After(cutoff) {
+			continue
+		}
+		sum += v
+		count++
+	}
+
+	if count == 0 {
+		return 0, false
+	}
+
+	return sum / count, true
+}
+
+// forget drops the samples of the groups which are gone.
+func (s *scaler) forget(groups []types.ScalingGroup) {
+	known := make(map[string]bool)
+	for _, g := range groups {
+		known[g.ID] = true
+	}
+
+	for ID := range s.samples {
+		if !known[ID] {
+			delete(s.samples, ID)
+		}
+	}
+}
+
+// scalingGroupInstances returns the instances of a group which are not
+// being deleted.
+func (c *controller) scalingGroupInstances(g types.ScalingGroup) ([]*types.Instance, error) {
+	instances, err := c.ds.GetAllInstancesFromTenant(g.TenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	tag := scalingGroupTag(g.ID)
+
+	var members []*types.Instance
+	for _, i := range instances {
+		if i.State == types.InstanceDeleting {
+			continue
+		}
+
+		for _, t := range i.Tags {
+			if t == tag {
+				members = append(members, i)
+				break
+			}
+		}
+	}
+
+	return members, nil
+}
+
+// sampleScalingMetrics averages the last statistics of the running
+// instances.  It also returns the number of running instances.
+func (c *controller) sampleScalingMetrics(instances []*types.Instance) (map[types.ScalingMetric]int, int) {
+	metrics := make(map[types.ScalingMetric]int)
+
+	running := 0
+	cpu := 0
+	mem := 0
+	memInstances := 0
+
+	for _, i := range instances {
+		if i.State != types.InstanceRunning {
+			continue
+		}
+
+		stat, ok := c.ds.GetInstanceLastStat(i.ID)
+		if !ok {
+			continue
+		}
+
+		running++
+		cpu += stat.VCPUUsage
+
+		if requested := i.Usage[string(payloads.MemMB)]; requested > 0 {
+			mem += stat.MemUsage * 100 / requested
+			memInstances++
+		}
+	}
+
+	if running > 0 {
+		metrics[types.ScalingCPU] = cpu / running
+	}
+
+	if memInstances > 0 {
+		metrics[types.ScalingMemory] = mem / memInstances
+	}
+
+	return metrics, running
+}
+
+// scalingDecision applies the rules of a group to its samples, it
+// returns the new desired instances and why, or the current ones and an
+// empty reason.
+func scalingDecision(s *scaler, g types.ScalingGroup, now time.Time) (int, string) {
+	if now.Before(g.LastScale.Add(time.Duration(g.Cooldown) * time.Second)) {
+		return g.DesiredInstances, ""
+	}
+
+	if rule := g.ScaleOut; rule != nil && g.DesiredInstances < g.MaxInstances {
+		avg, ok := s.average(g.ID, rule.Metric, time.Duration(rule.Period)*time.Second, now)
+		if ok && avg > rule.Threshold {
+			desired := g.DesiredInstances + rule.Step
+			if desired > g.MaxInstances {
+				desired = g.MaxInstances
+			}
+			return desired, fmt.Sprintf("%s %d%% above %d%% over %ds", rule.Metric, avg, rule.Threshold, rule.Period)
+		}
+	}
+
+	if rule := g.ScaleIn; rule != nil && g.DesiredInstances > g.MinInstances {
+		avg, ok := s.average(g.ID, rule.Metric, time.Duration(rule.Period)*time.Second, now)
+		if ok && avg < rule.Threshold {
+			desired := g.DesiredInstances - rule.Step
+			if desired < g.MinInstances {
+				desired = g.MinInstances
+			}
+			return desired, fmt.Sprintf("%s %d%% below %d%% over %ds", rule.Metric, avg, rule.Threshold, rule.Period)
+		}
+	}
+
+	return g.DesiredInstances, ""
+}
+
+// scalingVictims orders the instances a group deletes first: those not
+// running, then the most recent.
+type scalingVictims []*types.Instance
+
+func (s scalingVictims) Len() int      { return len(s) }
+func (s scalingVictims) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s scalingVictims) Less(i, j int) bool {
+	ri := s[i].State == types.InstanceRunning
+	rj := s[j].State == types.InstanceRunning
+	if ri != rj {
+		return !ri
+	}
+	return s[i].CreateTime.After(s[j].CreateTime)
+}
+
+// adjustScalingGroup starts or deletes instances of a group until it has
+// its desired instances, and records why in its history.
+func (c *controller) adjustScalingGroup(g types.ScalingGroup, instances []*types.Instance, reason string) {
+	current := len(instances)
+	if current == g.DesiredInstances {
+		return
+	}
+
+	if reason == "" {
+		reason = fmt.Sprintf("%d instances, %d desired", current, g.DesiredInstances)
+	}
+
+	reached := current
+
+	if current < g.DesiredInstances {
+		w := types.WorkloadRequest{
+			WorkloadID: g.WorkloadID,
+			TenantID:   g.TenantID,
+			Instances:  g.DesiredInstances - current,
+			Name:       g.Name,
+			Tags:       []string{scalingGroupTag(g.ID)},
+		}
+
+		started, err := c.startWorkload(w)
+		reached += len(started)
+		if err != nil {
+			glog.Warningf("Scaling group %s unable to start instances: %v", g.ID, err)
+			c.ds.LogEvent(g.TenantID, fmt.Sprintf("Scaling group %s unable to start instances: %v", g.ID, err))
+		}
+	} else {
+		sort.Sort(scalingVictims(instances))
+
+		for _, i := range instances {
+			if reached == g.DesiredInstances {
+				break
+			}
+
+			err := c.deleteInstance(i.ID)
+			if err != nil {
+				glog.Warningf("Scaling group %s unable to delete instance %s: %v", g.ID, i.ID, err)
+				continue
+			}
+			reached--
+		}
+	}
+
+	if reached == current {
+		return
+	}
+
+	a := types.ScalingActivity{
+		GroupID:   g.ID,
+		Timestamp: time.Now().UTC(),
+		From:      current,
+		To:        reached,
+		Reason:    reason,
+	}
+
+	err := c.ds.AddScalingActivity(a)
+	if err != nil {
+		glog.Warningf("Unable to record activity of scaling group %s: %v", g.ID, err)
+	}
+
+	msg := fmt.Sprintf("Scaling group %s scaled from %d to %d instances: %s", g.ID, current, reached, reason)
+	c.ds.LogEvent(g.TenantID, msg)
+}
+
+// scaleGroup samples the metrics of a group, applies its rules and
+// adjusts its instances.
+func (c *controller) scaleGroup(s *scaler, g types.ScalingGroup, now time.Time) {
+	instances, err := c.scalingGroupInstances(g)
+	if err != nil {
+		glog.Warningf("Unable to scale group %s: %v", g.ID, err)
+		return
+	}
+
+	metrics, _ := c.sampleScalingMetrics(instances)
+
+	var keep time.Duration
+	for _, rule := range []*types.ScalingRule{g.ScaleOut, g.ScaleIn} {
+		if rule != nil && time.Duration(rule.Period)*time.Second > keep {
+			keep = time.Duration(rule.Period) * time.Second
+		}
+	}
+	s.record(g.ID, scalingSample{time: now, metrics: metrics}, keep)
+
+	desired, reason := scalingDecision(s, g, now)
+	if desired != g.DesiredInstances {
+		g.DesiredInstances = desired
+		g.LastScale = now
+
+		err = c.ds.UpdateScalingGroup(g)
+		if err != nil {
+			glog.Warningf("Unable to update scaling group %s: %v", g.ID, err)
+			return
+		}
+	}
+
+	c.adjustScalingGroup(g, instances, reason)
+}
+
+// scale runs one scaling pass over all the groups.
+func (c *controller) scale(s *scaler, now time.Time) {
+	c.scalingLock.Lock()
+	defer c.scalingLock.Unlock()
+
+	groups, err := c.ds.GetScalingGroups("")
+	if err != nil {
+		glog.Warningf("Unable to scale groups: %v", err)
+		return
+	}
+
+	s.forget(groups)
+
+	for _, g := range groups {
+		c.scaleGroup(s, g, now)
+	}
+}
+
+// startScaler periodically scales the scaling groups.
+func (c *controller) startScaler() error {
+	if *scalingInterval <= 0 {
+		glog.Info("Scaling groups disabled")
+		return nil
+	}
+
+	glog.Infof("Scaling groups every %v", *scalingInterval)
+
+	s := newScaler()
+
+	ticker := time.NewTicker(*scalingInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		c.scale(s, time.Now().UTC())
+	}
+
+	return nil
+}
+
+// getScalingGroup returns a scaling group of a tenant, or any group if
+// tenantID is empty.
+func (c *controller) getScalingGroup(tenantID string, ID string) (types.ScalingGroup, error) {
+	g, err := c.ds.GetScalingGroup(ID)
+	if err != nil {
+		return types.ScalingGroup{}, err
+	}
+
+	if tenantID != "" && g.TenantID != tenantID {
+		return types.ScalingGroup{}, types.ErrScalingGroupNotFound
+	}
+
+	return g, nil
+}
+
+// CreateScalingGroup creates a scaling group and starts its desired
+// instances.  Admins, with an empty tenantID, create groups for the
+// tenant of the request.
+func (c *controller) CreateScalingGroup(tenantID string, req types.ScalingGroup) (types.ScalingGroup, error) {
+	if tenantID != "" {
+		req.TenantID = tenantID
+	}
+
+	err := validateScalingGroup(req)
+	if err != nil {
+		return req, err
+	}
+
+	_, err = c.getVisibleWorkload(req.TenantID, req.WorkloadID)
+	if err != nil {
+		return req, err
+	}
+
+	req.ID = uuid.Generate().String()
+	req.CreateTime = time.Now().UTC()
+	req.LastScale = time.Time{}
+
+	c.scalingLock.Lock()
+	defer c.scalingLock.Unlock()
+
+	err = c.ds.UpdateScalingGroup(req)
+	if err != nil {
+		return req, err
+	}
+
+	c.ds.LogEvent(req.TenantID, fmt.Sprintf("Scaling group %s created", req.ID))
+
+	c.adjustScalingGroup(req, nil, "scaling group created")
+
+	return req, nil
+}
+
+// ListScalingGroups returns the scaling groups of a tenant, or all the
+// groups if tenantID is empty.
+func (c *controller) ListScalingGroups(tenantID string) ([]types.ScalingGroup, error) {
+	return c.ds.GetScalingGroups(tenantID)
+}
+
+// ShowScalingGroup returns the status of a scaling group.
+func (c *controller) ShowScalingGroup(tenantID string, ID string) (types.ScalingGroupStatus, error) {
+	g, err := c.getScalingGroup(tenantID, ID)
+	if err != nil {
+		return types.ScalingGroupStatus{}, err
+	}
+
+	instances, err := c.scalingGroupInstances(g)
+	if err != nil {
+		return types.ScalingGroupStatus{}, err
+	}
+
+	status := types.ScalingGroupStatus{
+		ScalingGroup: g,
+		Instances:    []string{},
+	}
+
+	for _, i := range instances {
+		status.Instances = append(status.Instances, i.ID)
+	}
+	sort.Strings(status.Instances)
+
+	status.Metrics, status.Running = c.sampleScalingMetrics(instances)
+
+	return status, nil
+}
+
+// UpdateScalingGroup changes the name, instance counts, rules and
+// cooldown of a scaling group, its workload cannot be changed.
+func (c *controller) UpdateScalingGroup(tenantID string, req types.ScalingGroup) (types.ScalingGroup, error) {
+	c.scalingLock.Lock()
+	defer c.scalingLock.Unlock()
+
+	g, err := c.getScalingGroup(tenantID, req.ID)
+	if err != nil {
+		return req, err
+	}
+
+	if req.WorkloadID != "" && req.WorkloadID != g.WorkloadID {
+		return req, types.ErrBadRequest
+	}
+
+	g.Name = req.Name
+	g.MinInstances = req.MinInstances
+	g.MaxInstances = req.MaxInstances
+	g.DesiredInstances = req.DesiredInstances
+	g.ScaleOut = req.ScaleOut
+	g.ScaleIn = req.ScaleIn
+	g.Cooldown = req.Cooldown
+
+	err = validateScalingGroup(g)
+	if err != nil {
+		return req, err
+	}
+
+	err = c.ds.UpdateScalingGroup(g)
+	if err != nil {
+		return req, err
+	}
+
+	instances, err := c.scalingGroupInstances(g)
+	if err != nil {
+		return g, err
+	}
+
+	c.adjustScalingGroup(g, instances, "scaling group updated")
+
+	return g, nil
+}
+
+// DeleteScalingGroup deletes a scaling group and its instances.
+func (c *controller) DeleteScalingGroup(tenantID string, ID string) error {
+	c.scalingLock.Lock()
+	defer c.scalingLock.Unlock()
+
+	g, err := c.getScalingGroup(tenantID, ID)
+	if err != nil {
+		return err
+	}
+
+	instances, err := c.scalingGroupInstances(g)
+	if err != nil {
+		return err
+	}
+
+	for _, i := range instances {
+		err = c.deleteInstance(i.ID)
+		if err != nil {
+			glog.Warningf("Unable to delete instance %s of scaling group %s: %v", i.ID, g.ID, err)
+		}
+	}
+
+	err = c.ds.DeleteScalingGroup(g.ID)
+	if err != nil {
+		return err
+	}
+
+	c.ds.LogEvent(g.TenantID, fmt.Sprintf("Scaling group %s deleted", g.ID))
+
+	return nil
+}
+
+// ListScalingActivities returns the history of a scaling group.
+func (c *controller) ListScalingActivities(tenantID string, ID string) ([]types.ScalingActivity, error) {
+	g, err := c.getScalingGroup(tenantID, ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.ds.GetScalingActivities(g.ID)
+}
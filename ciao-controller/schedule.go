@@ -0,0 +1,346 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/01org/ciao/ciao-controller/internal/cron"
+	"github.com/01org/ciao/ciao-controller/types"
+	"github.com/01org/ciao/ssntp/uuid"
+	"github.com/golang/glog"
+)
+
+var scheduleInterval = flag.Duration("schedule_interval", 30*time.Second, "How often the instance schedules are checked for due actions, 0 disables them")
+var scheduleRestartTimeout = flag.Duration("schedule_restart_timeout", 5*time.Minute, "How long a scheduled restart waits for an instance to stop before starting it again")
+
+// validateScheduleRequest checks a schedule request and returns the time
+// of its first run.
+func validateScheduleRequest(req types.ScheduleRequest, now time.Time) (time.Time, error) {
+	switch req.Action {
+	case types.ScheduleStop, types.ScheduleStart, types.ScheduleRestart, types.ScheduleDelete:
+	default:
+		return time.Time{}, types.ErrBadRequest
+	}
+
+	if (req.InstanceID == "") == (req.Tag == "") {
+		return time.Time{}, types.ErrBadRequest
+	}
+
+	if (req.Cron == "") == (req.After == "") {
+		return time.Time{}, types.ErrBadRequest
+	}
+
+	if req.After != "" {
+		d, err := time.ParseDuration(req.After)
+		if err != nil || d <= 0 {
+			return time.Time{}, types.ErrBadRequest
+		}
+
+		return now.Add(d), nil
+	}
+
+	e, err := cron.Parse(req.Cron)
+	if err != nil {
+		return time.Time{}, types.ErrBadRequest
+	}
+
+	next := e.Next(now)
+	if next.IsZero() {
+		return time.Time{}, types.ErrBadRequest
+	}
+
+	return next, nil
+}
+
+// CreateSchedule attaches a schedule to an instance or to the instances of
+// a tenant with a tag.  Admins, with an empty tenantID, may schedule the
+// instances of any tenant.
+func (c *controller) CreateSchedule(tenantID string, req types.ScheduleRequest) (types.Schedule, error) {
+	now := time.Now().UTC()
+
+	next, err := validateScheduleRequest(req, now)
+	if err != nil {
+		return types.Schedule{}, err
+	}
+
+	if tenantID != "" {
+		req.TenantID = tenantID
+	}
+
+	if req.InstanceID != "" {
+		i, err := c.ds.GetInstance(req.InstanceID)
+		if err != nil || (req.TenantID != "" && i.TenantID != req.TenantID) {
+			return types.Schedule{}, types.ErrInstanceNotFound
+		}
+		req.TenantID = i.TenantID
+	}
+
+	if req.TenantID == "" {
+		return types.Schedule{}, types.ErrBadRequest
+	}
+
+	s := types.Schedule{
+		ID:         uuid.Generate().String(),
+		TenantID:   req.TenantID,
+		InstanceID: req.InstanceID,
+		Tag:        req.Tag,
+		Action:     req.Action,
+		Cron:       req.Cron,
+		CreateTime: now,
+		NextRun:    next,
+	}
+
+	err = c.ds.AddSchedule(s)
+	if err != nil {
+		return types.Schedule{}, err
+	}
+
+	msg := fmt.Sprintf("Schedule %s created: %s %s at %s", s.ID, s.Action, scheduleTarget(s), s.NextRun.Format(time.RFC3339))
+	c.ds.LogEvent(s.TenantID, msg)
+
+	return s, nil
+}
+
+// ListSchedules returns the schedules of a tenant, or all the schedules if
+// tenantID is empty.
+func (c *controller) ListSchedules(tenantID string) ([]types.Schedule, error) {
+	return c.ds.GetSchedules(tenantID)
+}
+
+// ShowSchedule returns a schedule of a tenant, or any schedule if tenantID
+// is empty.
+func (c *controller) ShowSchedule(tenantID string, ID string) (types.Schedule, error) {
+	s, err := c.ds.GetSchedule(ID)
+	if err != nil {
+		return types.Schedule{}, err
+	}
+
+	if tenantID != "" && s.TenantID != tenantID {
+		return types.Schedule{}, types.ErrScheduleNotFound
+	}
+
+	return s, nil
+}
+
+// DeleteSchedule removes a schedule of a tenant, or any schedule if
+// tenantID is empty.
+func (c *controller) DeleteSchedule(tenantID string, ID string) error {
+	s, err := c.ShowSchedule(tenantID, ID)
+	if err != nil {
+		return err
+	}
+
+	err = c.ds.DeleteSchedule(s.ID)
+	if err != nil {
+		return err
+	}
+
+	c.ds.LogEvent(s.TenantID, fmt.Sprintf("Schedule %s deleted", s.ID))
+
+	return nil
+}
+
+func scheduleTarget(s types.Schedule) string {
+	if s.InstanceID != "" {
+		return "instance " + s.InstanceID
+	}
+
+	return fmt.Sprintf("instances tagged %q", s.Tag)
+}
+
+// scheduleInstances returns the instances a schedule applies to.  An
+// instance schedule whose instance is gone has none.
+func (c *controller) scheduleInstances(s types.Schedule) ([]*types.Instance, error) {
+	if s.InstanceID != "" {
+		i, err := c.ds.GetInstance(s.InstanceID)
+		if err != nil {
+			return nil, nil
+		}
+		return []*types.Instance{i}, nil
+	}
+
+	instances, err := c.ds.GetAllInstancesFromTenant(s.TenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	var tagged []*types.Instance
+	for _, i := range instances {
+		for _, t := range i.Tags {
+			if t == s.Tag {
+				tagged = append(tagged, i)
+				break
+			}
+		}
+	}
+
+	return tagged, nil
+}
+
+// runScheduleAction runs the action of a schedule on an instance.  The
+// instances which are not in a state the action applies to are skipped.
+func (c *controller) runScheduleAction(action types.ScheduleAction, i *types.Instance) error {
+	switch action {
+	case types.ScheduleStop:
+		if i.State != types.InstanceRunning {
+			return nil
+		}
+		return c.stopInstance(i.ID)
+	case types.ScheduleStart:
+		if i.State != types.InstanceExited {
+			return nil
+		}
+		return c.restartInstance(i.ID)
+	case types.ScheduleRestart:
+		switch i.State {
+		case types.InstanceExited:
+			return c.restartInstance(i.ID)
+		case types.InstanceRunning:
+			err := c.stopInstance(i.ID)
+			if err != nil {
+				return err
+			}
+			go c.startStoppedInstance(i.ID, *scheduleRestartTimeout)
+		}
+		return nil
+	case types.ScheduleDelete:
+		if i.State == types.InstanceDeleting {
+			return nil
+		}
+		return c.deleteInstance(i.ID)
+	}
+
+	return types.ErrBadRequest
+}
+
+// startStoppedInstance starts an instance again once it has stopped,
+// giving up after timeout.
+func (c *controller) startStoppedInstance(instanceID string, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+
+	for time.Now().Before(deadline) {
+		time.Sleep(time.Second)
+
+		i, err := c.ds.GetInstance(instanceID)
+		if err != nil {
+			return
+		}
+
+		switch i.State {
+		case types.InstanceStopping:
+			continue
+		case types.InstanceExited:
+			err = c.restartInstance(instanceID)
+			if err != nil {
+				glog.Warningf("Unable to restart instance %s: %v", instanceID, err)
+			}
+		}
+		return
+	}
+
+	glog.Warningf("Instance %s did not stop within %v, not restarted", instanceID, timeout)
+}
+
+// runSchedules runs the schedules due at now.  The runs missed while the
+// controller was down are run once.  Recurring schedules are moved to
+// their next run, the others and the schedules whose instance is gone are
+// removed.
+func (c *controller) runSchedules(now time.Time) {
+	schedules, err := c.ds.GetSchedules("")
+	if err != nil {
+		glog.Warningf("Unable to run instance schedules: %v", err)
+		return
+	}
+
+	for _, s := range schedules {
+		instances, err := c.scheduleInstances(s)
+		if err != nil {
+			glog.Warningf("Unable to run schedule %s: %v", s.ID, err)
+			continue
+		}
+
+		if s.InstanceID != "" && len(instances) == 0 {
+			err = c.ds.DeleteSchedule(s.ID)
+			if err != nil {
+				glog.Warningf("Unable to remove schedule %s: %v", s.ID, err)
+			}
+			continue
+		}
+
+		if now.Before(s.NextRun) {
+			continue
+		}
+
+		for _, i := range instances {
+			err = c.runScheduleAction(s.Action, i)
+			if err != nil {
+				glog.Warningf("Schedule %s unable to %s instance %s: %v", s.ID, s.Action, i.ID, err)
+				continue
+			}
+
+			msg := fmt.Sprintf("Schedule %s: %s instance %s", s.ID, s.Action, i.ID)
+			c.ds.LogEvent(s.TenantID, msg)
+		}
+
+		if s.Cron == "" {
+			err = c.ds.DeleteSchedule(s.ID)
+			if err != nil {
+				glog.Warningf("Unable to remove schedule %s: %v", s.ID, err)
+			}
+			continue
+		}
+
+		e, err := cron.Parse(s.Cron)
+		if err != nil {
+			glog.Warningf("Invalid schedule %s: %v", s.ID, err)
+			continue
+		}
+
+		s.LastRun = now
+		s.NextRun = e.Next(now)
+		if s.NextRun.IsZero() {
+			err = c.ds.DeleteSchedule(s.ID)
+		} else {
+			err = c.ds.UpdateSchedule(s)
+		}
+		if err != nil {
+			glog.Warningf("Unable to update schedule %s: %v", s.ID, err)
+		}
+	}
+}
+
+// startScheduleRunner periodically runs the due instance schedules.
+func (c *controller) startScheduleRunner() error {
+	if *scheduleInterval <= 0 {
+		glog.Info("Instance schedules disabled")
+		return nil
+	}
+
+	glog.Infof("Running instance schedules every %v", *scheduleInterval)
+
+	c.runSchedules(time.Now().UTC())
+
+	ticker := time.NewTicker(*scheduleInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		c.runSchedules(time.Now().UTC())
+	}
+
+	return nil
+}
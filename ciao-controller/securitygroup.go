@@ -0,0 +1,439 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"net"
+	"time"
+
+	"github.com/01org/ciao/ciao-controller/types"
+	"github.com/01org/ciao/payloads"
+	"github.com/01org/ciao/ssntp/uuid"
+	"github.com/golang/glog"
+)
+
+var securityGroupSyncInterval = flag.Duration("security_group_sync_interval", 5*time.Minute, "How often the security group rules of the instances are sent again to the launchers, 0 only sends them when they change")
+
+// the address of the metadata service, proxied by the CNCIs
+const securityGroupMetadataCIDR = "169.254.169.254/32"
+
+// validateSecurityGroupRule checks a rule given by a user and fills its
+// unset fields with the defaults, ingress from any address.
+func validateSecurityGroupRule(rule *types.SecurityGroupRule) error {
+	switch rule.Direction {
+	case "":
+		rule.Direction = payloads.Ingress
+	case payloads.Ingress, payloads.Egress:
+	default:
+		return types.ErrBadRequest
+	}
+
+	switch rule.Protocol {
+	case "tcp", "udp":
+		if rule.PortMin < 1 || rule.PortMax > 65535 || rule.PortMin > rule.PortMax {
+			return types.ErrBadRequest
+		}
+	case "icmp", "":
+		if (rule.PortMin != 0 && rule.PortMin != -1) || (rule.PortMax != 0 && rule.PortMax != -1) {
+			return types.ErrBadRequest
+		}
+		rule.PortMin = -1
+		rule.PortMax = -1
+	default:
+		return types.ErrBadRequest
+	}
+
+	if rule.RemoteCIDR != "" && rule.RemoteGroupID != "" {
+		return types.ErrBadRequest
+	}
+
+	if rule.RemoteCIDR != "" {
+		_, ipNet, err := net.ParseCIDR(rule.RemoteCIDR)
+		if err != nil || ipNet.IP.To4() == nil {
+			return types.ErrBadRequest
+		}
+		rule.RemoteCIDR = ipNet.String()
+	} else if rule.RemoteGroupID == "" {
+		rule.RemoteCIDR = "0.0.0.0/0"
+	}
+
+	return nil
+}
+
+// newSecurityGroup returns a security group of a tenant which allows all
+// the traffic from its instances, as the security groups created by
+// OpenStack do.
+func newSecurityGroup(tenantID string, name string, description string) types.SecurityGroup {
+	return types.SecurityGroup{
+		ID:          uuid.Generate().String(),
+		TenantID:    tenantID,
+		Name:        name,
+		Description: description,
+		Rules: []types.SecurityGroupRule{
+			{
+				ID:         uuid.Generate().String(),
+				Direction:  payloads.Egress,
+				PortMin:    -1,
+				PortMax:    -1,
+				RemoteCIDR: "0.0.0.0/0",
+			},
+		},
+		CreateTime: time.Now(),
+	}
+}
+
+// securityGroupUsers returns the instances in a security group and the
+// security groups with rules referring to it.
+func (c *controller) securityGroupUsers(g types.SecurityGroup) ([]string, []string, error) {
+	instances, err := c.ds.GetAllInstancesFromTenant(g.TenantID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var members []string
+	for _, i := range instances {
+		for _, id := range i.SecurityGroups {
+			if id == g.ID {
+				members = append(members, i.ID)
+				break
+			}
+		}
+	}
+
+	groups, err := c.ds.GetSecurityGroups(g.TenantID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var referrers []string
+	for _, o := range groups {
+		if o.ID == g.ID {
+			continue
+		}
+
+		for _, r := range o.Rules {
+			if r.RemoteGroupID == g.ID {
+				referrers = append(referrers, o.ID)
+				break
+			}
+		}
+	}
+
+	return members, referrers, nil
+}
+
+// tenantSecurityGroups returns the security groups named by a user among
+// those of a tenant, as a list of IDs.
+func (c *controller) tenantSecurityGroups(tenantID string, names []string) ([]string, error) {
+	groups, err := c.ds.GetSecurityGroups(tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	var IDs []string
+	for _, name := range names {
+		found := false
+		for _, g := range groups {
+			if g.Name == name || g.ID == name {
+				IDs = append(IDs, g.ID)
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return nil, types.ErrSecurityGroupNotFound
+		}
+	}
+
+	return IDs, nil
+}
+
+// securityRules holds the security groups of a tenant and the addresses of
+// the instances in each of them, to resolve the rules of its instances.
+type securityRules struct {
+	groups  map[string]types.SecurityGroup
+	members map[string][]string
+}
+
+// tenantSecurityRules gathers the security groups of a tenant and the
+// addresses of their instances.
+func (c *controller) tenantSecurityRules(tenantID string) (securityRules, []*types.Instance, error) {
+	s := securityRules{
+		groups:  make(map[string]types.SecurityGroup),
+		members: make(map[string][]string),
+	}
+
+	groups, err := c.ds.GetSecurityGroups(tenantID)
+	if err != nil {
+		return s, nil, err
+	}
+
+	for _, g := range groups {
+		s.groups[g.ID] = g
+	}
+
+	instances, err := c.ds.GetAllInstancesFromTenant(tenantID)
+	if err != nil {
+		return s, nil, err
+	}
+
+	for _, i := range instances {
+		if i.IPAddress == "" || i.State == types.InstanceDeleting {
+			continue
+		}
+
+		for _, id := range i.SecurityGroups {
+			s.members[id] = append(s.members[id], i.IPAddress+"/32")
+		}
+	}
+
+	return s, instances, nil
+}
+
+// instanceSecurity returns the rules enforced on the traffic of an
+// instance with the address ip in the security groups groupIDs.  The
+// instances in security groups may always talk to their CNCI, which is
+// their gateway and DNS server, and reach the metadata service.
+func (s securityRules) instanceSecurity(instanceID string, ip string, groupIDs []string) payloads.InstanceSecurity {
+	sec := payloads.InstanceSecurity{
+		InstanceUUID: instanceID,
+		Enforced:     len(groupIDs) > 0,
+	}
+
+	if !sec.Enforced {
+		return sec
+	}
+
+	if addr := net.ParseIP(ip); addr != nil && addr.To4() != nil {
+		gw := metadataGateway(addr).String() + "/32"
+		sec.Rules = append(sec.Rules,
+			payloads.SecurityGroupRule{Direction: payloads.Ingress, RemoteCIDR: gw},
+			payloads.SecurityGroupRule{Direction: payloads.Egress, RemoteCIDR: gw},
+			payloads.SecurityGroupRule{
+				Direction:  payloads.Egress,
+				Protocol:   "tcp",
+				PortMin:    80,
+				PortMax:    80,
+				RemoteCIDR: securityGroupMetadataCIDR,
+			})
+	}
+
+	for _, id := range groupIDs {
+		g, ok := s.groups[id]
+		if !ok {
+			continue
+		}
+
+		for _, r := range g.Rules {
+			rule := payloads.SecurityGroupRule{
+				Direction: r.Direction,
+				Protocol:  r.Protocol,
+			}
+
+			if r.PortMin > 0 {
+				rule.PortMin = r.PortMin
+				rule.PortMax = r.PortMax
+			}
+
+			if r.RemoteGroupID == "" {
+				rule.RemoteCIDR = r.RemoteCIDR
+				sec.Rules = append(sec.Rules, rule)
+				continue
+			}
+
+			for _, cidr := range s.members[r.RemoteGroupID] {
+				if cidr == ip+"/32" {
+					continue
+				}
+				rule.RemoteCIDR = cidr
+				sec.Rules = append(sec.Rules, rule)
+			}
+		}
+	}
+
+	return sec
+}
+
+// newInstanceSecurity returns the rules of a new instance of a tenant,
+// sent to its launcher along with the instance.
+func (c *controller) newInstanceSecurity(tenantID string, instanceID string, ip string, groupIDs []string) (*payloads.InstanceSecurity, error) {
+	if len(groupIDs) == 0 {
+		return nil, nil
+	}
+
+	s, _, err := c.tenantSecurityRules(tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	sec := s.instanceSecurity(instanceID, ip, groupIDs)
+	return &sec, nil
+}
+
+// updateSecurityGroups sends the rules of all the instances of a tenant
+// to the launchers of their nodes.  The instances in no security group are
+// sent too, so that the launchers stop filtering their traffic when they
+// leave their last group.
+func (c *controller) updateSecurityGroups(tenantID string) error {
+	s, instances, err := c.tenantSecurityRules(tenantID)
+	if err != nil {
+		return err
+	}
+
+	nodes := make(map[string][]payloads.InstanceSecurity)
+	for _, i := range instances {
+		if i.NodeID == "" || i.CNCI || i.State == types.InstanceDeleting {
+			continue
+		}
+
+		nodes[i.NodeID] = append(nodes[i.NodeID], s.instanceSecurity(i.ID, i.IPAddress, i.SecurityGroups))
+	}
+
+	for nodeID, security := range nodes {
+		err = c.client.configureSecurityGroups(nodeID, tenantID, security)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *controller) sendSecurityGroups(tenantID string) {
+	err := c.updateSecurityGroups(tenantID)
+	if err != nil {
+		glog.Warningf("Unable to send security groups of tenant %s: %v", tenantID, err)
+	}
+}
+
+// syncSecurityGroups sends the rules again to the launchers of the
+// instances of the tenants which have security groups, in case a launcher
+// restarted or an instance moved to another node.
+func (c *controller) syncSecurityGroups() {
+	groups, err := c.ds.GetSecurityGroups("")
+	if err != nil {
+		glog.Warningf("Unable to get security groups: %v", err)
+		return
+	}
+
+	tenants := make(map[string]bool)
+	for _, g := range groups {
+		if tenants[g.TenantID] {
+			continue
+		}
+		tenants[g.TenantID] = true
+
+		c.sendSecurityGroups(g.TenantID)
+	}
+}
+
+// tenantHasSecurityGroups returns true if the tenant has security groups
+// whose rules may depend on the addresses of its instances.
+func (c *controller) tenantHasSecurityGroups(tenantID string) bool {
+	groups, err := c.ds.GetSecurityGroups(tenantID)
+	return err == nil && len(groups) > 0
+}
+
+// startSecurityGroupSync sends the rules of the instances of a tenant
+// again when one of its instances starts or is removed, since the rules
+// referring to a security group list the addresses of its instances, and
+// periodically.
+func (c *controller) startSecurityGroupSync() error {
+	_, events := c.ds.SubscribeEvents()
+
+	var tick <-chan time.Time
+	if *securityGroupSyncInterval > 0 {
+		glog.Infof("Sending security groups every %v", *securityGroupSyncInterval)
+
+		ticker := time.NewTicker(*securityGroupSyncInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	} else {
+		glog.Info("Security groups only sent when they change")
+	}
+
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				return nil
+			}
+
+			started := e.Type == types.InstanceStateEvent && e.From == payloads.Pending
+			if (started || e.Type == types.InstanceDeletedEvent) && c.tenantHasSecurityGroups(e.TenantID) {
+				c.sendSecurityGroups(e.TenantID)
+			}
+		case <-tick:
+			c.syncSecurityGroups()
+		}
+	}
+}
+
+// addSecurityGroupRule validates a rule and adds it to a security group,
+// then sends the new rules to the launchers.
+func (c *controller) addSecurityGroupRule(g types.SecurityGroup, rule types.SecurityGroupRule) (types.SecurityGroupRule, error) {
+	err := validateSecurityGroupRule(&rule)
+	if err != nil {
+		return rule, err
+	}
+
+	if rule.RemoteGroupID != "" {
+		remote, err := c.ds.GetSecurityGroup(rule.RemoteGroupID)
+		if err != nil || remote.TenantID != g.TenantID {
+			return rule, types.ErrBadRequest
+		}
+	}
+
+	rule.ID = uuid.Generate().String()
+
+	err = c.ds.AddSecurityGroupRule(g.ID, rule)
+	if err != nil {
+		return rule, err
+	}
+
+	go c.sendSecurityGroups(g.TenantID)
+
+	return rule, nil
+}
+
+// deleteSecurityGroup deletes a security group which no instance belongs
+// to and no rule of another security group refers to.
+func (c *controller) deleteSecurityGroup(g types.SecurityGroup) error {
+	members, referrers, err := c.securityGroupUsers(g)
+	if err != nil {
+		return err
+	}
+
+	if len(members) > 0 || len(referrers) > 0 {
+		return types.ErrSecurityGroupInUse
+	}
+
+	return c.ds.DeleteSecurityGroup(g.ID)
+}
+
+// setInstanceSecurityGroups changes the security groups of an instance,
+// then sends the new rules to the launchers.
+func (c *controller) setInstanceSecurityGroups(i *types.Instance, groupIDs []string) error {
+	err := c.ds.SetInstanceSecurityGroups(i.ID, groupIDs)
+	if err != nil {
+		return err
+	}
+
+	go c.sendSecurityGroups(i.TenantID)
+
+	return nil
+}
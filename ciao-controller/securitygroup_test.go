@@ -0,0 +1,136 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/01org/ciao/ciao-controller/types"
+	"github.com/01org/ciao/payloads"
+)
+
+func TestValidateSecurityGroupRule(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  types.SecurityGroupRule
+		valid bool
+	}{
+		{"tcp", types.SecurityGroupRule{Protocol: "tcp", PortMin: 22, PortMax: 22}, true},
+		{"udp range", types.SecurityGroupRule{Direction: payloads.Egress, Protocol: "udp", PortMin: 1000, PortMax: 2000, RemoteCIDR: "10.0.0.0/8"}, true},
+		{"icmp", types.SecurityGroupRule{Protocol: "icmp", PortMin: -1, PortMax: -1}, true},
+		{"any", types.SecurityGroupRule{RemoteGroupID: "group"}, true},
+		{"unknown direction", types.SecurityGroupRule{Direction: "both", Protocol: "tcp", PortMin: 22, PortMax: 22}, false},
+		{"unknown protocol", types.SecurityGroupRule{Protocol: "sctp", PortMin: 22, PortMax: 22}, false},
+		{"no port", types.SecurityGroupRule{Protocol: "tcp"}, false},
+		{"invalid port", types.SecurityGroupRule{Protocol: "tcp", PortMin: 1, PortMax: 65536}, false},
+		{"inverted ports", types.SecurityGroupRule{Protocol: "tcp", PortMin: 80, PortMax: 22}, false},
+		{"icmp ports", types.SecurityGroupRule{Protocol: "icmp", PortMin: 8, PortMax: 8}, false},
+		{"invalid cidr", types.SecurityGroupRule{Protocol: "tcp", PortMin: 22, PortMax: 22, RemoteCIDR: "10.0.0.0"}, false},
+		{"ipv6 cidr", types.SecurityGroupRule{Protocol: "tcp", PortMin: 22, PortMax: 22, RemoteCIDR: "fd00::/8"}, false},
+		{"cidr and group", types.SecurityGroupRule{RemoteCIDR: "10.0.0.0/8", RemoteGroupID: "group"}, false},
+	}
+
+	for _, test := range tests {
+		rule := test.rule
+		err := validateSecurityGroupRule(&rule)
+		if test.valid && err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		} else if !test.valid && err == nil {
+			t.Errorf("%s: invalid rule accepted", test.name)
+		}
+	}
+}
+
+func TestSecurityGroupRuleDefaults(t *testing.T) {
+	rule := types.SecurityGroupRule{Protocol: "icmp", RemoteCIDR: "10.1.2.3/8"}
+
+	err := validateSecurityGroupRule(&rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := types.SecurityGroupRule{
+		Direction:  payloads.Ingress,
+		Protocol:   "icmp",
+		PortMin:    -1,
+		PortMax:    -1,
+		RemoteCIDR: "10.0.0.0/8",
+	}
+	if rule != expected {
+		t.Fatalf("expected %+v, got %+v", expected, rule)
+	}
+
+	rule = types.SecurityGroupRule{Protocol: "tcp", PortMin: 22, PortMax: 22}
+	err = validateSecurityGroupRule(&rule)
+	if err != nil || rule.RemoteCIDR != "0.0.0.0/0" {
+		t.Fatalf("expected a rule from any address, got %+v, %v", rule, err)
+	}
+}
+
+func TestInstanceSecurity(t *testing.T) {
+	s := securityRules{
+		groups: map[string]types.SecurityGroup{
+			"web": {
+				ID: "web",
+				Rules: []types.SecurityGroupRule{
+					{Direction: payloads.Ingress, Protocol: "tcp", PortMin: 80, PortMax: 80, RemoteCIDR: "0.0.0.0/0"},
+					{Direction: payloads.Egress, PortMin: -1, PortMax: -1, RemoteGroupID: "db"},
+				},
+			},
+			"db": {
+				ID: "db",
+				Rules: []types.SecurityGroupRule{
+					{Direction: payloads.Ingress, Protocol: "tcp", PortMin: 5432, PortMax: 5432, RemoteGroupID: "web"},
+				},
+			},
+		},
+		members: map[string][]string{
+			"web": {"172.16.0.2/32", "172.16.0.3/32"},
+			"db":  {"172.16.0.4/32"},
+		},
+	}
+
+	sec := s.instanceSecurity("unfiltered", "172.16.0.5", nil)
+	if sec.Enforced || len(sec.Rules) != 0 {
+		t.Fatalf("instance in no security group filtered: %+v", sec)
+	}
+
+	sec = s.instanceSecurity("db", "172.16.0.4", []string{"db"})
+	expected := payloads.InstanceSecurity{
+		InstanceUUID: "db",
+		Enforced:     true,
+		Rules: []payloads.SecurityGroupRule{
+			{Direction: payloads.Ingress, RemoteCIDR: "172.16.0.1/32"},
+			{Direction: payloads.Egress, RemoteCIDR: "172.16.0.1/32"},
+			{Direction: payloads.Egress, Protocol: "tcp", PortMin: 80, PortMax: 80, RemoteCIDR: securityGroupMetadataCIDR},
+			{Direction: payloads.Ingress, Protocol: "tcp", PortMin: 5432, PortMax: 5432, RemoteCIDR: "172.16.0.2/32"},
+			{Direction: payloads.Ingress, Protocol: "tcp", PortMin: 5432, PortMax: 5432, RemoteCIDR: "172.16.0.3/32"},
+		},
+	}
+	if !reflect.DeepEqual(sec, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, sec)
+	}
+
+	sec = s.instanceSecurity("web", "172.16.0.2", []string{"web"})
+	rules := sec.Rules[3:]
+	expectedRules := []payloads.SecurityGroupRule{
+		{Direction: payloads.Ingress, Protocol: "tcp", PortMin: 80, PortMax: 80, RemoteCIDR: "0.0.0.0/0"},
+		{Direction: payloads.Egress, RemoteCIDR: "172.16.0.4/32"},
+	}
+	if !reflect.DeepEqual(rules, expectedRules) {
+		t.Fatalf("expected rules %+v, got %+v", expectedRules, rules)
+	}
+}
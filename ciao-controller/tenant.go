@@ -0,0 +1,143 @@
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/01org/ciao/ciao-controller/types"
+)
+
+func tenantSummary(t *types.Tenant) types.TenantSummary {
+	return types.TenantSummary{
+		ID:   t.ID,
+		Name: t.Name,
+	}
+}
+
+// ListTenants returns all the tenants known to ciao sorted by ID.
+func (c *controller) ListTenants() ([]types.TenantSummary, error) {
+	tenants, err := c.ds.GetAllTenants()
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := []types.TenantSummary{}
+	for _, t := range tenants {
+		summaries = append(summaries, tenantSummary(t))
+	}
+
+	sort.Sort(types.SortedTenantsByID(summaries))
+
+	return summaries, nil
+}
+
+// CreateTenant adds a tenant and starts its CNCI.  Tenants are also
+// created implicitly the first time they use ciao.
+func (c *controller) CreateTenant(ID string, name string) (types.TenantSummary, error) {
+	t, err := c.ds.GetTenant(ID)
+	if err != nil {
+		return types.TenantSummary{}, err
+	}
+
+	if t != nil {
+		return types.TenantSummary{}, types.ErrDuplicateTenant
+	}
+
+	err = c.confirmTenant(ID)
+	if err != nil {
+		return types.TenantSummary{}, err
+	}
+
+	if name != "" {
+		err = c.ds.UpdateTenantName(ID, name)
+		if err != nil {
+			return types.TenantSummary{}, err
+		}
+	}
+
+	return c.ShowTenant(ID)
+}
+
+// ShowTenant returns the details of a tenant.
+func (c *controller) ShowTenant(ID string) (types.TenantSummary, error) {
+	t, err := c.ds.GetTenant(ID)
+	if err != nil {
+		return types.TenantSummary{}, err
+	}
+
+	if t == nil {
+		return types.TenantSummary{}, types.ErrTenantNotFound
+	}
+
+	return tenantSummary(t), nil
+}
+
+// UpdateTenant renames a tenant.
+func (c *controller) UpdateTenant(ID string, name string) (types.TenantSummary, error) {
+	err := c.ds.UpdateTenantName(ID, name)
+	if err != nil {
+		return types.TenantSummary{}, err
+	}
+
+	return c.ShowTenant(ID)
+}
+
+// DeleteTenant removes a tenant which no longer owns any instance,
+// volume, external IP or workload and deletes its CNCI.
+func (c *controller) DeleteTenant(ID string) error {
+	t, err := c.ds.GetTenant(ID)
+	if err != nil {
+		return err
+	}
+
+	if t == nil {
+		return types.ErrTenantNotFound
+	}
+
+	cnci, err := c.ds.GetInstance(t.CNCIID)
+	if err != nil {
+		cnci = nil
+	}
+
+	err = c.ds.DeleteTenant(ID)
+	if err != nil {
+		return err
+	}
+
+	if cnci != nil && cnci.NodeID != "" {
+		go c.client.DeleteInstance(cnci.ID, cnci.NodeID)
+	}
+
+	c.ds.LogEvent("", fmt.Sprintf("Deleted tenant %s", ID))
+
+	return nil
+}
+
+// ListQuotas returns the quotas of a tenant along with their usage.
+func (c *controller) ListQuotas(tenantID string) ([]types.QuotaDetails, error) {
+	return c.ds.GetQuotas(tenantID)
+}
+
+// UpdateQuotas changes the quotas of a tenant and returns all of them.
+func (c *controller) UpdateQuotas(tenantID string, quotas []types.QuotaDetails) ([]types.QuotaDetails, error) {
+	err := c.ds.UpdateQuotas(tenantID, quotas)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.ds.GetQuotas(tenantID)
+}
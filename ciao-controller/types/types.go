@@ -18,6 +18,8 @@ package types
 
 import (
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/01org/ciao/ciao-storage"
@@ -81,6 +83,46 @@ type Workload struct {
 	Config      string                       `json:"config"`
 	Defaults    []payloads.RequestedResource `json:"defaults"`
 	Storage     []StorageResource            `json:"storage"`
+	TenantID    string                       `json:"tenant_id,omitempty"`
+	Visibility  Visibility                   `json:"visibility,omitempty"`
+	Parameters  []WorkloadParameter          `json:"parameters,omitempty"`
+
+	// RestartPolicy tells how the instances of the workload are
+	// restarted when they exit or lose their node, they are never
+	// restarted if it is nil.
+	RestartPolicy *payloads.RestartPolicy `json:"restart_policy,omitempty"`
+
+	// HealthCheck tells how the health of the instances of the workload
+	// is checked from their tenant network, it is not checked if it is
+	// nil.
+	HealthCheck *payloads.HealthCheck `json:"health_check,omitempty"`
+}
+
+// WorkloadParameter is a parameter of the config of a workload, set when
+// instances of the workload are started.  The config of a workload with
+// parameters is a text/template rendered for each instance.
+type WorkloadParameter struct {
+	Name        string `json:"name" yaml:"name"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	Default     string `json:"default,omitempty" yaml:"default,omitempty"`
+	Required    bool   `json:"required,omitempty" yaml:"required,omitempty"`
+}
+
+// Visibility defines which tenants may see and use a workload.
+type Visibility string
+
+const (
+	// Public workloads are available to all tenants.
+	Public Visibility = "public"
+
+	// Private workloads are only available to the tenant owning them.
+	Private Visibility = "private"
+)
+
+// VisibleTo tells if a workload may be used by a tenant.  An empty
+// tenant ID stands for an admin, who can use all workloads.
+func (w *Workload) VisibleTo(tenantID string) bool {
+	return tenantID == "" || w.Visibility != Private || w.TenantID == tenantID
 }
 
 // WorkloadResponse will be returned from /workloads apis
@@ -90,6 +132,11 @@ type WorkloadResponse struct {
 	Link     Link     `json:"link"`
 }
 
+// ListWorkloadsResponse is returned from GET /workloads
+type ListWorkloadsResponse struct {
+	Workloads []WorkloadResponse `json:"workloads"`
+}
+
 // WorkloadRequest contains resource and configuration for a user
 // workload.
 type WorkloadRequest struct {
@@ -98,23 +145,151 @@ type WorkloadRequest struct {
 	Instances  int
 	TraceLabel string
 	Volumes    []storage.BlockDevice
+	Priority   payloads.Priority
+	Name       string
+	Tags       []string
+	Metadata   map[string]string
+	Parameters map[string]string
+
+	// RestartPolicy overrides the restart policy of the workload.
+	RestartPolicy *payloads.RestartPolicy
+
+	// HealthCheck overrides the health check of the workload.
+	HealthCheck *payloads.HealthCheck
+
+	// Keypair is injected in the metadata of the instances.
+	Keypair *Keypair
+
+	// SecurityGroups are the IDs of the security groups of the
+	// instances.
+	SecurityGroups []string
+}
+
+// InstanceState represents the lifecycle state of an instance in the
+// controller datastore.  The states reported by ciao-launcher are a
+// subset of these.
+type InstanceState string
+
+const (
+	// InstancePending means that the instance has not been started yet.
+	InstancePending InstanceState = payloads.ComputeStatusPending
+
+	// InstanceRunning means that the instance is running.
+	InstanceRunning InstanceState = payloads.ComputeStatusRunning
+
+	// InstanceExited means that the instance was created but is not
+	// running anymore.
+	InstanceExited InstanceState = payloads.ComputeStatusStopped
+
+	// InstanceStopping means that a stop command was sent.
+	InstanceStopping InstanceState = "stopping"
+
+	// InstanceRestarting means that a restart command was sent.
+	InstanceRestarting InstanceState = "restarting"
+
+	// InstanceDeleting means that a delete command was sent.
+	InstanceDeleting InstanceState = "deleting"
+
+	// InstanceLost means that the node the instance was running on
+	// stopped reporting it.
+	InstanceLost InstanceState = "lost"
+)
+
+// instanceTransitions lists the states each state may move to.
+var instanceTransitions = map[InstanceState][]InstanceState{
+	"":                 {InstancePending},
+	InstancePending:    {InstanceRunning, InstanceExited, InstanceLost},
+	InstanceRunning:    {InstanceStopping, InstanceExited, InstanceDeleting, InstanceLost},
+	InstanceStopping:   {InstanceExited, InstanceRunning, InstanceDeleting, InstanceLost},
+	InstanceExited:     {InstanceRestarting, InstanceRunning, InstanceDeleting, InstanceLost},
+	InstanceRestarting: {InstancePending, InstanceRunning, InstanceExited, InstanceDeleting, InstanceLost},
+	InstanceDeleting:   {},
+	InstanceLost:       {InstancePending, InstanceRunning, InstanceExited, InstanceDeleting},
+}
+
+// CanTransition tells if an instance may move from state s to state to.
+func (s InstanceState) CanTransition(to InstanceState) bool {
+	for _, allowed := range instanceTransitions[s] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Transient tells if the state is waiting for the result of a command
+// sent to ciao-launcher.
+func (s InstanceState) Transient() bool {
+	return s == InstanceStopping || s == InstanceRestarting || s == InstanceDeleting
+}
+
+// InstanceTransition records a change of state of an instance.
+type InstanceTransition struct {
+	From      InstanceState `json:"from"`
+	To        InstanceState `json:"to"`
+	Timestamp time.Time     `json:"timestamp"`
+}
+
+// TransitionError is returned when an action is not allowed in the
+// current state of an instance.
+type TransitionError struct {
+	InstanceID string
+	From       InstanceState
+	To         InstanceState
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("Instance %s cannot go from %s to %s", e.InstanceID, e.From, e.To)
+}
+
+// ParameterError is returned when the parameters given to start instances
+// of a workload are unknown or missing, or fail to render its config.
+type ParameterError struct {
+	WorkloadID string
+	Reason     string
+}
+
+func (e *ParameterError) Error() string {
+	return fmt.Sprintf("Invalid parameters of workload %s: %s", e.WorkloadID, e.Reason)
 }
 
 // Instance contains information about an instance of a workload.
 type Instance struct {
-	ID          string              `json:"instance_id"`
-	TenantID    string              `json:"tenant_id"`
-	State       string              `json:"instance_state"`
-	WorkloadID  string              `json:"workload_id"`
-	NodeID      string              `json:"node_id"`
-	MACAddress  string              `json:"mac_address"`
-	IPAddress   string              `json:"ip_address"`
-	SSHIP       string              `json:"ssh_ip"`
-	SSHPort     int                 `json:"ssh_port"`
-	CNCI        bool                `json:"-"`
-	Usage       map[string]int      `json:"-"`
-	Attachments []StorageAttachment `json:"-"`
-	CreateTime  time.Time           `json:"-"`
+	ID          string               `json:"instance_id"`
+	TenantID    string               `json:"tenant_id"`
+	State       InstanceState        `json:"instance_state"`
+	WorkloadID  string               `json:"workload_id"`
+	NodeID      string               `json:"node_id"`
+	MACAddress  string               `json:"mac_address"`
+	IPAddress   string               `json:"ip_address"`
+	SSHIP       string               `json:"ssh_ip"`
+	SSHPort     int                  `json:"ssh_port"`
+	Name        string               `json:"name"`
+	Tags        []string             `json:"tags"`
+	Metadata    map[string]string    `json:"metadata"`
+	CNCI        bool                 `json:"-"`
+	Usage       map[string]int       `json:"-"`
+	Attachments []StorageAttachment  `json:"-"`
+	CreateTime  time.Time            `json:"-"`
+	Transitions []InstanceTransition `json:"-"`
+
+	// HealthCheck is the health check of the instance, Health and
+	// HealthReason are the health it last reported and the error of the
+	// last failed probe.  Health is empty until the CNCI of the tenant
+	// reports it.
+	HealthCheck  *payloads.HealthCheck `json:"health_check,omitempty"`
+	Health       payloads.HealthStatus `json:"health,omitempty"`
+	HealthReason string                `json:"health_reason,omitempty"`
+
+	// KeyName and PublicKey are the keypair injected in the metadata
+	// of the instance when it was created.
+	KeyName   string `json:"key_name,omitempty"`
+	PublicKey string `json:"public_key,omitempty"`
+
+	// SecurityGroups are the IDs of the security groups of the
+	// instance.  The traffic of instances without security groups is
+	// not filtered.
+	SecurityGroups []string `json:"security_groups,omitempty"`
 }
 
 // SortedInstancesByID implements sort.Interface for Instance by ID string
@@ -124,6 +299,13 @@ func (s SortedInstancesByID) Len() int           { return len(s) }
 func (s SortedInstancesByID) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
 func (s SortedInstancesByID) Less(i, j int) bool { return s[i].ID < s[j].ID }
 
+// SortedWorkloadsByID implements sort.Interface for Workload by ID string
+type SortedWorkloadsByID []Workload
+
+func (s SortedWorkloadsByID) Len() int           { return len(s) }
+func (s SortedWorkloadsByID) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s SortedWorkloadsByID) Less(i, j int) bool { return s[i].ID < s[j].ID }
+
 // SortedComputeNodesByID implements sort.Interface for Node by ID string
 type SortedComputeNodesByID []CiaoComputeNode
 
@@ -150,13 +332,277 @@ type Resource struct {
 }
 
 // OverLimit calculates whether a request will put a tenant over it's limit.
+// A negative limit means the resource is unlimited.
 func (r *Resource) OverLimit(request int) bool {
-	if r.Limit > 0 && r.Usage+request > r.Limit {
+	if r.Limit >= 0 && r.Usage+request > r.Limit {
 		return true
 	}
 	return false
 }
 
+// Names of the tenant resources which can be given a quota.
+const (
+	InstancesQuota   = "instances"
+	VCPUsQuota       = "vcpus"
+	MemoryQuota      = "mem_mb"
+	DiskQuota        = "disk_mb"
+	VolumesQuota     = "volumes"
+	ExternalIPsQuota = "external_ips"
+
+	// ShareWeightQuota is not a quota but the fair-share weight of
+	// the tenant in the scheduler, it has no usage.
+	ShareWeightQuota = "share_weight"
+)
+
+// QuotaNames lists the resources which can be given a quota, in the
+// order they are reported.
+var QuotaNames = []string{
+	InstancesQuota,
+	VCPUsQuota,
+	MemoryQuota,
+	DiskQuota,
+	VolumesQuota,
+	ExternalIPsQuota,
+	ShareWeightQuota,
+}
+
+// QuotaDetails holds the limit and usage of a tenant resource.
+// A negative value means the resource is unlimited.
+type QuotaDetails struct {
+	Name  string `json:"name"`
+	Value int    `json:"value"`
+	Usage int    `json:"usage"`
+}
+
+// QuotaListResponse lists the quotas of a tenant.
+type QuotaListResponse struct {
+	Quotas []QuotaDetails `json:"quotas"`
+}
+
+// QuotaUpdateRequest is used to change the quotas of a tenant.  Quotas
+// which are not listed are left unchanged and usage is ignored.
+type QuotaUpdateRequest struct {
+	Quotas []QuotaDetails `json:"quotas"`
+}
+
+// TenantSummary is a short form of Tenant.
+type TenantSummary struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Links []Link `json:"links,omitempty"`
+}
+
+// SortedTenantsByID implements sort.Interface for TenantSummary by ID.
+type SortedTenantsByID []TenantSummary
+
+func (s SortedTenantsByID) Len() int           { return len(s) }
+func (s SortedTenantsByID) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s SortedTenantsByID) Less(i, j int) bool { return s[i].ID < s[j].ID }
+
+// TenantsListResponse lists the tenants known to ciao.
+type TenantsListResponse struct {
+	Tenants []TenantSummary `json:"tenants"`
+}
+
+// TenantRequest is used to create a tenant or to rename it.  The ID
+// must be the one of the matching identity service project.
+type TenantRequest struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// ScheduleAction is the action a schedule runs on its instances.
+type ScheduleAction string
+
+const (
+	// ScheduleStop stops the running instances.
+	ScheduleStop ScheduleAction = "stop"
+
+	// ScheduleStart starts the exited instances.
+	ScheduleStart ScheduleAction = "start"
+
+	// ScheduleRestart stops the running instances and starts them again.
+	ScheduleRestart ScheduleAction = "restart"
+
+	// ScheduleDelete deletes the instances.
+	ScheduleDelete ScheduleAction = "delete"
+)
+
+// Schedule runs an action on an instance, or on the instances of a tenant
+// with a tag, at the times matched by a cron expression.  A schedule
+// without a cron expression runs once at NextRun and is then removed.
+type Schedule struct {
+	ID         string         `json:"id"`
+	TenantID   string         `json:"tenant_id"`
+	InstanceID string         `json:"instance_id,omitempty"`
+	Tag        string         `json:"tag,omitempty"`
+	Action     ScheduleAction `json:"action"`
+	Cron       string         `json:"cron,omitempty"`
+	CreateTime time.Time      `json:"create_time"`
+	LastRun    time.Time      `json:"last_run"`
+	NextRun    time.Time      `json:"next_run"`
+	Links      []Link         `json:"links,omitempty"`
+}
+
+// SortedSchedulesByID implements sort.Interface for Schedule by ID.
+type SortedSchedulesByID []Schedule
+
+func (s SortedSchedulesByID) Len() int           { return len(s) }
+func (s SortedSchedulesByID) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s SortedSchedulesByID) Less(i, j int) bool { return s[i].ID < s[j].ID }
+
+// ScheduleRequest is used to create a schedule.  One of InstanceID and
+// Tag, and one of Cron and After must be set.  After is a duration, e.g.,
+// 8h, after which the action runs once.  TenantID is only used by admins
+// scheduling an action on the instances of a tenant with a tag.
+type ScheduleRequest struct {
+	TenantID   string         `json:"tenant_id,omitempty"`
+	InstanceID string         `json:"instance_id,omitempty"`
+	Tag        string         `json:"tag,omitempty"`
+	Action     ScheduleAction `json:"action"`
+	Cron       string         `json:"cron,omitempty"`
+	After      string         `json:"after,omitempty"`
+}
+
+// ListSchedulesResponse lists the schedules of a tenant.
+type ListSchedulesResponse struct {
+	Schedules []Schedule `json:"schedules"`
+}
+
+// Keypair is an SSH public key of a user.  The names of the keypairs are
+// unique among the keypairs of a user.
+type Keypair struct {
+	UserID      string    `json:"user_id"`
+	Name        string    `json:"name"`
+	Type        string    `json:"type"`
+	PublicKey   string    `json:"public_key"`
+	Fingerprint string    `json:"fingerprint"`
+	CreateTime  time.Time `json:"create_time"`
+}
+
+// SortedKeypairsByName implements sort.Interface for Keypair by Name.
+type SortedKeypairsByName []Keypair
+
+func (s SortedKeypairsByName) Len() int           { return len(s) }
+func (s SortedKeypairsByName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s SortedKeypairsByName) Less(i, j int) bool { return s[i].Name < s[j].Name }
+
+// SecurityGroupRule allows a flow of traffic of the instances of a
+// security group.  The remote end of the traffic is either the range of
+// addresses RemoteCIDR or the instances of the security group
+// RemoteGroupID.  PortMin and PortMax are -1 for the icmp protocol and
+// when all protocols are allowed.
+type SecurityGroupRule struct {
+	ID            string                          `json:"id"`
+	Direction     payloads.SecurityGroupDirection `json:"direction"`
+	Protocol      string                          `json:"protocol"`
+	PortMin       int                             `json:"port_min"`
+	PortMax       int                             `json:"port_max"`
+	RemoteCIDR    string                          `json:"remote_cidr,omitempty"`
+	RemoteGroupID string                          `json:"remote_group_id,omitempty"`
+}
+
+// SecurityGroup is a set of rules allowing traffic of the instances of a
+// tenant.  The traffic of an instance in security groups which is not
+// allowed by any of the rules of its groups is dropped.  The names of the
+// security groups are unique among the security groups of a tenant.
+type SecurityGroup struct {
+	ID          string              `json:"id"`
+	TenantID    string              `json:"tenant_id"`
+	Name        string              `json:"name"`
+	Description string              `json:"description"`
+	Rules       []SecurityGroupRule `json:"rules"`
+	CreateTime  time.Time           `json:"create_time"`
+}
+
+// SortedSecurityGroupsByName implements sort.Interface for SecurityGroup by
+// Name.
+type SortedSecurityGroupsByName []SecurityGroup
+
+func (s SortedSecurityGroupsByName) Len() int           { return len(s) }
+func (s SortedSecurityGroupsByName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s SortedSecurityGroupsByName) Less(i, j int) bool { return s[i].Name < s[j].Name }
+
+// ScalingMetric is an instance statistic driving a scaling group.
+type ScalingMetric string
+
+const (
+	// ScalingCPU is the CPU usage of the instances in percent of their
+	// VCPUs.
+	ScalingCPU ScalingMetric = "cpu"
+
+	// ScalingMemory is the memory usage of the instances in percent of
+	// the memory they requested.
+	ScalingMemory ScalingMetric = "memory"
+)
+
+// ScalingRule changes the desired instances of a scaling group by Step
+// when the average of Metric over the running instances of the group and
+// the last Period seconds crosses Threshold, in percent.
+type ScalingRule struct {
+	Metric    ScalingMetric `json:"metric"`
+	Threshold int           `json:"threshold"`
+	Period    int           `json:"period"`
+	Step      int           `json:"step"`
+}
+
+// ScalingGroup keeps DesiredInstances instances of a workload running,
+// between MinInstances and MaxInstances.  The group scales out when the
+// metric of ScaleOut goes above its threshold and in when the metric of
+// ScaleIn goes below it, at most once per Cooldown seconds.
+type ScalingGroup struct {
+	ID               string       `json:"id"`
+	TenantID         string       `json:"tenant_id"`
+	Name             string       `json:"name"`
+	WorkloadID       string       `json:"workload_id"`
+	MinInstances     int          `json:"min_instances"`
+	MaxInstances     int          `json:"max_instances"`
+	DesiredInstances int          `json:"desired_instances"`
+	ScaleOut         *ScalingRule `json:"scale_out,omitempty"`
+	ScaleIn          *ScalingRule `json:"scale_in,omitempty"`
+	Cooldown         int          `json:"cooldown"`
+	CreateTime       time.Time    `json:"create_time"`
+	LastScale        time.Time    `json:"last_scale"`
+	Links            []Link       `json:"links,omitempty"`
+}
+
+// SortedScalingGroupsByID implements sort.Interface for ScalingGroup by ID.
+type SortedScalingGroupsByID []ScalingGroup
+
+func (s SortedScalingGroupsByID) Len() int           { return len(s) }
+func (s SortedScalingGroupsByID) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s SortedScalingGroupsByID) Less(i, j int) bool { return s[i].ID < s[j].ID }
+
+// ScalingGroupStatus is a scaling group with its instances and the last
+// averages of the metrics of its running instances.
+type ScalingGroupStatus struct {
+	ScalingGroup
+	Instances []string              `json:"instances"`
+	Running   int                   `json:"running"`
+	Metrics   map[ScalingMetric]int `json:"metrics"`
+}
+
+// ListScalingGroupsResponse lists the scaling groups of a tenant.
+type ListScalingGroupsResponse struct {
+	ScalingGroups []ScalingGroup `json:"scaling_groups"`
+}
+
+// ScalingActivity records the instances a scaling group started or
+// deleted to move from From to To instances, and why.
+type ScalingActivity struct {
+	GroupID   string    `json:"group_id"`
+	Timestamp time.Time `json:"timestamp"`
+	From      int       `json:"from"`
+	To        int       `json:"to"`
+	Reason    string    `json:"reason"`
+}
+
+// ListScalingActivitiesResponse lists the scaling history of a group,
+// oldest first.
+type ListScalingActivitiesResponse struct {
+	Activities []ScalingActivity `json:"activities"`
+}
+
 // LogEntry stores information about events.
 type LogEntry struct {
 	Timestamp time.Time `json:"time_stamp"`
@@ -361,6 +807,114 @@ type CiaoUsageHistory struct {
 	Usages []CiaoUsage `json:"usage"`
 }
 
+// InstanceUsage records the resources an instance consumed while running
+// during an hour.  Resources are metered in units times hours, an
+// instance with 2 vCPUs running for half an hour consumes 1 vCPU hour.
+type InstanceUsage struct {
+	InstanceID      string    `json:"instance_id"`
+	TenantID        string    `json:"tenant_id"`
+	WorkloadID      string    `json:"workload_id"`
+	Hour            time.Time `json:"hour"`
+	Hours           float64   `json:"hours"`
+	VCPUHours       float64   `json:"vcpu_hours"`
+	MemoryGBHours   float64   `json:"memory_gb_hours"`
+	DiskGBHours     float64   `json:"disk_gb_hours"`
+	VolumeGBHours   float64   `json:"volume_gb_hours"`
+	ExternalIPHours float64   `json:"external_ip_hours"`
+}
+
+// CiaoInstanceUsages represents the unmarshalled version of the contents
+// of a v2.1/usage response.  It contains the hourly usage records of the
+// instances over a given period of time.
+type CiaoInstanceUsages struct {
+	Usages []InstanceUsage `json:"usages"`
+}
+
+// AuditRecord records a mutating API call.  Outcome is success, denied
+// when the caller was not authenticated or not allowed, or failure.
+type AuditRecord struct {
+	Timestamp time.Time `json:"timestamp"`
+	RequestID string    `json:"request_id"`
+	UserID    string    `json:"user_id"`
+	UserName  string    `json:"user_name"`
+	ProjectID string    `json:"project_id"`
+	Roles     []string  `json:"roles"`
+	SourceIP  string    `json:"source_ip"`
+	Service   string    `json:"service"`
+	Method    string    `json:"method"`
+	Resource  string    `json:"resource"`
+	Status    int       `json:"status"`
+	Outcome   string    `json:"outcome"`
+	LatencyMS float64   `json:"latency_ms"`
+}
+
+// Audit outcomes
+const (
+	AuditSuccess = "success"
+	AuditDenied  = "denied"
+	AuditFailure = "failure"
+)
+
+// AuditFilter selects audit records.  Empty fields match any record,
+// Resource matches the records of a resource and of its sub-resources.
+type AuditFilter struct {
+	Start     time.Time
+	End       time.Time
+	UserID    string
+	ProjectID string
+	Resource  string
+	Outcome   string
+	Limit     int
+}
+
+// Match tells if the record is selected by the filter, ignoring Limit.
+func (f AuditFilter) Match(r AuditRecord) bool {
+	if !f.Start.IsZero() && r.Timestamp.Before(f.Start) {
+		return false
+	}
+
+	if !f.End.IsZero() && !r.Timestamp.Before(f.End) {
+		return false
+	}
+
+	if f.UserID != "" && r.UserID != f.UserID {
+		return false
+	}
+
+	if f.ProjectID != "" && r.ProjectID != f.ProjectID {
+		return false
+	}
+
+	if f.Resource != "" && !strings.HasPrefix(r.Resource, f.Resource) {
+		return false
+	}
+
+	return f.Outcome == "" || r.Outcome == f.Outcome
+}
+
+// CiaoAuditLog represents the unmarshalled version of the contents of a
+// v2.1/audit response, the matching records newest first.
+type CiaoAuditLog struct {
+	Records []AuditRecord `json:"records"`
+}
+
+// RateLimitCounter counts the API calls of a tenant in an operation class
+// that the rate limits allowed and refused.  Tokens is what is left of the
+// burst of the tenant in the class.
+type RateLimitCounter struct {
+	TenantID string  `json:"tenant_id"`
+	Class    string  `json:"class"`
+	Allowed  uint64  `json:"allowed"`
+	Limited  uint64  `json:"limited"`
+	Tokens   float64 `json:"tokens"`
+}
+
+// CiaoRateLimits represents the unmarshalled version of the contents of a
+// v2.1/ratelimits response.
+type CiaoRateLimits struct {
+	Counters []RateLimitCounter `json:"counters"`
+}
+
 // CiaoCNCISubnet contains subnet information for a CNCI.
 type CiaoCNCISubnet struct {
 	Subnet string `json:"subnet_cidr"`
@@ -447,10 +1001,11 @@ type CNCIDetail struct {
 
 // CiaoServersAction represents the unmarshalled version of the contents of a
 // v2.1/servers/action request.  It contains an action to be performed on
-// one or more instances.
+// one or more instances, given by their IDs or by the tags they all have.
 type CiaoServersAction struct {
 	Action    string   `json:"action"`
 	ServerIDs []string `json:"servers"`
+	Tags      []string `json:"tags,omitempty"`
 }
 
 // CiaoTraceSummary contains information about a specific SSNTP Trace label.
@@ -520,6 +1075,93 @@ func NewCiaoEvents() (events CiaoEvents) {
 	return
 }
 
+// StreamEventType identifies the kind of change a StreamEvent reports.
+type StreamEventType string
+
+const (
+	// InstanceStateEvent reports an instance moving to a new state.
+	InstanceStateEvent StreamEventType = "instance_state"
+
+	// InstanceDeletedEvent reports an instance being removed.
+	InstanceDeletedEvent StreamEventType = "instance_deleted"
+
+	// InstanceStartFailureEvent reports a launcher failing to start an instance.
+	InstanceStartFailureEvent StreamEventType = "instance_start_failure"
+
+	// InstanceStopFailureEvent reports a launcher failing to stop an instance.
+	InstanceStopFailureEvent StreamEventType = "instance_stop_failure"
+
+	// InstanceRestartFailureEvent reports a launcher failing to restart an instance.
+	InstanceRestartFailureEvent StreamEventType = "instance_restart_failure"
+
+	// InstanceRestartedEvent reports a launcher restarting an instance
+	// following its restart policy.
+	InstanceRestartedEvent StreamEventType = "instance_restarted"
+
+	// InstanceRescheduledEvent reports an instance lost with its node
+	// being started again on another node.
+	InstanceRescheduledEvent StreamEventType = "instance_rescheduled"
+
+	// InstanceHealthEvent reports the health of an instance changing.
+	InstanceHealthEvent StreamEventType = "instance_health"
+
+	// NodeConnectedEvent reports a node joining the cluster.
+	NodeConnectedEvent StreamEventType = "node_connected"
+
+	// NodeDisconnectedEvent reports a node leaving the cluster.
+	NodeDisconnectedEvent StreamEventType = "node_disconnected"
+
+	// VolumeAttachedEvent reports a volume being attached to an instance.
+	VolumeAttachedEvent StreamEventType = "volume_attached"
+
+	// VolumeDetachedEvent reports a volume being detached from an instance.
+	VolumeDetachedEvent StreamEventType = "volume_detached"
+
+	// VolumeAttachFailureEvent reports a launcher failing to attach a volume.
+	VolumeAttachFailureEvent StreamEventType = "volume_attach_failure"
+
+	// VolumeDetachFailureEvent reports a launcher failing to detach a volume.
+	VolumeDetachFailureEvent StreamEventType = "volume_detach_failure"
+
+	// ExternalIPMappedEvent reports an external IP being mapped to an instance.
+	ExternalIPMappedEvent StreamEventType = "external_ip_mapped"
+
+	// ExternalIPUnmappedEvent reports an external IP being unmapped from an instance.
+	ExternalIPUnmappedEvent StreamEventType = "external_ip_unmapped"
+
+	// ExternalIPFailureEvent reports a CNCI failing to map or unmap an external IP.
+	ExternalIPFailureEvent StreamEventType = "external_ip_failure"
+)
+
+// StreamEvent is a typed event pushed to the clients of the event
+// stream as it happens.  Only the fields relevant to Type are set.
+type StreamEvent struct {
+	Type       StreamEventType `json:"type"`
+	Timestamp  time.Time       `json:"timestamp"`
+	TenantID   string          `json:"tenant_id,omitempty"`
+	InstanceID string          `json:"instance_id,omitempty"`
+	NodeID     string          `json:"node_id,omitempty"`
+	VolumeID   string          `json:"volume_id,omitempty"`
+	ExternalIP string          `json:"external_ip,omitempty"`
+	From       InstanceState   `json:"from,omitempty"`
+	To         InstanceState   `json:"to,omitempty"`
+	Message    string          `json:"message,omitempty"`
+}
+
+// CiaoBackupValidation represents the unmarshalled version of the
+// response to a v2.1/backup/validate request.  Warnings list the
+// differences between the backup and the running cluster that a restore
+// would lose or bring back.
+type CiaoBackupValidation struct {
+	Created           time.Time `json:"created"`
+	Files             int       `json:"files"`
+	SchemaVersion     int       `json:"schema_version"`
+	PendingMigrations int       `json:"pending_migrations"`
+	Tenants           int       `json:"tenants"`
+	Instances         int       `json:"instances"`
+	Warnings          []string  `json:"warnings"`
+}
+
 var (
 	// ErrQuota is returned when a resource limit is exceeded.
 	ErrQuota = errors.New("Over Quota")
@@ -566,6 +1208,60 @@ var (
 	// ErrInstanceMapped is returned when an instance cannot be deleted
 	// due to having an external IP assigned to it.
 	ErrInstanceMapped = errors.New("Unmap the external IP prior to deletion")
+
+	// ErrWorkloadNotFound is returned when a workload is unknown or not
+	// visible to the tenant.
+	ErrWorkloadNotFound = errors.New("Workload not found")
+
+	// ErrWorkloadOwner is returned when a tenant modifies a workload it
+	// does not own.
+	ErrWorkloadOwner = errors.New("You are not the workload owner")
+
+	// ErrWorkloadInUse is returned when a workload still has instances
+	ErrWorkloadInUse = errors.New("Workload has running instances")
+
+	// ErrDuplicateTenant is returned when creating a tenant which exists.
+	ErrDuplicateTenant = errors.New("Tenant already exists")
+
+	// ErrTenantInUse is returned when deleting a tenant which still owns
+	// instances, volumes, external IPs or workloads.
+	ErrTenantInUse = errors.New("Tenant has resources in use")
+
+	// ErrUnknownQuota is returned when updating an unknown quota.
+	ErrUnknownQuota = errors.New("Unknown quota")
+
+	// ErrNotAdmin is returned when a tenant calls an admin only API.
+	ErrNotAdmin = errors.New("Admin privileges required")
+
+	// ErrScheduleNotFound is returned when a schedule is not found.
+	ErrScheduleNotFound = errors.New("Schedule not found")
+
+	// ErrScalingGroupNotFound is returned when a scaling group is not
+	// found.
+	ErrScalingGroupNotFound = errors.New("Scaling group not found")
+
+	// ErrKeypairNotFound is returned when a keypair is not found.
+	ErrKeypairNotFound = errors.New("Keypair not found")
+
+	// ErrDuplicateKeypair is returned when adding a keypair whose name
+	// is already used by a keypair of the user.
+	ErrDuplicateKeypair = errors.New("Keypair by that name already exists")
+
+	// ErrSecurityGroupNotFound is returned when a security group is not
+	// found.
+	ErrSecurityGroupNotFound = errors.New("Security group not found")
+
+	// ErrDuplicateSecurityGroup is returned when adding a security group
+	// whose name is already used by a security group of the tenant.
+	ErrDuplicateSecurityGroup = errors.New("Security group by that name already exists")
+
+	// ErrSecurityGroupRuleNotFound is returned when a security group
+	// rule is not found.
+	ErrSecurityGroupRuleNotFound = errors.New("Security group rule not found")
+
+	// ErrSecurityGroupInUse is returned when deleting a security group
+	// which has instances or is the remote group of rules.
+	ErrSecurityGroupInUse = errors.New("Security group in use")
 )
 
 // Link provides a url and relationship for a resource.
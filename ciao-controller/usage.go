@@ -0,0 +1,191 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/01org/ciao/ciao-controller/types"
+	osIdentity "github.com/01org/ciao/openstack/identity"
+	"github.com/golang/glog"
+)
+
+// usageCSVHeader names the columns of the csv usage export.
+var usageCSVHeader = []string{
+	"instance_id",
+	"tenant_id",
+	"workload_id",
+	"hour",
+	"hours",
+	"vcpu_hours",
+	"memory_gb_hours",
+	"disk_gb_hours",
+	"volume_gb_hours",
+	"external_ip_hours",
+}
+
+// parseUsageTime parses the start or end of a usage export, given as
+// RFC3339 times or dates.
+func parseUsageTime(value string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return t, nil
+	}
+
+	return time.Parse("2006-01-02", value)
+}
+
+// usageExportPeriod returns the period of a usage export, the last day
+// unless the request sets start and end.
+func usageExportPeriod(r *http.Request) (time.Time, time.Time, error) {
+	values := r.URL.Query()
+
+	end := time.Now().UTC()
+	if v := values.Get("end"); v != "" {
+		t, err := parseUsageTime(v)
+		if err != nil {
+			return end, end, fmt.Errorf("invalid end time %q", v)
+		}
+		end = t
+	}
+
+	start := end.Add(-24 * time.Hour)
+	if v := values.Get("start"); v != "" {
+		t, err := parseUsageTime(v)
+		if err != nil {
+			return start, end, fmt.Errorf("invalid start time %q", v)
+		}
+		start = t
+	}
+
+	if !start.Before(end) {
+		return start, end, fmt.Errorf("start %v is not before end %v", start, end)
+	}
+
+	return start, end, nil
+}
+
+func formatUsage(v float64) string {
+	return strconv.FormatFloat(v, 'f', 6, 64)
+}
+
+func writeUsageCSV(w http.ResponseWriter, usages []types.InstanceUsage) error {
+	cw := csv.NewWriter(w)
+
+	err := cw.Write(usageCSVHeader)
+	if err != nil {
+		return err
+	}
+
+	for _, u := range usages {
+		err = cw.Write([]string{
+			u.InstanceID,
+			u.TenantID,
+			u.WorkloadID,
+			u.Hour.UTC().Format(time.RFC3339),
+			formatUsage(u.Hours),
+			formatUsage(u.VCPUHours),
+			formatUsage(u.MemoryGBHours),
+			formatUsage(u.DiskGBHours),
+			formatUsage(u.VolumeGBHours),
+			formatUsage(u.ExternalIPHours),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+
+	return cw.Error()
+}
+
+// usageExportHandler exports the hourly usage records of the instances,
+// as json or as csv when the format query parameter or the Accept header
+// asks for it.
+type usageExportHandler struct {
+	*controller
+}
+
+// @Title usageExport
+// @Description Exports the hourly usage records of the instances between start and end, optionally of a single tenant.  Requires admin privileges.
+// @Accept  json
+// @Success 200 {object} types.CiaoInstanceUsages "Returns the hourly usage records, as csv when format=csv."
+// @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
+// @Failure 500 {object} HTTPReturnErrorCode "The response contains the corresponding message and 50x corresponding code."
+// @Router /v2.1/usage [get]
+// @Resource /v2.1/usage
+func (h usageExportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !osIdentity.Privileged(r.Context()) {
+		http.Error(w, "Admin privileges required", http.StatusForbidden)
+		return
+	}
+
+	start, end, err := usageExportPeriod(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" && strings.Contains(r.Header.Get("Accept"), "text/csv") {
+		format = "csv"
+	}
+
+	if format != "" && format != "csv" && format != "json" {
+		http.Error(w, fmt.Sprintf("unsupported format %q", format), http.StatusBadRequest)
+		return
+	}
+
+	usages, err := h.ds.GetInstanceUsage(r.URL.Query().Get("tenant"), start, end)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if format == "csv" {
+		name := fmt.Sprintf("ciao-usage-%s-%s.csv", start.UTC().Format("20060102T15"), end.UTC().Format("20060102T15"))
+
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+		w.WriteHeader(http.StatusOK)
+
+		err = writeUsageCSV(w, usages)
+		if err != nil {
+			glog.Errorf("Unable to write usage export: %v", err)
+		}
+		return
+	}
+
+	if usages == nil {
+		usages = []types.InstanceUsage{}
+	}
+
+	b, err := json.Marshal(types.CiaoInstanceUsages{Usages: usages})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
@@ -0,0 +1,160 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"text/template"
+
+	"github.com/01org/ciao/ciao-controller/types"
+	"gopkg.in/yaml.v2"
+)
+
+// userDataVars are the variables of the config template of a workload
+// when rendered for an instance.
+type userDataVars struct {
+	// Index is the index of the instance among those started together,
+	// from 0 to Count - 1.
+	Index int
+	Count int
+
+	InstanceID string
+	TenantID   string
+	IPAddress  string
+	Name       string
+
+	// Parameters are the values of the parameters of the workload.
+	Parameters map[string]string
+
+	// KeyName and PublicKey are the keypair injected in the metadata
+	// of the instance, if any.
+	KeyName   string
+	PublicKey string
+
+	// SecurityGroups are the IDs of the security groups of the
+	// instance, if any.
+	SecurityGroups []string
+}
+
+// parameterName matches the parameter names usable as template fields,
+// as in {{.Parameters.name}}.
+var parameterName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func parseUserData(wl *types.Workload) (*template.Template, error) {
+	return template.New(wl.ID).Option("missingkey=error").Parse(wl.Config)
+}
+
+// validateWorkloadParameters checks the names of the parameters of a
+// workload, and that its config is a template of them.
+func validateWorkloadParameters(req types.Workload) error {
+	if len(req.Parameters) == 0 {
+		return nil
+	}
+
+	values := make(map[string]string)
+
+	for _, p := range req.Parameters {
+		if _, ok := values[p.Name]; ok || !parameterName.MatchString(p.Name) {
+			return types.ErrBadRequest
+		}
+
+		values[p.Name] = p.Default
+	}
+
+	tmpl, err := parseUserData(&req)
+	if err != nil {
+		return types.ErrBadRequest
+	}
+
+	var b bytes.Buffer
+	err = tmpl.Execute(&b, userDataVars{Count: 1, Parameters: values})
+	if err != nil {
+		return types.ErrBadRequest
+	}
+
+	return nil
+}
+
+// workloadParameters returns the values of the parameters of a workload,
+// given values or defaults.  All the required parameters must be given,
+// and only parameters of the workload.
+func workloadParameters(wl *types.Workload, values map[string]string) (map[string]string, error) {
+	params := make(map[string]string)
+
+	for _, p := range wl.Parameters {
+		v, ok := values[p.Name]
+		if !ok {
+			if p.Required {
+				return nil, &types.ParameterError{
+					WorkloadID: wl.ID,
+					Reason:     fmt.Sprintf("missing parameter %q", p.Name),
+				}
+			}
+			v = p.Default
+		}
+
+		params[p.Name] = v
+	}
+
+	var unknown []string
+	for name := range values {
+		if _, ok := params[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, &types.ParameterError{
+			WorkloadID: wl.ID,
+			Reason:     fmt.Sprintf("unknown parameters %q", unknown),
+		}
+	}
+
+	return params, nil
+}
+
+// renderUserData renders the config of a workload with parameters for an
+// instance.  The result must still be a YAML document.
+func renderUserData(wl *types.Workload, vars userDataVars) (string, error) {
+	if len(wl.Parameters) == 0 {
+		return wl.Config, nil
+	}
+
+	tmpl, err := parseUserData(wl)
+	if err != nil {
+		return "", &types.ParameterError{WorkloadID: wl.ID, Reason: err.Error()}
+	}
+
+	var b bytes.Buffer
+	err = tmpl.Execute(&b, vars)
+	if err != nil {
+		return "", &types.ParameterError{WorkloadID: wl.ID, Reason: err.Error()}
+	}
+
+	var doc interface{}
+	err = yaml.Unmarshal(b.Bytes(), &doc)
+	if err != nil {
+		return "", &types.ParameterError{
+			WorkloadID: wl.ID,
+			Reason:     fmt.Sprintf("rendered config is not YAML: %v", err),
+		}
+	}
+
+	return b.String(), nil
+}
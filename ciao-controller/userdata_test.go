@@ -0,0 +1,134 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/01org/ciao/ciao-controller/types"
+)
+
+const templatedConfig = `---
+#cloud-config
+hostname: {{.Parameters.prefix}}-{{.Index}}
+write_files:
+  - path: /etc/motd
+    content: "{{.Parameters.greeting}} from {{.InstanceID}} of {{.TenantID}} at {{.IPAddress}}"
+...
+`
+
+func templatedWorkload() *types.Workload {
+	return &types.Workload{
+		ID:     "templated",
+		Config: templatedConfig,
+		Parameters: []types.WorkloadParameter{
+			{Name: "prefix", Required: true},
+			{Name: "greeting", Default: "hello"},
+		},
+	}
+}
+
+func TestValidateWorkloadParameters(t *testing.T) {
+	tests := []struct {
+		name   string
+		params []types.WorkloadParameter
+		config string
+		valid  bool
+	}{
+		{"no parameters", nil, "{{.Garbage", true},
+		{"parameters", templatedWorkload().Parameters, templatedConfig, true},
+		{"invalid name", []types.WorkloadParameter{{Name: "a-b"}}, "", false},
+		{"duplicate name", []types.WorkloadParameter{{Name: "a"}, {Name: "a"}}, "", false},
+		{"parse error", []types.WorkloadParameter{{Name: "a"}}, "{{.Parameters.a", false},
+		{"unknown parameter", []types.WorkloadParameter{{Name: "a"}}, "{{.Parameters.b}}", false},
+		{"unknown variable", []types.WorkloadParameter{{Name: "a"}}, "{{.Node}}", false},
+	}
+
+	for _, test := range tests {
+		err := validateWorkloadParameters(types.Workload{
+			Config:     test.config,
+			Parameters: test.params,
+		})
+		if test.valid && err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		} else if !test.valid && err != types.ErrBadRequest {
+			t.Errorf("%s: expected %v, got %v", test.name, types.ErrBadRequest, err)
+		}
+	}
+}
+
+func TestWorkloadParameters(t *testing.T) {
+	wl := templatedWorkload()
+
+	params, err := workloadParameters(wl, map[string]string{"prefix": "web"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params["prefix"] != "web" || params["greeting"] != "hello" {
+		t.Errorf("unexpected parameters %v", params)
+	}
+
+	_, err = workloadParameters(wl, map[string]string{"greeting": "hi"})
+	if _, ok := err.(*types.ParameterError); !ok {
+		t.Errorf("missing required parameter accepted: %v", err)
+	}
+
+	_, err = workloadParameters(wl, map[string]string{"prefix": "web", "port": "80"})
+	if _, ok := err.(*types.ParameterError); !ok {
+		t.Errorf("unknown parameter accepted: %v", err)
+	}
+}
+
+func TestRenderUserData(t *testing.T) {
+	wl := templatedWorkload()
+
+	vars := userDataVars{
+		Index:      2,
+		Count:      3,
+		InstanceID: "instance",
+		TenantID:   "tenant",
+		IPAddress:  "172.16.0.2",
+		Parameters: map[string]string{"prefix": "web", "greeting": "hi"},
+	}
+
+	config, err := renderUserData(wl, vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `---
+#cloud-config
+hostname: web-2
+write_files:
+  - path: /etc/motd
+    content: "hi from instance of tenant at 172.16.0.2"
+...
+`
+	if config != expected {
+		t.Errorf("unexpected config:\n%s", config)
+	}
+
+	vars.Parameters["greeting"] = `"broken`
+	_, err = renderUserData(wl, vars)
+	if _, ok := err.(*types.ParameterError); !ok {
+		t.Errorf("invalid YAML accepted: %v", err)
+	}
+
+	wl.Parameters = nil
+	config, err = renderUserData(wl, vars)
+	if err != nil || config != templatedConfig {
+		t.Errorf("config without parameters changed: %v", err)
+	}
+}
@@ -15,6 +15,8 @@
 package main
 
 import (
+	"sort"
+
 	"github.com/01org/ciao/ciao-controller/types"
 	"github.com/01org/ciao/payloads"
 	"github.com/01org/ciao/ssntp/uuid"
@@ -135,6 +137,72 @@ func validateWorkloadRequest(req types.Workload) error {
 		}
 	}
 
+	err := validateRestartPolicy(req.RestartPolicy)
+	if err != nil {
+		return err
+	}
+
+	err = validateHealthCheck(req.HealthCheck)
+	if err != nil {
+		return err
+	}
+
+	return validateWorkloadParameters(req)
+}
+
+// imageToStorage turns the image ID of a workload request into a
+// bootable workload storage resource.
+func imageToStorage(req *types.Workload) error {
+	if req.ImageID == "" {
+		return nil
+	}
+
+	// validate that the image id is at least valid
+	// uuid4.
+	_, err := uuid.Parse(req.ImageID)
+	if err != nil {
+		return err
+	}
+
+	storage := types.StorageResource{
+		Bootable:   true,
+		Ephemeral:  true,
+		SourceType: types.ImageService,
+		SourceID:   req.ImageID,
+	}
+
+	req.ImageID = ""
+	req.Storage = append(req.Storage, storage)
+
+	return nil
+}
+
+// validateWorkloadVisibility fills in the owner and visibility of a
+// workload.  Admin workloads are public unless they are given an owner,
+// tenant workloads are always private.
+func validateWorkloadVisibility(tenantID string, req *types.Workload) error {
+	if tenantID != "" {
+		req.TenantID = tenantID
+		req.Visibility = types.Private
+		return nil
+	}
+
+	switch req.Visibility {
+	case "":
+		if req.TenantID != "" {
+			req.Visibility = types.Private
+		} else {
+			req.Visibility = types.Public
+		}
+	case types.Public:
+	case types.Private:
+		if req.TenantID == "" {
+			return types.ErrBadRequest
+		}
+	default:
+		return types.ErrBadRequest
+	}
+
 	return nil
 }
 
@@ -144,28 +212,109 @@ func (c *controller) CreateWorkload(req types.Workload) (types.Workload, error)
 		return req, err
 	}
 
+	err = validateWorkloadVisibility("", &req)
+	if err != nil {
+		return req, err
+	}
+
 	// create a workload storage resource for this new workload.
-	if req.ImageID != "" {
-		// validate that the image id is at least valid
-		// uuid4.
-		_, err = uuid.Parse(req.ImageID)
-		if err != nil {
-			return req, err
-		}
+	err = imageToStorage(&req)
+	if err != nil {
+		return req, err
+	}
+
+	req.ID = uuid.Generate().String()
+
+	err = c.ds.AddWorkload(req)
+	return req, err
+}
 
-		storage := types.StorageResource{
-			Bootable:   true,
-			Ephemeral:  true,
-			SourceType: types.ImageService,
-			SourceID:   req.ImageID,
+// getVisibleWorkload retrieves a workload which is not internal and is
+// visible to the tenant, or to an admin if tenantID is empty.
+func (c *controller) getVisibleWorkload(tenantID string, ID string) (*types.Workload, error) {
+	wl, err := c.ds.GetWorkload(ID)
+	if err != nil || isCNCIWorkload(wl) || !wl.VisibleTo(tenantID) {
+		return nil, types.ErrWorkloadNotFound
+	}
+
+	return wl, nil
+}
+
+// ListWorkloads returns the workloads visible to a tenant, or all the
+// workloads if tenantID is empty.
+func (c *controller) ListWorkloads(tenantID string) ([]types.Workload, error) {
+	wls, err := c.ds.GetWorkloads()
+	if err != nil {
+		return nil, err
+	}
+
+	var workloads []types.Workload
+	for _, wl := range wls {
+		if wl.VisibleTo(tenantID) {
+			workloads = append(workloads, *wl)
 		}
+	}
 
-		req.ImageID = ""
-		req.Storage = append(req.Storage, storage)
+	sort.Sort(types.SortedWorkloadsByID(workloads))
+
+	return workloads, nil
+}
+
+// ShowWorkload returns a workload visible to the tenant.
+func (c *controller) ShowWorkload(tenantID string, ID string) (types.Workload, error) {
+	wl, err := c.getVisibleWorkload(tenantID, ID)
+	if err != nil {
+		return types.Workload{}, err
 	}
 
-	req.ID = uuid.Generate().String()
+	return *wl, nil
+}
 
-	err = c.ds.AddWorkload(req)
+// UpdateWorkload replaces the definition of a workload.  Tenants may
+// only update their own workloads.
+func (c *controller) UpdateWorkload(tenantID string, req types.Workload) (types.Workload, error) {
+	wl, err := c.getVisibleWorkload(tenantID, req.ID)
+	if err != nil {
+		return req, err
+	}
+
+	if tenantID != "" && wl.TenantID != tenantID {
+		return req, types.ErrWorkloadOwner
+	}
+
+	ID := req.ID
+	req.ID = ""
+	err = validateWorkloadRequest(req)
+	if err != nil {
+		return req, err
+	}
+	req.ID = ID
+
+	err = validateWorkloadVisibility(tenantID, &req)
+	if err != nil {
+		return req, err
+	}
+
+	err = imageToStorage(&req)
+	if err != nil {
+		return req, err
+	}
+
+	err = c.ds.UpdateWorkload(req)
 	return req, err
 }
+
+// DeleteWorkload removes a workload which has no instances.  Tenants
+// may only delete their own workloads.
+func (c *controller) DeleteWorkload(tenantID string, ID string) error {
+	wl, err := c.getVisibleWorkload(tenantID, ID)
+	if err != nil {
+		return err
+	}
+
+	if tenantID != "" && wl.TenantID != tenantID {
+		return types.ErrWorkloadOwner
+	}
+
+	return c.ds.DeleteWorkload(ID)
+}
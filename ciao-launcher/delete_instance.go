@@ -29,6 +29,11 @@ func deleteVnic(instanceDir string, conn serverConn) {
 		return
 	}
 
+	cfg.Security = nil
+	if err = filterVnic(cfg); err != nil {
+		glog.Warningf("Unable to remove vnic filter: %s", err)
+	}
+
 	vnicCfg, err := createVnicCfg(cfg)
 	if err != nil {
 		glog.Warningf("Unable to create vnicCfg: %s", err)
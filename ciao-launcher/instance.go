@@ -17,6 +17,7 @@
 package main
 
 import (
+	"os"
 	"path"
 	"sync"
 	"time"
@@ -48,6 +49,20 @@ type instanceData struct {
 	rcvStamp       time.Time
 	st             *startTimes
 	storageDriver  storage.BlockDriver
+
+	// stopping is set when the instance is stopped or deleted, its
+	// exit is then expected and not subject to the restart policy.
+	stopping bool
+
+	// unconfirmed is set when the launcher starts monitoring an existing
+	// instance, until the instance is seen running.  Only instances with
+	// the always restart policy are restarted if they are not.
+	unconfirmed bool
+
+	// restarts counts the automatic restarts since the instance was last
+	// started or restarted by the controller.
+	restarts     int
+	restartTimer <-chan time.Time
 }
 
 type insStartCmd struct {
@@ -61,6 +76,7 @@ type insRestartCmd struct{}
 type insDeleteCmd struct {
 	suicide bool
 	running ovsRunningState
+	reason  payloads.InstanceDeletedReason
 }
 type insStopCmd struct{}
 type insMonitorCmd struct{}
@@ -71,6 +87,9 @@ type insAttachVolumeCmd struct {
 type insDetachVolumeCmd struct {
 	volumeUUID string
 }
+type insSecurityGroupsCmd struct {
+	security payloads.InstanceSecurity
+}
 
 /*
 This functions asks the server loop to kill the instance.  An instance
@@ -129,6 +148,8 @@ func (id *instanceData) startCommand(cmd *insStartCmd) {
 		return
 	}
 	id.st = st
+	id.stopping = false
+	id.restarts = 0
 
 	id.connectedCh = make(chan struct{})
 	id.monitorCloseCh = make(chan struct{})
@@ -165,12 +186,102 @@ func (id *instanceData) restartCommand(cmd *insRestartCmd) {
 		return
 	}
 
+	id.stopping = false
+	id.restarts = 0
+	id.restartTimer = nil
+
+	id.connectedCh = make(chan struct{})
+	id.monitorCloseCh = make(chan struct{})
+	id.monitorCh = id.vm.monitorVM(id.monitorCloseCh, id.connectedCh, &id.instanceWg, false)
+}
+
+// restartDelay tells if the restart policy of the instance allows it to be
+// restarted after it exited, and after which delay.  The delay, at least
+// minRestartBackoff, doubles with each restart, up to maxRestartBackoff.
+func (id *instanceData) restartDelay() (time.Duration, bool) {
+	policy := id.cfg.Restart
+
+	if id.stopping {
+		return 0, false
+	}
+
+	switch policy.Condition {
+	case payloads.RestartAlways:
+	case payloads.RestartOnFailure:
+		if id.unconfirmed {
+			return 0, false
+		}
+		if policy.MaxRestarts > 0 && id.restarts >= policy.MaxRestarts {
+			glog.Warningf("Instance %s restarted %d times, giving up", id.instance, id.restarts)
+			return 0, false
+		}
+	default:
+		return 0, false
+	}
+
+	delay := time.Duration(policy.Backoff) * time.Second
+	if delay < minRestartBackoff {
+		delay = minRestartBackoff
+	}
+	for i := 0; i < id.restarts && delay < maxRestartBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxRestartBackoff {
+		delay = maxRestartBackoff
+	}
+
+	return delay, true
+}
+
+func (id *instanceData) sendInstanceRestartedEvent() {
+	var event payloads.EventInstanceRestarted
+
+	event.InstanceRestarted.InstanceUUID = id.instance
+	event.InstanceRestarted.Restarts = id.restarts
+
+	payload, err := yaml.Marshal(&event)
+	if err != nil {
+		glog.Errorf("Unable to Marshall InstanceRestarted %v", err)
+		return
+	}
+
+	_, err = id.ac.conn.SendEvent(ssntp.InstanceRestarted, payload)
+	if err != nil {
+		glog.Errorf("Failed to send event command %v", err)
+		return
+	}
+}
+
+// autoRestart restarts an instance that exited on its own, following its
+// restart policy.
+func (id *instanceData) autoRestart() {
+	if id.shuttingDown || id.monitorCh != nil {
+		return
+	}
+
+	id.restarts++
+	glog.Infof("Restarting instance %s, restart %d", id.instance, id.restarts)
+
+	restartErr := processRestart(id.instanceDir, id.vm, id.ac.conn, id.cfg)
+	if restartErr != nil {
+		glog.Errorf("Unable to restart instance %s[%s]: %v", id.instance,
+			string(restartErr.code), restartErr.err)
+		restartErr.send(id.ac.conn, id.instance)
+
+		if delay, ok := id.restartDelay(); ok {
+			id.restartTimer = time.After(delay)
+		}
+		return
+	}
+
 	id.connectedCh = make(chan struct{})
 	id.monitorCloseCh = make(chan struct{})
 	id.monitorCh = id.vm.monitorVM(id.monitorCloseCh, id.connectedCh, &id.instanceWg, false)
+	id.sendInstanceRestartedEvent()
 }
 
 func (id *instanceData) monitorCommand(cmd *insMonitorCmd) {
+	id.unconfirmed = true
 	id.connectedCh = make(chan struct{})
 	id.monitorCloseCh = make(chan struct{})
 	id.monitorCh = id.vm.monitorVM(id.monitorCloseCh, id.connectedCh, &id.instanceWg, true)
@@ -191,13 +302,15 @@ func (id *instanceData) stopCommand(cmd *insStopCmd) {
 		return
 	}
 	glog.Infof("Powerdown %s", id.instance)
+	id.stopping = true
 	id.monitorCh <- virtualizerStopCmd{}
 }
 
-func (id *instanceData) sendInstanceDeletedEvent() {
+func (id *instanceData) sendInstanceDeletedEvent(reason payloads.InstanceDeletedReason) {
 	var event payloads.EventInstanceDeleted
 
 	event.InstanceDeleted.InstanceUUID = id.instance
+	event.InstanceDeleted.Reason = reason
 
 	payload, err := yaml.Marshal(&event)
 	if err != nil {
@@ -220,6 +333,9 @@ func (id *instanceData) deleteCommand(cmd *insDeleteCmd) bool {
 		return false
 	}
 
+	id.stopping = true
+	id.restartTimer = nil
+
 	if id.monitorCh != nil {
 		glog.Infof("Powerdown %s before deleting", id.instance)
 		id.monitorCh <- virtualizerStopCmd{}
@@ -236,7 +352,7 @@ func (id *instanceData) deleteCommand(cmd *insDeleteCmd) bool {
 	id.unmapVolumes()
 
 	if !cmd.suicide {
-		id.sendInstanceDeletedEvent()
+		id.sendInstanceDeletedEvent(cmd.reason)
 		id.ovsCh <- &ovsStatusCmd{}
 	}
 	return true
@@ -282,6 +398,34 @@ func (id *instanceData) detachVolumeCommand(cmd *insDetachVolumeCmd) {
 	glog.Infof("Volume %s detched from instance %s", cmd.volumeUUID, id.instance)
 }
 
+func (id *instanceData) securityGroupsCommand(cmd *insSecurityGroupsCmd) {
+	if id.shuttingDown {
+		glog.Warningf("Instance %s is shutting down, security groups ignored", id.instance)
+		return
+	}
+
+	id.cfg.Security = &cmd.security
+
+	// The configuration of instances which are not created yet is saved
+	// when they are
+	if _, err := os.Stat(id.instanceDir); err == nil {
+		if err := id.cfg.save(id.instanceDir); err != nil {
+			glog.Errorf("Unable to save security groups of instance %s: %v", id.instance, err)
+		}
+	}
+
+	if !networking {
+		return
+	}
+
+	if err := filterVnic(id.cfg); err != nil {
+		glog.Errorf("Unable to enforce security groups of instance %s: %v", id.instance, err)
+		return
+	}
+
+	glog.Infof("Security groups of instance %s configured", id.instance)
+}
+
 func (id *instanceData) logStartTrace() {
 	if id.st == nil {
 		return
@@ -325,6 +469,8 @@ func (id *instanceData) instanceCommand(cmd interface{}) bool {
 		id.attachVolumeCommand(cmd)
 	case *insDetachVolumeCmd:
 		id.detachVolumeCommand(cmd)
+	case *insSecurityGroupsCmd:
+		id.securityGroupsCommand(cmd)
 	case *insDeleteCmd:
 		if id.deleteCommand(cmd) {
 			return false
@@ -394,9 +540,19 @@ DONE:
 			id.ovsCh <- &ovsStateChange{id.instance, ovsStopped}
 			id.st = nil
 			id.unmapVolumes()
+
+			if delay, ok := id.restartDelay(); ok {
+				glog.Infof("Instance %s will be restarted in %v", id.instance, delay)
+				id.restartTimer = time.After(delay)
+			}
+			id.unconfirmed = false
+		case <-id.restartTimer:
+			id.restartTimer = nil
+			id.autoRestart()
 		case <-id.connectedCh:
 			id.logStartTrace()
 			id.connectedCh = nil
+			id.unconfirmed = false
 			id.vm.connected()
 			id.ovsCh <- &ovsStateChange{id.instance, ovsRunning}
 			d, m, c := id.vm.stats()
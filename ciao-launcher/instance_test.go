@@ -68,6 +68,7 @@ type instanceTestState struct {
 	monitorClosedCh chan struct{}
 	failStartVM     bool
 	ac              *agentClient
+	restarted       payloads.EventInstanceRestarted
 }
 
 func (v *instanceTestState) init(cfg *vmConfig, instanceDir string) {
@@ -166,6 +167,12 @@ func (v *instanceTestState) SendError(error ssntp.Error, payload []byte) (int, e
 }
 
 func (v *instanceTestState) SendEvent(event ssntp.Event, payload []byte) (int, error) {
+	if event == ssntp.InstanceRestarted {
+		err := yaml.Unmarshal(payload, &v.restarted)
+		if err != nil {
+			v.t.Fatalf("Failed to unmarshall restarted event %v", err)
+		}
+	}
 	return 0, nil
 }
 
@@ -928,6 +935,102 @@ func TestLostInstance(t *testing.T) {
 	wg.Wait()
 }
 
+// Check the instanceLoop restarts a lost instance according to its policy.
+//
+// We start an instance whose restart policy allows a single restart on
+// failure and we close its monitorCloseCh channel.  The instanceLoop should
+// restart it and report the restart.  We then close the monitorCloseCh
+// channel again and delete the instance.
+//
+// The instance should be restarted once, with an InstanceRestarted event
+// sent, and not restarted a second time.  The instance should then be
+// deleted correctly and the instanceLoop should exit cleanly.
+func TestRestartLostInstance(t *testing.T) {
+	var wg sync.WaitGroup
+
+	defer func(backoff time.Duration) { minRestartBackoff = backoff }(minRestartBackoff)
+	minRestartBackoff = 10 * time.Millisecond
+
+	cfg := standardCfg
+	cfg.Restart = payloads.RestartPolicy{
+		Condition:   payloads.RestartOnFailure,
+		MaxRestarts: 1,
+	}
+	state, ovsCh, cmdCh, doneCh := startVMWithCFG(t, &wg, &cfg, true, false)
+
+	close(state.monitorClosedCh)
+
+	if !waitForStateChange(t, ovsStopped, ovsCh) {
+		cleanupShutdownFail(t, cfg.Instance, doneCh, ovsCh, &wg)
+	}
+
+	if !waitForStateChange(t, ovsRunning, ovsCh) {
+		cleanupShutdownFail(t, cfg.Instance, doneCh, ovsCh, &wg)
+	}
+
+	if state.restarted.InstanceRestarted.InstanceUUID != state.instance ||
+		state.restarted.InstanceRestarted.Restarts != 1 {
+		t.Errorf("Invalid InstanceRestarted event %+v", state.restarted)
+	}
+
+	close(state.monitorClosedCh)
+
+	if !waitForStateChange(t, ovsStopped, ovsCh) {
+		cleanupShutdownFail(t, cfg.Instance, doneCh, ovsCh, &wg)
+	}
+
+	state.monitorCh = nil
+
+	if !state.deleteInstance(t, ovsCh, cmdCh) {
+		cleanupShutdownFail(t, cfg.Instance, doneCh, ovsCh, &wg)
+	}
+
+	wg.Wait()
+}
+
+// Check the instanceLoop does not restart a stopped instance.
+//
+// We start an instance with the always restart policy, stop it and wait
+// for it to be reported as stopped.  We then delete the instance.
+//
+// The instance should not be restarted, it should be deleted correctly
+// and the instanceLoop should exit cleanly.
+func TestStopRestartAlwaysInstance(t *testing.T) {
+	var wg sync.WaitGroup
+	cfg := standardCfg
+	cfg.Restart = payloads.RestartPolicy{Condition: payloads.RestartAlways}
+	state, ovsCh, cmdCh, doneCh := startVMWithCFG(t, &wg, &cfg, true, false)
+
+	select {
+	case cmdCh <- &insStopCmd{}:
+	case <-time.After(time.Second):
+		cleanupShutdownFail(t, cfg.Instance, doneCh, ovsCh, &wg)
+	}
+
+	select {
+	case <-state.monitorCh:
+		close(state.monitorClosedCh)
+	case <-time.After(time.Second):
+		cleanupShutdownFail(t, cfg.Instance, doneCh, ovsCh, &wg)
+	}
+
+	if !waitForStateChange(t, ovsStopped, ovsCh) {
+		cleanupShutdownFail(t, cfg.Instance, doneCh, ovsCh, &wg)
+	}
+
+	state.monitorCh = nil
+
+	if !state.deleteInstance(t, ovsCh, cmdCh) {
+		cleanupShutdownFail(t, cfg.Instance, doneCh, ovsCh, &wg)
+	}
+
+	if state.restarted.InstanceRestarted.Restarts != 0 {
+		t.Errorf("Stopped instance restarted %+v", state.restarted)
+	}
+
+	wg.Wait()
+}
+
 // Check we get an error when starting a running instance.
 //
 // We start the instance loop and then try to start an instance.  Our test virtualizer
@@ -1143,3 +1246,39 @@ func TestMain(m *testing.M) {
 	_ = os.RemoveAll(testInstancesDir)
 	os.Exit(exit)
 }
+
+// Check the delay between automatic restarts
+//
+// We compute the restart delay of instances with various restart policies
+// and numbers of restarts.
+//
+// Instances without a backoff wait minRestartBackoff, the delay doubles
+// with each restart and is capped by maxRestartBackoff.
+func TestRestartDelay(t *testing.T) {
+	tests := []struct {
+		policy   payloads.RestartPolicy
+		restarts int
+		delay    time.Duration
+		restart  bool
+	}{
+		{payloads.RestartPolicy{Condition: payloads.RestartNever}, 0, 0, false},
+		{payloads.RestartPolicy{Condition: payloads.RestartAlways}, 0, minRestartBackoff, true},
+		{payloads.RestartPolicy{Condition: payloads.RestartAlways}, 2, 4 * minRestartBackoff, true},
+		{payloads.RestartPolicy{Condition: payloads.RestartOnFailure, Backoff: 10}, 1, 20 * time.Second, true},
+		{payloads.RestartPolicy{Condition: payloads.RestartOnFailure, Backoff: 10}, 20, maxRestartBackoff, true},
+		{payloads.RestartPolicy{Condition: payloads.RestartOnFailure, MaxRestarts: 3}, 3, 0, false},
+	}
+
+	for _, test := range tests {
+		id := &instanceData{
+			cfg:      &vmConfig{Restart: test.policy},
+			restarts: test.restarts,
+		}
+
+		delay, restart := id.restartDelay()
+		if restart != test.restart || delay != test.delay {
+			t.Errorf("%+v after %d restarts: got %v %v, expected %v %v",
+				test.policy, test.restarts, delay, restart, test.delay, test.restart)
+		}
+	}
+}
@@ -87,6 +87,10 @@ var cephID string
 var simulate bool
 var maxInstances = int(math.MaxInt32)
 
+// minRestartBackoff is the delay before the first automatic restart of the
+// instances whose restart policy has no backoff.
+var minRestartBackoff = time.Second
+
 func init() {
 	flag.StringVar(&serverCertPath, "cacert", "", "Client certificate")
 	flag.StringVar(&clientCertPath, "cert", "", "CA certificate")
@@ -104,6 +108,9 @@ const (
 	lockFile       = "client-agent.lock"
 	statsPeriod    = 6
 	resourcePeriod = 30
+
+	// maxRestartBackoff caps the delay between automatic restarts.
+	maxRestartBackoff = 5 * time.Minute
 )
 
 func installLauncherDeps(role ssntp.Role, doneCh chan struct{}) {
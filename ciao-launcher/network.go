@@ -34,6 +34,7 @@ var cnNet *libsnnet.ComputeNode
 var hostname string
 var nicInfo []*payloads.NetworkStat
 var dockerNet *libsnnet.DockerPlugin
+var cnFirewall *libsnnet.Firewall
 
 func initNetworkPhase1() error {
 
@@ -123,6 +124,13 @@ func initNetwork(ctx context.Context) error {
 		return err
 	}
 
+	fw, err := libsnnet.InitVnicFirewall()
+	if err != nil {
+		glog.Warningf("Unable to initialise vnic filtering, instances in security groups will not start: %v", err)
+	} else {
+		cnFirewall = fw
+	}
+
 	limit := len(cnNet.ComputeAddr)
 	if len(cnNet.ComputeLink) < limit {
 		limit = len(cnNet.ComputeLink)
@@ -142,7 +150,6 @@ func initNetwork(ctx context.Context) error {
 		glog.Warning("Unable to determine IP address. Should not happen")
 	}
 
-	var err error
 	hostname, err = os.Hostname()
 	if err == nil {
 		glog.Infof("Hostname of node is %s", hostname)
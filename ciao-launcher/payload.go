@@ -184,6 +184,27 @@ func parseStartPayload(data []byte) (*vmConfig, *payloadError) {
 		}
 	}
 
+	var restart payloads.RestartPolicy
+	if start.RestartPolicy != nil {
+		restart = *start.RestartPolicy
+	}
+	switch restart.Condition {
+	case "", payloads.RestartNever, payloads.RestartOnFailure, payloads.RestartAlways:
+	default:
+		err = fmt.Errorf("Invalid restart condition received: %s", restart.Condition)
+		return nil, &payloadError{err, payloads.InvalidData}
+	}
+	if restart.MaxRestarts < 0 || restart.Backoff < 0 {
+		err = fmt.Errorf("Invalid restart policy received: %+v", restart)
+		return nil, &payloadError{err, payloads.InvalidData}
+	}
+
+	if start.Security != nil {
+		if _, err = securityFilterRules(start.Security); err != nil {
+			return nil, &payloadError{err, payloads.InvalidData}
+		}
+	}
+
 	return &vmConfig{Cpus: cpus,
 		Mem:         mem,
 		Disk:        disk,
@@ -201,6 +222,8 @@ func parseStartPayload(data []byte) (*vmConfig, *payloadError) {
 		VnicUUID:    strings.TrimSpace(net.VnicUUID),
 		SSHPort:     sshPort,
 		Volumes:     volumes,
+		Restart:     restart,
+		Security:    start.Security,
 	}, nil
 }
 
@@ -299,20 +322,20 @@ func parseRestartPayload(data []byte) (string, *payloadError) {
 	return instance, nil
 }
 
-func parseDeletePayload(data []byte) (string, *payloadError) {
+func parseDeletePayload(data []byte) (string, payloads.InstanceDeletedReason, *payloadError) {
 	var clouddata payloads.Delete
 
 	err := yaml.Unmarshal(data, &clouddata)
 	if err != nil {
-		return "", &payloadError{err, payloads.DeleteInvalidPayload}
+		return "", "", &payloadError{err, payloads.DeleteInvalidPayload}
 	}
 
 	instance := strings.TrimSpace(clouddata.Delete.InstanceUUID)
 	if !uuidRegexp.MatchString(instance) {
 		err = fmt.Errorf("Invalid instance id received: %s", instance)
-		return "", &payloadError{err, payloads.DeleteInvalidData}
+		return "", "", &payloadError{err, payloads.DeleteInvalidData}
 	}
-	return instance, nil
+	return instance, clouddata.Delete.Reason, nil
 }
 
 func parseStopPayload(data []byte) (string, *payloadError) {
@@ -332,6 +355,30 @@ func parseStopPayload(data []byte) (string, *payloadError) {
 	return instance, nil
 }
 
+func parseSecurityGroupsPayload(data []byte) ([]payloads.InstanceSecurity, error) {
+	var clouddata payloads.CommandConfigureSecurityGroups
+
+	err := yaml.Unmarshal(data, &clouddata)
+	if err != nil {
+		return nil, err
+	}
+
+	instances := clouddata.SecurityGroups.Instances
+	for i := range instances {
+		instance := strings.TrimSpace(instances[i].InstanceUUID)
+		if !uuidRegexp.MatchString(instance) {
+			return nil, fmt.Errorf("Invalid instance id received: %s", instance)
+		}
+		instances[i].InstanceUUID = instance
+
+		if _, err = securityFilterRules(&instances[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return instances, nil
+}
+
 func extractVolumeInfo(cmd *payloads.VolumeCmd, errString string) (string, string, *payloadError) {
 	instance := strings.TrimSpace(cmd.InstanceUUID)
 	if !uuidRegexp.MatchString(instance) {
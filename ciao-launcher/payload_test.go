@@ -158,6 +158,35 @@ start:
   storage:
      - id: 69e84267-ed01-4738-b15f-b47de06b62e7
        boot: true
+`,
+		nil,
+	},
+	{
+		`
+start:
+  requested_resources:
+     - type: vcpus
+       value: 2
+  instance_uuid: d7d86208-b46c-4465-9018-ee14087d415f
+  tenant_uuid: 67d86208-000-4465-9018-fe14087d415f
+  fw_type: legacy
+  networking:
+    vnic_mac: 02:00:e6:f5:af:f9
+    vnic_uuid: 67d86208-b46c-0000-9018-fe14087d415f
+    concentrator_ip: 192.168.42.21
+    concentrator_uuid: 67d86208-b46c-4465-0000-fe14087d415f
+    subnet: 192.168.8.0/21
+    private_ip: 192.168.8.2
+  storage:
+     - id: 69e84267-ed01-4738-b15f-b47de06b62e7
+       boot: true
+  security:
+    instance_uuid: d7d86208-b46c-4465-9018-ee14087d415f
+    enforced: true
+    rules:
+      - direction: ingress
+        protocol: sctp
+        remote_cidr: 0.0.0.0/0
 `,
 		nil,
 	},
@@ -335,7 +364,27 @@ func TestParseRestartPayload(t *testing.T) {
 // The payload should parse without any error and the instance UUID in the
 // resulting payloads data structure should be as expected.
 func TestParseDeletePayload(t *testing.T) {
-	instance, err := parseDeletePayload([]byte(testutil.DeleteYaml))
+	instance, reason, err := parseDeletePayload([]byte(testutil.DeleteYaml))
+	if err != nil {
+		t.Fatalf("Failed to parse delete payload : %v", err.err)
+	}
+	if instance != testutil.InstanceUUID {
+		t.Errorf("Wrong instance UUID.  Expected %s found %s", instance,
+			testutil.InstanceUUID)
+	}
+	if reason != "" {
+		t.Errorf("Unexpected delete reason %s", reason)
+	}
+}
+
+// Check that parseDeletePayload returns the reason for a preemption.
+//
+// Parse a valid delete payload sent by the scheduler to preempt an instance.
+//
+// The payload should parse without any error and the reason should be
+// payloads.Preempted.
+func TestParsePreemptPayload(t *testing.T) {
+	instance, reason, err := parseDeletePayload([]byte(testutil.PreemptYaml))
 	if err != nil {
 		t.Fatalf("Failed to parse delete payload : %v", err.err)
 	}
@@ -343,6 +392,9 @@ func TestParseDeletePayload(t *testing.T) {
 		t.Errorf("Wrong instance UUID.  Expected %s found %s", instance,
 			testutil.InstanceUUID)
 	}
+	if reason != payloads.Preempted {
+		t.Errorf("Wrong delete reason.  Expected %s found %s", payloads.Preempted, reason)
+	}
 }
 
 // Check that parseStopPayload works correctly.
@@ -361,3 +413,50 @@ func TestParseStopPayload(t *testing.T) {
 			testutil.InstanceUUID)
 	}
 }
+
+// Check that parseSecurityGroupsPayload works correctly.
+//
+// Parse a valid ConfigureSecurityGroups payload, then payloads with an
+// invalid instance UUID and an invalid rule.
+//
+// The valid payload should parse without any error and the rules of its
+// instance should be as expected.  Errors should be returned for the invalid
+// payloads.
+func TestParseSecurityGroupsPayload(t *testing.T) {
+	instances, err := parseSecurityGroupsPayload([]byte(testutil.SecurityGroupsYaml))
+	if err != nil {
+		t.Fatalf("Failed to parse security groups payload : %v", err)
+	}
+
+	if len(instances) != 1 || instances[0].InstanceUUID != testutil.InstanceUUID {
+		t.Fatalf("Wrong instances %+v", instances)
+	}
+
+	if !instances[0].Enforced || len(instances[0].Rules) != 2 {
+		t.Errorf("Wrong security of instance %+v", instances[0])
+	}
+
+	var cmd payloads.CommandConfigureSecurityGroups
+	cmd.SecurityGroups.Instances = []payloads.InstanceSecurity{{InstanceUUID: "imnotvalid"}}
+	y, _ := yaml.Marshal(&cmd)
+	if _, err = parseSecurityGroupsPayload(y); err == nil {
+		t.Errorf("Invalid instance UUID accepted")
+	}
+
+	cmd.SecurityGroups.Instances = []payloads.InstanceSecurity{
+		{
+			InstanceUUID: testutil.InstanceUUID,
+			Enforced:     true,
+			Rules: []payloads.SecurityGroupRule{
+				{
+					Direction:  payloads.Ingress,
+					RemoteCIDR: "10.0.0.0",
+				},
+			},
+		},
+	}
+	y, _ = yaml.Marshal(&cmd)
+	if _, err = parseSecurityGroupsPayload(y); err == nil {
+		t.Errorf("Invalid rule CIDR accepted")
+	}
+}
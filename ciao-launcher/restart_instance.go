@@ -37,6 +37,12 @@ func processRestart(instanceDir string, vm virtualizer, conn serverConn, cfg *vm
 		if err != nil {
 			return &restartError{err, payloads.RestartNetworkFailure}
 		}
+
+		err = refilterVnic(instanceDir, cfg, vnicName)
+		if err != nil {
+			glog.Errorf("Unable to enforce security groups: %v", err)
+			return &restartError{err, payloads.RestartNetworkFailure}
+		}
 	}
 
 	err = vm.startVM(vnicName, getNodeIPAddress(), cephID)
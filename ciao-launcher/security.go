@@ -0,0 +1,130 @@
+/*
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/01org/ciao/networking/libsnnet"
+	"github.com/01org/ciao/payloads"
+	"github.com/golang/glog"
+)
+
+// securityFilterRules converts the security group rules of an instance into
+// the rules filtering the traffic of its vnic.
+func securityFilterRules(sec *payloads.InstanceSecurity) ([]libsnnet.FilterRule, error) {
+	rules := make([]libsnnet.FilterRule, 0, len(sec.Rules))
+	for _, r := range sec.Rules {
+		if r.Direction != payloads.Ingress && r.Direction != payloads.Egress {
+			return nil, fmt.Errorf("Invalid rule direction received: %s", r.Direction)
+		}
+
+		switch r.Protocol {
+		case "", "icmp":
+		case "tcp", "udp":
+			if r.PortMin < 0 || r.PortMax > 65535 ||
+				(r.PortMin == 0 && r.PortMax != 0) || r.PortMin > r.PortMax {
+				return nil, fmt.Errorf("Invalid rule port range received: %d-%d",
+					r.PortMin, r.PortMax)
+			}
+		default:
+			return nil, fmt.Errorf("Invalid rule protocol received: %s", r.Protocol)
+		}
+
+		rule := libsnnet.FilterRule{
+			Ingress:  r.Direction == payloads.Ingress,
+			Protocol: r.Protocol,
+			PortMin:  r.PortMin,
+			PortMax:  r.PortMax,
+		}
+
+		if r.RemoteCIDR != "" {
+			_, remote, err := net.ParseCIDR(r.RemoteCIDR)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid rule CIDR received: %s", r.RemoteCIDR)
+			}
+			rule.Remote = remote
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// errNoVnicFirewall is returned for the instances in security groups when
+// the vnic firewall could not be initialised.
+var errNoVnicFirewall = errors.New("Vnic firewall unavailable, security groups cannot be enforced")
+
+// checkVnicFilter tells if the security groups of an instance can be
+// enforced.  Instances in security groups must not run unfiltered.
+func checkVnicFilter(cfg *vmConfig) error {
+	if cnFirewall == nil && !cfg.NetworkNode && cfg.Security != nil && cfg.Security.Enforced {
+		return errNoVnicFirewall
+	}
+
+	return nil
+}
+
+// filterVnic enforces the security groups of an instance on the traffic of
+// its vnic.  The traffic of instances which do not belong to security groups
+// is not filtered.
+func filterVnic(cfg *vmConfig) error {
+	if cfg.NetworkNode || cfg.VnicName == "" {
+		return nil
+	}
+
+	if cnFirewall == nil {
+		return checkVnicFilter(cfg)
+	}
+
+	if cfg.Security == nil || !cfg.Security.Enforced {
+		return cnFirewall.VnicFilter(libsnnet.FwDisable, cfg.VnicName, nil)
+	}
+
+	rules, err := securityFilterRules(cfg.Security)
+	if err != nil {
+		return err
+	}
+
+	glog.Infof("Filtering vnic %s of instance %s with %d rules", cfg.VnicName,
+		cfg.Instance, len(rules))
+
+	return cnFirewall.VnicFilter(libsnnet.FwEnable, cfg.VnicName, rules)
+}
+
+// refilterVnic enforces the security groups of a restarted instance on the
+// traffic of its vnic, which may have been recreated with a new name.
+func refilterVnic(instanceDir string, cfg *vmConfig, vnicName string) error {
+	if cfg.VnicName != vnicName {
+		if cfg.VnicName != "" && cnFirewall != nil {
+			err := cnFirewall.VnicFilter(libsnnet.FwDisable, cfg.VnicName, nil)
+			if err != nil {
+				glog.Warningf("Unable to remove filter of vnic %s: %v", cfg.VnicName, err)
+			}
+		}
+
+		cfg.VnicName = vnicName
+		if err := cfg.save(instanceDir); err != nil {
+			return err
+		}
+	}
+
+	return filterVnic(cfg)
+}
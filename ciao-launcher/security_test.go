@@ -0,0 +1,114 @@
+/*
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package main
+
+import (
+	"testing"
+
+	"github.com/01org/ciao/payloads"
+)
+
+var securityRuleTests = []struct {
+	rule  payloads.SecurityGroupRule
+	valid bool
+}{
+	{payloads.SecurityGroupRule{Direction: payloads.Ingress, Protocol: "tcp", PortMin: 22, PortMax: 22, RemoteCIDR: "0.0.0.0/0"}, true},
+	{payloads.SecurityGroupRule{Direction: payloads.Egress, Protocol: "udp", PortMin: 5000, PortMax: 5100}, true},
+	{payloads.SecurityGroupRule{Direction: payloads.Ingress, Protocol: "icmp", RemoteCIDR: "192.168.0.0/16"}, true},
+	{payloads.SecurityGroupRule{Direction: payloads.Egress}, true},
+	{payloads.SecurityGroupRule{Direction: "sideways"}, false},
+	{payloads.SecurityGroupRule{Direction: payloads.Ingress, Protocol: "sctp"}, false},
+	{payloads.SecurityGroupRule{Direction: payloads.Ingress, Protocol: "tcp", PortMin: 80, PortMax: 22}, false},
+	{payloads.SecurityGroupRule{Direction: payloads.Ingress, Protocol: "tcp", PortMax: 22}, false},
+	{payloads.SecurityGroupRule{Direction: payloads.Ingress, Protocol: "tcp", PortMin: 1, PortMax: 70000}, false},
+	{payloads.SecurityGroupRule{Direction: payloads.Ingress, RemoteCIDR: "10.0.0.1"}, false},
+}
+
+// Check that securityFilterRules converts security group rules.
+//
+// Convert a number of valid and invalid rules.
+//
+// The valid rules should be converted to filter rules with the same
+// direction, protocol, ports and remote range.  Errors should be returned
+// for the invalid rules.
+func TestSecurityFilterRules(t *testing.T) {
+	for i, test := range securityRuleTests {
+		sec := &payloads.InstanceSecurity{
+			Enforced: true,
+			Rules:    []payloads.SecurityGroupRule{test.rule},
+		}
+
+		rules, err := securityFilterRules(sec)
+		if !test.valid {
+			if err == nil {
+				t.Errorf("Invalid rule %d accepted", i)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("Valid rule %d rejected: %v", i, err)
+			continue
+		}
+
+		r := rules[0]
+		if r.Ingress != (test.rule.Direction == payloads.Ingress) ||
+			r.Protocol != test.rule.Protocol ||
+			r.PortMin != test.rule.PortMin || r.PortMax != test.rule.PortMax {
+			t.Errorf("Rule %d does not match %+v", i, r)
+		}
+
+		if (r.Remote == nil) != (test.rule.RemoteCIDR == "") ||
+			(r.Remote != nil && r.Remote.String() != test.rule.RemoteCIDR) {
+			t.Errorf("Remote of rule %d does not match %v", i, r.Remote)
+		}
+	}
+}
+
+// Check that instances in security groups are not left unfiltered when
+// vnics cannot be filtered.
+//
+// Call checkVnicFilter and filterVnic for an enforced instance, an
+// instance in no security group and a CNCI when the vnic firewall is not
+// initialised.
+//
+// Only the enforced instance should be refused.
+func TestFilterVnicDisabled(t *testing.T) {
+	cfg := &vmConfig{
+		VnicName: "svn_1a2b3c4d",
+		Security: &payloads.InstanceSecurity{Enforced: true},
+	}
+
+	if err := checkVnicFilter(cfg); err != errNoVnicFirewall {
+		t.Errorf("Expected %v, got %v", errNoVnicFirewall, err)
+	}
+
+	if err := filterVnic(cfg); err != errNoVnicFirewall {
+		t.Errorf("Expected %v, got %v", errNoVnicFirewall, err)
+	}
+
+	cfg.Security = nil
+	if err := filterVnic(cfg); err != nil {
+		t.Errorf("filterVnic failed: %v", err)
+	}
+
+	cfg.Security = &payloads.InstanceSecurity{Enforced: true}
+	cfg.NetworkNode = true
+	if err := checkVnicFilter(cfg); err != nil {
+		t.Errorf("checkVnicFilter failed: %v", err)
+	}
+}
@@ -134,7 +134,7 @@ func (client *agentClient) CommandNotify(cmd ssntp.Command, frame *ssntp.Frame)
 		}
 		client.cmdCh <- &cmdWrapper{instance, &insStopCmd{}}
 	case ssntp.DELETE:
-		instance, payloadErr := parseDeletePayload(payload)
+		instance, reason, payloadErr := parseDeletePayload(payload)
 		if payloadErr != nil {
 			deleteError := &deleteError{
 				payloadErr.err,
@@ -144,7 +144,7 @@ func (client *agentClient) CommandNotify(cmd ssntp.Command, frame *ssntp.Frame)
 			glog.Errorf("Unable to parse YAML: %s", payloadErr.err)
 			return
 		}
-		client.cmdCh <- &cmdWrapper{instance, &insDeleteCmd{}}
+		client.cmdCh <- &cmdWrapper{instance, &insDeleteCmd{reason: reason}}
 	case ssntp.AttachVolume:
 		instance, volume, payloadErr := parseAttachVolumePayload(payload)
 		if payloadErr != nil {
@@ -169,6 +169,15 @@ func (client *agentClient) CommandNotify(cmd ssntp.Command, frame *ssntp.Frame)
 			return
 		}
 		client.cmdCh <- &cmdWrapper{instance, &insDetachVolumeCmd{volume}}
+	case ssntp.ConfigureSecurityGroups:
+		instances, err := parseSecurityGroupsPayload(payload)
+		if err != nil {
+			glog.Errorf("Unable to parse YAML: %v", err)
+			return
+		}
+		for _, s := range instances {
+			client.cmdCh <- &cmdWrapper{s.InstanceUUID, &insSecurityGroupsCmd{s}}
+		}
 	}
 }
 
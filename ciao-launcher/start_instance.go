@@ -113,6 +113,11 @@ func processStart(cmd *insStartCmd, instanceDir string, vm virtualizer, conn ser
 	}
 
 	if networking {
+		err = checkVnicFilter(cfg)
+		if err != nil {
+			return nil, &startError{err, payloads.NetworkFailure}
+		}
+
 		vnicCfg, err = createVnicCfg(cfg)
 		if err != nil {
 			glog.Errorf("Could not create VnicCFG: %s", err)
@@ -134,6 +139,13 @@ func processStart(cmd *insStartCmd, instanceDir string, vm virtualizer, conn ser
 		if err != nil {
 			return nil, &startError{err, payloads.NetworkFailure}
 		}
+
+		cfg.VnicName = vnicName
+		err = filterVnic(cfg)
+		if err != nil {
+			glog.Errorf("Unable to enforce security groups: %v", err)
+			return nil, &startError{err, payloads.NetworkFailure}
+		}
 	}
 
 	st.networkStamp = time.Now()
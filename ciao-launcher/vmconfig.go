@@ -21,6 +21,7 @@ import (
 	"os"
 	"path"
 
+	"github.com/01org/ciao/payloads"
 	"github.com/golang/glog"
 )
 
@@ -47,6 +48,9 @@ type vmConfig struct {
 	VnicUUID    string
 	SSHPort     int
 	Volumes     []volumeConfig
+	Restart     payloads.RestartPolicy
+	VnicName    string
+	Security    *payloads.InstanceSecurity
 }
 
 func loadVMConfig(instanceDir string) (*vmConfig, error) {
@@ -138,5 +138,20 @@ Ciao-scheduler currently implements an extremely trivial algorithm to
 prefer not using the most-recently-used compute node.  This is inexpensive
 and leads to sufficient spread of new workloads across a cluster.
 
+CNCIs are placed on the network node hosting the fewest of them among
+those with room for a new one.  Network nodes that disconnected several
+times in the last few minutes are only used when no other one fits.
+
+Fairness between tenants is handled before placement.  START commands
+are queued and dispatched by priority class first, high priority
+instances (such as CNCIs) before normal ones and normal ones before
+preemptible ones.  Within a class the next instance to start belongs to
+the tenant with the smallest number of running instances divided by its
+weight.  A start that fits nowhere waits in the queue, letting the ones
+behind it go first, until a node has room for it or it expires.  When
+started with -preempt, a high or normal priority start that fits
+nowhere deletes preemptible instances, and waits for them to go, rather
+than waiting for room to be freed.
+
 */
 package main
@@ -0,0 +1,559 @@
+//
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/01org/ciao/payloads"
+	"github.com/01org/ciao/ssntp"
+	"github.com/golang/glog"
+	"gopkg.in/yaml.v2"
+)
+
+// START commands are not forwarded as soon as they are received but go
+// through a fair-share queue.  Pending high priority instances are
+// dispatched first, then normal and finally preemptible ones.  Within a
+// priority class the next instance comes from the tenant with the
+// fewest running instances relative to its weight, and each tenant's
+// instances are dispatched in arrival order.  A START no node has room
+// for stays queued, without holding back the ones behind it, until room
+// is made or it expires.  The scheduler keeps no persistent state, so
+// running counts only cover the instances it has dispatched since it
+// was started.
+
+// how long a START waits for preempted instances to be deleted before
+// being dispatched anyway
+var preemptTimeout = 30 * time.Second
+
+// how long a START waits for a node to have room for it before being
+// reported as failed to the controller
+var startTimeout = 5 * time.Minute
+
+const (
+	highClass = iota
+	normalClass
+	preemptibleClass
+	numPriorityClasses
+)
+
+func priorityClass(p payloads.Priority) int {
+	switch p {
+	case payloads.HighPriority:
+		return highClass
+	case payloads.PreemptiblePriority:
+		return preemptibleClass
+	}
+	return normalClass
+}
+
+type pendingStart struct {
+	controllerUUID  string
+	frame           *ssntp.Frame
+	tenantUUID      string
+	priority        payloads.Priority
+	workload        workResources
+	seq             uint64
+	deadline        time.Time
+	waiting         bool
+	preemptDeadline time.Time
+}
+
+// preempting tells if the START is waiting for preempted instances to be
+// deleted.
+func (start *pendingStart) preempting(now time.Time) bool {
+	return !start.preemptDeadline.IsZero() && now.Before(start.preemptDeadline)
+}
+
+type tenantShare struct {
+	weight  int
+	running int
+	pending [numPriorityClasses][]*pendingStart
+}
+
+type runningInstance struct {
+	tenantUUID string
+	priority   payloads.Priority
+	nodeUUID   string
+	workload   workResources
+	preempted  bool
+}
+
+type fairShareQueue struct {
+	mutex       sync.Mutex
+	tenants     map[string]*tenantShare
+	instances   map[string]*runningInstance
+	seq         uint64
+	dispatching bool
+	redispatch  bool
+
+	// now and after are the clock of the queue, the offline simulator
+	// runs it in simulated time
+	now   func() time.Time
+	after func(d time.Duration, f func())
+}
+
+func newFairShareQueue() *fairShareQueue {
+	return &fairShareQueue{
+		tenants:   make(map[string]*tenantShare),
+		instances: make(map[string]*runningInstance),
+		now:       time.Now,
+		after:     func(d time.Duration, f func()) { time.AfterFunc(d, f) },
+	}
+}
+
+// Must be called with q.mutex held
+func (q *fairShareQueue) tenant(tenantUUID string) *tenantShare {
+	t := q.tenants[tenantUUID]
+	if t == nil {
+		t = &tenantShare{weight: 1}
+		q.tenants[tenantUUID] = t
+	}
+	return t
+}
+
+// Must be called with q.mutex held
+func (q *fairShareQueue) forgetTenant(tenantUUID string) {
+	t := q.tenants[tenantUUID]
+	if t == nil || t.running > 0 {
+		return
+	}
+
+	for _, pending := range t.pending {
+		if len(pending) > 0 {
+			return
+		}
+	}
+
+	delete(q.tenants, tenantUUID)
+}
+
+// Must be called with q.mutex held
+func (q *fairShareQueue) push(start *pendingStart, weight int) {
+	t := q.tenant(start.tenantUUID)
+	if weight > 0 {
+		t.weight = weight
+	}
+
+	q.seq++
+	start.seq = q.seq
+
+	class := priorityClass(start.priority)
+	t.pending[class] = append(t.pending[class], start)
+}
+
+// requeue puts back a START at the front of its tenant queue.
+// Must be called with q.mutex held
+func (q *fairShareQueue) requeue(start *pendingStart) {
+	t := q.tenant(start.tenantUUID)
+	class := priorityClass(start.priority)
+	t.pending[class] = append([]*pendingStart{start}, t.pending[class]...)
+}
+
+// lessShare tells if tenant a has a smaller share of the cluster than b,
+// i.e. a.running/a.weight < b.running/b.weight.
+func lessShare(a, b *tenantShare) bool {
+	return a.running*b.weight < b.running*a.weight
+}
+
+// pop removes and returns the next START to dispatch from the priority
+// classes before classes.
+// Must be called with q.mutex held
+func (q *fairShareQueue) pop(classes int) *pendingStart {
+	for class := 0; class < classes; class++ {
+		var next *tenantShare
+		for _, t := range q.tenants {
+			if len(t.pending[class]) == 0 {
+				continue
+			}
+
+			if next == nil || lessShare(t, next) ||
+				(!lessShare(next, t) && t.pending[class][0].seq < next.pending[class][0].seq) {
+				next = t
+			}
+		}
+
+		if next != nil {
+			start := next.pending[class][0]
+			next.pending[class] = next.pending[class][1:]
+			return start
+		}
+	}
+
+	return nil
+}
+
+// Must be called with q.mutex held
+func (q *fairShareQueue) instanceStarted(instanceUUID string, instance *runningInstance) {
+	q.instances[instanceUUID] = instance
+	q.tenant(instance.tenantUUID).running++
+}
+
+// Must be called with q.mutex held
+func (q *fairShareQueue) instanceGone(instanceUUID string) *runningInstance {
+	instance := q.instances[instanceUUID]
+	if instance == nil {
+		return nil
+	}
+
+	delete(q.instances, instanceUUID)
+	if t := q.tenants[instance.tenantUUID]; t != nil {
+		t.running--
+		q.forgetTenant(instance.tenantUUID)
+	}
+
+	return instance
+}
+
+// Must be called with q.mutex held
+func (q *fairShareQueue) nodeGone(nodeUUID string) {
+	for instanceUUID, instance := range q.instances {
+		if instance.nodeUUID == nodeUUID {
+			q.instanceGone(instanceUUID)
+		}
+	}
+}
+
+// queueStart adds a START command to the fair-share queue and tries to
+// dispatch pending work.  The frame is forwarded by dispatchPending.
+func (sched *ssntpSchedulerServer) queueStart(controllerUUID string, frame *ssntp.Frame) (dest ssntp.ForwardDestination, instanceUUID string) {
+	var work payloads.Start
+	err := yaml.Unmarshal(frame.Payload, &work)
+	if err != nil {
+		glog.Errorf("Bad START workload yaml from Controller %s: %s\n", controllerUUID, err)
+		dest.SetDecision(ssntp.Discard)
+		return dest, ""
+	}
+
+	workload, err := sched.getWorkloadResources(&work)
+	if err != nil {
+		glog.Errorf("Bad START workload resource list from Controller %s: %s\n", controllerUUID, err)
+		dest.SetDecision(ssntp.Discard)
+		return dest, ""
+	}
+
+	sched.fairShare.mutex.Lock()
+	start := &pendingStart{
+		controllerUUID: controllerUUID,
+		frame:          frame,
+		tenantUUID:     work.Start.TenantUUID,
+		priority:       work.Start.Priority,
+		workload:       workload,
+		deadline:       sched.fairShare.now().Add(startTimeout),
+	}
+	sched.fairShare.push(start, work.Start.TenantWeight)
+	sched.fairShare.mutex.Unlock()
+
+	sched.dispatchPending()
+
+	dest.SetDecision(ssntp.Queue)
+	return dest, workload.instanceUUID
+}
+
+// dispatchPending dispatches pending START commands in fair-share order.
+// The STARTs which cannot be placed yet are put back in the queue and,
+// while one of them waits for preempted instances to be deleted, the
+// lower priority ones are held back so that they do not take its room.
+// Node locks are never taken with the queue mutex held.  Only one caller
+// dispatches at a time, others return immediately and the dispatching
+// one goes through the queue again for them.
+func (sched *ssntpSchedulerServer) dispatchPending() {
+	q := sched.fairShare
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.dispatching {
+		q.redispatch = true
+		return
+	}
+	q.dispatching = true
+
+	for {
+		q.redispatch = false
+
+		var waiting []*pendingStart
+		classes := numPriorityClasses
+		for {
+			start := q.pop(classes)
+			if start == nil {
+				break
+			}
+
+			q.mutex.Unlock()
+			queued := sched.dispatchStart(start)
+			q.mutex.Lock()
+
+			if !queued {
+				continue
+			}
+
+			waiting = append(waiting, start)
+			if class := priorityClass(start.priority); start.preempting(q.now()) && class < classes {
+				classes = class + 1
+			}
+		}
+
+		for i := len(waiting) - 1; i >= 0; i-- {
+			q.requeue(waiting[i])
+		}
+
+		if !q.redispatch {
+			break
+		}
+	}
+
+	q.dispatching = false
+}
+
+// dispatchStart places and forwards a single START. It returns true if
+// the START stays queued, because no node has room for it yet or some
+// instances are being preempted to make room for it.  Once expired, the
+// START is dispatched anyway and reported as failed if it does not fit.
+func (sched *ssntpSchedulerServer) dispatchStart(start *pendingStart) bool {
+	q := sched.fairShare
+	now := q.now()
+
+	if !sched.nodeHasRoom(&start.workload) {
+		if start.preempting(now) {
+			return true
+		}
+
+		if sched.preempt && start.preemptDeadline.IsZero() &&
+			start.workload.networkNode == 0 &&
+			priorityClass(start.priority) < preemptibleClass &&
+			sched.preemptFor(start) {
+
+			start.preemptDeadline = now.Add(preemptTimeout)
+			q.after(preemptTimeout, sched.dispatchPending)
+			return true
+		}
+
+		if now.Before(start.deadline) {
+			if !start.waiting {
+				start.waiting = true
+				q.after(start.deadline.Sub(now), sched.dispatchPending)
+			}
+			return true
+		}
+	}
+
+	dest, instanceUUID := startWorkload(sched, start.controllerUUID, start.frame.Payload)
+	if dest.Decision() == ssntp.Forward {
+		q.mutex.Lock()
+		q.instanceStarted(instanceUUID, &runningInstance{
+			tenantUUID: start.tenantUUID,
+			priority:   start.priority,
+			nodeUUID:   dest.Recipients()[0],
+			workload:   start.workload,
+		})
+		q.mutex.Unlock()
+	}
+
+	sched.forward(dest, start.frame)
+
+	return false
+}
+
+// nodeHasRoom tells if a node of the type the workload needs has room
+// for it.
+func (sched *ssntpSchedulerServer) nodeHasRoom(workload *workResources) bool {
+	if workload.networkNode == 0 {
+		return sched.computeNodeHasRoom(workload)
+	}
+
+	sched.nnMutex.RLock()
+	defer sched.nnMutex.RUnlock()
+
+	for _, node := range sched.nnMap {
+		node.mutex.Lock()
+		fits := sched.workloadFits(node, workload)
+		node.mutex.Unlock()
+
+		if fits {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (sched *ssntpSchedulerServer) computeNodeHasRoom(workload *workResources) bool {
+	sched.cnMutex.RLock()
+	defer sched.cnMutex.RUnlock()
+
+	for _, node := range sched.cnList {
+		node.mutex.Lock()
+		fits := sched.workloadFits(node, workload)
+		node.mutex.Unlock()
+
+		if fits {
+			return true
+		}
+	}
+
+	return false
+}
+
+type preemptionVictim struct {
+	instanceUUID string
+	workload     workResources
+}
+
+type byMemDesc []preemptionVictim
+
+func (v byMemDesc) Len() int      { return len(v) }
+func (v byMemDesc) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v byMemDesc) Less(i, j int) bool {
+	return v[i].workload.memReqMB > v[j].workload.memReqMB
+}
+
+// pickVictims finds the compute node on which deleting the fewest
+// preemptible instances makes room for the workload.
+func (sched *ssntpSchedulerServer) pickVictims(workload *workResources) (string, []preemptionVictim) {
+	candidates := make(map[string][]preemptionVictim)
+
+	sched.fairShare.mutex.Lock()
+	for instanceUUID, instance := range sched.fairShare.instances {
+		if instance.preempted || priorityClass(instance.priority) != preemptibleClass {
+			continue
+		}
+		candidates[instance.nodeUUID] = append(candidates[instance.nodeUUID],
+			preemptionVictim{instanceUUID, instance.workload})
+	}
+	sched.fairShare.mutex.Unlock()
+
+	sched.cnMutex.RLock()
+	defer sched.cnMutex.RUnlock()
+
+	var bestNode string
+	var best []preemptionVictim
+
+	for nodeUUID, victims := range candidates {
+		node := sched.cnMap[nodeUUID]
+		if node == nil {
+			continue
+		}
+
+		node.mutex.Lock()
+		memAvailMB := node.memAvailMB
+		diskAvailMB := node.diskAvailMB
+		online := node.status == ssntp.READY || node.status == ssntp.FULL
+		node.mutex.Unlock()
+
+		if !online {
+			continue
+		}
+
+		sort.Sort(byMemDesc(victims))
+
+		for i, v := range victims {
+			memAvailMB += v.workload.memReqMB
+			diskAvailMB += v.workload.diskReqMB
+
+			if memAvailMB >= workload.memReqMB && diskAvailMB >= workload.diskReqMB {
+				if best == nil || i+1 < len(best) {
+					bestNode = nodeUUID
+					best = victims[:i+1]
+				}
+				break
+			}
+		}
+	}
+
+	return bestNode, best
+}
+
+// preemptFor sends DELETE commands for the preemptible instances that
+// need to go to make room for start.  It returns false if there is no
+// such set of instances.
+func (sched *ssntpSchedulerServer) preemptFor(start *pendingStart) bool {
+	nodeUUID, victims := sched.pickVictims(&start.workload)
+	if len(victims) == 0 {
+		return false
+	}
+
+	sched.fairShare.mutex.Lock()
+	for _, v := range victims {
+		if instance := sched.fairShare.instances[v.instanceUUID]; instance != nil {
+			instance.preempted = true
+		}
+	}
+	sched.fairShare.mutex.Unlock()
+
+	for _, v := range victims {
+		glog.Infof("Preempting instance %s on node %s for instance %s\n",
+			v.instanceUUID, nodeUUID, start.workload.instanceUUID)
+
+		payload, err := yaml.Marshal(&payloads.Delete{
+			Delete: payloads.StopCmd{
+				InstanceUUID:      v.instanceUUID,
+				WorkloadAgentUUID: nodeUUID,
+				Reason:            payloads.Preempted,
+			},
+		})
+		if err != nil {
+			glog.Errorf("Unable to Marshall DELETE %v", err)
+			continue
+		}
+
+		_, err = sched.ssntp.SendCommand(nodeUUID, ssntp.DELETE, payload)
+		if err != nil {
+			glog.Warningf("Unable to preempt instance %s: %v", v.instanceUUID, err)
+		}
+	}
+
+	return true
+}
+
+// instanceGone drops the fair-share accounting for an instance that was
+// deleted or failed to start, and dispatches any work waiting for room.
+func (sched *ssntpSchedulerServer) instanceGone(instanceUUID string) {
+	sched.fairShare.mutex.Lock()
+	instance := sched.fairShare.instanceGone(instanceUUID)
+	sched.fairShare.mutex.Unlock()
+
+	if instance != nil {
+		sched.releaseInstance(instance.nodeUUID, &instance.workload)
+	}
+
+	sched.dispatchPending()
+}
+
+func (sched *ssntpSchedulerServer) instanceDeleted(payload []byte) {
+	var event payloads.EventInstanceDeleted
+	err := yaml.Unmarshal(payload, &event)
+	if err != nil {
+		glog.Errorf("Bad InstanceDeleted yaml: %v", err)
+		return
+	}
+
+	sched.instanceGone(event.InstanceDeleted.InstanceUUID)
+}
+
+func (sched *ssntpSchedulerServer) instanceStartFailed(payload []byte) {
+	var failure payloads.ErrorStartFailure
+	err := yaml.Unmarshal(payload, &failure)
+	if err != nil {
+		glog.Errorf("Bad StartFailure yaml: %v", err)
+		return
+	}
+
+	sched.instanceGone(failure.InstanceUUID)
+}
@@ -0,0 +1,167 @@
+//
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"testing"
+
+	"github.com/01org/ciao/payloads"
+	"github.com/01org/ciao/ssntp"
+)
+
+func queueTestStart(q *fairShareQueue, tenant string, priority payloads.Priority, weight int, instance string) {
+	q.push(&pendingStart{
+		tenantUUID: tenant,
+		priority:   priority,
+		workload:   workResources{instanceUUID: instance},
+	}, weight)
+}
+
+func expectPop(t *testing.T, q *fairShareQueue, instances ...string) {
+	for _, instance := range instances {
+		start := q.pop(numPriorityClasses)
+		if start == nil {
+			t.Fatalf("expected %s, queue is empty", instance)
+		}
+		if start.workload.instanceUUID != instance {
+			t.Fatalf("expected %s, got %s", instance, start.workload.instanceUUID)
+		}
+		q.instanceStarted(instance, &runningInstance{
+			tenantUUID: start.tenantUUID,
+			priority:   start.priority,
+		})
+	}
+
+	if start := q.pop(numPriorityClasses); start != nil {
+		t.Fatalf("unexpected pending start %s", start.workload.instanceUUID)
+	}
+}
+
+func TestFairShareOrder(t *testing.T) {
+	q := newFairShareQueue()
+
+	// tenant a queues first but b catches up as soon as a runs more
+	queueTestStart(q, "a", "", 0, "a1")
+	queueTestStart(q, "a", "", 0, "a2")
+	queueTestStart(q, "a", "", 0, "a3")
+	queueTestStart(q, "b", "", 0, "b1")
+	queueTestStart(q, "b", "", 0, "b2")
+
+	expectPop(t, q, "a1", "b1", "a2", "b2", "a3")
+}
+
+func TestFairShareWeight(t *testing.T) {
+	q := newFairShareQueue()
+
+	queueTestStart(q, "a", "", 2, "a1")
+	queueTestStart(q, "a", "", 2, "a2")
+	queueTestStart(q, "a", "", 2, "a3")
+	queueTestStart(q, "b", "", 1, "b1")
+	queueTestStart(q, "b", "", 1, "b2")
+
+	expectPop(t, q, "a1", "b1", "a2", "a3", "b2")
+}
+
+func TestFairSharePriority(t *testing.T) {
+	q := newFairShareQueue()
+
+	queueTestStart(q, "a", payloads.PreemptiblePriority, 0, "a1")
+	queueTestStart(q, "a", payloads.NormalPriority, 0, "a2")
+	queueTestStart(q, "b", "", 0, "b1")
+	queueTestStart(q, "b", payloads.HighPriority, 0, "b2")
+
+	expectPop(t, q, "b2", "a2", "b1", "a1")
+}
+
+func TestFairShareInstanceGone(t *testing.T) {
+	q := newFairShareQueue()
+
+	q.instanceStarted("a1", &runningInstance{tenantUUID: "a", nodeUUID: "n1"})
+	q.instanceStarted("a2", &runningInstance{tenantUUID: "a", nodeUUID: "n2"})
+	q.instanceStarted("b1", &runningInstance{tenantUUID: "b", nodeUUID: "n1"})
+
+	if q.instanceGone("unknown") != nil {
+		t.Fatal("unknown instance removed")
+	}
+
+	q.nodeGone("n1")
+	if q.tenants["b"] != nil {
+		t.Fatal("idle tenant not forgotten")
+	}
+	if q.tenants["a"].running != 1 {
+		t.Fatalf("expected 1 running instance, got %d", q.tenants["a"].running)
+	}
+
+	q.instanceGone("a2")
+	if len(q.tenants) != 0 || len(q.instances) != 0 {
+		t.Fatal("instances still accounted for")
+	}
+}
+
+func TestPickVictims(t *testing.T) {
+	s := newSsntpSchedulerServer()
+
+	for uuid, memAvailMB := range map[string]int{"a": 0, "b": 512} {
+		node := &nodeStat{
+			status:     ssntp.FULL,
+			uuid:       uuid,
+			memTotalMB: 4096,
+			memAvailMB: memAvailMB,
+		}
+		s.cnList = append(s.cnList, node)
+		s.cnMap[node.uuid] = node
+	}
+
+	running := []struct {
+		instance string
+		node     string
+		priority payloads.Priority
+		memMB    int
+	}{
+		{"a1", "a", payloads.PreemptiblePriority, 1024},
+		{"a2", "a", payloads.PreemptiblePriority, 1024},
+		{"a3", "a", "", 2048},
+		{"b1", "b", payloads.PreemptiblePriority, 1024},
+		{"b2", "b", payloads.HighPriority, 2560},
+	}
+
+	for _, r := range running {
+		s.fairShare.instanceStarted(r.instance, &runningInstance{
+			tenantUUID: "t",
+			priority:   r.priority,
+			nodeUUID:   r.node,
+			workload:   workResources{instanceUUID: r.instance, memReqMB: r.memMB},
+		})
+	}
+
+	// b has 512MB free, deleting b1 alone makes room
+	node, victims := s.pickVictims(&workResources{memReqMB: 1536})
+	if node != "b" || len(victims) != 1 || victims[0].instanceUUID != "b1" {
+		t.Fatalf("unexpected victims %v on %s", victims, node)
+	}
+
+	// only a can free 2048MB, by deleting both of its preemptible instances
+	node, victims = s.pickVictims(&workResources{memReqMB: 2048})
+	if node != "a" || len(victims) != 2 {
+		t.Fatalf("unexpected victims %v on %s", victims, node)
+	}
+
+	node, victims = s.pickVictims(&workResources{memReqMB: 4096})
+	if len(victims) != 0 {
+		t.Fatalf("unexpected victims %v on %s", victims, node)
+	}
+}
@@ -23,6 +23,7 @@ import (
 	"log"
 	"os"
 	"runtime/pprof"
+	"sort"
 	"sync"
 	"syscall"
 	"time"
@@ -42,11 +43,14 @@ var heartbeat = flag.Bool("heartbeat", false, "Emit status heartbeat text")
 var logDir = "/var/lib/ciao/logs/scheduler"
 var configURI = flag.String("configuration-uri", "file:///etc/ciao/configuration.yaml",
 	"Cluster configuration URI")
+var preempt = flag.Bool("preempt", false, "Delete preemptible instances to make room for higher priority ones")
+var simulate = flag.String("simulate", "", "Run the offline scheduling simulation described in this file and exit")
 
 type ssntpSchedulerServer struct {
 	// user config overrides ------------------------------------------
 	heartbeat  bool
 	cpuprofile string
+	preempt    bool
 
 	// ssntp ----------------------------------------------------------
 	config *ssntp.Config
@@ -68,18 +72,30 @@ type ssntpSchedulerServer struct {
 	//cnInactiveMap      map[string]nodeStat
 
 	// Network Nodes
-	nnMap   map[string]*nodeStat
-	nnMutex sync.RWMutex // Rlock traversing map, Lock modifying map
-	nnMRU   string
+	nnMap         map[string]*nodeStat
+	nnMutex       sync.RWMutex           // Rlock traversing map, Lock modifying map
+	nnDisconnects map[string][]time.Time // recent disconnections per node
+
+	// Pending START commands and running instances, per tenant
+	fairShare *fairShareQueue
+
+	// forward sends the dispatched START frames to their node, it does
+	// nothing for the ones which could not be placed
+	forward func(dest ssntp.ForwardDestination, frame *ssntp.Frame)
 }
 
 func newSsntpSchedulerServer() *ssntpSchedulerServer {
-	return &ssntpSchedulerServer{
+	sched := &ssntpSchedulerServer{
 		controllerMap: make(map[string]*controllerStat),
 		cnMap:         make(map[string]*nodeStat),
 		cnMRUIndex:    -1,
 		nnMap:         make(map[string]*nodeStat),
+		nnDisconnects: make(map[string][]time.Time),
+		fairShare:     newFairShareQueue(),
 	}
+	sched.forward = sched.ssntp.ForwardQueued
+
+	return sched
 }
 
 type nodeStat struct {
@@ -92,8 +108,16 @@ type nodeStat struct {
 	diskAvailMB int
 	load        int
 	cpus        int
+	instances   int // dispatched and not yet deleted
 }
 
+// A network node disconnecting this many times within flapWindow is
+// flapping and only gets new CNCIs when no other network node fits.
+const (
+	flapThreshold = 3
+	flapWindow    = 10 * time.Minute
+)
+
 type controllerStatus uint8
 
 func (s controllerStatus) String() string {
@@ -290,6 +314,10 @@ func disconnectComputeNode(sched *ssntpSchedulerServer, uuid string) {
 		sched.cnMRUIndex = -1
 	}
 
+	sched.fairShare.mutex.Lock()
+	sched.fairShare.nodeGone(uuid)
+	sched.fairShare.mutex.Unlock()
+
 	sched.sendNodeDisconnectedEvents(uuid, payloads.ComputeNode)
 }
 
@@ -326,6 +354,13 @@ func disconnectNetworkNode(sched *ssntpSchedulerServer, uuid string) {
 	//TODO: consider moving to nnInactiveMap?
 	delete(sched.nnMap, uuid)
 
+	// only the last flapThreshold disconnections matter
+	disconnects := append(sched.nnDisconnects[uuid], time.Now())
+	if len(disconnects) > flapThreshold {
+		disconnects = disconnects[len(disconnects)-flapThreshold:]
+	}
+	sched.nnDisconnects[uuid] = disconnects
+
 	sched.sendNodeDisconnectedEvents(uuid, payloads.NetworkNode)
 }
 func (sched *ssntpSchedulerServer) ConnectNotify(uuid string, role ssntp.Role) {
@@ -398,11 +433,16 @@ func (sched *ssntpSchedulerServer) StatusNotify(uuid string, status ssntp.Status
 	if role.IsAgent() {
 		var cn *nodeStat
 		sched.cnMutex.RLock()
-		defer sched.cnMutex.RUnlock()
 		if sched.cnMap[uuid] != nil {
 			cn = sched.cnMap[uuid]
 			sched.updateNodeStat(cn, status, frame)
 		}
+		sched.cnMutex.RUnlock()
+
+		// fresh resource stats may let pending instances start
+		if status == ssntp.READY {
+			sched.dispatchPending()
+		}
 	}
 
 	if role.IsNetAgent() {
@@ -503,6 +543,10 @@ func (sched *ssntpSchedulerServer) getCommandConcentratorUUID(command ssntp.Comm
 		var cmd payloads.CommandReleasePublicIP
 		err := yaml.Unmarshal(payload, &cmd)
 		return cmd.ReleaseIP.ConcentratorUUID, err
+	case ssntp.ConfigureHealthChecks:
+		var cmd payloads.CommandConfigureHealthChecks
+		err := yaml.Unmarshal(payload, &cmd)
+		return cmd.HealthChecks.ConcentratorUUID, err
 	}
 }
 
@@ -584,6 +628,10 @@ func getWorkloadAgentUUID(sched *ssntpSchedulerServer, command ssntp.Command, pa
 		var cmd payloads.DetachVolume
 		err := yaml.Unmarshal(payload, &cmd)
 		return cmd.Detach.InstanceUUID, cmd.Detach.WorkloadAgentUUID, err
+	case ssntp.ConfigureSecurityGroups:
+		var cmd payloads.CommandConfigureSecurityGroups
+		err := yaml.Unmarshal(payload, &cmd)
+		return "", cmd.SecurityGroups.WorkloadAgentUUID, err
 	}
 }
 
@@ -606,6 +654,32 @@ func (sched *ssntpSchedulerServer) fwdCmdToComputeNode(command ssntp.Command, pa
 // Decrement resource claims for the referenced locked nodeStat object
 func (sched *ssntpSchedulerServer) decrementResourceUsage(node *nodeStat, workload *workResources) {
 	node.memAvailMB -= workload.memReqMB
+	node.instances++
+}
+
+// Drop the instance claimed by decrementResourceUsage once it has gone
+func (sched *ssntpSchedulerServer) releaseInstance(nodeUUID string, workload *workResources) {
+	var node *nodeStat
+
+	if workload.networkNode == 0 {
+		sched.cnMutex.RLock()
+		node = sched.cnMap[nodeUUID]
+		sched.cnMutex.RUnlock()
+	} else {
+		sched.nnMutex.RLock()
+		node = sched.nnMap[nodeUUID]
+		sched.nnMutex.RUnlock()
+	}
+
+	if node == nil {
+		return
+	}
+
+	node.mutex.Lock()
+	if node.instances > 0 {
+		node.instances--
+	}
+	node.mutex.Unlock()
 }
 
 // Find suitable compute node, returning referenced to a locked nodeStat if found
@@ -652,6 +726,39 @@ func pickComputeNode(sched *ssntpSchedulerServer, controllerUUID string, workloa
 	return nil
 }
 
+// Must be called with nnMutex held
+func (sched *ssntpSchedulerServer) nnFlapping(uuid string, now time.Time) bool {
+	n := 0
+	for _, t := range sched.nnDisconnects[uuid] {
+		if now.Sub(t) < flapWindow {
+			n++
+		}
+	}
+	return n >= flapThreshold
+}
+
+type nnCandidate struct {
+	node      *nodeStat
+	flapping  bool
+	instances int
+}
+
+// network nodes in order of preference: stable before flapping ones,
+// then least loaded with CNCIs first
+type byNetworkNodePreference []nnCandidate
+
+func (c byNetworkNodePreference) Len() int      { return len(c) }
+func (c byNetworkNodePreference) Swap(i, j int) { c[i], c[j] = c[j], c[i] }
+func (c byNetworkNodePreference) Less(i, j int) bool {
+	if c[i].flapping != c[j].flapping {
+		return !c[i].flapping
+	}
+	if c[i].instances != c[j].instances {
+		return c[i].instances < c[j].instances
+	}
+	return c[i].node.uuid < c[j].node.uuid
+}
+
 // Find suitable net node, returning referenced to a locked nodeStat if found
 func (sched *ssntpSchedulerServer) pickNetworkNode(controllerUUID string, workload *workResources) (node *nodeStat) {
 	sched.nnMutex.RLock()
@@ -663,14 +770,29 @@ func (sched *ssntpSchedulerServer) pickNetworkNode(controllerUUID string, worklo
 		return nil
 	}
 
-	// with more than one node MRU gives simplistic spread
+	now := time.Now()
+	var candidates []nnCandidate
 	for _, node := range sched.nnMap {
 		node.mutex.Lock()
-		if (len(sched.nnMap) <= 1 || ((len(sched.nnMap) > 1) && (node.uuid != sched.nnMRU))) &&
-			sched.workloadFits(node, workload) {
-			sched.nnMRU = node.uuid
-			return node // locked nodeStat
+		if sched.workloadFits(node, workload) {
+			candidates = append(candidates, nnCandidate{
+				node:      node,
+				flapping:  sched.nnFlapping(node.uuid, now),
+				instances: node.instances,
+			})
 		}
+		node.mutex.Unlock()
+	}
+
+	sort.Sort(byNetworkNodePreference(candidates))
+
+	// the node may have filled up since we looked at it
+	for _, c := range candidates {
+		c.node.mutex.Lock()
+		if sched.workloadFits(c.node, workload) {
+			return c.node // locked nodeStat
+		}
+		c.node.mutex.Unlock()
 	}
 
 	sched.sendStartFailureError(controllerUUID, workload.instanceUUID, payloads.NoNetworkNodes)
@@ -749,7 +871,7 @@ func (sched *ssntpSchedulerServer) CommandForward(controllerUUID string, command
 	switch command {
 	// the main command with scheduler processing
 	case ssntp.START:
-		dest, instanceUUID = startWorkload(sched, controllerUUID, payload)
+		dest, instanceUUID = sched.queueStart(controllerUUID, frame)
 	case ssntp.RESTART:
 		fallthrough
 	case ssntp.STOP:
@@ -760,11 +882,15 @@ func (sched *ssntpSchedulerServer) CommandForward(controllerUUID string, command
 		fallthrough
 	case ssntp.DetachVolume:
 		fallthrough
+	case ssntp.ConfigureSecurityGroups:
+		fallthrough
 	case ssntp.EVACUATE:
 		dest, instanceUUID = sched.fwdCmdToComputeNode(command, payload)
 	case ssntp.AssignPublicIP:
 		fallthrough
 	case ssntp.ReleasePublicIP:
+		fallthrough
+	case ssntp.ConfigureHealthChecks:
 		dest = sched.fwdCmdToCNCI(command, payload)
 	default:
 		dest.SetDecision(ssntp.Discard)
@@ -801,13 +927,22 @@ func (sched *ssntpSchedulerServer) EventForward(uuid string, event ssntp.Event,
 }
 
 func (sched *ssntpSchedulerServer) EventNotify(uuid string, event ssntp.Event, frame *ssntp.Frame) {
-	// Currently all events are handled by EventForward, the SSNTP command forwader,
-	// or directly by role defined forwarding rules.
+	// Events are forwarded by EventForward, the SSNTP command forwader,
+	// or directly by role defined forwarding rules. We only look at
+	// deleted instances to keep the fair-share accounting up to date.
 	glog.V(2).Infof("EVENT %v from %s\n", event, uuid)
+
+	if event == ssntp.InstanceDeleted {
+		sched.instanceDeleted(frame.Payload)
+	}
 }
 
 func (sched *ssntpSchedulerServer) ErrorNotify(uuid string, error ssntp.Error, frame *ssntp.Frame) {
 	glog.V(2).Infof("ERROR %v from %s\n", error, uuid)
+
+	if error == ssntp.StartFailure {
+		sched.instanceStartFailed(frame.Payload)
+	}
 }
 
 func setLimits() {
@@ -1004,6 +1139,14 @@ func setSSNTPForwardRules(sched *ssntpSchedulerServer) {
 			Operand: ssntp.InstanceDeleted,
 			Dest:    ssntp.Controller,
 		},
+		{ // all InstanceRestarted events go to all Controllers
+			Operand: ssntp.InstanceRestarted,
+			Dest:    ssntp.Controller,
+		},
+		{ // all InstanceHealth events go to all Controllers
+			Operand: ssntp.InstanceHealth,
+			Dest:    ssntp.Controller,
+		},
 		{ // all ConcentratorInstanceAdded events go to all Controllers
 			Operand: ssntp.ConcentratorInstanceAdded,
 			Dest:    ssntp.Controller,
@@ -1092,6 +1235,14 @@ func setSSNTPForwardRules(sched *ssntpSchedulerServer) {
 			Operand:        ssntp.ReleasePublicIP,
 			CommandForward: sched,
 		},
+		{ // all ConfigureHealthChecks commands are processed by the Command forwarder
+			Operand:        ssntp.ConfigureHealthChecks,
+			CommandForward: sched,
+		},
+		{ // all ConfigureSecurityGroups commands are processed by the Command forwarder
+			Operand:        ssntp.ConfigureSecurityGroups,
+			CommandForward: sched,
+		},
 	}
 }
 
@@ -1117,6 +1268,7 @@ func configSchedulerServer() (sched *ssntpSchedulerServer) {
 	sched = newSsntpSchedulerServer()
 	sched.cpuprofile = *cpuprofile
 	sched.heartbeat = *heartbeat
+	sched.preempt = *preempt
 
 	toggleDebug(sched)
 
@@ -1134,6 +1286,14 @@ func configSchedulerServer() (sched *ssntpSchedulerServer) {
 func main() {
 	flag.Parse()
 
+	if *simulate != "" {
+		if err := runSimulation(*simulate, os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "Simulation failed: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	if err := initLogger(); err != nil {
 		fmt.Printf("Unable to initialise logs: %v", err)
 		return
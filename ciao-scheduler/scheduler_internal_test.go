@@ -22,6 +22,7 @@ import (
 	"os"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/01org/ciao/payloads"
 	"github.com/01org/ciao/ssntp"
@@ -229,6 +230,71 @@ func TestPickComputeNode(t *testing.T) {
 	}
 }
 
+func TestPickNetworkNode(t *testing.T) {
+	sched = configSchedulerServer()
+	if sched == nil {
+		t.Fatal("unable to configure test scheduler")
+	}
+
+	var work = createStartWorkload(1, 256, 0)
+	resources, err := sched.getWorkloadResources(work)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resources.networkNode = 1
+
+	pick := func() string {
+		node := sched.pickNetworkNode("", &resources)
+		if node == nil {
+			return ""
+		}
+		sched.decrementResourceUsage(node, &resources)
+		node.mutex.Unlock()
+		return node.uuid
+	}
+
+	spinUpNetworkNodeVerySmall(sched, 1)
+	if uuid := pick(); uuid != "" {
+		t.Fatalf("found fit on %s when none should exist", uuid)
+	}
+
+	// CNCIs are balanced over the nodes which fit
+	spinUpNetworkNodeSmall(sched, 2)
+	spinUpNetworkNodeSmall(sched, 3)
+	counts := make(map[string]int)
+	for i := 0; i < 6; i++ {
+		counts[pick()]++
+	}
+	if counts["00000002"] != 3 || counts["00000003"] != 3 {
+		t.Fatalf("unbalanced CNCI placement %v", counts)
+	}
+
+	// deleted CNCIs free their slot
+	for i := 0; i < 2; i++ {
+		sched.releaseInstance("00000003", &resources)
+	}
+	if uuid := pick(); uuid != "00000003" {
+		t.Fatalf("expected least loaded node 00000003, got %s", uuid)
+	}
+
+	// a flapping node only gets CNCIs when nothing else fits
+	now := time.Now()
+	sched.nnDisconnects["00000003"] = []time.Time{now, now, now}
+	if uuid := pick(); uuid != "00000002" {
+		t.Fatalf("expected stable node 00000002, got %s", uuid)
+	}
+
+	sched.nnMap["00000002"].status = ssntp.FULL
+	if uuid := pick(); uuid != "00000003" {
+		t.Fatalf("expected flapping node 00000003, got %s", uuid)
+	}
+
+	sched.nnDisconnects["00000003"] = []time.Time{now.Add(-flapWindow), now, now}
+	if sched.nnFlapping("00000003", now) {
+		t.Fatal("old disconnections count as flapping")
+	}
+}
+
 func benchmarkPickComputeNode(b *testing.B, nodecount int) {
 	sched = configSchedulerServer()
 	if sched == nil {
@@ -359,6 +359,72 @@ func propagateInstanceDeleted() error {
 	return nil
 }
 
+func TestInstanceRestarted(t *testing.T) {
+	agentCh := agent.AddEventChan(ssntp.InstanceRestarted)
+	controllerCh := controller.AddEventChan(ssntp.InstanceRestarted)
+
+	go agent.SendRestartedEvent(testutil.InstanceUUID, 1)
+
+	_, err := agent.GetEventChanResult(agentCh, ssntp.InstanceRestarted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = controller.GetEventChanResult(controllerCh, ssntp.InstanceRestarted)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConfigureHealthChecks(t *testing.T) {
+	cnciAgentCh := cnciAgent.AddCmdChan(ssntp.ConfigureHealthChecks)
+
+	_, err := controller.Ssntp.SendCommand(ssntp.ConfigureHealthChecks, []byte(testutil.HealthChecksYaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := cnciAgent.GetCmdChanResult(cnciAgentCh, ssntp.ConfigureHealthChecks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.TenantUUID != testutil.TenantUUID {
+		t.Fatalf("wrong tenant UUID %s", result.TenantUUID)
+	}
+}
+
+func TestConfigureSecurityGroups(t *testing.T) {
+	agentCh := agent.AddCmdChan(ssntp.ConfigureSecurityGroups)
+
+	_, err := controller.Ssntp.SendCommand(ssntp.ConfigureSecurityGroups, []byte(testutil.SecurityGroupsYaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := agent.GetCmdChanResult(agentCh, ssntp.ConfigureSecurityGroups)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.TenantUUID != testutil.TenantUUID {
+		t.Fatalf("wrong tenant UUID %s", result.TenantUUID)
+	}
+}
+
+func TestInstanceHealth(t *testing.T) {
+	cnciAgentCh := cnciAgent.AddEventChan(ssntp.InstanceHealth)
+	controllerCh := controller.AddEventChan(ssntp.InstanceHealth)
+
+	go cnciAgent.SendInstanceHealthEvent(testutil.InstanceUUID, payloads.Unhealthy, "connection refused")
+
+	_, err := cnciAgent.GetEventChanResult(cnciAgentCh, ssntp.InstanceHealth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = controller.GetEventChanResult(controllerCh, ssntp.InstanceHealth)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestDelete(t *testing.T) {
 	fail := false
 
@@ -0,0 +1,536 @@
+//
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/01org/ciao/payloads"
+	"github.com/01org/ciao/ssntp"
+	"gopkg.in/yaml.v2"
+)
+
+// The offline simulator drives the production placement code (the
+// fair-share queue, startWorkload and the pick*Node policies behind it)
+// against a synthetic cluster, entirely in-process.  No SSNTP connections
+// are made: nodes are injected straight into the scheduler maps and their
+// READY statistics are refreshed by the simulator after every event,
+// as a launcher would do after starting or deleting an instance.  The
+// queue runs in simulated time, the STARTs which expire in it are the
+// rejected ones.
+
+const simControllerUUID = "00000000-0000-0000-0000-00000000c0de"
+
+type simOp string
+
+const (
+	simStart  simOp = "start"
+	simDelete simOp = "delete"
+)
+
+// simNodeClass describes count identical nodes in the synthetic cluster.
+type simNodeClass struct {
+	Count       int  `yaml:"count"`
+	MemMB       int  `yaml:"mem_mb"`
+	DiskMB      int  `yaml:"disk_mb"`
+	CPUs        int  `yaml:"cpus"`
+	NetworkNode bool `yaml:"network_node"`
+}
+
+// simEvent is a single START or DELETE in a recorded event stream.
+type simEvent struct {
+	Time        float64           `yaml:"time"`
+	Op          simOp             `yaml:"op"`
+	Instance    string            `yaml:"instance"`
+	Tenant      string            `yaml:"tenant,omitempty"`
+	Priority    payloads.Priority `yaml:"priority,omitempty"`
+	Weight      int               `yaml:"weight,omitempty"`
+	MemMB       int               `yaml:"mem_mb,omitempty"`
+	DiskMB      int               `yaml:"disk_mb,omitempty"`
+	NetworkNode bool              `yaml:"network_node,omitempty"`
+}
+
+// simWorkload is one entry of the workload mix used to generate events.
+type simWorkload struct {
+	MemMB       int  `yaml:"mem_mb"`
+	DiskMB      int  `yaml:"disk_mb"`
+	NetworkNode bool `yaml:"network_node"`
+	Weight      int  `yaml:"weight"`
+}
+
+// simGenerator describes a synthetic event stream with exponentially
+// distributed inter-arrival times and instance lifetimes.
+type simGenerator struct {
+	Seed      int64         `yaml:"seed"`
+	Starts    int           `yaml:"starts"`
+	Interval  float64       `yaml:"interval"`
+	Lifetime  float64       `yaml:"lifetime"`
+	Workloads []simWorkload `yaml:"workloads"`
+}
+
+// simConfig is the top level simulation description.  Events, when
+// present, take precedence over Generate.
+type simConfig struct {
+	Nodes          []simNodeClass `yaml:"nodes"`
+	Events         []simEvent     `yaml:"events"`
+	Generate       *simGenerator  `yaml:"generate"`
+	ReportInterval float64        `yaml:"report_interval"`
+}
+
+type simPlacement struct {
+	node   *nodeStat
+	memMB  int
+	diskMB int
+}
+
+type simNode struct {
+	stat       *nodeStat
+	memUsedMB  int
+	diskUsedMB int
+}
+
+type simSample struct {
+	time          float64
+	running       int
+	queued        int
+	memUtil       float64
+	diskUtil      float64
+	fragmentation float64
+	starts        int
+	rejected      int
+}
+
+type simEvents []simEvent
+
+func (e simEvents) Len() int           { return len(e) }
+func (e simEvents) Swap(i, j int)      { e[i], e[j] = e[j], e[i] }
+func (e simEvents) Less(i, j int) bool { return e[i].Time < e[j].Time }
+
+type simulator struct {
+	sched     *ssntpSchedulerServer
+	nodes     map[string]*simNode
+	instances map[string]simPlacement
+	starts    int
+	rejected  int
+	samples   []simSample
+
+	// clock is the simulated time, queued are the STARTs waiting in
+	// the fair-share queue and deleted the queued instances deleted
+	// before they started
+	clock   float64
+	queued  map[*ssntp.Frame]*simEvent
+	deleted map[string]bool
+	err     error
+}
+
+func loadSimConfig(path string) (*simConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config simConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("Bad simulation yaml %s: %v", path, err)
+	}
+
+	return &config, nil
+}
+
+func (config *simConfig) validate() error {
+	if len(config.Nodes) == 0 {
+		return fmt.Errorf("simulation needs at least one node class")
+	}
+
+	for i, class := range config.Nodes {
+		if class.Count <= 0 || class.MemMB <= 0 {
+			return fmt.Errorf("node class %d: count and mem_mb must be > 0", i)
+		}
+	}
+
+	if len(config.Events) == 0 && config.Generate == nil {
+		return fmt.Errorf("simulation needs either events or a generator")
+	}
+
+	if config.Generate != nil && len(config.Events) == 0 {
+		gen := config.Generate
+		if gen.Starts <= 0 || gen.Interval <= 0 || gen.Lifetime <= 0 {
+			return fmt.Errorf("generator starts, interval and lifetime must be > 0")
+		}
+		if len(gen.Workloads) == 0 {
+			return fmt.Errorf("generator needs at least one workload")
+		}
+	}
+
+	return nil
+}
+
+// generateEvents builds a START/DELETE stream from the generator
+// description.  The result is deterministic for a given seed.
+func (gen *simGenerator) generateEvents() []simEvent {
+	r := rand.New(rand.NewSource(gen.Seed))
+
+	totalWeight := 0
+	for _, w := range gen.Workloads {
+		if w.Weight <= 0 {
+			totalWeight++
+		} else {
+			totalWeight += w.Weight
+		}
+	}
+
+	var events []simEvent
+	now := 0.0
+	for i := 0; i < gen.Starts; i++ {
+		now += r.ExpFloat64() * gen.Interval
+
+		pick := r.Intn(totalWeight)
+		var workload simWorkload
+		for _, w := range gen.Workloads {
+			weight := w.Weight
+			if weight <= 0 {
+				weight = 1
+			}
+			if pick < weight {
+				workload = w
+				break
+			}
+			pick -= weight
+		}
+
+		instance := fmt.Sprintf("sim-instance-%d", i)
+		events = append(events, simEvent{
+			Time:        now,
+			Op:          simStart,
+			Instance:    instance,
+			MemMB:       workload.MemMB,
+			DiskMB:      workload.DiskMB,
+			NetworkNode: workload.NetworkNode,
+		}, simEvent{
+			Time:     now + r.ExpFloat64()*gen.Lifetime,
+			Op:       simDelete,
+			Instance: instance,
+		})
+	}
+
+	return events
+}
+
+func newSimulator(config *simConfig) *simulator {
+	sim := &simulator{
+		sched:     newSsntpSchedulerServer(),
+		nodes:     make(map[string]*simNode),
+		instances: make(map[string]simPlacement),
+		queued:    make(map[*ssntp.Frame]*simEvent),
+		deleted:   make(map[string]bool),
+	}
+
+	sim.sched.forward = sim.forward
+	sim.sched.fairShare.now = sim.now
+	// the queue is dispatched at every event, no timer is needed
+	sim.sched.fairShare.after = func(time.Duration, func()) {}
+
+	connectController(sim.sched, simControllerUUID)
+
+	id := 0
+	for _, class := range config.Nodes {
+		for i := 0; i < class.Count; i++ {
+			node := &nodeStat{
+				status:      ssntp.READY,
+				uuid:        fmt.Sprintf("sim-node-%d", id),
+				memTotalMB:  class.MemMB,
+				memAvailMB:  class.MemMB,
+				diskTotalMB: class.DiskMB,
+				diskAvailMB: class.DiskMB,
+				cpus:        class.CPUs,
+			}
+			id++
+
+			if class.NetworkNode {
+				sim.sched.nnMap[node.uuid] = node
+			} else {
+				sim.sched.cnList = append(sim.sched.cnList, node)
+				sim.sched.cnMap[node.uuid] = node
+			}
+			sim.nodes[node.uuid] = &simNode{stat: node}
+		}
+	}
+
+	return sim
+}
+
+func (sim *simulator) startPayload(event *simEvent) ([]byte, error) {
+	var work payloads.Start
+
+	work.Start.InstanceUUID = event.Instance
+	work.Start.TenantUUID = event.Tenant
+	work.Start.Priority = event.Priority
+	work.Start.TenantWeight = event.Weight
+	work.Start.RequestedResources = []payloads.RequestedResource{
+		{Type: payloads.MemMB, Value: event.MemMB, Mandatory: true},
+	}
+	if event.NetworkNode {
+		work.Start.RequestedResources = append(work.Start.RequestedResources,
+			payloads.RequestedResource{Type: payloads.NetworkNode, Value: 1, Mandatory: true})
+	}
+	if event.DiskMB > 0 {
+		// getWorkloadResources counts local storage in GB
+		work.Start.Storage = []payloads.StorageResource{
+			{Local: true, Ephemeral: true, Size: (event.DiskMB + 1023) / 1024},
+		}
+	}
+
+	return yaml.Marshal(&work)
+}
+
+// refreshNode emulates the READY frame a launcher sends after its
+// resource usage has changed.
+func (sim *simulator) refreshNode(node *simNode) {
+	node.stat.mutex.Lock()
+	node.stat.memAvailMB = node.stat.memTotalMB - node.memUsedMB
+	node.stat.diskAvailMB = node.stat.diskTotalMB - node.diskUsedMB
+	node.stat.mutex.Unlock()
+}
+
+// now returns the simulated time.
+func (sim *simulator) now() time.Time {
+	return time.Unix(0, 0).Add(time.Duration(sim.clock * float64(time.Second)))
+}
+
+func (sim *simulator) start(event *simEvent) error {
+	if _, ok := sim.instances[event.Instance]; ok {
+		return fmt.Errorf("duplicate start for instance %s", event.Instance)
+	}
+
+	payload, err := sim.startPayload(event)
+	if err != nil {
+		return err
+	}
+
+	sim.starts++
+
+	frame := &ssntp.Frame{Payload: payload}
+	sim.queued[frame] = event
+
+	dest, _ := sim.sched.queueStart(simControllerUUID, frame)
+	if dest.Decision() != ssntp.Queue {
+		delete(sim.queued, frame)
+		sim.rejected++
+	}
+
+	return nil
+}
+
+// forward places the instances the scheduler dispatches, as their
+// launcher would.
+func (sim *simulator) forward(dest ssntp.ForwardDestination, frame *ssntp.Frame) {
+	event := sim.queued[frame]
+	if event == nil {
+		return
+	}
+	delete(sim.queued, frame)
+
+	recipients := dest.Recipients()
+	if dest.Decision() != ssntp.Forward || len(recipients) != 1 {
+		sim.rejected++
+		return
+	}
+
+	node := sim.nodes[recipients[0]]
+	if node == nil {
+		sim.err = fmt.Errorf("instance %s placed on unknown node %s", event.Instance, recipients[0])
+		return
+	}
+
+	diskMB := 0
+	if event.DiskMB > 0 {
+		diskMB = ((event.DiskMB + 1023) / 1024) * 1024
+	}
+
+	node.memUsedMB += event.MemMB
+	node.diskUsedMB += diskMB
+	sim.refreshNode(node)
+
+	sim.instances[event.Instance] = simPlacement{
+		node:   node.stat,
+		memMB:  event.MemMB,
+		diskMB: diskMB,
+	}
+
+	// the instance was deleted while queued
+	if sim.deleted[event.Instance] {
+		delete(sim.deleted, event.Instance)
+		sim.release(event.Instance)
+	}
+}
+
+func (sim *simulator) delete(event *simEvent) {
+	for _, queued := range sim.queued {
+		if queued.Instance == event.Instance {
+			sim.deleted[event.Instance] = true
+			return
+		}
+	}
+
+	sim.release(event.Instance)
+}
+
+// release frees the resources of an instance, nothing is released for
+// the rejected ones.
+func (sim *simulator) release(instance string) {
+	placement, ok := sim.instances[instance]
+	if !ok {
+		return
+	}
+	delete(sim.instances, instance)
+
+	node := sim.nodes[placement.node.uuid]
+	node.memUsedMB -= placement.memMB
+	node.diskUsedMB -= placement.diskMB
+	sim.refreshNode(node)
+
+	sim.sched.instanceGone(instance)
+}
+
+// sample records the cluster state.  Fragmentation is the share of free
+// compute node memory which is not on the node with the largest free
+// block, i.e. 0 when all free memory is in one place.
+func (sim *simulator) sample(now float64) {
+	s := simSample{
+		time:     now,
+		running:  len(sim.instances),
+		queued:   len(sim.queued),
+		starts:   sim.starts,
+		rejected: sim.rejected,
+	}
+
+	var memTotal, memUsed, diskTotal, diskUsed, memFree, largestFree int
+	for _, node := range sim.sched.cnList {
+		n := sim.nodes[node.uuid]
+		memTotal += node.memTotalMB
+		memUsed += n.memUsedMB
+		diskTotal += node.diskTotalMB
+		diskUsed += n.diskUsedMB
+
+		free := node.memTotalMB - n.memUsedMB
+		memFree += free
+		if free > largestFree {
+			largestFree = free
+		}
+	}
+
+	if memTotal > 0 {
+		s.memUtil = float64(memUsed) / float64(memTotal)
+	}
+	if diskTotal > 0 {
+		s.diskUtil = float64(diskUsed) / float64(diskTotal)
+	}
+	if memFree > 0 {
+		s.fragmentation = 1 - float64(largestFree)/float64(memFree)
+	}
+
+	sim.samples = append(sim.samples, s)
+}
+
+func (sim *simulator) run(events []simEvent, reportInterval float64) error {
+	sort.Stable(simEvents(events))
+
+	nextReport := reportInterval
+	for i := range events {
+		event := &events[i]
+
+		for reportInterval > 0 && event.Time >= nextReport {
+			sim.sample(nextReport)
+			nextReport += reportInterval
+		}
+
+		// expire the STARTs which waited too long
+		sim.clock = event.Time
+		sim.sched.dispatchPending()
+
+		switch event.Op {
+		case simStart:
+			if err := sim.start(event); err != nil {
+				return err
+			}
+		case simDelete:
+			sim.delete(event)
+		default:
+			return fmt.Errorf("unknown simulation op \"%s\" at time %v", event.Op, event.Time)
+		}
+
+		if sim.err != nil {
+			return sim.err
+		}
+	}
+
+	end := 0.0
+	if len(events) > 0 {
+		end = events[len(events)-1].Time
+	}
+	sim.sample(end)
+
+	return nil
+}
+
+func (s simSample) rejectionRate() float64 {
+	if s.starts == 0 {
+		return 0
+	}
+	return float64(s.rejected) / float64(s.starts)
+}
+
+func (sim *simulator) report(w io.Writer) {
+	fmt.Fprintf(w, "%10s %8s %8s %7s %7s %7s %8s %8s %7s\n",
+		"time", "running", "queued", "mem%", "disk%", "frag%", "starts", "rejected", "rej%")
+
+	for _, s := range sim.samples {
+		fmt.Fprintf(w, "%10.1f %8d %8d %7.1f %7.1f %7.1f %8d %8d %7.1f\n",
+			s.time, s.running, s.queued, s.memUtil*100, s.diskUtil*100,
+			s.fragmentation*100, s.starts, s.rejected, s.rejectionRate()*100)
+	}
+}
+
+func runSimulation(path string, w io.Writer) error {
+	config, err := loadSimConfig(path)
+	if err != nil {
+		return err
+	}
+
+	if err := config.validate(); err != nil {
+		return err
+	}
+
+	events := config.Events
+	if len(events) == 0 {
+		events = config.Generate.generateEvents()
+	}
+
+	sim := newSimulator(config)
+	if err := sim.run(events, config.ReportInterval); err != nil {
+		return err
+	}
+
+	sim.report(w)
+
+	return nil
+}
@@ -0,0 +1,258 @@
+//
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/01org/ciao/payloads"
+)
+
+const testSimRecorded = `
+nodes:
+  - count: 2
+    mem_mb: 1024
+    disk_mb: 10240
+events:
+  - {time: 1, op: start, instance: a, mem_mb: 512}
+  - {time: 2, op: start, instance: b, mem_mb: 1024}
+  - {time: 3, op: start, instance: c, mem_mb: 1024}
+  - {time: 4, op: delete, instance: a}
+  - {time: 5, op: start, instance: d, mem_mb: 1024}
+  - {time: 6, op: delete, instance: c}
+`
+
+func TestSimulateRecorded(t *testing.T) {
+	f, err := ioutil.TempFile("", "sim")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.WriteString(testSimRecorded); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	config, err := loadSimConfig(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := config.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	sim := newSimulator(config)
+	if err := sim.run(config.Events, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// c waits while a holds half of the first node and takes its place,
+	// d waits for c to be deleted.
+	if sim.starts != 4 || sim.rejected != 0 {
+		t.Fatalf("expected 4 starts, no rejection, got %d, %d", sim.starts, sim.rejected)
+	}
+
+	if len(sim.samples) != 1 {
+		t.Fatalf("expected a single final sample, got %d", len(sim.samples))
+	}
+
+	s := sim.samples[0]
+	if s.running != 2 || s.memUtil != 1 || s.fragmentation != 0 {
+		t.Fatalf("unexpected final sample %+v", s)
+	}
+
+	var out bytes.Buffer
+	if err := runSimulation(f.Name(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "rej%") {
+		t.Fatalf("report missing header: %s", out.String())
+	}
+}
+
+func simulatedPlacements(t *testing.T, sim *simulator, running []string, queued []string) {
+	if len(sim.instances) != len(running) || len(sim.queued) != len(queued) {
+		t.Fatalf("expected %v running and %v queued, got %v and %d queued",
+			running, queued, sim.instances, len(sim.queued))
+	}
+
+	for _, instance := range running {
+		if _, ok := sim.instances[instance]; !ok {
+			t.Fatalf("instance %s not running", instance)
+		}
+	}
+
+	for _, instance := range queued {
+		found := false
+		for _, event := range sim.queued {
+			found = found || event.Instance == instance
+		}
+		if !found {
+			t.Fatalf("instance %s not queued", instance)
+		}
+	}
+}
+
+func TestSimulateQueued(t *testing.T) {
+	sim := newSimulator(&simConfig{Nodes: []simNodeClass{{Count: 1, MemMB: 1024}}})
+
+	// big waits for room without holding small back
+	err := sim.run([]simEvent{
+		{Time: 1, Op: simStart, Instance: "a", MemMB: 512},
+		{Time: 2, Op: simStart, Instance: "big", MemMB: 1024},
+		{Time: 3, Op: simStart, Instance: "small", MemMB: 512},
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	simulatedPlacements(t, sim, []string{"a", "small"}, []string{"big"})
+
+	err = sim.run([]simEvent{{Time: 4, Op: simDelete, Instance: "a"}}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	simulatedPlacements(t, sim, []string{"small"}, []string{"big"})
+
+	err = sim.run([]simEvent{{Time: 5, Op: simDelete, Instance: "small"}}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	simulatedPlacements(t, sim, []string{"big"}, nil)
+
+	// c expires before big is deleted
+	expiry := 6 + startTimeout.Seconds()
+	err = sim.run([]simEvent{
+		{Time: 6, Op: simStart, Instance: "c", MemMB: 1024},
+		{Time: expiry, Op: simDelete, Instance: "big"},
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	simulatedPlacements(t, sim, nil, nil)
+
+	if sim.starts != 4 || sim.rejected != 1 {
+		t.Fatalf("expected 4 starts, 1 rejection, got %d, %d", sim.starts, sim.rejected)
+	}
+}
+
+func TestSimulateFairShare(t *testing.T) {
+	sim := newSimulator(&simConfig{Nodes: []simNodeClass{{Count: 2, MemMB: 1024}}})
+
+	// b1 goes first once a1 has gone, as tenant a still runs a2
+	err := sim.run([]simEvent{
+		{Time: 1, Op: simStart, Instance: "a1", Tenant: "a", MemMB: 1024},
+		{Time: 2, Op: simStart, Instance: "a2", Tenant: "a", MemMB: 1024},
+		{Time: 3, Op: simStart, Instance: "a3", Tenant: "a", MemMB: 1024},
+		{Time: 4, Op: simStart, Instance: "b1", Tenant: "b", MemMB: 1024},
+		{Time: 5, Op: simDelete, Instance: "a1"},
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	simulatedPlacements(t, sim, []string{"a2", "b1"}, []string{"a3"})
+
+	// preemptible instances are started last
+	err = sim.run([]simEvent{
+		{Time: 6, Op: simStart, Instance: "c1", Tenant: "c", Priority: payloads.PreemptiblePriority, MemMB: 1024},
+		{Time: 7, Op: simStart, Instance: "c2", Tenant: "c", Priority: payloads.HighPriority, MemMB: 1024},
+		{Time: 8, Op: simDelete, Instance: "b1"},
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	simulatedPlacements(t, sim, []string{"a2", "c2"}, []string{"a3", "c1"})
+}
+
+func TestSimulateGenerated(t *testing.T) {
+	config := &simConfig{
+		Nodes: []simNodeClass{
+			{Count: 4, MemMB: 4096, DiskMB: 40960},
+			{Count: 1, MemMB: 4096, NetworkNode: true},
+		},
+		Generate: &simGenerator{
+			Seed:     42,
+			Starts:   200,
+			Interval: 1,
+			Lifetime: 30,
+			Workloads: []simWorkload{
+				{MemMB: 512, Weight: 3},
+				{MemMB: 2048, DiskMB: 2048, Weight: 1},
+				{MemMB: 128, NetworkNode: true},
+			},
+		},
+		ReportInterval: 10,
+	}
+	if err := config.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	events := config.Generate.generateEvents()
+	if len(events) != 400 {
+		t.Fatalf("expected 400 events, got %d", len(events))
+	}
+	if !reflect.DeepEqual(events, config.Generate.generateEvents()) {
+		t.Fatal("event generation is not deterministic")
+	}
+
+	sim := newSimulator(config)
+	if err := sim.run(events, config.ReportInterval); err != nil {
+		t.Fatal(err)
+	}
+
+	if sim.starts != 200 {
+		t.Fatalf("expected 200 starts, got %d", sim.starts)
+	}
+	if len(sim.instances) != 0 {
+		t.Fatalf("%d instances still running at end of simulation", len(sim.instances))
+	}
+
+	for _, node := range sim.nodes {
+		if node.memUsedMB != 0 || node.stat.memAvailMB != node.stat.memTotalMB {
+			t.Fatalf("node %s leaked resources", node.stat.uuid)
+		}
+	}
+
+	if len(sim.samples) < 2 {
+		t.Fatalf("expected periodic samples, got %d", len(sim.samples))
+	}
+}
+
+func TestSimulateInvalid(t *testing.T) {
+	configs := []simConfig{
+		{},
+		{Nodes: []simNodeClass{{Count: 1, MemMB: 1024}}},
+		{Nodes: []simNodeClass{{Count: 0, MemMB: 1024}}, Events: []simEvent{{}}},
+		{Nodes: []simNodeClass{{Count: 1, MemMB: 1024}}, Generate: &simGenerator{Starts: 1}},
+	}
+
+	for i, config := range configs {
+		if err := config.validate(); err == nil {
+			t.Errorf("config %d: expected validation failure", i)
+		}
+	}
+
+	sim := newSimulator(&simConfig{Nodes: []simNodeClass{{Count: 1, MemMB: 1024}}})
+	if err := sim.run([]simEvent{{Op: "reboot"}}, 0); err == nil {
+		t.Fatal("expected failure on unknown op")
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"encoding/gob"
 	"fmt"
+	"io"
 	"os"
 	"path"
 	"time"
@@ -221,3 +222,11 @@ func (db *BoltDB) DbGetAll(table string, dbTable DbTable) (elements []interface{
 
 	return elements, err
 }
+
+// DbBackup writes a consistent copy of the database to w
+func (db *BoltDB) DbBackup(w io.Writer) error {
+	return db.DB.View(func(tx *bolt.Tx) error {
+		_, err := tx.WriteTo(w)
+		return err
+	})
+}
@@ -16,6 +16,8 @@
 
 package database
 
+import "io"
+
 // DbTable defines basic table operations
 type DbTable interface {
 	// Creates the backing map
@@ -46,4 +48,6 @@ type DbProvider interface {
 	DbGet(table string, key string, dbTable DbTable) (interface{}, error)
 	//Retrieves all values from a table
 	DbGetAll(table string, dbTable DbTable) ([]interface{}, error)
+	//Writes a consistent copy of the database to w
+	DbBackup(w io.Writer) error
 }
@@ -218,6 +218,52 @@ func testDbGetAll(t *testing.T, provider Provider) {
 	}
 }
 
+func testDbBackup(t *testing.T, provider Provider) {
+	defer closeDb(&provider)
+
+	err := provider.Db.DbInit(provider.DbDir, provider.DbFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = provider.Db.DbTablesInit(provider.DbTables)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = provider.Db.DbAdd(provider.DbTables[0], "sampleKey", TestData{ID: "sampleKey"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backupFile := "backup-" + provider.DbFile
+	f, err := os.Create(path.Join(provider.DbDir, backupFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Remove(path.Join(provider.DbDir, backupFile)) }()
+
+	err = provider.Db.DbBackup(f)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backup := initProvider(NewBoltDBProvider())
+	backup.DbFile = backupFile
+
+	err = backup.Db.DbInit(backup.DbDir, backup.DbFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeDb(&backup)
+
+	_, err = backup.Db.DbGet(backup.DbTables[0], "sampleKey", &TestMap{})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
 // Test for BoltDb Provider
 
 func TestBoltDbInit(t *testing.T) {
@@ -261,3 +307,9 @@ func TestBoltDbGetAll(t *testing.T) {
 	testDbGetAll(t, provider)
 	_ = os.Remove(path.Join(dbDir, dbFile))
 }
+
+func TestBoltDbBackup(t *testing.T) {
+	provider := initProvider(NewBoltDBProvider())
+	testDbBackup(t, provider)
+	_ = os.Remove(path.Join(dbDir, dbFile))
+}
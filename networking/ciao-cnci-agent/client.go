@@ -230,6 +230,14 @@ func processCommand(client *ssntpConn, cmd *cmdWrapper) {
 			}
 		}(cmd)
 
+	case *payloads.CommandConfigureHealthChecks:
+
+		go func(cmd *cmdWrapper) {
+			c := &netCmd.HealthChecks
+			glog.Infof("Processing: CiaoCommandConfigureHealthChecks %v", c)
+			configureHealthChecks(client, c)
+		}(cmd)
+
 	case *statusConnected:
 		//Block and send this as it does not make sense to send other events
 		//or process commands when we have not yet registered
@@ -289,6 +297,21 @@ func (client *agentClient) CommandNotify(cmd ssntp.Command, frame *ssntp.Frame)
 			client.cmdCh <- &cmdWrapper{&releaseIP}
 		}(payload)
 
+	case ssntp.ConfigureHealthChecks:
+		glog.Infof("CMD: ssntp.ConfigureHealthChecks %v", len(payload))
+
+		go func(payload []byte) {
+			var healthChecks payloads.CommandConfigureHealthChecks
+			err := yaml.Unmarshal(payload, &healthChecks)
+			if err != nil {
+				glog.Warning("Error unmarshalling ConfigureHealthChecks")
+				return
+			}
+			glog.Infof("EVENT: ssntp.ConfigureHealthChecks %v", healthChecks)
+
+			client.cmdCh <- &cmdWrapper{&healthChecks}
+		}(payload)
+
 	default:
 		glog.Infof("CMD: %s", cmd)
 	}
@@ -517,6 +540,10 @@ func main() {
 		glog.Fatalf("Unable to setup network. %+v", err)
 	}
 
+	if err := startMetadataProxy(); err != nil {
+		glog.Errorf("Unable to start metadata proxy. %+v", err)
+	}
+
 	//Recover the state from the database and then
 	//recreate the CNCI state by replaying the commands
 	//Has to be done prior to accepting commands over the network
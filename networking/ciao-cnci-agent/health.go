@@ -0,0 +1,237 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/01org/ciao/payloads"
+	"github.com/01org/ciao/ssntp"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+//Defaults used when the controller leaves a field of a health check unset
+const (
+	healthDefaultInterval           = 10
+	healthDefaultTimeout            = 5
+	healthDefaultHealthyThreshold   = 2
+	healthDefaultUnhealthyThreshold = 3
+)
+
+type healthProbe struct {
+	target payloads.HealthCheckTarget
+	cnci   string
+	tenant string
+	stopCh chan struct{}
+}
+
+//healthMonitor runs the health checks of the tenant instances. The health
+//of an instance is only reported when it changes, or when the controller
+//reconfigures the checks, and it is not persisted: the controller pushes
+//the checks again periodically
+type healthMonitor struct {
+	sync.Mutex
+	client *ssntpConn
+	probes map[string]*healthProbe
+	health map[string]payloads.InstanceHealthEvent
+}
+
+var gHealth = &healthMonitor{
+	probes: make(map[string]*healthProbe),
+	health: make(map[string]payloads.InstanceHealthEvent),
+}
+
+func healthCheckDefaults(check payloads.HealthCheck) payloads.HealthCheck {
+	if check.Interval <= 0 {
+		check.Interval = healthDefaultInterval
+	}
+	if check.Timeout <= 0 {
+		check.Timeout = healthDefaultTimeout
+	}
+	if check.HealthyThreshold <= 0 {
+		check.HealthyThreshold = healthDefaultHealthyThreshold
+	}
+	if check.UnhealthyThreshold <= 0 {
+		check.UnhealthyThreshold = healthDefaultUnhealthyThreshold
+	}
+	return check
+}
+
+//configureHealthChecks replaces the health checks run by the CNCI with the
+//ones of the command. Unchanged checks keep running and the health they
+//already found is reported again
+func configureHealthChecks(client *ssntpConn, cmd *payloads.HealthChecksCommand) {
+	var known []payloads.InstanceHealthEvent
+
+	m := gHealth
+	m.Lock()
+	m.client = client
+
+	targets := make(map[string]payloads.HealthCheckTarget)
+	for _, t := range cmd.Targets {
+		t.Check = healthCheckDefaults(t.Check)
+		targets[t.InstanceUUID] = t
+	}
+
+	for id, p := range m.probes {
+		t, ok := targets[id]
+		if ok && t == p.target {
+			if h, ok := m.health[id]; ok {
+				known = append(known, h)
+			}
+			delete(targets, id)
+			continue
+		}
+		close(p.stopCh)
+		delete(m.probes, id)
+		delete(m.health, id)
+	}
+
+	for id, t := range targets {
+		p := &healthProbe{
+			target: t,
+			cnci:   cmd.ConcentratorUUID,
+			tenant: cmd.TenantUUID,
+			stopCh: make(chan struct{}),
+		}
+		m.probes[id] = p
+		go m.run(p)
+	}
+	m.Unlock()
+
+	for i := range known {
+		if err := sendNetworkEvent(client, ssntp.InstanceHealth, &known[i]); err != nil {
+			glog.Errorf("Unable to send event : %+v", err)
+		}
+	}
+}
+
+func (m *healthMonitor) run(p *healthProbe) {
+	var successes, failures int
+	var health payloads.HealthStatus
+
+	check := p.target.Check
+	ticker := time.NewTicker(time.Duration(check.Interval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		err := probe(p.target)
+		if err == nil {
+			successes++
+			failures = 0
+		} else {
+			glog.V(1).Infof("Health check of %s failed: %v", p.target.InstanceUUID, err)
+			failures++
+			successes = 0
+		}
+
+		var reason string
+		changed := false
+		if successes >= check.HealthyThreshold && health != payloads.Healthy {
+			health = payloads.Healthy
+			changed = true
+		} else if failures >= check.UnhealthyThreshold && health != payloads.Unhealthy {
+			health = payloads.Unhealthy
+			reason = err.Error()
+			changed = true
+		}
+
+		if changed {
+			m.report(p, health, reason)
+		}
+
+		select {
+		case <-p.stopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *healthMonitor) report(p *healthProbe, health payloads.HealthStatus, reason string) {
+	evt := payloads.InstanceHealthEvent{
+		ConcentratorUUID: p.cnci,
+		TenantUUID:       p.tenant,
+		InstanceUUID:     p.target.InstanceUUID,
+		Health:           health,
+		Reason:           reason,
+	}
+
+	m.Lock()
+	if m.probes[p.target.InstanceUUID] != p {
+		//The check was removed while the probe was running
+		m.Unlock()
+		return
+	}
+	m.health[p.target.InstanceUUID] = evt
+	client := m.client
+	m.Unlock()
+
+	glog.Infof("Instance %s is %s %s", evt.InstanceUUID, health, reason)
+
+	if err := sendNetworkEvent(client, ssntp.InstanceHealth, &evt); err != nil {
+		glog.Errorf("Unable to send event : %+v", err)
+	}
+}
+
+func probe(target payloads.HealthCheckTarget) error {
+	check := target.Check
+	timeout := time.Duration(check.Timeout) * time.Second
+	addr := net.JoinHostPort(target.PrivateIP, strconv.Itoa(check.Port))
+
+	switch check.Protocol {
+	case payloads.HealthCheckTCP:
+		conn, err := net.DialTimeout("tcp", addr, timeout)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	case payloads.HealthCheckHTTP:
+		url := fmt.Sprintf("http://%s/%s", addr, strings.TrimPrefix(check.Path, "/"))
+		client := &http.Client{Timeout: timeout}
+		resp, err := client.Get(url)
+		if err != nil {
+			return err
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+			return errors.Errorf("GET %s returned %s", url, resp.Status)
+		}
+		return nil
+	default:
+		return errors.Errorf("unsupported health check protocol %s", check.Protocol)
+	}
+}
+
+func instanceHealthMarshal(evt *payloads.InstanceHealthEvent) ([]byte, error) {
+	var instanceHealth payloads.EventInstanceHealth
+
+	instanceHealth.InstanceHealth = *evt
+
+	glog.Infoln("instanceHealthMarshal Event ", instanceHealth)
+
+	return yaml.Marshal(&instanceHealth)
+}
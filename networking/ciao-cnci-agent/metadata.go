@@ -0,0 +1,175 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/01org/ciao/payloads"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+	"github.com/vishvananda/netlink"
+)
+
+// metadataAddr is the well known address guests expect to find the
+// OpenStack and EC2 metadata services on.
+const metadataAddr = "169.254.169.254"
+
+var arpTable = "/proc/net/arp"
+
+var metadataURL string
+var metadataSecret string
+var metadataCACert string
+
+func init() {
+	flag.StringVar(&metadataURL, "metadata-url", "", "URL of the controller metadata service. Metadata proxy disabled if empty")
+	flag.StringVar(&metadataSecret, "metadata-secret", "", "Secret shared with the controller metadata service")
+	flag.StringVar(&metadataCACert, "metadata-cacert", "", "CA certificate of the controller metadata service")
+}
+
+// lookupMAC returns the hardware address the kernel has learnt for ip
+// on one of the tenant bridges.
+func lookupMAC(ip string) (string, error) {
+	f, err := os.Open(arpTable)
+	if err != nil {
+		return "", errors.Wrapf(err, "open %s", arpTable)
+	}
+	defer func() { _ = f.Close() }()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// IP address, HW type, Flags, HW address, Mask, Device
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 || fields[0] != ip {
+			continue
+		}
+
+		if fields[3] == "00:00:00:00:00:00" {
+			break
+		}
+
+		return strings.ToLower(fields[3]), nil
+	}
+
+	return "", errors.Errorf("no neighbour entry for %s", ip)
+}
+
+type metadataProxy struct {
+	proxy *httputil.ReverseProxy
+}
+
+func (p *metadataProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		http.Error(w, "Invalid remote address", http.StatusBadRequest)
+		return
+	}
+
+	mac, err := lookupMAC(ip)
+	if err != nil {
+		glog.Warningf("Metadata request rejected: %v", err)
+		http.Error(w, "Unknown instance", http.StatusForbidden)
+		return
+	}
+
+	r.Header.Del(payloads.MetadataIPHeader)
+	r.Header.Set(payloads.MetadataCNCIHeader, agentUUID)
+	r.Header.Set(payloads.MetadataIPHeader, ip)
+	r.Header.Set(payloads.MetadataMACHeader, mac)
+	r.Header.Set(payloads.MetadataSignatureHeader, payloads.MetadataSignature(metadataSecret, agentUUID, ip, mac))
+
+	// The reverse proxy appends the client address to X-Forwarded-For,
+	// clear the remote address so that the header carries only ip.
+	r.RemoteAddr = ""
+
+	p.proxy.ServeHTTP(w, r)
+}
+
+func newMetadataProxy() (*metadataProxy, error) {
+	target, err := url.Parse(metadataURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid metadata url %s", metadataURL)
+	}
+
+	proxy := httputil.NewSingleHostReverseProxy(target)
+
+	if metadataCACert != "" {
+		cert, err := ioutil.ReadFile(metadataCACert)
+		if err != nil {
+			return nil, errors.Wrapf(err, "read %s", metadataCACert)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(cert) {
+			return nil, errors.Errorf("invalid CA certificate %s", metadataCACert)
+		}
+
+		proxy.Transport = &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: pool},
+		}
+	}
+
+	return &metadataProxy{proxy: proxy}, nil
+}
+
+// startMetadataProxy makes the metadata address reachable from the tenant
+// subnets and forwards requests sent to it to the controller, tagged with
+// the IP and MAC address of the requesting instance.
+func startMetadataProxy() error {
+	if metadataURL == "" {
+		return nil
+	}
+
+	if metadataSecret == "" {
+		return errors.New("metadata-secret is required by the metadata proxy")
+	}
+
+	p, err := newMetadataProxy()
+	if err != nil {
+		return err
+	}
+
+	if enableNetwork {
+		lo, err := netlink.LinkByName("lo")
+		if err != nil {
+			return errors.Wrap(err, "metadata loopback")
+		}
+
+		addr, _ := netlink.ParseAddr(metadataAddr + "/32")
+		if err := netlink.AddrAdd(lo, addr); err != nil && !os.IsExist(err) {
+			return errors.Wrapf(err, "metadata address %s", metadataAddr)
+		}
+	}
+
+	go func() {
+		glog.Infof("Starting metadata proxy on %s", metadataAddr)
+		err := http.ListenAndServe(metadataAddr+":80", p)
+		glog.Errorf("Metadata proxy exited: %v", err)
+	}()
+
+	return nil
+}
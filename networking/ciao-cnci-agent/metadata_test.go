@@ -0,0 +1,112 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/01org/ciao/payloads"
+)
+
+const testARPTable = `IP address       HW type     Flags       HW address            Mask     Device
+192.168.0.10     0x1         0x2         02:00:C0:A8:00:0A     *        br0
+192.168.0.11     0x1         0x0         00:00:00:00:00:00     *        br0
+`
+
+func TestMetadataProxy(t *testing.T) {
+	f, err := ioutil.TempFile("", "arp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+
+	_, err = f.WriteString(testARPTable)
+	_ = f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	savedARPTable, savedURL, savedSecret, savedUUID := arpTable, metadataURL, metadataSecret, agentUUID
+	defer func() {
+		arpTable, metadataURL, metadataSecret, agentUUID = savedARPTable, savedURL, savedSecret, savedUUID
+	}()
+
+	var forwarded http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.Header
+	}))
+	defer server.Close()
+
+	arpTable = f.Name()
+	metadataURL = server.URL
+	metadataSecret = "secret"
+	agentUUID = "a9d2a5a6-0c0b-4ab2-8b8b-2d0c4e0b1e2a"
+
+	p, err := newMetadataProxy()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		remoteAddr string
+		status     int
+	}{
+		{"192.168.0.10:40000", http.StatusOK},
+		{"192.168.0.11:40000", http.StatusForbidden},
+		{"192.168.0.12:40000", http.StatusForbidden},
+		{"192.168.0.10", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		forwarded = nil
+
+		req := httptest.NewRequest("GET", "/openstack/latest/meta_data.json", nil)
+		req.RemoteAddr = tt.remoteAddr
+		req.Header.Set(payloads.MetadataIPHeader, "10.0.0.1")
+
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, req)
+
+		if rr.Code != tt.status {
+			t.Errorf("%s: got %d, expected %d", tt.remoteAddr, rr.Code, tt.status)
+			continue
+		}
+
+		if tt.status != http.StatusOK {
+			if forwarded != nil {
+				t.Errorf("%s: request forwarded", tt.remoteAddr)
+			}
+			continue
+		}
+
+		ip, mac := "192.168.0.10", "02:00:c0:a8:00:0a"
+		if forwarded.Get(payloads.MetadataCNCIHeader) != agentUUID ||
+			forwarded.Get(payloads.MetadataIPHeader) != ip ||
+			forwarded.Get(payloads.MetadataMACHeader) != mac {
+			t.Errorf("%s: wrong headers forwarded: %v", tt.remoteAddr, forwarded)
+		}
+
+		sig := payloads.MetadataSignature(metadataSecret, agentUUID, ip, mac)
+		if forwarded.Get(payloads.MetadataSignatureHeader) != sig {
+			t.Errorf("%s: wrong signature forwarded", tt.remoteAddr)
+		}
+	}
+}
@@ -368,6 +368,13 @@ func generateNetEventPayload(eventType ssntp.Event, eventInfo interface{}, agent
 			return nil, errors.Errorf("invalid eventInfo [%T] %v", eventInfo, eventInfo)
 		}
 		return publicIPUnassignedMarshal(cmd)
+	case ssntp.InstanceHealth:
+		glog.Infof("generating instance health Event Payload %v", eventInfo)
+		evt, ok := eventInfo.(*payloads.InstanceHealthEvent)
+		if !ok {
+			return nil, errors.Errorf("invalid eventInfo [%T] %v", eventInfo, eventInfo)
+		}
+		return instanceHealthMarshal(evt)
 	default:
 		return nil, errors.Errorf("unsupported ssntpEventInfo type: %v", eventType)
 	}
@@ -67,9 +67,15 @@ Routing decision                                                  |
 */
 
 const (
-	procIPFwd = "/proc/sys/net/ipv4/ip_forward"
+	procIPFwd          = "/proc/sys/net/ipv4/ip_forward"
+	procBridgeIPTables = "/proc/sys/net/bridge/bridge-nf-call-iptables"
 )
 
+//vnicFilterChain is the chain the bridged traffic of the compute
+//nodes goes through. The traffic of the filtered vnics jumps from it
+//to their own chains
+const vnicFilterChain = "ciao-vnic-filter"
+
 //FwAction defines firewall action to be performed
 type FwAction int
 
@@ -462,6 +468,230 @@ func disablePublicIP(intIP, pubIP string) error {
 	return nil
 }
 
+//FilterRule allows a flow of the traffic of a filtered vnic.
+//Ingress rules allow the traffic sent to the vnic from Remote,
+//egress rules the traffic sent by the vnic to Remote
+type FilterRule struct {
+	Ingress bool
+	//Protocol is tcp, udp or icmp, all protocols are allowed if empty
+	Protocol string
+	//PortMin and PortMax are the range of destination ports allowed
+	//for tcp and udp, all ports are allowed if PortMin is 0
+	PortMin int
+	PortMax int
+	//Remote is the range of addresses allowed, any if nil
+	Remote *net.IPNet
+}
+
+//InitVnicFirewall sets up the filtering of the traffic of the vnics
+//attached to the tenant bridges of a compute node. The bridged traffic
+//is sent through the iptables FORWARD chain, which hands it over to
+//the ciao-vnic-filter chain. The traffic of the vnics which are not
+//filtered is accepted.
+func InitVnicFirewall() (*Firewall, error) {
+	ipt, err := iptables.New()
+	if err != nil {
+		return nil, fmt.Errorf("InitVnicFirewall: Unable to setup iptables %v", err)
+	}
+
+	f := &Firewall{
+		IPTables: ipt,
+	}
+
+	// verify it exists if not create it, the vnics filtered before a
+	// restart of the launcher stay filtered
+	_ = ipt.NewChain("filter", vnicFilterChain)
+
+	//iptables -A ciao-vnic-filter -m physdev --physdev-is-bridged
+	// -o sbr+ -j ACCEPT
+	err = ipt.AppendUnique("filter", vnicFilterChain,
+		"-m", "physdev", "--physdev-is-bridged",
+		"-o", prefixBridge+"+", "-j", "ACCEPT")
+	if err != nil {
+		return nil, fmt.Errorf("Error: InitVnicFirewall could not accept tenant traffic %v", err)
+	}
+
+	//iptables -I FORWARD 1 -m physdev --physdev-is-bridged -j ciao-vnic-filter
+	ok, err := ipt.Exists("filter", "FORWARD",
+		"-m", "physdev", "--physdev-is-bridged", "-j", vnicFilterChain)
+	if err != nil {
+		return nil, fmt.Errorf("Error: InitVnicFirewall could not verify existence of chain %s, %v", vnicFilterChain, err)
+	}
+	if !ok {
+		err := ipt.Insert("filter", "FORWARD", 1,
+			"-m", "physdev", "--physdev-is-bridged", "-j", vnicFilterChain)
+		if err != nil {
+			return nil, fmt.Errorf("Error: InitVnicFirewall could not insert chain %s %v", vnicFilterChain, err)
+		}
+	}
+
+	if err = bridgeFiltering(FwEnable); err != nil {
+		return nil, fmt.Errorf("Error: InitVnicFirewall bridge filtering enable %v", err)
+	}
+
+	return f, nil
+}
+
+//bridgeFiltering enables or disables the filtering of the bridged
+//traffic by iptables, which requires the br_netfilter module
+//echo 0 > /proc/sys/net/bridge/bridge-nf-call-iptables
+//echo 1 > /proc/sys/net/bridge/bridge-nf-call-iptables
+func bridgeFiltering(action FwAction) error {
+	file, err := os.OpenFile(procBridgeIPTables, os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("Bridge filtering: Unable to open %v %v", procBridgeIPTables, err)
+	}
+	defer func() { _ = file.Close() }()
+
+	switch action {
+	case FwEnable:
+		_, err = file.WriteString("1")
+	case FwDisable:
+		_, err = file.WriteString("0")
+	}
+
+	if err != nil {
+		return fmt.Errorf("Bridge filtering failed %v %v", action, err)
+	}
+
+	return nil
+}
+
+//vnicChains returns the chains of the traffic sent to and by a vnic
+func vnicChains(vnic string) (string, string) {
+	return "ciao-" + vnic + "-in", "ciao-" + vnic + "-out"
+}
+
+//filterRuleSpec returns the iptables rule specification of a rule,
+//the allowed traffic returns to the ciao-vnic-filter chain as the
+//traffic between two vnics of the node goes through both their chains
+func filterRuleSpec(rule FilterRule) []string {
+	var spec []string
+
+	if rule.Remote != nil {
+		if rule.Ingress {
+			spec = append(spec, "-s", rule.Remote.String())
+		} else {
+			spec = append(spec, "-d", rule.Remote.String())
+		}
+	}
+
+	if rule.Protocol != "" {
+		spec = append(spec, "-p", rule.Protocol)
+
+		if rule.PortMin != 0 && (rule.Protocol == "tcp" || rule.Protocol == "udp") {
+			ports := strconv.Itoa(rule.PortMin)
+			if rule.PortMax > rule.PortMin {
+				ports += ":" + strconv.Itoa(rule.PortMax)
+			}
+			spec = append(spec, "--dport", ports)
+		}
+	}
+
+	return append(spec, "-j", "RETURN")
+}
+
+//vnicChainSpecs returns the rule specifications of the chain of the
+//traffic sent to a vnic, or by a vnic, followed by the specification
+//dropping the traffic which is not allowed. The replies and DHCP are
+//always allowed
+func vnicChainSpecs(ingress bool, rules []FilterRule) [][]string {
+	specs := [][]string{
+		{"-m", "state", "--state", "RELATED,ESTABLISHED", "-j", "RETURN"},
+	}
+
+	if ingress {
+		specs = append(specs, []string{"-p", "udp", "--sport", "67", "--dport", "68", "-j", "RETURN"})
+	} else {
+		specs = append(specs, []string{"-p", "udp", "--sport", "68", "--dport", "67", "-j", "RETURN"})
+	}
+
+	for _, rule := range rules {
+		if rule.Ingress == ingress {
+			specs = append(specs, filterRuleSpec(rule))
+		}
+	}
+
+	return append(specs, []string{"-j", "DROP"})
+}
+
+//VnicFilter enables or disables the filtering of the traffic of a vnic
+//attached to a tenant bridge. Enabling the filtering of a filtered vnic
+//replaces its rules. Only the traffic allowed by the rules is
+//accepted when the filtering is enabled. Disabling the filtering of a
+//vnic which is not filtered is not an error
+func (f *Firewall) VnicFilter(action FwAction, vnic string, rules []FilterRule) error {
+	in, out := vnicChains(vnic)
+
+	jumps := [][]string{
+		{"-m", "physdev", "--physdev-out", vnic, "--physdev-is-bridged", "-j", in},
+		{"-m", "physdev", "--physdev-in", vnic, "--physdev-is-bridged", "-j", out},
+	}
+
+	switch action {
+	case FwEnable:
+		for _, chain := range []string{in, out} {
+			//ClearChain creates the chain if it does not exist
+			err := f.ClearChain("filter", chain)
+			if err != nil {
+				return fmt.Errorf("Unable to reset chain %s %v", chain, err)
+			}
+
+			for _, spec := range vnicChainSpecs(chain == in, rules) {
+				err = f.Append("filter", chain, spec...)
+				if err != nil {
+					return fmt.Errorf("Unable to filter vnic %s %v %v", vnic, spec, err)
+				}
+			}
+		}
+
+		for _, jump := range jumps {
+			ok, err := f.Exists("filter", vnicFilterChain, jump...)
+			if err != nil {
+				return fmt.Errorf("Unable to verify existence of filter of vnic %s %v", vnic, err)
+			}
+			if ok {
+				continue
+			}
+
+			//the jumps precede the acceptance of the unfiltered traffic
+			err = f.Insert("filter", vnicFilterChain, 1, jump...)
+			if err != nil {
+				return fmt.Errorf("Unable to enable filter of vnic %s %v", vnic, err)
+			}
+		}
+	case FwDisable:
+		for _, jump := range jumps {
+			ok, err := f.Exists("filter", vnicFilterChain, jump...)
+			if err != nil || !ok {
+				continue
+			}
+
+			err = f.Delete("filter", vnicFilterChain, jump...)
+			if err != nil {
+				return fmt.Errorf("Unable to disable filter of vnic %s %v", vnic, err)
+			}
+		}
+
+		for _, chain := range []string{in, out} {
+			//the vnic may not be filtered
+			if _, err := f.List("filter", chain); err != nil {
+				continue
+			}
+
+			_ = f.ClearChain("filter", chain)
+			err := f.DeleteChain("filter", chain)
+			if err != nil {
+				return fmt.Errorf("Unable to delete chain %s %v", chain, err)
+			}
+		}
+	default:
+		return fmt.Errorf("Invalid parameter %v", action)
+	}
+
+	return nil
+}
+
 //DumpIPTables provides a utility routine that returns
 //the current state of the iptables
 func DumpIPTables() string {
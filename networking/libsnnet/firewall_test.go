@@ -183,3 +183,59 @@ func TestFw_All(t *testing.T) {
 	err = fw.ShutdownFirewall()
 	assert.Nil(err)
 }
+
+//Tests the vnic filtering primitives
+//
+//Tests the primitives used by the launcher to enforce the security
+//groups of the instances of a compute node
+//
+//Test should pass
+func TestFw_VnicFilter(t *testing.T) {
+	assert := assert.New(t)
+
+	fw, err := InitVnicFirewall()
+	require.Nil(t, err)
+
+	_, remote, err := net.ParseCIDR("192.51.100.0/24")
+	require.Nil(t, err)
+
+	rules := []FilterRule{
+		{
+			Ingress:  true,
+			Protocol: "tcp",
+			PortMin:  22,
+			PortMax:  22,
+			Remote:   remote,
+		},
+		{
+			Ingress:  true,
+			Protocol: "udp",
+			PortMin:  5000,
+			PortMax:  5100,
+		},
+		{
+			Ingress: false,
+		},
+	}
+
+	err = fw.VnicFilter(FwEnable, "svn_vnictest", rules)
+	assert.Nil(err)
+
+	//Replaces the rules of the vnic
+	err = fw.VnicFilter(FwEnable, "svn_vnictest", rules[:1])
+	assert.Nil(err)
+
+	ok, err := fw.Exists("filter", "ciao-svn_vnictest-in",
+		"-s", remote.String(), "-p", "tcp", "--dport", "22", "-j", "RETURN")
+	assert.Nil(err)
+	assert.True(ok)
+
+	err = fw.VnicFilter(FwDisable, "svn_vnictest", nil)
+	assert.Nil(err)
+
+	ok, err = fw.Exists("filter", vnicFilterChain,
+		"-m", "physdev", "--physdev-out", "svn_vnictest", "--physdev-is-bridged",
+		"-j", "ciao-svn_vnictest-in")
+	assert.Nil(err)
+	assert.False(ok)
+}
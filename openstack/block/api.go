@@ -23,6 +23,7 @@ import (
 	"os"
 	"time"
 
+	"github.com/01org/ciao/openstack/identity"
 	"github.com/gorilla/mux"
 )
 
@@ -291,6 +292,52 @@ type ShowVolumeDetails struct {
 	Volume VolumeDetail `json:"volume"`
 }
 
+// QuotaSet implements the block api quota set object.  A value of -1
+// means unlimited.
+// http://developer.openstack.org/api-ref-blockstorage-v2.html#quota-sets-ext-os-quota-sets
+type QuotaSet struct {
+	ID        string `json:"id,omitempty"`
+	Volumes   int    `json:"volumes"`
+	Gigabytes int    `json:"gigabytes"`
+	Snapshots int    `json:"snapshots"`
+}
+
+// QuotaSetResponse is returned when showing or updating a quota set.
+type QuotaSetResponse struct {
+	QuotaSet QuotaSet `json:"quota_set"`
+}
+
+// QuotaUsage holds the limit and usage of a quota.
+type QuotaUsage struct {
+	InUse    int `json:"in_use"`
+	Limit    int `json:"limit"`
+	Reserved int `json:"reserved"`
+}
+
+// QuotaSetUsage is the form of QuotaSet returned when usage is requested.
+type QuotaSetUsage struct {
+	ID        string     `json:"id"`
+	Volumes   QuotaUsage `json:"volumes"`
+	Gigabytes QuotaUsage `json:"gigabytes"`
+	Snapshots QuotaUsage `json:"snapshots"`
+}
+
+// QuotaSetUsageResponse is returned when showing a quota set with usage.
+type QuotaSetUsageResponse struct {
+	QuotaSet QuotaSetUsage `json:"quota_set"`
+}
+
+// QuotaSetUpdate lists the quotas to change.  Quotas left nil are not
+// changed.
+type QuotaSetUpdate struct {
+	Volumes *int `json:"volumes,omitempty"`
+}
+
+// UpdateQuotaSetRequest is the body of a quota set update request.
+type UpdateQuotaSetRequest struct {
+	QuotaSet QuotaSetUpdate `json:"quota_set"`
+}
+
 // These errors can be returned by the Service interface
 var (
 	ErrQuota                = errors.New("Tenant over quota")
@@ -302,6 +349,7 @@ var (
 	ErrInstanceOwner        = errors.New("You are not instance owner")
 	ErrInstanceNotAvailable = errors.New("Instance not available")
 	ErrVolumeNotAttached    = errors.New("Volume not attached")
+	ErrNotAdmin             = errors.New("Admin privileges required")
 )
 
 // errorResponse maps service error responses to http responses.
@@ -322,7 +370,8 @@ func errorResponse(err error) APIResponse {
 		ErrVolumeOwner,
 		ErrInstanceOwner,
 		ErrInstanceNotAvailable,
-		ErrVolumeNotAttached:
+		ErrVolumeNotAttached,
+		ErrNotAdmin:
 		return APIResponse{http.StatusForbidden, nil}
 	default:
 		return APIResponse{http.StatusInternalServerError, nil}
@@ -347,6 +396,9 @@ type Service interface {
 	ListVolumes(tenant string) ([]ListVolume, error)
 	ListVolumesDetail(tenant string) ([]VolumeDetail, error)
 	ShowVolumeDetails(tenant string, volume string) (VolumeDetail, error)
+	ShowVolumeQuotaSet(tenant string, target string) (QuotaSetUsage, error)
+	UpdateVolumeQuotaSet(tenant string, target string, req QuotaSetUpdate) (QuotaSetUsage, error)
+	DeleteVolumeQuotaSet(tenant string, target string) error
 }
 
 // Context contains data and interfaces that the block api will need.
@@ -478,6 +530,86 @@ func showAbsoluteLimits(bc *Context, w http.ResponseWriter, r *http.Request) (AP
 	return APIResponse{http.StatusOK, resp}, nil
 }
 
+func quotaSet(usage QuotaSetUsage) QuotaSet {
+	return QuotaSet{
+		ID:        usage.ID,
+		Volumes:   usage.Volumes.Limit,
+		Gigabytes: usage.Gigabytes.Limit,
+		Snapshots: usage.Snapshots.Limit,
+	}
+}
+
+func showQuotaSet(bc *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+	target := vars["target"]
+
+	if tenant != target && !identity.Privileged(r.Context()) {
+		return errorResponse(ErrNotAdmin), ErrNotAdmin
+	}
+
+	usage, err := bc.ShowVolumeQuotaSet(tenant, target)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	if r.URL.Query().Get("usage") == "true" {
+		return APIResponse{http.StatusOK, QuotaSetUsageResponse{usage}}, nil
+	}
+
+	return APIResponse{http.StatusOK, QuotaSetResponse{quotaSet(usage)}}, nil
+}
+
+func updateQuotaSet(bc *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+	target := vars["target"]
+
+	if !identity.Privileged(r.Context()) {
+		return errorResponse(ErrNotAdmin), ErrNotAdmin
+	}
+
+	defer r.Body.Close()
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return APIResponse{http.StatusBadRequest, nil}, err
+	}
+
+	var req UpdateQuotaSetRequest
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		return APIResponse{http.StatusBadRequest, nil}, err
+	}
+
+	usage, err := bc.UpdateVolumeQuotaSet(tenant, target, req.QuotaSet)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	quotas := quotaSet(usage)
+	quotas.ID = ""
+
+	return APIResponse{http.StatusOK, QuotaSetResponse{quotas}}, nil
+}
+
+func deleteQuotaSet(bc *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+	target := vars["target"]
+
+	if !identity.Privileged(r.Context()) {
+		return errorResponse(ErrNotAdmin), ErrNotAdmin
+	}
+
+	err := bc.DeleteVolumeQuotaSet(tenant, target)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return APIResponse{http.StatusOK, nil}, nil
+}
+
 func createVolume(bc *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
 	vars := mux.Vars(r)
 	tenant := vars["tenant"]
@@ -664,6 +796,14 @@ func Routes(config APIConfig) *mux.Router {
 	r.Handle("/v2/{tenant}/limits",
 		APIHandler{context, showAbsoluteLimits}).Methods("GET")
 
+	// Quota sets
+	r.Handle("/v2/{tenant}/os-quota-sets/{target}",
+		APIHandler{context, showQuotaSet}).Methods("GET")
+	r.Handle("/v2/{tenant}/os-quota-sets/{target}",
+		APIHandler{context, updateQuotaSet}).Methods("PUT")
+	r.Handle("/v2/{tenant}/os-quota-sets/{target}",
+		APIHandler{context, deleteQuotaSet}).Methods("DELETE")
+
 	// Volumes
 	r.Handle("/v2/{tenant}/volumes",
 		APIHandler{context, createVolume}).Methods("POST")
@@ -22,6 +22,8 @@ import (
 	"os"
 	"strconv"
 	"testing"
+
+	"github.com/01org/ciao/openstack/identity"
 )
 
 type test struct {
@@ -119,6 +121,38 @@ var tests = []test{
 		http.StatusAccepted,
 		"null",
 	},
+	{
+		"GET",
+		"/v2/validtenantid/os-quota-sets/validtenantid",
+		showQuotaSet,
+		"",
+		http.StatusOK,
+		`{"quota_set":{"volumes":10,"gigabytes":-1,"snapshots":-1}}`,
+	},
+	{
+		"GET",
+		"/v2/validtenantid/os-quota-sets/validtenantid?usage=true",
+		showQuotaSet,
+		"",
+		http.StatusOK,
+		`{"quota_set":{"id":"","volumes":{"in_use":2,"limit":10,"reserved":0},"gigabytes":{"in_use":12,"limit":-1,"reserved":0},"snapshots":{"in_use":0,"limit":-1,"reserved":0}}}`,
+	},
+	{
+		"PUT",
+		"/v2/validtenantid/os-quota-sets/validtenantid",
+		updateQuotaSet,
+		`{"quota_set":{"volumes":20}}`,
+		http.StatusOK,
+		`{"quota_set":{"volumes":20,"gigabytes":-1,"snapshots":-1}}`,
+	},
+	{
+		"DELETE",
+		"/v2/validtenantid/os-quota-sets/validtenantid",
+		deleteQuotaSet,
+		"",
+		http.StatusOK,
+		"null",
+	},
 }
 
 type testVolumeService struct{}
@@ -262,6 +296,27 @@ func (vs testVolumeService) ListVolumesDetail(tenant string) ([]VolumeDetail, er
 	}, nil
 }
 
+func (vs testVolumeService) ShowVolumeQuotaSet(tenant string, target string) (QuotaSetUsage, error) {
+	return QuotaSetUsage{
+		ID:        target,
+		Volumes:   QuotaUsage{InUse: 2, Limit: 10},
+		Gigabytes: QuotaUsage{InUse: 12, Limit: -1},
+		Snapshots: QuotaUsage{Limit: -1},
+	}, nil
+}
+
+func (vs testVolumeService) UpdateVolumeQuotaSet(tenant string, target string, req QuotaSetUpdate) (QuotaSetUsage, error) {
+	usage, err := vs.ShowVolumeQuotaSet(tenant, target)
+	if req.Volumes != nil {
+		usage.Volumes.Limit = *req.Volumes
+	}
+	return usage, err
+}
+
+func (vs testVolumeService) DeleteVolumeQuotaSet(tenant string, target string) error {
+	return nil
+}
+
 func TestAPIResponse(t *testing.T) {
 	var vs testVolumeService
 
@@ -275,6 +330,7 @@ func TestAPIResponse(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
+		req = req.WithContext(identity.WithPrivilege(req.Context(), true))
 
 		rr := httptest.NewRecorder()
 		handler := APIHandler{context, tt.handler}
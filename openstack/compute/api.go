@@ -21,10 +21,13 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httputil"
+	"net/url"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/01org/ciao/openstack/identity"
 	"github.com/golang/glog"
 	"github.com/gorilla/mux"
 )
@@ -65,70 +68,163 @@ type Image struct {
 	Links []Link `json:"links"`
 }
 
-// SecurityGroup represents the security group of an instance.
+// SecurityGroup represents a security group of a tenant.  The servers of
+// a tenant only accept the traffic allowed by the rules of their security
+// groups.  Servers list their security groups by name only.
+// http://developer.openstack.org/api-ref/compute/#security-groups-os-security-groups-deprecated
 type SecurityGroup struct {
-	Name string `json:"name"`
+	ID          string              `json:"id,omitempty"`
+	Name        string              `json:"name"`
+	Description string              `json:"description,omitempty"`
+	TenantID    string              `json:"tenant_id,omitempty"`
+	Rules       []SecurityGroupRule `json:"rules,omitempty"`
+}
+
+// SecurityGroupRule is a rule of a security group.  The rule allows the
+// traffic of IPProtocol, between FromPort and ToPort for tcp and udp,
+// from or to either the addresses of IPRange or the servers of Group.
+type SecurityGroupRule struct {
+	ID            string `json:"id"`
+	ParentGroupID string `json:"parent_group_id"`
+
+	// Direction is either ingress or egress, a ciao extension.
+	Direction  string `json:"direction"`
+	IPProtocol string `json:"ip_protocol"`
+	FromPort   int    `json:"from_port"`
+	ToPort     int    `json:"to_port"`
+	IPRange    struct {
+		CIDR string `json:"cidr,omitempty"`
+	} `json:"ip_range"`
+	Group struct {
+		Name     string `json:"name,omitempty"`
+		TenantID string `json:"tenant_id,omitempty"`
+	} `json:"group"`
 }
 
 // These errors can be returned by the Service interface
 var (
-	ErrQuota                = errors.New("Tenant over quota")
-	ErrTenantNotFound       = errors.New("Tenant not found")
-	ErrServerNotFound       = errors.New("Server not found")
-	ErrServerOwner          = errors.New("You are not server owner")
-	ErrInstanceNotAvailable = errors.New("Instance not currently available for this operation")
+	ErrQuota                     = errors.New("Tenant over quota")
+	ErrTenantNotFound            = errors.New("Tenant not found")
+	ErrServerNotFound            = errors.New("Server not found")
+	ErrServerOwner               = errors.New("You are not server owner")
+	ErrInstanceNotAvailable      = errors.New("Instance not currently available for this operation")
+	ErrSchedulerHint             = errors.New("Invalid scheduler hint")
+	ErrNotAdmin                  = errors.New("Admin privileges required")
+	ErrMetadataNotFound          = errors.New("Metadata item not found")
+	ErrTagNotFound               = errors.New("Tag not found")
+	ErrInvalidMetadata           = errors.New("Invalid metadata")
+	ErrInvalidTag                = errors.New("Invalid tag")
+	ErrRestartPolicy             = errors.New("Invalid restart policy")
+	ErrHealthCheck               = errors.New("Invalid health check")
+	ErrKeypairNotFound           = errors.New("Keypair not found")
+	ErrKeypairExists             = errors.New("Keypair by that name already exists")
+	ErrInvalidKeypair            = errors.New("Invalid keypair")
+	ErrSecurityGroupNotFound     = errors.New("Security group not found")
+	ErrSecurityGroupExists       = errors.New("Security group by that name already exists")
+	ErrSecurityGroupInUse        = errors.New("Security group in use")
+	ErrSecurityGroupRuleNotFound = errors.New("Security group rule not found")
+	ErrInvalidSecurityGroup      = errors.New("Invalid security group")
 )
 
 // errorResponse maps service error responses to http responses.
 // this helper function can help functions avoid having to switch
 // on return values all the time.
 func errorResponse(err error) APIResponse {
+	if _, ok := err.(*StateError); ok {
+		return APIResponse{http.StatusConflict, nil}
+	}
+
+	if _, ok := err.(*ParameterError); ok {
+		return APIResponse{http.StatusBadRequest, nil}
+	}
+
 	switch err {
-	case ErrTenantNotFound, ErrServerNotFound:
+	case ErrTenantNotFound, ErrServerNotFound, ErrMetadataNotFound, ErrTagNotFound, ErrKeypairNotFound,
+		ErrSecurityGroupNotFound, ErrSecurityGroupRuleNotFound:
 		return APIResponse{http.StatusNotFound, nil}
 
-	case ErrQuota, ErrServerOwner, ErrInstanceNotAvailable:
+	case ErrKeypairExists, ErrSecurityGroupExists, ErrSecurityGroupInUse:
+		return APIResponse{http.StatusConflict, nil}
+
+	case ErrQuota, ErrServerOwner, ErrInstanceNotAvailable, ErrNotAdmin:
 		return APIResponse{http.StatusForbidden, nil}
 
+	case ErrSchedulerHint, ErrInvalidMetadata, ErrInvalidTag, ErrRestartPolicy, ErrHealthCheck, ErrInvalidKeypair,
+		ErrInvalidSecurityGroup:
+		return APIResponse{http.StatusBadRequest, nil}
+
 	default:
 		return APIResponse{http.StatusInternalServerError, nil}
 	}
 }
 
+// StateError is returned by the Service interface when the status of a
+// server does not allow the requested action.
+type StateError struct {
+	Action string
+	Status string
+}
+
+func (e *StateError) Error() string {
+	return fmt.Sprintf("Cannot %s server while it is %s", e.Action, e.Status)
+}
+
+// ParameterError is returned by the Service interface when the parameters
+// of a CreateServerRequest do not match those of its flavor.
+type ParameterError struct {
+	Reason string
+}
+
+func (e *ParameterError) Error() string {
+	return fmt.Sprintf("Invalid parameters: %s", e.Reason)
+}
+
+// StatusTransition records a change of status of a server.
+type StatusTransition struct {
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
 // ServerDetails contains information about a specific instance.
 type ServerDetails struct {
-	Addresses                        Addresses       `json:"addresses"`
-	Created                          time.Time       `json:"created"`
-	Flavor                           FlavorLinks     `json:"flavor"`
-	HostID                           string          `json:"hostId"`
-	ID                               string          `json:"id"`
-	Image                            Image           `json:"image"`
-	KeyName                          string          `json:"key_name"`
-	Links                            []Link          `json:"links"`
-	Name                             string          `json:"name"`
-	AccessIPv4                       string          `json:"accessIPv4"`
-	AccessIPv6                       string          `json:"accessIPv6"`
-	ConfigDrive                      string          `json:"config_drive"`
-	OSDCFDiskConfig                  string          `json:"OS-DCF:diskConfig"`
-	OSEXTAZAvailabilityZone          string          `json:"OS-EXT-AZ:availability_zone"`
-	OSEXTSRVATTRHost                 string          `json:"OS-EXT-SRV-ATTR:host"`
-	OSEXTSRVATTRHypervisorHostname   string          `json:"OS-EXT-SRV-ATTR:hypervisor_hostname"`
-	OSEXTSRVATTRInstanceName         string          `json:"OS-EXT-SRV-ATTR:instance_name"`
-	OSEXTSTSPowerState               int             `json:"OS-EXT-STS:power_state"`
-	OSEXTSTSTaskState                string          `json:"OS-EXT-STS:task_state"`
-	OSEXTSTSVMState                  string          `json:"OS-EXT-STS:vm_state"`
-	OsExtendedVolumesVolumesAttached []string        `json:"os-extended-volumes:volumes_attached"`
-	OSSRVUSGLaunchedAt               time.Time       `json:"OS-SRV-USG:launched_at"`
-	OSSRVUSGTerminatedAt             time.Time       `json:"OS-SRV-USG:terminated_at"`
-	Progress                         int             `json:"progress"`
-	SecurityGroups                   []SecurityGroup `json:"security_groups"`
-	Status                           string          `json:"status"`
-	HostStatus                       string          `json:"host_status"`
-	TenantID                         string          `json:"tenant_id"`
-	Updated                          time.Time       `json:"updated"`
-	UserID                           string          `json:"user_id"`
-	SSHIP                            string          `json:"ssh_ip"`
-	SSHPort                          int             `json:"ssh_port"`
+	Addresses                        Addresses          `json:"addresses"`
+	Created                          time.Time          `json:"created"`
+	Flavor                           FlavorLinks        `json:"flavor"`
+	HostID                           string             `json:"hostId"`
+	ID                               string             `json:"id"`
+	Image                            Image              `json:"image"`
+	KeyName                          string             `json:"key_name"`
+	Links                            []Link             `json:"links"`
+	Metadata                         map[string]string  `json:"metadata"`
+	Name                             string             `json:"name"`
+	AccessIPv4                       string             `json:"accessIPv4"`
+	AccessIPv6                       string             `json:"accessIPv6"`
+	ConfigDrive                      string             `json:"config_drive"`
+	OSDCFDiskConfig                  string             `json:"OS-DCF:diskConfig"`
+	OSEXTAZAvailabilityZone          string             `json:"OS-EXT-AZ:availability_zone"`
+	OSEXTSRVATTRHost                 string             `json:"OS-EXT-SRV-ATTR:host"`
+	OSEXTSRVATTRHypervisorHostname   string             `json:"OS-EXT-SRV-ATTR:hypervisor_hostname"`
+	OSEXTSRVATTRInstanceName         string             `json:"OS-EXT-SRV-ATTR:instance_name"`
+	OSEXTSTSPowerState               int                `json:"OS-EXT-STS:power_state"`
+	OSEXTSTSTaskState                string             `json:"OS-EXT-STS:task_state"`
+	OSEXTSTSVMState                  string             `json:"OS-EXT-STS:vm_state"`
+	OsExtendedVolumesVolumesAttached []string           `json:"os-extended-volumes:volumes_attached"`
+	OSSRVUSGLaunchedAt               time.Time          `json:"OS-SRV-USG:launched_at"`
+	OSSRVUSGTerminatedAt             time.Time          `json:"OS-SRV-USG:terminated_at"`
+	Progress                         int                `json:"progress"`
+	SecurityGroups                   []SecurityGroup    `json:"security_groups"`
+	Status                           string             `json:"status"`
+	HostStatus                       string             `json:"host_status"`
+	Tags                             []string           `json:"tags"`
+	TenantID                         string             `json:"tenant_id"`
+	Updated                          time.Time          `json:"updated"`
+	UserID                           string             `json:"user_id"`
+	SSHIP                            string             `json:"ssh_ip"`
+	SSHPort                          int                `json:"ssh_port"`
+	StatusHistory                    []StatusTransition `json:"status_history,omitempty"`
+	Health                           string             `json:"health,omitempty"`
+	HealthReason                     string             `json:"health_reason,omitempty"`
 }
 
 // Servers represents the unmarshalled version of the contents of a
@@ -274,9 +370,315 @@ type CreateServerRequest struct {
 		MaxInstances        int                    `json:"max_count"`
 		MinInstances        int                    `json:"min_count"`
 		BlockDeviceMappings []BlockDeviceMappingV2 `json:"block_device_mapping_v2,omitempty"`
+		Metadata            map[string]string      `json:"metadata,omitempty"`
+		Tags                []string               `json:"tags,omitempty"`
+		KeyName             string                 `json:"key_name,omitempty"`
+		SecurityGroups      []SecurityGroup        `json:"security_groups,omitempty"`
+
+		// Parameters set the parameters of the config of the
+		// flavor, a ciao extension.
+		Parameters map[string]string `json:"parameters,omitempty"`
+
+		// RestartPolicy overrides the restart policy of the
+		// flavor, a ciao extension.
+		RestartPolicy *RestartPolicy `json:"restart_policy,omitempty"`
+
+		// HealthCheck overrides the health check of the flavor, a
+		// ciao extension.
+		HealthCheck *HealthCheck `json:"health_check,omitempty"`
+	} `json:"server"`
+	SchedulerHints *SchedulerHints `json:"os:scheduler_hints,omitempty"`
+
+	// Keypair is the keypair of the caller named by Server.KeyName,
+	// looked up by the API before the request reaches the Service.
+	Keypair *Keypair `json:"-"`
+}
+
+// UpdateServerRequest represents the unmarshalled version of the contents of
+// a PUT /v2.1/{tenant}/servers/{server} request.  Only the name of a server
+// can be changed.
+type UpdateServerRequest struct {
+	Server struct {
+		Name string `json:"name"`
 	} `json:"server"`
 }
 
+// ServerMetadata represents the metadata of a server, as listed and set by
+// the /v2.1/{tenant}/servers/{server}/metadata requests.
+type ServerMetadata struct {
+	Metadata map[string]string `json:"metadata"`
+}
+
+// ServerMetadataItem represents a single metadata item of a server, as shown
+// and set by the /v2.1/{tenant}/servers/{server}/metadata/{key} requests.
+type ServerMetadataItem struct {
+	Meta map[string]string `json:"meta"`
+}
+
+// ServerTags represents the tags of a server, as listed and set by the
+// /v2.1/{tenant}/servers/{server}/tags requests.
+type ServerTags struct {
+	Tags []string `json:"tags"`
+}
+
+// Limits of the tags and metadata of a server.
+const (
+	maxTags             = 50
+	maxTagLength        = 60
+	maxMetadataItems    = 128
+	maxMetadataKeyValue = 255
+)
+
+// validateTags checks the tags of a server: there are at most 50 tags of at
+// most 60 characters, without commas nor slashes.
+func validateTags(tags []string) error {
+	if len(tags) > maxTags {
+		return ErrInvalidTag
+	}
+
+	for _, tag := range tags {
+		if tag == "" || len(tag) > maxTagLength || strings.ContainsAny(tag, ",/") {
+			return ErrInvalidTag
+		}
+	}
+
+	return nil
+}
+
+// validateMetadata checks the metadata of a server: there are at most 128
+// items, whose keys are not empty and whose keys and values are at most 255
+// characters.
+func validateMetadata(metadata map[string]string) error {
+	if len(metadata) > maxMetadataItems {
+		return ErrInvalidMetadata
+	}
+
+	for k, v := range metadata {
+		if k == "" || len(k) > maxMetadataKeyValue || len(v) > maxMetadataKeyValue {
+			return ErrInvalidMetadata
+		}
+	}
+
+	return nil
+}
+
+// SchedulerHints contains the optional placement hints of a
+// CreateServerRequest.
+type SchedulerHints struct {
+	// Priority is the priority class of the new instances, one of
+	// high, normal or preemptible.  Empty means normal.
+	Priority string `json:"priority,omitempty"`
+}
+
+// RestartPolicy tells how a server is restarted when it exits without
+// being stopped or when its node is lost.  Condition is one of never,
+// on-failure or always, Backoff is in seconds.
+type RestartPolicy struct {
+	Condition   string `json:"condition"`
+	MaxRestarts int    `json:"max_restarts,omitempty"`
+	Backoff     int    `json:"backoff,omitempty"`
+}
+
+// HealthCheck tells how the health of a server is checked from its tenant
+// network.  Protocol is tcp or http, Path is only used by http checks.
+// Interval and Timeout are in seconds, the thresholds are the numbers of
+// probes in a row after which the server becomes healthy or unhealthy.
+// Restart restarts the server when it becomes unhealthy.
+type HealthCheck struct {
+	Protocol           string `json:"protocol"`
+	Port               int    `json:"port"`
+	Path               string `json:"path,omitempty"`
+	Interval           int    `json:"interval,omitempty"`
+	Timeout            int    `json:"timeout,omitempty"`
+	HealthyThreshold   int    `json:"healthy_threshold,omitempty"`
+	UnhealthyThreshold int    `json:"unhealthy_threshold,omitempty"`
+	Restart            bool   `json:"restart,omitempty"`
+}
+
+// QuotaSet implements the quota set object. A value of -1 means
+// unlimited.
+// http://developer.openstack.org/api-ref/compute/#quota-sets-os-quota-sets
+type QuotaSet struct {
+	ID          string `json:"id,omitempty"`
+	Instances   int    `json:"instances"`
+	Cores       int    `json:"cores"`
+	RAM         int    `json:"ram"`
+	FloatingIPs int    `json:"floating_ips"`
+}
+
+// QuotaSetResponse is returned when showing or updating a quota set.
+type QuotaSetResponse struct {
+	QuotaSet QuotaSet `json:"quota_set"`
+}
+
+// QuotaDetail holds the limit and usage of a quota.
+type QuotaDetail struct {
+	InUse    int `json:"in_use"`
+	Limit    int `json:"limit"`
+	Reserved int `json:"reserved"`
+}
+
+// QuotaSetDetail is the detailed form of QuotaSet.
+type QuotaSetDetail struct {
+	ID          string      `json:"id"`
+	Instances   QuotaDetail `json:"instances"`
+	Cores       QuotaDetail `json:"cores"`
+	RAM         QuotaDetail `json:"ram"`
+	FloatingIPs QuotaDetail `json:"floating_ips"`
+}
+
+// QuotaSetDetailResponse is returned when showing the details of a
+// quota set.
+type QuotaSetDetailResponse struct {
+	QuotaSet QuotaSetDetail `json:"quota_set"`
+}
+
+// QuotaSetUpdate lists the quotas to change.  Quotas left nil are
+// not changed.
+type QuotaSetUpdate struct {
+	Instances   *int `json:"instances,omitempty"`
+	Cores       *int `json:"cores,omitempty"`
+	RAM         *int `json:"ram,omitempty"`
+	FloatingIPs *int `json:"floating_ips,omitempty"`
+}
+
+// UpdateQuotaSetRequest represents the unmarshalled version of the
+// contents of a quota set update request.
+type UpdateQuotaSetRequest struct {
+	QuotaSet QuotaSetUpdate `json:"quota_set"`
+}
+
+// ServerUsage holds the usage of a server during the period of a
+// tenant usage report.
+// http://developer.openstack.org/api-ref/compute/#usage-reports-os-simple-tenant-usage
+type ServerUsage struct {
+	InstanceID string     `json:"instance_id"`
+	Name       string     `json:"name"`
+	TenantID   string     `json:"tenant_id"`
+	Hours      float64    `json:"hours"`
+	VCPUs      int        `json:"vcpus"`
+	MemoryMB   int        `json:"memory_mb"`
+	LocalGB    int        `json:"local_gb"`
+	Flavor     string     `json:"flavor"`
+	StartedAt  time.Time  `json:"started_at"`
+	EndedAt    *time.Time `json:"ended_at"`
+	State      string     `json:"state"`
+	Uptime     int        `json:"uptime"`
+}
+
+// TenantUsage holds the usage of a tenant between Start and Stop.  The
+// totals are in hours, MB hours and GB hours.
+type TenantUsage struct {
+	TenantID           string        `json:"tenant_id"`
+	Start              time.Time     `json:"start"`
+	Stop               time.Time     `json:"stop"`
+	TotalHours         float64       `json:"total_hours"`
+	TotalVCPUsUsage    float64       `json:"total_vcpus_usage"`
+	TotalMemoryMBUsage float64       `json:"total_memory_mb_usage"`
+	TotalLocalGBUsage  float64       `json:"total_local_gb_usage"`
+	ServerUsages       []ServerUsage `json:"server_usages,omitempty"`
+}
+
+// TenantUsagesResponse is returned when listing the usage of all the
+// tenants.
+type TenantUsagesResponse struct {
+	TenantUsages []TenantUsage `json:"tenant_usages"`
+}
+
+// TenantUsageResponse is returned when showing the usage of a tenant.
+type TenantUsageResponse struct {
+	TenantUsage TenantUsage `json:"tenant_usage"`
+}
+
+// Keypair is an SSH keypair of a user.  The public key of the keypair is
+// injected in the metadata of the servers created with its name.  The
+// private key is only returned when the keypair is generated.
+// http://developer.openstack.org/api-ref/compute/#keypairs-keypairs
+type Keypair struct {
+	Name        string    `json:"name"`
+	Type        string    `json:"type"`
+	PublicKey   string    `json:"public_key"`
+	PrivateKey  string    `json:"private_key,omitempty"`
+	Fingerprint string    `json:"fingerprint"`
+	UserID      string    `json:"user_id,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// KeypairRequest holds the keypair to create.  A keypair is generated
+// when PublicKey is empty, imported otherwise.
+type KeypairRequest struct {
+	Name      string `json:"name"`
+	Type      string `json:"type,omitempty"`
+	PublicKey string `json:"public_key,omitempty"`
+}
+
+// CreateKeypairRequest represents the unmarshalled version of the
+// contents of a /v2.1/{tenant}/os-keypairs request.
+type CreateKeypairRequest struct {
+	Keypair KeypairRequest `json:"keypair"`
+}
+
+// KeypairResponse is returned when creating or showing a keypair.
+type KeypairResponse struct {
+	Keypair Keypair `json:"keypair"`
+}
+
+// KeypairsResponse is returned when listing the keypairs of a user.
+type KeypairsResponse struct {
+	Keypairs []KeypairResponse `json:"keypairs"`
+}
+
+// SecurityGroupRequest holds the name and description of a security group
+// to create or update.
+type SecurityGroupRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// CreateSecurityGroupRequest represents the unmarshalled version of the
+// contents of a /v2.1/{tenant}/os-security-groups request.  The same
+// request updates a security group.
+type CreateSecurityGroupRequest struct {
+	SecurityGroup SecurityGroupRequest `json:"security_group"`
+}
+
+// SecurityGroupResponse is returned when creating, showing or updating a
+// security group.
+type SecurityGroupResponse struct {
+	SecurityGroup SecurityGroup `json:"security_group"`
+}
+
+// SecurityGroupsResponse is returned when listing the security groups of a
+// tenant or of a server.
+type SecurityGroupsResponse struct {
+	SecurityGroups []SecurityGroup `json:"security_groups"`
+}
+
+// SecurityGroupRuleRequest holds the rule to add to the security group
+// ParentGroupID.  The rule refers either to the addresses of CIDR or to
+// the servers of the security group GroupID.
+type SecurityGroupRuleRequest struct {
+	ParentGroupID string `json:"parent_group_id"`
+	Direction     string `json:"direction,omitempty"`
+	IPProtocol    string `json:"ip_protocol"`
+	FromPort      int    `json:"from_port"`
+	ToPort        int    `json:"to_port"`
+	CIDR          string `json:"cidr,omitempty"`
+	GroupID       string `json:"group_id,omitempty"`
+}
+
+// CreateSecurityGroupRuleRequest represents the unmarshalled version of the
+// contents of a /v2.1/{tenant}/os-security-group-rules request.
+type CreateSecurityGroupRuleRequest struct {
+	SecurityGroupRule SecurityGroupRuleRequest `json:"security_group_rule"`
+}
+
+// SecurityGroupRuleResponse is returned when creating a security group
+// rule.
+type SecurityGroupRuleResponse struct {
+	SecurityGroupRule SecurityGroupRule `json:"security_group_rule"`
+}
+
 // APIConfig contains information needed to start the compute api service.
 type APIConfig struct {
 	Port           int     // the https port of the compute api service
@@ -292,11 +694,41 @@ type Service interface {
 	DeleteServer(tenant string, server string) error
 	StartServer(tenant string, server string) error
 	StopServer(tenant string, server string) error
+	UpdateServer(tenant string, server string, req UpdateServerRequest) (Server, error)
+	SetServerMetadata(tenant string, server string, metadata map[string]string) error
+	SetServerTags(tenant string, server string, tags []string) error
 
 	//flavor interfaces
 	ListFlavors(string) (Flavors, error)
 	ListFlavorsDetail(string) (FlavorsDetails, error)
 	ShowFlavorDetails(string, string) (Flavor, error)
+
+	// quota interfaces
+	ShowQuotaSet(tenant string, target string) (QuotaSetDetail, error)
+	UpdateQuotaSet(tenant string, target string, req QuotaSetUpdate) (QuotaSetDetail, error)
+	DeleteQuotaSet(tenant string, target string) error
+
+	// usage interfaces
+	ListTenantUsage(start time.Time, end time.Time) ([]TenantUsage, error)
+	ShowTenantUsage(tenant string, start time.Time, end time.Time) (TenantUsage, error)
+
+	// keypair interfaces
+	CreateKeypair(tenant string, user string, req KeypairRequest) (Keypair, error)
+	ListKeypairs(tenant string, user string) ([]Keypair, error)
+	ShowKeypair(tenant string, user string, name string) (Keypair, error)
+	DeleteKeypair(tenant string, user string, name string) error
+
+	// security group interfaces
+	CreateSecurityGroup(tenant string, req SecurityGroupRequest) (SecurityGroup, error)
+	ListSecurityGroups(tenant string) ([]SecurityGroup, error)
+	ShowSecurityGroup(tenant string, group string) (SecurityGroup, error)
+	UpdateSecurityGroup(tenant string, group string, req SecurityGroupRequest) (SecurityGroup, error)
+	DeleteSecurityGroup(tenant string, group string) error
+	CreateSecurityGroupRule(tenant string, req SecurityGroupRuleRequest) (SecurityGroupRule, error)
+	DeleteSecurityGroupRule(tenant string, rule string) error
+	ListServerSecurityGroups(tenant string, server string) ([]SecurityGroup, error)
+	AddServerSecurityGroup(tenant string, server string, name string) error
+	RemoveServerSecurityGroup(tenant string, server string, name string) error
 }
 
 type pagerFilterType uint8
@@ -549,6 +981,26 @@ func createServer(c *Context, w http.ResponseWriter, r *http.Request) (APIRespon
 		return APIResponse{http.StatusBadRequest, nil}, err
 	}
 
+	err = validateTags(req.Server.Tags)
+	if err == nil {
+		err = validateMetadata(req.Server.Metadata)
+	}
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	if req.Server.KeyName != "" {
+		keypair, err := c.ShowKeypair(tenant, keypairUser(r), req.Server.KeyName)
+		if err == ErrKeypairNotFound {
+			err = ErrInvalidKeypair
+		}
+		if err != nil {
+			return errorResponse(err), err
+		}
+		keypair.PrivateKey = ""
+		req.Keypair = &keypair
+	}
+
 	resp, err := c.CreateServer(tenant, req)
 	if err != nil {
 		return errorResponse(err), err
@@ -557,13 +1009,121 @@ func createServer(c *Context, w http.ResponseWriter, r *http.Request) (APIRespon
 	return APIResponse{http.StatusAccepted, resp}, nil
 }
 
+// splitTags splits the comma separated tags of a query parameter.
+func splitTags(values url.Values, key string) []string {
+	var tags []string
+
+	for _, v := range values[key] {
+		for _, tag := range strings.Split(v, ",") {
+			if tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+
+	return tags
+}
+
+// taggedWith returns how many of the tags the server has.
+func taggedWith(server ServerDetails, tags []string) int {
+	n := 0
+
+	for _, tag := range tags {
+		for _, t := range server.Tags {
+			if t == tag {
+				n++
+				break
+			}
+		}
+	}
+
+	return n
+}
+
+// filterServers returns the servers matching the name, tags and metadata
+// filters of a query.  The name is a regular expression, tags lists the tags
+// the servers have all of, tags-any the tags they have at least one of,
+// not-tags and not-tags-any exclude the servers having all or any of their
+// tags.  Each metadata parameter is a key=value item the servers have, or
+// only a key.
+func filterServers(servers []ServerDetails, values url.Values) ([]ServerDetails, error) {
+	var name *regexp.Regexp
+
+	if n := values.Get("name"); n != "" {
+		var err error
+
+		name, err = regexp.Compile(n)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid name filter: %v", err)
+		}
+	}
+
+	tags := splitTags(values, "tags")
+	tagsAny := splitTags(values, "tags-any")
+	notTags := splitTags(values, "not-tags")
+	notTagsAny := splitTags(values, "not-tags-any")
+	metadata := values["metadata"]
+
+	if name == nil && len(tags) == 0 && len(tagsAny) == 0 &&
+		len(notTags) == 0 && len(notTagsAny) == 0 && len(metadata) == 0 {
+		return servers, nil
+	}
+
+	var filtered []ServerDetails
+
+	for _, server := range servers {
+		if name != nil && !name.MatchString(server.Name) {
+			continue
+		}
+
+		if len(tags) > 0 && taggedWith(server, tags) != len(tags) {
+			continue
+		}
+
+		if len(tagsAny) > 0 && taggedWith(server, tagsAny) == 0 {
+			continue
+		}
+
+		if len(notTags) > 0 && taggedWith(server, notTags) == len(notTags) {
+			continue
+		}
+
+		if len(notTagsAny) > 0 && taggedWith(server, notTagsAny) > 0 {
+			continue
+		}
+
+		if !hasMetadata(server, metadata) {
+			continue
+		}
+
+		filtered = append(filtered, server)
+	}
+
+	return filtered, nil
+}
+
+// hasMetadata returns whether the server has all the key=value or key
+// metadata items.
+func hasMetadata(server ServerDetails, items []string) bool {
+	for _, item := range items {
+		kv := strings.SplitN(item, "=", 2)
+
+		v, ok := server.Metadata[kv[0]]
+		if !ok || (len(kv) == 2 && v != kv[1]) {
+			return false
+		}
+	}
+
+	return true
+}
+
 // ListServersDetails provides server details by tenant or by flavor.
 // This function is exported for use by ciao-controller due to legacy
 // endpoint using the "flavor" option. It is simpler to just overload
 // this function than to reimplement the legacy code.
 //
 // @Title ListServerDetails
-// @Description Lists all servers with details.
+// @Description Lists all servers with details, filtered by the name, tags, tags-any, not-tags, not-tags-any and metadata query parameters.
 // @Accept  json
 // @Success 200 {array} ServerDetails "Returns details of all servers."
 // @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
@@ -586,6 +1146,11 @@ func ListServersDetails(c *Context, w http.ResponseWriter, r *http.Request) (API
 		return errorResponse(err), err
 	}
 
+	servers, err = filterServers(servers, r.URL.Query())
+	if err != nil {
+		return APIResponse{http.StatusBadRequest, nil}, err
+	}
+
 	pager := serverPager{servers: servers}
 	filterType := none
 	filter := ""
@@ -649,7 +1214,7 @@ func deleteServer(c *Context, w http.ResponseWriter, r *http.Request) (APIRespon
 }
 
 // @Title serverAction
-// @Description Runs the indicated action (os-start, os-stop) in the a server.
+// @Description Runs the indicated action (os-start, os-stop, addSecurityGroup, removeSecurityGroup) in the a server.
 // @Accept  json
 // @Success 202 {object} string "This operation does not return a response body, returns the 202 StatusAccepted code."
 // @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
@@ -670,6 +1235,26 @@ func serverAction(c *Context, w http.ResponseWriter, r *http.Request) (APIRespon
 		return APIResponse{http.StatusBadRequest, nil}, err
 	}
 
+	var groupAction struct {
+		AddSecurityGroup    *SecurityGroup `json:"addSecurityGroup"`
+		RemoveSecurityGroup *SecurityGroup `json:"removeSecurityGroup"`
+	}
+
+	err = json.Unmarshal(body, &groupAction)
+	if err == nil && (groupAction.AddSecurityGroup != nil || groupAction.RemoveSecurityGroup != nil) {
+		if groupAction.AddSecurityGroup != nil {
+			err = c.AddServerSecurityGroup(tenant, server, groupAction.AddSecurityGroup.Name)
+		} else {
+			err = c.RemoveServerSecurityGroup(tenant, server, groupAction.RemoveSecurityGroup.Name)
+		}
+
+		if err != nil {
+			return errorResponse(err), err
+		}
+
+		return APIResponse{http.StatusAccepted, nil}, nil
+	}
+
 	bodyString := string(body)
 
 	var action action
@@ -697,21 +1282,36 @@ func serverAction(c *Context, w http.ResponseWriter, r *http.Request) (APIRespon
 	return APIResponse{http.StatusAccepted, nil}, nil
 }
 
-// @Title listFlavors
-// @Description Lists flavors.
+// @Title updateServer
+// @Description Changes the name of a server.
 // @Accept  json
-// @Success 200 {object} Flavors "Returns Flavors with the corresponding available flavors for the tenant."
+// @Success 200 {object} Server "Returns details for the server."
 // @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
 // @Failure 500 {object} HTTPReturnErrorCode "The response contains the corresponding message and 50x corresponding code."
-// @Router /v2.1/{tenant}/flavors [get]
-// @Resource /v2.1/{tenant}/flavors
-func listFlavors(c *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+// @Router /v2.1/{tenant}/servers/{server} [put]
+// @Resource /v2.1/{tenant}/servers
+func updateServer(c *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
 	vars := mux.Vars(r)
 	tenant := vars["tenant"]
+	server := vars["server"]
 
 	DumpRequest(r)
 
-	resp, err := c.ListFlavors(tenant)
+	defer r.Body.Close()
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return APIResponse{http.StatusBadRequest, nil}, err
+	}
+
+	var req UpdateServerRequest
+
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		return APIResponse{http.StatusBadRequest, nil}, err
+	}
+
+	resp, err := c.UpdateServer(tenant, server, req)
 	if err != nil {
 		return errorResponse(err), err
 	}
@@ -719,52 +1319,1128 @@ func listFlavors(c *Context, w http.ResponseWriter, r *http.Request) (APIRespons
 	return APIResponse{http.StatusOK, resp}, nil
 }
 
-// @Title listFlavorsDetails
-// @Description Lists flavors with details.
+// serverMetadata returns the metadata of a server, never nil.
+func serverMetadata(c *Context, tenant string, server string) (map[string]string, error) {
+	s, err := c.ShowServerDetails(tenant, server)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := make(map[string]string)
+	for k, v := range s.Server.Metadata {
+		metadata[k] = v
+	}
+
+	return metadata, nil
+}
+
+// serverTags returns the tags of a server, never nil.
+func serverTags(c *Context, tenant string, server string) ([]string, error) {
+	s, err := c.ShowServerDetails(tenant, server)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]string{}, s.Server.Tags...), nil
+}
+
+// setServerMetadata validates and stores the metadata of a server.
+func setServerMetadata(c *Context, tenant string, server string, metadata map[string]string) (APIResponse, error) {
+	err := validateMetadata(metadata)
+	if err == nil {
+		err = c.SetServerMetadata(tenant, server, metadata)
+	}
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return APIResponse{http.StatusOK, ServerMetadata{Metadata: metadata}}, nil
+}
+
+// @Title listServerMetadata
+// @Description Lists the metadata of a server.
 // @Accept  json
-// @Success 200 {object} FlavorsDetails "Returns FlavorsDetails with flavor details."
+// @Success 200 {object} ServerMetadata "Returns the metadata of the server."
 // @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
 // @Failure 500 {object} HTTPReturnErrorCode "The response contains the corresponding message and 50x corresponding code."
-// @Router /v2.1/{tenant}/flavors/detail [get]
-// @Resource /v2.1/{tenant}/flavors
-func listFlavorsDetails(c *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+// @Router /v2.1/{tenant}/servers/{server}/metadata [get]
+// @Resource /v2.1/{tenant}/servers
+func listServerMetadata(c *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
 	vars := mux.Vars(r)
 	tenant := vars["tenant"]
+	server := vars["server"]
 
 	DumpRequest(r)
 
-	resp, err := c.ListFlavorsDetail(tenant)
+	metadata, err := serverMetadata(c, tenant, server)
 	if err != nil {
 		return errorResponse(err), err
 	}
 
-	return APIResponse{http.StatusOK, resp}, nil
+	return APIResponse{http.StatusOK, ServerMetadata{Metadata: metadata}}, nil
 }
 
-// @Title showFlavorDetails
-// @Description Shows details for a flavor.
+// readServerMetadata reads the metadata of a request body.
+func readServerMetadata(r *http.Request) (map[string]string, error) {
+	defer r.Body.Close()
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var req ServerMetadata
+
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		return nil, err
+	}
+
+	return req.Metadata, nil
+}
+
+// @Title updateServerMetadata
+// @Description Adds metadata items to a server, replacing the items with the same keys.
 // @Accept  json
-// @Success 200 {object} Flavor "Returns details for a flavor."
+// @Success 200 {object} ServerMetadata "Returns all the metadata of the server."
 // @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
 // @Failure 500 {object} HTTPReturnErrorCode "The response contains the corresponding message and 50x corresponding code."
-// @Router /v2.1/{tenant}/flavors/{flavor} [get]
-// @Resource /v2.1/{tenant}/flavors
-func showFlavorDetails(c *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+// @Router /v2.1/{tenant}/servers/{server}/metadata [post]
+// @Resource /v2.1/{tenant}/servers
+func updateServerMetadata(c *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
 	vars := mux.Vars(r)
 	tenant := vars["tenant"]
-	flavor := vars["flavor"]
+	server := vars["server"]
 
 	DumpRequest(r)
 
-	resp, err := c.ShowFlavorDetails(tenant, flavor)
+	items, err := readServerMetadata(r)
+	if err != nil {
+		return APIResponse{http.StatusBadRequest, nil}, err
+	}
+
+	metadata, err := serverMetadata(c, tenant, server)
 	if err != nil {
 		return errorResponse(err), err
 	}
 
-	return APIResponse{http.StatusOK, resp}, nil
+	for k, v := range items {
+		metadata[k] = v
+	}
+
+	return setServerMetadata(c, tenant, server, metadata)
 }
 
-// Routes returns a gorilla mux router for the compute endpoints.
+// @Title replaceServerMetadata
+// @Description Replaces all the metadata of a server.
+// @Accept  json
+// @Success 200 {object} ServerMetadata "Returns the metadata of the server."
+// @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
+// @Failure 500 {object} HTTPReturnErrorCode "The response contains the corresponding message and 50x corresponding code."
+// @Router /v2.1/{tenant}/servers/{server}/metadata [put]
+// @Resource /v2.1/{tenant}/servers
+func replaceServerMetadata(c *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+	server := vars["server"]
+
+	DumpRequest(r)
+
+	metadata, err := readServerMetadata(r)
+	if err != nil {
+		return APIResponse{http.StatusBadRequest, nil}, err
+	}
+
+	if metadata == nil {
+		metadata = make(map[string]string)
+	}
+
+	return setServerMetadata(c, tenant, server, metadata)
+}
+
+// @Title showServerMetadataItem
+// @Description Shows a metadata item of a server.
+// @Accept  json
+// @Success 200 {object} ServerMetadataItem "Returns the metadata item."
+// @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
+// @Failure 500 {object} HTTPReturnErrorCode "The response contains the corresponding message and 50x corresponding code."
+// @Router /v2.1/{tenant}/servers/{server}/metadata/{key} [get]
+// @Resource /v2.1/{tenant}/servers
+func showServerMetadataItem(c *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+	server := vars["server"]
+	key := vars["key"]
+
+	DumpRequest(r)
+
+	metadata, err := serverMetadata(c, tenant, server)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	v, ok := metadata[key]
+	if !ok {
+		return errorResponse(ErrMetadataNotFound), ErrMetadataNotFound
+	}
+
+	return APIResponse{http.StatusOK, ServerMetadataItem{Meta: map[string]string{key: v}}}, nil
+}
+
+// @Title setServerMetadataItem
+// @Description Creates or replaces a metadata item of a server.
+// @Accept  json
+// @Success 200 {object} ServerMetadataItem "Returns the metadata item."
+// @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
+// @Failure 500 {object} HTTPReturnErrorCode "The response contains the corresponding message and 50x corresponding code."
+// @Router /v2.1/{tenant}/servers/{server}/metadata/{key} [put]
+// @Resource /v2.1/{tenant}/servers
+func setServerMetadataItem(c *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+	server := vars["server"]
+	key := vars["key"]
+
+	DumpRequest(r)
+
+	defer r.Body.Close()
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return APIResponse{http.StatusBadRequest, nil}, err
+	}
+
+	var req ServerMetadataItem
+
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		return APIResponse{http.StatusBadRequest, nil}, err
+	}
+
+	v, ok := req.Meta[key]
+	if !ok || len(req.Meta) != 1 {
+		return errorResponse(ErrInvalidMetadata), ErrInvalidMetadata
+	}
+
+	metadata, err := serverMetadata(c, tenant, server)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	metadata[key] = v
+
+	resp, err := setServerMetadata(c, tenant, server, metadata)
+	if err != nil {
+		return resp, err
+	}
+
+	return APIResponse{http.StatusOK, req}, nil
+}
+
+// @Title deleteServerMetadataItem
+// @Description Deletes a metadata item of a server.
+// @Accept  json
+// @Success 204 {object} string "This operation does not return a response body, returns the 204 StatusNoContent code."
+// @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
+// @Failure 500 {object} HTTPReturnErrorCode "The response contains the corresponding message and 50x corresponding code."
+// @Router /v2.1/{tenant}/servers/{server}/metadata/{key} [delete]
+// @Resource /v2.1/{tenant}/servers
+func deleteServerMetadataItem(c *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+	server := vars["server"]
+	key := vars["key"]
+
+	DumpRequest(r)
+
+	metadata, err := serverMetadata(c, tenant, server)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	if _, ok := metadata[key]; !ok {
+		return errorResponse(ErrMetadataNotFound), ErrMetadataNotFound
+	}
+
+	delete(metadata, key)
+
+	err = c.SetServerMetadata(tenant, server, metadata)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return APIResponse{http.StatusNoContent, nil}, nil
+}
+
+// @Title listServerTags
+// @Description Lists the tags of a server.
+// @Accept  json
+// @Success 200 {object} ServerTags "Returns the tags of the server."
+// @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
+// @Failure 500 {object} HTTPReturnErrorCode "The response contains the corresponding message and 50x corresponding code."
+// @Router /v2.1/{tenant}/servers/{server}/tags [get]
+// @Resource /v2.1/{tenant}/servers
+func listServerTags(c *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+	server := vars["server"]
+
+	DumpRequest(r)
+
+	tags, err := serverTags(c, tenant, server)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return APIResponse{http.StatusOK, ServerTags{Tags: tags}}, nil
+}
+
+// @Title replaceServerTags
+// @Description Replaces all the tags of a server.
+// @Accept  json
+// @Success 200 {object} ServerTags "Returns the tags of the server."
+// @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
+// @Failure 500 {object} HTTPReturnErrorCode "The response contains the corresponding message and 50x corresponding code."
+// @Router /v2.1/{tenant}/servers/{server}/tags [put]
+// @Resource /v2.1/{tenant}/servers
+func replaceServerTags(c *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+	server := vars["server"]
+
+	DumpRequest(r)
+
+	defer r.Body.Close()
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return APIResponse{http.StatusBadRequest, nil}, err
+	}
+
+	var req ServerTags
+
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		return APIResponse{http.StatusBadRequest, nil}, err
+	}
+
+	if req.Tags == nil {
+		req.Tags = []string{}
+	}
+
+	err = validateTags(req.Tags)
+	if err == nil {
+		err = c.SetServerTags(tenant, server, req.Tags)
+	}
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return APIResponse{http.StatusOK, req}, nil
+}
+
+// @Title deleteServerTags
+// @Description Deletes all the tags of a server.
+// @Accept  json
+// @Success 204 {object} string "This operation does not return a response body, returns the 204 StatusNoContent code."
+// @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
+// @Failure 500 {object} HTTPReturnErrorCode "The response contains the corresponding message and 50x corresponding code."
+// @Router /v2.1/{tenant}/servers/{server}/tags [delete]
+// @Resource /v2.1/{tenant}/servers
+func deleteServerTags(c *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+	server := vars["server"]
+
+	DumpRequest(r)
+
+	err := c.SetServerTags(tenant, server, nil)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return APIResponse{http.StatusNoContent, nil}, nil
+}
+
+// @Title checkServerTag
+// @Description Checks whether a server has a tag.
+// @Accept  json
+// @Success 204 {object} string "The server has the tag, returns the 204 StatusNoContent code."
+// @Failure 404 {object} HTTPReturnErrorCode "The server does not have the tag."
+// @Failure 500 {object} HTTPReturnErrorCode "The response contains the corresponding message and 50x corresponding code."
+// @Router /v2.1/{tenant}/servers/{server}/tags/{tag} [get]
+// @Resource /v2.1/{tenant}/servers
+func checkServerTag(c *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+	server := vars["server"]
+	tag := vars["tag"]
+
+	DumpRequest(r)
+
+	tags, err := serverTags(c, tenant, server)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	for _, t := range tags {
+		if t == tag {
+			return APIResponse{http.StatusNoContent, nil}, nil
+		}
+	}
+
+	return errorResponse(ErrTagNotFound), ErrTagNotFound
+}
+
+// @Title addServerTag
+// @Description Adds a tag to a server.
+// @Accept  json
+// @Success 201 {object} string "The tag was added, returns the 201 StatusCreated code."
+// @Success 204 {object} string "The server already has the tag, returns the 204 StatusNoContent code."
+// @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
+// @Failure 500 {object} HTTPReturnErrorCode "The response contains the corresponding message and 50x corresponding code."
+// @Router /v2.1/{tenant}/servers/{server}/tags/{tag} [put]
+// @Resource /v2.1/{tenant}/servers
+func addServerTag(c *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+	server := vars["server"]
+	tag := vars["tag"]
+
+	DumpRequest(r)
+
+	tags, err := serverTags(c, tenant, server)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	for _, t := range tags {
+		if t == tag {
+			return APIResponse{http.StatusNoContent, nil}, nil
+		}
+	}
+
+	tags = append(tags, tag)
+
+	err = validateTags(tags)
+	if err == nil {
+		err = c.SetServerTags(tenant, server, tags)
+	}
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return APIResponse{http.StatusCreated, nil}, nil
+}
+
+// @Title deleteServerTag
+// @Description Deletes a tag of a server.
+// @Accept  json
+// @Success 204 {object} string "This operation does not return a response body, returns the 204 StatusNoContent code."
+// @Failure 404 {object} HTTPReturnErrorCode "The server does not have the tag."
+// @Failure 500 {object} HTTPReturnErrorCode "The response contains the corresponding message and 50x corresponding code."
+// @Router /v2.1/{tenant}/servers/{server}/tags/{tag} [delete]
+// @Resource /v2.1/{tenant}/servers
+func deleteServerTag(c *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+	server := vars["server"]
+	tag := vars["tag"]
+
+	DumpRequest(r)
+
+	tags, err := serverTags(c, tenant, server)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	var remaining []string
+	for _, t := range tags {
+		if t != tag {
+			remaining = append(remaining, t)
+		}
+	}
+
+	if len(remaining) == len(tags) {
+		return errorResponse(ErrTagNotFound), ErrTagNotFound
+	}
+
+	err = c.SetServerTags(tenant, server, remaining)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return APIResponse{http.StatusNoContent, nil}, nil
+}
+
+// @Title listFlavors
+// @Description Lists flavors.
+// @Accept  json
+// @Success 200 {object} Flavors "Returns Flavors with the corresponding available flavors for the tenant."
+// @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
+// @Failure 500 {object} HTTPReturnErrorCode "The response contains the corresponding message and 50x corresponding code."
+// @Router /v2.1/{tenant}/flavors [get]
+// @Resource /v2.1/{tenant}/flavors
+func listFlavors(c *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+
+	DumpRequest(r)
+
+	resp, err := c.ListFlavors(tenant)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return APIResponse{http.StatusOK, resp}, nil
+}
+
+// @Title listFlavorsDetails
+// @Description Lists flavors with details.
+// @Accept  json
+// @Success 200 {object} FlavorsDetails "Returns FlavorsDetails with flavor details."
+// @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
+// @Failure 500 {object} HTTPReturnErrorCode "The response contains the corresponding message and 50x corresponding code."
+// @Router /v2.1/{tenant}/flavors/detail [get]
+// @Resource /v2.1/{tenant}/flavors
+func listFlavorsDetails(c *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+
+	DumpRequest(r)
+
+	resp, err := c.ListFlavorsDetail(tenant)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return APIResponse{http.StatusOK, resp}, nil
+}
+
+// @Title showFlavorDetails
+// @Description Shows details for a flavor.
+// @Accept  json
+// @Success 200 {object} Flavor "Returns details for a flavor."
+// @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
+// @Failure 500 {object} HTTPReturnErrorCode "The response contains the corresponding message and 50x corresponding code."
+// @Router /v2.1/{tenant}/flavors/{flavor} [get]
+// @Resource /v2.1/{tenant}/flavors
+func showFlavorDetails(c *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+	flavor := vars["flavor"]
+
+	DumpRequest(r)
+
+	resp, err := c.ShowFlavorDetails(tenant, flavor)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return APIResponse{http.StatusOK, resp}, nil
+}
+
+func quotaSet(detail QuotaSetDetail) QuotaSet {
+	return QuotaSet{
+		ID:          detail.ID,
+		Instances:   detail.Instances.Limit,
+		Cores:       detail.Cores.Limit,
+		RAM:         detail.RAM.Limit,
+		FloatingIPs: detail.FloatingIPs.Limit,
+	}
+}
+
+// @Title showQuotaSet
+// @Description Shows the quotas of a tenant.  Tenants may only show their own quotas.
+// @Accept  json
+// @Success 200 {object} QuotaSetResponse "Returns the quotas of the tenant."
+// @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
+// @Failure 500 {object} HTTPReturnErrorCode "The response contains the corresponding message and 50x corresponding code."
+// @Router /v2.1/{tenant}/os-quota-sets/{target} [get]
+// @Resource /v2.1/{tenant}/os-quota-sets
+func showQuotaSet(c *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+	target := vars["target"]
+
+	DumpRequest(r)
+
+	if tenant != target && !identity.Privileged(r.Context()) {
+		return errorResponse(ErrNotAdmin), ErrNotAdmin
+	}
+
+	detail, err := c.ShowQuotaSet(tenant, target)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return APIResponse{http.StatusOK, QuotaSetResponse{quotaSet(detail)}}, nil
+}
+
+// @Title showQuotaSetDetail
+// @Description Shows the quotas of a tenant along with their usage.
+// @Accept  json
+// @Success 200 {object} QuotaSetDetailResponse "Returns the quotas and usage of the tenant."
+// @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
+// @Failure 500 {object} HTTPReturnErrorCode "The response contains the corresponding message and 50x corresponding code."
+// @Router /v2.1/{tenant}/os-quota-sets/{target}/detail [get]
+// @Resource /v2.1/{tenant}/os-quota-sets
+func showQuotaSetDetail(c *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+	target := vars["target"]
+
+	DumpRequest(r)
+
+	if tenant != target && !identity.Privileged(r.Context()) {
+		return errorResponse(ErrNotAdmin), ErrNotAdmin
+	}
+
+	detail, err := c.ShowQuotaSet(tenant, target)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return APIResponse{http.StatusOK, QuotaSetDetailResponse{detail}}, nil
+}
+
+// @Title updateQuotaSet
+// @Description Updates the quotas of a tenant.  Requires admin privileges.
+// @Accept  json
+// @Success 200 {object} QuotaSetResponse "Returns the updated quotas of the tenant."
+// @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
+// @Failure 500 {object} HTTPReturnErrorCode "The response contains the corresponding message and 50x corresponding code."
+// @Router /v2.1/{tenant}/os-quota-sets/{target} [put]
+// @Resource /v2.1/{tenant}/os-quota-sets
+func updateQuotaSet(c *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+	target := vars["target"]
+
+	DumpRequest(r)
+
+	if !identity.Privileged(r.Context()) {
+		return errorResponse(ErrNotAdmin), ErrNotAdmin
+	}
+
+	defer r.Body.Close()
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return APIResponse{http.StatusBadRequest, nil}, err
+	}
+
+	var req UpdateQuotaSetRequest
+
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		return APIResponse{http.StatusBadRequest, nil}, err
+	}
+
+	detail, err := c.UpdateQuotaSet(tenant, target, req.QuotaSet)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	quotas := quotaSet(detail)
+	quotas.ID = ""
+
+	return APIResponse{http.StatusOK, QuotaSetResponse{quotas}}, nil
+}
+
+// @Title deleteQuotaSet
+// @Description Reverts the quotas of a tenant to unlimited.  Requires admin privileges.
+// @Accept  json
+// @Success 202 {object} string "This operation does not return a response body, returns the 202 StatusAccepted code."
+// @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
+// @Failure 500 {object} HTTPReturnErrorCode "The response contains the corresponding message and 50x corresponding code."
+// @Router /v2.1/{tenant}/os-quota-sets/{target} [delete]
+// @Resource /v2.1/{tenant}/os-quota-sets
+func deleteQuotaSet(c *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+	target := vars["target"]
+
+	DumpRequest(r)
+
+	if !identity.Privileged(r.Context()) {
+		return errorResponse(ErrNotAdmin), ErrNotAdmin
+	}
+
+	err := c.DeleteQuotaSet(tenant, target)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return APIResponse{http.StatusAccepted, nil}, nil
+}
+
+// usageTimeFormats are the formats accepted for the start and end of a
+// usage report, the OpenStack clients send UTC times without a zone.
+var usageTimeFormats = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999",
+	"2006-01-02",
+}
+
+// usagePeriod returns the period of a usage report.  The period ends
+// now and spans a day unless the request sets start and end.
+func usagePeriod(r *http.Request) (time.Time, time.Time, error) {
+	values := r.URL.Query()
+
+	parse := func(name string, def time.Time) (time.Time, error) {
+		value := values.Get(name)
+		if value == "" {
+			return def, nil
+		}
+
+		for _, format := range usageTimeFormats {
+			t, err := time.Parse(format, value)
+			if err == nil {
+				return t.UTC(), nil
+			}
+		}
+
+		return def, fmt.Errorf("invalid %s time %q", name, value)
+	}
+
+	end, err := parse("end", time.Now().UTC())
+	if err != nil {
+		return end, end, err
+	}
+
+	start, err := parse("start", end.Add(-24*time.Hour))
+	if err != nil {
+		return start, end, err
+	}
+
+	if !start.Before(end) {
+		return start, end, fmt.Errorf("usage report start %v is not before its end %v", start, end)
+	}
+
+	return start, end, nil
+}
+
+// @Title listTenantUsage
+// @Description Lists the usage of all the tenants over a period.  Requires admin privileges.
+// @Accept  json
+// @Success 200 {object} TenantUsagesResponse "Returns the usage of the tenants."
+// @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
+// @Failure 500 {object} HTTPReturnErrorCode "The response contains the corresponding message and 50x corresponding code."
+// @Router /v2.1/{tenant}/os-simple-tenant-usage [get]
+// @Resource /v2.1/{tenant}/os-simple-tenant-usage
+func listTenantUsage(c *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	DumpRequest(r)
+
+	if !identity.Privileged(r.Context()) {
+		return errorResponse(ErrNotAdmin), ErrNotAdmin
+	}
+
+	start, end, err := usagePeriod(r)
+	if err != nil {
+		return APIResponse{http.StatusBadRequest, nil}, err
+	}
+
+	usages, err := c.ListTenantUsage(start, end)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	if r.URL.Query().Get("detailed") != "1" {
+		for i := range usages {
+			usages[i].ServerUsages = nil
+		}
+	}
+
+	return APIResponse{http.StatusOK, TenantUsagesResponse{usages}}, nil
+}
+
+// @Title showTenantUsage
+// @Description Shows the usage of a tenant and of its servers over a period.  Tenants may only show their own usage.
+// @Accept  json
+// @Success 200 {object} TenantUsageResponse "Returns the usage of the tenant."
+// @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
+// @Failure 500 {object} HTTPReturnErrorCode "The response contains the corresponding message and 50x corresponding code."
+// @Router /v2.1/{tenant}/os-simple-tenant-usage/{target} [get]
+// @Resource /v2.1/{tenant}/os-simple-tenant-usage
+func showTenantUsage(c *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+	target := vars["target"]
+
+	DumpRequest(r)
+
+	if tenant != target && !identity.Privileged(r.Context()) {
+		return errorResponse(ErrNotAdmin), ErrNotAdmin
+	}
+
+	start, end, err := usagePeriod(r)
+	if err != nil {
+		return APIResponse{http.StatusBadRequest, nil}, err
+	}
+
+	usage, err := c.ShowTenantUsage(target, start, end)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return APIResponse{http.StatusOK, TenantUsageResponse{usage}}, nil
+}
+
+// keypairUser returns the user whose keypairs a request refers to, the
+// caller unless an admin names another user with the user_id parameter.
+func keypairUser(r *http.Request) string {
+	if user := r.URL.Query().Get("user_id"); user != "" && identity.Privileged(r.Context()) {
+		return user
+	}
+
+	caller := identity.CallerFromContext(r.Context())
+	if caller == nil {
+		return ""
+	}
+
+	return caller.UserID
+}
+
+// @Title createKeypair
+// @Description Generates or imports a keypair of the caller.
+// @Accept  json
+// @Success 200 {object} KeypairResponse "Returns the keypair, along with its private key when it is generated."
+// @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
+// @Failure 500 {object} HTTPReturnErrorCode "The response contains the corresponding message and 50x corresponding code."
+// @Router /v2.1/{tenant}/os-keypairs [post]
+// @Resource /v2.1/{tenant}/os-keypairs
+func createKeypair(c *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+
+	DumpRequest(r)
+
+	defer r.Body.Close()
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return APIResponse{http.StatusBadRequest, nil}, err
+	}
+
+	var req CreateKeypairRequest
+
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		return APIResponse{http.StatusBadRequest, nil}, err
+	}
+
+	keypair, err := c.CreateKeypair(tenant, keypairUser(r), req.Keypair)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return APIResponse{http.StatusOK, KeypairResponse{keypair}}, nil
+}
+
+// @Title listKeypairs
+// @Description Lists the keypairs of the caller.
+// @Accept  json
+// @Success 200 {object} KeypairsResponse "Returns the keypairs of the caller."
+// @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
+// @Failure 500 {object} HTTPReturnErrorCode "The response contains the corresponding message and 50x corresponding code."
+// @Router /v2.1/{tenant}/os-keypairs [get]
+// @Resource /v2.1/{tenant}/os-keypairs
+func listKeypairs(c *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+
+	DumpRequest(r)
+
+	keypairs, err := c.ListKeypairs(tenant, keypairUser(r))
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	resp := KeypairsResponse{Keypairs: []KeypairResponse{}}
+	for _, k := range keypairs {
+		resp.Keypairs = append(resp.Keypairs, KeypairResponse{k})
+	}
+
+	return APIResponse{http.StatusOK, resp}, nil
+}
+
+// @Title showKeypair
+// @Description Shows a keypair of the caller.
+// @Accept  json
+// @Success 200 {object} KeypairResponse "Returns the keypair."
+// @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
+// @Failure 500 {object} HTTPReturnErrorCode "The response contains the corresponding message and 50x corresponding code."
+// @Router /v2.1/{tenant}/os-keypairs/{keypair} [get]
+// @Resource /v2.1/{tenant}/os-keypairs
+func showKeypair(c *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+	name := vars["keypair"]
+
+	DumpRequest(r)
+
+	keypair, err := c.ShowKeypair(tenant, keypairUser(r), name)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return APIResponse{http.StatusOK, KeypairResponse{keypair}}, nil
+}
+
+// @Title deleteKeypair
+// @Description Deletes a keypair of the caller.
+// @Accept  json
+// @Success 202 {object} string "This operation does not return a response body, returns the 202 StatusAccepted code."
+// @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
+// @Failure 500 {object} HTTPReturnErrorCode "The response contains the corresponding message and 50x corresponding code."
+// @Router /v2.1/{tenant}/os-keypairs/{keypair} [delete]
+// @Resource /v2.1/{tenant}/os-keypairs
+func deleteKeypair(c *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+	name := vars["keypair"]
+
+	DumpRequest(r)
+
+	err := c.DeleteKeypair(tenant, keypairUser(r), name)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return APIResponse{http.StatusAccepted, nil}, nil
+}
+
+// @Title createSecurityGroup
+// @Description Creates a security group of the tenant.
+// @Accept  json
+// @Success 200 {object} SecurityGroupResponse "Returns the security group."
+// @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
+// @Failure 500 {object} HTTPReturnErrorCode "The response contains the corresponding message and 50x corresponding code."
+// @Router /v2.1/{tenant}/os-security-groups [post]
+// @Resource /v2.1/{tenant}/os-security-groups
+func createSecurityGroup(c *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+
+	DumpRequest(r)
+
+	defer r.Body.Close()
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return APIResponse{http.StatusBadRequest, nil}, err
+	}
+
+	var req CreateSecurityGroupRequest
+
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		return APIResponse{http.StatusBadRequest, nil}, err
+	}
+
+	group, err := c.CreateSecurityGroup(tenant, req.SecurityGroup)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return APIResponse{http.StatusOK, SecurityGroupResponse{group}}, nil
+}
+
+// @Title listSecurityGroups
+// @Description Lists the security groups of the tenant.
+// @Accept  json
+// @Success 200 {object} SecurityGroupsResponse "Returns the security groups of the tenant."
+// @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
+// @Failure 500 {object} HTTPReturnErrorCode "The response contains the corresponding message and 50x corresponding code."
+// @Router /v2.1/{tenant}/os-security-groups [get]
+// @Resource /v2.1/{tenant}/os-security-groups
+func listSecurityGroups(c *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+
+	DumpRequest(r)
+
+	groups, err := c.ListSecurityGroups(tenant)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	resp := SecurityGroupsResponse{SecurityGroups: []SecurityGroup{}}
+	resp.SecurityGroups = append(resp.SecurityGroups, groups...)
+
+	return APIResponse{http.StatusOK, resp}, nil
+}
+
+// @Title showSecurityGroup
+// @Description Shows a security group of the tenant.
+// @Accept  json
+// @Success 200 {object} SecurityGroupResponse "Returns the security group."
+// @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
+// @Failure 500 {object} HTTPReturnErrorCode "The response contains the corresponding message and 50x corresponding code."
+// @Router /v2.1/{tenant}/os-security-groups/{group} [get]
+// @Resource /v2.1/{tenant}/os-security-groups
+func showSecurityGroup(c *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+	groupID := vars["group"]
+
+	DumpRequest(r)
+
+	group, err := c.ShowSecurityGroup(tenant, groupID)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return APIResponse{http.StatusOK, SecurityGroupResponse{group}}, nil
+}
+
+// @Title updateSecurityGroup
+// @Description Changes the name and description of a security group of the tenant.
+// @Accept  json
+// @Success 200 {object} SecurityGroupResponse "Returns the updated security group."
+// @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
+// @Failure 500 {object} HTTPReturnErrorCode "The response contains the corresponding message and 50x corresponding code."
+// @Router /v2.1/{tenant}/os-security-groups/{group} [put]
+// @Resource /v2.1/{tenant}/os-security-groups
+func updateSecurityGroup(c *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+	groupID := vars["group"]
+
+	DumpRequest(r)
+
+	defer r.Body.Close()
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return APIResponse{http.StatusBadRequest, nil}, err
+	}
+
+	var req CreateSecurityGroupRequest
+
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		return APIResponse{http.StatusBadRequest, nil}, err
+	}
+
+	group, err := c.UpdateSecurityGroup(tenant, groupID, req.SecurityGroup)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return APIResponse{http.StatusOK, SecurityGroupResponse{group}}, nil
+}
+
+// @Title deleteSecurityGroup
+// @Description Deletes a security group of the tenant which no server and no rule refers to.
+// @Accept  json
+// @Success 202 {object} string "This operation does not return a response body, returns the 202 StatusAccepted code."
+// @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
+// @Failure 500 {object} HTTPReturnErrorCode "The response contains the corresponding message and 50x corresponding code."
+// @Router /v2.1/{tenant}/os-security-groups/{group} [delete]
+// @Resource /v2.1/{tenant}/os-security-groups
+func deleteSecurityGroup(c *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+	groupID := vars["group"]
+
+	DumpRequest(r)
+
+	err := c.DeleteSecurityGroup(tenant, groupID)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return APIResponse{http.StatusAccepted, nil}, nil
+}
+
+// @Title createSecurityGroupRule
+// @Description Adds a rule to a security group of the tenant.
+// @Accept  json
+// @Success 200 {object} SecurityGroupRuleResponse "Returns the security group rule."
+// @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
+// @Failure 500 {object} HTTPReturnErrorCode "The response contains the corresponding message and 50x corresponding code."
+// @Router /v2.1/{tenant}/os-security-group-rules [post]
+// @Resource /v2.1/{tenant}/os-security-group-rules
+func createSecurityGroupRule(c *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+
+	DumpRequest(r)
+
+	defer r.Body.Close()
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return APIResponse{http.StatusBadRequest, nil}, err
+	}
+
+	var req CreateSecurityGroupRuleRequest
+
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		return APIResponse{http.StatusBadRequest, nil}, err
+	}
+
+	rule, err := c.CreateSecurityGroupRule(tenant, req.SecurityGroupRule)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return APIResponse{http.StatusOK, SecurityGroupRuleResponse{rule}}, nil
+}
+
+// @Title deleteSecurityGroupRule
+// @Description Deletes a rule of a security group of the tenant.
+// @Accept  json
+// @Success 202 {object} string "This operation does not return a response body, returns the 202 StatusAccepted code."
+// @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
+// @Failure 500 {object} HTTPReturnErrorCode "The response contains the corresponding message and 50x corresponding code."
+// @Router /v2.1/{tenant}/os-security-group-rules/{rule} [delete]
+// @Resource /v2.1/{tenant}/os-security-group-rules
+func deleteSecurityGroupRule(c *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+	rule := vars["rule"]
+
+	DumpRequest(r)
+
+	err := c.DeleteSecurityGroupRule(tenant, rule)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return APIResponse{http.StatusAccepted, nil}, nil
+}
+
+// @Title listServerSecurityGroups
+// @Description Lists the security groups of a server.
+// @Accept  json
+// @Success 200 {object} SecurityGroupsResponse "Returns the security groups of the server."
+// @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
+// @Failure 500 {object} HTTPReturnErrorCode "The response contains the corresponding message and 50x corresponding code."
+// @Router /v2.1/{tenant}/servers/{server}/os-security-groups [get]
+// @Resource /v2.1/{tenant}/servers
+func listServerSecurityGroups(c *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+	server := vars["server"]
+
+	DumpRequest(r)
+
+	groups, err := c.ListServerSecurityGroups(tenant, server)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	resp := SecurityGroupsResponse{SecurityGroups: []SecurityGroup{}}
+	resp.SecurityGroups = append(resp.SecurityGroups, groups...)
+
+	return APIResponse{http.StatusOK, resp}, nil
+}
+
+// Routes returns a gorilla mux router for the compute endpoints.
 func Routes(config APIConfig) *mux.Router {
 	context := &Context{config.Port, config.ComputeService}
 
@@ -779,9 +2455,37 @@ func Routes(config APIConfig) *mux.Router {
 		APIHandler{context, showServerDetails}).Methods("GET")
 	r.Handle("/v2.1/{tenant}/servers/{server}",
 		APIHandler{context, deleteServer}).Methods("DELETE")
+	r.Handle("/v2.1/{tenant}/servers/{server}",
+		APIHandler{context, updateServer}).Methods("PUT")
 	r.Handle("/v2.1/{tenant}/servers/{server}/action",
 		APIHandler{context, serverAction}).Methods("POST")
 
+	// server metadata and tags endpoints
+	r.Handle("/v2.1/{tenant}/servers/{server}/metadata",
+		APIHandler{context, listServerMetadata}).Methods("GET")
+	r.Handle("/v2.1/{tenant}/servers/{server}/metadata",
+		APIHandler{context, updateServerMetadata}).Methods("POST")
+	r.Handle("/v2.1/{tenant}/servers/{server}/metadata",
+		APIHandler{context, replaceServerMetadata}).Methods("PUT")
+	r.Handle("/v2.1/{tenant}/servers/{server}/metadata/{key}",
+		APIHandler{context, showServerMetadataItem}).Methods("GET")
+	r.Handle("/v2.1/{tenant}/servers/{server}/metadata/{key}",
+		APIHandler{context, setServerMetadataItem}).Methods("PUT")
+	r.Handle("/v2.1/{tenant}/servers/{server}/metadata/{key}",
+		APIHandler{context, deleteServerMetadataItem}).Methods("DELETE")
+	r.Handle("/v2.1/{tenant}/servers/{server}/tags",
+		APIHandler{context, listServerTags}).Methods("GET")
+	r.Handle("/v2.1/{tenant}/servers/{server}/tags",
+		APIHandler{context, replaceServerTags}).Methods("PUT")
+	r.Handle("/v2.1/{tenant}/servers/{server}/tags",
+		APIHandler{context, deleteServerTags}).Methods("DELETE")
+	r.Handle("/v2.1/{tenant}/servers/{server}/tags/{tag}",
+		APIHandler{context, checkServerTag}).Methods("GET")
+	r.Handle("/v2.1/{tenant}/servers/{server}/tags/{tag}",
+		APIHandler{context, addServerTag}).Methods("PUT")
+	r.Handle("/v2.1/{tenant}/servers/{server}/tags/{tag}",
+		APIHandler{context, deleteServerTag}).Methods("DELETE")
+
 	// flavor related endpoints
 	r.Handle("/v2.1/{tenant}/flavors",
 		APIHandler{context, listFlavors}).Methods("GET")
@@ -790,5 +2494,49 @@ func Routes(config APIConfig) *mux.Router {
 	r.Handle("/v2.1/{tenant}/flavors/{flavor}",
 		APIHandler{context, showFlavorDetails}).Methods("GET")
 
+	// quota related endpoints
+	r.Handle("/v2.1/{tenant}/os-quota-sets/{target}",
+		APIHandler{context, showQuotaSet}).Methods("GET")
+	r.Handle("/v2.1/{tenant}/os-quota-sets/{target}/detail",
+		APIHandler{context, showQuotaSetDetail}).Methods("GET")
+	r.Handle("/v2.1/{tenant}/os-quota-sets/{target}",
+		APIHandler{context, updateQuotaSet}).Methods("PUT")
+	r.Handle("/v2.1/{tenant}/os-quota-sets/{target}",
+		APIHandler{context, deleteQuotaSet}).Methods("DELETE")
+
+	// usage related endpoints
+	r.Handle("/v2.1/{tenant}/os-simple-tenant-usage",
+		APIHandler{context, listTenantUsage}).Methods("GET")
+	r.Handle("/v2.1/{tenant}/os-simple-tenant-usage/{target}",
+		APIHandler{context, showTenantUsage}).Methods("GET")
+
+	// keypair related endpoints
+	r.Handle("/v2.1/{tenant}/os-keypairs",
+		APIHandler{context, createKeypair}).Methods("POST")
+	r.Handle("/v2.1/{tenant}/os-keypairs",
+		APIHandler{context, listKeypairs}).Methods("GET")
+	r.Handle("/v2.1/{tenant}/os-keypairs/{keypair}",
+		APIHandler{context, showKeypair}).Methods("GET")
+	r.Handle("/v2.1/{tenant}/os-keypairs/{keypair}",
+		APIHandler{context, deleteKeypair}).Methods("DELETE")
+
+	// security group related endpoints
+	r.Handle("/v2.1/{tenant}/os-security-groups",
+		APIHandler{context, createSecurityGroup}).Methods("POST")
+	r.Handle("/v2.1/{tenant}/os-security-groups",
+		APIHandler{context, listSecurityGroups}).Methods("GET")
+	r.Handle("/v2.1/{tenant}/os-security-groups/{group}",
+		APIHandler{context, showSecurityGroup}).Methods("GET")
+	r.Handle("/v2.1/{tenant}/os-security-groups/{group}",
+		APIHandler{context, updateSecurityGroup}).Methods("PUT")
+	r.Handle("/v2.1/{tenant}/os-security-groups/{group}",
+		APIHandler{context, deleteSecurityGroup}).Methods("DELETE")
+	r.Handle("/v2.1/{tenant}/os-security-group-rules",
+		APIHandler{context, createSecurityGroupRule}).Methods("POST")
+	r.Handle("/v2.1/{tenant}/os-security-group-rules/{rule}",
+		APIHandler{context, deleteSecurityGroupRule}).Methods("DELETE")
+	r.Handle("/v2.1/{tenant}/servers/{server}/os-security-groups",
+		APIHandler{context, listServerSecurityGroups}).Methods("GET")
+
 	return r
 }
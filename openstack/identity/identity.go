@@ -15,6 +15,7 @@
 package identity
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/golang/glog"
@@ -30,6 +31,12 @@ type Project struct {
 	Name string `mapstructure:"name"`
 }
 
+// User holds user information extracted from the keystone response.
+type User struct {
+	ID   string `mapstructure:"id"`
+	Name string `mapstructure:"name"`
+}
+
 // RoleEntry contains the name of a role extracted from the keystone response.
 type RoleEntry struct {
 	Name string `mapstructure:"name"`
@@ -96,6 +103,27 @@ func (r getResult) extractProject() (*Project, error) {
 	}, nil
 }
 
+func (r getResult) extractUser() (*User, error) {
+	if r.Err != nil {
+		glog.V(2).Info(r.Err)
+		return nil, r.Err
+	}
+
+	var response struct {
+		Token struct {
+			ValidUser User `mapstructure:"user"`
+		} `mapstructure:"token"`
+	}
+
+	err := mapstructure.Decode(r.Body, &response)
+	if err != nil {
+		glog.V(2).Info(err)
+		return nil, err
+	}
+
+	return &response.Token.ValidUser, nil
+}
+
 func (r getResult) extractServices() (*Services, error) {
 	if r.Err != nil {
 		glog.V(2).Info(r.Err)
@@ -207,34 +235,35 @@ func validateProjectRole(client *gophercloud.ServiceClient, token string, projec
 
 // checkToken verifies that given the token, the request is performed as
 // a valid admin and that such token is consistent with the services
-// attempted to be used in the received request
-func (h Handler) checkToken(r *http.Request, tenant string, token string) bool {
+// attempted to be used in the received request.  The second value
+// tells if the token belongs to an admin.
+func (h Handler) checkToken(r *http.Request, tenant string, token string) (bool, bool) {
 
 	/* TODO Caching or PKI */
 	for _, a := range h.ValidAdmins {
 		if validateProjectRole(h.Client, token, a.Project, a.Role) == true {
-			return true
+			return true, true
 		}
 	}
 
 	for _, s := range h.ValidServices {
 		if validateService(h.Client, token, tenant, s.ServiceType, s.ServiceName) == true {
-			return true
+			return true, false
 		} else if validateService(h.Client, token, tenant, s.ServiceType, "") == true {
-			return true
+			return true, false
 		}
 
 	}
 
 	glog.V(2).Infof("Invalid token for [%s]", tenant)
-	return false
+	return false, false
 }
 
-func (h Handler) validateToken(r *http.Request) bool {
+func (h Handler) validateToken(r *http.Request, caller *Caller) (bool, bool) {
 
 	token := r.Header["X-Auth-Token"]
 	if len(token) == 0 {
-		return false
+		return false, false
 	}
 
 	vars := mux.Vars(r)
@@ -248,10 +277,24 @@ func (h Handler) validateToken(r *http.Request) bool {
 	p, err := result.extractProject()
 	if err != nil {
 		glog.V(2).Infof("Unable to retrieve tenant from token [%s]", token)
-		return false
+		return false, false
 	}
 	tenantFromToken := p.ID
 
+	caller.ProjectID = p.ID
+	caller.ProjectName = p.Name
+
+	if u, err := result.extractUser(); err == nil {
+		caller.UserID = u.ID
+		caller.UserName = u.Name
+	}
+
+	if roles, err := result.extractRoles(); err == nil {
+		for _, role := range roles.Entries {
+			caller.Roles = append(caller.Roles, role.Name)
+		}
+	}
+
 	if tenantFromVars == "" {
 		glog.V(2).Infof("Token validation for [%s]", tenantFromToken)
 		return h.checkToken(r, tenantFromToken, token[0])
@@ -260,7 +303,7 @@ func (h Handler) validateToken(r *http.Request) bool {
 	// obtained from the URI endpoint request
 	if tenantFromVars != tenantFromToken {
 		glog.Errorf("expected tenant %v, got %v\n", tenantFromToken, tenantFromVars)
-		return false
+		return false, false
 	}
 
 	glog.V(2).Infof("Token validation for [%s]", tenantFromVars)
@@ -287,16 +330,104 @@ type Handler struct {
 	Next          http.Handler
 	ValidServices []ValidService
 	ValidAdmins   []ValidAdmin
+
+	// Policy, when set, authorizes the operations of the validated
+	// callers.  Operations maps the methods of the route to their
+	// operation names in the policy.
+	Policy     *Policy
+	Operations map[string]string
+}
+
+// policyTarget returns the target of the request the policy rules see,
+// the variables of its route and the project it refers to.
+func policyTarget(r *http.Request) map[string]string {
+	target := make(map[string]string)
+	for k, v := range mux.Vars(r) {
+		target[k] = v
+	}
+
+	if _, ok := target["project_id"]; !ok {
+		target["project_id"] = target["tenant"]
+	}
+
+	return target
 }
 
 // ServeHTTP satisfies the http handler interface.
 // It will check to make sure that the api caller is validated with
 // keystone before allowing the next handler in the chain to be called.
 func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if h.validateToken(r) == false {
+	ctx := r.Context()
+
+	caller := CallerFromContext(ctx)
+	if caller == nil {
+		caller = &Caller{}
+		ctx = WithCaller(ctx, caller)
+	}
+
+	valid, privileged := h.validateToken(r, caller)
+	caller.Admin = privileged
+
+	if valid == false {
 		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
 		return
 	}
 
-	h.Next.ServeHTTP(w, r)
+	if h.Policy != nil {
+		target := policyTarget(r)
+
+		privileged = h.Policy.Admin(caller, target)
+		caller.Admin = privileged
+
+		operation := h.Operations[r.Method]
+		if !h.Policy.Enforce(operation, caller, target) {
+			glog.V(2).Infof("Policy denies %s to user %s of project %s", operation, caller.UserID, caller.ProjectID)
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+	}
+
+	h.Next.ServeHTTP(w, r.WithContext(WithPrivilege(ctx, privileged)))
+}
+
+// Caller describes who made a request, as far as its token tells.
+type Caller struct {
+	UserID      string
+	UserName    string
+	ProjectID   string
+	ProjectName string
+	Roles       []string
+	Admin       bool
+}
+
+type callerKey struct{}
+
+// WithCaller returns a copy of ctx carrying caller.  A Handler serving a
+// request whose context already carries a Caller fills that one in, which
+// tells the handlers wrapping the Handler who made the request, even when
+// it is rejected.
+func WithCaller(ctx context.Context, caller *Caller) context.Context {
+	return context.WithValue(ctx, callerKey{}, caller)
+}
+
+// CallerFromContext returns the Caller carried by the request context, nil
+// if there is none.
+func CallerFromContext(ctx context.Context) *Caller {
+	caller, _ := ctx.Value(callerKey{}).(*Caller)
+	return caller
+}
+
+type privilegeKey struct{}
+
+// WithPrivilege returns a copy of ctx recording whether the request has
+// been authenticated as coming from an admin.
+func WithPrivilege(ctx context.Context, privileged bool) context.Context {
+	return context.WithValue(ctx, privilegeKey{}, privileged)
+}
+
+// Privileged tells if the request context has been authenticated by a
+// Handler as coming from an admin.
+func Privileged(ctx context.Context) bool {
+	privileged, _ := ctx.Value(privilegeKey{}).(bool)
+	return privileged
 }
@@ -198,3 +198,56 @@ func TestHandler(t *testing.T) {
 		}
 	}
 }
+
+func TestHandlerCaller(t *testing.T) {
+	testIdentityConfig := testutil.IdentityConfig{
+		ComputeURL: testutil.ComputeURL,
+		ProjectID:  testutil.ComputeUser,
+	}
+
+	id := testutil.StartIdentityServer(testIdentityConfig)
+	if id == nil {
+		t.Fatal("Could not start test identity server")
+	}
+
+	defer id.Close()
+
+	client, err := getIdentityClient(id.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var inner *Caller
+	testHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inner = CallerFromContext(r.Context())
+	})
+
+	h := Handler{
+		Client:        client,
+		Next:          &testHandler,
+		ValidServices: validServices,
+		ValidAdmins:   validAdmins,
+	}
+
+	req, err := http.NewRequest("GET", "/v2.1/tenants", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Auth-Token", "imavalidtoken")
+
+	// the caller provided by a wrapping handler is filled in
+	caller := &Caller{}
+	req = req.WithContext(WithCaller(req.Context(), caller))
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK || inner != caller {
+		t.Fatalf("caller not passed to the next handler: %d", rr.Code)
+	}
+
+	if caller.UserName != "admin" || caller.UserID == "" || caller.ProjectID != testutil.ComputeUser ||
+		len(caller.Roles) != 1 || caller.Roles[0] != "admin" || !caller.Admin {
+		t.Fatalf("unexpected caller %+v", caller)
+	}
+}
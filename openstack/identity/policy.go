@@ -0,0 +1,394 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identity
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// DefaultRule is the rule of the operations a policy has no rule for.
+const DefaultRule = "default"
+
+// AdminRule is the rule which, when a policy has it, decides which callers
+// are privileged instead of the ValidAdmins of the Handler.
+const AdminRule = "context_is_admin"
+
+// maxRuleDepth bounds the nesting of rule references, which catches loops.
+const maxRuleDepth = 32
+
+// Policy maps API operations to rules, in the style of the OpenStack
+// policy.json files.  A rule is an expression of checks combined with
+// "and", "or", "not" and parentheses.  The checks are:
+//
+//	""  or "@"             always true
+//	"!"                    always false
+//	role:<role>            the caller has the role
+//	rule:<name>            the named rule is true
+//	is_admin:True          the caller is privileged
+//	<attribute>:<value>    a caller attribute has the value
+//	<attribute>:%(<key>)s  a caller attribute has the value of a target key
+//
+// The caller attributes are user_id, user_name, project_id and
+// project_name.  The target of a request holds the variables of its route,
+// and project_id, the project of the route.
+type Policy struct {
+	rules map[string]check
+}
+
+type checkContext struct {
+	policy *Policy
+	caller *Caller
+	target map[string]string
+	depth  int
+}
+
+type check interface {
+	eval(ctx *checkContext) bool
+}
+
+type constCheck bool
+
+func (c constCheck) eval(ctx *checkContext) bool {
+	return bool(c)
+}
+
+type notCheck struct {
+	check check
+}
+
+func (c notCheck) eval(ctx *checkContext) bool {
+	return !c.check.eval(ctx)
+}
+
+type andCheck []check
+
+func (c andCheck) eval(ctx *checkContext) bool {
+	for _, check := range c {
+		if !check.eval(ctx) {
+			return false
+		}
+	}
+	return true
+}
+
+type orCheck []check
+
+func (c orCheck) eval(ctx *checkContext) bool {
+	for _, check := range c {
+		if check.eval(ctx) {
+			return true
+		}
+	}
+	return false
+}
+
+type ruleCheck string
+
+func (c ruleCheck) eval(ctx *checkContext) bool {
+	rule, ok := ctx.policy.rules[string(c)]
+	if !ok || ctx.depth >= maxRuleDepth {
+		return false
+	}
+
+	ctx.depth++
+	result := rule.eval(ctx)
+	ctx.depth--
+
+	return result
+}
+
+type roleCheck string
+
+func (c roleCheck) eval(ctx *checkContext) bool {
+	for _, role := range ctx.caller.Roles {
+		if strings.EqualFold(role, string(c)) {
+			return true
+		}
+	}
+	return false
+}
+
+type attributeCheck struct {
+	attribute string
+	value     string
+}
+
+func (c attributeCheck) eval(ctx *checkContext) bool {
+	value := c.value
+	if strings.HasPrefix(value, "%(") && strings.HasSuffix(value, ")s") {
+		var ok bool
+		value, ok = ctx.target[value[2:len(value)-2]]
+		if !ok {
+			return false
+		}
+	}
+
+	switch c.attribute {
+	case "is_admin":
+		return strings.EqualFold(value, fmt.Sprint(ctx.caller.Admin))
+	case "user_id":
+		return value == ctx.caller.UserID
+	case "user_name":
+		return value == ctx.caller.UserName
+	case "project_id":
+		return value == ctx.caller.ProjectID
+	case "project_name":
+		return value == ctx.caller.ProjectName
+	}
+
+	return false
+}
+
+// tokenizeRule splits a rule into its words and parentheses.
+func tokenizeRule(rule string) []string {
+	var tokens []string
+
+	for _, field := range strings.Fields(rule) {
+		for strings.HasPrefix(field, "(") {
+			tokens = append(tokens, "(")
+			field = field[1:]
+		}
+
+		closing := 0
+		for strings.HasSuffix(field, ")") && !strings.HasSuffix(field, ")s") {
+			closing++
+			field = field[:len(field)-1]
+		}
+
+		if field != "" {
+			tokens = append(tokens, field)
+		}
+
+		for ; closing > 0; closing-- {
+			tokens = append(tokens, ")")
+		}
+	}
+
+	return tokens
+}
+
+type ruleParser struct {
+	tokens []string
+}
+
+func (p *ruleParser) peek() string {
+	if len(p.tokens) == 0 {
+		return ""
+	}
+	return p.tokens[0]
+}
+
+func (p *ruleParser) next() string {
+	token := p.peek()
+	if len(p.tokens) > 0 {
+		p.tokens = p.tokens[1:]
+	}
+	return token
+}
+
+func (p *ruleParser) parseOr() (check, error) {
+	var checks orCheck
+
+	for {
+		c, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		checks = append(checks, c)
+
+		if !strings.EqualFold(p.peek(), "or") {
+			break
+		}
+		p.next()
+	}
+
+	if len(checks) == 1 {
+		return checks[0], nil
+	}
+	return checks, nil
+}
+
+func (p *ruleParser) parseAnd() (check, error) {
+	var checks andCheck
+
+	for {
+		c, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		checks = append(checks, c)
+
+		if !strings.EqualFold(p.peek(), "and") {
+			break
+		}
+		p.next()
+	}
+
+	if len(checks) == 1 {
+		return checks[0], nil
+	}
+	return checks, nil
+}
+
+func (p *ruleParser) parseNot() (check, error) {
+	if strings.EqualFold(p.peek(), "not") {
+		p.next()
+
+		c, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notCheck{c}, nil
+	}
+
+	return p.parseCheck()
+}
+
+func (p *ruleParser) parseCheck() (check, error) {
+	token := p.next()
+
+	switch token {
+	case "":
+		return nil, fmt.Errorf("unexpected end of rule")
+	case "(":
+		c, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if p.next() != ")" {
+			return nil, fmt.Errorf("missing closing parenthesis")
+		}
+		return c, nil
+	case "@":
+		return constCheck(true), nil
+	case "!":
+		return constCheck(false), nil
+	}
+
+	i := strings.Index(token, ":")
+	if i <= 0 || i == len(token)-1 {
+		return nil, fmt.Errorf("invalid check %q", token)
+	}
+
+	kind := token[:i]
+	value := strings.Trim(token[i+1:], `'"`)
+
+	switch kind {
+	case "rule":
+		return ruleCheck(value), nil
+	case "role":
+		return roleCheck(value), nil
+	case "is_admin", "user_id", "user_name", "project_id", "project_name":
+		return attributeCheck{kind, value}, nil
+	}
+
+	return nil, fmt.Errorf("unknown check %q", kind)
+}
+
+func parseRule(rule string) (check, error) {
+	p := &ruleParser{tokens: tokenizeRule(rule)}
+	if len(p.tokens) == 0 {
+		return constCheck(true), nil
+	}
+
+	c, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(p.tokens) > 0 {
+		return nil, fmt.Errorf("unexpected %q", p.peek())
+	}
+
+	return c, nil
+}
+
+// ParsePolicy parses a policy.json document, a JSON object mapping
+// operations and rule names to rules.
+func ParsePolicy(data []byte) (*Policy, error) {
+	var rules map[string]string
+
+	err := json.Unmarshal(data, &rules)
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy: %v", err)
+	}
+
+	policy := &Policy{rules: make(map[string]check)}
+
+	for name, rule := range rules {
+		c, err := parseRule(rule)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rule %q: %v", name, err)
+		}
+		policy.rules[name] = c
+	}
+
+	for name, rule := range rules {
+		for _, token := range tokenizeRule(rule) {
+			if !strings.HasPrefix(token, "rule:") {
+				continue
+			}
+
+			ref := strings.Trim(token[len("rule:"):], `'"`)
+			if _, ok := policy.rules[ref]; !ok {
+				return nil, fmt.Errorf("rule %q refers to unknown rule %q", name, ref)
+			}
+		}
+	}
+
+	return policy, nil
+}
+
+// LoadPolicy reads and parses a policy.json file.
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParsePolicy(data)
+}
+
+// Enforce reports whether the policy allows the caller to run the operation
+// on the target.  Operations without a rule follow the default rule, and
+// are allowed when the policy has no default rule either.
+func (p *Policy) Enforce(operation string, caller *Caller, target map[string]string) bool {
+	rule, ok := p.rules[operation]
+	if !ok {
+		rule, ok = p.rules[DefaultRule]
+	}
+
+	if !ok {
+		return true
+	}
+
+	return rule.eval(&checkContext{policy: p, caller: caller, target: target})
+}
+
+// Admin reports whether the caller is privileged, as decided by the
+// AdminRule of the policy or by the privileged flag the caller already has
+// if the policy has no such rule.
+func (p *Policy) Admin(caller *Caller, target map[string]string) bool {
+	rule, ok := p.rules[AdminRule]
+	if !ok {
+		return caller.Admin
+	}
+
+	return rule.eval(&checkContext{policy: p, caller: caller, target: target})
+}
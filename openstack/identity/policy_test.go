@@ -0,0 +1,210 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identity
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/01org/ciao/testutil"
+	"github.com/gorilla/mux"
+)
+
+const testPolicy = `{
+	"context_is_admin": "role:admin",
+	"admin_or_owner": "is_admin:True or project_id:%(project_id)s",
+	"operator": "role:operator and project_id:%(project_id)s",
+	"default": "rule:admin_or_owner",
+	"compute:servers:create": "",
+	"compute:servers:delete": "rule:admin_or_owner and not role:auditor",
+	"compute:servers:action": "(rule:operator or is_admin:True) and not role:auditor",
+	"ciao:pools:create": "is_admin:True",
+	"ciao:workloads:create": "!",
+	"volume:action": "@",
+	"image:create": "role:member or user_name:'glance'"
+}`
+
+var policyTests = []struct {
+	operation string
+	caller    Caller
+	target    map[string]string
+	allowed   bool
+}{
+	{"compute:servers:create", Caller{}, nil, true},
+	{"compute:servers:delete", Caller{ProjectID: "p1"}, map[string]string{"project_id": "p1"}, true},
+	{"compute:servers:delete", Caller{ProjectID: "p1"}, map[string]string{"project_id": "p2"}, false},
+	{"compute:servers:delete", Caller{ProjectID: "p1", Admin: true}, map[string]string{"project_id": "p2"}, true},
+	{"compute:servers:delete", Caller{ProjectID: "p1", Roles: []string{"Auditor"}}, map[string]string{"project_id": "p1"}, false},
+	{"compute:servers:action", Caller{ProjectID: "p1", Roles: []string{"operator"}}, map[string]string{"project_id": "p1"}, true},
+	{"compute:servers:action", Caller{ProjectID: "p1", Roles: []string{"operator"}}, map[string]string{"project_id": "p2"}, false},
+	{"compute:servers:action", Caller{ProjectID: "p1"}, map[string]string{"project_id": "p1"}, false},
+	{"ciao:pools:create", Caller{Admin: true}, nil, true},
+	{"ciao:pools:create", Caller{}, nil, false},
+	{"ciao:workloads:create", Caller{Admin: true}, nil, false},
+	{"volume:action", Caller{}, nil, true},
+	{"image:create", Caller{UserName: "glance"}, nil, true},
+	{"image:create", Caller{Roles: []string{"member"}}, nil, true},
+	{"image:create", Caller{}, nil, false},
+	{"compute:servers:list", Caller{ProjectID: "p1"}, map[string]string{"project_id": "p1"}, true},
+	{"compute:servers:list", Caller{ProjectID: "p1"}, map[string]string{}, false},
+}
+
+func TestPolicyEnforce(t *testing.T) {
+	policy, err := ParsePolicy([]byte(testPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range policyTests {
+		caller := tt.caller
+		allowed := policy.Enforce(tt.operation, &caller, tt.target)
+		if allowed != tt.allowed {
+			t.Errorf("%s by %+v on %v: got %v expected %v", tt.operation, tt.caller, tt.target, allowed, tt.allowed)
+		}
+	}
+
+	if !policy.Admin(&Caller{Roles: []string{"admin"}}, nil) || policy.Admin(&Caller{Admin: true}, nil) {
+		t.Error("admin rule not enforced")
+	}
+}
+
+func TestPolicyNoDefault(t *testing.T) {
+	policy, err := ParsePolicy([]byte(`{"compute:servers:delete": "is_admin:True"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !policy.Enforce("compute:servers:list", &Caller{}, nil) {
+		t.Error("operation without rule nor default denied")
+	}
+
+	if policy.Enforce("compute:servers:delete", &Caller{}, nil) {
+		t.Error("operation allowed to a caller without privileges")
+	}
+
+	if !policy.Admin(&Caller{Admin: true}, nil) {
+		t.Error("privileged caller not admin without an admin rule")
+	}
+}
+
+func TestPolicyRuleLoop(t *testing.T) {
+	policy, err := ParsePolicy([]byte(`{"a": "rule:b", "b": "rule:a or role:x"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if policy.Enforce("a", &Caller{}, nil) {
+		t.Error("looping rule allowed")
+	}
+}
+
+func TestParsePolicyErrors(t *testing.T) {
+	invalid := []string{
+		`[]`,
+		`{"a": "role:admin or"}`,
+		`{"a": "(role:admin"}`,
+		`{"a": "role:admin)"}`,
+		`{"a": "tenant:admin"}`,
+		`{"a": "role:"}`,
+		`{"a": "rule:missing"}`,
+		`{"a": "role:admin role:member"}`,
+	}
+
+	for _, p := range invalid {
+		_, err := ParsePolicy([]byte(p))
+		if err == nil {
+			t.Errorf("invalid policy %s parsed", p)
+		}
+	}
+}
+
+func TestHandlerPolicy(t *testing.T) {
+	testIdentityConfig := testutil.IdentityConfig{
+		ComputeURL: testutil.ComputeURL,
+		ProjectID:  testutil.ComputeUser,
+	}
+
+	id := testutil.StartIdentityServer(testIdentityConfig)
+	if id == nil {
+		t.Fatal("Could not start test identity server")
+	}
+
+	defer id.Close()
+
+	client, err := getIdentityClient(id.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy, err := ParsePolicy([]byte(`{
+		"context_is_admin": "role:auditor",
+		"owner": "project_id:%(project_id)s",
+		"compute:servers:delete": "rule:owner and role:operator",
+		"compute:servers:show": "rule:owner"
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	privileged := false
+	testHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		privileged = Privileged(r.Context())
+	})
+
+	h := Handler{
+		Client:        client,
+		Next:          &testHandler,
+		ValidServices: validServices,
+		ValidAdmins:   validAdmins,
+		Policy:        policy,
+		Operations: map[string]string{
+			"GET":    "compute:servers:show",
+			"DELETE": "compute:servers:delete",
+		},
+	}
+
+	r := mux.NewRouter()
+	r.Handle("/v2.1/{tenant}/servers/{server}", h).Methods("GET", "DELETE")
+
+	url := fmt.Sprintf("/v2.1/%s/servers/test", testutil.ComputeUser)
+
+	for _, tt := range []struct {
+		method string
+		status int
+	}{
+		{"GET", http.StatusOK},
+		{"DELETE", http.StatusForbidden},
+	} {
+		req, err := http.NewRequest(tt.method, url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("X-Auth-Token", "imavalidtoken")
+
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+
+		if rr.Code != tt.status {
+			t.Errorf("%s: got %d expected %d", tt.method, rr.Code, tt.status)
+		}
+	}
+
+	// the admin rule of the policy overrides the valid admins
+	if privileged {
+		t.Error("admin without the auditor role privileged")
+	}
+}
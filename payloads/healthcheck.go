@@ -0,0 +1,115 @@
+/*
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package payloads
+
+// HealthCheckProtocol is the protocol a health check probes an instance
+// with.
+type HealthCheckProtocol string
+
+const (
+	// HealthCheckTCP probes succeed when a TCP connection to the port of
+	// the instance is accepted.
+	HealthCheckTCP HealthCheckProtocol = "tcp"
+
+	// HealthCheckHTTP probes succeed when a GET of the path on the port
+	// of the instance returns a 2xx or 3xx status.
+	HealthCheckHTTP HealthCheckProtocol = "http"
+)
+
+// HealthCheck describes how the health of an instance is checked from its
+// tenant network.
+type HealthCheck struct {
+	// Protocol is the protocol of the probes.
+	Protocol HealthCheckProtocol `yaml:"protocol" json:"protocol"`
+
+	// Port is the port of the instance which is probed.
+	Port int `yaml:"port" json:"port"`
+
+	// Path is the path of the URL HTTP probes get.
+	Path string `yaml:"path,omitempty" json:"path,omitempty"`
+
+	// Interval is the delay in seconds between two probes.
+	Interval int `yaml:"interval" json:"interval"`
+
+	// Timeout is the delay in seconds after which a probe fails.
+	Timeout int `yaml:"timeout" json:"timeout"`
+
+	// HealthyThreshold is the number of successful probes in a row
+	// after which the instance is healthy.
+	HealthyThreshold int `yaml:"healthy_threshold" json:"healthy_threshold"`
+
+	// UnhealthyThreshold is the number of failed probes in a row after
+	// which the instance is unhealthy.
+	UnhealthyThreshold int `yaml:"unhealthy_threshold" json:"unhealthy_threshold"`
+
+	// Restart tells the controller to restart the instance when it
+	// becomes unhealthy.  It is not used by the CNCI agents.
+	Restart bool `yaml:"restart,omitempty" json:"restart,omitempty"`
+}
+
+// HealthCheckTarget is an instance whose health is checked.
+type HealthCheckTarget struct {
+	InstanceUUID string      `yaml:"instance_uuid"`
+	PrivateIP    string      `yaml:"private_ip"`
+	Check        HealthCheck `yaml:"check"`
+}
+
+// HealthChecksCommand contains all the health checks of the instances of a
+// tenant.  The CNCI agent stops checking the instances which are not
+// listed.
+type HealthChecksCommand struct {
+	ConcentratorUUID string              `yaml:"concentrator_uuid"`
+	TenantUUID       string              `yaml:"tenant_uuid"`
+	Targets          []HealthCheckTarget `yaml:"targets"`
+}
+
+// CommandConfigureHealthChecks is a wrapper around HealthChecksCommand. It
+// is the ConfigureHealthChecks command payload.
+type CommandConfigureHealthChecks struct {
+	HealthChecks HealthChecksCommand `yaml:"configure_health_checks"`
+}
+
+// HealthStatus is the result of the health checks of an instance.
+type HealthStatus string
+
+const (
+	// Healthy indicates that the last HealthyThreshold probes of the
+	// instance succeeded.
+	Healthy HealthStatus = "healthy"
+
+	// Unhealthy indicates that the last UnhealthyThreshold probes of the
+	// instance failed.
+	Unhealthy HealthStatus = "unhealthy"
+)
+
+// InstanceHealthEvent contains the health of an instance, as found by the
+// CNCI agent of its tenant, and the error of the last failed probe.
+type InstanceHealthEvent struct {
+	ConcentratorUUID string       `yaml:"concentrator_uuid"`
+	TenantUUID       string       `yaml:"tenant_uuid"`
+	InstanceUUID     string       `yaml:"instance_uuid"`
+	Health           HealthStatus `yaml:"health"`
+	Reason           string       `yaml:"reason,omitempty"`
+}
+
+// EventInstanceHealth represents the unmarshalled version of the contents
+// of an SSNTP ssntp.InstanceHealth event.  This event is sent by CNCI
+// agents when the health of an instance changes, and for all the instances
+// whose health is known when they receive their health checks.
+type EventInstanceHealth struct {
+	InstanceHealth InstanceHealthEvent `yaml:"instance_health"`
+}
@@ -0,0 +1,139 @@
+/*
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package payloads_test
+
+import (
+	"testing"
+
+	. "github.com/01org/ciao/payloads"
+	"github.com/01org/ciao/testutil"
+	"gopkg.in/yaml.v2"
+)
+
+func TestHealthChecksUnmarshal(t *testing.T) {
+	var cmd CommandConfigureHealthChecks
+
+	err := yaml.Unmarshal([]byte(testutil.HealthChecksYaml), &cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cmd.HealthChecks.ConcentratorUUID != testutil.CNCIUUID {
+		t.Errorf("Wrong concentrator UUID field [%s]", cmd.HealthChecks.ConcentratorUUID)
+	}
+
+	if cmd.HealthChecks.TenantUUID != testutil.TenantUUID {
+		t.Errorf("Wrong tenant UUID field [%s]", cmd.HealthChecks.TenantUUID)
+	}
+
+	if len(cmd.HealthChecks.Targets) != 1 {
+		t.Fatalf("Wrong number of targets [%d]", len(cmd.HealthChecks.Targets))
+	}
+
+	target := cmd.HealthChecks.Targets[0]
+	if target.InstanceUUID != testutil.InstanceUUID {
+		t.Errorf("Wrong instance UUID field [%s]", target.InstanceUUID)
+	}
+
+	if target.PrivateIP != testutil.InstancePrivateIP {
+		t.Errorf("Wrong private IP field [%s]", target.PrivateIP)
+	}
+
+	expected := HealthCheck{
+		Protocol:           HealthCheckHTTP,
+		Port:               80,
+		Path:               "/healthz",
+		Interval:           10,
+		Timeout:            5,
+		HealthyThreshold:   2,
+		UnhealthyThreshold: 3,
+	}
+	if target.Check != expected {
+		t.Errorf("Wrong check field [%+v]", target.Check)
+	}
+}
+
+func TestHealthChecksMarshal(t *testing.T) {
+	var cmd CommandConfigureHealthChecks
+
+	cmd.HealthChecks.ConcentratorUUID = testutil.CNCIUUID
+	cmd.HealthChecks.TenantUUID = testutil.TenantUUID
+	cmd.HealthChecks.Targets = []HealthCheckTarget{
+		{
+			InstanceUUID: testutil.InstanceUUID,
+			PrivateIP:    testutil.InstancePrivateIP,
+			Check: HealthCheck{
+				Protocol:           HealthCheckHTTP,
+				Port:               80,
+				Path:               "/healthz",
+				Interval:           10,
+				Timeout:            5,
+				HealthyThreshold:   2,
+				UnhealthyThreshold: 3,
+			},
+		},
+	}
+
+	y, err := yaml.Marshal(&cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(y) != testutil.HealthChecksYaml {
+		t.Errorf("ConfigureHealthChecks marshalling failed\n[%s]\n vs\n[%s]", string(y), testutil.HealthChecksYaml)
+	}
+}
+
+func TestInstanceHealthUnmarshal(t *testing.T) {
+	var event EventInstanceHealth
+
+	err := yaml.Unmarshal([]byte(testutil.InstanceHealthYaml), &event)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if event.InstanceHealth.InstanceUUID != testutil.InstanceUUID {
+		t.Errorf("Wrong instance UUID field [%s]", event.InstanceHealth.InstanceUUID)
+	}
+
+	if event.InstanceHealth.Health != Unhealthy {
+		t.Errorf("Wrong health field [%s]", event.InstanceHealth.Health)
+	}
+
+	if event.InstanceHealth.Reason != "connection refused" {
+		t.Errorf("Wrong reason field [%s]", event.InstanceHealth.Reason)
+	}
+}
+
+func TestInstanceHealthMarshal(t *testing.T) {
+	var event EventInstanceHealth
+
+	event.InstanceHealth.ConcentratorUUID = testutil.CNCIUUID
+	event.InstanceHealth.TenantUUID = testutil.TenantUUID
+	event.InstanceHealth.InstanceUUID = testutil.InstanceUUID
+	event.InstanceHealth.Health = Unhealthy
+	event.InstanceHealth.Reason = "connection refused"
+
+	y, err := yaml.Marshal(&event)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(y) != testutil.InstanceHealthYaml {
+		t.Errorf("InstanceHealth marshalling failed\n[%s]\n vs\n[%s]", string(y), testutil.InstanceHealthYaml)
+	}
+}
@@ -16,10 +16,23 @@
 
 package payloads
 
+// InstanceDeletedReason denotes why an instance was deleted.  An empty
+// reason means that the deletion was requested by the controller.
+type InstanceDeletedReason string
+
+const (
+	// Preempted indicates that the scheduler deleted a preemptible
+	// instance to make room for an instance of a higher priority class.
+	Preempted InstanceDeletedReason = "preempted"
+)
+
 // InstanceDeletedEvent contains the UUID of an instance that has just been
 // deleted.
 type InstanceDeletedEvent struct {
 	InstanceUUID string `yaml:"instance_uuid"`
+
+	// Reason is copied from the DELETE command that deleted the instance.
+	Reason InstanceDeletedReason `yaml:"reason,omitempty"`
 }
 
 // EventInstanceDeleted represents the unmarshalled version of the contents of
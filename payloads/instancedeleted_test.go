@@ -50,3 +50,19 @@ func TestInstanceDeletedMarshal(t *testing.T) {
 		t.Errorf("InstanceDeleted marshalling failed\n[%s]\n vs\n[%s]", string(y), testutil.InsDelYaml)
 	}
 }
+
+func TestInstanceDeletedPreemptedMarshal(t *testing.T) {
+	var insDel EventInstanceDeleted
+
+	insDel.InstanceDeleted.InstanceUUID = testutil.InstanceUUID
+	insDel.InstanceDeleted.Reason = Preempted
+
+	y, err := yaml.Marshal(&insDel)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if string(y) != testutil.InsDelPreemptedYaml {
+		t.Errorf("InstanceDeleted marshalling failed\n[%s]\n vs\n[%s]", string(y), testutil.InsDelPreemptedYaml)
+	}
+}
@@ -0,0 +1,34 @@
+/*
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package payloads
+
+// InstanceRestartedEvent contains the UUID of an instance that ciao-launcher
+// has just restarted following its restart policy.
+type InstanceRestartedEvent struct {
+	InstanceUUID string `yaml:"instance_uuid"`
+
+	// Restarts is the number of times the instance was restarted since
+	// it was last started or restarted by the controller.
+	Restarts int `yaml:"restarts"`
+}
+
+// EventInstanceRestarted represents the unmarshalled version of the contents
+// of an SSNTP ssntp.InstanceRestarted event. This event is sent by
+// ciao-launcher when it restarts an instance that exited on its own.
+type EventInstanceRestarted struct {
+	InstanceRestarted InstanceRestartedEvent `yaml:"instance_restarted"`
+}
@@ -0,0 +1,57 @@
+/*
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package payloads_test
+
+import (
+	"testing"
+
+	. "github.com/01org/ciao/payloads"
+	"github.com/01org/ciao/testutil"
+	"gopkg.in/yaml.v2"
+)
+
+func TestInstanceRestartedUnmarshal(t *testing.T) {
+	var insRestarted EventInstanceRestarted
+	err := yaml.Unmarshal([]byte(testutil.InsRestartedYaml), &insRestarted)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if insRestarted.InstanceRestarted.InstanceUUID != testutil.InstanceUUID {
+		t.Errorf("Wrong instance UUID field [%s]", insRestarted.InstanceRestarted.InstanceUUID)
+	}
+
+	if insRestarted.InstanceRestarted.Restarts != 2 {
+		t.Errorf("Wrong restarts field [%d]", insRestarted.InstanceRestarted.Restarts)
+	}
+}
+
+func TestInstanceRestartedMarshal(t *testing.T) {
+	var insRestarted EventInstanceRestarted
+
+	insRestarted.InstanceRestarted.InstanceUUID = testutil.InstanceUUID
+	insRestarted.InstanceRestarted.Restarts = 2
+
+	y, err := yaml.Marshal(&insRestarted)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if string(y) != testutil.InsRestartedYaml {
+		t.Errorf("InstanceRestarted marshalling failed\n[%s]\n vs\n[%s]", string(y), testutil.InsRestartedYaml)
+	}
+}
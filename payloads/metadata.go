@@ -0,0 +1,49 @@
+/*
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package payloads
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// Headers set by the CNCI metadata proxy on every request it forwards to
+// the controller metadata service.
+const (
+	// MetadataCNCIHeader carries the UUID of the forwarding CNCI.
+	MetadataCNCIHeader = "X-Ciao-CNCI-ID"
+
+	// MetadataIPHeader carries the IP address of the requesting instance.
+	MetadataIPHeader = "X-Forwarded-For"
+
+	// MetadataMACHeader carries the MAC address of the requesting
+	// instance.
+	MetadataMACHeader = "X-Ciao-Instance-MAC"
+
+	// MetadataSignatureHeader carries the MetadataSignature of the
+	// other headers.
+	MetadataSignatureHeader = "X-Ciao-Metadata-Signature"
+)
+
+// MetadataSignature computes the signature a CNCI attaches to a proxied
+// metadata request for the instance with the given IP and MAC address.
+func MetadataSignature(secret, cnciID, ip, mac string) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	_, _ = h.Write([]byte(cnciID + "\n" + ip + "\n" + mac))
+	return hex.EncodeToString(h.Sum(nil))
+}
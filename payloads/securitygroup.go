@@ -0,0 +1,79 @@
+/*
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package payloads
+
+// SecurityGroupDirection is the direction of the traffic of an instance a
+// security group rule applies to.
+type SecurityGroupDirection string
+
+const (
+	// Ingress rules allow traffic to the instance.
+	Ingress SecurityGroupDirection = "ingress"
+
+	// Egress rules allow traffic from the instance.
+	Egress SecurityGroupDirection = "egress"
+)
+
+// SecurityGroupRule allows a flow of traffic of an instance.  Remote
+// security groups are resolved by the controller, the rules sent to the
+// launchers only contain CIDRs.
+type SecurityGroupRule struct {
+	// Direction tells whether the rule applies to the traffic to or
+	// from the instance.
+	Direction SecurityGroupDirection `yaml:"direction"`
+
+	// Protocol is tcp, udp or icmp.  All protocols are allowed when it
+	// is empty.
+	Protocol string `yaml:"protocol,omitempty"`
+
+	// PortMin and PortMax are the range of ports of the instance
+	// allowed for the tcp and udp protocols.  All ports are allowed
+	// when they are 0.
+	PortMin int `yaml:"port_min,omitempty"`
+	PortMax int `yaml:"port_max,omitempty"`
+
+	// RemoteCIDR is the range of addresses the traffic is allowed
+	// from, for ingress rules, or to, for egress rules.
+	RemoteCIDR string `yaml:"remote_cidr"`
+}
+
+// InstanceSecurity holds the rules enforced on the traffic of an instance.
+// The traffic of an instance is only filtered when Enforced is set, that
+// is when it belongs to security groups, and all the traffic which is not
+// allowed by its rules is then dropped.
+type InstanceSecurity struct {
+	InstanceUUID string              `yaml:"instance_uuid"`
+	Enforced     bool                `yaml:"enforced"`
+	Rules        []SecurityGroupRule `yaml:"rules,omitempty"`
+}
+
+// SecurityGroupsCommand contains the rules of the instances of a tenant
+// running on a node.
+type SecurityGroupsCommand struct {
+	// WorkloadAgentUUID identifies the node the instances are running
+	// on.  This information is needed by the scheduler to route the
+	// command to the correct CN.
+	WorkloadAgentUUID string             `yaml:"workload_agent_uuid"`
+	TenantUUID        string             `yaml:"tenant_uuid"`
+	Instances         []InstanceSecurity `yaml:"instances"`
+}
+
+// CommandConfigureSecurityGroups is a wrapper around SecurityGroupsCommand.
+// It is the ConfigureSecurityGroups command payload.
+type CommandConfigureSecurityGroups struct {
+	SecurityGroups SecurityGroupsCommand `yaml:"configure_security_groups"`
+}
@@ -0,0 +1,132 @@
+/*
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package payloads_test
+
+import (
+	"reflect"
+	"testing"
+
+	. "github.com/01org/ciao/payloads"
+	"github.com/01org/ciao/testutil"
+	"gopkg.in/yaml.v2"
+)
+
+var testSecurityRules = []SecurityGroupRule{
+	{
+		Direction:  Ingress,
+		Protocol:   "tcp",
+		PortMin:    22,
+		PortMax:    22,
+		RemoteCIDR: "0.0.0.0/0",
+	},
+	{
+		Direction:  Egress,
+		RemoteCIDR: testutil.InstancePrivateIP + "/32",
+	},
+}
+
+func TestSecurityGroupsUnmarshal(t *testing.T) {
+	var cmd CommandConfigureSecurityGroups
+
+	err := yaml.Unmarshal([]byte(testutil.SecurityGroupsYaml), &cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cmd.SecurityGroups.WorkloadAgentUUID != testutil.AgentUUID {
+		t.Errorf("Wrong agent UUID field [%s]", cmd.SecurityGroups.WorkloadAgentUUID)
+	}
+
+	if cmd.SecurityGroups.TenantUUID != testutil.TenantUUID {
+		t.Errorf("Wrong tenant UUID field [%s]", cmd.SecurityGroups.TenantUUID)
+	}
+
+	if len(cmd.SecurityGroups.Instances) != 1 {
+		t.Fatalf("Wrong number of instances [%d]", len(cmd.SecurityGroups.Instances))
+	}
+
+	instance := cmd.SecurityGroups.Instances[0]
+	if instance.InstanceUUID != testutil.InstanceUUID {
+		t.Errorf("Wrong instance UUID field [%s]", instance.InstanceUUID)
+	}
+
+	if !instance.Enforced {
+		t.Error("Security groups not enforced")
+	}
+
+	if !reflect.DeepEqual(instance.Rules, testSecurityRules) {
+		t.Errorf("Wrong rules field [%+v]", instance.Rules)
+	}
+}
+
+func TestSecurityGroupsMarshal(t *testing.T) {
+	var cmd CommandConfigureSecurityGroups
+
+	cmd.SecurityGroups.WorkloadAgentUUID = testutil.AgentUUID
+	cmd.SecurityGroups.TenantUUID = testutil.TenantUUID
+	cmd.SecurityGroups.Instances = []InstanceSecurity{
+		{
+			InstanceUUID: testutil.InstanceUUID,
+			Enforced:     true,
+			Rules:        testSecurityRules,
+		},
+	}
+
+	y, err := yaml.Marshal(&cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(y) != testutil.SecurityGroupsYaml {
+		t.Errorf("ConfigureSecurityGroups marshalling failed\n[%s]\n vs\n[%s]", string(y), testutil.SecurityGroupsYaml)
+	}
+}
+
+func TestStartSecurity(t *testing.T) {
+	var cmd Start
+	cmd.Start.InstanceUUID = testutil.InstanceUUID
+	cmd.Start.Security = &InstanceSecurity{
+		InstanceUUID: testutil.InstanceUUID,
+		Enforced:     true,
+		Rules:        testSecurityRules,
+	}
+
+	y, err := yaml.Marshal(&cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var clone Start
+	err = yaml.Unmarshal(y, &clone)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(clone.Start.Security, cmd.Start.Security) {
+		t.Errorf("Security rules lost in\n[%s]", string(y))
+	}
+
+	var start Start
+	err = yaml.Unmarshal([]byte(testutil.StartYaml), &start)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if start.Start.Security != nil {
+		t.Error("Unexpected security rules")
+	}
+}
@@ -86,6 +86,58 @@ const (
 	Docker = "docker"
 )
 
+// Priority is the scheduling priority class of an instance.
+type Priority string
+
+const (
+	// HighPriority instances are dispatched by the scheduler ahead of
+	// all other pending instances.
+	HighPriority Priority = "high"
+
+	// NormalPriority is the default priority class.  An empty priority
+	// is treated as NormalPriority.
+	NormalPriority Priority = "normal"
+
+	// PreemptiblePriority instances are dispatched after all other
+	// pending instances and may be deleted by the scheduler to make room
+	// for instances of a higher priority class.
+	PreemptiblePriority Priority = "preemptible"
+)
+
+// RestartCondition tells when ciao-launcher restarts an instance that
+// exited without being stopped or deleted.
+type RestartCondition string
+
+const (
+	// RestartNever indicates that exited instances are left alone.  An
+	// empty condition is treated as RestartNever.
+	RestartNever RestartCondition = "never"
+
+	// RestartOnFailure indicates that instances exiting while they are
+	// monitored are restarted, at most MaxRestarts times.
+	RestartOnFailure RestartCondition = "on-failure"
+
+	// RestartAlways indicates that instances are restarted whenever they
+	// exit, including those found not running when ciao-launcher starts.
+	RestartAlways RestartCondition = "always"
+)
+
+// RestartPolicy describes how ciao-launcher restarts an instance that
+// exited without being stopped or deleted.
+type RestartPolicy struct {
+	// Condition tells when the instance is restarted.
+	Condition RestartCondition `yaml:"condition" json:"condition"`
+
+	// MaxRestarts is the number of restarts after which an on-failure
+	// instance is left exited.  Zero means no limit.
+	MaxRestarts int `yaml:"max_restarts,omitempty" json:"max_restarts,omitempty"`
+
+	// Backoff is the delay in seconds before the first restart, it
+	// doubles with each following restart.  ciao-launcher waits at least
+	// one second.
+	Backoff int `yaml:"backoff,omitempty" json:"backoff,omitempty"`
+}
+
 // StorageResource represents a requested storage resource for a workload.
 type StorageResource struct {
 	// ID is passed to the Block Driver to operate on the resource
@@ -221,6 +273,24 @@ type StartCmd struct {
 	// Storage contains all the information required to attach or boot
 	// from storage for the new instance.
 	Storage []StorageResource `yaml:"storage,omitempty"`
+
+	// Priority is the scheduling priority class of the new instance.
+	Priority Priority `yaml:"priority,omitempty"`
+
+	// TenantWeight is the fair-share weight of the tenant to which the
+	// new instance belongs.  Tenants with a higher weight get a larger
+	// share of the cluster when the scheduler has a backlog of pending
+	// instances.  A zero weight is treated as 1.
+	TenantWeight int `yaml:"tenant_weight,omitempty"`
+
+	// RestartPolicy tells whether and how the new instance is restarted
+	// when it exits without being stopped.
+	RestartPolicy *RestartPolicy `yaml:"restart_policy,omitempty"`
+
+	// Security holds the rules enforced on the traffic of the new
+	// instance from its creation.  The traffic of instances without
+	// security groups is not filtered.
+	Security *InstanceSecurity `yaml:"security,omitempty"`
 }
 
 // Start represents the unmarshalled version of the contents of a SSNTP START
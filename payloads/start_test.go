@@ -122,3 +122,38 @@ func TestStartUnmarshalPartial(t *testing.T) {
 		t.Error("Unexpected values in Start")
 	}
 }
+
+func TestStartRestartPolicy(t *testing.T) {
+	var cmd Start
+	cmd.Start.InstanceUUID = testutil.InstanceUUID
+	cmd.Start.RestartPolicy = &RestartPolicy{
+		Condition:   RestartOnFailure,
+		MaxRestarts: 3,
+		Backoff:     10,
+	}
+
+	y, err := yaml.Marshal(&cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var clone Start
+	err = yaml.Unmarshal(y, &clone)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if clone.Start.RestartPolicy == nil || *clone.Start.RestartPolicy != *cmd.Start.RestartPolicy {
+		t.Errorf("Restart policy lost in\n[%s]", string(y))
+	}
+
+	var start Start
+	err = yaml.Unmarshal([]byte(testutil.StartYaml), &start)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if start.Start.RestartPolicy != nil {
+		t.Error("Unexpected restart policy")
+	}
+}
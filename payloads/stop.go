@@ -25,6 +25,11 @@ type StopCmd struct {
 	// running.  This information is needed by the scheduler to route
 	// the command to the correct CN/NN.
 	WorkloadAgentUUID string `yaml:"workload_agent_uuid"`
+
+	// Reason is only used by DELETE commands.  It is reported back by
+	// ciao-launcher in the InstanceDeleted event once the instance has
+	// been deleted.
+	Reason InstanceDeletedReason `yaml:"reason,omitempty"`
 }
 
 // Stop represents the unmarshalled version of the contents of a SSNTP STOP
@@ -33,8 +33,9 @@ const (
 	// Discard the frame. The frame will be discarded by SSNTP.
 	Discard
 
-	// Queue the frame. SSNTP will queue the frame and the caller will have to call
-	// into the SSNTP Server queueing API to fetch it back.
+	// Queue the frame. SSNTP will not forward the frame. The forwarder
+	// keeps a reference to it and will have to call into the SSNTP Server
+	// queueing API (ForwardQueued) to eventually forward it.
 	Queue
 )
 
@@ -261,8 +262,7 @@ func (f *frameForward) deleteForwardDestination(dest *session) {
 }
 
 func forwardDestination(destination ForwardDestination, server *Server, frame *Frame) {
-	/* TODO Handle queueing */
-	if destination.decision == Discard || destination.recipientUUIDs == nil {
+	if destination.decision != Forward || destination.recipientUUIDs == nil {
 		return
 	}
 
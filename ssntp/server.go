@@ -449,6 +449,13 @@ func (server *Server) SendTracedError(uuid string, error Error, payload []byte,
 	return server.sendError(uuid, error, payload, trace)
 }
 
+// ForwardQueued forwards a frame for which a forwarder previously
+// returned a Queue decision. The frame is sent to the destination
+// recipients, exactly as if it had been forwarded when received.
+func (server *Server) ForwardQueued(destination ForwardDestination, frame *Frame) {
+	forwardDestination(destination, server, frame)
+}
+
 // UUID exports the SSNTP server Universally Unique ID.
 func (server *Server) UUID() string {
 	return server.uuid.String()
@@ -42,7 +42,8 @@ type Type uint8
 
 // Command is the SSNTP Command operand.
 // It can be CONNECT, START, STOP, STATS, EVACUATE, DELETE, RESTART,
-// AssignPublicIP, ReleasePublicIP, CONFIGURE, AttachVolume or DetachVolume.
+// AssignPublicIP, ReleasePublicIP, CONFIGURE, AttachVolume, DetachVolume,
+// ConfigureHealthChecks or ConfigureSecurityGroups.
 type Command uint8
 
 // Status is the SSNTP Status operand.
@@ -62,7 +63,7 @@ type Error uint8
 // Event is the SSNTP Event operand.
 // It can be TenantAdded, TenantRemoval, InstanceDeleted,
 // ConcentratorInstanceAdded, PublicIPAssigned, PublicIPUnassigned, TraceReport,
-// NodeConnected or NodeDisconnected
+// NodeConnected, NodeDisconnected, InstanceRestarted or InstanceHealth
 type Event uint8
 
 const (
@@ -253,6 +254,36 @@ const (
 	//	|       |       | (0x0) |  (0xb)  |                 |                         |
 	//	+-----------------------------------------------------------------------------+
 	DetachVolume
+
+	// ConfigureHealthChecks is a command sent by the Controller to the CNCI
+	// agent of a tenant, through the Scheduler, for checking the health of
+	// the tenant instances from the tenant network.
+	//
+	// The ConfigureHealthChecks command payload includes the CNCI UUID, the
+	// tenant UUID and, for each checked instance, its UUID, its private IP
+	// and the description of its health check.
+	//
+	//                                       SSNTP ConfigureHealthChecks Command frame
+	//	+-----------------------------------------------------------------------------+
+	//	| Major | Minor | Type  | Operand |  Payload Length | YAML formatted payload  |
+	//	|       |       | (0x0) |  (0xc)  |                 |                         |
+	//	+-----------------------------------------------------------------------------+
+	ConfigureHealthChecks
+
+	// ConfigureSecurityGroups is a command sent by the Controller to a
+	// compute node agent, through the Scheduler, for filtering the
+	// traffic of the instances of a tenant running on the node.
+	//
+	// The ConfigureSecurityGroups command payload includes the agent UUID,
+	// the tenant UUID and, for each instance, its UUID, whether its
+	// traffic is filtered and the rules of its security groups.
+	//
+	//                                     SSNTP ConfigureSecurityGroups Command frame
+	//	+-----------------------------------------------------------------------------+
+	//	| Major | Minor | Type  | Operand |  Payload Length | YAML formatted payload  |
+	//	|       |       | (0x0) |  (0xd)  |                 |                         |
+	//	+-----------------------------------------------------------------------------+
+	ConfigureSecurityGroups
 )
 
 const (
@@ -455,6 +486,34 @@ const (
 	//	|       |       | (0x3) |  (0x7)  |                 |                        |
 	//	+----------------------------------------------------------------------------+
 	NodeDisconnected
+
+	// InstanceRestarted is sent by workload agents to notify the Controller that
+	// they restarted an instance which exited on its own, following the instance
+	// restart policy.
+	// The InstanceRestarted event payload contains the instance UUID and the
+	// number of times it was restarted.
+	//
+	//					 SSNTP InstanceRestarted Event frame
+	//
+	//	+----------------------------------------------------------------------------+
+	//	| Major | Minor | Type  | Operand |  Payload Length | YAML formatted payload |
+	//	|       |       | (0x3) |  (0x8)  |                 |                        |
+	//	+----------------------------------------------------------------------------+
+	InstanceRestarted
+
+	// InstanceHealth is sent by CNCI agents to notify the Controller that
+	// the health of an instance changed, as found by its health check.
+	// The InstanceHealth event payload contains the CNCI, tenant and
+	// instance UUIDs, the instance health and the error of the last
+	// failed probe.
+	//
+	//					 SSNTP InstanceHealth Event frame
+	//
+	//	+----------------------------------------------------------------------------+
+	//	| Major | Minor | Type  | Operand |  Payload Length | YAML formatted payload |
+	//	|       |       | (0x3) |  (0x9)  |                 |                        |
+	//	+----------------------------------------------------------------------------+
+	InstanceHealth
 )
 
 // SSNTP clients and servers can have one or several roles and are expected to declare their
@@ -605,6 +664,10 @@ func (command Command) String() string {
 		return "Attach storage volume"
 	case DetachVolume:
 		return "Detach storage volume"
+	case ConfigureHealthChecks:
+		return "Configure health checks"
+	case ConfigureSecurityGroups:
+		return "Configure security groups"
 	}
 
 	return ""
@@ -647,6 +710,10 @@ func (status Event) String() string {
 		return "Node Connected"
 	case NodeDisconnected:
 		return "Node Disconnected"
+	case InstanceRestarted:
+		return "Instance Restarted"
+	case InstanceHealth:
+		return "Instance Health"
 	}
 
 	return ""
@@ -2483,6 +2483,8 @@ func TestCommandStringer(t *testing.T) {
 		{CONFIGURE, "CONFIGURE"},
 		{AttachVolume, "Attach storage volume"},
 		{DetachVolume, "Detach storage volume"},
+		{ConfigureHealthChecks, "Configure health checks"},
+		{ConfigureSecurityGroups, "Configure security groups"},
 	}
 
 	for _, test := range stringTests {
@@ -2526,6 +2528,8 @@ func TestEventStringer(t *testing.T) {
 		{TraceReport, "Trace Report"},
 		{NodeConnected, "Node Connected"},
 		{NodeDisconnected, "Node Disconnected"},
+		{InstanceRestarted, "Instance Restarted"},
+		{InstanceHealth, "Instance Health"},
 	}
 
 	for _, test := range stringTests {
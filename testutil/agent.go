@@ -504,6 +504,38 @@ func (client *SsntpTestClient) handleDetachVolume(payload []byte) Result {
 	return result
 }
 
+func (client *SsntpTestClient) handleConfigureHealthChecks(payload []byte) Result {
+	var result Result
+	var cmd payloads.CommandConfigureHealthChecks
+
+	err := yaml.Unmarshal(payload, &cmd)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	result.NodeUUID = cmd.HealthChecks.ConcentratorUUID
+	result.TenantUUID = cmd.HealthChecks.TenantUUID
+
+	return result
+}
+
+func (client *SsntpTestClient) handleConfigureSecurityGroups(payload []byte) Result {
+	var result Result
+	var cmd payloads.CommandConfigureSecurityGroups
+
+	err := yaml.Unmarshal(payload, &cmd)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	result.NodeUUID = cmd.SecurityGroups.WorkloadAgentUUID
+	result.TenantUUID = cmd.SecurityGroups.TenantUUID
+
+	return result
+}
+
 // CommandNotify implements the SSNTP client CommandNotify callback for SsntpTestClient
 func (client *SsntpTestClient) CommandNotify(command ssntp.Command, frame *ssntp.Frame) {
 	payload := frame.Payload
@@ -544,6 +576,12 @@ func (client *SsntpTestClient) CommandNotify(command ssntp.Command, frame *ssntp
 	case ssntp.DetachVolume:
 		result = client.handleDetachVolume(payload)
 
+	case ssntp.ConfigureHealthChecks:
+		result = client.handleConfigureHealthChecks(payload)
+
+	case ssntp.ConfigureSecurityGroups:
+		result = client.handleConfigureSecurityGroups(payload)
+
 	default:
 		fmt.Fprintf(os.Stderr, "client %s unhandled command %s\n", client.Role.String(), command.String())
 	}
@@ -685,6 +723,57 @@ func (client *SsntpTestClient) SendDeleteEvent(uuid string) {
 	go client.SendResultAndDelEventChan(ssntp.InstanceDeleted, result)
 }
 
+// SendRestartedEvent allows an SsntpTestClient to push an ssntp.InstanceRestarted event frame
+func (client *SsntpTestClient) SendRestartedEvent(uuid string, restarts int) {
+	var result Result
+
+	event := payloads.EventInstanceRestarted{
+		InstanceRestarted: payloads.InstanceRestartedEvent{
+			InstanceUUID: uuid,
+			Restarts:     restarts,
+		},
+	}
+
+	y, err := yaml.Marshal(event)
+	if err != nil {
+		result.Err = err
+	} else {
+		_, err = client.Ssntp.SendEvent(ssntp.InstanceRestarted, y)
+		if err != nil {
+			result.Err = err
+		}
+	}
+
+	go client.SendResultAndDelEventChan(ssntp.InstanceRestarted, result)
+}
+
+// SendInstanceHealthEvent allows an SsntpTestClient to push an ssntp.InstanceHealth event frame
+func (client *SsntpTestClient) SendInstanceHealthEvent(uuid string, health payloads.HealthStatus, reason string) {
+	var result Result
+
+	event := payloads.EventInstanceHealth{
+		InstanceHealth: payloads.InstanceHealthEvent{
+			ConcentratorUUID: CNCIUUID,
+			TenantUUID:       TenantUUID,
+			InstanceUUID:     uuid,
+			Health:           health,
+			Reason:           reason,
+		},
+	}
+
+	y, err := yaml.Marshal(event)
+	if err != nil {
+		result.Err = err
+	} else {
+		_, err = client.Ssntp.SendEvent(ssntp.InstanceHealth, y)
+		if err != nil {
+			result.Err = err
+		}
+	}
+
+	go client.SendResultAndDelEventChan(ssntp.InstanceHealth, result)
+}
+
 // SendTenantAddedEvent allows an SsntpTestClient to push an ssntp.TenantAdded event frame
 func (client *SsntpTestClient) SendTenantAddedEvent() {
 	var result Result
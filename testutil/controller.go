@@ -309,6 +309,20 @@ func (ctl *SsntpTestController) EventNotify(event ssntp.Event, frame *ssntp.Fram
 		if err != nil {
 			result.Err = err
 		}
+	case ssntp.InstanceRestarted:
+		var restartedEvent payloads.EventInstanceRestarted
+
+		err := yaml.Unmarshal(frame.Payload, &restartedEvent)
+		if err != nil {
+			result.Err = err
+		}
+	case ssntp.InstanceHealth:
+		var healthEvent payloads.EventInstanceHealth
+
+		err := yaml.Unmarshal(frame.Payload, &healthEvent)
+		if err != nil {
+			result.Err = err
+		}
 	case ssntp.TraceReport:
 		var traceEvent payloads.Trace
 
@@ -273,6 +273,14 @@ const DeleteYaml = `delete:
   workload_agent_uuid: ` + AgentUUID + `
 `
 
+// PreemptYaml is a sample DELETE ssntp.Command payload sent by the
+// scheduler to preempt an instance
+const PreemptYaml = `delete:
+  instance_uuid: ` + InstanceUUID + `
+  workload_agent_uuid: ` + AgentUUID + `
+  reason: preempted
+`
+
 // EvacuateYaml is a sample node EVACUATE ssntp.Command payload for test cases
 const EvacuateYaml = `evacuate:
   workload_agent_uuid: ` + AgentUUID + `
@@ -387,6 +395,62 @@ const InsDelYaml = `instance_deleted:
   instance_uuid: ` + InstanceUUID + `
 `
 
+// InsDelPreemptedYaml is a sample InstanceDeleted ssntp.Event payload for
+// an instance preempted by the scheduler
+const InsDelPreemptedYaml = `instance_deleted:
+  instance_uuid: ` + InstanceUUID + `
+  reason: preempted
+`
+
+// InsRestartedYaml is a sample workload InstanceRestarted ssntp.Event payload for test cases
+const InsRestartedYaml = `instance_restarted:
+  instance_uuid: ` + InstanceUUID + `
+  restarts: 2
+`
+
+// HealthChecksYaml is a sample ConfigureHealthChecks ssntp.Command payload for test cases
+const HealthChecksYaml = `configure_health_checks:
+  concentrator_uuid: ` + CNCIUUID + `
+  tenant_uuid: ` + TenantUUID + `
+  targets:
+  - instance_uuid: ` + InstanceUUID + `
+    private_ip: ` + InstancePrivateIP + `
+    check:
+      protocol: http
+      port: 80
+      path: /healthz
+      interval: 10
+      timeout: 5
+      healthy_threshold: 2
+      unhealthy_threshold: 3
+`
+
+// InstanceHealthYaml is a sample InstanceHealth ssntp.Event payload for test cases
+const InstanceHealthYaml = `instance_health:
+  concentrator_uuid: ` + CNCIUUID + `
+  tenant_uuid: ` + TenantUUID + `
+  instance_uuid: ` + InstanceUUID + `
+  health: unhealthy
+  reason: connection refused
+`
+
+// SecurityGroupsYaml is a sample ConfigureSecurityGroups ssntp.Command payload for test cases
+const SecurityGroupsYaml = `configure_security_groups:
+  workload_agent_uuid: ` + AgentUUID + `
+  tenant_uuid: ` + TenantUUID + `
+  instances:
+  - instance_uuid: ` + InstanceUUID + `
+    enforced: true
+    rules:
+    - direction: ingress
+      protocol: tcp
+      port_min: 22
+      port_max: 22
+      remote_cidr: 0.0.0.0/0
+    - direction: egress
+      remote_cidr: ` + InstancePrivateIP + `/32
+`
+
 // NodeConnectedYaml is a sample node NodeConnected ssntp.Event payload for test cases
 const NodeConnectedYaml = `node_connected:
   node_uuid: ` + AgentUUID + `
@@ -453,6 +453,14 @@ func (server *SsntpTestServer) EventNotify(uuid string, event ssntp.Event, frame
 		var deleteEvent payloads.EventInstanceDeleted
 
 		result.Err = yaml.Unmarshal(payload, &deleteEvent)
+	case ssntp.InstanceRestarted:
+		var restartedEvent payloads.EventInstanceRestarted
+
+		result.Err = yaml.Unmarshal(payload, &restartedEvent)
+	case ssntp.InstanceHealth:
+		var healthEvent payloads.EventInstanceHealth
+
+		result.Err = yaml.Unmarshal(payload, &healthEvent)
 	case ssntp.ConcentratorInstanceAdded:
 		// forward rule auto-sends to controllers
 	case ssntp.TenantAdded:
@@ -636,6 +644,27 @@ func (server *SsntpTestServer) handleDetachVolume(payload []byte) ssntp.ForwardD
 	return dest
 }
 
+func (server *SsntpTestServer) handleConfigureSecurityGroups(payload []byte) ssntp.ForwardDestination {
+	var cmd payloads.CommandConfigureSecurityGroups
+	var dest ssntp.ForwardDestination
+
+	err := yaml.Unmarshal(payload, &cmd)
+	if err != nil {
+		return dest
+	}
+
+	server.clientsLock.Lock()
+	defer server.clientsLock.Unlock()
+
+	for _, c := range server.clients {
+		if c == cmd.SecurityGroups.WorkloadAgentUUID {
+			dest.AddRecipient(c)
+		}
+	}
+
+	return dest
+}
+
 // CommandForward implements an SSNTP CommandForward callback for SsntpTestServer
 func (server *SsntpTestServer) CommandForward(uuid string, command ssntp.Command, frame *ssntp.Frame) (dest ssntp.ForwardDestination) {
 	payload := frame.Payload
@@ -647,6 +676,8 @@ func (server *SsntpTestServer) CommandForward(uuid string, command ssntp.Command
 		dest = server.handleAttachVolume(payload)
 	case ssntp.DetachVolume:
 		dest = server.handleDetachVolume(payload)
+	case ssntp.ConfigureSecurityGroups:
+		dest = server.handleConfigureSecurityGroups(payload)
 	case ssntp.EVACUATE:
 		fallthrough
 	case ssntp.STOP:
@@ -698,6 +729,14 @@ func StartTestServer() *SsntpTestServer {
 				Operand: ssntp.InstanceDeleted,
 				Dest:    ssntp.Controller,
 			},
+			{ // all InstanceRestarted events go to all Controllers
+				Operand: ssntp.InstanceRestarted,
+				Dest:    ssntp.Controller,
+			},
+			{ // all InstanceHealth events go to all Controllers
+				Operand: ssntp.InstanceHealth,
+				Dest:    ssntp.Controller,
+			},
 			{ // all ConcentratorInstanceAdded events go to all Controllers
 				Operand: ssntp.ConcentratorInstanceAdded,
 				Dest:    ssntp.Controller,
@@ -766,6 +805,10 @@ func StartTestServer() *SsntpTestServer {
 				Operand:        ssntp.DetachVolume,
 				CommandForward: server,
 			},
+			{ // all ConfigureSecurityGroups commands are processed by the Command forwarder
+				Operand:        ssntp.ConfigureSecurityGroups,
+				CommandForward: server,
+			},
 		},
 	}
 